@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/objstore"
+)
+
+var (
+	backfillCheckpoint    string
+	backfillWriteInvoices bool
+	backfillTimeout       time.Duration
+	backfillEndpoint      string
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill <source> <destination>",
+	Short: "Process the documents under an object storage prefix",
+	Long: `Process every object under a source prefix and write each result as JSON
+under the destination prefix, as <key>.result.json (and the extracted invoice
+as <key>.invoice.json with --invoices).
+
+Locations are s3://bucket/prefix, gs://bucket/prefix, an Azure container URL
+with a SAS token (https://account.blob.core.windows.net/container/prefix?sv=...)
+or a local directory. S3 credentials and region come from the AWS environment
+variables; GCS uses HMAC keys in GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY.
+
+Objects are processed in key order. With --checkpoint the last finished key
+is saved after each object, so an interrupted backfill resumes after it.
+
+Examples:
+  invoice-processor backfill s3://invoices/2024/ s3://invoices/results/2024/ \
+    --checkpoint backfill-2024.txt
+  invoice-processor backfill gs://archive/scans/ ./results --invoices`,
+	Args: cobra.ExactArgs(2),
+	RunE: runBackfill,
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+
+	backfillCmd.Flags().StringVar(&backfillCheckpoint, "checkpoint", "", "File recording progress, to resume an interrupted backfill")
+	backfillCmd.Flags().BoolVar(&backfillWriteInvoices, "invoices", false, "Also write each extracted invoice on its own")
+	backfillCmd.Flags().DurationVar(&backfillTimeout, "timeout", 2*time.Minute, "Processing timeout per object")
+	backfillCmd.Flags().StringVar(&backfillEndpoint, "s3-endpoint", "", "Endpoint of an S3-compatible service for s3:// locations")
+	addExtractionFlags(backfillCmd)
+}
+
+// openLocation returns the bucket and prefix of a backfill location
+func openLocation(location string) (objstore.Bucket, string, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 { // C:\ on Windows
+		return objstore.DirBucket(location), "", nil
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		bucket, err := objstore.NewS3Bucket(objstore.S3Config{Bucket: u.Host, Endpoint: backfillEndpoint})
+		return bucket, prefix, err
+	case "gs":
+		bucket, err := objstore.NewGCSBucket(u.Host, os.Getenv("GCS_ACCESS_KEY_ID"), os.Getenv("GCS_SECRET_ACCESS_KEY"))
+		return bucket, prefix, err
+	case "https":
+		// The first path segment is the container, the rest the prefix
+		container, prefix, _ := strings.Cut(prefix, "/")
+		u.Path = "/" + container
+		bucket, err := objstore.NewAzureBucket(u.String(), nil)
+		return bucket, prefix, err
+	default:
+		return nil, "", fmt.Errorf("unsupported location %q (s3://, gs://, https:// or a directory)", location)
+	}
+}
+
+// sameBucket reports whether two cloud locations name the same bucket
+func sameBucket(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil || len(ua.Scheme) < 2 {
+		return false
+	}
+	if ua.Scheme == "https" {
+		containerA, _, _ := strings.Cut(strings.TrimPrefix(ua.Path, "/"), "/")
+		containerB, _, _ := strings.Cut(strings.TrimPrefix(ub.Path, "/"), "/")
+		return ub.Scheme == "https" && ua.Host == ub.Host && containerA == containerB
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+func runBackfill(cmd *cobra.Command, args []string) error {
+	src, prefix, err := openLocation(args[0])
+	if err != nil {
+		return err
+	}
+	dst, outputPrefix, err := openLocation(args[1])
+	if err != nil {
+		return err
+	}
+	if sameBucket(args[0], args[1]) {
+		dst = src // Lets NewBackfill reject an output prefix inside the input
+	}
+
+	cfg := objstore.Config{
+		Prefix:        prefix,
+		OutputPrefix:  outputPrefix,
+		WriteInvoices: backfillWriteInvoices,
+		Timeout:       backfillTimeout,
+	}
+	if backfillCheckpoint != "" {
+		cfg.Checkpoint = objstore.FileCheckpoint(backfillCheckpoint)
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	backfill, err := objstore.NewBackfill(pipeline, src, dst, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	start := time.Now()
+	summary, err := backfill.Run(ctx)
+	fmt.Fprintf(os.Stderr, "Processed %d objects in %s: %d succeeded, %d failed, %d skipped\n",
+		summary.Objects, time.Since(start).Round(time.Millisecond), summary.Succeeded, summary.Failed, summary.Skipped)
+	if summary.LastKey != "" {
+		printVerbose("Last object: %s\n", summary.LastKey)
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+var (
+	batchWorkers     int
+	batchStopOnError bool
+	batchTimeout     time.Duration
+	batchSplit       bool
+	batchCheckpoint  string
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [directories or files...]",
+	Short: "Process a directory of invoices concurrently",
+	Long: `Process every supported file in directories (recursively) or in the
+given files, several at a time, and print a summary to stderr.
+
+Results are written in the order of the files, in the --format chosen
+(json, jsonl, csv, table or xlsx); xlsx needs --output. Failed documents are
+reported with their error and don't stop the batch unless --stop-on-error is
+set, in which case the files not yet started are skipped.
+
+On SIGINT or SIGTERM no more files are started, and those in flight get
+--shutdown-timeout to finish. With --checkpoint, the files finished are
+appended to a file that the next run reads to skip them, so an interrupted
+batch resumes where it stopped. Each run writes the results of its own files.
+
+Examples:
+  invoice-processor batch invoices/ -o results.json
+  invoice-processor batch invoices/ --workers 8 -f xlsx -o results.xlsx
+  invoice-processor batch inbox/ --llm-model gpt-4o-mini -f jsonl
+  invoice-processor batch archive/ --checkpoint archive.done -f jsonl >> results.jsonl`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBatch,
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	batchCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: stdout)")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", processor.DefaultBatchWorkers, "Files processed at once")
+	batchCmd.Flags().BoolVar(&batchStopOnError, "stop-on-error", false, "Skip the remaining files after a failed document")
+	batchCmd.Flags().DurationVar(&batchTimeout, "timeout", 2*time.Minute, "Processing timeout per file")
+	batchCmd.Flags().BoolVar(&batchSplit, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	batchCmd.Flags().StringVar(&batchCheckpoint, "checkpoint", "", "File listing the files finished, to skip them when resuming")
+	addExtractionFlags(batchCmd)
+}
+
+func runBatch(cmd *cobra.Command, args []string) error {
+	files, err := collectFiles(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files found to process")
+	}
+
+	var checkpoint *batchCheckpointFile
+	if batchCheckpoint != "" {
+		if checkpoint, err = openBatchCheckpoint(batchCheckpoint); err != nil {
+			return err
+		}
+		defer checkpoint.Close()
+		files = slices.DeleteFunc(files, checkpoint.Finished)
+		if len(files) == 0 {
+			printVerbose("All files are in the checkpoint\n")
+			return outputResults(nil)
+		}
+	}
+
+	inputs := make([]processor.BatchInput, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		inputs = append(inputs, processor.BatchInput{Name: file, Data: data})
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	opts := processor.BatchOptions{
+		Workers:         batchWorkers,
+		ContinueOnError: !batchStopOnError,
+		Timeout:         batchTimeout,
+		SplitDocuments:  batchSplit,
+	}
+	if checkpoint != nil {
+		opts.Done = checkpoint.Add
+	}
+	printVerbose("Processing %d files with %d workers\n", len(inputs), batchWorkers)
+	pipelineResults, summary := pipeline.ProcessBatch(ctx, inputs, opts)
+
+	// Source names the file, and the archive member or attachment if any
+	results := make([]*ProcessResult, 0, len(pipelineResults))
+	for _, r := range pipelineResults {
+		results = append(results, convertResults(r.Source, []*processor.Result{r})...)
+	}
+	for _, r := range results {
+		r.Source = ""
+	}
+
+	fmt.Fprintf(os.Stderr, "Processed %d documents from %d files in %s: %d succeeded, %d failed, %d skipped\n",
+		summary.Documents, summary.Inputs, summary.Duration.Round(time.Millisecond), summary.Succeeded, summary.Failed, summary.Skipped)
+	if usage := summary.Usage; usage.PromptTokens+usage.CompletionTokens > 0 {
+		fmt.Fprintf(os.Stderr, "LLM tokens: %d prompt, %d completion\n", usage.PromptTokens, usage.CompletionTokens)
+	}
+
+	if err := outputResults(results); err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		return checkpoint.Err()
+	}
+	return nil
+}
+
+// batchCheckpointFile records the files a batch finished, one per line
+type batchCheckpointFile struct {
+	mu       sync.Mutex
+	f        *os.File
+	finished map[string]bool
+	err      error
+}
+
+func openBatchCheckpoint(path string) (*batchCheckpointFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	finished := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			finished[line] = true
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	return &batchCheckpointFile{f: f, finished: finished}, nil
+}
+
+// Finished reports whether a previous run finished file
+func (c *batchCheckpointFile) Finished(file string) bool {
+	return c.finished[file]
+}
+
+// Add records a finished input; it is called from the batch workers
+func (c *batchCheckpointFile) Add(_ int, input processor.BatchInput, _ []*processor.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintln(c.f, input.Name); err != nil && c.err == nil {
+		c.err = fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+}
+
+// Err returns the first write error
+func (c *batchCheckpointFile) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *batchCheckpointFile) Close() error {
+	return c.f.Close()
+}
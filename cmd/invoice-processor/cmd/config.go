@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/config"
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+// fileConfig is the configuration file given with --config, if any
+var fileConfig *config.Config
+
+// loadConfig reads --config and sets the flags of cmd not given on the
+// command line from it. Flags win over the file, and the file over the LLM_*
+// environment variables.
+func loadConfig(cmd *cobra.Command) error {
+	if configFile == "" {
+		return nil
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	fileConfig = cfg
+
+	flags := configFlags(cfg)
+	maps.Copy(flags, connectorFlags(cmd, cfg))
+	for name, value := range flags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed {
+			continue // Not a flag of this command, or given
+		}
+		for _, v := range value {
+			if err := cmd.Flags().Set(name, v); err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %w", configFile, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configFlags maps the settings of cfg to the flags they stand for
+func configFlags(cfg *config.Config) map[string][]string {
+	flags := make(map[string][]string)
+	str := func(name, value string) {
+		if value != "" {
+			flags[name] = []string{value}
+		}
+	}
+	num := func(name string, value int) {
+		if value != 0 {
+			flags[name] = []string{strconv.Itoa(value)}
+		}
+	}
+	duration := func(name string, value time.Duration) {
+		if value != 0 {
+			flags[name] = []string{value.String()}
+		}
+	}
+	boolean := func(name string, value bool) {
+		if value {
+			flags[name] = []string{"true"}
+		}
+	}
+
+	l := cfg.LLM
+	str("api-key", l.APIKey)
+	str("llm-provider", l.Provider)
+	str("llm-base-url", l.BaseURL)
+	str("llm-model", l.Model)
+	str("llm-vision-model", l.VisionModel)
+	str("llm-prompts-dir", l.PromptsDir)
+	str("llm-examples", l.Examples)
+	str("llm-cache-dir", l.CacheDir)
+	str("llm-proxy", l.Proxy)
+	str("llm-audit-log", l.AuditLog)
+	duration("llm-timeout", l.Timeout)
+	boolean("llm-audit-bodies", l.AuditBodies)
+	boolean("llm-prompt-caching", l.PromptCaching)
+	num("llm-circuit-breaker", l.CircuitBreaker)
+	for name, value := range l.Headers {
+		flags["llm-header"] = append(flags["llm-header"], name+": "+value)
+	}
+	if len(l.ExtraBody) > 0 {
+		body, _ := json.Marshal(l.ExtraBody)
+		str("llm-extra-body", string(body))
+	}
+	if l.Temperature != nil {
+		str("temperature", strconv.FormatFloat(*l.Temperature, 'g', -1, 64))
+	}
+	if l.TopP != 0 {
+		str("top-p", strconv.FormatFloat(l.TopP, 'g', -1, 64))
+	}
+	if l.MaxTokens != 0 {
+		str("max-tokens", strconv.FormatInt(l.MaxTokens, 10))
+	}
+
+	e := cfg.Extraction
+	str("strategies", strings.Join(e.Strategies, ","))
+	str("vendors", e.Vendors)
+	str("classifier-model", e.ClassifierModel)
+	num("samples", e.Samples)
+	num("image-max-side", e.ImageMaxSide)
+	boolean("ensemble", e.Ensemble)
+	boolean("race", e.Race)
+	boolean("recover-fields", e.RecoverFields)
+	boolean("redact-pii", e.RedactPII)
+	boolean("bounding-boxes", e.BoundingBoxes)
+	boolean("check-arithmetic", e.CheckArithmetic)
+	boolean("check-tax-ids", e.CheckTaxIDs)
+	boolean("llm-addresses", e.LLMAddresses)
+	boolean("raw-responses", e.RawResponses)
+	boolean("detect-duplicates", e.Duplicates)
+	boolean("preclassify", e.Preclassify)
+	duration("deadline", e.Deadline)
+	// The flags take 0 for what the file writes -1
+	if e.MergePages != 0 {
+		flags["merge-pages"] = []string{strconv.Itoa(max(e.MergePages, 0))}
+	}
+	if e.MaxTextTokens != 0 {
+		flags["max-text-tokens"] = []string{strconv.Itoa(max(e.MaxTextTokens, 0))}
+	}
+
+	str("webhook-url", cfg.Webhook.URL)
+	str("webhook-secret", cfg.Webhook.Secret)
+	str("events-file", cfg.Events.File)
+	return flags
+}
+
+// connectorFlags maps the connector section of cmd to its flags. The
+// commands share flag names, such as --timeout, so each reads only its own.
+func connectorFlags(cmd *cobra.Command, cfg *config.Config) map[string][]string {
+	flags := make(map[string][]string)
+	set := func(name, value string) {
+		if value != "" && value != "0s" && value != "0" && value != "false" {
+			flags[name] = []string{value}
+		}
+	}
+	switch cmd {
+	case watchCmd:
+		w := cfg.Connectors.Watch
+		set("output-dir", w.OutputDir)
+		set("quarantine-dir", w.QuarantineDir)
+		set("processed-dir", w.ProcessedDir)
+		set("interval", w.Interval.String())
+		set("timeout", w.Timeout.String())
+		set("split", strconv.FormatBool(w.Split))
+	case consumeCmd:
+		q := cfg.Connectors.Queue
+		set("broker", q.Broker)
+		set("input", q.Input)
+		set("output", q.Output)
+		set("dead-letter", q.DeadLetter)
+		set("nats-url", q.NATSURL)
+		set("durable", q.Durable)
+		if len(q.KafkaBrokers) > 0 {
+			set("kafka-brokers", strings.Join(q.KafkaBrokers, ","))
+		}
+		set("group", q.Group)
+		set("max-attempts", strconv.Itoa(q.MaxAttempts))
+		set("max-size", strconv.FormatInt(q.MaxSize, 10))
+		set("timeout", q.Timeout.String())
+	case imapCmd:
+		m := cfg.Connectors.IMAP
+		set("addr", m.Addr)
+		set("user", m.User)
+		set("password", m.Password)
+		set("mailbox", m.Mailbox)
+		set("flag", m.Flag)
+		set("interval", m.Interval.String())
+		set("timeout", m.Timeout.String())
+		set("insecure", strconv.FormatBool(m.Insecure))
+	case sftpCmd:
+		s := cfg.Connectors.SFTP
+		set("addr", s.Addr)
+		set("user", s.User)
+		set("password", s.Password)
+		set("key", s.KeyFile)
+		set("key-passphrase", s.KeyPassphrase)
+		set("known-hosts", s.KnownHosts)
+		set("host-key", s.HostKey)
+		set("dir", s.Dir)
+		set("processed-dir", s.ProcessedDir)
+		set("failed-dir", s.FailedDir)
+		set("min-age", s.MinAge.String())
+		set("interval", s.Interval.String())
+		set("timeout", s.Timeout.String())
+		set("split", strconv.FormatBool(s.Split))
+		if len(s.Patterns) > 0 {
+			flags["pattern"] = s.Patterns
+		}
+	case driveCmd:
+		d := cfg.Connectors.Drive
+		set("interval", d.Interval.String())
+		set("timeout", d.Timeout.String())
+		set("split", strconv.FormatBool(d.Split))
+	}
+	return flags
+}
+
+// configExtractorOptions returns the LLM settings of the configuration file
+// that have no flag
+func configExtractorOptions() (clientOpts []llm.ClientOption, extractorOpts []llm.ExtractorOption) {
+	if fileConfig == nil {
+		return nil, nil
+	}
+	l := fileConfig.LLM
+	if l.RequestTimeout > 0 {
+		clientOpts = append(clientOpts, llm.WithRequestTimeout(l.RequestTimeout))
+	}
+	if l.MaxConcurrency > 0 {
+		clientOpts = append(clientOpts, llm.WithMaxConcurrency(l.MaxConcurrency))
+	}
+	if l.RequestsPerSecond > 0 || l.TokensPerMinute > 0 {
+		clientOpts = append(clientOpts, llm.WithRateLimit("", llm.RateLimit{
+			RequestsPerSecond: l.RequestsPerSecond,
+			TokensPerMinute:   l.TokensPerMinute,
+		}))
+	}
+	if len(l.FallbackModels) > 0 {
+		extractorOpts = append(extractorOpts, llm.WithFallbackModels(l.FallbackModels...))
+	}
+	if len(l.VisionFallbackModels) > 0 {
+		extractorOpts = append(extractorOpts, llm.WithVisionFallbackModels(l.VisionFallbackModels...))
+	}
+	if l.MaxAttempts > 0 {
+		retry := llm.DefaultRetryPolicy
+		retry.MaxAttempts = l.MaxAttempts
+		extractorOpts = append(extractorOpts, llm.WithRetryPolicy(retry))
+	}
+	return clientOpts, extractorOpts
+}
+
+// configPipelineOptions returns the pipeline settings of the configuration
+// file that have no flag
+func configPipelineOptions() ([]processor.PipelineOption, error) {
+	if fileConfig == nil {
+		return nil, nil
+	}
+	opts := []processor.PipelineOption{processor.WithValidation(fileConfig.ValidationEnabled())}
+	rules, err := fileConfig.ValidationRules()
+	if err != nil {
+		return nil, err
+	}
+	if rules != nil {
+		opts = append(opts, processor.WithValidationRules(rules...))
+	}
+	tenants, err := fileConfig.ProcessorTenants()
+	if err != nil {
+		return nil, err
+	}
+	if tenants != nil {
+		opts = append(opts, processor.WithTenants(tenants))
+	}
+	if budget := fileConfig.BudgetController(); budget != nil {
+		opts = append(opts, processor.WithBudget(budget))
+	}
+	mapping, err := fileConfig.SpreadsheetMapping()
+	if err != nil {
+		return nil, err
+	}
+	if mapping != nil {
+		opts = append(opts, processor.WithSpreadsheetMapping(*mapping))
+	}
+	if len(fileConfig.Extraction.Units) > 0 {
+		opts = append(opts, processor.WithUnitMapping(fileConfig.Extraction.Units))
+	}
+	return opts, nil
+}
+
+// configStore opens the store of the configuration file, if any. SQL stores
+// need a database/sql driver built into the binary.
+func configStore(ctx context.Context) (store.Store, func(), error) {
+	if fileConfig == nil {
+		return nil, func() {}, nil
+	}
+	s := fileConfig.Store
+	switch s.Type {
+	case config.StoreMemory:
+		return store.NewMemoryStore(), func() {}, nil
+	case config.StoreSQLite, config.StorePostgres:
+		driver := s.Driver
+		if driver == "" {
+			driver = s.Type
+		}
+		db, err := sql.Open(driver, s.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open store: %w", err)
+		}
+		newStore := store.NewPostgres
+		if s.Type == config.StoreSQLite {
+			newStore = store.NewSQLite
+		}
+		sqlStore, err := newStore(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return sqlStore, func() { db.Close() }, nil
+	}
+	return nil, func() {}, nil
+}
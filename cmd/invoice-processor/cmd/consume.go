@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+var (
+	consumeBroker      string
+	consumeInput       string
+	consumeOutput      string
+	consumeDeadLetter  string
+	consumeNATSURL     string
+	consumeDurable     string
+	consumeKafka       string
+	consumeKafkaTLS    bool
+	consumeGroup       string
+	consumeMaxAttempts int
+	consumeTimeout     time.Duration
+	consumeMaxSize     int64
+	consumeOnce        bool
+)
+
+var consumeCmd = &cobra.Command{
+	Use:   "consume",
+	Short: "Process documents from a message queue",
+	Long: `Read documents from a queue, process them and publish the results to
+another queue.
+
+A message is a JSON document ({"id", "filename", "url"} to fetch, or "data"
+in base64) or the raw document, named by its document_id and filename
+attributes. Results are published as {"message_id", "document_id",
+"results"}. A message is acknowledged only once its results are published,
+so nothing is lost if the consumer stops (it may be processed twice).
+Messages that can't be decoded, or fetched or published after
+--max-attempts deliveries, go to the dead-letter queue.
+
+Queues are SQS queue URLs (credentials and region from the AWS environment
+variables), NATS subjects stored by a JetStream stream, read through a
+durable pull consumer created if missing, or Kafka topics, read as a member
+of --group (SASL PLAIN credentials from KAFKA_USERNAME and KAFKA_PASSWORD).
+Kafka offsets are committed only up to the oldest message not yet
+acknowledged.
+
+Examples:
+  invoice-processor consume --broker sqs \
+    --input https://sqs.ap-southeast-1.amazonaws.com/123456789012/invoices \
+    --output https://sqs.ap-southeast-1.amazonaws.com/123456789012/results \
+    --dead-letter https://sqs.ap-southeast-1.amazonaws.com/123456789012/invoices-dlq
+  invoice-processor consume --broker nats --nats-url nats://localhost:4222 \
+    --input invoices --output results --dead-letter invoices-dlq
+  invoice-processor consume --broker kafka --kafka-brokers kafka-1:9092,kafka-2:9092 \
+    --input invoices --output results --dead-letter invoices-dlq`,
+	Args: cobra.NoArgs,
+	RunE: runConsume,
+}
+
+func init() {
+	rootCmd.AddCommand(consumeCmd)
+
+	consumeCmd.Flags().StringVar(&consumeBroker, "broker", "sqs", "Message broker: sqs, nats or kafka")
+	consumeCmd.Flags().StringVar(&consumeInput, "input", "", "Queue to read documents from")
+	consumeCmd.Flags().StringVar(&consumeOutput, "output", "", "Queue to publish results to")
+	consumeCmd.Flags().StringVar(&consumeDeadLetter, "dead-letter", "", "Queue for messages that can't be processed (default: redelivered)")
+	consumeCmd.Flags().StringVar(&consumeNATSURL, "nats-url", queue.DefaultNATSURL, "NATS server URL (env: NATS_URL)")
+	consumeCmd.Flags().StringVar(&consumeDurable, "durable", queue.DefaultNATSDurable, "NATS durable consumer")
+	consumeCmd.Flags().StringVar(&consumeKafka, "kafka-brokers", queue.DefaultKafkaBroker, "Kafka bootstrap brokers, comma-separated (env: KAFKA_BROKERS)")
+	consumeCmd.Flags().BoolVar(&consumeKafkaTLS, "kafka-tls", false, "Connect to Kafka with TLS")
+	consumeCmd.Flags().StringVar(&consumeGroup, "group", queue.DefaultKafkaGroup, "Kafka consumer group")
+	consumeCmd.Flags().IntVar(&consumeMaxAttempts, "max-attempts", queue.DefaultMaxAttempts, "Deliveries before a message is dead-lettered")
+	consumeCmd.Flags().DurationVar(&consumeTimeout, "timeout", 5*time.Minute, "Processing timeout per message")
+	consumeCmd.Flags().Int64Var(&consumeMaxSize, "max-size", queue.DefaultMaxDocumentSize, "Largest document fetched from a url, in bytes")
+	consumeCmd.Flags().BoolVar(&consumeOnce, "once", false, "Receive once and exit")
+	addExtractionFlags(consumeCmd)
+}
+
+func runConsume(cmd *cobra.Command, args []string) error {
+	if consumeInput == "" || consumeOutput == "" {
+		return fmt.Errorf("--input and --output are required")
+	}
+
+	var open func(name string) (queue.Queue, error)
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	switch consumeBroker {
+	case "sqs":
+		open = func(name string) (queue.Queue, error) {
+			return queue.NewSQSQueue(queue.SQSConfig{QueueURL: name})
+		}
+	case "nats":
+		url := consumeNATSURL
+		if env := os.Getenv("NATS_URL"); env != "" && !cmd.Flags().Changed("nats-url") {
+			url = env
+		}
+		open = func(name string) (queue.Queue, error) {
+			q, err := queue.NewNATSQueue(queue.NATSConfig{URL: url, Subject: name, Durable: consumeDurable})
+			if err != nil {
+				return nil, err
+			}
+			closers = append(closers, q)
+			return q, nil
+		}
+	case "kafka":
+		brokers := consumeKafka
+		if env := os.Getenv("KAFKA_BROKERS"); env != "" && !cmd.Flags().Changed("kafka-brokers") {
+			brokers = env
+		}
+		cfg := queue.KafkaConfig{
+			Brokers:  strings.Split(brokers, ","),
+			User:     os.Getenv("KAFKA_USERNAME"),
+			Password: os.Getenv("KAFKA_PASSWORD"),
+			Group:    consumeGroup,
+		}
+		if consumeKafkaTLS {
+			cfg.TLSConfig = &tls.Config{}
+		}
+		open = func(name string) (queue.Queue, error) {
+			cfg.Topic = name
+			q, err := queue.NewKafkaQueue(cfg)
+			if err != nil {
+				return nil, err
+			}
+			closers = append(closers, q)
+			return q, nil
+		}
+	default:
+		return fmt.Errorf("unsupported broker %q (sqs, nats, kafka)", consumeBroker)
+	}
+
+	input, err := open(consumeInput)
+	if err != nil {
+		return err
+	}
+	output, err := open(consumeOutput)
+	if err != nil {
+		return err
+	}
+	cfg := queue.Config{MaxAttempts: consumeMaxAttempts, Timeout: consumeTimeout, MaxDocumentSize: consumeMaxSize}
+	if consumeDeadLetter != "" {
+		if cfg.DeadLetter, err = open(consumeDeadLetter); err != nil {
+			return err
+		}
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	consumer, err := queue.NewConsumer(pipeline, input, output, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	if consumeOnce {
+		n, err := consumer.Poll(ctx)
+		printVerbose("Processed %d message(s)\n", n)
+		return err
+	}
+	return consumer.Run(ctx, func(err error) {
+		fmt.Fprintf(os.Stderr, "Queue poll failed: %v\n", err)
+	})
+}
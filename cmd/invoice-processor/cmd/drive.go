@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/clouddrive"
+)
+
+var (
+	driveInterval time.Duration
+	driveTimeout  time.Duration
+	driveSplit    bool
+	driveOnce     bool
+)
+
+var driveCmd = &cobra.Command{
+	Use:   "drive [folder...]",
+	Short: "Process receipts dropped into shared Google Drive or Dropbox folders",
+	Long: `Poll shared Google Drive or Dropbox folders and process every new file.
+
+The result of each file is written back next to it as <name>.json; files
+with a result are skipped, so deleting one has its file processed again.
+Folders are given as gdrive://<folder-id> or dropbox:///<path>.
+
+Google Drive is reached with the service account key file named by
+GOOGLE_APPLICATION_CREDENTIALS (share the folders with the account) or an
+access token in GOOGLE_DRIVE_TOKEN. Dropbox is reached with DROPBOX_TOKEN, or
+a refresh token in DROPBOX_REFRESH_TOKEN with DROPBOX_APP_KEY and
+DROPBOX_APP_SECRET.
+
+Examples:
+  invoice-processor drive gdrive://1AbCdEfGhIjKlMnOp
+  DROPBOX_TOKEN=... invoice-processor drive dropbox:///Receipts --once`,
+	RunE: runDrive,
+}
+
+func init() {
+	rootCmd.AddCommand(driveCmd)
+
+	driveCmd.Flags().DurationVar(&driveInterval, "interval", clouddrive.DefaultPollInterval, "Time between polls")
+	driveCmd.Flags().DurationVar(&driveTimeout, "timeout", 5*time.Minute, "Processing timeout per file")
+	driveCmd.Flags().BoolVar(&driveSplit, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	driveCmd.Flags().BoolVar(&driveOnce, "once", false, "Poll once and exit")
+	addExtractionFlags(driveCmd)
+}
+
+func runDrive(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && fileConfig != nil {
+		args = fileConfig.Connectors.Drive.Folders
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no folders to watch")
+	}
+	folders := make([]clouddrive.Folder, len(args))
+	for i, location := range args {
+		folder, err := openFolder(location)
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		folders[i] = folder
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	connectors := make([]*clouddrive.Connector, len(folders))
+	for i, folder := range folders {
+		location := args[i]
+		connectors[i], err = clouddrive.NewConnector(pipeline, folder, clouddrive.Config{
+			PollInterval:   driveInterval,
+			Timeout:        driveTimeout,
+			SplitDocuments: driveSplit,
+			OnReport: func(report *clouddrive.Report) {
+				status := "ok"
+				if report.Failed {
+					status = "failed"
+				}
+				fmt.Fprintf(os.Stderr, "%s/%s: %d document(s), %s\n", strings.TrimSuffix(location, "/"), report.File, len(report.Results), status)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	if driveOnce {
+		for i, connector := range connectors {
+			n, err := connector.Poll(ctx)
+			printVerbose("%s: processed %d file(s)\n", args[i], n)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[i], err)
+			}
+		}
+		return nil
+	}
+
+	printVerbose("Watching %v\n", args)
+	var wg sync.WaitGroup
+	for i, connector := range connectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			connector.Run(ctx, func(err error) {
+				fmt.Fprintf(os.Stderr, "%s: poll failed: %v\n", args[i], err)
+			})
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// openFolder returns the folder of a gdrive:// or dropbox:// location, with
+// credentials from the environment
+func openFolder(location string) (clouddrive.Folder, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder: %w", err)
+	}
+	switch u.Scheme {
+	case "gdrive":
+		var token clouddrive.TokenSource
+		if keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); keyFile != "" {
+			key, err := os.ReadFile(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read service account key: %w", err)
+			}
+			if token, err = clouddrive.NewServiceAccountToken(key, clouddrive.DriveScope, nil); err != nil {
+				return nil, err
+			}
+		} else {
+			token = clouddrive.StaticToken(os.Getenv("GOOGLE_DRIVE_TOKEN"))
+		}
+		return clouddrive.NewGoogleDrive(clouddrive.GoogleDriveConfig{FolderID: u.Host, Token: token})
+	case "dropbox":
+		var token clouddrive.TokenSource = clouddrive.StaticToken(os.Getenv("DROPBOX_TOKEN"))
+		if refresh := os.Getenv("DROPBOX_REFRESH_TOKEN"); refresh != "" {
+			if token, err = clouddrive.NewDropboxRefreshToken(os.Getenv("DROPBOX_APP_KEY"), os.Getenv("DROPBOX_APP_SECRET"), refresh, nil); err != nil {
+				return nil, err
+			}
+		}
+		return clouddrive.NewDropbox(clouddrive.DropboxConfig{Path: u.Host + u.Path, Token: token})
+	}
+	return nil, fmt.Errorf("unsupported folder scheme %q (use gdrive://<folder-id> or dropbox:///<path>)", u.Scheme)
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/config"
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/render"
+)
+
+var (
+	exportTables      bool
+	exportMapping     string
+	exportLinesOutput string
+	exportAnonymize   bool
+	exportAnonKey     string
+	exportAccounting  string
+	exportFont        string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [results files...]",
+	Short: "Convert saved results to another format",
+	Long: `Convert the JSON or JSON Lines output of process and batch to another
+format without processing the invoices again. Results of several files are
+concatenated.
+
+With --tables the extracted invoices are exported on their own, for
+accounting imports: a table with one row per invoice and a table with one
+row per line item (the Lines sheet in xlsx, --lines-output in csv). jsonl
+writes the invoices in full. --mapping reads the columns from a JSON file:
+
+  {"invoices": [{"field": "number", "header": "Số HĐ"},
+                {"field": "total_amount", "header": "Tổng tiền", "format": "#,##0"}],
+   "lines": [{"field": "number"}, {"field": "items.name"}, {"field": "items.quantity"}]}
+
+With --anonymize the parties of the invoices are replaced with made-up ones
+of the same format, the same party getting the same pseudonym throughout,
+and the raw responses, debug artifacts, vendor matches and emails of the
+results are left out, so real invoices can serve as test fixtures or be
+shared. Give --anonymize-key a secret to keep pseudonyms from being
+recomputed from known tax IDs.
+
+-f ubl writes the invoices as UBL 2.1 Invoice and CreditNote documents, for
+AP systems that only accept UBL. A single invoice goes to --output or
+stdout; several need --output, a directory that gets one file per invoice
+named after the seller tax ID, series and number.
+
+-f html and -f pdf render each invoice the same way as a clean, standardized
+document with Vietnamese and English labels, for review or for archiving a
+normalized copy alongside the original. PDFs embed Roboto; --font gives
+another TrueType font.
+
+--accounting writes the invoices as bills to import into an accounting
+system, one row per line item: quickbooks (csv for QuickBooks Online, iif
+for QuickBooks Desktop), xero (csv) or misa (the MISA AMIS purchase voucher
+template, xlsx or csv). Tax codes, accounts and the date format default to
+those of the system and are set in the export.accounting section of
+--config:
+
+  export:
+    accounting:
+      xero:
+        account: "310"
+        tax_codes: {"10%": "Input VAT 10%", "KCT": "Exempt Expenses"}
+
+Examples:
+  invoice-processor export results.json -f csv -o invoices.csv
+  invoice-processor export results.json -f xlsx -o invoices.xlsx
+  invoice-processor export monday.json tuesday.json -f jsonl
+  invoice-processor export results.json --tables -f csv -o invoices.csv --lines-output lines.csv
+  invoice-processor export results.json --anonymize -f jsonl -o fixtures.jsonl
+  invoice-processor export results.json -f ubl -o ubl/
+  invoice-processor export results.json -f pdf -o archive/
+  invoice-processor export results.json --accounting xero -f csv -o bills.csv
+  invoice-processor export results.json --accounting quickbooks -f iif -o bills.iif
+  invoice-processor export results.json --accounting misa -f xlsx -o mua-hang.xlsx`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: stdout)")
+	exportCmd.Flags().BoolVar(&exportTables, "tables", false, "Export the invoices as header and line item tables")
+	exportCmd.Flags().StringVar(&exportMapping, "mapping", "", "JSON file of table columns (implies --tables)")
+	exportCmd.Flags().StringVar(&exportLinesOutput, "lines-output", "", "File for the line items table in csv")
+	exportCmd.Flags().BoolVar(&exportAnonymize, "anonymize", false, "Pseudonymize the parties of the invoices")
+	exportCmd.Flags().StringVar(&exportAnonKey, "anonymize-key", "", "Secret key of the pseudonyms (implies --anonymize)")
+	exportCmd.Flags().StringVar(&exportFont, "font", "", "TrueType font of pdf output (default: Roboto)")
+	exportCmd.Flags().StringVar(&exportAccounting, "accounting", "", "Export bills for an accounting system (quickbooks, xero, misa)")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	var results []*ProcessResult
+	for _, file := range args {
+		fileResults, err := readResults(file)
+		if err != nil {
+			return err
+		}
+		results = append(results, fileResults...)
+	}
+	if exportAnonymize || exportAnonKey != "" {
+		anonymizeResults(results, model.NewAnonymizer([]byte(exportAnonKey)))
+	}
+	if exportAccounting != "" {
+		return exportBills(successfulInvoices(results))
+	}
+	switch outputFormat {
+	case "ubl":
+		return exportDocuments(successfulInvoices(results), ".xml", export.WriteUBL)
+	case "html", "pdf":
+		r, err := renderer()
+		if err != nil {
+			return err
+		}
+		if outputFormat == "html" {
+			return exportDocuments(successfulInvoices(results), ".html", r.HTML)
+		}
+		return exportDocuments(successfulInvoices(results), ".pdf", r.PDF)
+	}
+	if exportTables || exportMapping != "" {
+		return exportInvoices(results)
+	}
+	printVerbose("Exporting %d results\n", len(results))
+	return outputResults(results)
+}
+
+// anonymizeResults pseudonymizes the invoices of results and leaves out
+// what else names the parties; files are named after their invoices
+func anonymizeResults(results []*ProcessResult, a *model.Anonymizer) {
+	for i, r := range results {
+		anon := &ProcessResult{
+			Source:     r.Source,
+			Pages:      r.Pages,
+			Method:     r.Method,
+			Confidence: r.Confidence,
+			Warnings:   r.Warnings,
+			Error:      r.Error,
+			Skipped:    r.Skipped,
+			Duplicate:  r.Duplicate,
+			Retries:    r.Retries,
+		}
+		if r.Invoice != nil {
+			anon.Invoice = a.Anonymize(r.Invoice)
+			anon.File = anon.Invoice.SourceFile
+		}
+		results[i] = anon
+	}
+}
+
+// exportInvoices writes the invoices of successful results as tables
+func exportInvoices(results []*ProcessResult) error {
+	mapping := export.DefaultMapping()
+	if exportMapping != "" {
+		data, err := os.ReadFile(exportMapping)
+		if err != nil {
+			return fmt.Errorf("failed to read mapping: %w", err)
+		}
+		mapping = export.Mapping{}
+		if err := json.Unmarshal(data, &mapping); err != nil {
+			return fmt.Errorf("failed to parse mapping: %w", err)
+		}
+	}
+
+	invoices := successfulInvoices(results)
+	printVerbose("Exporting %d invoices\n", len(invoices))
+
+	if outputFormat == "xlsx" && outputFile == "" {
+		return fmt.Errorf("xlsx output needs an output file (-o)")
+	}
+	w := os.Stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch outputFormat {
+	case "csv":
+		if exportLinesOutput == "" {
+			return export.WriteInvoicesCSV(w, nil, invoices, mapping)
+		}
+		lines, err := os.Create(exportLinesOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create lines file: %w", err)
+		}
+		defer lines.Close()
+		return export.WriteInvoicesCSV(w, lines, invoices, mapping)
+	case "xlsx":
+		return export.WriteInvoicesXLSX(w, invoices, mapping)
+	case "jsonl":
+		return export.WriteJSONL(w, invoices)
+	default:
+		return fmt.Errorf("unsupported format for --tables: %s (csv, xlsx, jsonl)", outputFormat)
+	}
+}
+
+// exportBills writes the invoices as the bill import of --accounting
+func exportBills(invoices []*model.Invoice) error {
+	cfg := fileConfig
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	accounting, err := cfg.Accounting(exportAccounting)
+	if err != nil {
+		return err
+	}
+	printVerbose("Exporting %d invoices for %s\n", len(invoices), accounting.System)
+
+	switch {
+	case outputFormat == "iif" && accounting.System != export.QuickBooks:
+		return fmt.Errorf("iif output is only for quickbooks")
+	case outputFormat == "xlsx" && outputFile == "":
+		return fmt.Errorf("xlsx output needs an output file (-o)")
+	case outputFormat != "csv" && outputFormat != "xlsx" && outputFormat != "iif":
+		return fmt.Errorf("unsupported format for --accounting: %s (csv, xlsx, iif)", outputFormat)
+	}
+	w := os.Stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch outputFormat {
+	case "iif":
+		return accounting.WriteIIF(w, invoices)
+	case "xlsx":
+		return accounting.WriteXLSX(w, invoices)
+	default:
+		return accounting.WriteCSV(w, invoices)
+	}
+}
+
+// exportDocuments writes each invoice as a document of its own: a single
+// one to the output file or stdout, several to files in the output
+// directory
+func exportDocuments(invoices []*model.Invoice, ext string, write func(io.Writer, *model.Invoice) error) error {
+	printVerbose("Exporting %d invoices as %s\n", len(invoices), outputFormat)
+	if len(invoices) == 1 {
+		if outputFile == "" {
+			return write(os.Stdout, invoices[0])
+		}
+		return writeDocumentFile(outputFile, invoices[0], write)
+	}
+
+	if outputFile == "" {
+		return fmt.Errorf("%s output of several invoices needs an output directory (-o)", outputFormat)
+	}
+	if err := os.MkdirAll(outputFile, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, inv := range invoices {
+		if err := writeDocumentFile(filepath.Join(outputFile, documentFileName(inv, ext)), inv, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeDocumentFile(path string, inv *model.Invoice, write func(io.Writer, *model.Invoice) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+	return write(f, inv)
+}
+
+// documentFileName names the file of inv after its seller tax ID, series
+// and number, keeping only characters safe in file names
+func documentFileName(inv *model.Invoice, ext string) string {
+	name := strings.Join([]string{inv.Seller.TaxID, inv.Series, inv.Number}, "_")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, name) + ext
+}
+
+// renderer returns the renderer of html and pdf output, drawing with
+// --font
+func renderer() (*render.Renderer, error) {
+	var opts []render.Option
+	if exportFont != "" {
+		ttf, err := os.ReadFile(exportFont)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		opts = append(opts, render.WithFont(ttf))
+	}
+	return render.New(opts...)
+}
+
+// successfulInvoices returns the invoices of results that did not fail
+func successfulInvoices(results []*ProcessResult) []*model.Invoice {
+	var invoices []*model.Invoice
+	for _, r := range results {
+		if r.Error == "" && r.Invoice != nil {
+			invoices = append(invoices, r.Invoice)
+		}
+	}
+	return invoices
+}
+
+// readResults reads a JSON array of results, or one result per line
+func readResults(path string) ([]*ProcessResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+
+	var results []*ProcessResult
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return results, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var result ProcessResult
+		if err := decoder.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		results = append(results, &result)
+	}
+	return results, nil
+}
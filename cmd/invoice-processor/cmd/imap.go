@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/mailbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+var (
+	imapAddr     string
+	imapUser     string
+	imapPassword string
+	imapMailbox  string
+	imapFlag     string
+	imapInterval time.Duration
+	imapTimeout  time.Duration
+	imapInsecure bool
+	imapOnce     bool
+	imapOutput   string
+)
+
+var imapCmd = &cobra.Command{
+	Use:   "imap",
+	Short: "Process invoices arriving in an IMAP mailbox",
+	Long: `Poll an IMAP mailbox and process every new message.
+
+PDF, XML, ZIP and image attachments are processed one by one; a message
+without attachments is read from its HTML body. Each document is written as
+one JSON line. Processed messages get the --flag keyword and are skipped
+afterwards; they are not marked as read.
+
+Examples:
+  IMAP_PASSWORD=... invoice-processor imap --addr imap.example.com:993 --user ap@example.com
+  invoice-processor imap --addr imap.example.com:993 --user ap@example.com --once -o invoices.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: runIMAP,
+}
+
+func init() {
+	rootCmd.AddCommand(imapCmd)
+
+	imapCmd.Flags().StringVar(&imapAddr, "addr", "", "IMAP server host:port (env: IMAP_ADDR)")
+	imapCmd.Flags().StringVar(&imapUser, "user", "", "IMAP username (env: IMAP_USER)")
+	imapCmd.Flags().StringVar(&imapPassword, "password", "", "IMAP password (env: IMAP_PASSWORD)")
+	imapCmd.Flags().StringVar(&imapMailbox, "mailbox", mailbox.DefaultMailbox, "Folder to poll")
+	imapCmd.Flags().StringVar(&imapFlag, "flag", mailbox.DefaultProcessedFlag, `Keyword set on processed messages (use '\Seen' if the server has no keywords)`)
+	imapCmd.Flags().DurationVar(&imapInterval, "interval", mailbox.DefaultPollInterval, "Time between polls")
+	imapCmd.Flags().DurationVar(&imapTimeout, "timeout", 5*time.Minute, "Processing timeout per message")
+	imapCmd.Flags().BoolVar(&imapInsecure, "insecure", false, "Connect without TLS (local bridges only)")
+	imapCmd.Flags().BoolVar(&imapOnce, "once", false, "Poll once and exit")
+	imapCmd.Flags().StringVarP(&imapOutput, "output", "o", "", "Append JSON lines to this file (default: stdout)")
+	addExtractionFlags(imapCmd)
+}
+
+func runIMAP(cmd *cobra.Command, args []string) error {
+	if imapAddr == "" {
+		imapAddr = os.Getenv("IMAP_ADDR")
+	}
+	if imapUser == "" {
+		imapUser = os.Getenv("IMAP_USER")
+	}
+	if imapPassword == "" {
+		imapPassword = os.Getenv("IMAP_PASSWORD")
+	}
+
+	out := os.Stdout
+	if imapOutput != "" {
+		f, err := os.OpenFile(imapOutput, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	connector, err := mailbox.NewConnector(pipeline, mailbox.Config{
+		Addr:          imapAddr,
+		Username:      imapUser,
+		Password:      imapPassword,
+		Mailbox:       imapMailbox,
+		Insecure:      imapInsecure,
+		ProcessedFlag: imapFlag,
+		PollInterval:  imapInterval,
+		Timeout:       imapTimeout,
+	}, func(_ context.Context, msg mailbox.Message, results []*processor.Result) error {
+		name := msg.MessageID
+		if name == "" {
+			name = fmt.Sprintf("%s/%d", imapMailbox, msg.UID)
+		}
+		printVerbose("Processing: %s (%s)\n", msg.Subject, name)
+		for _, result := range convertResults(name, results) {
+			if err := enc.Encode(result); err != nil {
+				return err // Leave the message for the next poll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	if imapOnce {
+		n, err := connector.Poll(ctx)
+		printVerbose("Processed %d message(s)\n", n)
+		return err
+	}
+	return connector.Run(ctx, func(err error) {
+		fmt.Fprintf(os.Stderr, "IMAP poll failed: %v\n", err)
+	})
+}
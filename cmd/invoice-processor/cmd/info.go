@@ -97,6 +97,16 @@ func formatName(f processor.Format) string {
 		return "PDF"
 	case processor.FormatImage:
 		return "Image"
+	case processor.FormatHTML:
+		return "HTML"
+	case processor.FormatSpreadsheet:
+		return "Excel workbook (XLSX)"
+	case processor.FormatZIP:
+		return "ZIP archive"
+	case processor.FormatEmail:
+		return "Email (EML)"
+	case processor.FormatMSG:
+		return "Outlook message (MSG)"
 	default:
 		return "Unknown"
 	}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,14 +14,41 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/rezonia/invoice-processor/internal/export"
 	"github.com/rezonia/invoice-processor/internal/llm"
 	"github.com/rezonia/invoice-processor/internal/model"
 	"github.com/rezonia/invoice-processor/internal/processor"
 )
 
 var (
-	outputFile string
-	timeout    time.Duration
+	outputFile       string
+	timeout          time.Duration
+	recoverFields    bool
+	samples          int
+	ensemble         bool
+	race             bool
+	redactPII        bool
+	temperature      float64
+	topP             float64
+	maxTokens        int64
+	boundingBoxes    bool
+	splitPDFs        bool
+	checkArithmetic  bool
+	checkTaxIDs      bool
+	llmAddresses     bool
+	vendorsFile      string
+	maxTextTokens    int
+	imageMaxSide     int
+	detectDuplicates bool
+	strategies       string
+	rawResponses     bool
+	mergePages       int
+	debugMode        bool
+	debugImages      string
+	tenant           string
+	preclassify      bool
+	deadline         time.Duration
+	classifierModel  string
 )
 
 var processCmd = &cobra.Command{
@@ -31,17 +60,23 @@ Supported formats:
   - XML: .xml
   - PDF: .pdf
   - Images: .png, .jpg, .jpeg, .tiff
+  - HTML receipts and spreadsheets: .html, .htm, .xlsx, .csv, .tsv
+  - Archives and emails: .zip, .eml, .msg (each member or attachment is
+    processed; files that are not invoices, and PDF copies of XML invoices,
+    are skipped)
 
 The extraction flow:
   1. XML files: Direct parsing (fastest, no API key needed)
-  2. PDF files: LLM text extraction → LLM vision (requires API key)
+  2. PDF files: LLM text extraction → LLM vision (requires API key);
+     without one, header fields and totals are read with label rules
   3. Images: LLM vision extraction (requires API key)
 
 Examples:
   invoice-processor process invoice.xml
   invoice-processor process invoice.pdf --api-key <key>
   invoice-processor process *.xml -o results.json
-  invoice-processor process invoices/ -f table`,
+  invoice-processor process invoices/ -f table
+  invoice-processor process invoice.pdf --debug --debug-images pages/`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runProcess,
 }
@@ -51,6 +86,37 @@ func init() {
 
 	processCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: stdout)")
 	processCmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute, "Processing timeout per file")
+	processCmd.Flags().BoolVar(&splitPDFs, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	processCmd.Flags().BoolVar(&debugMode, "debug", false, "Include the extracted text, page images, prompts and raw LLM responses in the results")
+	processCmd.Flags().StringVar(&debugImages, "debug-images", "", "Directory to write the page images sent to the vision model to (implies --debug)")
+	addExtractionFlags(processCmd)
+}
+
+// addExtractionFlags registers the flags read by newPipeline
+func addExtractionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&recoverFields, "recover-fields", false, "Re-ask the LLM for a missing tax ID, total or date")
+	cmd.Flags().IntVar(&samples, "samples", 0, "Run N LLM samples per document and merge them by majority vote")
+	cmd.Flags().BoolVar(&ensemble, "ensemble", false, "Run text and vision extraction on PDFs and merge the results")
+	cmd.Flags().BoolVar(&race, "race", false, "Run text and vision extraction on PDFs together and keep the first valid invoice")
+	cmd.Flags().BoolVar(&redactPII, "redact-pii", false, "Mask personal data in text sent to the LLM (images are sent as is)")
+	cmd.Flags().Float64Var(&temperature, "temperature", llm.DefaultTemperature, "LLM sampling temperature")
+	cmd.Flags().Float64Var(&topP, "top-p", 0, "LLM nucleus sampling cutoff (0 = provider default)")
+	cmd.Flags().Int64Var(&maxTokens, "max-tokens", 0, "Maximum LLM output tokens (0 = default)")
+	cmd.Flags().StringVar(&vendorsFile, "vendors", "", "JSON file of vendors (id, name, tax_id, aliases) to match sellers against by embedding similarity")
+	cmd.Flags().BoolVar(&llmAddresses, "llm-addresses", false, "Split addresses the built-in rules cannot place into ward, district and province with the LLM")
+	cmd.Flags().IntVar(&maxTextTokens, "max-text-tokens", llm.DefaultTextTokenBudget, "Truncate document text sent to the LLM to about this many tokens, keeping the header, totals and line items (0 = no limit)")
+	cmd.Flags().IntVar(&imageMaxSide, "image-max-side", 0, "Downscale images to this many pixels on the longest side before vision extraction (0 = per-model budget, -1 = send as is)")
+	cmd.Flags().BoolVar(&checkArithmetic, "check-arithmetic", false, "Re-ask the LLM for amounts that do not add up (quantity × price, items to subtotal, subtotal + VAT to total)")
+	cmd.Flags().BoolVar(&checkTaxIDs, "check-tax-ids", false, "Reject extracted tax IDs that fail their check digit (re-asked with --recover-fields)")
+	cmd.Flags().BoolVar(&boundingBoxes, "bounding-boxes", false, "Ask the vision model where each field appears on the page")
+	cmd.Flags().StringVar(&strategies, "strategies", "", "Order of PDF extraction strategies, comma-separated: embedded_xml, text, vision (default: text,vision)")
+	cmd.Flags().IntVar(&mergePages, "merge-pages", processor.DefaultMaxMergedPages, "Read up to this many pages of long scanned PDFs in groups and merge them into one invoice (0 = only the first group)")
+	cmd.Flags().BoolVar(&rawResponses, "raw-responses", false, "Keep the exact prompts, models and unparsed LLM responses of each document in the results, for audit")
+	cmd.Flags().BoolVar(&detectDuplicates, "detect-duplicates", false, "Flag invoices already processed in this run (same seller tax ID, series, number, date and total)")
+	cmd.Flags().BoolVar(&preclassify, "preclassify", false, "Skip documents that are not invoices or receipts, such as contracts and delivery photos, before LLM extraction")
+	cmd.Flags().StringVar(&classifierModel, "classifier-model", "", "Small model asked with --preclassify about documents the keywords can't tell, such as scans (default: keywords only)")
+	cmd.Flags().DurationVar(&deadline, "deadline", 0, "Stop extracting a document after this long, keeping what was read in time, e.g. 60s (0 = no limit)")
+	cmd.Flags().StringVar(&tenant, "tenant", "", "Process documents with the settings of this tenant of the configuration file")
 }
 
 func runProcess(cmd *cobra.Command, args []string) error {
@@ -66,55 +132,243 @@ func runProcess(cmd *cobra.Command, args []string) error {
 
 	printVerbose("Found %d files to process\n", len(files))
 
-	// Create pipeline
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// Process files
+	results := make([]*ProcessResult, 0, len(files))
+	for _, file := range files {
+		printVerbose("Processing: %s\n", file)
+
+		for _, result := range processFile(pipeline, file) {
+			results = append(results, result)
+
+			if result.Source != "" {
+				printVerbose("  %s:\n", result.Source)
+			}
+			if result.Pages != "" {
+				printVerbose("  Pages %s:\n", result.Pages)
+			}
+			if result.Error != "" {
+				printVerbose("  Error: %s\n", result.Error)
+				continue
+			}
+			docType := "Invoice"
+			if result.Invoice != nil {
+				switch result.Invoice.DocumentType {
+				case model.DocumentTypeReceipt:
+					docType = "Receipt"
+				case model.DocumentTypeCreditNote:
+					docType = "Credit note"
+				case model.DocumentTypeDeliveryNote:
+					docType = "Delivery note"
+				case model.DocumentTypePurchaseOrder:
+					docType = "Purchase order"
+				}
+			}
+			printVerbose("  Type: %s, Method: %s, Confidence: %.2f\n", docType, result.Method, result.Confidence)
+		}
+	}
+
+	// Output results
+	return outputResults(results)
+}
+
+// newPipeline builds the extraction pipeline from the LLM and extraction
+// flags. cleanup closes the files it opened.
+func newPipeline() (pipeline *processor.Pipeline, cleanup func(), err error) {
+	var closers []io.Closer
+	cleanup = func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
 	var llmExtractor *llm.Extractor
-	if apiKey != "" {
+	var vendorMatcher processor.VendorMatcher
+	if llmEnabled() {
+		httpOpts, err := llmHTTPOptions()
+		if err != nil {
+			return nil, nil, err
+		}
+
 		// Build client options
-		var clientOpts []llm.ClientOption
+		clientOpts := []llm.ClientOption{
+			llm.WithTimeout(llmTimeout),
+			llm.WithProxy(httpOpts.Proxy),
+		}
+		for name, value := range httpOpts.Headers {
+			clientOpts = append(clientOpts, llm.WithHeader(name, value))
+		}
 		if llmBaseURL != "" {
 			clientOpts = append(clientOpts, llm.WithBaseURL(llmBaseURL))
 		}
+		extraBody, err := llmExtraBodyFields()
+		if err != nil {
+			return nil, nil, err
+		}
+		if llmProvider != "" || extraBody != nil {
+			provider, err := llm.NewProvider(llm.ProviderConfig{
+				Name:      llmProvider,
+				APIKey:    apiKey,
+				BaseURL:   llmBaseURL,
+				Timeout:   llmTimeout,
+				HTTP:      httpOpts,
+				ExtraBody: extraBody,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			clientOpts = append(clientOpts, llm.WithProvider(provider))
+		}
+		if llmCacheDir != "" {
+			cache, err := llm.NewDiskCache(llmCacheDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			clientOpts = append(clientOpts, llm.WithCache(cache, 0))
+		}
+
+		if llmAuditLog != "" {
+			f, err := os.OpenFile(llmAuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+			}
+			closers = append(closers, f)
+			clientOpts = append(clientOpts, llm.WithInterceptor(llm.NewJSONLAuditLog(f)))
+			if llmAuditBodies {
+				clientOpts = append(clientOpts, llm.WithAuditBodies(llm.RedactBodies(llm.NewRedactor())))
+			}
+		}
 
-		client := llm.NewClient(apiKey, clientOpts...)
+		if llmPromptCache {
+			clientOpts = append(clientOpts, llm.WithPromptCaching(true))
+		}
+		if llmBreaker > 0 {
+			clientOpts = append(clientOpts, llm.WithCircuitBreaker(llm.CircuitBreaker{FailureThreshold: llmBreaker}))
+		}
+
+		fileClientOpts, fileExtractorOpts := configExtractorOptions()
+		client := llm.NewClient(apiKey, append(clientOpts, fileClientOpts...)...)
 
 		// Build extractor options
-		var extractorOpts []llm.ExtractorOption
+		extractorOpts := fileExtractorOpts
 		if llmModel != "" {
 			extractorOpts = append(extractorOpts, llm.WithTextModel(llmModel))
 		}
 		if llmVisionModel != "" {
 			extractorOpts = append(extractorOpts, llm.WithVisionModel(llmVisionModel))
 		}
+		if llmPromptsDir != "" {
+			prompts, err := llm.LoadPromptSetDir(llmPromptsDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			extractorOpts = append(extractorOpts, llm.WithPrompts(prompts))
+		}
+		if llmExamples != "" {
+			examples, err := loadExamples(llmExamples)
+			if err != nil {
+				return nil, nil, err
+			}
+			extractorOpts = append(extractorOpts, llm.WithExamples(examples, 0))
+		}
+		if recoverFields {
+			extractorOpts = append(extractorOpts, llm.WithFieldRecovery())
+		}
+		if samples > 1 {
+			extractorOpts = append(extractorOpts, llm.WithSelfConsistency(samples, 0))
+		}
+		if redactPII {
+			extractorOpts = append(extractorOpts, llm.WithRedactor(llm.NewRedactor()))
+		}
+		if boundingBoxes {
+			extractorOpts = append(extractorOpts, llm.WithBoundingBoxes(true))
+		}
+		extractorOpts = append(extractorOpts, llm.WithTextTokenBudget(maxTextTokens))
+		switch {
+		case imageMaxSide < 0:
+			extractorOpts = append(extractorOpts, llm.WithImageDownscaling(false))
+		case imageMaxSide > 0:
+			extractorOpts = append(extractorOpts, llm.WithImageBudget(llm.ImageBudget{MaxLongSide: imageMaxSide}))
+		}
+		if checkArithmetic {
+			extractorOpts = append(extractorOpts, llm.WithArithmeticCheck(llm.DefaultArithmeticTolerance))
+		}
+		if checkTaxIDs {
+			extractorOpts = append(extractorOpts, llm.WithTaxIDCheck())
+		}
+		extractorOpts = append(extractorOpts, llm.WithGenerationParams(llm.GenerationParams{
+			Temperature: llm.Temperature(temperature),
+			TopP:        topP,
+			MaxTokens:   maxTokens,
+		}))
 
 		llmExtractor = llm.NewExtractor(client, extractorOpts...)
 		printVerbose("LLM extraction enabled (text: %s, vision: %s)\n", llmModel, llmVisionModel)
-	}
 
-	pipeline := processor.NewPipeline(
-		processor.WithLLMExtractor(llmExtractor),
-	)
-
-	// Process files
-	results := make([]*ProcessResult, 0, len(files))
-	for _, file := range files {
-		printVerbose("Processing: %s\n", file)
-
-		result := processFile(pipeline, file)
-		results = append(results, result)
-
-		if result.Error != "" {
-			printVerbose("  Error: %s\n", result.Error)
-		} else {
-			docType := "Invoice"
-			if result.Invoice != nil && result.Invoice.DocumentType == model.DocumentTypeReceipt {
-				docType = "Receipt"
+		if vendorsFile != "" {
+			vendors, err := loadVendors(vendorsFile)
+			if err != nil {
+				return nil, nil, err
 			}
-			printVerbose("  Type: %s, Method: %s, Confidence: %.2f\n", docType, result.Method, result.Confidence)
+			vendorMatcher = processor.NewEmbeddingMatcher(client.Embedder(""), vendors)
 		}
 	}
 
-	// Output results
-	return outputResults(results)
+	pipelineOpts := []processor.PipelineOption{
+		processor.WithLLMExtractor(llmExtractor),
+		processor.WithEnsemble(ensemble),
+		processor.WithRace(race),
+		processor.WithLLMAddressParsing(llmAddresses),
+		processor.WithPageMerge(mergePages),
+	}
+	if vendorMatcher != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithVendorMatcher(vendorMatcher))
+	}
+	if detectDuplicates {
+		pipelineOpts = append(pipelineOpts, processor.WithDuplicateStore(processor.NewMemoryDuplicateStore()))
+	}
+	if rawResponses {
+		pipelineOpts = append(pipelineOpts, processor.WithRawResponses(true))
+	}
+	if strategies != "" {
+		chain, err := processor.ParseStrategies(strategies)
+		if err != nil {
+			return nil, nil, err
+		}
+		pipelineOpts = append(pipelineOpts, processor.WithStrategies(chain...))
+	}
+	if deadline > 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithDocumentDeadline(deadline))
+	}
+	if preclassify {
+		pipelineOpts = append(pipelineOpts, processor.WithDocumentClassifier(processor.NewDocumentClassifier(llmExtractor, classifierModel)))
+	}
+	if debugMode || debugImages != "" {
+		pipelineOpts = append(pipelineOpts, processor.WithDebug(processor.DebugOptions{ImageDir: debugImages}))
+	}
+	fileOpts, err := configPipelineOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	pipelineOpts = append(pipelineOpts, fileOpts...)
+	if tenant != "" {
+		pipelineOpts = append(pipelineOpts, processor.WithDefaultTenant(tenant))
+	}
+	pipeline = processor.NewPipeline(pipelineOpts...)
+	if !pipeline.HasTenant(tenant) {
+		return nil, nil, fmt.Errorf("%w %q", processor.ErrUnknownTenant, tenant)
+	}
+	return pipeline, cleanup, nil
 }
 
 func collectFiles(args []string) ([]string, error) {
@@ -128,38 +382,35 @@ func collectFiles(args []string) ([]string, error) {
 		}
 
 		if len(matches) == 0 {
-			// Check if it's a directory
-			info, err := os.Stat(arg)
-			if err != nil {
+			if _, err := os.Stat(arg); err != nil {
 				return nil, fmt.Errorf("file not found: %s", arg)
 			}
-
-			if info.IsDir() {
-				// Walk directory
-				err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
-					if !info.IsDir() && isSupportedFile(path) {
-						files = append(files, path)
-					}
-					return nil
-				})
-				if err != nil {
-					return nil, err
+			files = append(files, arg)
+			continue
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				if isSupportedFile(match) {
+					files = append(files, match)
 				}
-			} else {
-				files = append(files, arg)
+				continue
 			}
-		} else {
-			for _, match := range matches {
-				info, err := os.Stat(match)
+			// Walk directory
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
-					continue
+					return err
 				}
-				if !info.IsDir() && isSupportedFile(match) {
-					files = append(files, match)
+				if !info.IsDir() && isSupportedFile(path) {
+					files = append(files, path)
 				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -170,15 +421,16 @@ func collectFiles(args []string) ([]string, error) {
 func isSupportedFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	switch ext {
-	case ".xml", ".pdf", ".png", ".jpg", ".jpeg", ".tiff", ".tif":
+	case ".xml", ".pdf", ".png", ".jpg", ".jpeg", ".tiff", ".tif", ".zip", ".eml", ".msg",
+		".html", ".htm", ".xlsx", ".csv", ".tsv":
 		return true
 	default:
 		return false
 	}
 }
 
-func processFile(pipeline *processor.Pipeline, filePath string) *ProcessResult {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func processFile(pipeline *processor.Pipeline, filePath string) []*ProcessResult {
+	ctx, cancel := context.WithTimeout(llm.ContextWithDocumentID(context.Background(), filePath), timeout)
 	defer cancel()
 
 	result := &ProcessResult{
@@ -189,72 +441,49 @@ func processFile(pipeline *processor.Pipeline, filePath string) *ProcessResult {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to read file: %v", err)
-		return result
+		return []*ProcessResult{result}
 	}
 
-	// Detect format
-	format := processor.DetectFormat(data)
-	ext := strings.ToLower(filepath.Ext(filePath))
+	return convertResults(filePath, pipeline.Process(ctx, data, processor.ProcessOptions{Filename: filePath, SplitDocuments: splitPDFs}))
+}
 
-	// Override format detection based on extension if ambiguous
-	if format == processor.FormatUnknown {
-		switch ext {
-		case ".xml":
-			format = processor.FormatXML
-		case ".pdf":
-			format = processor.FormatPDF
-		case ".png", ".jpg", ".jpeg", ".tiff", ".tif":
-			format = processor.FormatImage
+// convertResults converts pipeline results for one file to CLI results
+func convertResults(filePath string, pipelineResults []*processor.Result) []*ProcessResult {
+	results := make([]*ProcessResult, len(pipelineResults))
+	for i, pipelineResult := range pipelineResults {
+		result := &ProcessResult{
+			File:       filePath,
+			Source:     pipelineResult.Source,
+			Submission: pipelineResult.Submission,
+			Warnings:   pipelineResult.Warnings,
+			Retries:    pipelineResult.Retries,
+			Raw:        pipelineResult.Raw,
+			Debug:      pipelineResult.Debug,
 		}
-	}
-
-	// Process based on format
-	var pipelineResult *processor.Result
-	switch format {
-	case processor.FormatXML:
-		pipelineResult = pipeline.ProcessXMLBytes(ctx, data)
-
-	case processor.FormatPDF:
-		pipelineResult = pipeline.ProcessPDF(ctx, nil, data, getMimeType(ext))
-
-	case processor.FormatImage:
-		pipelineResult = pipeline.ProcessImage(ctx, data, getMimeType(ext))
-
-	default:
-		result.Error = "unsupported file format"
-		return result
-	}
-
-	// Convert result
-	if pipelineResult.Error != nil {
-		result.Error = pipelineResult.Error.Error()
-		return result
-	}
-
-	result.Invoice = pipelineResult.Invoice
-	result.Method = string(pipelineResult.Method)
-	result.Confidence = pipelineResult.Confidence
-	result.Warnings = pipelineResult.Warnings
+		if pipelineResult.Pages != nil {
+			result.Pages = pipelineResult.Pages.String()
+		}
+		results[i] = result
 
-	return result
-}
+		if pipelineResult.Error != nil {
+			result.Error = pipelineResult.Error.Error()
+			result.Skipped = errors.Is(pipelineResult.Error, processor.ErrSkipped)
+			continue
+		}
 
-func getMimeType(ext string) string {
-	switch ext {
-	case ".png":
-		return "image/png"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".tiff", ".tif":
-		return "image/tiff"
-	case ".pdf":
-		return "application/pdf"
-	default:
-		return "application/octet-stream"
+		result.Invoice = pipelineResult.Invoice
+		result.Method = string(pipelineResult.Method)
+		result.Confidence = pipelineResult.Confidence
+		result.Vendor = pipelineResult.Vendor
+		result.Duplicate = pipelineResult.Duplicate
 	}
+	return results
 }
 
 func outputResults(results []*ProcessResult) error {
+	if outputFormat == "xlsx" && outputFile == "" {
+		return fmt.Errorf("xlsx output needs an output file (-o)")
+	}
 	var writer = os.Stdout
 	if outputFile != "" {
 		f, err := os.Create(outputFile)
@@ -268,6 +497,10 @@ func outputResults(results []*ProcessResult) error {
 	switch outputFormat {
 	case "json":
 		return outputJSON(writer, results)
+	case "jsonl":
+		return outputJSONL(writer, results)
+	case "xlsx":
+		return outputXLSX(writer, results)
 	case "table":
 		return outputTable(writer, results)
 	case "csv":
@@ -283,14 +516,62 @@ func outputJSON(w *os.File, results []*ProcessResult) error {
 	return encoder.Encode(results)
 }
 
+// outputJSONL writes a result per line
+func outputJSONL(w *os.File, results []*ProcessResult) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range results {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputXLSX writes the CSV columns as a workbook, with amounts as numbers
+func outputXLSX(w *os.File, results []*ProcessResult) error {
+	sheet := export.Sheet{
+		Name:   "Invoices",
+		Header: []string{"File", "Number", "Series", "Date", "Seller Name", "Seller Tax ID", "Buyer Name", "Buyer Tax ID", "Total Amount", "Currency", "Method", "Confidence", "Error"},
+	}
+	for _, r := range results {
+		if r.Error != "" || r.Invoice == nil {
+			sheet.Rows = append(sheet.Rows, []any{r.name(), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, r.Error})
+			continue
+		}
+		date := ""
+		if !r.Invoice.Date.IsZero() {
+			date = r.Invoice.Date.Format("2006-01-02")
+		}
+		sheet.Rows = append(sheet.Rows, []any{
+			r.name(),
+			r.Invoice.Number,
+			r.Invoice.Series,
+			date,
+			r.Invoice.Seller.Name,
+			r.Invoice.Seller.TaxID,
+			r.Invoice.Buyer.Name,
+			r.Invoice.Buyer.TaxID,
+			r.Invoice.TotalAmount,
+			r.Invoice.Currency,
+			r.Method,
+			r.Confidence,
+		})
+	}
+	return export.WriteXLSX(w, sheet)
+}
+
 func outputTable(w *os.File, results []*ProcessResult) error {
 	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
 	fmt.Fprintln(tw, "FILE\tNUMBER\tSERIES\tDATE\tTOTAL\tMETHOD\tCONFIDENCE")
 	fmt.Fprintln(tw, "----\t------\t------\t----\t-----\t------\t----------")
 
 	for _, r := range results {
+		if r.Skipped {
+			fmt.Fprintf(tw, "%s\tSKIPPED: %s\t\t\t\t\t\n", r.name(), r.Error)
+			continue
+		}
 		if r.Error != "" {
-			fmt.Fprintf(tw, "%s\tERROR: %s\t\t\t\t\t\n", r.File, r.Error)
+			fmt.Fprintf(tw, "%s\tERROR: %s\t\t\t\t\t\n", r.name(), r.Error)
 			continue
 		}
 
@@ -300,7 +581,7 @@ func outputTable(w *os.File, results []*ProcessResult) error {
 				date = r.Invoice.Date.Format("2006-01-02")
 			}
 			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%.2f\n",
-				r.File,
+				r.name(),
 				r.Invoice.Number,
 				r.Invoice.Series,
 				date,
@@ -319,7 +600,7 @@ func outputCSV(w *os.File, results []*ProcessResult) error {
 
 	for _, r := range results {
 		if r.Error != "" {
-			fmt.Fprintf(w, "%s,,,,,,,,,,,,%s\n", r.File, r.Error)
+			fmt.Fprintf(w, "%s,,,,,,,,,,,,%s\n", escapeCSV(r.name()), escapeCSV(r.Error))
 			continue
 		}
 
@@ -329,7 +610,7 @@ func outputCSV(w *os.File, results []*ProcessResult) error {
 				date = r.Invoice.Date.Format("2006-01-02")
 			}
 			fmt.Fprintf(w, "%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%.2f,\n",
-				r.File,
+				escapeCSV(r.name()),
 				r.Invoice.Number,
 				r.Invoice.Series,
 				date,
@@ -357,10 +638,56 @@ func escapeCSV(s string) string {
 
 // ProcessResult holds the result of processing a single file
 type ProcessResult struct {
-	File       string         `json:"file"`
-	Invoice    *model.Invoice `json:"invoice,omitempty"`
-	Method     string         `json:"method,omitempty"`
-	Confidence float64        `json:"confidence,omitempty"`
-	Warnings   []string       `json:"warnings,omitempty"`
-	Error      string         `json:"error,omitempty"`
+	File       string                 `json:"file"`
+	Source     string                 `json:"source,omitempty"`
+	Submission *processor.Submission  `json:"submission,omitempty"`
+	Pages      string                 `json:"pages,omitempty"`
+	Invoice    *model.Invoice         `json:"invoice,omitempty"`
+	Vendor     *processor.VendorMatch `json:"vendor,omitempty"`
+	Method     string                 `json:"method,omitempty"`
+	Confidence float64                `json:"confidence,omitempty"`
+	Warnings   []string               `json:"warnings,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Skipped    bool                   `json:"skipped,omitempty"`
+	Duplicate  bool                   `json:"duplicate,omitempty"`
+	Retries    int                    `json:"retries,omitempty"`
+	Raw        []llm.AuditEvent       `json:"raw,omitempty"`
+	Debug      *processor.DebugInfo   `json:"debug,omitempty"`
+}
+
+// name is the file, followed by the archive member or attachment if any
+func (r *ProcessResult) name() string {
+	if r.Source == "" {
+		return r.File
+	}
+	return r.File + "/" + r.Source
+}
+
+// loadVendors reads a JSON array of vendors
+func loadVendors(path string) ([]processor.Vendor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vendors: %w", err)
+	}
+
+	var vendors []processor.Vendor
+	if err := json.Unmarshal(data, &vendors); err != nil {
+		return nil, fmt.Errorf("failed to parse vendors: %w", err)
+	}
+	return vendors, nil
+}
+
+// loadExamples reads a JSON Lines file of few-shot examples
+func loadExamples(path string) (*llm.ExampleSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open examples: %w", err)
+	}
+	defer f.Close()
+
+	examples, err := llm.ReadExamples(f)
+	if err != nil {
+		return nil, err
+	}
+	return llm.NewExampleSet(examples...)
 }
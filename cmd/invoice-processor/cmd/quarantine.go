@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/watcher"
+)
+
+var (
+	quarantineOutputDir    string
+	quarantineProcessedDir string
+	quarantineTimeout      time.Duration
+	quarantineSplit        bool
+	replayModel            string
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "List and replay files quarantined by watch",
+	Long: `Inspect and re-run the files watch moved to its quarantine directory.
+
+Each quarantined file keeps its report, with the error class of every failed
+document (parse, not_invoice, timeout, rate_limited, circuit_open, error).
+Replaying runs a file again, optionally with other extraction strategies or
+another model; files that succeed leave the quarantine as watch would have
+moved them, and each report keeps the history of earlier attempts.
+
+Examples:
+  invoice-processor quarantine list failed/
+  invoice-processor quarantine replay failed/ --output-dir results/ --processed-dir done/
+  invoice-processor quarantine replay failed/ scan.pdf --strategies embedded_xml,vision --model gpt-4o`,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list <quarantine-dir>",
+	Short: "List quarantined files and why they failed",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runQuarantineList,
+}
+
+var quarantineReplayCmd = &cobra.Command{
+	Use:   "replay <quarantine-dir> [files...]",
+	Short: "Process quarantined files again (default: all of them)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runQuarantineReplay,
+}
+
+func init() {
+	rootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineReplayCmd)
+
+	quarantineReplayCmd.Flags().StringVar(&quarantineOutputDir, "output-dir", "", "Directory for JSON reports of files that succeed (default: next to each file)")
+	quarantineReplayCmd.Flags().StringVar(&quarantineProcessedDir, "processed-dir", "", "Directory files that succeed are moved to (default: left in place)")
+	quarantineReplayCmd.Flags().DurationVar(&quarantineTimeout, "timeout", 2*time.Minute, "Processing timeout per file")
+	quarantineReplayCmd.Flags().BoolVar(&quarantineSplit, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	quarantineReplayCmd.Flags().StringVar(&replayModel, "model", "", "Send every LLM request to this model instead of the configured ones")
+	addExtractionFlags(quarantineReplayCmd)
+}
+
+// quarantineEntry is one line of quarantine list
+type quarantineEntry struct {
+	File        string    `json:"file"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Attempts    int       `json:"attempts"`
+	Errors      []string  `json:"errors"`
+}
+
+func runQuarantineList(cmd *cobra.Command, args []string) error {
+	reports, err := watcher.Quarantined(watcher.Config{QuarantineDir: args[0]})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]quarantineEntry, 0, len(reports))
+	for _, report := range reports {
+		entry := quarantineEntry{File: filepath.Base(report.Path), ProcessedAt: report.ProcessedAt, Attempts: len(report.Attempts) + 1}
+		for _, doc := range report.Documents {
+			if doc.Error != "" && !doc.Skipped {
+				entry.Errors = append(entry.Errors, fmt.Sprintf("[%s] %s", doc.ErrorClass, doc.Error))
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func runQuarantineReplay(cmd *cobra.Command, args []string) error {
+	cfg := watcher.Config{
+		QuarantineDir:  args[0],
+		OutputDir:      quarantineOutputDir,
+		ProcessedDir:   quarantineProcessedDir,
+		Timeout:        quarantineTimeout,
+		SplitDocuments: quarantineSplit,
+	}
+	for _, dir := range []string{cfg.OutputDir, cfg.ProcessedDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	reports, err := watcher.Quarantined(cfg)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		wanted := make(map[string]bool)
+		for _, name := range args[1:] {
+			wanted[filepath.Base(name)] = true
+		}
+		var selected []*watcher.Report
+		for _, report := range reports {
+			if wanted[filepath.Base(report.Path)] {
+				selected = append(selected, report)
+			}
+		}
+		reports = selected
+	}
+	if len(reports) == 0 {
+		return fmt.Errorf("no quarantined files to replay")
+	}
+
+	opts := watcher.ReplayOptions{Model: replayModel}
+	if strategies != "" {
+		if opts.Strategies, err = processor.ParseStrategies(strategies); err != nil {
+			return err
+		}
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	var failed int
+	for _, report := range reports {
+		replayed, err := watcher.Replay(ctx, pipeline, cfg, report, opts)
+		if err != nil {
+			return err
+		}
+		status := "ok"
+		if replayed.Failed {
+			status = "still failing"
+			failed++
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d document(s), %s (attempt %d)\n", replayed.File, len(replayed.Documents), status, len(replayed.Attempts)+1)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files still failing", failed, len(reports))
+	}
+	return nil
+}
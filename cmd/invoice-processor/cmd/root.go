@@ -1,22 +1,43 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
 )
 
 var (
 	version = "1.0.0"
 
 	// Global flags
+	configFile     string
 	verbose        bool
 	outputFormat   string
 	apiKey         string
+	llmProvider    string
 	llmBaseURL     string
 	llmModel       string
 	llmVisionModel string
+	llmCacheDir    string
+	llmPromptsDir  string
+	llmExamples    string
+	llmProxy       string
+	llmHeaders     []string
+	llmTimeout     time.Duration
+	llmAuditLog    string
+	llmAuditBodies bool
+	llmPromptCache bool
+	llmBreaker     int
+	llmExtraBody   string
+
+	shutdownTimeout time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -42,6 +63,9 @@ Examples:
   # Validate an invoice
   invoice-processor validate invoice.xml`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig(cmd)
+	},
 }
 
 func Execute() error {
@@ -49,22 +73,44 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML configuration file; flags override its settings (env: INVOICE_PROCESSOR_CONFIG)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
-	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", "json", "Output format (json, csv, table)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", "json", "Output format (json, jsonl, csv, table, xlsx)")
 	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "API key for LLM provider (env: LLM_API_KEY)")
+	rootCmd.PersistentFlags().StringVar(&llmProvider, "llm-provider", "", "LLM provider: openai, openrouter, litellm, anthropic, gemini, azure, bedrock, ollama (env: LLM_PROVIDER)")
 	rootCmd.PersistentFlags().StringVar(&llmBaseURL, "llm-base-url", "", "LLM API base URL (env: LLM_BASE_URL)")
 	rootCmd.PersistentFlags().StringVar(&llmModel, "llm-model", "", "LLM model for text extraction (env: LLM_MODEL)")
 	rootCmd.PersistentFlags().StringVar(&llmVisionModel, "llm-vision-model", "", "LLM model for vision/image extraction (env: LLM_VISION_MODEL)")
+	rootCmd.PersistentFlags().StringVar(&llmPromptsDir, "llm-prompts-dir", "", "Directory with prompt overrides (env: LLM_PROMPTS_DIR)")
+	rootCmd.PersistentFlags().StringVar(&llmExamples, "llm-examples", "", "JSON Lines file of few-shot examples (env: LLM_EXAMPLES_FILE)")
+	rootCmd.PersistentFlags().StringVar(&llmCacheDir, "llm-cache-dir", "", "Cache LLM responses in this directory (env: LLM_CACHE_DIR)")
+	rootCmd.PersistentFlags().StringVar(&llmProxy, "llm-proxy", "", "HTTP proxy for LLM requests (env: LLM_PROXY, default: HTTPS_PROXY)")
+	rootCmd.PersistentFlags().StringArrayVar(&llmHeaders, "llm-header", nil, "Extra header for LLM requests as 'Name: value' (repeatable)")
+	rootCmd.PersistentFlags().DurationVar(&llmTimeout, "llm-timeout", llm.DefaultTimeout, "HTTP timeout for LLM requests")
+	rootCmd.PersistentFlags().StringVar(&llmAuditLog, "llm-audit-log", "", "Append a JSON Lines audit record of every LLM call to this file (env: LLM_AUDIT_LOG)")
+	rootCmd.PersistentFlags().BoolVar(&llmAuditBodies, "llm-audit-bodies", false, "Include PII-masked prompts and responses in the audit log")
+	rootCmd.PersistentFlags().BoolVar(&llmPromptCache, "llm-prompt-caching", false, "Mark the system prompt and schema for provider prompt caching (Anthropic, Bedrock)")
+	rootCmd.PersistentFlags().StringVar(&llmExtraBody, "llm-extra-body", "", "JSON object merged into every request to an OpenAI-compatible gateway, e.g. LiteLLM metadata (env: LLM_EXTRA_BODY)")
+	rootCmd.PersistentFlags().IntVar(&llmBreaker, "llm-circuit-breaker", 0, "Stop calling a model for 30s after this many consecutive transient failures, moving to fallback models (0 = disabled)")
+	rootCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time the documents in flight get to finish on SIGINT or SIGTERM before they are canceled")
 
 	// Load from environment variables if not set via flags
 	cobra.OnInitialize(initConfig)
 }
 
 func initConfig() {
+	// Configuration file
+	if configFile == "" {
+		configFile = os.Getenv("INVOICE_PROCESSOR_CONFIG")
+	}
 	// API key
 	if apiKey == "" {
 		apiKey = os.Getenv("LLM_API_KEY")
 	}
+	// Provider
+	if llmProvider == "" {
+		llmProvider = os.Getenv("LLM_PROVIDER")
+	}
 	// Base URL
 	if llmBaseURL == "" {
 		llmBaseURL = os.Getenv("LLM_BASE_URL")
@@ -77,6 +123,70 @@ func initConfig() {
 	if llmVisionModel == "" {
 		llmVisionModel = os.Getenv("LLM_VISION_MODEL")
 	}
+	// Prompt overrides
+	if llmPromptsDir == "" {
+		llmPromptsDir = os.Getenv("LLM_PROMPTS_DIR")
+	}
+	// Few-shot examples
+	if llmExamples == "" {
+		llmExamples = os.Getenv("LLM_EXAMPLES_FILE")
+	}
+	// Response cache
+	if llmCacheDir == "" {
+		llmCacheDir = os.Getenv("LLM_CACHE_DIR")
+	}
+	// Egress proxy
+	if llmProxy == "" {
+		llmProxy = os.Getenv("LLM_PROXY")
+	}
+	// Audit log
+	if llmAuditLog == "" {
+		llmAuditLog = os.Getenv("LLM_AUDIT_LOG")
+	}
+	// Gateway request fields
+	if llmExtraBody == "" {
+		llmExtraBody = os.Getenv("LLM_EXTRA_BODY")
+	}
+}
+
+// llmEnabled reports whether enough configuration is present to use the LLM
+func llmEnabled() bool {
+	return apiKey != "" || (llmProvider != "" && !llm.RequiresAPIKey(llmProvider))
+}
+
+// llmHTTPOptions builds the LLM transport settings from the proxy and header flags
+func llmHTTPOptions() (llm.HTTPOptions, error) {
+	var opts llm.HTTPOptions
+	if llmProxy != "" {
+		proxy, err := url.Parse(llmProxy)
+		if err != nil {
+			return opts, fmt.Errorf("invalid LLM proxy URL: %w", err)
+		}
+		opts.Proxy = proxy
+	}
+	for _, header := range llmHeaders {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return opts, fmt.Errorf("invalid LLM header %q, expected 'Name: value'", header)
+		}
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return opts, nil
+}
+
+// llmExtraBodyFields parses --llm-extra-body
+func llmExtraBodyFields() (map[string]any, error) {
+	if llmExtraBody == "" {
+		return nil, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(llmExtraBody), &fields); err != nil {
+		return nil, fmt.Errorf("invalid LLM extra body, expected a JSON object: %w", err)
+	}
+	return fields, nil
 }
 
 func printVerbose(format string, args ...interface{}) {
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of extracted invoices",
+	Long: `Print the JSON Schema (draft 2020-12) of the invoices the processor writes,
+for consumers to validate payloads against. The schema is of the version in
+the payloads' schema_version; docs/invoice.schema.json holds a copy.
+
+Example:
+  invoice-processor schema > invoice.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: runSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchema(cmd *cobra.Command, args []string) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(model.InvoiceJSONSchema())
+}
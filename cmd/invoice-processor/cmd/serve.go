@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,14 +11,23 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
 	"github.com/rezonia/invoice-processor/internal/server"
+	"github.com/rezonia/invoice-processor/internal/webhook"
 )
 
 var (
 	serverAddr     string
+	grpcAddr       string
 	serverDebug    bool
+	serverMetrics  bool
 	readTimeout    time.Duration
 	writeTimeout   time.Duration
+	webhookURL     string
+	webhookSecret  string
+	eventsFile     string
 )
 
 var serveCmd = &cobra.Command{
@@ -31,7 +42,13 @@ The API provides endpoints for:
   - POST /api/v1/process/auto   - Auto-detect and process
   - POST /api/v1/validate       - Validate invoice
   - POST /api/v1/info           - Get file information
+  - GET  /api/v1/events         - Event stream of processed invoices (with --events-file)
   - GET  /health                - Health check
+  - GET  /metrics               - Prometheus metrics (with --metrics)
+
+With --grpc-address, the Process and streaming ProcessBatch methods of the
+gRPC service in api/grpc/proto/invoice.proto are served on a second address
+over unencrypted HTTP/2.
 
 Examples:
   # Start server on default port
@@ -41,7 +58,13 @@ Examples:
   invoice-processor serve --address :8080 --api-key <key>
 
   # Start in debug mode
-  invoice-processor serve --debug`,
+  invoice-processor serve --debug
+
+  # Serve the gRPC API too
+  invoice-processor serve --grpc-address :9090
+
+  # Post results to a webhook, signed with a secret
+  invoice-processor serve --webhook-url https://example.com/hook --webhook-secret <secret>`,
 	RunE: runServe,
 }
 
@@ -49,40 +72,100 @@ func init() {
 	rootCmd.AddCommand(serveCmd)
 
 	serveCmd.Flags().StringVar(&serverAddr, "address", ":8080", "Server listen address")
+	serveCmd.Flags().StringVar(&grpcAddr, "grpc-address", "", "gRPC listen address (default: gRPC off)")
 	serveCmd.Flags().BoolVar(&serverDebug, "debug", false, "Enable debug mode")
+	serveCmd.Flags().BoolVar(&serverMetrics, "metrics", false, "Serve Prometheus metrics at /metrics")
 	serveCmd.Flags().DurationVar(&readTimeout, "read-timeout", 30*time.Second, "HTTP read timeout")
 	serveCmd.Flags().DurationVar(&writeTimeout, "write-timeout", 5*time.Minute, "HTTP write timeout")
+	serveCmd.Flags().StringVar(&webhookURL, "webhook-url", "", "URL to post processing results to")
+	serveCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Secret to sign webhook deliveries with (HMAC-SHA256)")
+	serveCmd.Flags().StringVar(&eventsFile, "events-file", "", "Append invoice events to this JSON lines file and serve them at /api/v1/events")
 }
 
 func runServe(cmd *cobra.Command, args []string) error {
+	// Fail early on an invalid provider; the server would silently disable LLM extraction
+	if llmProvider != "" {
+		if _, err := llm.NewProvider(llm.ProviderConfig{Name: llmProvider, APIKey: apiKey, BaseURL: llmBaseURL}); err != nil {
+			return err
+		}
+	}
+
 	config := &server.Config{
 		Address:        serverAddr,
+		GRPCAddress:    grpcAddr,
 		APIKey:         apiKey,
+		LLMProvider:    llmProvider,
 		LLMBaseURL:     llmBaseURL,
 		LLMModel:       llmModel,
 		LLMVisionModel: llmVisionModel,
 		ReadTimeout:    readTimeout,
 		WriteTimeout:   writeTimeout,
 		Debug:          serverDebug,
+		Metrics:        serverMetrics,
+	}
+	level := slog.LevelInfo
+	if serverDebug {
+		level = slog.LevelDebug
+	}
+	config.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	if webhookURL != "" {
+		config.Webhook = webhook.NewDispatcher(webhookURL, webhook.WithSecret(webhookSecret))
+	}
+	resultStore, closeStore, err := configStore(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	config.Store = resultStore
+	if eventsFile != "" {
+		events, err := outbox.OpenFileStore(eventsFile)
+		if err != nil {
+			return err
+		}
+		defer events.Close()
+		config.Events = events
+	}
+	if fileConfig != nil && fileConfig.Extraction.Idempotency {
+		config.Idempotency = processor.NewMemoryIdempotencyStore()
+	}
+	if fileConfig != nil {
+		if config.Tenants, err = fileConfig.ProcessorTenants(); err != nil {
+			return err
+		}
+		config.Budget = fileConfig.BudgetController()
 	}
 
 	srv := server.NewServer(config)
 
-	// Handle graceful shutdown
-	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-		fmt.Println("\nShutting down server...")
-		os.Exit(0)
-	}()
-
 	fmt.Printf("Starting server on %s\n", serverAddr)
-	if apiKey != "" {
+	if grpcAddr != "" {
+		fmt.Printf("Serving gRPC on %s\n", grpcAddr)
+	}
+	if llmEnabled() {
 		fmt.Println("LLM extraction enabled")
 	} else {
 		fmt.Println("LLM extraction disabled (no API key)")
 	}
 
-	return srv.Run()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Run() }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Let the requests in flight finish, then deliver their notifications
+	fmt.Println("\nShutting down server...")
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Stop(stopCtx)
+	if config.Webhook != nil {
+		webhookCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		config.Webhook.Close(webhookCtx)
+	}
+	return err
 }
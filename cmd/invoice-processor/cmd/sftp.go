@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/sftp"
+)
+
+var (
+	sftpAddr          string
+	sftpUser          string
+	sftpPassword      string
+	sftpKeyFile       string
+	sftpKeyPassphrase string
+	sftpKnownHosts    string
+	sftpHostKey       string
+	sftpDir           string
+	sftpPatterns      []string
+	sftpProcessedDir  string
+	sftpFailedDir     string
+	sftpMinAge        time.Duration
+	sftpInterval      time.Duration
+	sftpTimeout       time.Duration
+	sftpSplit         bool
+	sftpOnce          bool
+	sftpOutput        string
+)
+
+var sftpCmd = &cobra.Command{
+	Use:   "sftp",
+	Short: "Process invoices dropped on an SFTP server",
+	Long: `Poll a directory of an SFTP server and process every file matching
+--pattern, oldest first. Each document is written as one JSON line.
+
+Files are fetched once they have gone unmodified for --min-age, so uploads in
+progress are left alone, and are then moved to --processed-dir, or to
+--failed-dir when a document failed. The server's host key is checked against
+--known-hosts (default: ~/.ssh/known_hosts) or --host-key.
+
+Examples:
+  SFTP_PASSWORD=... invoice-processor sftp --addr sftp.supplier.com:22 --user acme --dir outbox --pattern '*.pdf'
+  invoice-processor sftp --addr sftp.supplier.com:22 --user acme --key ~/.ssh/id_ed25519 --once -o invoices.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: runSFTP,
+}
+
+func init() {
+	rootCmd.AddCommand(sftpCmd)
+
+	sftpCmd.Flags().StringVar(&sftpAddr, "addr", "", "SFTP server host:port (env: SFTP_ADDR)")
+	sftpCmd.Flags().StringVar(&sftpUser, "user", "", "SFTP username (env: SFTP_USER)")
+	sftpCmd.Flags().StringVar(&sftpPassword, "password", "", "SFTP password (env: SFTP_PASSWORD)")
+	sftpCmd.Flags().StringVar(&sftpKeyFile, "key", "", "Private key file (env: SFTP_KEY)")
+	sftpCmd.Flags().StringVar(&sftpKeyPassphrase, "key-passphrase", "", "Passphrase of the private key (env: SFTP_KEY_PASSPHRASE)")
+	sftpCmd.Flags().StringVar(&sftpKnownHosts, "known-hosts", "", "known_hosts file the server's host key is checked against (default: ~/.ssh/known_hosts)")
+	sftpCmd.Flags().StringVar(&sftpHostKey, "host-key", "", "Server's host key, as an authorized_keys line, instead of --known-hosts")
+	sftpCmd.Flags().StringVar(&sftpDir, "dir", "", "Remote directory to poll (default: the login directory)")
+	sftpCmd.Flags().StringSliceVar(&sftpPatterns, "pattern", nil, "Glob of the files to process, such as '*.pdf' (repeatable; default: all)")
+	sftpCmd.Flags().StringVar(&sftpProcessedDir, "processed-dir", "processed", "Remote directory processed files are moved to")
+	sftpCmd.Flags().StringVar(&sftpFailedDir, "failed-dir", "failed", "Remote directory files with a failed document are moved to")
+	sftpCmd.Flags().DurationVar(&sftpMinAge, "min-age", sftp.DefaultMinAge, "Time a file must go unmodified before it is fetched")
+	sftpCmd.Flags().DurationVar(&sftpInterval, "interval", sftp.DefaultPollInterval, "Time between polls")
+	sftpCmd.Flags().DurationVar(&sftpTimeout, "timeout", 5*time.Minute, "Processing timeout per file")
+	sftpCmd.Flags().BoolVar(&sftpSplit, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	sftpCmd.Flags().BoolVar(&sftpOnce, "once", false, "Poll once and exit")
+	sftpCmd.Flags().StringVarP(&sftpOutput, "output", "o", "", "Append JSON lines to this file (default: stdout)")
+	addExtractionFlags(sftpCmd)
+}
+
+func runSFTP(cmd *cobra.Command, args []string) error {
+	if sftpAddr == "" {
+		sftpAddr = os.Getenv("SFTP_ADDR")
+	}
+	if sftpUser == "" {
+		sftpUser = os.Getenv("SFTP_USER")
+	}
+	if sftpPassword == "" {
+		sftpPassword = os.Getenv("SFTP_PASSWORD")
+	}
+	if sftpKeyFile == "" {
+		sftpKeyFile = os.Getenv("SFTP_KEY")
+	}
+	if sftpKeyPassphrase == "" {
+		sftpKeyPassphrase = os.Getenv("SFTP_KEY_PASSPHRASE")
+	}
+
+	var key []byte
+	if sftpKeyFile != "" {
+		var err error
+		if key, err = os.ReadFile(sftpKeyFile); err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+	}
+	if sftpKnownHosts == "" && sftpHostKey == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			sftpKnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+
+	out := os.Stdout
+	if sftpOutput != "" {
+		f, err := os.OpenFile(sftpOutput, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	connector, err := sftp.NewConnector(pipeline, sftp.Config{
+		Addr:           sftpAddr,
+		Username:       sftpUser,
+		Password:       sftpPassword,
+		PrivateKey:     key,
+		KeyPassphrase:  sftpKeyPassphrase,
+		KnownHostsFile: sftpKnownHosts,
+		HostKey:        sftpHostKey,
+		Dir:            sftpDir,
+		Patterns:       sftpPatterns,
+		ProcessedDir:   sftpProcessedDir,
+		FailedDir:      sftpFailedDir,
+		MinAge:         sftpMinAge,
+		PollInterval:   sftpInterval,
+		Timeout:        sftpTimeout,
+		SplitDocuments: sftpSplit,
+	}, func(_ context.Context, file sftp.File, results []*processor.Result) error {
+		printVerbose("Processing: %s\n", file.Path)
+		for _, result := range convertResults(file.Path, results) {
+			if err := enc.Encode(result); err != nil {
+				return err // Leave the file for the next poll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	if sftpOnce {
+		n, err := connector.Poll(ctx)
+		printVerbose("Processed %d file(s)\n", n)
+		return err
+	}
+	return connector.Run(ctx, func(err error) {
+		fmt.Fprintf(os.Stderr, "SFTP poll failed: %v\n", err)
+	})
+}
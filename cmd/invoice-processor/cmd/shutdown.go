@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// shutdownContext returns a context canceled on SIGINT or SIGTERM. The
+// signal also stops pipeline, so it takes no new documents and gives those in
+// flight --shutdown-timeout to finish before canceling them.
+func shutdownContext(pipeline *processor.Pipeline) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		if pipeline.Stopped() {
+			return
+		}
+		stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := pipeline.Stop(stopCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "Shutdown: %v\n", err)
+		}
+	}()
+	return ctx, stop
+}
@@ -23,7 +23,7 @@ var validateCmd = &cobra.Command{
 
 Checks performed:
   - Required fields present (number, date, seller, buyer)
-  - Tax ID format (10 or 13 digits for Vietnam)
+  - Tax ID format (10, 12 or 13 digits for Vietnam)
   - Amount calculations (subtotal + tax = total)
   - Date validity
 
@@ -210,8 +210,8 @@ func validateFile(pipeline *processor.Pipeline, filePath string) *ValidationResu
 }
 
 func isValidTaxID(taxID string) bool {
-	// Vietnam tax ID: 10 or 13 digits
-	if len(taxID) != 10 && len(taxID) != 13 {
+	// Vietnam tax ID: 10 or 13 digits, or a 12-digit personal ID
+	if len(taxID) != 10 && len(taxID) != 12 && len(taxID) != 13 {
 		return false
 	}
 
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rezonia/invoice-processor/internal/watcher"
+)
+
+var (
+	watchOutputDir     string
+	watchQuarantineDir string
+	watchProcessedDir  string
+	watchInterval      time.Duration
+	watchTimeout       time.Duration
+	watchSplit         bool
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [directories...]",
+	Short: "Process invoice files as they arrive in directories",
+	Long: `Watch directories and process every new file dropped into them.
+
+Each file gets a <file>.json report in the output directory (default: next to
+the file). Files with a failed document are moved to the quarantine directory
+together with their report; files that succeed are moved to the processed
+directory, if set. Files are picked up once their size stops changing; hidden
+files and partial downloads (.part, .tmp, .crdownload) are ignored. Without
+directories, those of connectors.watch in the --config file are watched.
+
+Examples:
+  invoice-processor watch inbox/ --quarantine-dir failed/
+  invoice-processor watch inbox/ --output-dir results/ --processed-dir done/ --quarantine-dir failed/`,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVar(&watchOutputDir, "output-dir", "", "Directory for JSON reports (default: next to each file)")
+	watchCmd.Flags().StringVar(&watchQuarantineDir, "quarantine-dir", "quarantine", "Directory failed files are moved to")
+	watchCmd.Flags().StringVar(&watchProcessedDir, "processed-dir", "", "Directory processed files are moved to (default: left in place)")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", watcher.DefaultPollInterval, "How often the directories are scanned")
+	watchCmd.Flags().DurationVar(&watchTimeout, "timeout", 2*time.Minute, "Processing timeout per file")
+	watchCmd.Flags().BoolVar(&watchSplit, "split", false, "Return one result per invoice for PDFs bundling several invoices")
+	addExtractionFlags(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && fileConfig != nil {
+		args = fileConfig.Connectors.Watch.Dirs
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no directories to watch")
+	}
+
+	pipeline, cleanup, err := newPipeline()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	w, err := watcher.New(pipeline, watcher.Config{
+		Dirs:           args,
+		OutputDir:      watchOutputDir,
+		QuarantineDir:  watchQuarantineDir,
+		ProcessedDir:   watchProcessedDir,
+		PollInterval:   watchInterval,
+		Timeout:        watchTimeout,
+		SplitDocuments: watchSplit,
+		OnReport: func(report *watcher.Report) {
+			status := "ok"
+			if report.Failed {
+				status = "quarantined"
+			}
+			fmt.Fprintf(os.Stderr, "%s: %d document(s), %s\n", report.File, len(report.Documents), status)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := shutdownContext(pipeline)
+	defer stop()
+
+	printVerbose("Watching %v\n", args)
+	return w.Run(ctx)
+}
@@ -0,0 +1,224 @@
+// Package address splits Vietnamese addresses into administrative units with
+// standardized names.
+package address
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+type level int
+
+const (
+	levelWard level = iota + 1
+	levelDistrict
+	levelProvince
+)
+
+// unit is an administrative unit prefix such as "Phường" or its abbreviation "P."
+type unit struct {
+	pattern *regexp.Regexp // The name follows in group 1
+	name    string         // Standardized prefix
+	level   level
+}
+
+var units = []unit{
+	{regexp.MustCompile(`(?i)^(?:phường|phuong)\s+(.+)$`), "Phường", levelWard},
+	{regexp.MustCompile(`(?i)^p\.\s*(.+)$`), "Phường", levelWard},
+	{regexp.MustCompile(`(?i)^p\s*(\d+)$`), "Phường", levelWard},
+	{regexp.MustCompile(`(?i)^(?:thị trấn|thi tran)\s+(.+)$`), "Thị trấn", levelWard},
+	{regexp.MustCompile(`(?i)^tt\.\s*(.+)$`), "Thị trấn", levelWard},
+	{regexp.MustCompile(`(?i)^xã\s+(.+)$`), "Xã", levelWard},
+	{regexp.MustCompile(`(?i)^x\.\s*(.+)$`), "Xã", levelWard},
+	{regexp.MustCompile(`(?i)^(?:quận|quan)\s+(.+)$`), "Quận", levelDistrict},
+	{regexp.MustCompile(`(?i)^q\.\s*(.+)$`), "Quận", levelDistrict},
+	{regexp.MustCompile(`(?i)^q\s*(\d+)$`), "Quận", levelDistrict},
+	{regexp.MustCompile(`(?i)^(?:huyện|huyen)\s+(.+)$`), "Huyện", levelDistrict},
+	{regexp.MustCompile(`(?i)^h\.\s*(.+)$`), "Huyện", levelDistrict},
+	{regexp.MustCompile(`(?i)^(?:thị xã|thi xa)\s+(.+)$`), "Thị xã", levelDistrict},
+	{regexp.MustCompile(`(?i)^tx[.\s]\s*(.+)$`), "Thị xã", levelDistrict},
+	{regexp.MustCompile(`(?i)^(?:thành phố|thanh pho)\s+(.+)$`), "Thành phố", levelDistrict},
+	{regexp.MustCompile(`(?i)^tp[.\s]\s*(.+)$`), "Thành phố", levelDistrict},
+	{regexp.MustCompile(`(?i)^(?:tỉnh|tinh)\s+(.+)$`), "Tỉnh", levelProvince},
+}
+
+var (
+	// unitBoundary finds where a unit starts in an address written without commas
+	unitBoundary = regexp.MustCompile(`(?i)\s+(?:phường|p\.|quận|q\.|huyện|h\.|thị xã|tx\.|thị trấn|tt\.|thành phố|tp\.|tỉnh)`)
+
+	// provincePrefix is stripped from folded province names
+	provincePrefix = regexp.MustCompile(`^(?:(?:tinh|thanh pho|tp)[.\s]+|t\.\s*)`)
+
+	countryNames = []string{"việt nam", "viet nam", "vietnam", "vn"}
+)
+
+// Parse splits an address into street, ward, district and province, reading
+// units from their prefixes ("P.", "Quận", "TP.") and the province from the
+// last component. It reports whether both the ward and the province were found.
+func Parse(s string) (model.Address, bool) {
+	parts := components(s)
+	var addr model.Address
+
+	// The province is written last, possibly split on its own hyphen ("Bà Rịa - Vũng Tàu")
+	if n := len(parts); n > 1 {
+		if name, ok := province(parts[n-2] + " - " + parts[n-1]); ok {
+			addr.Province, parts = name, parts[:n-2]
+		}
+	}
+	if n := len(parts); n > 0 && addr.Province == "" {
+		if name, ok := province(parts[n-1]); ok {
+			addr.Province, parts = name, parts[:n-1]
+		}
+	}
+
+	// Units are read right to left; the street is everything before the first one
+	street := len(parts)
+	for i := len(parts) - 1; i >= 0; i-- {
+		name, lvl, ok := parseUnit(parts[i])
+		if !ok {
+			continue
+		}
+		switch {
+		case lvl == levelWard && addr.Ward == "":
+			addr.Ward = name
+		case lvl == levelDistrict && addr.District == "":
+			addr.District = name
+		case lvl == levelProvince && addr.Province == "":
+			addr.Province = name
+		default:
+			continue
+		}
+		street = i
+	}
+
+	// An unprefixed component between the street and the district is the ward
+	if addr.Ward == "" && addr.District != "" && street >= 2 && !startsWithDigit(parts[street-1]) {
+		addr.Ward = parts[street-1]
+		street--
+	}
+	addr.Street = strings.Join(parts[:street], ", ")
+
+	return addr, addr.Ward != "" && addr.Province != ""
+}
+
+// Normalize standardizes the unit names of an address split elsewhere, such as
+// by an LLM: unit prefixes are expanded and the province name standardized
+func Normalize(addr model.Address) model.Address {
+	addr.Street = collapse(addr.Street)
+	if name, _, ok := parseUnit(addr.Ward); ok {
+		addr.Ward = name
+	}
+	if name, _, ok := parseUnit(addr.District); ok {
+		addr.District = name
+	}
+	if name, ok := province(addr.Province); ok {
+		addr.Province = name
+	} else {
+		addr.Province = collapse(addr.Province)
+	}
+	return addr
+}
+
+// components splits an address on commas, or on hyphens and unit prefixes
+// when it has none, and drops a trailing country name
+func components(s string) []string {
+	s = collapse(s)
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' })
+	if len(parts) == 1 {
+		parts = strings.Split(parts[0], " - ")
+	}
+	if len(parts) == 1 {
+		parts = splitAtUnits(parts[0])
+	}
+
+	var out []string
+	for _, part := range parts {
+		if part = strings.Trim(part, " .-"); part != "" {
+			out = append(out, part)
+		}
+	}
+	if n := len(out); n > 0 && isCountry(out[n-1]) {
+		out = out[:n-1]
+	}
+	return out
+}
+
+func splitAtUnits(s string) []string {
+	var parts []string
+	start := 0
+	for _, loc := range unitBoundary.FindAllStringIndex(s, -1) {
+		parts = append(parts, s[start:loc[0]])
+		start = loc[0]
+	}
+	return append(parts, s[start:])
+}
+
+// parseUnit reads a unit prefix and returns the name with the prefix standardized
+func parseUnit(s string) (string, level, bool) {
+	s = collapse(s)
+	for _, u := range units {
+		if m := u.pattern.FindStringSubmatch(s); m != nil {
+			name := m[1]
+			if trimmed := strings.TrimLeft(name, "0"); trimmed != "" && startsWithDigit(trimmed) {
+				name = trimmed // "Quận 01" is "Quận 1"
+			}
+			return u.name + " " + name, u.level, true
+		}
+	}
+	return "", 0, false
+}
+
+// province returns the standardized name of a province written in any common form
+func province(s string) (string, bool) {
+	name, ok := provinceIndex[provinceKey(s)]
+	return name, ok
+}
+
+// provinceKey folds a province name to lowercase ASCII letters and digits
+// without its "Tỉnh" or "Thành phố" prefix
+func provinceKey(s string) string {
+	folded := provincePrefix.ReplaceAllString(fold(collapse(s)), "")
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, folded)
+}
+
+// fold lowercases s and strips Vietnamese diacritics
+func fold(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r == 'đ' {
+			r = 'd'
+		} else if r >= utf8.RuneSelf {
+			r, _ = utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isCountry(s string) bool {
+	folded := fold(s)
+	for _, name := range countryNames {
+		if folded == fold(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
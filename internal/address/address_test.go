@@ -0,0 +1,95 @@
+package address_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/address"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     model.Address
+		complete bool
+	}{
+		{
+			input:    "123 Lê Lợi, P. Bến Nghé, Q.1, TP.HCM",
+			want:     model.Address{Street: "123 Lê Lợi", Ward: "Phường Bến Nghé", District: "Quận 1", Province: "Hồ Chí Minh"},
+			complete: true,
+		},
+		{
+			input:    "Tầng 5, Tòa nhà ABC, 45 Nguyễn Huệ, Phường 05, Quận 03, Thành phố Hồ Chí Minh, Việt Nam",
+			want:     model.Address{Street: "Tầng 5, Tòa nhà ABC, 45 Nguyễn Huệ", Ward: "Phường 5", District: "Quận 3", Province: "Hồ Chí Minh"},
+			complete: true,
+		},
+		{
+			input:    "Số 8 Phạm Hùng, Phường Mai Dịch, Quận Cầu Giấy, Hà Nội",
+			want:     model.Address{Street: "Số 8 Phạm Hùng", Ward: "Phường Mai Dịch", District: "Quận Cầu Giấy", Province: "Hà Nội"},
+			complete: true,
+		},
+		{
+			input:    "KCN VSIP, Phường Bình Hòa, TP. Thuận An, Tỉnh Bình Dương",
+			want:     model.Address{Street: "KCN VSIP", Ward: "Phường Bình Hòa", District: "Thành phố Thuận An", Province: "Bình Dương"},
+			complete: true,
+		},
+		{
+			// After the 2025 reform there is no district
+			input:    "12 Trần Phú, Xã Tân Hội, Tỉnh Lâm Đồng",
+			want:     model.Address{Street: "12 Trần Phú", Ward: "Xã Tân Hội", Province: "Lâm Đồng"},
+			complete: true,
+		},
+		{
+			input:    "123 Le Loi P.Ben Nghe Q.1 TP.HCM",
+			want:     model.Address{Street: "123 Le Loi", Ward: "Phường Ben Nghe", District: "Quận 1", Province: "Hồ Chí Minh"},
+			complete: true,
+		},
+		{
+			input:    "56 Đường 3/2, Bến Nghé, Quận 1, Sài Gòn",
+			want:     model.Address{Street: "56 Đường 3/2", Ward: "Bến Nghé", District: "Quận 1", Province: "Hồ Chí Minh"},
+			complete: true,
+		},
+		{
+			input:    "Số 1, Đường 30/4, Phường Thắng Tam, Bà Rịa - Vũng Tàu",
+			want:     model.Address{Street: "Số 1, Đường 30/4", Ward: "Phường Thắng Tam", Province: "Bà Rịa - Vũng Tàu"},
+			complete: true,
+		},
+		{
+			input:    "Thừa Thiên Huế",
+			want:     model.Address{Province: "Huế"},
+			complete: false,
+		},
+		{
+			input:    "45 Hai Bà Trưng, Quận 1",
+			want:     model.Address{Street: "45 Hai Bà Trưng", District: "Quận 1"},
+			complete: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, complete := address.Parse(tt.input)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.complete, complete)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got := address.Normalize(model.Address{
+		Street:   " 12  Lý Thường Kiệt ",
+		Ward:     "P.Hàng Bài",
+		District: "Hoàn Kiếm",
+		Province: "TP Ha Noi",
+	})
+	assert.Equal(t, model.Address{
+		Street:   "12 Lý Thường Kiệt",
+		Ward:     "Phường Hàng Bài",
+		District: "Hoàn Kiếm",
+		Province: "Hà Nội",
+	}, got)
+
+	assert.Equal(t, "Atlantis", address.Normalize(model.Address{Province: "Atlantis"}).Province, "unknown provinces are kept")
+}
@@ -0,0 +1,84 @@
+package address
+
+// provinces maps the standardized name of each province and centrally governed
+// city to the other ways it is written. Names and aliases are compared by key
+// (see provinceKey), so accents, case, spacing and punctuation do not matter.
+// The list covers the 63 units in use before the 2025 merger; the 34 merged
+// provinces all kept one of these names.
+var provinces = map[string][]string{
+	"An Giang":          nil,
+	"Bà Rịa - Vũng Tàu": {"BRVT", "Vũng Tàu"},
+	"Bắc Giang":         nil,
+	"Bắc Kạn":           {"Bắc Cạn"},
+	"Bạc Liêu":          nil,
+	"Bắc Ninh":          nil,
+	"Bến Tre":           nil,
+	"Bình Định":         nil,
+	"Bình Dương":        nil,
+	"Bình Phước":        nil,
+	"Bình Thuận":        nil,
+	"Cà Mau":            nil,
+	"Cần Thơ":           nil,
+	"Cao Bằng":          nil,
+	"Đà Nẵng":           nil,
+	"Đắk Lắk":           {"Đắc Lắc", "Daklak"},
+	"Đắk Nông":          {"Đắc Nông"},
+	"Điện Biên":         nil,
+	"Đồng Nai":          nil,
+	"Đồng Tháp":         nil,
+	"Gia Lai":           nil,
+	"Hà Giang":          nil,
+	"Hà Nam":            nil,
+	"Hà Nội":            {"HN", "Hanoi"},
+	"Hà Tĩnh":           nil,
+	"Hải Dương":         nil,
+	"Hải Phòng":         nil,
+	"Hậu Giang":         nil,
+	"Hòa Bình":          nil,
+	"Hồ Chí Minh":       {"HCM", "TPHCM", "HCMC", "Sài Gòn", "Ho Chi Minh City"},
+	"Huế":               {"Thừa Thiên Huế", "TT Huế"},
+	"Hưng Yên":          nil,
+	"Khánh Hòa":         nil,
+	"Kiên Giang":        nil,
+	"Kon Tum":           {"Kontum"},
+	"Lai Châu":          nil,
+	"Lâm Đồng":          nil,
+	"Lạng Sơn":          nil,
+	"Lào Cai":           nil,
+	"Long An":           nil,
+	"Nam Định":          nil,
+	"Nghệ An":           nil,
+	"Ninh Bình":         nil,
+	"Ninh Thuận":        nil,
+	"Phú Thọ":           nil,
+	"Phú Yên":           nil,
+	"Quảng Bình":        nil,
+	"Quảng Nam":         nil,
+	"Quảng Ngãi":        nil,
+	"Quảng Ninh":        nil,
+	"Quảng Trị":         nil,
+	"Sóc Trăng":         nil,
+	"Sơn La":            nil,
+	"Tây Ninh":          nil,
+	"Thái Bình":         nil,
+	"Thái Nguyên":       nil,
+	"Thanh Hóa":         nil,
+	"Tiền Giang":        nil,
+	"Trà Vinh":          nil,
+	"Tuyên Quang":       nil,
+	"Vĩnh Long":         nil,
+	"Vĩnh Phúc":         nil,
+	"Yên Bái":           nil,
+}
+
+// provinceIndex maps province keys to standardized names
+var provinceIndex = func() map[string]string {
+	index := make(map[string]string)
+	for name, aliases := range provinces {
+		index[provinceKey(name)] = name
+		for _, alias := range aliases {
+			index[provinceKey(alias)] = name
+		}
+	}
+	return index
+}()
@@ -0,0 +1,233 @@
+// Package clouddrive ingests receipts and invoices dropped into shared
+// Google Drive and Dropbox folders, writing each file's results back next to
+// it
+package clouddrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Defaults for Config
+const (
+	DefaultPollInterval = time.Minute
+	DefaultMaxFiles     = 100
+)
+
+// ResultSuffix is appended to the name of a file for the name of its result
+const ResultSuffix = ".json"
+
+// File describes a file of a folder
+type File struct {
+	ID      string // Service identifier, passed back to Download
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Folder is a shared folder of a storage service
+type Folder interface {
+	// List returns the files directly in the folder, without subfolders
+	List(ctx context.Context) ([]File, error)
+	Download(ctx context.Context, file File) ([]byte, error)
+	// Upload creates the file name in the folder, replacing one of that name
+	// where the service has unique names
+	Upload(ctx context.Context, name string, data []byte, contentType string) error
+}
+
+// TokenSource returns the OAuth access token requests are authorized with
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource returning an access token obtained
+// elsewhere
+type StaticToken string
+
+// Token returns t
+func (t StaticToken) Token(context.Context) (string, error) {
+	if t == "" {
+		return "", errors.New("access token is empty")
+	}
+	return string(t), nil
+}
+
+// cachedToken reuses an access token until shortly before it expires
+type cachedToken struct {
+	fetch func(ctx context.Context) (token string, ttl time.Duration, err error)
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, time.Now().Add(ttl-time.Minute)
+	return token, nil
+}
+
+// Config configures a Connector
+type Config struct {
+	PollInterval   time.Duration // Time between polls (default: DefaultPollInterval)
+	MaxFiles       int           // Files processed per poll (default: DefaultMaxFiles)
+	Timeout        time.Duration // Per-file processing timeout (0 = none)
+	SplitDocuments bool          // See processor.ProcessOptions.SplitDocuments
+
+	// OnReport is called after each file is processed, for logging
+	OnReport func(report *Report)
+}
+
+// Report is the JSON written next to each processed file
+type Report struct {
+	File        string                     `json:"file"`
+	ProcessedAt time.Time                  `json:"processed_at"`
+	Failed      bool                       `json:"failed,omitempty"`
+	Results     []*processor.EncodedResult `json:"results"`
+}
+
+// Connector polls a folder and runs each new file through the pipeline. A
+// file is new until a result named after it (<name>.json) is in the folder,
+// so deleting a result has the file processed again. Failed documents are
+// recorded in the result like the others.
+type Connector struct {
+	pipeline *processor.Pipeline
+	folder   Folder
+	cfg      Config
+}
+
+// NewConnector returns a connector polling folder
+func NewConnector(pipeline *processor.Pipeline, folder Folder, cfg Config) (*Connector, error) {
+	if folder == nil {
+		return nil, errors.New("folder is required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultMaxFiles
+	}
+	return &Connector{pipeline: pipeline, folder: folder, cfg: cfg}, nil
+}
+
+// Run polls until ctx is canceled, then returns nil. A failed poll, such as
+// an expired token, is reported to onError and retried on the next interval.
+func (c *Connector) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Poll(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll processes up to MaxFiles new files, oldest first, and returns how
+// many were processed. Once ctx is canceled the file in flight is finished
+// and the others are left for the next run, as is a file the pipeline is
+// stopped before finishing (see processor.Pipeline.Stop).
+func (c *Connector) Poll(ctx context.Context) (int, error) {
+	files, err := c.folder.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := newFiles(files)
+	if len(pending) > c.cfg.MaxFiles {
+		pending = pending[:c.cfg.MaxFiles]
+	}
+
+	handled := 0
+	work := context.WithoutCancel(ctx) // Finish the file in flight
+	for _, file := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		data, err := c.folder.Download(work, file)
+		if err != nil {
+			return handled, fmt.Errorf("failed to download %s: %w", file.Name, err)
+		}
+		report, stopped := c.process(work, file, data)
+		if stopped {
+			break // Interrupted: leave the file for the next run
+		}
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return handled, fmt.Errorf("failed to encode the result of %s: %w", file.Name, err)
+		}
+		if err := c.folder.Upload(work, file.Name+ResultSuffix, out, "application/json"); err != nil {
+			return handled, fmt.Errorf("failed to upload the result of %s: %w", file.Name, err)
+		}
+		if c.cfg.OnReport != nil {
+			c.cfg.OnReport(report)
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// newFiles returns the files without a result, oldest first
+func newFiles(files []File) []File {
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Name] = true
+	}
+	var pending []File
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, ResultSuffix) || strings.HasPrefix(f.Name, ".") || names[f.Name+ResultSuffix] {
+			continue
+		}
+		pending = append(pending, f)
+	}
+	slices.SortFunc(pending, func(a, b File) int {
+		if n := a.ModTime.Compare(b.ModTime); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return pending
+}
+
+// process runs one file through the pipeline. It reports whether the
+// pipeline was stopped before the file was finished.
+func (c *Connector) process(ctx context.Context, file File, data []byte) (*Report, bool) {
+	ctx = llm.ContextWithDocumentID(ctx, file.ID)
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	results := c.pipeline.Process(ctx, data, processor.ProcessOptions{Filename: file.Name, SplitDocuments: c.cfg.SplitDocuments})
+
+	report := &Report{File: file.Name, ProcessedAt: time.Now().UTC(), Results: make([]*processor.EncodedResult, len(results))}
+	for i, r := range results {
+		if errors.Is(r.Error, processor.ErrStopped) {
+			return nil, true
+		}
+		report.Results[i] = r.Encode()
+		report.Failed = report.Failed || (r.Error != nil && !report.Results[i].Skipped)
+	}
+	return report, false
+}
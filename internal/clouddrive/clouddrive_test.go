@@ -0,0 +1,152 @@
+package clouddrive_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/clouddrive"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+// memFolder is a Folder held in memory, by name
+type memFolder struct {
+	files     map[string]string
+	modTimes  map[string]time.Time
+	uploadErr error
+}
+
+func newMemFolder(files map[string]string) *memFolder {
+	f := &memFolder{files: files, modTimes: make(map[string]time.Time)}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		f.modTimes[name] = start.Add(time.Duration(i) * time.Minute)
+	}
+	return f
+}
+
+func (f *memFolder) List(context.Context) ([]clouddrive.File, error) {
+	var files []clouddrive.File
+	for name, content := range f.files {
+		files = append(files, clouddrive.File{ID: "id:" + name, Name: name, Size: int64(len(content)), ModTime: f.modTimes[name]})
+	}
+	return files, nil
+}
+
+func (f *memFolder) Download(_ context.Context, file clouddrive.File) ([]byte, error) {
+	content, ok := f.files[file.Name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(content), nil
+}
+
+func (f *memFolder) Upload(_ context.Context, name string, data []byte, _ string) error {
+	if f.uploadErr != nil {
+		return f.uploadErr
+	}
+	f.files[name] = string(data)
+	return nil
+}
+
+func (f *memFolder) report(t *testing.T, name string) clouddrive.Report {
+	t.Helper()
+	data, ok := f.files[name]
+	require.True(t, ok, "no %s", name)
+	var report clouddrive.Report
+	require.NoError(t, json.Unmarshal([]byte(data), &report))
+	return report
+}
+
+func TestConnector_Poll(t *testing.T) {
+	folder := newMemFolder(map[string]string{
+		"a.xml":       invoiceXML,
+		"b.txt":       "not an invoice",
+		"c.xml":       invoiceXML,
+		"c.xml.json":  `{"file":"c.xml"}`,
+		".hidden.xml": invoiceXML,
+	})
+	var reports []*clouddrive.Report
+	c, err := clouddrive.NewConnector(processor.NewPipeline(), folder, clouddrive.Config{
+		OnReport: func(r *clouddrive.Report) { reports = append(reports, r) },
+	})
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "a.xml", reports[0].File, "oldest first")
+
+	ok := folder.report(t, "a.xml.json")
+	assert.False(t, ok.Failed)
+	require.Len(t, ok.Results, 1)
+	assert.Equal(t, "0000042", ok.Results[0].Invoice.Number)
+
+	failed := folder.report(t, "b.txt.json")
+	assert.True(t, failed.Failed)
+	assert.Contains(t, failed.Results[0].Error, "unsupported file format")
+	assert.Equal(t, `{"file":"c.xml"}`, folder.files["c.xml.json"], "files with a result are not processed again")
+
+	n, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestConnector_UploadFails(t *testing.T) {
+	folder := newMemFolder(map[string]string{"a.xml": invoiceXML})
+	folder.uploadErr = errors.New("quota exceeded")
+	c, err := clouddrive.NewConnector(processor.NewPipeline(), folder, clouddrive.Config{})
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	assert.ErrorContains(t, err, "quota exceeded")
+	assert.Zero(t, n)
+
+	folder.uploadErr = nil
+	n, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "processed again on the next poll")
+	assert.Contains(t, folder.files, "a.xml.json")
+}
+
+func TestConnector_MaxFiles(t *testing.T) {
+	folder := newMemFolder(map[string]string{"a.xml": invoiceXML, "b.xml": invoiceXML, "c.xml": invoiceXML})
+	c, err := clouddrive.NewConnector(processor.NewPipeline(), folder, clouddrive.Config{MaxFiles: 2})
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NotContains(t, folder.files, "c.xml.json", "left for the next poll")
+}
+
+func TestConnector_StoppedPipeline(t *testing.T) {
+	folder := newMemFolder(map[string]string{"a.xml": invoiceXML})
+	p := processor.NewPipeline()
+	require.NoError(t, p.Stop(context.Background()))
+	c, err := clouddrive.NewConnector(p, folder, clouddrive.Config{})
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.NotContains(t, folder.files, "a.xml.json")
+}
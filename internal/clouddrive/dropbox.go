@@ -0,0 +1,197 @@
+package clouddrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DropboxConfig configures a Dropbox folder
+type DropboxConfig struct {
+	Path  string // Folder path, such as "/Receipts" ("" or "/" = the root)
+	Token TokenSource
+
+	// Endpoint replaces both the API (https://api.dropboxapi.com) and content
+	// (https://content.dropboxapi.com) hosts, for tests
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// Dropbox is a Folder of Dropbox, using the v2 HTTP API
+type Dropbox struct {
+	path       string
+	token      TokenSource
+	api        string
+	content    string
+	httpClient *http.Client
+}
+
+// NewDropbox returns the folder at cfg.Path
+func NewDropbox(cfg DropboxConfig) (*Dropbox, error) {
+	if cfg.Token == nil {
+		return nil, errors.New("Dropbox token is required")
+	}
+	path := strings.TrimSuffix(cfg.Path, "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	d := &Dropbox{path: path, token: cfg.Token, api: "https://api.dropboxapi.com", content: "https://content.dropboxapi.com", httpClient: cfg.HTTPClient}
+	if cfg.Endpoint != "" {
+		d.api = strings.TrimSuffix(cfg.Endpoint, "/")
+		d.content = d.api
+	}
+	if d.httpClient == nil {
+		d.httpClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+	return d, nil
+}
+
+type dropboxListResult struct {
+	Entries []struct {
+		Tag            string    `json:".tag"`
+		ID             string    `json:"id"`
+		Name           string    `json:"name"`
+		Size           int64     `json:"size"`
+		ServerModified time.Time `json:"server_modified"`
+	} `json:"entries"`
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"has_more"`
+}
+
+// List returns the files of the folder, following the listing's cursor
+func (d *Dropbox) List(ctx context.Context) ([]File, error) {
+	var files []File
+	endpoint, arg := "/2/files/list_folder", any(map[string]any{"path": d.path, "limit": 2000})
+	for {
+		body, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := d.do(ctx, d.api+endpoint, nil, body, "application/json")
+		if err != nil {
+			return nil, err
+		}
+		var page dropboxListResult
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Dropbox list response: %w", err)
+		}
+
+		for _, e := range page.Entries {
+			if e.Tag == "file" {
+				files = append(files, File{ID: e.ID, Name: e.Name, Size: e.Size, ModTime: e.ServerModified})
+			}
+		}
+		if !page.HasMore {
+			return files, nil
+		}
+		endpoint, arg = "/2/files/list_folder/continue", map[string]any{"cursor": page.Cursor}
+	}
+}
+
+// Download reads the content of a file
+func (d *Dropbox) Download(ctx context.Context, file File) ([]byte, error) {
+	resp, err := d.do(ctx, d.content+"/2/files/download", map[string]any{"path": file.ID}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Upload writes a file in the folder, replacing one of that name
+func (d *Dropbox) Upload(ctx context.Context, name string, data []byte, _ string) error {
+	arg := map[string]any{"path": d.path + "/" + name, "mode": "overwrite", "mute": true}
+	resp, err := d.do(ctx, d.content+"/2/files/upload", arg, data, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do posts an authorized request and returns a successful response. The
+// arguments of content endpoints go in the Dropbox-API-Arg header.
+func (d *Dropbox) do(ctx context.Context, u string, arg map[string]any, body []byte, contentType string) (*http.Response, error) {
+	token, err := d.token.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Dropbox token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if arg != nil {
+		header, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Dropbox-API-Arg", asciiJSON(header))
+	}
+
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(u, d.api), d.content)
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Dropbox %s failed: %w", endpoint, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var apiErr struct {
+		ErrorSummary string `json:"error_summary"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, &apiErr) != nil {
+		apiErr.ErrorSummary = strings.TrimSpace(string(data)) // Plain text for bad requests
+	}
+	return nil, fmt.Errorf("Dropbox %s returned %s: %s", endpoint, resp.Status, apiErr.ErrorSummary)
+}
+
+// asciiJSON escapes the non-ASCII characters of JSON, which HTTP headers
+// cannot carry
+func asciiJSON(data []byte) string {
+	var b strings.Builder
+	for _, r := range string(data) {
+		switch {
+		case r < 0x80:
+			b.WriteRune(r)
+		case r > 0xffff:
+			r -= 0x10000
+			fmt.Fprintf(&b, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
+
+// NewDropboxRefreshToken returns a TokenSource exchanging the refresh token
+// of a Dropbox app for short-lived access tokens
+func NewDropboxRefreshToken(appKey, appSecret, refreshToken string, httpClient *http.Client) (TokenSource, error) {
+	if appKey == "" || refreshToken == "" {
+		return nil, errors.New("Dropbox app key and refresh token are required")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &cachedToken{fetch: func(ctx context.Context) (string, time.Duration, error) {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {appKey}}
+		if appSecret != "" {
+			form.Set("client_secret", appSecret)
+		}
+		return fetchToken(ctx, httpClient, "https://api.dropboxapi.com/oauth2/token", form)
+	}}, nil
+}
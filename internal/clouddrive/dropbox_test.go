@@ -0,0 +1,80 @@
+package clouddrive_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/clouddrive"
+)
+
+func TestDropbox(t *testing.T) {
+	uploads := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer dropbox-token", r.Header.Get("Authorization"))
+		var arg map[string]any
+		if header := r.Header.Get("Dropbox-API-Arg"); header != "" {
+			for _, c := range header {
+				require.Less(t, c, rune(0x80), "headers carry ASCII only")
+			}
+			require.NoError(t, json.Unmarshal([]byte(header), &arg))
+		}
+		switch r.URL.Path {
+		case "/2/files/list_folder":
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "/Receipts", body["path"])
+			fmt.Fprint(w, `{"entries":[
+				{".tag":"file","id":"id:a","name":"taxi.jpg","size":4,"server_modified":"2024-03-01T09:00:00Z"},
+				{".tag":"folder","id":"id:f","name":"Archive"}
+			],"cursor":"c1","has_more":true}`)
+		case "/2/files/list_folder/continue":
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "c1", body["cursor"])
+			fmt.Fprint(w, `{"entries":[{".tag":"file","id":"id:b","name":"café.jpg","size":4,"server_modified":"2024-03-01T10:00:00Z"}],"cursor":"c2","has_more":false}`)
+		case "/2/files/download":
+			if arg["path"] != "id:a" {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error_summary":"path/not_found/.."}`)
+				return
+			}
+			fmt.Fprint(w, "\xff\xd8\xff\xe0")
+		case "/2/files/upload":
+			assert.Equal(t, "overwrite", arg["mode"])
+			data, _ := io.ReadAll(r.Body)
+			uploads[arg["path"].(string)] = string(data)
+			fmt.Fprint(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dropbox, err := clouddrive.NewDropbox(clouddrive.DropboxConfig{Path: "Receipts/", Token: clouddrive.StaticToken("dropbox-token"), Endpoint: srv.URL})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	files, err := dropbox.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 2, "folders are skipped")
+	assert.Equal(t, "taxi.jpg", files[0].Name)
+	assert.Equal(t, "café.jpg", files[1].Name)
+
+	data, err := dropbox.Download(ctx, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "\xff\xd8\xff\xe0", string(data))
+
+	_, err = dropbox.Download(ctx, files[1])
+	assert.ErrorContains(t, err, "path/not_found")
+
+	require.NoError(t, dropbox.Upload(ctx, "café.jpg.json", []byte(`{}`), "application/json"))
+	assert.Equal(t, map[string]string{"/Receipts/café.jpg.json": `{}`}, uploads)
+}
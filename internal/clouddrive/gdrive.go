@@ -0,0 +1,292 @@
+package clouddrive
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DriveScope is the OAuth scope of the Drive API requests
+const DriveScope = "https://www.googleapis.com/auth/drive"
+
+// googleAppsType prefixes the MIME types of Drive folders, Docs, Sheets and
+// the other Google types, which have no content to download
+const googleAppsType = "application/vnd.google-apps."
+
+// GoogleDriveConfig configures a GoogleDrive folder
+type GoogleDriveConfig struct {
+	FolderID string // The ID at the end of the folder's URL
+	Token    TokenSource
+
+	Endpoint   string // Default: https://www.googleapis.com
+	HTTPClient *http.Client
+}
+
+// GoogleDrive is a Folder of Google Drive, shared drives included, using the
+// Drive v3 REST API
+type GoogleDrive struct {
+	folder     string
+	token      TokenSource
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewGoogleDrive returns the folder cfg.FolderID
+func NewGoogleDrive(cfg GoogleDriveConfig) (*GoogleDrive, error) {
+	if cfg.FolderID == "" {
+		return nil, errors.New("Drive folder ID is required")
+	}
+	if cfg.Token == nil {
+		return nil, errors.New("Drive token is required")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://www.googleapis.com"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+	return &GoogleDrive{folder: cfg.FolderID, token: cfg.Token, endpoint: strings.TrimSuffix(cfg.Endpoint, "/"), httpClient: cfg.HTTPClient}, nil
+}
+
+type driveFileList struct {
+	Files []struct {
+		ID           string    `json:"id"`
+		Name         string    `json:"name"`
+		MimeType     string    `json:"mimeType"`
+		Size         int64     `json:"size,string"`
+		ModifiedTime time.Time `json:"modifiedTime"`
+	} `json:"files"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// List returns the files of the folder page by page, skipping trashed files
+// and Google types
+func (d *GoogleDrive) List(ctx context.Context) ([]File, error) {
+	var files []File
+	pageToken := ""
+	for {
+		query := url.Values{
+			"q":                         {fmt.Sprintf("'%s' in parents and trashed = false", strings.ReplaceAll(d.folder, "'", `\'`))},
+			"fields":                    {"nextPageToken,files(id,name,mimeType,size,modifiedTime)"},
+			"pageSize":                  {"1000"},
+			"supportsAllDrives":         {"true"},
+			"includeItemsFromAllDrives": {"true"},
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := d.do(ctx, http.MethodGet, "/drive/v3/files?"+query.Encode(), nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var page driveFileList
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Drive list response: %w", err)
+		}
+
+		for _, f := range page.Files {
+			if strings.HasPrefix(f.MimeType, googleAppsType) {
+				continue
+			}
+			files = append(files, File{ID: f.ID, Name: f.Name, Size: f.Size, ModTime: f.ModifiedTime})
+		}
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// Download reads the content of a file
+func (d *GoogleDrive) Download(ctx context.Context, file File) ([]byte, error) {
+	resp, err := d.do(ctx, http.MethodGet, "/drive/v3/files/"+url.PathEscape(file.ID)+"?alt=media&supportsAllDrives=true", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Upload creates a file in the folder. Drive allows several files of one
+// name, so an existing one is kept.
+func (d *GoogleDrive) Upload(ctx context.Context, name string, data []byte, contentType string) error {
+	metadata, err := json.Marshal(map[string]any{"name": name, "parents": []string{d.folder}, "mimeType": contentType})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"application/json; charset=UTF-8", metadata},
+		{contentType, data},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return err
+		}
+		w.Write(part.data)
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	resp, err := d.do(ctx, http.MethodPost, "/upload/drive/v3/files?uploadType=multipart&supportsAllDrives=true&fields=id", body.Bytes(), "multipart/related; boundary="+mw.Boundary())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends an authorized request and returns a successful response
+func (d *GoogleDrive) do(ctx context.Context, method, path string, body []byte, contentType string) (*http.Response, error) {
+	token, err := d.token.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Drive token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Drive %s failed: %w", method, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	return nil, fmt.Errorf("Drive %s %s returned %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, apiErr.Error.Message)
+}
+
+// serviceAccountKey holds the fields of a service account JSON key used
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewServiceAccountToken returns a TokenSource for the service account of a
+// JSON key, as downloaded from the Google Cloud console, using the OAuth JWT
+// bearer flow. The folder must be shared with the account's email address.
+func NewServiceAccountToken(keyJSON []byte, scope string, httpClient *http.Client) (TokenSource, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, errors.New("invalid service account key: client_email and private_key are required")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account key: private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid service account key: private_key is not RSA")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &cachedToken{fetch: func(ctx context.Context) (string, time.Duration, error) {
+		assertion, err := signJWT(rsaKey, map[string]any{
+			"iss":   key.ClientEmail,
+			"scope": scope,
+			"aud":   key.TokenURI,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		return fetchToken(ctx, httpClient, key.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+	}}, nil
+}
+
+// signJWT returns claims as a JWT signed with RS256
+func signJWT(key *rsa.PrivateKey, claims map[string]any) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// fetchToken posts an OAuth token request and returns the access token and
+// its lifetime
+func fetchToken(ctx context.Context, httpClient *http.Client, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil && resp.StatusCode/100 == 2 {
+		return "", 0, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 || out.AccessToken == "" {
+		return "", 0, fmt.Errorf("token request returned %s: %s", resp.Status, strings.TrimSpace(out.Error+" "+out.ErrorDescription))
+	}
+	return out.AccessToken, time.Duration(out.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,161 @@
+package clouddrive_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/clouddrive"
+)
+
+// fakeDrive answers the Drive v3 API for folder "receipts", one file per
+// page
+type fakeDrive struct {
+	t       *testing.T
+	files   []map[string]any
+	content map[string]string
+	uploads []map[string]string // Metadata name and content
+}
+
+func (f *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer drive-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/drive/v3/files":
+		assert.Equal(f.t, "'receipts' in parents and trashed = false", r.URL.Query().Get("q"))
+		page := 0
+		fmt.Sscan(r.URL.Query().Get("pageToken"), &page)
+		out := map[string]any{"files": f.files[page : page+1]}
+		if page+1 < len(f.files) {
+			out["nextPageToken"] = fmt.Sprint(page + 1)
+		}
+		json.NewEncoder(w).Encode(out)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/drive/v3/files/"):
+		assert.Equal(f.t, "media", r.URL.Query().Get("alt"))
+		fmt.Fprint(w, f.content[strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")])
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/drive/v3/files":
+		assert.Equal(f.t, "multipart", r.URL.Query().Get("uploadType"))
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(f.t, err)
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var metadata struct {
+			Name    string   `json:"name"`
+			Parents []string `json:"parents"`
+		}
+		part, err := mr.NextPart()
+		require.NoError(f.t, err)
+		require.NoError(f.t, json.NewDecoder(part).Decode(&metadata))
+		assert.Equal(f.t, []string{"receipts"}, metadata.Parents)
+		part, err = mr.NextPart()
+		require.NoError(f.t, err)
+		data, _ := io.ReadAll(part)
+		f.uploads = append(f.uploads, map[string]string{"name": metadata.Name, "content": string(data)})
+		fmt.Fprint(w, `{"id":"new"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGoogleDrive(t *testing.T) {
+	fake := &fakeDrive{
+		t: t,
+		files: []map[string]any{
+			{"id": "1", "name": "receipt.jpg", "mimeType": "image/jpeg", "size": "4", "modifiedTime": "2024-03-01T09:00:00.000Z"},
+			{"id": "2", "name": "Notes", "mimeType": "application/vnd.google-apps.document", "modifiedTime": "2024-03-01T09:00:00.000Z"},
+		},
+		content: map[string]string{"1": "\xff\xd8\xff\xe0"},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	drive, err := clouddrive.NewGoogleDrive(clouddrive.GoogleDriveConfig{FolderID: "receipts", Token: clouddrive.StaticToken("drive-token"), Endpoint: srv.URL})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	files, err := drive.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "Google Docs are skipped")
+	assert.Equal(t, "receipt.jpg", files[0].Name)
+	assert.EqualValues(t, 4, files[0].Size)
+
+	data, err := drive.Download(ctx, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "\xff\xd8\xff\xe0", string(data))
+
+	require.NoError(t, drive.Upload(ctx, "receipt.jpg.json", []byte(`{"file":"receipt.jpg"}`), "application/json"))
+	require.Len(t, fake.uploads, 1)
+	assert.Equal(t, map[string]string{"name": "receipt.jpg.json", "content": `{"file":"receipt.jpg"}`}, fake.uploads[0])
+
+	denied, err := clouddrive.NewGoogleDrive(clouddrive.GoogleDriveConfig{FolderID: "receipts", Token: clouddrive.StaticToken("expired"), Endpoint: srv.URL})
+	require.NoError(t, err)
+	_, err = denied.List(ctx)
+	assert.ErrorContains(t, err, "Invalid Credentials")
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	requests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		assert.Contains(t, string(claims), `"iss":"reader@project.iam.gserviceaccount.com"`)
+		assert.Contains(t, string(claims), `"scope":"`+clouddrive.DriveScope+`"`)
+
+		fmt.Fprint(w, `{"access_token":"drive-token","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer tokenServer.Close()
+
+	keyJSON, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "reader@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	})
+	require.NoError(t, err)
+	source, err := clouddrive.NewServiceAccountToken(keyJSON, clouddrive.DriveScope, nil)
+	require.NoError(t, err)
+
+	for range 2 {
+		token, err := source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "drive-token", token)
+	}
+	assert.Equal(t, 1, requests, "the token is reused until it expires")
+
+	_, err = clouddrive.NewServiceAccountToken([]byte(`{"client_email":"x","private_key":"not PEM"}`), clouddrive.DriveScope, nil)
+	assert.Error(t, err)
+}
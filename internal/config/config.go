@@ -0,0 +1,515 @@
+// Package config reads the YAML file a deployment is configured with: the
+// LLM provider and models, extraction strategies, validation rules, storage,
+// connectors, tenants, the LLM budget and accounting exports, so the
+// pipeline can be wired without Go code.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Config is a pipeline configuration file. Zero fields keep the defaults.
+type Config struct {
+	LLM        LLM        `yaml:"llm"`
+	Extraction Extraction `yaml:"extraction"`
+	Validation Validation `yaml:"validation"`
+	Store      Store      `yaml:"store"`
+	Webhook    Webhook    `yaml:"webhook"`
+	Events     Events     `yaml:"events"`
+	Connectors Connectors `yaml:"connectors"`
+	Budget     Budget     `yaml:"budget"`
+	Export     Export     `yaml:"export"`
+
+	// Tenants are the client companies sharing the pipeline, by ID
+	Tenants map[string]Tenant `yaml:"tenants"`
+}
+
+// LLM configures the provider and models used for extraction
+type LLM struct {
+	Provider             string            `yaml:"provider"` // openai, openrouter, litellm, anthropic, gemini, azure, bedrock, ollama
+	APIKey               string            `yaml:"api_key"`
+	BaseURL              string            `yaml:"base_url"`
+	Model                string            `yaml:"model"`
+	VisionModel          string            `yaml:"vision_model"`
+	FallbackModels       []string          `yaml:"fallback_models"`
+	VisionFallbackModels []string          `yaml:"vision_fallback_models"`
+	EmbeddingModel       string            `yaml:"embedding_model"`
+	Timeout              time.Duration     `yaml:"timeout"`
+	RequestTimeout       time.Duration     `yaml:"request_timeout"`
+	MaxAttempts          int               `yaml:"max_attempts"`
+	MaxConcurrency       int               `yaml:"max_concurrency"`
+	RequestsPerSecond    float64           `yaml:"requests_per_second"`
+	TokensPerMinute      int               `yaml:"tokens_per_minute"`
+	CircuitBreaker       int               `yaml:"circuit_breaker"` // Consecutive transient failures that stop calls to a model
+	Proxy                string            `yaml:"proxy"`
+	Headers              map[string]string `yaml:"headers"`
+	ExtraBody            map[string]any    `yaml:"extra_body"`
+	PromptCaching        bool              `yaml:"prompt_caching"`
+	Temperature          *float64          `yaml:"temperature"`
+	TopP                 float64           `yaml:"top_p"`
+	MaxTokens            int64             `yaml:"max_tokens"`
+	AuditLog             string            `yaml:"audit_log"` // File a JSON Lines record of every call is appended to
+	AuditBodies          bool              `yaml:"audit_bodies"`
+
+	// Read by the CLI only
+	CacheDir   string `yaml:"cache_dir"`
+	PromptsDir string `yaml:"prompts_dir"`
+	Examples   string `yaml:"examples"`
+}
+
+// Extraction configures how documents are read
+type Extraction struct {
+	Strategies      []string      `yaml:"strategies"`  // embedded_xml, text, vision
+	MergePages      int           `yaml:"merge_pages"` // 0 = default, -1 = only the first group
+	Ensemble        bool          `yaml:"ensemble"`
+	Race            bool          `yaml:"race"`
+	Samples         int           `yaml:"samples"`
+	RecoverFields   bool          `yaml:"recover_fields"`
+	RedactPII       bool          `yaml:"redact_pii"`
+	BoundingBoxes   bool          `yaml:"bounding_boxes"`
+	CheckArithmetic bool          `yaml:"check_arithmetic"`
+	CheckTaxIDs     bool          `yaml:"check_tax_ids"`
+	LLMAddresses    bool          `yaml:"llm_addresses"`
+	MaxTextTokens   int           `yaml:"max_text_tokens"` // 0 = default, -1 = no limit
+	ImageMaxSide    int           `yaml:"image_max_side"`  // 0 = per-model budget, -1 = send images as is
+	RawResponses    bool          `yaml:"raw_responses"`
+	Duplicates      bool          `yaml:"detect_duplicates"`
+	Idempotency     bool          `yaml:"idempotency"` // Answer documents submitted again from memory
+	Vendors         string        `yaml:"vendors"`     // JSON file of vendors to match sellers against
+	Preclassify     bool          `yaml:"preclassify"`
+	ClassifierModel string        `yaml:"classifier_model"` // Small model for documents the keywords can't tell (default: keywords only)
+	Deadline        time.Duration `yaml:"deadline"`         // Per document, e.g. 60s (0 = none)
+
+	Spreadsheet Spreadsheet       `yaml:"spreadsheet"`
+	Units       map[string]string `yaml:"units"` // Units of measure to UN/ECE codes, added to the defaults ("" unmaps a unit)
+}
+
+// Spreadsheet configures how the columns of XLSX and CSV invoices are read
+type Spreadsheet struct {
+	Columns   map[string][]string `yaml:"columns"`    // Header names by field (invoice_number, item_name, amount...), replacing the defaults
+	Sheet     string              `yaml:"sheet"`      // Sheet holding the line items (default: the first with a header row)
+	HeaderRow int                 `yaml:"header_row"` // Row of the header, from 1 (default: detected)
+}
+
+// Validation configures the checks run after extraction
+type Validation struct {
+	Enabled         *bool    `yaml:"enabled"`          // nil = on
+	Rules           []string `yaml:"rules"`            // Names of the rules to run (default: all)
+	ReviewThreshold float64  `yaml:"review_threshold"` // Below this confidence, results need review
+}
+
+// Store configures where results are persisted
+type Store struct {
+	Type   string `yaml:"type"`   // memory, sqlite or postgres
+	Driver string `yaml:"driver"` // database/sql driver registered by the program (default: the type)
+	DSN    string `yaml:"dsn"`
+}
+
+// Store types
+const (
+	StoreMemory   = "memory"
+	StoreSQLite   = "sqlite"
+	StorePostgres = "postgres"
+)
+
+// Webhook configures where processed documents are posted
+type Webhook struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// Events configures the event stream of processed invoices (see package
+// outbox)
+type Events struct {
+	File string `yaml:"file"` // JSON lines log the events are appended to
+}
+
+// Budget caps the estimated LLM spend, in USD (see processor.Budget)
+type Budget struct {
+	Daily                float64          `yaml:"daily"`
+	PerTenant            float64          `yaml:"per_tenant"`
+	PerBatch             float64          `yaml:"per_batch"`
+	DowngradeModel       string           `yaml:"downgrade_model"` // Used once a cap is reached; none = stop LLM calls
+	DowngradeVisionModel string           `yaml:"downgrade_vision_model"`
+	Prices               map[string]Price `yaml:"prices"` // By model
+}
+
+// Price is what a model costs, in USD per million tokens
+type Price struct {
+	Prompt       float64 `yaml:"prompt"`
+	Completion   float64 `yaml:"completion"`
+	CachedPrompt float64 `yaml:"cached_prompt"`
+}
+
+// Export configures the export command
+type Export struct {
+	Accounting map[string]Accounting `yaml:"accounting"` // By system: quickbooks, xero, misa
+}
+
+// Accounting overrides the defaults of an accounting system (see
+// export.Accounting)
+type Accounting struct {
+	TaxCodes       map[string]string `yaml:"tax_codes"` // By VAT rate: "10%", "8%", "0%", "KCT", "KKKNT"
+	Account        string            `yaml:"account"`
+	PayableAccount string            `yaml:"payable_account"`
+	TaxAccount     string            `yaml:"tax_account"`
+	DateFormat     string            `yaml:"date_format"` // Go layout, e.g. "02/01/2006"
+}
+
+// Tenant overrides the extraction settings for the documents of one client
+// company (see processor.WithTenants). Zero fields keep the shared settings.
+type Tenant struct {
+	Model           string   `yaml:"model"`
+	VisionModel     string   `yaml:"vision_model"`
+	PromptsDir      string   `yaml:"prompts_dir"` // Prompt files; missing ones keep the defaults
+	Strategies      []string `yaml:"strategies"`
+	ValidationRules []string `yaml:"validation_rules"`
+}
+
+// Connectors configure the document sources of the CLI commands
+type Connectors struct {
+	Watch Watch `yaml:"watch"`
+	Queue Queue `yaml:"queue"`
+	IMAP  IMAP  `yaml:"imap"`
+	SFTP  SFTP  `yaml:"sftp"`
+	Drive Drive `yaml:"drive"`
+}
+
+// Watch configures the watch command
+type Watch struct {
+	Dirs          []string      `yaml:"dirs"`
+	OutputDir     string        `yaml:"output_dir"`
+	QuarantineDir string        `yaml:"quarantine_dir"`
+	ProcessedDir  string        `yaml:"processed_dir"`
+	Interval      time.Duration `yaml:"interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+	Split         bool          `yaml:"split"`
+}
+
+// Queue configures the consume command
+type Queue struct {
+	Broker       string        `yaml:"broker"` // sqs, nats or kafka
+	Input        string        `yaml:"input"`
+	Output       string        `yaml:"output"`
+	DeadLetter   string        `yaml:"dead_letter"`
+	NATSURL      string        `yaml:"nats_url"`
+	Durable      string        `yaml:"durable"`
+	KafkaBrokers []string      `yaml:"kafka_brokers"`
+	Group        string        `yaml:"group"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	MaxSize      int64         `yaml:"max_size"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+// IMAP configures the imap command
+type IMAP struct {
+	Addr     string        `yaml:"addr"`
+	User     string        `yaml:"user"`
+	Password string        `yaml:"password"`
+	Mailbox  string        `yaml:"mailbox"`
+	Flag     string        `yaml:"flag"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Insecure bool          `yaml:"insecure"`
+}
+
+// SFTP configures the sftp command
+type SFTP struct {
+	Addr          string        `yaml:"addr"`
+	User          string        `yaml:"user"`
+	Password      string        `yaml:"password"`
+	KeyFile       string        `yaml:"key_file"`
+	KeyPassphrase string        `yaml:"key_passphrase"`
+	KnownHosts    string        `yaml:"known_hosts"`
+	HostKey       string        `yaml:"host_key"`
+	Dir           string        `yaml:"dir"`
+	Patterns      []string      `yaml:"patterns"`
+	ProcessedDir  string        `yaml:"processed_dir"`
+	FailedDir     string        `yaml:"failed_dir"`
+	MinAge        time.Duration `yaml:"min_age"`
+	Interval      time.Duration `yaml:"interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+	Split         bool          `yaml:"split"`
+}
+
+// Drive configures the drive command. Credentials come from the
+// environment.
+type Drive struct {
+	Folders  []string      `yaml:"folders"` // gdrive://<folder-id> or dropbox:///<path>
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Split    bool          `yaml:"split"`
+}
+
+// Load reads the configuration file at path (see Parse)
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse reads a configuration from YAML. Values may refer to environment
+// variables as ${NAME}, or ${NAME:-default} for a variable that may be unset
+// or empty; keys that are not part of the configuration are errors.
+func Parse(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if doc.Kind == 0 {
+		return &Config{}, nil // Empty file
+	}
+	interpolate(&doc)
+
+	// Decoding the interpolated document again rejects unknown keys
+	interpolated, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(interpolated))
+	dec.KnownFields(true)
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the values that can be checked without building anything
+func (c *Config) Validate() error {
+	switch c.Store.Type {
+	case "", StoreMemory:
+	case StoreSQLite, StorePostgres:
+		if c.Store.DSN == "" {
+			return fmt.Errorf("invalid config: store.dsn is required for %s", c.Store.Type)
+		}
+	default:
+		return fmt.Errorf("invalid config: unknown store type %q (expected memory, sqlite or postgres)", c.Store.Type)
+	}
+	if c.Validation.ReviewThreshold < 0 || c.Validation.ReviewThreshold > 1 {
+		return fmt.Errorf("invalid config: validation.review_threshold must be between 0 and 1")
+	}
+	if _, err := c.Strategies(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if _, err := c.ValidationRules(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if _, err := c.SpreadsheetMapping(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	for name := range c.Export.Accounting {
+		if _, err := c.Accounting(name); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	if b := c.Budget; b.Daily < 0 || b.PerTenant < 0 || b.PerBatch < 0 {
+		return fmt.Errorf("invalid config: budget caps must not be negative")
+	} else if (b.Daily > 0 || b.PerTenant > 0 || b.PerBatch > 0) && len(b.Prices) == 0 {
+		return fmt.Errorf("invalid config: budget.prices is required to enforce a budget")
+	}
+	for id, t := range c.Tenants {
+		if len(t.Strategies) > 0 {
+			if _, err := processor.ParseStrategies(strings.Join(t.Strategies, ",")); err != nil {
+				return fmt.Errorf("invalid config: tenant %s: %w", id, err)
+			}
+		}
+		if _, err := validationRules(t.ValidationRules); err != nil {
+			return fmt.Errorf("invalid config: tenant %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Strategies returns extraction.strategies (nil = the pipeline's default)
+func (c *Config) Strategies() ([]processor.Strategy, error) {
+	if len(c.Extraction.Strategies) == 0 {
+		return nil, nil
+	}
+	return processor.ParseStrategies(strings.Join(c.Extraction.Strategies, ","))
+}
+
+// ValidationRules returns the rules of model.TT78Rules named in
+// validation.rules, in that order (nil = the defaults)
+func (c *Config) ValidationRules() ([]processor.ValidationRule, error) {
+	return validationRules(c.Validation.Rules)
+}
+
+// validationRules returns the rules of model.TT78Rules named, in that order
+func validationRules(names []string) ([]processor.ValidationRule, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := model.TT78Rules()
+	rules := make([]processor.ValidationRule, 0, len(names))
+	for _, name := range names {
+		rule, ok := known.Rule(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown validation rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ProcessorTenants returns the tenants for processor.WithTenants, reading
+// their prompt directories
+func (c *Config) ProcessorTenants() (map[string]processor.Tenant, error) {
+	if len(c.Tenants) == 0 {
+		return nil, nil
+	}
+	tenants := make(map[string]processor.Tenant, len(c.Tenants))
+	for id, t := range c.Tenants {
+		tenant := processor.Tenant{Models: llm.Models{Text: t.Model, Vision: t.VisionModel}}
+		var err error
+		if t.PromptsDir != "" {
+			if tenant.Prompts, err = llm.LoadPromptSetDir(t.PromptsDir); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", id, err)
+			}
+		}
+		if len(t.Strategies) > 0 {
+			if tenant.Strategies, err = processor.ParseStrategies(strings.Join(t.Strategies, ",")); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", id, err)
+			}
+		}
+		if tenant.ValidationRules, err = validationRules(t.ValidationRules); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", id, err)
+		}
+		tenants[id] = tenant
+	}
+	return tenants, nil
+}
+
+// BudgetController returns the controller of the budget section, or nil
+// when it sets no cap
+func (c *Config) BudgetController() *processor.BudgetController {
+	b := c.Budget
+	if b.Daily == 0 && b.PerTenant == 0 && b.PerBatch == 0 {
+		return nil
+	}
+	prices := make(map[string]llm.ModelPrice, len(b.Prices))
+	for model, p := range b.Prices {
+		prices[model] = llm.ModelPrice{Prompt: p.Prompt, Completion: p.Completion, CachedPrompt: p.CachedPrompt}
+	}
+	return processor.NewBudgetController(processor.Budget{
+		Prices:    prices,
+		Daily:     b.Daily,
+		PerTenant: b.PerTenant,
+		PerBatch:  b.PerBatch,
+		Downgrade: llm.Models{Text: b.DowngradeModel, Vision: b.DowngradeVisionModel},
+	})
+}
+
+// SpreadsheetMapping returns extraction.spreadsheet for
+// processor.WithSpreadsheetMapping (nil = the defaults)
+func (c *Config) SpreadsheetMapping() (*processor.SpreadsheetMapping, error) {
+	s := c.Extraction.Spreadsheet
+	if len(s.Columns) == 0 && s.Sheet == "" && s.HeaderRow == 0 {
+		return nil, nil
+	}
+	if s.HeaderRow < 0 {
+		return nil, fmt.Errorf("extraction.spreadsheet.header_row must not be negative")
+	}
+	defaults := processor.DefaultSpreadsheetColumns()
+	mapping := &processor.SpreadsheetMapping{Sheet: s.Sheet, HeaderRow: s.HeaderRow}
+	for name, columns := range s.Columns {
+		field := processor.SpreadsheetField(name)
+		if _, ok := defaults[field]; !ok {
+			return nil, fmt.Errorf("unknown spreadsheet field %q", name)
+		}
+		if mapping.Columns == nil {
+			mapping.Columns = make(map[processor.SpreadsheetField][]string, len(s.Columns))
+		}
+		mapping.Columns[field] = columns
+	}
+	return mapping, nil
+}
+
+// Accounting returns the export settings of an accounting system:
+// export.accounting.<system> over the defaults of the system
+func (c *Config) Accounting(system string) (export.Accounting, error) {
+	s, err := export.ParseAccountingSystem(system)
+	if err != nil {
+		return export.Accounting{}, err
+	}
+	a := c.Export.Accounting[string(s)]
+	var codes export.TaxCodes
+	for rate, code := range a.TaxCodes {
+		parsed, err := model.ParseVATRate(rate)
+		if err != nil {
+			return export.Accounting{}, fmt.Errorf("export.accounting.%s.tax_codes: %w", s, err)
+		}
+		if codes == nil {
+			codes = make(export.TaxCodes, len(a.TaxCodes))
+		}
+		codes[parsed.String()] = code
+	}
+	return export.Accounting{
+		System:         s,
+		TaxCodes:       codes,
+		Account:        a.Account,
+		PayableAccount: a.PayableAccount,
+		TaxAccount:     a.TaxAccount,
+		DateFormat:     a.DateFormat,
+	}, nil
+}
+
+// ValidationEnabled reports whether validation runs after extraction
+func (c *Config) ValidationEnabled() bool {
+	return c.Validation.Enabled == nil || *c.Validation.Enabled
+}
+
+// variable matches ${NAME} and ${NAME:-default}
+var variable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate replaces the environment variables in the scalars of node.
+// Unquoted values are typed by what they are replaced with, so ${WORKERS} can
+// fill a number; quoted ones stay strings.
+func interpolate(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode {
+		for _, child := range node.Content {
+			interpolate(child)
+		}
+		return
+	}
+	if !variable.MatchString(node.Value) {
+		return
+	}
+	node.Value = expand(node.Value)
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+}
+
+func expand(s string) string {
+	return variable.ReplaceAllStringFunc(s, func(ref string) string {
+		m := variable.FindStringSubmatch(ref)
+		if value := os.Getenv(m[1]); value != "" {
+			return value
+		}
+		return m[2]
+	})
+}
@@ -0,0 +1,230 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/config"
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const deployment = `
+llm:
+  provider: anthropic
+  api_key: ${TEST_LLM_KEY}
+  model: ${TEST_LLM_MODEL:-claude-sonnet}
+  fallback_models: [claude-haiku]
+  timeout: 90s
+  max_concurrency: ${TEST_LLM_CONCURRENCY}
+  headers:
+    X-Team: "${TEST_TEAM}"
+extraction:
+  strategies: [embedded_xml, vision]
+  merge_pages: 10
+validation:
+  rules: [totals, tax_id, series_format]
+  review_threshold: 0.8
+store:
+  type: postgres
+  driver: pgx
+  dsn: postgres://invoices@db/${TEST_DB:-invoices}
+connectors:
+  watch:
+    dirs: [inbox]
+    quarantine_dir: failed
+    interval: 5s
+  sftp:
+    addr: sftp.supplier.com:22
+    patterns: ["*.pdf", "*.xml"]
+`
+
+func TestParse(t *testing.T) {
+	t.Setenv("TEST_LLM_KEY", "sk-secret")
+	t.Setenv("TEST_LLM_CONCURRENCY", "4")
+	t.Setenv("TEST_TEAM", "42")
+
+	cfg, err := config.Parse([]byte(deployment))
+	require.NoError(t, err)
+
+	assert.Equal(t, "anthropic", cfg.LLM.Provider)
+	assert.Equal(t, "sk-secret", cfg.LLM.APIKey)
+	assert.Equal(t, "claude-sonnet", cfg.LLM.Model, "default of an unset variable")
+	assert.Equal(t, []string{"claude-haiku"}, cfg.LLM.FallbackModels)
+	assert.Equal(t, 90*time.Second, cfg.LLM.Timeout)
+	assert.Equal(t, 4, cfg.LLM.MaxConcurrency, "variables fill numbers")
+	assert.Equal(t, map[string]string{"X-Team": "42"}, cfg.LLM.Headers, "quoted variables stay strings")
+	assert.Equal(t, "postgres://invoices@db/invoices", cfg.Store.DSN)
+	assert.Equal(t, []string{"inbox"}, cfg.Connectors.Watch.Dirs)
+	assert.Equal(t, 5*time.Second, cfg.Connectors.Watch.Interval)
+	assert.Equal(t, []string{"*.pdf", "*.xml"}, cfg.Connectors.SFTP.Patterns)
+	assert.True(t, cfg.ValidationEnabled())
+
+	strategies, err := cfg.Strategies()
+	require.NoError(t, err)
+	assert.Equal(t, []processor.Strategy{processor.StrategyEmbeddedXML, processor.StrategyVision}, strategies)
+
+	rules, err := cfg.ValidationRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, processor.RuleTotals, rules[0].Name)
+	assert.Equal(t, processor.RuleTaxID, rules[1].Name)
+	assert.Equal(t, model.RuleSeriesFormat, rules[2].Name, "rules of the TT78 set may be named")
+}
+
+func TestParse_Defaults(t *testing.T) {
+	cfg, err := config.Parse(nil)
+	require.NoError(t, err)
+	assert.True(t, cfg.ValidationEnabled())
+
+	strategies, err := cfg.Strategies()
+	require.NoError(t, err)
+	assert.Nil(t, strategies)
+	rules, err := cfg.ValidationRules()
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	cfg, err = config.Parse([]byte("validation:\n  enabled: false\n"))
+	require.NoError(t, err)
+	assert.False(t, cfg.ValidationEnabled())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown key", "llm:\n  modle: gpt-4o\n", "field modle not found"},
+		{"unknown strategy", "extraction:\n  strategies: [ocr]\n", `unknown extraction strategy "ocr"`},
+		{"unknown rule", "validation:\n  rules: [spelling]\n", `unknown validation rule "spelling"`},
+		{"store without DSN", "store:\n  type: sqlite\n", "store.dsn is required"},
+		{"unknown store", "store:\n  type: mongo\n", `unknown store type "mongo"`},
+		{"threshold", "validation:\n  review_threshold: 70\n", "review_threshold"},
+		{"tenant rule", "tenants:\n  acme:\n    validation_rules: [spelling]\n", `tenant acme: unknown validation rule "spelling"`},
+		{"budget without prices", "budget:\n  daily: 50\n", "budget.prices is required"},
+		{"negative budget", "budget:\n  per_batch: -1\n", "must not be negative"},
+		{"spreadsheet field", "extraction:\n  spreadsheet:\n    columns:\n      price: [Rate]\n", `unknown spreadsheet field "price"`},
+		{"accounting system", "export:\n  accounting:\n    sage: {account: \"6000\"}\n", `unknown accounting system "sage"`},
+		{"tax code rate", "export:\n  accounting:\n    xero:\n      tax_codes: {ten: VAT}\n", "export.accounting.xero.tax_codes"},
+		{"not YAML", "llm: [", "invalid config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse([]byte(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestProcessorTenants(t *testing.T) {
+	prompts := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(prompts, "system_invoice.txt"), []byte("You read Acme's invoices."), 0o600))
+
+	cfg, err := config.Parse([]byte(`
+tenants:
+  acme:
+    model: gpt-4o
+    prompts_dir: ` + prompts + `
+    strategies: [vision]
+    validation_rules: [totals]
+  globex: {}
+`))
+	require.NoError(t, err)
+
+	tenants, err := cfg.ProcessorTenants()
+	require.NoError(t, err)
+	require.Len(t, tenants, 2)
+	acme := tenants["acme"]
+	assert.Equal(t, "gpt-4o", acme.Models.Text)
+	assert.Equal(t, "You read Acme's invoices.", acme.Prompts.SystemInvoice)
+	assert.Equal(t, []processor.Strategy{processor.StrategyVision}, acme.Strategies)
+	require.Len(t, acme.ValidationRules, 1)
+	assert.Equal(t, processor.RuleTotals, acme.ValidationRules[0].Name)
+	assert.Nil(t, tenants["globex"].ValidationRules, "the shared rules apply")
+
+	cfg.Tenants["acme"] = config.Tenant{PromptsDir: filepath.Join(prompts, "missing")}
+	_, err = cfg.ProcessorTenants()
+	assert.ErrorContains(t, err, "tenant acme")
+}
+
+func TestBudgetController(t *testing.T) {
+	cfg, err := config.Parse([]byte("budget:\n  prices:\n    gpt-4o: {prompt: 2.5, completion: 10}\n"))
+	require.NoError(t, err)
+	assert.Nil(t, cfg.BudgetController(), "no cap, no budget")
+
+	cfg.Budget.PerTenant = 10
+	c := cfg.BudgetController()
+	require.NotNil(t, c)
+	assert.Zero(t, c.Spent("acme"))
+}
+
+func TestSpreadsheetMapping(t *testing.T) {
+	cfg, err := config.Parse([]byte("llm:\n  model: gpt-4o\n"))
+	require.NoError(t, err)
+	mapping, err := cfg.SpreadsheetMapping()
+	require.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	cfg, err = config.Parse([]byte(`
+extraction:
+  spreadsheet:
+    sheet: Lines
+    header_row: 3
+    columns:
+      item_name: [Line]
+      amount: [Charge, Fee]
+`))
+	require.NoError(t, err)
+	mapping, err = cfg.SpreadsheetMapping()
+	require.NoError(t, err)
+	assert.Equal(t, &processor.SpreadsheetMapping{
+		Sheet:     "Lines",
+		HeaderRow: 3,
+		Columns: map[processor.SpreadsheetField][]string{
+			processor.SheetItemName: {"Line"},
+			processor.SheetAmount:   {"Charge", "Fee"},
+		},
+	}, mapping)
+}
+
+func TestAccounting(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+export:
+  accounting:
+    xero:
+      account: "310"
+      tax_codes: {"10": Input 10%, kct: Exempt}
+`))
+	require.NoError(t, err)
+	accounting, err := cfg.Accounting("Xero")
+	require.NoError(t, err)
+	assert.Equal(t, export.Accounting{
+		System:   export.Xero,
+		Account:  "310",
+		TaxCodes: export.TaxCodes{"10%": "Input 10%", "KCT": "Exempt"},
+	}, accounting, "rates as VATRate writes them")
+
+	accounting, err = cfg.Accounting("misa")
+	require.NoError(t, err)
+	assert.Equal(t, export.Accounting{System: export.MISA}, accounting)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice-processor.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("llm:\n  model: gpt-4o\n"), 0o600))
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", cfg.LLM.Model)
+
+	_, err = config.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
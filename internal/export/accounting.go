@@ -0,0 +1,354 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// AccountingSystem is an accounting system invoices are imported into as
+// bills
+type AccountingSystem string
+
+const (
+	QuickBooks AccountingSystem = "quickbooks" // QuickBooks Online bill import, or IIF for QuickBooks Desktop
+	Xero       AccountingSystem = "xero"       // Xero bill import
+	MISA       AccountingSystem = "misa"       // MISA AMIS purchase voucher template (chứng từ mua hàng)
+)
+
+// ParseAccountingSystem reads the name of an accounting system
+func ParseAccountingSystem(s string) (AccountingSystem, error) {
+	system := AccountingSystem(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := accountingDefaults[system]; !ok {
+		return "", fmt.Errorf("unknown accounting system %q (quickbooks, xero, misa)", s)
+	}
+	return system, nil
+}
+
+// TaxCodes maps VAT rates, written as VATRate.String writes them ("10%",
+// "0%", "KCT", "KKKNT"), to the tax codes of an accounting system
+type TaxCodes map[string]string
+
+// Code returns the tax code of rate, or the rate as written when it has
+// none
+func (c TaxCodes) Code(rate model.VATRate) string {
+	if code, ok := c[rate.String()]; ok {
+		return code
+	}
+	return rate.String()
+}
+
+// Accounting lays invoices out as the import files of an accounting
+// system. Zero fields take the defaults of the system.
+type Accounting struct {
+	System   AccountingSystem
+	TaxCodes TaxCodes // Added to the defaults of the system
+
+	Account        string // Account the lines are booked to (purchases)
+	PayableAccount string // Accounts payable (MISA and IIF)
+	TaxAccount     string // Deductible input VAT (MISA and IIF)
+	DateFormat     string // Go layout of dates, e.g. "02/01/2006"
+}
+
+// accountingDefaults are the settings an accounting system starts with: the
+// tax codes and accounts of its default chart for Vietnam
+var accountingDefaults = map[AccountingSystem]Accounting{
+	QuickBooks: {
+		TaxCodes: TaxCodes{
+			"10%": "VAT 10%", "8%": "VAT 8%", "5%": "VAT 5%", "0%": "VAT 0%",
+			"KCT": "Exempt", "KKKNT": "Out of Scope",
+		},
+		Account:        "Purchases",
+		PayableAccount: "Accounts Payable",
+		TaxAccount:     "VAT Receivable",
+		DateFormat:     "01/02/2006",
+	},
+	Xero: {
+		TaxCodes: TaxCodes{
+			"10%": "VAT 10%", "8%": "VAT 8%", "5%": "VAT 5%", "0%": "Zero Rated Expenses",
+			"KCT": "Exempt Expenses", "KKKNT": "No VAT",
+		},
+		Account:    "300",
+		DateFormat: "02/01/2006",
+	},
+	MISA: {
+		TaxCodes:       TaxCodes{},
+		Account:        "1561",
+		PayableAccount: "331",
+		TaxAccount:     "1331",
+		DateFormat:     "02/01/2006",
+	},
+}
+
+// DefaultAccounting returns the settings of system: its tax codes, the
+// accounts of its default chart (for MISA, those of Circular 200) and the
+// date format its import expects
+func DefaultAccounting(system AccountingSystem) (Accounting, error) {
+	defaults, ok := accountingDefaults[system]
+	if !ok {
+		return Accounting{}, fmt.Errorf("unknown accounting system %q (quickbooks, xero, misa)", system)
+	}
+	defaults.System = system
+	defaults.TaxCodes = make(TaxCodes, len(accountingDefaults[system].TaxCodes))
+	for rate, code := range accountingDefaults[system].TaxCodes {
+		defaults.TaxCodes[rate] = code
+	}
+	return defaults, nil
+}
+
+// withDefaults returns a with the defaults of its system filled in
+func (a Accounting) withDefaults() (Accounting, error) {
+	d, err := DefaultAccounting(a.System)
+	if err != nil {
+		return Accounting{}, err
+	}
+	for rate, code := range a.TaxCodes {
+		d.TaxCodes[rate] = code
+	}
+	if a.Account != "" {
+		d.Account = a.Account
+	}
+	if a.PayableAccount != "" {
+		d.PayableAccount = a.PayableAccount
+	}
+	if a.TaxAccount != "" {
+		d.TaxAccount = a.TaxAccount
+	}
+	if a.DateFormat != "" {
+		d.DateFormat = a.DateFormat
+	}
+	return d, nil
+}
+
+// Table returns the import table of the invoices, one row per line item.
+// Amounts count as Invoice.Signed gives them: credit notes are bills of
+// negative quantities and amounts, which the systems import as supplier
+// credits.
+func (a Accounting) Table(invoices []*model.Invoice) (Sheet, error) {
+	a, err := a.withDefaults()
+	if err != nil {
+		return Sheet{}, err
+	}
+	var columns []Column
+	switch a.System {
+	case QuickBooks:
+		columns = a.quickBooksColumns()
+	case Xero:
+		columns = a.xeroColumns()
+	case MISA:
+		columns = a.misaColumns()
+	}
+
+	headers, getters, err := compileColumns(columns, true)
+	if err != nil {
+		return Sheet{}, err
+	}
+	sheet := Sheet{Name: string(a.System), Header: headers, Formats: columnFormats(columns)}
+	for _, inv := range invoices {
+		for i := range inv.Items {
+			sheet.Rows = append(sheet.Rows, row(getters, inv, &inv.Items[i]))
+		}
+	}
+	return sheet, nil
+}
+
+// WriteCSV writes the import table of the invoices as CSV
+func (a Accounting) WriteCSV(w io.Writer, invoices []*model.Invoice) error {
+	sheet, err := a.Table(invoices)
+	if err != nil {
+		return err
+	}
+	return WriteCSV(w, sheet)
+}
+
+// WriteXLSX writes the import table of the invoices as a workbook, as MISA
+// imports its templates
+func (a Accounting) WriteXLSX(w io.Writer, invoices []*model.Invoice) error {
+	sheet, err := a.Table(invoices)
+	if err != nil {
+		return err
+	}
+	return WriteXLSX(w, sheet)
+}
+
+func (a Accounting) date(inv *model.Invoice, _ *model.LineItem) any {
+	if inv.Date.IsZero() {
+		return nil
+	}
+	return inv.Date.Format(a.DateFormat)
+}
+
+func (a Accounting) taxCode(_ *model.Invoice, item *model.LineItem) any {
+	return a.TaxCodes.Code(item.VATRate)
+}
+
+func documentNumber(inv *model.Invoice, _ *model.LineItem) any {
+	return documentID(inv.Series, inv.Number)
+}
+
+func sellerName(inv *model.Invoice, _ *model.LineItem) any {
+	return inv.Seller.Name
+}
+
+// lineNet is the amount of a line after its discount
+func lineNet(inv *model.Invoice, item *model.LineItem) any {
+	return inv.Signed(item.Amount.Sub(item.DiscountAmt))
+}
+
+func lineQuantity(inv *model.Invoice, item *model.LineItem) any {
+	return inv.Signed(item.Quantity)
+}
+
+func lineVAT(inv *model.Invoice, item *model.LineItem) any {
+	return inv.Signed(item.VATAmount)
+}
+
+func lineName(_ *model.Invoice, item *model.LineItem) any {
+	if item.Description != "" {
+		return item.Name + " - " + item.Description
+	}
+	return item.Name
+}
+
+func constant(value string) func(*model.Invoice, *model.LineItem) any {
+	return func(*model.Invoice, *model.LineItem) any { return value }
+}
+
+// quickBooksColumns are the columns of the QuickBooks Online bill import
+func (a Accounting) quickBooksColumns() []Column {
+	return []Column{
+		{Header: "Bill No", Value: documentNumber},
+		{Header: "Supplier", Value: sellerName},
+		{Header: "Bill Date", Value: a.date},
+		{Header: "Due Date", Value: a.date},
+		{Header: "Memo", Field: "remarks"},
+		{Header: "Account", Value: constant(a.Account)},
+		{Header: "Line Description", Value: lineName},
+		{Header: "Line Amount", Value: lineNet, Format: amountFormat},
+		{Header: "Line Tax Code", Value: a.taxCode},
+		{Header: "Line Tax Amount", Value: lineVAT, Format: amountFormat},
+		{Header: "Currency", Field: "currency"},
+	}
+}
+
+// xeroColumns are the columns of the Xero bill import template; the
+// starred ones are required
+func (a Accounting) xeroColumns() []Column {
+	return []Column{
+		{Header: "*ContactName", Value: sellerName},
+		{Header: "EmailAddress", Field: "seller.email"},
+		{Header: "POAddressLine1", Field: "seller.address"},
+		{Header: "*InvoiceNumber", Value: documentNumber},
+		{Header: "*InvoiceDate", Value: a.date},
+		{Header: "*DueDate", Value: a.date},
+		{Header: "InventoryItemCode", Field: "items.code"},
+		{Header: "*Description", Value: lineName},
+		{Header: "*Quantity", Value: lineQuantity},
+		{Header: "*UnitAmount", Field: "items.unit_price", Format: amountFormat},
+		{Header: "Discount", Field: "items.discount"},
+		{Header: "*AccountCode", Value: constant(a.Account)},
+		{Header: "*TaxType", Value: a.taxCode},
+		{Header: "TaxAmount", Value: lineVAT, Format: amountFormat},
+		{Header: "Currency", Field: "currency"},
+	}
+}
+
+// misaColumns are the columns of the MISA AMIS purchase voucher template;
+// suppliers are identified by their tax ID, as MISA codes them by default
+func (a Accounting) misaColumns() []Column {
+	return []Column{
+		{Header: "Ngày hạch toán", Value: a.date},
+		{Header: "Ngày chứng từ", Value: a.date},
+		{Header: "Số chứng từ", Value: documentNumber},
+		{Header: "Mã nhà cung cấp", Field: "seller.tax_id"},
+		{Header: "Tên nhà cung cấp", Value: sellerName},
+		{Header: "Mã số thuế", Field: "seller.tax_id"},
+		{Header: "Diễn giải", Field: "remarks"},
+		{Header: "Ký hiệu HĐ", Field: "series"},
+		{Header: "Số hóa đơn", Field: "number"},
+		{Header: "Ngày hóa đơn", Value: a.date},
+		{Header: "Mã hàng", Field: "items.code"},
+		{Header: "Tên hàng", Value: lineName},
+		{Header: "TK kho/TK chi phí", Value: constant(a.Account)},
+		{Header: "TK công nợ", Value: constant(a.PayableAccount)},
+		{Header: "ĐVT", Field: "items.unit"},
+		{Header: "Số lượng", Value: lineQuantity},
+		{Header: "Đơn giá", Field: "items.unit_price", Format: amountFormat},
+		{Header: "Thành tiền", Value: func(inv *model.Invoice, item *model.LineItem) any { return inv.Signed(item.Amount) }, Format: amountFormat},
+		{Header: "Tỷ lệ CK (%)", Field: "items.discount"},
+		{Header: "Tiền chiết khấu", Value: func(inv *model.Invoice, item *model.LineItem) any { return inv.Signed(item.DiscountAmt) }, Format: amountFormat},
+		{Header: "% thuế GTGT", Value: a.taxCode},
+		{Header: "Tiền thuế GTGT", Value: lineVAT, Format: amountFormat},
+		{Header: "TK thuế GTGT", Value: constant(a.TaxAccount)},
+	}
+}
+
+// WriteIIF writes the invoices as QuickBooks Desktop IIF bills: a BILL
+// transaction crediting the payable account with the total, split into a
+// line debiting the account of each line item and one debiting the tax
+// account with the VAT of each rate. What the splits leave of the total,
+// all of it for invoices without line items, is debited to the account on
+// a line of its own, so every bill balances. Credit notes reverse the
+// signs.
+func (a Accounting) WriteIIF(w io.Writer, invoices []*model.Invoice) error {
+	if a.System == "" {
+		a.System = QuickBooks
+	}
+	a, err := a.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("!TRNS\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\tQNTY\tPRICE\n")
+	b.WriteString("!ENDTRNS\n")
+	for _, inv := range invoices {
+		date := inv.Date.Format(a.DateFormat)
+		number := documentID(inv.Series, inv.Number)
+		name := iifField(inv.Seller.Name)
+		fmt.Fprintf(&b, "TRNS\tBILL\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			date, iifField(a.PayableAccount), name, inv.Signed(inv.TotalAmount).Neg(), number, iifField(inv.Remarks))
+		remainder := inv.TotalAmount
+		for _, item := range inv.Items {
+			net := item.Amount.Sub(item.DiscountAmt)
+			remainder = remainder.Sub(net)
+			fmt.Fprintf(&b, "SPL\tBILL\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				date, iifField(a.Account), name, inv.Signed(net), number,
+				iifField(item.Name), inv.Signed(item.Quantity), item.UnitPrice)
+		}
+		breakdown := inv.TaxBreakdown
+		if breakdown == nil {
+			breakdown = model.SummarizeVAT(inv.Items)
+		}
+		for _, line := range breakdown {
+			if line.TaxAmount.IsZero() {
+				continue
+			}
+			remainder = remainder.Sub(line.TaxAmount)
+			fmt.Fprintf(&b, "SPL\tBILL\t%s\t%s\t%s\t%s\t%s\t%s\t\t\n",
+				date, iifField(a.TaxAccount), name, inv.Signed(line.TaxAmount), number, iifField(a.TaxCodes.Code(line.Rate)))
+		}
+		if len(breakdown) == 0 && !inv.TaxAmount.IsZero() { // VAT of no known rate
+			remainder = remainder.Sub(inv.TaxAmount)
+			fmt.Fprintf(&b, "SPL\tBILL\t%s\t%s\t%s\t%s\t%s\t\t\t\n",
+				date, iifField(a.TaxAccount), name, inv.Signed(inv.TaxAmount), number)
+		}
+		if !remainder.IsZero() {
+			fmt.Fprintf(&b, "SPL\tBILL\t%s\t%s\t%s\t%s\t%s\tNot itemized\t\t\n",
+				date, iifField(a.Account), name, inv.Signed(remainder), number)
+		}
+		b.WriteString("ENDTRNS\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write IIF: %w", err)
+	}
+	return nil
+}
+
+// iifField keeps the tabs and line breaks of s from splitting IIF fields
+func iifField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,126 @@
+package export_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// column returns the values of the named column of sheet
+func column(t *testing.T, sheet export.Sheet, header string) []any {
+	t.Helper()
+	for i, h := range sheet.Header {
+		if h == header {
+			values := make([]any, len(sheet.Rows))
+			for j, r := range sheet.Rows {
+				values[j] = r[i]
+			}
+			return values
+		}
+	}
+	require.Failf(t, "no column", "%q", header)
+	return nil
+}
+
+func TestAccounting_Table(t *testing.T) {
+	invoices := testInvoices()[:1]
+	invoices[0].Items[1].VATRate = model.VATRateKCT
+	invoices[0].CalculateTotals()
+
+	xero, err := export.Accounting{System: export.Xero, TaxCodes: export.TaxCodes{"10%": "Input 10%"}}.Table(invoices)
+	require.NoError(t, err)
+	assert.Equal(t, "*ContactName", xero.Header[0])
+	require.Len(t, xero.Rows, 2)
+	assert.Equal(t, []any{"C24TAA-0000042", "C24TAA-0000042"}, column(t, xero, "*InvoiceNumber"))
+	assert.Equal(t, []any{"01/05/2024", "01/05/2024"}, column(t, xero, "*InvoiceDate"))
+	assert.Equal(t, []any{"Input 10%", "Exempt Expenses"}, column(t, xero, "*TaxType"), "configured codes over the defaults")
+	assert.Equal(t, []any{"300", "300"}, column(t, xero, "*AccountCode"))
+
+	qb, err := export.Accounting{System: export.QuickBooks, Account: "Office Supplies"}.Table(invoices)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"05/01/2024", "05/01/2024"}, column(t, qb, "Bill Date"))
+	assert.Equal(t, []any{"Office Supplies", "Office Supplies"}, column(t, qb, "Account"))
+	assert.Equal(t, []any{"VAT 10%", "Exempt"}, column(t, qb, "Line Tax Code"))
+
+	misa, err := export.Accounting{System: export.MISA}.Table(invoices)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"0123456789", "0123456789"}, column(t, misa, "Mã nhà cung cấp"))
+	assert.Equal(t, []any{"10%", "KCT"}, column(t, misa, "% thuế GTGT"), "MISA takes the rates as written")
+	assert.Equal(t, []any{"1331", "1331"}, column(t, misa, "TK thuế GTGT"))
+
+	_, err = export.Accounting{System: "sage"}.Table(invoices)
+	assert.ErrorContains(t, err, `unknown accounting system "sage"`)
+}
+
+func TestAccounting_CreditNote(t *testing.T) {
+	invoices := testInvoices()[:1]
+	invoices[0].DocumentType = model.DocumentTypeCreditNote
+	invoices[0].CalculateTotals()
+
+	sheet, err := export.Accounting{System: export.Xero}.Table(invoices)
+	require.NoError(t, err)
+	quantities := column(t, sheet, "*Quantity")
+	assert.True(t, decimal.NewFromInt(-10).Equal(quantities[0].(decimal.Decimal)), "credit notes are negative bills")
+	assert.True(t, decimal.NewFromInt(50000).Equal(column(t, sheet, "*UnitAmount")[0].(decimal.Decimal)))
+}
+
+func TestAccounting_WriteIIF(t *testing.T) {
+	invoices := testInvoices()[:1]
+	invoices[0].Remarks = "Văn phòng\tphẩm"
+	invoices[0].CalculateTotals()
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Accounting{}.WriteIIF(&buf, invoices))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, "!ENDTRNS", lines[2])
+	assert.Equal(t, "TRNS\tBILL\t05/01/2024\tAccounts Payable\tCông ty TNHH A, B & C\t-561000\tC24TAA-0000042\tVăn phòng phẩm", lines[3])
+	assert.Equal(t, "SPL\tBILL\t05/01/2024\tPurchases\tCông ty TNHH A, B & C\t500000\tC24TAA-0000042\tGiấy A4\t10\t50000", lines[4])
+	assert.Equal(t, "SPL\tBILL\t05/01/2024\tVAT Receivable\tCông ty TNHH A, B & C\t51000\tC24TAA-0000042\tVAT 10%\t\t", lines[6])
+	assert.Equal(t, "ENDTRNS", lines[7])
+}
+
+func TestAccounting_WriteIIF_Unitemized(t *testing.T) {
+	receipt := &model.Invoice{
+		Number:         "R-17",
+		Date:           time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Seller:         model.Party{Name: "Cửa hàng D"},
+		SubtotalAmount: decimal.NewFromInt(100000),
+		TaxAmount:      decimal.NewFromInt(10000),
+		TotalAmount:    decimal.NewFromInt(110000),
+	}
+	invoice := testInvoices()[0]
+	invoice.CalculateTotals()
+	invoice.TotalAmount = invoice.TotalAmount.Add(decimal.NewFromInt(30000)) // A shipping fee not itemized
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Accounting{}.WriteIIF(&buf, []*model.Invoice{receipt, invoice}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 13)
+	assert.Equal(t, []string{
+		"TRNS\tBILL\t05/01/2024\tAccounts Payable\tCửa hàng D\t-110000\tR-17\t",
+		"SPL\tBILL\t05/01/2024\tVAT Receivable\tCửa hàng D\t10000\tR-17\t\t\t",
+		"SPL\tBILL\t05/01/2024\tPurchases\tCửa hàng D\t100000\tR-17\tNot itemized\t\t",
+		"ENDTRNS",
+	}, lines[3:7], "receipts without line items balance")
+	assert.Equal(t, "SPL\tBILL\t05/01/2024\tPurchases\tCông ty TNHH A, B & C\t30000\tC24TAA-0000042\tNot itemized\t\t", lines[11])
+
+	// Every bill balances
+	sum := decimal.Zero
+	for _, line := range lines[3:] {
+		fields := strings.Split(line, "\t")
+		if fields[0] == "ENDTRNS" {
+			assert.True(t, sum.IsZero(), "unbalanced bill: %s", sum)
+			continue
+		}
+		sum = sum.Add(decimal.RequireFromString(fields[5]))
+	}
+}
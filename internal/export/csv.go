@@ -0,0 +1,82 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// WriteCSV writes a sheet as CSV, its header first. Dates are written as
+// YYYY-MM-DD, or RFC 3339 when they have a time of day. Text that a
+// spreadsheet would run as a formula is prefixed with ', as its text came
+// from documents anyone can send.
+func WriteCSV(w io.Writer, sheet Sheet) error {
+	cw := csv.NewWriter(w)
+	if len(sheet.Header) > 0 {
+		if err := cw.Write(sheet.Header); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	record := make([]string, 0, len(sheet.Header))
+	for _, values := range sheet.Rows {
+		record = record[:0]
+		for _, v := range values {
+			text := cellText(v)
+			if _, ok := v.(string); ok {
+				text = escapeFormula(text)
+			}
+			record = append(record, text)
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// escapeFormula keeps spreadsheets from running text starting with =, +, -,
+// @, a tab or a carriage return as a formula
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// cellText returns a cell value as text
+func cellText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case decimal.Decimal:
+		return v.String()
+	case time.Time:
+		switch {
+		case v.IsZero():
+			return ""
+		case v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0:
+			return v.Format("2006-01-02")
+		default:
+			return v.Format(time.RFC3339)
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+}
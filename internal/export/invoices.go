@@ -0,0 +1,292 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// Column maps an invoice field to a table column
+type Column struct {
+	// Field is the JSON path of the value in the invoice, such as
+	// "seller.tax_id". In the lines table, "items." paths are fields of the
+	// line item, e.g. "items.quantity".
+	Field  string `json:"field,omitempty"`
+	Header string `json:"header,omitempty"` // Default: Field
+	Format string `json:"format,omitempty"` // Excel number format, e.g. "#,##0" (XLSX only)
+
+	// Value computes the cell instead of Field; item is nil in the
+	// invoices table
+	Value func(inv *model.Invoice, item *model.LineItem) any `json:"-"`
+}
+
+// Mapping lays invoices out as two tables: one row per invoice, and one
+// row per line item repeating the invoice columns needed to join them
+type Mapping struct {
+	Invoices []Column `json:"invoices"`
+	Lines    []Column `json:"lines,omitempty"` // No lines table when empty
+}
+
+// Amount format of the default mapping, in whole units
+const amountFormat = "#,##0"
+
+// DefaultMapping returns the invoice header and line item columns most
+// accounting imports need
+func DefaultMapping() Mapping {
+	return Mapping{
+		Invoices: []Column{
+			{Field: "number", Header: "Number"},
+			{Field: "series", Header: "Series"},
+			{Field: "date", Header: "Date"},
+			{Field: "document_type", Header: "Type"},
+			{Field: "seller.name", Header: "Seller Name"},
+			{Field: "seller.tax_id", Header: "Seller Tax ID"},
+			{Field: "buyer.name", Header: "Buyer Name"},
+			{Field: "buyer.tax_id", Header: "Buyer Tax ID"},
+			{Field: "subtotal_amount", Header: "Subtotal", Format: amountFormat},
+			{Field: "tax_amount", Header: "VAT", Format: amountFormat},
+			{Field: "total_amount", Header: "Total", Format: amountFormat},
+			{Field: "currency", Header: "Currency"},
+			{Field: "source_file", Header: "Source File"},
+		},
+		Lines: []Column{
+			{Field: "number", Header: "Invoice Number"},
+			{Field: "series", Header: "Series"},
+			{Field: "seller.tax_id", Header: "Seller Tax ID"},
+			{Field: "items.number", Header: "Line"},
+			{Field: "items.code", Header: "Code"},
+			{Field: "items.name", Header: "Name"},
+			{Field: "items.unit", Header: "Unit"},
+			{Field: "items.quantity", Header: "Quantity"},
+			{Field: "items.unit_price", Header: "Unit Price", Format: amountFormat},
+			{Field: "items.vat_rate", Header: "VAT Rate"},
+			{Field: "items.amount", Header: "Amount", Format: amountFormat},
+			{Field: "items.vat_amount", Header: "VAT", Format: amountFormat},
+			{Field: "items.total", Header: "Total", Format: amountFormat},
+		},
+	}
+}
+
+// getter reads a column value from an invoice and one of its items
+type getter func(inv *model.Invoice, item *model.LineItem) any
+
+// Tables returns the invoices table ("Invoices") and, when the mapping has
+// line columns, the lines table ("Lines"). It fails on unknown fields.
+func (m Mapping) Tables(invoices []*model.Invoice) ([]Sheet, error) {
+	if len(m.Invoices) == 0 {
+		return nil, fmt.Errorf("mapping has no invoice columns")
+	}
+	headers, invoiceGetters, err := compileColumns(m.Invoices, false)
+	if err != nil {
+		return nil, err
+	}
+	sheets := []Sheet{{Name: "Invoices", Header: headers, Formats: columnFormats(m.Invoices)}}
+	for _, inv := range invoices {
+		sheets[0].Rows = append(sheets[0].Rows, row(invoiceGetters, inv, nil))
+	}
+
+	if len(m.Lines) == 0 {
+		return sheets, nil
+	}
+	headers, lineGetters, err := compileColumns(m.Lines, true)
+	if err != nil {
+		return nil, err
+	}
+	lines := Sheet{Name: "Lines", Header: headers, Formats: columnFormats(m.Lines)}
+	for _, inv := range invoices {
+		for i := range inv.Items {
+			lines.Rows = append(lines.Rows, row(lineGetters, inv, &inv.Items[i]))
+		}
+	}
+	return append(sheets, lines), nil
+}
+
+// WriteInvoicesCSV writes the invoices table to w and the lines table, if
+// the mapping has one, to lines (nil = not written)
+func WriteInvoicesCSV(w, lines io.Writer, invoices []*model.Invoice, m Mapping) error {
+	sheets, err := m.Tables(invoices)
+	if err != nil {
+		return err
+	}
+	if err := WriteCSV(w, sheets[0]); err != nil {
+		return err
+	}
+	if lines != nil && len(sheets) > 1 {
+		return WriteCSV(lines, sheets[1])
+	}
+	return nil
+}
+
+// WriteInvoicesXLSX writes a workbook with the invoices and lines tables as
+// sheets
+func WriteInvoicesXLSX(w io.Writer, invoices []*model.Invoice, m Mapping) error {
+	sheets, err := m.Tables(invoices)
+	if err != nil {
+		return err
+	}
+	return WriteXLSX(w, sheets...)
+}
+
+// WriteJSONL writes each invoice in full as a line of JSON
+func WriteJSONL(w io.Writer, invoices []*model.Invoice) error {
+	enc := json.NewEncoder(w)
+	for _, inv := range invoices {
+		if err := enc.Encode(inv); err != nil {
+			return fmt.Errorf("failed to write JSON Lines: %w", err)
+		}
+	}
+	return nil
+}
+
+func row(getters []getter, inv *model.Invoice, item *model.LineItem) []any {
+	values := make([]any, len(getters))
+	for i, get := range getters {
+		values[i] = get(inv, item)
+	}
+	return values
+}
+
+func columnFormats(columns []Column) []string {
+	formats := make([]string, len(columns))
+	for i, c := range columns {
+		formats[i] = c.Format
+	}
+	return formats
+}
+
+func compileColumns(columns []Column, lines bool) ([]string, []getter, error) {
+	headers := make([]string, len(columns))
+	getters := make([]getter, len(columns))
+	for i, c := range columns {
+		headers[i] = c.Header
+		if headers[i] == "" {
+			headers[i] = c.Field
+		}
+		if c.Value != nil {
+			getters[i] = c.Value
+			continue
+		}
+		get, err := compileField(c.Field, lines)
+		if err != nil {
+			return nil, nil, err
+		}
+		getters[i] = get
+	}
+	return headers, getters, nil
+}
+
+var (
+	invoiceType  = reflect.TypeOf(model.Invoice{})
+	lineItemType = reflect.TypeOf(model.LineItem{})
+)
+
+// compileField resolves a JSON path to the struct fields it names
+func compileField(field string, lines bool) (getter, error) {
+	if field == "" {
+		return nil, fmt.Errorf("column has neither a field nor a value")
+	}
+	path := strings.Split(field, ".")
+	root, fromItem := invoiceType, false
+	if path[0] == "items" && len(path) > 1 {
+		if !lines {
+			return nil, fmt.Errorf("field %q is only available in the lines table", field)
+		}
+		root, fromItem, path = lineItemType, true, path[1:]
+	}
+
+	var indexes []int
+	t := root
+	for _, name := range path {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf(decimal.Decimal{}) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		index, ok := fieldByJSONName(t, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		indexes = append(indexes, index)
+		t = t.Field(index).Type
+	}
+
+	return func(inv *model.Invoice, item *model.LineItem) any {
+		v := reflect.ValueOf(inv)
+		if fromItem {
+			v = reflect.ValueOf(item)
+		}
+		for _, index := range indexes {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem().Field(index)
+			if v.Kind() != reflect.Pointer {
+				v = v.Addr()
+			}
+		}
+		if v.IsNil() {
+			return nil
+		}
+		return cellValue(v.Elem())
+	}, nil
+}
+
+// fieldByJSONName returns the index of the struct field encoded as name
+func fieldByJSONName(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == name && tag != "-" {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// cellValue converts a field to a cell: numbers, dates and text stay
+// typed, VAT rates are percentages or their category, lists of text are
+// joined and other values written as JSON
+func cellValue(v reflect.Value) any {
+	switch x := v.Interface().(type) {
+	case decimal.Decimal:
+		return x
+	case model.VATRate:
+		if !x.IsTaxable() {
+			return string(x.Category)
+		}
+		return x.Percent
+	case time.Time:
+		if x.IsZero() {
+			return nil
+		}
+		return x
+	case []string:
+		return strings.Join(x, "; ")
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,154 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func testInvoices() []*model.Invoice {
+	return []*model.Invoice{
+		{
+			Number: "0000042",
+			Series: "C24TAA",
+			Date:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			Seller: model.Party{Name: "Công ty TNHH A, B & C", TaxID: "0123456789"},
+			Buyer:  model.Party{Name: "Buyer", TaxID: "0312345678"},
+			Items: []model.LineItem{
+				{Number: 1, Name: "Giấy A4", Unit: "ream", Quantity: decimal.NewFromInt(10), UnitPrice: decimal.NewFromInt(50000), VATRate: model.VATRate10},
+				{Number: 2, Name: "Bút bi", Unit: "piece", Quantity: decimal.RequireFromString("2.5"), UnitPrice: decimal.NewFromInt(4000), VATRate: model.VATRate10},
+			},
+			Currency:     "VND",
+			DocumentType: model.DocumentTypeInvoice,
+			Corrections:  []string{"a", "b"},
+		},
+		{Number: "0000043", Seller: model.Party{TaxID: "0123456789"}},
+	}
+}
+
+func TestMapping_Tables(t *testing.T) {
+	invoices := testInvoices()
+	invoices[0].CalculateTotals()
+
+	sheets, err := export.DefaultMapping().Tables(invoices)
+	require.NoError(t, err)
+	require.Len(t, sheets, 2)
+
+	header := sheets[0]
+	assert.Equal(t, "Invoices", header.Name)
+	require.Len(t, header.Rows, 2)
+	assert.Equal(t, "0000042", header.Rows[0][0])
+	assert.Equal(t, invoices[0].Date, header.Rows[0][2])
+	assert.Equal(t, "0123456789", header.Rows[0][5])
+	assert.True(t, decimal.NewFromInt(561000).Equal(header.Rows[0][10].(decimal.Decimal)))
+	assert.Nil(t, header.Rows[1][2], "zero date")
+	assert.Equal(t, "#,##0", header.Formats[10])
+
+	lines := sheets[1]
+	assert.Equal(t, "Lines", lines.Name)
+	require.Len(t, lines.Rows, 2)
+	assert.Equal(t, []any{"0000042", "C24TAA", "0123456789", int64(2)}, lines.Rows[1][:4])
+	assert.Equal(t, "Bút bi", lines.Rows[1][5])
+	assert.True(t, decimal.NewFromInt(10).Equal(lines.Rows[1][9].(decimal.Decimal)))
+}
+
+func TestMapping_CustomColumns(t *testing.T) {
+	mapping := export.Mapping{
+		Invoices: []export.Column{
+			{Field: "seller.tax_id", Header: "MST"},
+			{Field: "corrections"},
+			{Field: "original_invoice.number"},
+			{Header: "Lines", Value: func(inv *model.Invoice, _ *model.LineItem) any { return len(inv.Items) }},
+		},
+	}
+	sheets, err := mapping.Tables(testInvoices())
+	require.NoError(t, err)
+	require.Len(t, sheets, 1)
+	assert.Equal(t, []string{"MST", "corrections", "original_invoice.number", "Lines"}, sheets[0].Header)
+	assert.Equal(t, []any{"0123456789", "a; b", nil, 2}, sheets[0].Rows[0])
+
+	for _, columns := range [][]export.Column{
+		{{Field: "seller.nonexistent"}},
+		{{Field: "total_amount.value"}},
+		{{Field: "items.name"}}, // Line fields only in the lines table
+		{{Header: "Empty"}},
+	} {
+		_, err := export.Mapping{Invoices: columns}.Tables(testInvoices())
+		assert.Error(t, err, columns[0].Field)
+	}
+}
+
+func TestMapping_JSON(t *testing.T) {
+	var mapping export.Mapping
+	require.NoError(t, json.Unmarshal([]byte(`{"invoices":[{"field":"number","header":"Số HĐ"}],"lines":[{"field":"items.name"}]}`), &mapping))
+	sheets, err := mapping.Tables(testInvoices())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Số HĐ"}, sheets[0].Header)
+	assert.Equal(t, "Giấy A4", sheets[1].Rows[0][0])
+}
+
+func TestWriteInvoicesCSV(t *testing.T) {
+	var header, lines bytes.Buffer
+	require.NoError(t, export.WriteInvoicesCSV(&header, &lines, testInvoices(), export.DefaultMapping()))
+
+	rows := strings.Split(strings.TrimSpace(header.String()), "\n")
+	require.Len(t, rows, 3)
+	assert.True(t, strings.HasPrefix(rows[0], "Number,Series,Date,Type,Seller Name"))
+	assert.Contains(t, rows[1], `0000042,C24TAA,2024-05-01,invoice,"Công ty TNHH A, B & C",0123456789`)
+
+	rows = strings.Split(strings.TrimSpace(lines.String()), "\n")
+	require.Len(t, rows, 3)
+	assert.Contains(t, rows[2], "0000042,C24TAA,0123456789,2,,Bút bi,piece,2.5,4000,10")
+}
+
+func TestWriteInvoicesCSV_Formulas(t *testing.T) {
+	invoices := testInvoices()[:1]
+	invoices[0].Seller.Name = `=HYPERLINK("http://example.com","x")`
+	invoices[0].Items[0].Name = "@SUM(A1)"
+	invoices[0].Items[1].Name = "-2+3"
+	invoices[0].Items[1].Quantity = decimal.NewFromInt(-2)
+
+	var header, lines bytes.Buffer
+	require.NoError(t, export.WriteInvoicesCSV(&header, &lines, invoices, export.DefaultMapping()))
+	assert.Contains(t, header.String(), `"'=HYPERLINK(""http://example.com"",""x"")"`)
+	assert.Contains(t, lines.String(), ",'@SUM(A1),")
+	assert.Contains(t, lines.String(), ",'-2+3,piece,-2,", "numbers keep their sign")
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Accounting{System: export.Xero}.WriteCSV(&buf, invoices))
+	assert.Contains(t, buf.String(), `"'=HYPERLINK(""http://example.com"",""x"")"`)
+}
+
+func TestWriteInvoicesXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteInvoicesXLSX(&buf, testInvoices(), export.DefaultMapping()))
+
+	parts := readParts(t, buf.Bytes())
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="Lines" sheetId="2" r:id="rId2"/>`)
+	assert.Contains(t, parts["xl/styles.xml"], `formatCode="#,##0"`)
+	// 2024-05-01 is day 45413, in the date style
+	assert.Contains(t, parts["xl/worksheets/sheet1.xml"], `<c r="C2" s="2"><v>45413</v></c>`)
+	assert.Contains(t, parts["xl/worksheets/sheet1.xml"], `<cols>`)
+	assert.Contains(t, parts["xl/worksheets/sheet2.xml"], `<c r="I2" s="3"><v>50000</v></c>`)
+}
+
+func TestWriteJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteJSONL(&buf, testInvoices()))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var inv model.Invoice
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &inv))
+	assert.Equal(t, "0000042", inv.Number)
+	assert.Len(t, inv.Items, 2)
+}
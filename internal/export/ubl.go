@@ -0,0 +1,472 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// UBL 2.1 namespaces
+const (
+	ublInvoiceNS    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNS = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCACNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// UNCL 1001 document type codes
+const (
+	ublCommercialInvoice = "380"
+	ublCreditNote        = "381"
+	ublCorrectedInvoice  = "384"
+)
+
+// ublDocument is a UBL Invoice or CreditNote, in the element order of the
+// UBL 2.1 schemas. Elements carry their namespace prefix in their names,
+// declared on the root.
+type ublDocument struct {
+	XMLName xml.Name
+	XMLNS   string `xml:"xmlns,attr"`
+	CAC     string `xml:"xmlns:cac,attr"`
+	CBC     string `xml:"xmlns:cbc,attr"`
+
+	UBLVersionID         string               `xml:"cbc:UBLVersionID"`
+	ID                   string               `xml:"cbc:ID"`
+	IssueDate            string               `xml:"cbc:IssueDate"`
+	InvoiceTypeCode      string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode   string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note                 string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string               `xml:"cbc:DocumentCurrencyCode"`
+	TaxCurrencyCode      string               `xml:"cbc:TaxCurrencyCode,omitempty"`
+	DiscrepancyResponse  *ublResponse         `xml:"cac:DiscrepancyResponse"`
+	BillingReference     *ublBillingReference `xml:"cac:BillingReference"`
+	Supplier             ublPartyWrapper      `xml:"cac:AccountingSupplierParty"`
+	Customer             ublPartyWrapper      `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans         *ublPaymentMeans     `xml:"cac:PaymentMeans"`
+	PaymentTerms         *ublNote             `xml:"cac:PaymentTerms"`
+	TaxExchangeRate      *ublExchangeRate     `xml:"cac:TaxExchangeRate"`
+	TaxTotals            []ublTaxTotal        `xml:"cac:TaxTotal"`
+	MonetaryTotal        ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines         []ublLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLines      []ublLine            `xml:"cac:CreditNoteLine"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ublResponse struct {
+	ReferenceID string `xml:"cbc:ReferenceID"`
+	Description string `xml:"cbc:Description,omitempty"`
+}
+
+type ublBillingReference struct {
+	ID        string `xml:"cac:InvoiceDocumentReference>cbc:ID"`
+	IssueDate string `xml:"cac:InvoiceDocumentReference>cbc:IssueDate,omitempty"`
+}
+
+type ublPartyWrapper struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	Name        string          `xml:"cac:PartyName>cbc:Name,omitempty"`
+	Address     *ublAddress     `xml:"cac:PostalAddress"`
+	TaxScheme   *ublPartyTax    `xml:"cac:PartyTaxScheme"`
+	LegalEntity *ublLegalEntity `xml:"cac:PartyLegalEntity"`
+	Contact     *ublContact     `xml:"cac:Contact"`
+}
+
+type ublAddress struct {
+	StreetName          string `xml:"cbc:StreetName,omitempty"`
+	CitySubdivisionName string `xml:"cbc:CitySubdivisionName,omitempty"`
+	CityName            string `xml:"cbc:CityName,omitempty"`
+	District            string `xml:"cbc:District,omitempty"`
+	Line                string `xml:"cac:AddressLine>cbc:Line,omitempty"`
+	Country             string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+type ublPartyTax struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+	CompanyID        string `xml:"cbc:CompanyID,omitempty"`
+}
+
+type ublContact struct {
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublPaymentMeans struct {
+	Code    string      `xml:"cbc:PaymentMeansCode"`
+	Account *ublAccount `xml:"cac:PayeeFinancialAccount"`
+}
+
+type ublAccount struct {
+	ID       string `xml:"cbc:ID"`
+	BankName string `xml:"cac:FinancialInstitutionBranch>cbc:Name,omitempty"`
+}
+
+type ublNote struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type ublIdentifier struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublExchangeRate struct {
+	SourceCurrencyCode string `xml:"cbc:SourceCurrencyCode"`
+	TargetCurrencyCode string `xml:"cbc:TargetCurrencyCode"`
+	CalculationRate    string `xml:"cbc:CalculationRate"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	Category      ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID              string `xml:"cbc:ID"`
+	Percent         string `xml:"cbc:Percent,omitempty"`
+	ExemptionReason string `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme       string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       ublAmount `xml:"cbc:PayableAmount"`
+}
+
+type ublLine struct {
+	ID                  string              `xml:"cbc:ID"`
+	InvoicedQuantity    *ublQuantity        `xml:"cbc:InvoicedQuantity"`
+	CreditedQuantity    *ublQuantity        `xml:"cbc:CreditedQuantity"`
+	LineExtensionAmount ublAmount           `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharge     *ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	Item                ublItem             `xml:"cac:Item"`
+	Price               ublAmount           `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+type ublAllowanceCharge struct {
+	ChargeIndicator bool      `xml:"cbc:ChargeIndicator"`
+	Reason          string    `xml:"cbc:AllowanceChargeReason"`
+	Multiplier      string    `xml:"cbc:MultiplierFactorNumeric,omitempty"`
+	Amount          ublAmount `xml:"cbc:Amount"`
+	BaseAmount      ublAmount `xml:"cbc:BaseAmount"`
+}
+
+type ublItem struct {
+	Description string         `xml:"cbc:Description,omitempty"`
+	Name        string         `xml:"cbc:Name"`
+	SellersID   *ublIdentifier `xml:"cac:SellersItemIdentification"`
+	TaxCategory ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+// MarshalUBL writes inv as a UBL 2.1 document, for AP systems that take
+// only UBL: a CreditNote for credit notes, an Invoice otherwise, typed a
+// corrected invoice for adjustments and replacements. The ID is the series
+// and number ("1C24TAA-42"), the tax IDs are the parties' company IDs in
+// the VAT scheme, and rates outside VAT (KCT, KKKNT) are category O with
+// the reason. Foreign currency invoices carry their exchange rate and
+// their VAT in VND. Invoices without line items, such as receipts, get a
+// single line of their subtotal, as UBL requires one; those whose VAT is
+// of several rates fail, as do those without a date, the issue date being
+// required.
+func MarshalUBL(inv *model.Invoice) ([]byte, error) {
+	if inv.Date.IsZero() {
+		return nil, fmt.Errorf("invoice %s has no date, which UBL requires", documentID(inv.Series, inv.Number))
+	}
+	breakdown := inv.TaxBreakdown
+	if breakdown == nil {
+		breakdown = model.SummarizeVAT(inv.Items)
+	}
+	items := inv.Items
+	if len(items) == 0 {
+		summary, err := summaryLine(inv, breakdown)
+		if err != nil {
+			return nil, err
+		}
+		items = []model.LineItem{summary}
+		if len(breakdown) == 0 {
+			breakdown = model.SummarizeVAT(items)
+		}
+	}
+	currency := inv.Currency
+	if currency == "" {
+		currency = model.CurrencyVND
+	}
+	amount := func(d decimal.Decimal) ublAmount {
+		return ublAmount{Currency: currency, Value: d.String()}
+	}
+
+	doc := &ublDocument{
+		XMLNS:                ublInvoiceNS,
+		CAC:                  ublCACNS,
+		CBC:                  ublCBCNS,
+		UBLVersionID:         "2.1",
+		ID:                   documentID(inv.Series, inv.Number),
+		IssueDate:            ublDate(inv.Date),
+		Note:                 inv.Remarks,
+		DocumentCurrencyCode: currency,
+		Supplier:             ublPartyWrapper{ublPartyOf(inv.Seller)},
+		Customer:             ublPartyWrapper{ublPartyOf(inv.Buyer)},
+		PaymentMeans:         ublPaymentMeansOf(inv),
+		MonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: amount(inv.SubtotalAmount),
+			TaxExclusiveAmount:  amount(inv.SubtotalAmount),
+			TaxInclusiveAmount:  amount(inv.TotalAmount),
+			PayableAmount:       amount(inv.TotalAmount),
+		},
+	}
+	if inv.PaymentTerms != "" {
+		doc.PaymentTerms = &ublNote{Note: inv.PaymentTerms}
+	}
+	if ref := inv.OriginalInvoice; ref != nil && ref.Number != "" {
+		doc.BillingReference = &ublBillingReference{ID: documentID(ref.Series, ref.Number), IssueDate: ublDate(ref.Date)}
+	}
+
+	taxTotal := ublTaxTotal{TaxAmount: amount(inv.TaxAmount)}
+	for _, line := range breakdown {
+		taxTotal.Subtotals = append(taxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: amount(line.TaxableAmount),
+			TaxAmount:     amount(line.TaxAmount),
+			Category:      ublTaxCategoryOf(line.Rate),
+		})
+	}
+	doc.TaxTotals = []ublTaxTotal{taxTotal}
+	if inv.IsForeignCurrency() && inv.ExchangeRate.IsPositive() {
+		tax := model.ConvertToVND(inv.TaxAmount, inv.ExchangeRate)
+		if inv.VNDAmounts != nil && !inv.VNDAmounts.TaxAmount.IsZero() {
+			tax = inv.VNDAmounts.TaxAmount
+		}
+		doc.TaxCurrencyCode = model.CurrencyVND
+		doc.TaxExchangeRate = &ublExchangeRate{SourceCurrencyCode: currency, TargetCurrencyCode: model.CurrencyVND, CalculationRate: inv.ExchangeRate.String()}
+		doc.TaxTotals = append(doc.TaxTotals, ublTaxTotal{TaxAmount: ublAmount{Currency: model.CurrencyVND, Value: tax.String()}})
+	}
+
+	var lines []ublLine
+	for i, item := range items {
+		number := item.Number
+		if number == 0 {
+			number = i + 1
+		}
+		line := ublLine{
+			ID:                  fmt.Sprint(number),
+			LineExtensionAmount: amount(item.Amount.Sub(item.DiscountAmt)),
+			Item: ublItem{
+				Description: item.Description,
+				Name:        item.Name,
+				TaxCategory: ublTaxCategoryOf(item.VATRate),
+			},
+			Price: amount(item.UnitPrice),
+		}
+		if item.Code != "" {
+			line.Item.SellersID = &ublIdentifier{ID: item.Code}
+		}
+		quantity := &ublQuantity{UnitCode: item.UnitCode, Value: item.Quantity.String()}
+		if inv.IsCreditNote() {
+			line.CreditedQuantity = quantity
+		} else {
+			line.InvoicedQuantity = quantity
+		}
+		if !item.DiscountAmt.IsZero() {
+			line.AllowanceCharge = &ublAllowanceCharge{
+				Reason:     "Chiết khấu",
+				Amount:     amount(item.DiscountAmt),
+				BaseAmount: amount(item.Amount),
+			}
+			if !item.Discount.IsZero() {
+				line.AllowanceCharge.Multiplier = item.Discount.Div(decimal.NewFromInt(100)).String()
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if inv.IsCreditNote() {
+		doc.XMLName = xml.Name{Local: "CreditNote"}
+		doc.XMLNS = ublCreditNoteNS
+		doc.CreditNoteTypeCode = ublCreditNote
+		doc.CreditNoteLines = lines
+		if ref := inv.OriginalInvoice; ref != nil && ref.Number != "" {
+			doc.DiscrepancyResponse = &ublResponse{ReferenceID: documentID(ref.Series, ref.Number), Description: inv.AdjustmentReason}
+		}
+	} else {
+		doc.XMLName = xml.Name{Local: "Invoice"}
+		doc.InvoiceTypeCode = ublCommercialInvoice
+		if inv.Type == model.InvoiceTypeAdjustment || inv.Type == model.InvoiceTypeReplacement {
+			doc.InvoiceTypeCode = ublCorrectedInvoice
+		}
+		doc.InvoiceLines = lines
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode UBL: %w", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// summaryLine is the line of an invoice without line items: its subtotal at
+// the rate of its VAT, the one of its breakdown or else the standard rate
+// its tax amount is of
+func summaryLine(inv *model.Invoice, breakdown []model.VATLine) (model.LineItem, error) {
+	line := model.LineItem{
+		Number:    1,
+		Name:      "Hàng hóa, dịch vụ",
+		Quantity:  decimal.NewFromInt(1),
+		UnitPrice: inv.SubtotalAmount,
+		Amount:    inv.SubtotalAmount,
+		VATAmount: inv.TaxAmount,
+		Total:     inv.TotalAmount,
+	}
+	switch len(breakdown) {
+	case 0:
+		for _, percent := range []int64{10, 8, 5, 0} {
+			if rate := model.VATPercent(percent); rate.Tax(inv.SubtotalAmount).Sub(inv.TaxAmount).Abs().LessThan(decimal.NewFromInt(1)) {
+				line.VATRate = rate
+				return line, nil
+			}
+		}
+		return model.LineItem{}, fmt.Errorf("invoice %s has no line items and VAT of no standard rate; UBL requires a line", documentID(inv.Series, inv.Number))
+	case 1:
+		line.VATRate = breakdown[0].Rate
+		return line, nil
+	}
+	return model.LineItem{}, fmt.Errorf("invoice %s has no line items and VAT of %d rates; UBL requires a line of each", documentID(inv.Series, inv.Number), len(breakdown))
+}
+
+// WriteUBL writes inv to w as a UBL 2.1 document (see MarshalUBL)
+func WriteUBL(w io.Writer, inv *model.Invoice) error {
+	data, err := MarshalUBL(inv)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write UBL: %w", err)
+	}
+	return nil
+}
+
+// documentID is the document number of an invoice: its series and number
+func documentID(series, number string) string {
+	if series == "" {
+		return number
+	}
+	return series + "-" + number
+}
+
+func ublDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+func ublPartyOf(p model.Party) ublParty {
+	party := ublParty{Name: p.Name}
+	switch {
+	case p.AddressParts != nil:
+		party.Address = &ublAddress{
+			StreetName:          p.AddressParts.Street,
+			CitySubdivisionName: p.AddressParts.Ward,
+			CityName:            p.AddressParts.Province,
+			District:            p.AddressParts.District,
+			Country:             "VN",
+		}
+	case p.Address != "":
+		party.Address = &ublAddress{Line: p.Address, Country: "VN"}
+	}
+	if p.TaxID != "" {
+		party.TaxScheme = &ublPartyTax{CompanyID: p.TaxID, TaxScheme: "VAT"}
+	}
+	if p.Name != "" {
+		party.LegalEntity = &ublLegalEntity{RegistrationName: p.Name, CompanyID: p.TaxID}
+	}
+	if p.Phone != "" || p.Email != "" {
+		party.Contact = &ublContact{Telephone: p.Phone, ElectronicMail: p.Email}
+	}
+	return party
+}
+
+// ublPaymentMeansOf reads the UNCL 4461 code of the payment method: 10
+// cash, 20 cheque, 30 credit transfer, 1 several or unknown. Abbreviations
+// such as "TM/CK" match as whole words only.
+func ublPaymentMeansOf(inv *model.Invoice) *ublPaymentMeans {
+	method := strings.ToLower(inv.PaymentMethod)
+	if method == "" && inv.Seller.BankAccount == "" {
+		return nil
+	}
+	words := strings.FieldsFunc(method, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	word := func(candidates ...string) bool {
+		for _, w := range words {
+			if slices.Contains(candidates, w) {
+				return true
+			}
+		}
+		return false
+	}
+	cash := strings.Contains(method, "tiền mặt") || word("cash", "tm")
+	transfer := strings.Contains(method, "chuyển khoản") || word("transfer", "ck")
+	cheque := word("séc", "cheque", "check")
+	means := &ublPaymentMeans{Code: "1"}
+	switch {
+	case cash && !transfer && !cheque:
+		means.Code = "10"
+	case cheque && !cash && !transfer:
+		means.Code = "20"
+	case transfer && !cash && !cheque, method == "":
+		means.Code = "30"
+	}
+	if inv.Seller.BankAccount != "" {
+		means.Account = &ublAccount{ID: inv.Seller.BankAccount, BankName: inv.Seller.BankName}
+	}
+	return means
+}
+
+// ublTaxCategoryOf maps a rate to its UNCL 5305 category: S standard, Z
+// zero rated, O outside the scope of VAT
+func ublTaxCategoryOf(rate model.VATRate) ublTaxCategory {
+	category := ublTaxCategory{TaxScheme: "VAT"}
+	switch {
+	case rate.Category == model.VATCategoryNonTaxable:
+		category.ID = "O"
+		category.ExemptionReason = "KCT - Không chịu thuế GTGT"
+	case rate.Category == model.VATCategoryNotDeclared:
+		category.ID = "O"
+		category.ExemptionReason = "KKKNT - Không kê khai, tính nộp thuế GTGT"
+	case rate.IsZero():
+		category.ID = "Z"
+		category.Percent = "0"
+	default:
+		category.ID = "S"
+		category.Percent = rate.Percent.String()
+	}
+	return category
+}
@@ -0,0 +1,204 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// ublDoc reads back the elements of a UBL document the tests check
+type ublDoc struct {
+	XMLName  xml.Name
+	ID       string `xml:"ID"`
+	TypeCode string `xml:"InvoiceTypeCode"`
+	NoteCode string `xml:"CreditNoteTypeCode"`
+	Currency string `xml:"DocumentCurrencyCode"`
+	Billing  string `xml:"BillingReference>InvoiceDocumentReference>ID"`
+	Reason   string `xml:"DiscrepancyResponse>Description"`
+	Seller   string `xml:"AccountingSupplierParty>Party>PartyTaxScheme>CompanyID"`
+	Street   string `xml:"AccountingSupplierParty>Party>PostalAddress>StreetName"`
+	Payment  string `xml:"PaymentMeans>PaymentMeansCode"`
+	Taxes    []struct {
+		Amount    ublAmount `xml:"TaxAmount"`
+		Subtotals []struct {
+			Taxable  string `xml:"TaxableAmount"`
+			Category string `xml:"TaxCategory>ID"`
+			Percent  string `xml:"TaxCategory>Percent"`
+		} `xml:"TaxSubtotal"`
+	} `xml:"TaxTotal"`
+	Payable string    `xml:"LegalMonetaryTotal>PayableAmount"`
+	Lines   []ublLine `xml:"InvoiceLine"`
+	Credits []ublLine `xml:"CreditNoteLine"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublLine struct {
+	Quantity struct {
+		UnitCode string `xml:"unitCode,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"InvoicedQuantity"`
+	Credited   string `xml:"CreditedQuantity"`
+	Amount     string `xml:"LineExtensionAmount"`
+	Allowance  string `xml:"AllowanceCharge>Amount"`
+	Multiplier string `xml:"AllowanceCharge>MultiplierFactorNumeric"`
+	Name       string `xml:"Item>Name"`
+	Price      string `xml:"Price>PriceAmount"`
+}
+
+func readUBL(t *testing.T, inv *model.Invoice) ublDoc {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteUBL(&buf, inv))
+
+	var doc ublDoc
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	return doc
+}
+
+func TestWriteUBL_Invoice(t *testing.T) {
+	inv := testInvoices()[0]
+	inv.Seller.AddressParts = &model.Address{Street: "123 Lê Lợi", Ward: "Phường Bến Nghé", Province: "Hồ Chí Minh"}
+	inv.Seller.BankAccount = "0071001234567"
+	inv.PaymentMethod = "Chuyển khoản"
+	inv.Items[0].UnitCode = "RM"
+	inv.Items[0].Discount = decimal.NewFromInt(10)
+	inv.Items[0].DiscountAmt = decimal.NewFromInt(50000)
+	inv.Items = append(inv.Items, model.LineItem{Number: 3, Name: "Sách", Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(20000), VATRate: model.VATRateKCT})
+	inv.CalculateTotals()
+
+	doc := readUBL(t, inv)
+	assert.Equal(t, "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2", doc.XMLName.Space)
+	assert.Equal(t, "Invoice", doc.XMLName.Local)
+	assert.Equal(t, "C24TAA-0000042", doc.ID)
+	assert.Equal(t, "380", doc.TypeCode)
+	assert.Equal(t, "VND", doc.Currency)
+	assert.Equal(t, "0123456789", doc.Seller)
+	assert.Equal(t, "123 Lê Lợi", doc.Street)
+	assert.Equal(t, "30", doc.Payment)
+
+	require.Len(t, doc.Taxes, 1)
+	assert.Equal(t, "VND", doc.Taxes[0].Amount.Currency)
+	assert.Equal(t, inv.TaxAmount.String(), doc.Taxes[0].Amount.Value)
+	require.Len(t, doc.Taxes[0].Subtotals, 2)
+	assert.Equal(t, "S", doc.Taxes[0].Subtotals[0].Category)
+	assert.Equal(t, "10", doc.Taxes[0].Subtotals[0].Percent)
+	assert.Equal(t, "O", doc.Taxes[0].Subtotals[1].Category, "KCT is outside the scope of VAT")
+	assert.Equal(t, inv.TotalAmount.String(), doc.Payable)
+
+	require.Len(t, doc.Lines, 3)
+	assert.Equal(t, "RM", doc.Lines[0].Quantity.UnitCode)
+	assert.Equal(t, "10", doc.Lines[0].Quantity.Value)
+	assert.Equal(t, "450000", doc.Lines[0].Amount, "net of the discount")
+	assert.Equal(t, "50000", doc.Lines[0].Allowance)
+	assert.Equal(t, "0.1", doc.Lines[0].Multiplier, "a multiplier, not the percentage")
+	assert.Equal(t, "Giấy A4", doc.Lines[0].Name)
+	assert.Empty(t, doc.Lines[1].Quantity.UnitCode)
+	assert.Empty(t, doc.Credits)
+}
+
+func TestWriteUBL_PaymentMeans(t *testing.T) {
+	for method, code := range map[string]string{
+		"Chuyển khoản":        "30",
+		"CK":                  "30",
+		"Bank transfer":       "30",
+		"Tiền mặt":            "10",
+		"TM":                  "10",
+		"TM/CK":               "1",
+		"Check":               "20",
+		"Cheque":              "20",
+		"Séc":                 "20",
+		"Thẻ tín dụng (card)": "1",
+	} {
+		inv := testInvoices()[0]
+		inv.PaymentMethod = method
+		assert.Equal(t, code, readUBL(t, inv).Payment, method)
+	}
+}
+
+func TestWriteUBL_NoItems(t *testing.T) {
+	receipt := &model.Invoice{
+		Number:         "R-17",
+		Date:           time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		SubtotalAmount: decimal.NewFromInt(100000),
+		TaxAmount:      decimal.NewFromInt(8000),
+		TotalAmount:    decimal.NewFromInt(108000),
+	}
+	doc := readUBL(t, receipt)
+	require.Len(t, doc.Lines, 1, "UBL requires a line")
+	assert.Equal(t, "100000", doc.Lines[0].Amount)
+	assert.Equal(t, "1", doc.Lines[0].Quantity.Value)
+	require.Len(t, doc.Taxes[0].Subtotals, 1)
+	assert.Equal(t, "8", doc.Taxes[0].Subtotals[0].Percent, "the rate of the tax amount")
+
+	receipt.TaxBreakdown = []model.VATLine{{Rate: model.VATRateKCT, TaxableAmount: decimal.NewFromInt(100000)}}
+	receipt.TaxAmount, receipt.TotalAmount = decimal.Zero, decimal.NewFromInt(100000)
+	doc = readUBL(t, receipt)
+	require.Len(t, doc.Lines, 1)
+	assert.Equal(t, "O", doc.Taxes[0].Subtotals[0].Category, "the rate of the breakdown")
+
+	receipt.TaxBreakdown = append(receipt.TaxBreakdown, model.VATLine{Rate: model.VATRate10})
+	_, err := export.MarshalUBL(receipt)
+	assert.ErrorContains(t, err, "no line items and VAT of 2 rates")
+
+	receipt.TaxBreakdown = nil
+	receipt.TaxAmount = decimal.NewFromInt(3500)
+	_, err = export.MarshalUBL(receipt)
+	assert.ErrorContains(t, err, "no standard rate")
+}
+
+func TestWriteUBL_NoDate(t *testing.T) {
+	inv := testInvoices()[0]
+	inv.Date = time.Time{}
+	_, err := export.MarshalUBL(inv)
+	assert.ErrorContains(t, err, "no date")
+}
+
+func TestWriteUBL_CreditNote(t *testing.T) {
+	inv := testInvoices()[0]
+	inv.DocumentType = model.DocumentTypeCreditNote
+	inv.Type = model.InvoiceTypeAdjustment
+	inv.OriginalInvoice = &model.InvoiceReference{Series: "C24TAA", Number: "0000041", Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}
+	inv.AdjustmentReason = "Hàng trả lại"
+	inv.CalculateTotals()
+
+	doc := readUBL(t, inv)
+	assert.Equal(t, "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2", doc.XMLName.Space)
+	assert.Equal(t, "CreditNote", doc.XMLName.Local)
+	assert.Equal(t, "381", doc.NoteCode)
+	assert.Empty(t, doc.TypeCode)
+	assert.Equal(t, "C24TAA-0000041", doc.Billing)
+	assert.Equal(t, "Hàng trả lại", doc.Reason)
+	assert.Equal(t, "561000", doc.Payable, "credit notes are positive")
+
+	assert.Empty(t, doc.Lines)
+	require.Len(t, doc.Credits, 2)
+	assert.Equal(t, "2.5", doc.Credits[1].Credited)
+}
+
+func TestWriteUBL_ForeignCurrency(t *testing.T) {
+	inv := testInvoices()[0]
+	inv.Currency = "USD"
+	inv.ExchangeRate = decimal.NewFromInt(25000)
+	inv.Items = inv.Items[:1]
+	inv.Items[0].UnitPrice = decimal.NewFromInt(2)
+	inv.CalculateTotals()
+
+	doc := readUBL(t, inv)
+	assert.Equal(t, "USD", doc.Currency)
+	require.Len(t, doc.Taxes, 2)
+	assert.Equal(t, "USD", doc.Taxes[0].Amount.Currency)
+	assert.Equal(t, "2", doc.Taxes[0].Amount.Value)
+	assert.Equal(t, ublAmount{Currency: "VND", Value: "50000"}, doc.Taxes[1].Amount)
+}
@@ -0,0 +1,279 @@
+// Package export writes processing results as spreadsheets and flat files
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+// Sheet is a worksheet of an XLSX workbook. Cells may be strings, numbers
+// (int, int64, float64, decimal.Decimal), dates (time.Time) or nil for
+// blanks; other values are written as text with fmt.
+type Sheet struct {
+	Name   string
+	Header []string // Bold first row, frozen when scrolling (optional)
+	Rows   [][]any
+
+	// Formats are Excel number formats by column, such as "#,##0" ("" =
+	// General, and yyyy-mm-dd for dates)
+	Formats []string
+}
+
+// WriteXLSX writes sheets as an Office Open XML workbook
+func WriteXLSX(w io.Writer, sheets ...Sheet) error {
+	if len(sheets) == 0 {
+		return fmt.Errorf("workbook has no sheets")
+	}
+	zw := zip.NewWriter(w)
+	write := func(name, content string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, xml.Header+content)
+		return err
+	}
+
+	styles := newStyleSheet(sheets)
+	var overrides, workbookSheets, rels strings.Builder
+	for i := range sheets {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheetName(sheets[i].Name, n)), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbookSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", styles.xml()},
+	}
+	for _, part := range parts {
+		if err := write(part.name, part.content); err != nil {
+			return fmt.Errorf("failed to write workbook: %w", err)
+		}
+	}
+	for i, sheet := range sheets {
+		if err := write(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheetXML(sheet, styles)); err != nil {
+			return fmt.Errorf("failed to write workbook: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write workbook: %w", err)
+	}
+	return nil
+}
+
+// Cell styles: 0 is the default, 1 the bold header, 2 dates and the
+// others the number formats of columns
+const (
+	styleHeader = 1
+	styleDate   = 2
+)
+
+// styleSheet assigns a cell style to each number format used
+type styleSheet struct {
+	formats []string
+	index   map[string]int
+}
+
+func newStyleSheet(sheets []Sheet) *styleSheet {
+	s := &styleSheet{index: make(map[string]int)}
+	for _, sheet := range sheets {
+		for _, format := range sheet.Formats {
+			if _, ok := s.index[format]; format != "" && !ok {
+				s.index[format] = styleDate + 1 + len(s.formats)
+				s.formats = append(s.formats, format)
+			}
+		}
+	}
+	return s
+}
+
+// style returns the style of a column format ("" = default)
+func (s *styleSheet) style(format string) int {
+	return s.index[format]
+}
+
+func (s *styleSheet) xml() string {
+	var b strings.Builder
+	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Custom number formats are numbered from 164; 164 is the date format
+	fmt.Fprintf(&b, `<numFmts count="%d"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/>`, len(s.formats)+1)
+	for i, format := range s.formats {
+		fmt.Fprintf(&b, `<numFmt numFmtId="%d" formatCode="%s"/>`, 165+i, escape(format))
+	}
+	b.WriteString(`</numFmts>`)
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&b, `<cellXfs count="%d"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`+
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`+
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, len(s.formats)+3)
+	for i := range s.formats {
+		fmt.Fprintf(&b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, 165+i)
+	}
+	b.WriteString(`</cellXfs></styleSheet>`)
+	return b.String()
+}
+
+func sheetXML(sheet Sheet, styles *styleSheet) string {
+	var b strings.Builder
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(sheet.Header) > 0 {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	if widths := columnWidths(sheet); len(widths) > 0 {
+		b.WriteString(`<cols>`)
+		for col, width := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, col+1, col+1, width)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	row := 0
+	if len(sheet.Header) > 0 {
+		row++
+		fmt.Fprintf(&b, `<row r="%d">`, row)
+		for col, name := range sheet.Header {
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, cellRef(col, row), styleHeader, escape(name))
+		}
+		b.WriteString(`</row>`)
+	}
+	for _, values := range sheet.Rows {
+		row++
+		fmt.Fprintf(&b, `<row r="%d">`, row)
+		for col, v := range values {
+			format := ""
+			if col < len(sheet.Formats) {
+				format = sheet.Formats[col]
+			}
+			writeCell(&b, cellRef(col, row), v, styles.style(format))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// columnWidths sizes the columns to their longest value, in characters,
+// between 8 and 50
+func columnWidths(sheet Sheet) []int {
+	var widths []int
+	measure := func(col int, text string) {
+		for len(widths) <= col {
+			widths = append(widths, 8)
+		}
+		if n := utf8.RuneCountInString(text) + 2; n > widths[col] {
+			widths[col] = min(n, 50)
+		}
+	}
+	for col, name := range sheet.Header {
+		measure(col, name)
+	}
+	for _, values := range sheet.Rows {
+		for col, v := range values {
+			measure(col, cellText(v))
+		}
+	}
+	return widths
+}
+
+func writeCell(b *strings.Builder, ref string, v any, style int) {
+	var number string
+	switch v := v.(type) {
+	case nil:
+		return
+	case string:
+		if v == "" {
+			return
+		}
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(v))
+		return
+	case int:
+		number = strconv.Itoa(v)
+	case int64:
+		number = strconv.FormatInt(v, 10)
+	case float64:
+		number = strconv.FormatFloat(v, 'f', -1, 64)
+	case decimal.Decimal:
+		number = v.String()
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+		number = strconv.FormatFloat(excelDate(v), 'f', -1, 64)
+		if style == 0 {
+			style = styleDate
+		}
+	default:
+		writeCell(b, ref, fmt.Sprint(v), style)
+		return
+	}
+	if style == 0 {
+		fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, number)
+		return
+	}
+	fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, number)
+}
+
+// excelDate returns the serial number Excel stores for the wall-clock time
+// of t: days since 1899-12-30
+func excelDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// cellRef returns the A1 reference of a zero-based column and one-based row
+func cellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// sheetName returns a name Excel accepts: at most 31 characters, none of
+// []:*?/\
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(n)
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+)
+
+// readParts returns the files of a workbook by name
+func readParts(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		// Every part must be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else {
+				require.NoError(t, err, f.Name)
+			}
+		}
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := export.WriteXLSX(&buf,
+		export.Sheet{
+			Name:   "Invoices",
+			Header: []string{"Number", "Seller", "Total"},
+			Rows: [][]any{
+				{"0000042", "Công ty A & B <HN>", decimal.RequireFromString("1100000.50")},
+				{"0000043", nil, 3},
+			},
+		},
+		export.Sheet{Name: "Lines: 2024/05", Rows: [][]any{{1.5}}},
+	)
+	require.NoError(t, err)
+
+	parts := readParts(t, buf.Bytes())
+	require.Contains(t, parts, "[Content_Types].xml")
+	require.Contains(t, parts, "xl/styles.xml")
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="Invoices" sheetId="1" r:id="rId1"/>`)
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="Lines_ 2024_05" sheetId="2" r:id="rId2"/>`)
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `state="frozen"`)
+	assert.Contains(t, sheet, `<c r="A1" s="1" t="inlineStr"><is><t>Number</t></is></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">0000042</t>`)
+	assert.Contains(t, sheet, `Công ty A &amp; B &lt;HN&gt;`)
+	assert.Contains(t, sheet, `<c r="C2"><v>1100000.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="C3"><v>3</v></c>`)
+	assert.NotContains(t, sheet, `r="B3"`)
+
+	assert.Contains(t, parts["xl/worksheets/sheet2.xml"], `<c r="A1"><v>1.5</v></c>`)
+	assert.NotContains(t, parts["xl/worksheets/sheet2.xml"], `frozen`)
+}
+
+func TestWriteXLSX_ColumnRefs(t *testing.T) {
+	row := make([]any, 28)
+	for i := range row {
+		row[i] = i
+	}
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteXLSX(&buf, export.Sheet{Rows: [][]any{row}}))
+
+	parts := readParts(t, buf.Bytes())
+	assert.Contains(t, parts["xl/workbook.xml"], `name="Sheet1"`)
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="Z1"><v>25</v></c>`)
+	assert.Contains(t, sheet, `<c r="AA1"><v>26</v></c>`)
+	assert.Contains(t, sheet, `<c r="AB1"><v>27</v></c>`)
+}
+
+func TestWriteXLSX_NoSheets(t *testing.T) {
+	assert.Error(t, export.WriteXLSX(io.Discard))
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// LLMAddress is one address split into administrative units
+type LLMAddress struct {
+	Street   string `json:"street"`
+	Ward     string `json:"ward"`
+	District string `json:"district"`
+	Province string `json:"province"`
+}
+
+// LLMAddresses is the expected JSON structure for address parsing
+type LLMAddresses struct {
+	Addresses []LLMAddress `json:"addresses"`
+}
+
+// AddressSchema is the output contract for splitting addresses into administrative units
+var AddressSchema = &ResponseSchema{
+	Name:        "record_addresses",
+	Description: "Record Vietnamese addresses split into street, ward, district and province",
+	Schema:      JSONSchemaFor(LLMAddresses{}),
+}
+
+// ParseAddresses splits Vietnamese addresses into street, ward, district and
+// province in one request, returning them in the order given
+func (e *Extractor) ParseAddresses(ctx context.Context, addresses []string) ([]model.Address, error) {
+	var list strings.Builder
+	for i, addr := range addresses {
+		fmt.Fprintf(&list, "%d. %s\n", i+1, addr)
+	}
+
+	response, err := e.complete(ctx, e.textModels(ctx), AddressSchema, e.promptSet(ctx).SystemInvoice, fmt.Sprintf(UserPromptAddresses, len(addresses), list.String()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+
+	resp, err := decodeJSON[LLMAddresses](response)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Addresses) != len(addresses) {
+		return nil, fmt.Errorf("expected %d addresses, got %d", len(addresses), len(resp.Addresses))
+	}
+
+	parsed := make([]model.Address, len(addresses))
+	for i, addr := range resp.Addresses {
+		parsed[i] = model.Address{
+			Street:   strings.TrimSpace(addr.Street),
+			Ward:     strings.TrimSpace(addr.Ward),
+			District: strings.TrimSpace(addr.District),
+			Province: strings.TrimSpace(addr.Province),
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+)
+
+// AnthropicConfig configures an Anthropic Messages API provider
+type AnthropicConfig struct {
+	APIKey  string
+	BaseURL string // Default: DefaultAnthropicBaseURL
+	Timeout time.Duration
+	HTTP    HTTPOptions
+}
+
+// AnthropicProvider calls the Anthropic Messages API
+type AnthropicProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewAnthropicProvider creates an Anthropic provider
+func NewAnthropicProvider(cfg AnthropicConfig) *AnthropicProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultAnthropicBaseURL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &AnthropicProvider{
+		apiKey:     cfg.APIKey,
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTP.httpClient(cfg.Timeout),
+	}
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicContent struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	Source       *anthropicImageSource  `json:"source,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicCacheControl marks the end of a cacheable prompt prefix
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	MaxTokens   int64                `json:"max_tokens"`
+	System      any                  `json:"system,omitempty"` // A string, or text blocks when caching
+	Messages    []anthropicMessage   `json:"messages"`
+	Temperature float64              `json:"temperature"`
+	TopP        float64              `json:"top_p,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model   string             `json:"model"`
+	Content []anthropicContent `json:"content"`
+	Usage   struct {
+		InputTokens              int64 `json:"input_tokens"`
+		OutputTokens             int64 `json:"output_tokens"`
+		CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// Name returns the provider name
+func (p *AnthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+// Complete sends a Messages API request
+func (p *AnthropicProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, _, err := newJSONRequest(ctx, p.baseURL+"/v1/messages", buildAnthropicRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(httpReq)
+
+	var resp anthropicResponse
+	if err := doJSON(p.httpClient, httpReq, ProviderAnthropic, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.toResponse(), nil
+}
+
+func (p *AnthropicProvider) setHeaders(req *http.Request) {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+}
+
+// buildAnthropicRequest converts req to a Messages API payload
+func buildAnthropicRequest(req *Request) anthropicRequest {
+	var content []anthropicContent
+	for _, img := range req.Images {
+		content = append(content, anthropicContent{Type: "image", Source: &anthropicImageSource{
+			Type:      "base64",
+			MediaType: img.MimeType,
+			Data:      base64.StdEncoding.EncodeToString(img.Data),
+		}})
+	}
+	content = append(content, anthropicContent{Type: "text", Text: req.UserPrompt})
+
+	payload := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Messages:    []anthropicMessage{{Role: "user", Content: content}},
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.SystemPrompt != "" {
+		payload.System = req.SystemPrompt
+		if req.CachePrompt {
+			// The cached prefix runs through the breakpoint: tools, then the system prompt
+			payload.System = []anthropicContent{{
+				Type:         "text",
+				Text:         req.SystemPrompt,
+				CacheControl: &anthropicCacheControl{Type: "ephemeral"},
+			}}
+		}
+	}
+	if req.Schema != nil {
+		// Force the model to answer through a tool whose input is the schema
+		payload.Tools = []anthropicTool{{
+			Name:        req.Schema.Name,
+			Description: req.Schema.Description,
+			InputSchema: req.Schema.Schema,
+		}}
+		payload.ToolChoice = &anthropicToolChoice{Type: "tool", Name: req.Schema.Name}
+	}
+
+	return payload
+}
+
+// toResponse returns the forced tool input, or the concatenated text blocks
+func (r *anthropicResponse) toResponse() *Response {
+	var text strings.Builder
+	for _, c := range r.Content {
+		if c.Type == "tool_use" {
+			text.Reset()
+			text.Write(c.Input)
+			break
+		}
+		text.WriteString(c.Text)
+	}
+
+	return &Response{
+		Content: text.String(),
+		Model:   r.Model,
+		Usage: Usage{
+			// input_tokens counts only the tokens after the last cache breakpoint
+			PromptTokens:       r.Usage.InputTokens + r.Usage.CacheCreationInputTokens + r.Usage.CacheReadInputTokens,
+			CompletionTokens:   r.Usage.OutputTokens,
+			CachedPromptTokens: r.Usage.CacheReadInputTokens,
+		},
+	}
+}
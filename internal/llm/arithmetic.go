@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// DefaultArithmeticTolerance absorbs rounding of amounts to whole đồng
+var DefaultArithmeticTolerance = decimal.NewFromInt(1)
+
+// WithArithmeticCheck verifies extracted amounts (quantity × unit price = amount,
+// item amounts add up to the subtotal, subtotal + VAT = total) and, when they
+// differ by more than tolerance, sends the discrepancies back to the model once
+// for correction. Corrected values are listed in Invoice.Corrections; amounts
+// that still do not add up are added to Invoice.LowConfidenceFields.
+func WithArithmeticCheck(tolerance decimal.Decimal) ExtractorOption {
+	return func(e *Extractor) {
+		e.arithmeticCheck = true
+		e.arithmeticTolerance = tolerance
+	}
+}
+
+// LLMAmounts is the expected JSON structure for arithmetic corrections
+type LLMAmounts struct {
+	Items       []LLMItemAmounts `json:"items"`
+	Subtotal    json.Number      `json:"subtotal"`
+	TotalVAT    json.Number      `json:"total_vat"`
+	TotalAmount json.Number      `json:"total_amount"`
+}
+
+// LLMItemAmounts holds the amounts of one line item
+type LLMItemAmounts struct {
+	Name           string      `json:"name"`
+	Quantity       json.Number `json:"quantity"`
+	UnitPrice      json.Number `json:"unit_price"`
+	DiscountAmount json.Number `json:"discount_amount"`
+	Amount         json.Number `json:"amount"`
+	VATAmount      json.Number `json:"vat_amount"`
+	Total          json.Number `json:"total"`
+}
+
+// ArithmeticSchema is the output contract for re-reading amounts that do not add up
+var ArithmeticSchema = &ResponseSchema{
+	Name:        "record_corrected_amounts",
+	Description: "Record the line item amounts and totals of an invoice after re-reading them",
+	Schema:      JSONSchemaFor(LLMAmounts{}),
+}
+
+// llmAmountFields names invoice amounts as they appear in the extraction schema
+var llmAmountFields = strings.NewReplacer("subtotal_amount", "subtotal", "tax_amount", "total_vat")
+
+// correctArithmetic re-asks the model for the amounts of an invoice whose
+// arithmetic does not hold. The answer is kept only if it leaves fewer
+// discrepancies. Like field recovery it is best effort: on failure inv is
+// returned with the inconsistent amounts flagged as low confidence.
+func (e *Extractor) correctArithmetic(ctx context.Context, inv *model.Invoice, models []string, document string, images []Image) *model.Invoice {
+	if !e.arithmeticCheck {
+		return inv
+	}
+	errs := inv.CheckArithmetic(e.arithmeticTolerance)
+	if len(errs) == 0 {
+		return inv
+	}
+
+	if corrected := e.requestAmounts(ctx, inv, errs, models, document, images); corrected != nil {
+		if remaining := corrected.CheckArithmetic(e.arithmeticTolerance); len(remaining) < len(errs) {
+			corrected.Corrections = append(slices.Clone(inv.Corrections), amountChanges(inv, corrected)...)
+			inv, errs = corrected, remaining
+		}
+	}
+
+	for _, err := range errs {
+		if !slices.Contains(inv.LowConfidenceFields, err.Field) {
+			inv.LowConfidenceFields = append(inv.LowConfidenceFields, err.Field)
+		}
+	}
+	return inv
+}
+
+// requestAmounts asks the model to re-read the amounts of inv and returns a
+// copy with them applied, or nil if the request fails
+func (e *Extractor) requestAmounts(ctx context.Context, inv *model.Invoice, errs []model.ArithmeticError, models []string, document string, images []Image) *model.Invoice {
+	var list strings.Builder
+	for _, err := range errs {
+		fmt.Fprintf(&list, "- %s\n", llmAmountFields.Replace(err.Error()))
+	}
+	current, err := json.MarshalIndent(amountsOf(inv), "", "  ")
+	if err != nil {
+		return nil
+	}
+
+	prompt := fmt.Sprintf(UserPromptArithmeticCorrection, list.String(), current)
+	if document != "" {
+		prompt += fmt.Sprintf("\n\nDocument text:\n---\n%s\n---", document)
+	}
+
+	response, err := e.complete(ctx, models, ArithmeticSchema, e.followUpSystemPrompt(ctx, inv), prompt, images)
+	if err != nil {
+		return nil
+	}
+	resp, err := decodeJSON[LLMAmounts](response)
+	if err != nil {
+		return nil
+	}
+
+	corrected := *inv
+	corrected.Items = slices.Clone(inv.Items)
+	// Items can only be matched up when the model returned all of them
+	if len(resp.Items) == len(corrected.Items) {
+		for i, amounts := range resp.Items {
+			item := &corrected.Items[i]
+			setDecimal(&item.Quantity, amounts.Quantity, parseDecimal)
+			setDecimal(&item.UnitPrice, amounts.UnitPrice, e.amountParser(inv.Currency))
+			setDecimal(&item.DiscountAmt, amounts.DiscountAmount, e.amountParser(inv.Currency))
+			setDecimal(&item.Amount, amounts.Amount, e.amountParser(inv.Currency))
+			setDecimal(&item.VATAmount, amounts.VATAmount, e.amountParser(inv.Currency))
+			setDecimal(&item.Total, amounts.Total, e.amountParser(inv.Currency))
+		}
+	}
+	setDecimal(&corrected.SubtotalAmount, resp.Subtotal, e.amountParser(inv.Currency))
+	setDecimal(&corrected.TaxAmount, resp.TotalVAT, e.amountParser(inv.Currency))
+	setDecimal(&corrected.TotalAmount, resp.TotalAmount, e.amountParser(inv.Currency))
+
+	return &corrected
+}
+
+// amountParser parses amounts in currency
+func (e *Extractor) amountParser(currency string) func(json.Number) decimal.Decimal {
+	return func(n json.Number) decimal.Decimal {
+		return e.parseAmount(n, currency)
+	}
+}
+
+// setDecimal overwrites dst with n unless the model left n out
+func setDecimal(dst *decimal.Decimal, n json.Number, parse func(json.Number) decimal.Decimal) {
+	if n != "" {
+		*dst = parse(n)
+	}
+}
+
+// amountsOf lists the amounts of inv in the extraction schema's terms
+func amountsOf(inv *model.Invoice) LLMAmounts {
+	amounts := LLMAmounts{
+		Subtotal:    json.Number(inv.SubtotalAmount.String()),
+		TotalVAT:    json.Number(inv.TaxAmount.String()),
+		TotalAmount: json.Number(inv.TotalAmount.String()),
+	}
+	for _, item := range inv.Items {
+		amounts.Items = append(amounts.Items, LLMItemAmounts{
+			Name:           item.Name,
+			Quantity:       json.Number(item.Quantity.String()),
+			UnitPrice:      json.Number(item.UnitPrice.String()),
+			DiscountAmount: json.Number(item.DiscountAmt.String()),
+			Amount:         json.Number(item.Amount.String()),
+			VATAmount:      json.Number(item.VATAmount.String()),
+			Total:          json.Number(item.Total.String()),
+		})
+	}
+	return amounts
+}
+
+// amountChanges describes the amounts that differ between before and after
+func amountChanges(before, after *model.Invoice) []string {
+	var changes []string
+	changed := func(field string, old, new decimal.Decimal) {
+		if !old.Equal(new) {
+			changes = append(changes, fmt.Sprintf("%s: %s → %s", field, old, new))
+		}
+	}
+
+	for i := range after.Items {
+		b, a := before.Items[i], after.Items[i]
+		changed(fmt.Sprintf("items[%d].quantity", i), b.Quantity, a.Quantity)
+		changed(fmt.Sprintf("items[%d].unit_price", i), b.UnitPrice, a.UnitPrice)
+		changed(fmt.Sprintf("items[%d].discount_amt", i), b.DiscountAmt, a.DiscountAmt)
+		changed(fmt.Sprintf("items[%d].amount", i), b.Amount, a.Amount)
+		changed(fmt.Sprintf("items[%d].vat_amount", i), b.VATAmount, a.VATAmount)
+		changed(fmt.Sprintf("items[%d].total", i), b.Total, a.Total)
+	}
+	changed("subtotal_amount", before.SubtotalAmount, after.SubtotalAmount)
+	changed("tax_amount", before.TaxAmount, after.TaxAmount)
+	changed("total_amount", before.TotalAmount, after.TotalAmount)
+
+	return changes
+}
@@ -0,0 +1,61 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_ArithmeticCheck(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"12","items":[
+			{"name":"Bút bi","quantity":10,"unit_price":5000,"amount":50000},
+			{"name":"Giấy A4","quantity":2,"unit_price":75000,"amount":1500000}
+		],"subtotal":200000,"total_vat":20000,"total_amount":220000}`,
+		`{"items":[
+			{"name":"Bút bi","quantity":10,"unit_price":5000,"amount":50000},
+			{"name":"Giấy A4","quantity":2,"unit_price":75000,"amount":150000}
+		],"subtotal":200000,"total_vat":20000,"total_amount":220000}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithArithmeticCheck(llm.DefaultArithmeticTolerance))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 ...")
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(150000).Equal(inv.Items[1].Amount))
+	assert.Equal(t, []string{"items[1].amount: 1500000 → 150000"}, inv.Corrections)
+	assert.Empty(t, inv.LowConfidenceFields)
+
+	require.Len(t, provider.requests, 2)
+	followUp := provider.requests[1]
+	assert.Equal(t, llm.ArithmeticSchema, followUp.Schema)
+	assert.Contains(t, followUp.UserPrompt, "items[1].amount is 1500000 but quantity × unit_price is 150000")
+	assert.Contains(t, followUp.UserPrompt, "subtotal is 200000 but the sum of item amounts is 1550000")
+	assert.Contains(t, followUp.UserPrompt, "HOA DON 12")
+}
+
+func TestExtractor_ArithmeticCheck_Unresolved(t *testing.T) {
+	first := `{"subtotal":200000,"total_vat":20000,"total_amount":230000}`
+	provider := &recordingProvider{responses: []string{first, first}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithArithmeticCheck(llm.DefaultArithmeticTolerance))
+
+	inv, err := extractor.ExtractFromImages(context.Background(), []llm.Image{{Data: []byte("png"), MimeType: "image/png"}})
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(230000).Equal(inv.TotalAmount))
+	assert.Empty(t, inv.Corrections)
+	assert.Equal(t, []string{"total_amount"}, inv.LowConfidenceFields)
+	assert.Len(t, provider.requests, 2)
+}
+
+func TestExtractor_ArithmeticCheck_Consistent(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"subtotal":200000,"total_vat":20000,"total_amount":220000}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithArithmeticCheck(llm.DefaultArithmeticTolerance))
+
+	_, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Len(t, provider.requests, 1)
+}
@@ -0,0 +1,208 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent describes one LLM call. Bodies are only set when enabled with
+// WithAuditBodies, after the body redactor has run.
+type AuditEvent struct {
+	ID             string        `json:"id"`
+	DocumentID     string        `json:"document_id,omitempty"` // From ContextWithDocumentID
+	Time           time.Time     `json:"time"`
+	Provider       string        `json:"provider"`
+	Model          string        `json:"model"`                     // Model that answered, as reported by the provider
+	RequestedModel string        `json:"requested_model,omitempty"` // Model asked for, when the provider reports another
+	RequestHash    string        `json:"request_hash"`              // CacheKey of the request
+	Schema         string        `json:"schema,omitempty"`
+	Images         int           `json:"images,omitempty"`
+	ImageBytes     int           `json:"image_bytes,omitempty"`
+	ImageHashes    []string      `json:"image_sha256,omitempty"` // SHA-256 of each image, to match it to the document
+	Temperature    float64       `json:"temperature"`
+	TopP           float64       `json:"top_p,omitempty"`
+	MaxTokens      int64         `json:"max_tokens,omitempty"`
+	Sample         int           `json:"sample,omitempty"`
+	Streamed       bool          `json:"streamed,omitempty"`
+	Cached         bool          `json:"cached,omitempty"`
+	Duration       time.Duration `json:"duration_ns"`
+	Usage          Usage         `json:"usage"`
+	Error          string        `json:"error,omitempty"`
+
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	UserPrompt   string `json:"user_prompt,omitempty"`
+	Response     string `json:"response,omitempty"`
+}
+
+// Interceptor receives an AuditEvent after every client call, including cache
+// hits and failures. It runs synchronously and must be safe for concurrent use.
+type Interceptor interface {
+	Intercept(ctx context.Context, event *AuditEvent)
+}
+
+// InterceptorFunc adapts a function to Interceptor
+type InterceptorFunc func(ctx context.Context, event *AuditEvent)
+
+// Intercept calls f
+func (f InterceptorFunc) Intercept(ctx context.Context, event *AuditEvent) {
+	f(ctx, event)
+}
+
+// BodyRedactor masks sensitive content in audited prompts and responses
+type BodyRedactor func(system, user, response string) (string, string, string)
+
+// auditBodySep separates bodies redacted together; rules never match across it
+const auditBodySep = "\n\x00\n"
+
+// RedactBodies masks audited bodies with r. The bodies are redacted together so
+// a value found in the prompt is also masked where the response repeats it.
+func RedactBodies(r *Redactor) BodyRedactor {
+	return func(system, user, response string) (string, string, string) {
+		masked, _ := r.Redact(strings.Join([]string{system, user, response}, auditBodySep))
+		parts := strings.SplitN(masked, auditBodySep, 3)
+		if len(parts) != 3 {
+			return "", "", ""
+		}
+		return parts[0], parts[1], parts[2]
+	}
+}
+
+// WithInterceptor adds an audit interceptor; several may be registered
+func WithInterceptor(i Interceptor) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.interceptors = append(cfg.interceptors, i)
+	}
+}
+
+// WithAuditBodies includes prompts and responses in audit events, passed
+// through redact first (nil = unredacted). Image data is never included.
+func WithAuditBodies(redact BodyRedactor) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.auditBodies = true
+		cfg.auditRedact = redact
+	}
+}
+
+type documentIDKey struct{}
+
+// ContextWithDocumentID tags LLM calls made with ctx for audit correlation
+func ContextWithDocumentID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, documentIDKey{}, id)
+}
+
+// DocumentIDFromContext returns the ID attached by ContextWithDocumentID
+func DocumentIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(documentIDKey{}).(string)
+	return id
+}
+
+type contextInterceptorsKey struct{}
+
+// ContextWithInterceptor adds an interceptor for the calls made with ctx
+// only, after those of the client. It receives the prompts and response
+// unredacted whether or not WithAuditBodies is set; use it for debugging.
+func ContextWithInterceptor(ctx context.Context, i Interceptor) context.Context {
+	parent, _ := ctx.Value(contextInterceptorsKey{}).([]Interceptor)
+	return context.WithValue(ctx, contextInterceptorsKey{}, append(slices.Clip(parent), i))
+}
+
+// audit reports a finished call to the interceptors
+func (c *Client) audit(ctx context.Context, req *Request, resp *Response, err error, start time.Time, streamed bool) {
+	scoped, _ := ctx.Value(contextInterceptorsKey{}).([]Interceptor)
+	if len(c.interceptors) == 0 && len(scoped) == 0 {
+		return
+	}
+
+	event := &AuditEvent{
+		ID:          newAuditID(),
+		DocumentID:  DocumentIDFromContext(ctx),
+		Time:        start,
+		Provider:    c.provider.Name(),
+		Model:       req.Model,
+		RequestHash: CacheKey(c.provider.Name(), req),
+		Images:      len(req.Images),
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+		Sample:      req.Sample,
+		Streamed:    streamed,
+		Duration:    time.Since(start),
+	}
+	if req.Schema != nil {
+		event.Schema = req.Schema.Name
+	}
+	for _, img := range req.Images {
+		event.ImageBytes += len(img.Data)
+		sum := sha256.Sum256(img.Data)
+		event.ImageHashes = append(event.ImageHashes, hex.EncodeToString(sum[:]))
+	}
+	if resp != nil {
+		event.Cached = resp.Cached
+		event.Usage = resp.Usage
+		if resp.Model != "" && resp.Model != req.Model {
+			event.Model, event.RequestedModel = resp.Model, req.Model
+		}
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if len(scoped) > 0 {
+		full := *event
+		full.SystemPrompt, full.UserPrompt = req.SystemPrompt, req.UserPrompt
+		if resp != nil {
+			full.Response = resp.Content
+		}
+		defer func() {
+			for _, i := range scoped {
+				i.Intercept(ctx, &full)
+			}
+		}()
+	}
+
+	if c.auditBodies {
+		event.SystemPrompt, event.UserPrompt = req.SystemPrompt, req.UserPrompt
+		if resp != nil {
+			event.Response = resp.Content
+		}
+		if c.auditRedact != nil {
+			event.SystemPrompt, event.UserPrompt, event.Response = c.auditRedact(event.SystemPrompt, event.UserPrompt, event.Response)
+		}
+	}
+
+	for _, i := range c.interceptors {
+		i.Intercept(ctx, event)
+	}
+}
+
+func newAuditID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// JSONLAuditLog writes audit events as JSON Lines
+type JSONLAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLAuditLog creates an interceptor writing one JSON object per call to w
+func NewJSONLAuditLog(w io.Writer) *JSONLAuditLog {
+	return &JSONLAuditLog{enc: json.NewEncoder(w)}
+}
+
+// Intercept writes event; write errors are ignored so auditing never fails a call
+func (l *JSONLAuditLog) Intercept(_ context.Context, event *AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(event)
+}
@@ -0,0 +1,129 @@
+package llm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+type failingProvider struct{ err error }
+
+func (p failingProvider) Name() string { return "failing" }
+
+func (p failingProvider) Complete(context.Context, *llm.Request) (*llm.Response, error) {
+	return nil, p.err
+}
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []*llm.AuditEvent
+}
+
+func (r *eventRecorder) Intercept(_ context.Context, event *llm.AuditEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestInterceptor_MetadataOnly(t *testing.T) {
+	rec := &eventRecorder{}
+	client := llm.NewClient("",
+		llm.WithProvider(staticProvider{content: `{"ok":true}`}),
+		llm.WithInterceptor(rec),
+		llm.WithCache(llm.NewMemoryCache(10), 0),
+	)
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "inv-42.pdf")
+	req := func() *llm.Request {
+		return &llm.Request{
+			Model:      "m",
+			UserPrompt: "Seller phone: 0912 345 678",
+			Images:     []llm.Image{{Data: []byte("12345"), MimeType: "image/png"}},
+			Schema:     llm.InvoiceSchema,
+		}
+	}
+	_, err := client.Complete(ctx, req())
+	require.NoError(t, err)
+	_, err = client.Complete(ctx, req())
+	require.NoError(t, err)
+
+	require.Len(t, rec.events, 2)
+	first := rec.events[0]
+	assert.NotEmpty(t, first.ID)
+	assert.Equal(t, "inv-42.pdf", first.DocumentID)
+	assert.Equal(t, "static", first.Provider)
+	assert.Equal(t, "m", first.Model)
+	assert.Equal(t, llm.InvoiceSchema.Name, first.Schema)
+	assert.Equal(t, 1, first.Images)
+	assert.Equal(t, 5, first.ImageBytes)
+	assert.Equal(t, []string{"5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5"}, first.ImageHashes)
+	assert.False(t, first.Cached)
+	assert.Empty(t, first.UserPrompt, "bodies are off by default")
+	assert.Empty(t, first.Response)
+
+	assert.True(t, rec.events[1].Cached)
+	assert.Equal(t, first.RequestHash, rec.events[1].RequestHash)
+	assert.NotEqual(t, first.ID, rec.events[1].ID)
+}
+
+func TestInterceptor_RedactedBodies(t *testing.T) {
+	rec := &eventRecorder{}
+	client := llm.NewClient("",
+		llm.WithProvider(staticProvider{content: `{"seller":{"phone":"0912 345 678"}}`}),
+		llm.WithInterceptor(rec),
+		llm.WithAuditBodies(llm.RedactBodies(llm.NewRedactor(llm.RedactPhones))),
+	)
+
+	_, err := client.Complete(context.Background(), &llm.Request{Model: "m", SystemPrompt: "sys", UserPrompt: "Điện thoại: 0912 345 678"})
+	require.NoError(t, err)
+
+	require.Len(t, rec.events, 1)
+	assert.Equal(t, "sys", rec.events[0].SystemPrompt)
+	assert.NotContains(t, rec.events[0].UserPrompt, "0912 345 678")
+	assert.Contains(t, rec.events[0].UserPrompt, "[PHONE_1]")
+	assert.NotContains(t, rec.events[0].Response, "0912 345 678")
+}
+
+func TestContextWithInterceptor(t *testing.T) {
+	clientRec, docRec := &eventRecorder{}, &eventRecorder{}
+	client := llm.NewClient("",
+		llm.WithProvider(staticProvider{content: `{"seller":{"phone":"0912 345 678"}}`}),
+		llm.WithInterceptor(clientRec),
+	)
+
+	ctx := llm.ContextWithInterceptor(context.Background(), docRec)
+	_, err := client.Complete(ctx, &llm.Request{Model: "m", SystemPrompt: "sys", UserPrompt: "Điện thoại: 0912 345 678"})
+	require.NoError(t, err)
+	_, err = client.Complete(context.Background(), &llm.Request{Model: "m"})
+	require.NoError(t, err)
+
+	require.Len(t, clientRec.events, 2)
+	assert.Empty(t, clientRec.events[0].UserPrompt, "client bodies stay off")
+	require.Len(t, docRec.events, 1, "only calls made with the context")
+	assert.Equal(t, "sys", docRec.events[0].SystemPrompt)
+	assert.Contains(t, docRec.events[0].UserPrompt, "0912 345 678")
+	assert.Contains(t, docRec.events[0].Response, "0912 345 678")
+	assert.Equal(t, clientRec.events[0].ID, docRec.events[0].ID)
+}
+
+func TestInterceptor_ErrorsAndStreams(t *testing.T) {
+	var buf bytes.Buffer
+	failing := llm.NewClient("", llm.WithProvider(failingProvider{err: errors.New("boom")}), llm.WithInterceptor(llm.NewJSONLAuditLog(&buf)))
+
+	_, err := failing.CompleteStream(context.Background(), &llm.Request{Model: "m"}, nil)
+	require.Error(t, err)
+
+	var event llm.AuditEvent
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+	assert.Equal(t, "boom", event.Error)
+	assert.True(t, event.Streamed)
+	assert.Equal(t, "failing", event.Provider)
+}
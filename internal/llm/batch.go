@@ -0,0 +1,275 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBatchUnsupported is returned when the provider has no batch API
+var ErrBatchUnsupported = errors.New("provider does not support batch requests")
+
+// DefaultBatchPollInterval is how often WaitBatch checks a job
+const DefaultBatchPollInterval = time.Minute
+
+// BatchItem is one request in a batch. CustomID correlates it with its result
+// and must be unique within the batch (Anthropic allows [a-zA-Z0-9_-]{1,64}).
+type BatchItem struct {
+	CustomID string
+	Request  *Request
+}
+
+// BatchStatus is the provider-neutral state of a batch job
+type BatchStatus string
+
+const (
+	BatchInProgress BatchStatus = "in_progress"
+	BatchCompleted  BatchStatus = "completed"
+	BatchFailed     BatchStatus = "failed"
+	BatchExpired    BatchStatus = "expired"
+	BatchCanceled   BatchStatus = "canceled"
+)
+
+// BatchJob tracks a submitted batch
+type BatchJob struct {
+	ID        string      `json:"id"`
+	Provider  string      `json:"provider"`
+	Status    BatchStatus `json:"status"`
+	Total     int         `json:"total"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	CustomIDs []string    `json:"custom_ids,omitempty"` // Recorded at submission
+}
+
+// Done reports whether the job has reached a final state
+func (j *BatchJob) Done() bool {
+	return j.Status != BatchInProgress
+}
+
+// BatchResult is the outcome of one batch item
+type BatchResult struct {
+	CustomID string
+	Response *Response
+	Err      error
+}
+
+// BatchProvider is implemented by providers with an asynchronous batch API
+type BatchProvider interface {
+	Provider
+	SubmitBatch(ctx context.Context, items []BatchItem) (*BatchJob, error)
+	GetBatch(ctx context.Context, id string) (*BatchJob, error)
+	BatchResults(ctx context.Context, id string) ([]BatchResult, error)
+}
+
+// BatchStore persists batch jobs so they can be tracked across restarts
+type BatchStore interface {
+	Save(ctx context.Context, job *BatchJob) error
+	Get(ctx context.Context, id string) (*BatchJob, error)
+	List(ctx context.Context) ([]*BatchJob, error)
+}
+
+// WithBatchStore records submitted batch jobs and their status updates
+func WithBatchStore(store BatchStore) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.batchStore = store
+	}
+}
+
+// SubmitBatch sends items to the provider's batch API, filling in client defaults
+func (c *Client) SubmitBatch(ctx context.Context, items []BatchItem) (*BatchJob, error) {
+	bp, ok := c.provider.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("batch has no items")
+	}
+
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.CustomID == "" || seen[item.CustomID] {
+			return nil, fmt.Errorf("batch custom IDs must be unique and non-empty: %q", item.CustomID)
+		}
+		seen[item.CustomID] = true
+
+		if item.Request.Model == "" {
+			item.Request.Model = c.defaultModel
+		}
+		if item.Request.MaxTokens == 0 {
+			item.Request.MaxTokens = DefaultMaxTokens
+		}
+		if c.promptCaching {
+			item.Request.CachePrompt = true
+		}
+	}
+
+	job, err := bp.SubmitBatch(ctx, items)
+	if err != nil {
+		return nil, fmt.Errorf("batch submission failed: %w", err)
+	}
+	for _, item := range items {
+		job.CustomIDs = append(job.CustomIDs, item.CustomID)
+	}
+
+	return job, c.saveBatch(ctx, job)
+}
+
+// GetBatch refreshes a job's status from the provider
+func (c *Client) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	bp, ok := c.provider.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+
+	job, err := bp.GetBatch(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("batch status failed: %w", err)
+	}
+
+	// Keep submission details the provider does not echo back
+	if c.batchStore != nil {
+		if stored, err := c.batchStore.Get(ctx, id); err == nil {
+			job.CustomIDs = stored.CustomIDs
+			if job.CreatedAt.IsZero() {
+				job.CreatedAt = stored.CreatedAt
+			}
+		}
+	}
+
+	return job, c.saveBatch(ctx, job)
+}
+
+// WaitBatch polls a job until it finishes or ctx is done (poll 0 = DefaultBatchPollInterval)
+func (c *Client) WaitBatch(ctx context.Context, id string, poll time.Duration) (*BatchJob, error) {
+	if poll <= 0 {
+		poll = DefaultBatchPollInterval
+	}
+
+	for {
+		job, err := c.GetBatch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		if err := sleep(ctx, poll); err != nil {
+			return job, err
+		}
+	}
+}
+
+// BatchResults downloads the results of a finished job
+func (c *Client) BatchResults(ctx context.Context, id string) ([]BatchResult, error) {
+	bp, ok := c.provider.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+
+	results, err := bp.BatchResults(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("batch results failed: %w", err)
+	}
+	return results, nil
+}
+
+// Batches lists jobs recorded in the batch store, newest first
+func (c *Client) Batches(ctx context.Context) ([]*BatchJob, error) {
+	if c.batchStore == nil {
+		return nil, fmt.Errorf("no batch store configured")
+	}
+	return c.batchStore.List(ctx)
+}
+
+func (c *Client) saveBatch(ctx context.Context, job *BatchJob) error {
+	if c.batchStore == nil {
+		return nil
+	}
+	job.UpdatedAt = time.Now()
+	if err := c.batchStore.Save(ctx, job); err != nil {
+		return fmt.Errorf("failed to record batch job: %w", err)
+	}
+	return nil
+}
+
+// FileBatchStore keeps one JSON file per batch job in a directory
+type FileBatchStore struct {
+	dir string
+}
+
+// NewFileBatchStore creates a batch store in dir, creating it if needed
+func NewFileBatchStore(dir string) (*FileBatchStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create batch store: %w", err)
+	}
+	return &FileBatchStore{dir: dir}, nil
+}
+
+func (s *FileBatchStore) path(id string) string {
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", "\\", "_").Replace(id)+".json")
+}
+
+// Save writes job atomically
+func (s *FileBatchStore) Save(_ context.Context, job *BatchJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".batch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(job.ID))
+}
+
+// Get reads a job by ID
+func (s *FileBatchStore) Get(_ context.Context, id string) (*BatchJob, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var job BatchJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("corrupt batch record %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// List returns all recorded jobs, newest first
+func (s *FileBatchStore) List(ctx context.Context) ([]*BatchJob, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*BatchJob
+	for _, path := range matches {
+		job, err := s.Get(ctx, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+
+	return jobs, nil
+}
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type anthropicBatchRequest struct {
+	CustomID string           `json:"custom_id"`
+	Params   anthropicRequest `json:"params"`
+}
+
+type anthropicBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"` // in_progress, canceling, ended
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResultsURL string    `json:"results_url"`
+}
+
+type anthropicBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string            `json:"type"` // succeeded, errored, canceled, expired
+		Message anthropicResponse `json:"message"`
+		Error   struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// SubmitBatch creates a Message Batch
+func (p *AnthropicProvider) SubmitBatch(ctx context.Context, items []BatchItem) (*BatchJob, error) {
+	requests := make([]anthropicBatchRequest, len(items))
+	for i, item := range items {
+		requests[i] = anthropicBatchRequest{CustomID: item.CustomID, Params: buildAnthropicRequest(item.Request)}
+	}
+
+	httpReq, _, err := newJSONRequest(ctx, p.baseURL+"/v1/messages/batches", map[string]any{"requests": requests})
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(httpReq)
+
+	var batch anthropicBatch
+	if err := doJSON(p.httpClient, httpReq, ProviderAnthropic, &batch); err != nil {
+		return nil, err
+	}
+	return batch.job(), nil
+}
+
+// GetBatch returns the current state of a Message Batch
+func (p *AnthropicProvider) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	batch, err := p.getBatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return batch.job(), nil
+}
+
+// BatchResults downloads the results of an ended Message Batch
+func (p *AnthropicProvider) BatchResults(ctx context.Context, id string) ([]BatchResult, error) {
+	batch, err := p.getBatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if batch.ResultsURL == "" {
+		return nil, fmt.Errorf("batch %s has no results yet (status %s)", id, batch.ProcessingStatus)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, batch.ResultsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	p.setHeaders(httpReq)
+
+	body, err := doStream(p.httpClient, httpReq, ProviderAnthropic)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return readAnthropicBatchResults(body)
+}
+
+func (p *AnthropicProvider) getBatch(ctx context.Context, id string) (*anthropicBatch, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/messages/batches/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	p.setHeaders(httpReq)
+
+	var batch anthropicBatch
+	if err := doJSON(p.httpClient, httpReq, ProviderAnthropic, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// readAnthropicBatchResults parses the JSONL results of a Message Batch
+func readAnthropicBatchResults(r io.Reader) ([]BatchResult, error) {
+	var results []BatchResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line anthropicBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to decode batch result: %w", err)
+		}
+
+		result := BatchResult{CustomID: line.CustomID}
+		switch line.Result.Type {
+		case "succeeded":
+			result.Response = line.Result.Message.toResponse()
+		case "errored":
+			result.Err = fmt.Errorf("%s: %s", line.Result.Error.Error.Type, line.Result.Error.Error.Message)
+		default:
+			result.Err = fmt.Errorf("batch item %s", line.Result.Type)
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch results: %w", err)
+	}
+
+	return results, nil
+}
+
+func (b *anthropicBatch) job() *BatchJob {
+	counts := b.RequestCounts
+	job := &BatchJob{
+		ID:        b.ID,
+		Provider:  ProviderAnthropic,
+		Status:    BatchInProgress,
+		Total:     counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired,
+		Succeeded: counts.Succeeded,
+		Failed:    counts.Errored + counts.Canceled + counts.Expired,
+		CreatedAt: b.CreatedAt,
+	}
+	if b.ProcessingStatus == "ended" {
+		job.Status = BatchCompleted
+	}
+	return job
+}
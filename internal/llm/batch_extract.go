@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// BatchDocument is one document for batch extraction. Text documents use the
+// OCR prompt; image documents are auto-classified like ExtractAuto.
+type BatchDocument struct {
+	ID     string // Correlates the document with its BatchInvoice
+	Text   string
+	Images []Image
+}
+
+// BatchInvoice is the extraction result for one BatchDocument
+type BatchInvoice struct {
+	ID      string
+	Invoice *model.Invoice
+	Err     error
+}
+
+// BatchItems builds the batch requests for docs. Fallback models, self-consistency,
+// field recovery and redaction do not apply to batches.
+func (e *Extractor) BatchItems(ctx context.Context, docs []BatchDocument) ([]BatchItem, error) {
+	items := make([]BatchItem, 0, len(docs))
+	for _, doc := range docs {
+		req := &Request{Temperature: DefaultTemperature}
+		switch {
+		case len(doc.Images) > 0:
+			req.Model = e.visionModels(ctx)[0]
+			req.SystemPrompt = e.promptSet(ctx).SystemReceipt
+			schema, prompt := e.grounding(AutoDetectSchema, imagePrompt(e.promptSet(ctx).AutoDetect, doc.Images), doc.Images)
+			req.UserPrompt = e.withExamples(ctx, "", prompt)
+			req.Images = e.fitImages(doc.Images, req.Model)
+			if e.structuredOutput {
+				req.Schema = schema
+			}
+		case doc.Text != "":
+			req.Model = e.textModels(ctx)[0]
+			req.SystemPrompt = e.promptSet(ctx).SystemInvoice
+			req.UserPrompt = e.withExamples(ctx, doc.Text, fmt.Sprintf(e.promptSet(ctx).OCR, doc.Text))
+			if e.structuredOutput {
+				req.Schema = InvoiceSchema
+			}
+		default:
+			return nil, fmt.Errorf("batch document %q has no text or images", doc.ID)
+		}
+
+		e.generationParams(ctx, req.Model).apply(req)
+
+		items = append(items, BatchItem{CustomID: doc.ID, Request: req})
+	}
+
+	return items, nil
+}
+
+// SubmitBatch submits docs to the provider's batch API
+func (e *Extractor) SubmitBatch(ctx context.Context, docs []BatchDocument) (*BatchJob, error) {
+	items, err := e.BatchItems(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.SubmitBatch(ctx, items)
+}
+
+// BatchInvoices downloads a finished job's results and converts them to invoices
+func (e *Extractor) BatchInvoices(ctx context.Context, jobID string) ([]BatchInvoice, error) {
+	results, err := e.client.BatchResults(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := make([]BatchInvoice, len(results))
+	for i, result := range results {
+		invoices[i] = BatchInvoice{ID: result.CustomID, Err: result.Err}
+		if result.Err == nil {
+			invoices[i].Invoice, invoices[i].Err = e.batchInvoice(result.Response)
+		}
+	}
+
+	return invoices, nil
+}
+
+func (e *Extractor) batchInvoice(resp *Response) (*model.Invoice, error) {
+	llmResp, err := decodeResponse(resp.Content)
+	if err != nil {
+		return nil, err
+	}
+	// Text results have no document_type and default to invoice
+	if err := normalizeDocumentType(llmResp); err != nil {
+		return nil, err
+	}
+	return e.convertToInvoice(llmResp)
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+type openAIBatchLine struct {
+	CustomID string `json:"custom_id"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Body     any    `json:"body"`
+}
+
+type openAIBatchOutput struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatch uploads items as a JSONL file and creates a 24h chat completions batch
+func (p *OpenAIProvider) SubmitBatch(ctx context.Context, items []BatchItem) (*BatchJob, error) {
+	// Azure batches need global deployments addressed differently; not supported here
+	if p.requestOptions != nil {
+		return nil, ErrBatchUnsupported
+	}
+
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for _, item := range items {
+		_, params, _ := p.buildParams(item.Request)
+		if err := enc.Encode(openAIBatchLine{
+			CustomID: item.CustomID,
+			Method:   "POST",
+			URL:      "/v1/chat/completions",
+			Body:     params,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to encode batch item %s: %w", item.CustomID, err)
+		}
+	}
+
+	file, err := p.client.Files.New(ctx, openai.FileNewParams{
+		File:    openai.File(&input, "batch.jsonl", "application/jsonl"),
+		Purpose: openai.FilePurposeBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch input upload failed: %w", err)
+	}
+
+	batch, err := p.client.Batches.New(ctx, openai.BatchNewParams{
+		CompletionWindow: openai.BatchNewParamsCompletionWindow24h,
+		Endpoint:         openai.BatchNewParamsEndpointV1ChatCompletions,
+		InputFileID:      file.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.batchJob(batch), nil
+}
+
+// GetBatch returns the current state of a batch
+func (p *OpenAIProvider) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	batch, err := p.client.Batches.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return p.batchJob(batch), nil
+}
+
+// BatchResults reads the output and error files of a finished batch
+func (p *OpenAIProvider) BatchResults(ctx context.Context, id string) ([]BatchResult, error) {
+	batch, err := p.client.Batches.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		fileResults, err := p.readBatchFile(ctx, fileID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, fileResults...)
+	}
+
+	return results, nil
+}
+
+func (p *OpenAIProvider) readBatchFile(ctx context.Context, fileID string) ([]BatchResult, error) {
+	resp, err := p.client.Files.Content(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("batch file download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return readOpenAIBatchOutput(resp.Body)
+}
+
+// readOpenAIBatchOutput parses a batch output or error file
+func readOpenAIBatchOutput(r io.Reader) ([]BatchResult, error) {
+	var results []BatchResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line openAIBatchOutput
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to decode batch output: %w", err)
+		}
+
+		result := BatchResult{CustomID: line.CustomID}
+		switch {
+		case line.Error != nil:
+			result.Err = fmt.Errorf("%s: %s", line.Error.Code, line.Error.Message)
+		case line.Response == nil:
+			result.Err = fmt.Errorf("batch item has no response")
+		case line.Response.StatusCode < 200 || line.Response.StatusCode >= 300:
+			result.Err = &APIError{Provider: ProviderOpenAI, StatusCode: line.Response.StatusCode, Body: string(line.Response.Body)}
+		default:
+			var completion openai.ChatCompletion
+			if err := json.Unmarshal(line.Response.Body, &completion); err != nil {
+				result.Err = fmt.Errorf("failed to decode batch response: %w", err)
+			} else {
+				result.Response, result.Err = chatCompletionResponse(&completion)
+			}
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch output: %w", err)
+	}
+
+	return results, nil
+}
+
+func (p *OpenAIProvider) batchJob(batch *openai.Batch) *BatchJob {
+	job := &BatchJob{
+		ID:        batch.ID,
+		Provider:  p.name,
+		Total:     int(batch.RequestCounts.Total),
+		Succeeded: int(batch.RequestCounts.Completed),
+		Failed:    int(batch.RequestCounts.Failed),
+		CreatedAt: time.Unix(batch.CreatedAt, 0),
+	}
+
+	switch batch.Status {
+	case openai.BatchStatusCompleted:
+		job.Status = BatchCompleted
+	case openai.BatchStatusFailed:
+		job.Status = BatchFailed
+	case openai.BatchStatusExpired:
+		job.Status = BatchExpired
+	case openai.BatchStatusCancelled:
+		job.Status = BatchCanceled
+	default:
+		job.Status = BatchInProgress
+	}
+
+	return job
+}
@@ -0,0 +1,202 @@
+package llm_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+const batchInvoiceJSON = `{"invoice_number":"0000123","date":"2024-03-15","seller":{"name":"ACME","tax_id":"0123456789"},"total_amount":1100000,"currency":"VND"}`
+
+func TestAnthropicBatch_SubmitAndCorrelate(t *testing.T) {
+	var srv *httptest.Server
+	var submitted struct {
+		Requests []struct {
+			CustomID string `json:"custom_id"`
+			Params   struct {
+				Model    string `json:"model"`
+				Messages []struct {
+					Content []struct {
+						Type string `json:"type"`
+					} `json:"content"`
+				} `json:"messages"`
+			} `json:"params"`
+		} `json:"requests"`
+	}
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/messages/batches":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&submitted))
+			w.Write([]byte(`{"id":"msgbatch_1","processing_status":"in_progress","request_counts":{"processing":2},"created_at":"2024-03-15T10:00:00Z"}`))
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1":
+			w.Write([]byte(`{"id":"msgbatch_1","processing_status":"ended","request_counts":{"succeeded":1,"errored":1},"results_url":"` + srv.URL + `/results"}`))
+		case r.URL.Path == "/results":
+			w.Write([]byte(`{"custom_id":"img-1","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"bad image"}}}}` + "\n"))
+			w.Write([]byte(`{"custom_id":"txt-1","result":{"type":"succeeded","message":{"model":"claude","content":[{"type":"tool_use","name":"extract_invoice","input":` + batchInvoiceJSON + `}]}}}` + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	store, err := llm.NewFileBatchStore(t.TempDir())
+	require.NoError(t, err)
+
+	provider := llm.NewAnthropicProvider(llm.AnthropicConfig{APIKey: "key", BaseURL: srv.URL})
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithBatchStore(store))
+	extractor := llm.NewExtractor(client, llm.WithTextModel("claude-text"), llm.WithVisionModel("claude-vision"))
+
+	ctx := context.Background()
+	job, err := extractor.SubmitBatch(ctx, []llm.BatchDocument{
+		{ID: "txt-1", Text: "HOA DON GTGT"},
+		{ID: "img-1", Images: []llm.Image{{Data: []byte("png"), MimeType: "image/png"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "msgbatch_1", job.ID)
+	assert.Equal(t, llm.BatchInProgress, job.Status)
+	assert.Equal(t, []string{"txt-1", "img-1"}, job.CustomIDs)
+
+	require.Len(t, submitted.Requests, 2)
+	assert.Equal(t, "claude-text", submitted.Requests[0].Params.Model)
+	assert.Equal(t, "claude-vision", submitted.Requests[1].Params.Model)
+	assert.Equal(t, "image", submitted.Requests[1].Params.Messages[0].Content[0].Type)
+
+	job, err = client.WaitBatch(ctx, "msgbatch_1", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, llm.BatchCompleted, job.Status)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, []string{"txt-1", "img-1"}, job.CustomIDs, "submission details kept from the store")
+	assert.Equal(t, 2024, job.CreatedAt.Year())
+
+	invoices, err := extractor.BatchInvoices(ctx, "msgbatch_1")
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+
+	byID := map[string]llm.BatchInvoice{}
+	for _, inv := range invoices {
+		byID[inv.ID] = inv
+	}
+	assert.ErrorContains(t, byID["img-1"].Err, "bad image")
+	require.NoError(t, byID["txt-1"].Err)
+	assert.Equal(t, "0000123", byID["txt-1"].Invoice.Number)
+	assert.Equal(t, model.DocumentTypeInvoice, byID["txt-1"].Invoice.DocumentType)
+}
+
+func TestOpenAIBatch_SubmitAndCorrelate(t *testing.T) {
+	var input string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/files":
+			file, _, err := r.FormFile("file")
+			if assert.NoError(t, err) {
+				data, _ := io.ReadAll(file)
+				input = string(data)
+			}
+			assert.Equal(t, "batch", r.FormValue("purpose"))
+			w.Write([]byte(`{"id":"file-in","object":"file","purpose":"batch"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/batches":
+			w.Write([]byte(`{"id":"batch_1","object":"batch","status":"validating","created_at":1710496800,"request_counts":{"total":1}}`))
+		case r.URL.Path == "/batches/batch_1":
+			w.Write([]byte(`{"id":"batch_1","object":"batch","status":"completed","output_file_id":"file-out","request_counts":{"total":1,"completed":1}}`))
+		case r.URL.Path == "/files/file-out/content":
+			content, _ := json.Marshal(batchInvoiceJSON)
+			body := `{"id":"c1","object":"chat.completion","model":"gpt","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":` + string(content) + `}}]}`
+			w.Write([]byte(`{"custom_id":"doc-1","response":{"status_code":200,"body":` + body + `}}` + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	provider := llm.NewOpenAIProvider(llm.OpenAIConfig{APIKey: "key", BaseURL: srv.URL})
+	client := llm.NewClient("", llm.WithProvider(provider))
+	extractor := llm.NewExtractor(client, llm.WithModel("gpt"))
+
+	ctx := context.Background()
+	job, err := extractor.SubmitBatch(ctx, []llm.BatchDocument{{ID: "doc-1", Text: "HOA DON"}})
+	require.NoError(t, err)
+	assert.Equal(t, "batch_1", job.ID)
+	assert.False(t, job.Done())
+
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	require.True(t, scanner.Scan())
+	var line struct {
+		CustomID string `json:"custom_id"`
+		URL      string `json:"url"`
+		Body     struct {
+			Model string `json:"model"`
+		} `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+	assert.Equal(t, "doc-1", line.CustomID)
+	assert.Equal(t, "/v1/chat/completions", line.URL)
+	assert.Equal(t, "gpt", line.Body.Model)
+
+	job, err = client.GetBatch(ctx, "batch_1")
+	require.NoError(t, err)
+	assert.Equal(t, llm.BatchCompleted, job.Status)
+	assert.Equal(t, 1, job.Succeeded)
+
+	invoices, err := extractor.BatchInvoices(ctx, "batch_1")
+	require.NoError(t, err)
+	require.Len(t, invoices, 1)
+	require.NoError(t, invoices[0].Err)
+	assert.Equal(t, "doc-1", invoices[0].ID)
+	assert.Equal(t, "0123456789", invoices[0].Invoice.Seller.TaxID)
+}
+
+func TestClientSubmitBatch_Validation(t *testing.T) {
+	ctx := context.Background()
+	anthropic := llm.NewClient("", llm.WithProvider(llm.NewAnthropicProvider(llm.AnthropicConfig{BaseURL: "http://127.0.0.1:0"})))
+
+	_, err := anthropic.SubmitBatch(ctx, nil)
+	assert.Error(t, err)
+
+	_, err = anthropic.SubmitBatch(ctx, []llm.BatchItem{
+		{CustomID: "a", Request: &llm.Request{}},
+		{CustomID: "a", Request: &llm.Request{}},
+	})
+	assert.ErrorContains(t, err, "unique")
+
+	ollama := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{})))
+	_, err = ollama.SubmitBatch(ctx, []llm.BatchItem{{CustomID: "a", Request: &llm.Request{}}})
+	assert.ErrorIs(t, err, llm.ErrBatchUnsupported)
+}
+
+func TestFileBatchStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := llm.NewFileBatchStore(t.TempDir())
+	require.NoError(t, err)
+
+	older := &llm.BatchJob{ID: "b1", Status: llm.BatchCompleted, CreatedAt: time.Now().Add(-time.Hour)}
+	newer := &llm.BatchJob{ID: "b2", Status: llm.BatchInProgress, CreatedAt: time.Now(), CustomIDs: []string{"x"}}
+	require.NoError(t, store.Save(ctx, older))
+	require.NoError(t, store.Save(ctx, newer))
+
+	got, err := store.Get(ctx, "b2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x"}, got.CustomIDs)
+
+	jobs, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "b2", jobs[0].ID)
+
+	_, err = store.Get(ctx, "missing")
+	assert.Error(t, err)
+}
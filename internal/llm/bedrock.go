@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// BedrockConfig configures an AWS Bedrock provider.
+// Empty credentials and region are read from the standard AWS environment variables.
+type BedrockConfig struct {
+	Region      string
+	Credentials sigv4.Credentials
+	BaseURL     string // Default: https://bedrock-runtime.<region>.amazonaws.com
+	Timeout     time.Duration
+	HTTP        HTTPOptions
+}
+
+// BedrockProvider calls the Bedrock Converse API
+type BedrockProvider struct {
+	baseURL    string
+	signer     *sigv4.Signer
+	httpClient *http.Client
+}
+
+// NewBedrockProvider creates an AWS Bedrock provider
+func NewBedrockProvider(cfg BedrockConfig) *BedrockProvider {
+	if cfg.Region == "" {
+		cfg.Region = sigv4.RegionFromEnv()
+	}
+	if cfg.Credentials.AccessKeyID == "" {
+		cfg.Credentials = sigv4.CredentialsFromEnv()
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", cfg.Region)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &BedrockProvider{
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		signer:     sigv4.NewSigner(cfg.Credentials, cfg.Region, "bedrock"),
+		httpClient: cfg.HTTP.httpClient(cfg.Timeout),
+	}
+}
+
+type bedrockImageSource struct {
+	Bytes string `json:"bytes"`
+}
+
+type bedrockImage struct {
+	Format string             `json:"format"`
+	Source bedrockImageSource `json:"source"`
+}
+
+type bedrockContent struct {
+	Text       string             `json:"text,omitempty"`
+	Image      *bedrockImage      `json:"image,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	CachePoint *bedrockCachePoint `json:"cachePoint,omitempty"`
+}
+
+// bedrockCachePoint ends a cacheable prompt prefix
+type bedrockCachePoint struct {
+	Type string `json:"type"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type bedrockToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema struct {
+		JSON map[string]any `json:"json"`
+	} `json:"inputSchema"`
+}
+
+type bedrockTool struct {
+	ToolSpec bedrockToolSpec `json:"toolSpec"`
+}
+
+type bedrockToolChoice struct {
+	Tool struct {
+		Name string `json:"name"`
+	} `json:"tool"`
+}
+
+type bedrockToolConfig struct {
+	Tools      []bedrockTool     `json:"tools"`
+	ToolChoice bedrockToolChoice `json:"toolChoice"`
+}
+
+type bedrockMessage struct {
+	Role    string           `json:"role"`
+	Content []bedrockContent `json:"content"`
+}
+
+type bedrockInferenceConfig struct {
+	MaxTokens   int64   `json:"maxTokens,omitempty"`
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"topP,omitempty"`
+}
+
+type bedrockRequest struct {
+	System          []bedrockContent       `json:"system,omitempty"`
+	Messages        []bedrockMessage       `json:"messages"`
+	InferenceConfig bedrockInferenceConfig `json:"inferenceConfig"`
+	ToolConfig      *bedrockToolConfig     `json:"toolConfig,omitempty"`
+}
+
+type bedrockResponse struct {
+	Output struct {
+		Message bedrockMessage `json:"message"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens           int64 `json:"inputTokens"`
+		OutputTokens          int64 `json:"outputTokens"`
+		CacheReadInputTokens  int64 `json:"cacheReadInputTokens"`
+		CacheWriteInputTokens int64 `json:"cacheWriteInputTokens"`
+	} `json:"usage"`
+}
+
+// Name returns the provider name
+func (p *BedrockProvider) Name() string {
+	return ProviderBedrock
+}
+
+// Complete sends a Converse request signed with SigV4
+func (p *BedrockProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	content := []bedrockContent{{Text: req.UserPrompt}}
+	for _, img := range req.Images {
+		content = append(content, bedrockContent{Image: &bedrockImage{
+			Format: bedrockImageFormat(img.MimeType),
+			Source: bedrockImageSource{Bytes: base64.StdEncoding.EncodeToString(img.Data)},
+		}})
+	}
+
+	payload := bedrockRequest{
+		Messages: []bedrockMessage{{Role: "user", Content: content}},
+		InferenceConfig: bedrockInferenceConfig{
+			MaxTokens:   req.MaxTokens,
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+		},
+	}
+	if req.SystemPrompt != "" {
+		payload.System = []bedrockContent{{Text: req.SystemPrompt}}
+		if req.CachePrompt {
+			payload.System = append(payload.System, bedrockContent{CachePoint: &bedrockCachePoint{Type: "default"}})
+		}
+	}
+	if req.Schema != nil {
+		// Force the model to answer through a tool whose input is the schema
+		spec := bedrockToolSpec{Name: req.Schema.Name, Description: req.Schema.Description}
+		spec.InputSchema.JSON = req.Schema.Schema
+		cfg := &bedrockToolConfig{Tools: []bedrockTool{{ToolSpec: spec}}}
+		cfg.ToolChoice.Tool.Name = req.Schema.Name
+		payload.ToolConfig = cfg
+	}
+
+	// Model IDs contain ':' which Bedrock expects percent-encoded
+	modelID := strings.ReplaceAll(url.PathEscape(req.Model), ":", "%3A")
+	httpReq, body, err := newJSONRequest(ctx, fmt.Sprintf("%s/model/%s/converse", p.baseURL, modelID), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.signer.Sign(httpReq, body); err != nil {
+		return nil, fmt.Errorf("failed to sign bedrock request: %w", err)
+	}
+
+	var resp bedrockResponse
+	if err := doJSON(p.httpClient, httpReq, ProviderBedrock, &resp); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, c := range resp.Output.Message.Content {
+		if c.ToolUse != nil {
+			text.Reset()
+			text.Write(c.ToolUse.Input)
+			break
+		}
+		text.WriteString(c.Text)
+	}
+
+	return &Response{
+		Content: text.String(),
+		Model:   req.Model,
+		Usage: Usage{
+			// inputTokens excludes tokens read from or written to the prompt cache
+			PromptTokens:       resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.CacheWriteInputTokens,
+			CompletionTokens:   resp.Usage.OutputTokens,
+			CachedPromptTokens: resp.Usage.CacheReadInputTokens,
+		},
+	}, nil
+}
+
+func bedrockImageFormat(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	default:
+		return "jpeg"
+	}
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the provider while a model's
+// circuit breaker is open. It is not retryable, so the Extractor moves on to
+// its fallback models, or fails fast when there are none.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker configures when calls to a model stop being sent
+type CircuitBreaker struct {
+	FailureThreshold int           // Consecutive transient failures that open the circuit
+	Cooldown         time.Duration // Time the circuit stays open before one trial call is let through
+}
+
+// DefaultCircuitBreaker opens after 5 consecutive failures for 30 seconds
+var DefaultCircuitBreaker = CircuitBreaker{FailureThreshold: 5, Cooldown: 30 * time.Second}
+
+// WithCircuitBreaker stops calling a model of the provider after
+// cfg.FailureThreshold consecutive transient failures (5xx, 429, timeouts) and
+// fails its calls with ErrCircuitOpen until cfg.Cooldown has passed. A trial
+// call is then let through: success closes the circuit, failure reopens it.
+// Client errors such as 400 or 401 do not count.
+func WithCircuitBreaker(cfg CircuitBreaker) ClientOption {
+	return func(c *clientConfig) {
+		if cfg.FailureThreshold <= 0 {
+			cfg.FailureThreshold = DefaultCircuitBreaker.FailureThreshold
+		}
+		if cfg.Cooldown <= 0 {
+			cfg.Cooldown = DefaultCircuitBreaker.Cooldown
+		}
+		c.breaker = &cfg
+	}
+}
+
+// circuit tracks the failures of one model
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	trial     bool // A trial call is in flight after the cooldown
+}
+
+// breakers holds a circuit per model
+type breakers struct {
+	cfg CircuitBreaker
+
+	mu      sync.Mutex
+	byModel map[string]*circuit
+}
+
+func newBreakers(cfg *CircuitBreaker) *breakers {
+	if cfg == nil {
+		return nil
+	}
+	return &breakers{cfg: *cfg, byModel: make(map[string]*circuit)}
+}
+
+// allow reports whether a call to model may be sent, and if not, when the
+// circuit will let a trial call through
+func (b *breakers) allow(model string) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.byModel[model]
+	if !ok || c.openUntil.IsZero() {
+		return true, time.Time{}
+	}
+	if time.Now().Before(c.openUntil) || c.trial {
+		return false, c.openUntil
+	}
+	c.trial = true
+	return true, time.Time{}
+}
+
+// done records the result of a call to model
+func (b *breakers) done(model string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.byModel[model]
+	if !ok {
+		c = &circuit{}
+		b.byModel[model] = c
+	}
+	c.trial = false
+	if !failed {
+		c.failures = 0
+		c.openUntil = time.Time{}
+		return
+	}
+
+	c.failures++
+	if c.failures >= b.cfg.FailureThreshold || !c.openUntil.IsZero() {
+		c.openUntil = time.Now().Add(b.cfg.Cooldown)
+	}
+}
+
+// release ends a trial call without recording a result
+func (b *breakers) release(model string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.byModel[model]; ok {
+		c.trial = false
+	}
+}
+
+// guarded runs call unless the circuit of req.Model is open
+func (c *Client) guarded(ctx context.Context, req *Request, call func() (*Response, error)) (*Response, error) {
+	if c.breakers == nil {
+		return call()
+	}
+
+	if ok, until := c.breakers.allow(req.Model); !ok {
+		return nil, fmt.Errorf("%s %s: %w (retry after %s)", c.provider.Name(), req.Model, ErrCircuitOpen, until.Format(time.RFC3339))
+	}
+
+	resp, err := call()
+	// Cancellation by the caller says nothing about the provider
+	if err != nil && ctx.Err() != nil {
+		c.breakers.release(req.Model)
+		return resp, err
+	}
+	c.breakers.done(req.Model, err != nil && IsRetryable(err))
+	return resp, err
+}
@@ -0,0 +1,90 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestCircuitBreaker_RoutesToFallback(t *testing.T) {
+	srv, models := ollamaServer(t, func(model string, _ int) int {
+		if model == "primary" {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithCircuitBreaker(llm.CircuitBreaker{FailureThreshold: 2, Cooldown: time.Minute}),
+	)
+	extractor := llm.NewExtractor(client,
+		llm.WithModel("primary"),
+		llm.WithFallbackModels("backup"),
+		llm.WithRetryPolicy(fastRetry),
+	)
+
+	for range 2 {
+		inv, err := extractor.ExtractFromText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, "42", inv.Number)
+	}
+
+	// The circuit opens on the second failure; later calls skip primary
+	assert.Equal(t, []string{"primary", "primary", "backup", "backup"}, *models)
+}
+
+func TestCircuitBreaker_FailsFastAndRecovers(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	srv, models := ollamaServer(t, func(string, int) int {
+		if down.Load() {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithCircuitBreaker(llm.CircuitBreaker{FailureThreshold: 1, Cooldown: 20 * time.Millisecond}),
+	)
+	req := func() *llm.Request { return &llm.Request{Model: "m", UserPrompt: "hi"} }
+
+	_, err := client.Complete(context.Background(), req())
+	require.Error(t, err)
+	_, err = client.Complete(context.Background(), req())
+	require.ErrorIs(t, err, llm.ErrCircuitOpen)
+	assert.False(t, llm.IsRetryable(err))
+	assert.Len(t, *models, 1, "open circuit does not call the provider")
+
+	// After the cooldown a trial call goes through and closes the circuit
+	down.Store(false)
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.Complete(context.Background(), req())
+	require.NoError(t, err)
+	_, err = client.Complete(context.Background(), req())
+	require.NoError(t, err)
+	assert.Len(t, *models, 3)
+}
+
+func TestCircuitBreaker_IgnoresClientErrors(t *testing.T) {
+	srv, models := ollamaServer(t, func(string, int) int { return http.StatusBadRequest })
+
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithCircuitBreaker(llm.CircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute}),
+	)
+	for range 3 {
+		_, err := client.Complete(context.Background(), &llm.Request{Model: "m", UserPrompt: "hi"})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, llm.ErrCircuitOpen)
+	}
+	assert.Len(t, *models, 3)
+}
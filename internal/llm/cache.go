@@ -0,0 +1,236 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache stores serialized LLM responses by key.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheKey returns the cache key for a request sent to the named provider.
+// It covers everything that influences the answer: model, prompts, images,
+// schema and generation parameters.
+func CacheKey(provider string, req *Request) string {
+	h := sha256.New()
+	write := func(s string) {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+
+	write(provider)
+	write(req.Model)
+	write(req.SystemPrompt)
+	write(req.UserPrompt)
+	for _, img := range req.Images {
+		write(img.MimeType)
+		sum := sha256.Sum256(img.Data)
+		h.Write(sum[:])
+	}
+	if req.Schema != nil {
+		schema, _ := json.Marshal(req.Schema)
+		h.Write(schema)
+	}
+	fmt.Fprintf(h, "|%d|%g", req.MaxTokens, req.Temperature)
+	if req.TopP > 0 {
+		fmt.Fprintf(h, "|p%g", req.TopP)
+	}
+	if req.Sample > 0 {
+		fmt.Fprintf(h, "|%d", req.Sample)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryCache is an in-process LRU cache
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // Front is most recently used
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates an in-memory cache holding at most maxEntries responses (0 = unbounded)
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns a cached value
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set stores a value, evicting the least recently used entry when full
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
+
+// DiskCache stores responses as files in a directory, surviving restarts
+type DiskCache struct {
+	dir string
+}
+
+type diskEntry struct {
+	Expires time.Time `json:"expires,omitzero"`
+	Value   []byte    `json:"value"`
+}
+
+// NewDiskCache creates a disk cache rooted at dir, creating it if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get returns a cached value
+func (c *DiskCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// Corrupt entries are treated as misses and overwritten on the next Set
+		return nil, false, nil
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		os.Remove(c.path(key))
+		return nil, false, nil
+	}
+
+	return entry.Value, true, nil
+}
+
+// Set stores a value; the write is atomic so concurrent readers never see partial files
+func (c *DiskCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := diskEntry{Value: value}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// path shards entries by key prefix to keep directories small
+func (c *DiskCache) path(key string) string {
+	if len(key) > 2 {
+		return filepath.Join(c.dir, key[:2], key+".json")
+	}
+	return filepath.Join(c.dir, key+".json")
+}
+
+// cachedComplete serves req from the cache when possible, storing fresh responses.
+// Cache failures never fail the request.
+func (c *Client) cachedComplete(ctx context.Context, req *Request, complete func() (*Response, error)) (*Response, error) {
+	if c.cache == nil {
+		return complete()
+	}
+
+	key := CacheKey(c.provider.Name(), req)
+	if data, ok, err := c.cache.Get(ctx, key); err == nil && ok {
+		var resp Response
+		if json.Unmarshal(data, &resp) == nil {
+			resp.Cached = true
+			return &resp, nil
+		}
+	}
+
+	resp, err := complete()
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(resp); err == nil {
+		_ = c.cache.Set(ctx, key, data, c.cacheTTL)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache shares cached responses between processes through Redis
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache creates a Redis-backed cache; keys are stored under prefix
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// Get returns a cached value
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set stores a value with the given expiry (0 = no expiry)
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
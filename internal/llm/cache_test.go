@@ -0,0 +1,83 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := llm.NewMemoryCache(2)
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, cache.Set(ctx, "b", []byte("2"), 0))
+	_, _, _ = cache.Get(ctx, "a") // a becomes most recently used
+	require.NoError(t, cache.Set(ctx, "c", []byte("3"), 0))
+
+	_, ok, _ := cache.Get(ctx, "b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	value, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	require.NoError(t, cache.Set(ctx, "short", []byte("x"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, ok, _ = cache.Get(ctx, "short")
+	assert.False(t, ok, "expired entry should miss")
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := llm.NewDiskCache(t.TempDir())
+	require.NoError(t, err)
+
+	_, ok, err := cache.Get(ctx, "abcdef")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "abcdef", []byte(`{"Content":"x"}`), time.Hour))
+	value, ok, err := cache.Get(ctx, "abcdef")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `{"Content":"x"}`, string(value))
+}
+
+func TestCacheKey(t *testing.T) {
+	base := &llm.Request{Model: "m", UserPrompt: "p", Images: []llm.Image{{Data: []byte{1}, MimeType: "image/png"}}}
+	otherImage := &llm.Request{Model: "m", UserPrompt: "p", Images: []llm.Image{{Data: []byte{2}, MimeType: "image/png"}}}
+	withSchema := &llm.Request{Model: "m", UserPrompt: "p", Images: base.Images, Schema: llm.InvoiceSchema}
+
+	assert.Equal(t, llm.CacheKey("openai", base), llm.CacheKey("openai", base))
+	assert.NotEqual(t, llm.CacheKey("openai", base), llm.CacheKey("gemini", base))
+	assert.NotEqual(t, llm.CacheKey("openai", base), llm.CacheKey("openai", otherImage))
+	assert.NotEqual(t, llm.CacheKey("openai", base), llm.CacheKey("openai", withSchema))
+}
+
+func TestClient_WithCache(t *testing.T) {
+	srv, models := ollamaServer(t, func(string, int) int { return http.StatusOK })
+
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithCache(llm.NewMemoryCache(0), 0),
+	)
+	extractor := llm.NewExtractor(client, llm.WithModel("m"))
+
+	for range 2 {
+		inv, err := extractor.ExtractFromText(context.Background(), "same document")
+		require.NoError(t, err)
+		assert.Equal(t, "42", inv.Number)
+	}
+	assert.Len(t, *models, 1, "second extraction should be served from cache")
+
+	resp, err := client.CompleteStream(context.Background(), &llm.Request{Model: "m", UserPrompt: "other"}, nil)
+	require.NoError(t, err)
+	assert.False(t, resp.Cached)
+	assert.Len(t, *models, 2)
+}
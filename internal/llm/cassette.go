@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrCassetteMiss is returned when a replayed cassette holds no recording for a request
+var ErrCassetteMiss = errors.New("no recorded response in cassette")
+
+// CassetteMode selects whether a Cassette calls the real provider
+type CassetteMode int
+
+const (
+	// CassetteReplay serves recorded responses only and never calls a provider;
+	// unknown requests fail with ErrCassetteMiss
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord calls the real provider and records every response
+	CassetteRecord
+	// CassetteReplayOrRecord serves recorded responses and records the missing ones
+	CassetteReplayOrRecord
+)
+
+// cassettePromptPreview is how much of the user prompt is stored to keep
+// recordings reviewable in diffs
+const cassettePromptPreview = 200
+
+// Cassette records LLM calls to a JSON file and replays them, so pipelines can
+// be tested without network access or API keys. Requests are matched by
+// everything that influences the answer (see CacheKey): a changed prompt or
+// model needs a new recording. Safe for concurrent use.
+type Cassette struct {
+	path string
+	mode CassetteMode
+
+	mu           sync.Mutex
+	interactions map[string]cassetteInteraction
+}
+
+// cassetteFile is the on-disk format
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Key      string         `json:"key"`
+	Provider string         `json:"provider"`
+	Model    string         `json:"model"`
+	Prompt   string         `json:"prompt,omitempty"` // Start of the user prompt, for reviewers
+	Response *Response      `json:"response,omitempty"`
+	Error    *cassetteError `json:"error,omitempty"`
+}
+
+type cassetteError struct {
+	StatusCode int    `json:"status_code,omitempty"` // Replayed as an *APIError when set
+	Message    string `json:"message"`
+}
+
+// NewCassette opens the cassette at path. A missing file starts an empty
+// cassette, which is an error in CassetteReplay mode.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{
+		path:         path,
+		mode:         mode,
+		interactions: make(map[string]cassetteInteraction),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode != CassetteReplay {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	for _, i := range file.Interactions {
+		c.interactions[i.Key] = i
+	}
+	return c, nil
+}
+
+// Len returns the number of recorded interactions
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.interactions)
+}
+
+// Provider returns a provider that answers from the cassette. upstream is
+// the real provider used for recording; it may be nil in CassetteReplay mode.
+func (c *Cassette) Provider(upstream Provider) Provider {
+	return &cassetteProvider{cassette: c, upstream: upstream}
+}
+
+type cassetteProvider struct {
+	cassette *Cassette
+	upstream Provider
+}
+
+// Name returns the upstream name, or when replaying without one the name of
+// the recorded provider, so the client picks the same default model as when
+// the cassette was recorded
+func (p *cassetteProvider) Name() string {
+	if p.upstream != nil {
+		return p.upstream.Name()
+	}
+	p.cassette.mu.Lock()
+	defer p.cassette.mu.Unlock()
+	for _, i := range p.cassette.interactions {
+		return i.Provider
+	}
+	return "cassette"
+}
+
+// Complete replays or records one request
+func (p *cassetteProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	c := p.cassette
+	key := CacheKey("", req)
+
+	if c.mode != CassetteRecord {
+		c.mu.Lock()
+		i, ok := c.interactions[key]
+		c.mu.Unlock()
+		if ok {
+			return i.replay()
+		}
+		if c.mode == CassetteReplay || p.upstream == nil {
+			return nil, fmt.Errorf("%w for model %s (record with CassetteReplayOrRecord)", ErrCassetteMiss, req.Model)
+		}
+	}
+	if p.upstream == nil {
+		return nil, fmt.Errorf("cassette recording requires an upstream provider")
+	}
+
+	resp, err := p.upstream.Complete(ctx, req)
+	// Cancellation is a property of the test run, not of the provider
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+
+	i := cassetteInteraction{
+		Key:      key,
+		Provider: p.upstream.Name(),
+		Model:    req.Model,
+		Prompt:   truncateRunes(req.UserPrompt, cassettePromptPreview),
+	}
+	if err != nil {
+		i.Error = &cassetteError{Message: err.Error()}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			i.Error.StatusCode = apiErr.StatusCode
+			i.Error.Message = apiErr.Body
+		}
+	} else {
+		recorded := *resp
+		recorded.Cached = false
+		i.Response = &recorded
+	}
+
+	if saveErr := c.record(i); saveErr != nil {
+		return nil, saveErr
+	}
+	return resp, err
+}
+
+// replay returns the recorded response or error
+func (i cassetteInteraction) replay() (*Response, error) {
+	if i.Error != nil {
+		if i.Error.StatusCode != 0 {
+			return nil, &APIError{Provider: i.Provider, StatusCode: i.Error.StatusCode, Body: i.Error.Message}
+		}
+		return nil, errors.New(i.Error.Message)
+	}
+	resp := *i.Response
+	return &resp, nil
+}
+
+// record adds an interaction and rewrites the cassette file
+func (c *Cassette) record(i cassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions[i.Key] = i
+
+	// Sorted by key so re-recording an unchanged run leaves the file unchanged
+	file := cassetteFile{Interactions: make([]cassetteInteraction, 0, len(c.interactions))}
+	for _, i := range c.interactions {
+		file.Interactions = append(file.Interactions, i)
+	}
+	sort.Slice(file.Interactions, func(a, b int) bool {
+		return file.Interactions[a].Key < file.Interactions[b].Key
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// truncateRunes returns the first n runes of s
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
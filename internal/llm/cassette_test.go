@@ -0,0 +1,76 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "invoice.json")
+
+	upstream := &recordingProvider{responses: []string{`{"invoice_number":"77","total_amount":1000}`}}
+	cassette, err := llm.NewCassette(path, llm.CassetteReplayOrRecord)
+	require.NoError(t, err)
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(cassette.Provider(upstream))))
+
+	recorded, err := extractor.ExtractFromText(context.Background(), "Số: 77")
+	require.NoError(t, err)
+	assert.Len(t, upstream.requests, 1)
+	assert.Equal(t, 1, cassette.Len())
+
+	// A fresh cassette replays without a provider or API key
+	replay, err := llm.NewCassette(path, llm.CassetteReplay)
+	require.NoError(t, err)
+	extractor = llm.NewExtractor(llm.NewClient("", llm.WithProvider(replay.Provider(nil))))
+
+	replayed, err := extractor.ExtractFromText(context.Background(), "Số: 77")
+	require.NoError(t, err)
+	assert.Equal(t, recorded.Number, replayed.Number)
+	assert.True(t, recorded.TotalAmount.Equal(replayed.TotalAmount))
+
+	_, err = extractor.ExtractFromText(context.Background(), "Số: 78")
+	require.ErrorIs(t, err, llm.ErrCassetteMiss)
+}
+
+func TestCassette_ReplaysErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.json")
+
+	cassette, err := llm.NewCassette(path, llm.CassetteRecord)
+	require.NoError(t, err)
+	upstream := failingProvider{err: &llm.APIError{Provider: "failing", StatusCode: http.StatusServiceUnavailable, Body: "overloaded"}}
+	req := &llm.Request{Model: "m", UserPrompt: "hi"}
+	_, err = cassette.Provider(upstream).Complete(context.Background(), req)
+	require.Error(t, err)
+
+	replay, err := llm.NewCassette(path, llm.CassetteReplay)
+	require.NoError(t, err)
+	provider := replay.Provider(nil)
+	assert.Equal(t, "failing", provider.Name())
+
+	_, err = provider.Complete(context.Background(), req)
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.True(t, llm.IsRetryable(err))
+}
+
+func TestNewCassette_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	_, err := llm.NewCassette(path, llm.CassetteReplay)
+	require.Error(t, err)
+
+	cassette, err := llm.NewCassette(path, llm.CassetteRecord)
+	require.NoError(t, err)
+	assert.Zero(t, cassette.Len())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "nothing is written before the first call")
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Document classes returned by ClassifyDocument
+const (
+	DocumentClassInvoice = "invoice"
+	DocumentClassReceipt = "receipt"
+	DocumentClassOther   = "other"
+)
+
+// LLMDocumentClass is the expected JSON structure for document classification
+type LLMDocumentClass struct {
+	Class  string `json:"class"`
+	Reason string `json:"reason"`
+}
+
+// ClassifySchema is the output contract for labelling a document before extraction
+var ClassifySchema = &ResponseSchema{
+	Name:        "record_document_class",
+	Description: "Record whether a document is an invoice, a receipt or something else",
+	Schema:      withEnum(JSONSchemaFor(LLMDocumentClass{}), "class", DocumentClassInvoice, DocumentClassReceipt, DocumentClassOther),
+}
+
+// maxClassifyText is how many characters of a document's text are sent for
+// classification; the title and first lines tell what it is
+const maxClassifyText = 2000
+
+// ClassifyDocument labels a document invoice, receipt or other from the
+// start of its text or, when text is empty, its first page image. The
+// request is small and goes to model alone, so a cheap model can screen
+// documents before the extraction models read them.
+func (e *Extractor) ClassifyDocument(ctx context.Context, model, text string, images []Image) (*LLMDocumentClass, error) {
+	userPrompt := fmt.Sprintf(UserPromptClassifyText, truncateRunes(strings.ToValidUTF8(text, ""), maxClassifyText))
+	if strings.TrimSpace(text) == "" {
+		if len(images) == 0 {
+			return nil, fmt.Errorf("no text or image to classify")
+		}
+		userPrompt, images = UserPromptClassifyImage, images[:1]
+	} else {
+		images = nil
+	}
+
+	response, err := e.complete(ctx, []string{model}, ClassifySchema, SystemPromptDocumentClassifier, userPrompt, images)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+
+	resp, err := decodeJSON[LLMDocumentClass](response)
+	if err != nil {
+		return nil, err
+	}
+	resp.Class = strings.ToLower(strings.TrimSpace(resp.Class))
+	switch resp.Class {
+	case DocumentClassInvoice, DocumentClassReceipt, DocumentClassOther:
+	default:
+		return nil, fmt.Errorf("unknown document class %q", resp.Class)
+	}
+	return resp, nil
+}
@@ -0,0 +1,39 @@
+package llm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_ClassifyDocument(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"class":" Other ","reason":"sales contract"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	text := "HỢP ĐỒNG MUA BÁN\n" + strings.Repeat("Điều khoản. ", 500)
+	class, err := extractor.ClassifyDocument(context.Background(), "tiny-model", text, []llm.Image{{Data: []byte("png"), MimeType: "image/png"}})
+	require.NoError(t, err)
+	assert.Equal(t, &llm.LLMDocumentClass{Class: llm.DocumentClassOther, Reason: "sales contract"}, class)
+
+	require.Len(t, provider.requests, 1)
+	req := provider.requests[0]
+	assert.Equal(t, "tiny-model", req.Model)
+	assert.Equal(t, llm.ClassifySchema, req.Schema)
+	assert.Contains(t, req.UserPrompt, "HỢP ĐỒNG MUA BÁN")
+	assert.Less(t, len([]rune(req.UserPrompt)), 2300, "only the start of the text is sent")
+	assert.Empty(t, req.Images, "text documents are classified from their text")
+}
+
+func TestExtractor_ClassifyDocument_UnknownClass(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"class":"memo"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	_, err := extractor.ClassifyDocument(context.Background(), "tiny-model", "", []llm.Image{{Data: []byte("png"), MimeType: "image/png"}})
+	require.ErrorContains(t, err, `unknown document class "memo"`)
+	assert.Equal(t, llm.UserPromptClassifyImage, provider.requests[0].UserPrompt)
+}
@@ -2,15 +2,11 @@ package llm
 
 import (
 	"context"
-	"encoding/base64"
-	"fmt"
-	"net/http"
 	"strings"
 	"time"
 
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
-	"github.com/openai/openai-go/packages/param"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/tracing"
 )
 
 const (
@@ -27,24 +23,24 @@ const (
 	ModelGeminiFlash    = "google/gemini-flash-1.5"
 )
 
-// Client handles communication with OpenAI-compatible APIs
+// Client sends chat requests to the configured LLM provider
 type Client struct {
-	client       openai.Client
-	visionClient openai.Client // Separate client for vision requests with special headers
-	defaultModel string
-}
-
-// visionHeaderTransport wraps an http.RoundTripper to add vision-specific headers
-type visionHeaderTransport struct {
-	base http.RoundTripper
-}
-
-func (t *visionHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Set("Copilot-Vision-Request", "true")
-	if t.base != nil {
-		return t.base.RoundTrip(req)
-	}
-	return http.DefaultTransport.RoundTrip(req)
+	provider          Provider
+	defaultModel      string
+	streamIdleTimeout time.Duration
+	cache             Cache
+	cacheTTL          time.Duration
+	limiters          *limiters
+	requestTimeout    time.Duration
+	batchStore        BatchStore
+	interceptors      []Interceptor
+	auditBodies       bool
+	auditRedact       BodyRedactor
+	promptCaching     bool
+	telemetry         []TelemetryHook
+	breakers          *breakers
+	tracer            tracing.Tracer
+	logger            logging.Logger
 }
 
 // ClientOption configures the client
@@ -54,6 +50,24 @@ type clientConfig struct {
 	baseURL      string
 	timeout      time.Duration
 	defaultModel string
+	provider     Provider
+	http         HTTPOptions
+
+	requestTimeout    time.Duration
+	streamIdleTimeout time.Duration
+	cache             Cache
+	cacheTTL          time.Duration
+	rateLimits        map[string]RateLimit
+	maxConcurrency    int
+	batchStore        BatchStore
+	interceptors      []Interceptor
+	auditBodies       bool
+	auditRedact       BodyRedactor
+	promptCaching     bool
+	telemetry         []TelemetryHook
+	breaker           *CircuitBreaker
+	tracer            tracing.Tracer
+	logger            logging.Logger
 }
 
 // WithBaseURL sets a custom base URL
@@ -63,7 +77,7 @@ func WithBaseURL(url string) ClientOption {
 	}
 }
 
-// WithTimeout sets custom HTTP timeout
+// WithTimeout sets the HTTP client timeout of the default provider
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(cfg *clientConfig) {
 		cfg.timeout = timeout
@@ -77,121 +91,177 @@ func WithDefaultModel(model string) ClientOption {
 	}
 }
 
-// NewClient creates a new OpenAI-compatible client
-func NewClient(apiKey string, opts ...ClientOption) *Client {
-	cfg := &clientConfig{
-		baseURL:      DefaultBaseURL,
-		timeout:      DefaultTimeout,
-		defaultModel: ModelClaude35Sonnet,
+// WithProvider sets the provider backend (default: OpenAI-compatible using the API key and base URL)
+func WithProvider(p Provider) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.provider = p
 	}
+}
 
-	for _, opt := range opts {
-		opt(cfg)
+// WithStreamIdleTimeout aborts streaming requests that produce no output for d
+func WithStreamIdleTimeout(d time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.streamIdleTimeout = d
 	}
+}
 
-	// Build client options for text client
-	clientOpts := []option.RequestOption{
-		option.WithAPIKey(apiKey),
-		option.WithBaseURL(cfg.baseURL),
-		option.WithHTTPClient(&http.Client{Timeout: cfg.timeout}),
-		option.WithHeader("HTTP-Referer", "https://github.com/rezonia/invoice-processor"),
-		option.WithHeader("X-Title", "Invoice Processor"),
+// WithCache serves repeated requests from cache, keyed by CacheKey (ttl 0 = no expiry)
+func WithCache(cache Cache, ttl time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.cache = cache
+		cfg.cacheTTL = ttl
 	}
+}
 
-	// Build client options for vision client with custom transport
-	visionHTTPClient := &http.Client{
-		Timeout: cfg.timeout,
-		Transport: &visionHeaderTransport{
-			base: http.DefaultTransport,
-		},
-	}
-	visionClientOpts := []option.RequestOption{
-		option.WithAPIKey(apiKey),
-		option.WithBaseURL(cfg.baseURL),
-		option.WithHTTPClient(visionHTTPClient),
-		option.WithHeader("HTTP-Referer", "https://github.com/rezonia/invoice-processor"),
-		option.WithHeader("X-Title", "Invoice Processor"),
+// WithRateLimit throttles requests to model; an empty model sets the limit for
+// every model without its own. Each model gets an independent budget.
+func WithRateLimit(model string, limit RateLimit) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.rateLimits == nil {
+			cfg.rateLimits = make(map[string]RateLimit)
+		}
+		cfg.rateLimits[model] = limit
 	}
+}
 
-	return &Client{
-		client:       openai.NewClient(clientOpts...),
-		visionClient: openai.NewClient(visionClientOpts...),
-		defaultModel: cfg.defaultModel,
+// WithMaxConcurrency caps the number of in-flight provider requests.
+// Requests waiting for a slot are served by priority (see
+// ContextWithPriority).
+func WithMaxConcurrency(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.maxConcurrency = n
 	}
 }
 
-// ChatText is a convenience method for text-only chat
-func (c *Client) ChatText(ctx context.Context, model, systemPrompt, userPrompt string) (string, error) {
-	if model == "" {
-		model = c.defaultModel
+// WithPromptCaching marks the system prompt and output schema of every request
+// as a cacheable prefix, so repeated extractions are billed for them at the
+// cached rate. Anthropic and Bedrock need the marker; OpenAI and Gemini cache
+// long prefixes automatically. Cache reads are reported in Usage.CachedPromptTokens.
+func WithPromptCaching(enabled bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.promptCaching = enabled
 	}
+}
 
-	messages := []openai.ChatCompletionMessageParamUnion{}
+// NewClient creates a new LLM client.
+// Without WithProvider, requests go to an OpenAI-compatible API (OpenRouter by default).
+func NewClient(apiKey string, opts ...ClientOption) *Client {
+	cfg := &clientConfig{
+		baseURL: DefaultBaseURL,
+		timeout: DefaultTimeout,
+	}
 
-	if systemPrompt != "" {
-		messages = append(messages, openai.SystemMessage(systemPrompt))
+	for _, opt := range opts {
+		opt(cfg)
 	}
 
-	messages = append(messages, openai.UserMessage(userPrompt))
+	if cfg.provider == nil {
+		cfg.provider = NewOpenAIProvider(OpenAIConfig{
+			APIKey:  apiKey,
+			BaseURL: cfg.baseURL,
+			Timeout: cfg.timeout,
+			HTTP:    cfg.http,
+		})
+	}
 
-	resp, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:       model,
-		Messages:    messages,
-		MaxTokens:   param.NewOpt[int64](4096),
-		Temperature: param.NewOpt[float64](0.1),
-	})
-	if err != nil {
-		return "", fmt.Errorf("chat completion failed: %w", err)
+	if cfg.defaultModel == "" {
+		cfg.defaultModel = DefaultModelFor(cfg.provider.Name())
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+	return &Client{
+		provider:          cfg.provider,
+		defaultModel:      cfg.defaultModel,
+		streamIdleTimeout: cfg.streamIdleTimeout,
+		cache:             cfg.cache,
+		cacheTTL:          cfg.cacheTTL,
+		limiters:          newLimiters(cfg.rateLimits, cfg.maxConcurrency),
+		requestTimeout:    cfg.requestTimeout,
+		batchStore:        cfg.batchStore,
+		interceptors:      cfg.interceptors,
+		auditBodies:       cfg.auditBodies,
+		auditRedact:       cfg.auditRedact,
+		promptCaching:     cfg.promptCaching,
+		telemetry:         cfg.telemetry,
+		breakers:          newBreakers(cfg.breaker),
+		tracer:            cfg.tracer,
+		logger:            cfg.logger,
 	}
+}
 
-	return resp.Choices[0].Message.Content, nil
+// Provider returns the provider backend used by the client
+func (c *Client) Provider() Provider {
+	return c.provider
 }
 
-// ChatWithImage sends a multimodal request with an image
-func (c *Client) ChatWithImage(ctx context.Context, model, systemPrompt, userPrompt string, imageData []byte, mimeType string) (string, error) {
-	if model == "" {
-		model = c.defaultModel
+// Complete sends a request to the provider, filling in client defaults
+func (c *Client) Complete(ctx context.Context, req *Request) (*Response, error) {
+	if req.Model == "" {
+		req.Model = c.defaultModel
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = DefaultMaxTokens
+	}
+	if c.promptCaching {
+		req.CachePrompt = true
 	}
 
-	// Convert image to base64 data URL
-	b64 := base64.StdEncoding.EncodeToString(imageData)
-	dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, b64)
+	ctx, span := c.startSpan(ctx, req, false)
+	start := time.Now()
+	resp, err := c.cachedComplete(ctx, req, func() (*Response, error) {
+		if err := checkGate(ctx, req); err != nil {
+			return nil, err
+		}
+		return c.guarded(ctx, req, func() (*Response, error) {
+			return c.throttled(ctx, req, func() (*Response, error) {
+				ctx, cancel := c.withRequestTimeout(ctx)
+				defer cancel()
+				return c.provider.Complete(ctx, req)
+			})
+		})
+	})
+	endSpan(span, resp, err)
+	c.audit(ctx, req, resp, err, start, false)
+	c.record(ctx, req, resp, err, start, false)
+	c.logCall(ctx, req, resp, err, start)
+	meter(ctx, req, resp)
 
-	messages := []openai.ChatCompletionMessageParamUnion{}
+	return resp, err
+}
 
-	if systemPrompt != "" {
-		messages = append(messages, openai.SystemMessage(systemPrompt))
+// ChatText is a convenience method for text-only chat
+func (c *Client) ChatText(ctx context.Context, model, systemPrompt, userPrompt string) (string, error) {
+	resp, err := c.Complete(ctx, &Request{
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Temperature:  DefaultTemperature,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	// Multimodal message with text and image
-	contentParts := []openai.ChatCompletionContentPartUnionParam{
-		openai.TextContentPart(userPrompt),
-		openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
-			URL: dataURL,
-		}),
-	}
-	messages = append(messages, openai.UserMessage(contentParts))
+	return resp.Content, nil
+}
 
-	// Use visionClient which has the Copilot-Vision-Request header
-	resp, err := c.visionClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:       model,
-		Messages:    messages,
-		MaxTokens:   param.NewOpt[int64](4096),
-		Temperature: param.NewOpt[float64](0.1),
+// ChatWithImage sends a multimodal request with an image
+func (c *Client) ChatWithImage(ctx context.Context, model, systemPrompt, userPrompt string, imageData []byte, mimeType string) (string, error) {
+	return c.ChatWithImages(ctx, model, systemPrompt, userPrompt, []Image{{Data: imageData, MimeType: mimeType}})
+}
+
+// ChatWithImages sends a multimodal request with several images in order
+func (c *Client) ChatWithImages(ctx context.Context, model, systemPrompt, userPrompt string, images []Image) (string, error) {
+	resp, err := c.Complete(ctx, &Request{
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Images:       images,
+		Temperature:  DefaultTemperature,
 	})
 	if err != nil {
-		return "", fmt.Errorf("chat completion failed: %w", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+		return "", err
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return resp.Content, nil
 }
 
 // ExtractJSON extracts JSON from LLM response (handles markdown code blocks)
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultSampleTemperature is used for self-consistency samples when none is given
+const DefaultSampleTemperature = 0.7
+
+// WithSelfConsistency runs each extraction n times at the given temperature and
+// merges the samples field by field by majority vote. Fields the samples
+// disagree on are listed in Invoice.LowConfidenceFields. Samples run
+// concurrently and cost n times a single extraction; n < 2 disables sampling.
+func WithSelfConsistency(n int, temperature float64) ExtractorOption {
+	return func(e *Extractor) {
+		e.samples = n
+		e.sampleTemperature = temperature
+		if e.sampleTemperature <= 0 {
+			e.sampleTemperature = DefaultSampleTemperature
+		}
+	}
+}
+
+// extractResponse runs one extraction, or several samples merged by vote, and
+// returns the decoded response with the fields the samples disagreed on
+func (e *Extractor) extractResponse(ctx context.Context, models []string, schema *ResponseSchema, systemPrompt, userPrompt string, images []Image) (*LLMResponse, []string, error) {
+	schema, userPrompt = e.grounding(schema, userPrompt, images)
+
+	if e.samples < 2 {
+		response, err := e.complete(ctx, models, schema, systemPrompt, userPrompt, images)
+		if err != nil {
+			return nil, nil, fmt.Errorf("LLM request failed: %w", err)
+		}
+		resp, err := e.decodeOrFix(ctx, models, schema, systemPrompt, response)
+		return resp, nil, err
+	}
+
+	results := make([]*LLMResponse, e.samples)
+	errs := make([]error, e.samples)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			response, err := e.completeSample(ctx, i+1, models, schema, systemPrompt, userPrompt, images)
+			if err == nil {
+				results[i], err = e.decodeOrFix(ctx, models, schema, systemPrompt, response)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("sample %d: %w", i+1, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Failed samples are dropped; the rest still vote
+	var samples []LLMResponse
+	for _, resp := range results {
+		if resp != nil {
+			samples = append(samples, *resp)
+		}
+	}
+	if len(samples) == 0 {
+		return nil, nil, fmt.Errorf("LLM request failed: %w", errors.Join(errs...))
+	}
+
+	merged, disagreements := voteResponses(samples)
+	return merged, disagreements, nil
+}
+
+// voteResponses merges samples field by field, taking the most common value of
+// each field (ties go to the earliest sample). It returns the JSON paths of
+// fields on which the samples were not unanimous. Line items are voted on by
+// count first, then per item among samples with the winning count.
+func voteResponses(samples []LLMResponse) (*LLMResponse, []string) {
+	values := make([]reflect.Value, len(samples))
+	for i := range samples {
+		values[i] = reflect.ValueOf(&samples[i]).Elem()
+	}
+
+	var merged LLMResponse
+	var disagreements []string
+	voteValue(values, reflect.ValueOf(&merged).Elem(), "", &disagreements)
+
+	// Boxes never agree exactly between samples; take the first sample's
+	for _, s := range samples {
+		if len(s.Locations) > 0 {
+			merged.Locations = s.Locations
+			break
+		}
+	}
+	// A value any sample saw as handwritten is flagged
+	for _, s := range samples {
+		for _, field := range s.HandwrittenFields {
+			if !slices.Contains(merged.HandwrittenFields, field) {
+				merged.HandwrittenFields = append(merged.HandwrittenFields, field)
+			}
+		}
+	}
+	return &merged, disagreements
+}
+
+// unvotedFields are merged by voteResponses rather than voted on
+var unvotedFields = []string{"locations", "handwritten_fields"}
+
+func voteValue(samples []reflect.Value, out reflect.Value, path string, disagreements *[]string) {
+	switch out.Kind() {
+	case reflect.Struct:
+		for i := 0; i < out.NumField(); i++ {
+			name := strings.Split(out.Type().Field(i).Tag.Get("json"), ",")[0]
+			if path == "" && slices.Contains(unvotedFields, name) {
+				continue
+			}
+			fields := make([]reflect.Value, len(samples))
+			for j, s := range samples {
+				fields[j] = s.Field(i)
+			}
+			voteValue(fields, out.Field(i), joinPath(path, name), disagreements)
+		}
+
+	case reflect.Slice:
+		lengths := make([]reflect.Value, len(samples))
+		for i, s := range samples {
+			lengths[i] = reflect.ValueOf(s.Len())
+		}
+		n, agreed := majority(lengths, func(v reflect.Value) string { return fmt.Sprint(v.Int()) })
+		if !agreed {
+			*disagreements = append(*disagreements, path)
+		}
+
+		var matching []reflect.Value
+		for _, s := range samples {
+			if s.Len() == int(n.Int()) {
+				matching = append(matching, s)
+			}
+		}
+		if n.Int() == 0 {
+			return
+		}
+		out.Set(reflect.MakeSlice(out.Type(), int(n.Int()), int(n.Int())))
+		for i := 0; i < int(n.Int()); i++ {
+			elems := make([]reflect.Value, len(matching))
+			for j, s := range matching {
+				elems[j] = s.Index(i)
+			}
+			voteValue(elems, out.Index(i), fmt.Sprintf("%s[%d]", path, i), disagreements)
+		}
+
+	default:
+		winner, agreed := majority(samples, voteKey)
+		out.Set(winner)
+		if !agreed {
+			*disagreements = append(*disagreements, path)
+		}
+	}
+}
+
+// majority returns the most common value by key and whether all samples agreed
+func majority(samples []reflect.Value, key func(reflect.Value) string) (reflect.Value, bool) {
+	counts := make(map[string]int)
+	best := 0
+	for _, s := range samples {
+		counts[key(s)]++
+		best = max(best, counts[key(s)])
+	}
+	for _, s := range samples {
+		if counts[key(s)] == best {
+			return s, len(counts) == 1
+		}
+	}
+	return reflect.Value{}, true
+}
+
+// voteKey normalizes a scalar so equivalent values vote together
+func voteKey(v reflect.Value) string {
+	if n, ok := v.Interface().(json.Number); ok {
+		if n == "" {
+			return ""
+		}
+		return parseDecimal(n).String()
+	}
+	if v.Kind() == reflect.String {
+		return strings.ToLower(strings.Join(strings.Fields(v.String()), " "))
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,99 @@
+package llm_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// sampleProvider answers each self-consistency sample with its own response
+type sampleProvider struct {
+	mu        sync.Mutex
+	responses map[int]string
+	requests  []*llm.Request
+}
+
+func (p *sampleProvider) Name() string { return "sample" }
+
+func (p *sampleProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	content, ok := p.responses[req.Sample]
+	if !ok {
+		return nil, &llm.APIError{Provider: "sample", StatusCode: 400, Body: "no response"}
+	}
+	return &llm.Response{Content: content, Model: req.Model}, nil
+}
+
+func TestExtractor_SelfConsistency(t *testing.T) {
+	provider := &sampleProvider{responses: map[int]string{
+		1: `{"invoice_number":"12","seller":{"tax_id":"0312345678"},"total_amount":1100000,"items":[{"name":"A"}]}`,
+		2: `{"invoice_number":"12","seller":{"tax_id":"0312345679"},"total_amount":1100000,"items":[{"name":"A"}]}`,
+		3: `{"invoice_number":"12","seller":{"tax_id":"0312345678"},"total_amount":1100000,"items":[{"name":"A"},{"name":"B"}]}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithSelfConsistency(3, 0.5))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+
+	assert.Equal(t, "12", inv.Number)
+	assert.Equal(t, "0312345678", inv.Seller.TaxID)
+	assert.True(t, decimal.NewFromInt(1100000).Equal(inv.TotalAmount))
+	assert.Len(t, inv.Items, 1)
+	assert.ElementsMatch(t, []string{"seller.tax_id", "items"}, inv.LowConfidenceFields)
+
+	require.Len(t, provider.requests, 3)
+	for _, req := range provider.requests {
+		assert.Equal(t, 0.5, req.Temperature)
+	}
+}
+
+func TestExtractor_SelfConsistency_FailedSamples(t *testing.T) {
+	provider := &sampleProvider{responses: map[int]string{
+		2: `{"invoice_number":"7"}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)),
+		llm.WithSelfConsistency(3, 0), llm.WithRetryPolicy(llm.NoRetry))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, "7", inv.Number)
+	assert.Empty(t, inv.LowConfidenceFields)
+
+	provider.responses = nil
+	_, err = extractor.ExtractFromText(context.Background(), "text")
+	require.Error(t, err)
+}
+
+func TestCacheKey_Sample(t *testing.T) {
+	req := &llm.Request{Model: "m", UserPrompt: "p"}
+	sampled := *req
+	sampled.Sample = 1
+
+	assert.NotEqual(t, llm.CacheKey("openai", req), llm.CacheKey("openai", &sampled))
+}
+
+func TestExtractor_SelfConsistency_Handwriting(t *testing.T) {
+	provider := &sampleProvider{responses: map[int]string{
+		1: `{"invoice_number":"12","total_amount":500000,"handwritten_fields":["total_amount"]}`,
+		2: `{"invoice_number":"12","total_amount":500000,"handwritten_fields":[]}`,
+		3: `{"invoice_number":"12","total_amount":500000,"handwritten_fields":["buyer.name","total_amount"]}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithSelfConsistency(3, 0.5))
+
+	inv, err := extractor.ExtractFromImage(context.Background(), []byte("img"), "image/jpeg")
+	require.NoError(t, err)
+
+	assert.True(t, inv.HasHandwriting)
+	assert.Equal(t, []string{"total_amount", "buyer.name"}, inv.HandwrittenFields, "any sample's handwriting counts")
+	assert.Empty(t, inv.LowConfidenceFields, "handwriting flags are not voted on")
+	assert.Contains(t, provider.requests[0].UserPrompt, llm.PromptHandwriting)
+}
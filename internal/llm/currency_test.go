@@ -0,0 +1,32 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_ForeignCurrency(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"7","total_amount":"1,320.55","currency":"USD","exchange_rate":"25.450","total_amount_vnd":"33.608.000"}`,
+		`{"invoice_number":"8","total_amount":110000,"currency":"VND","exchange_rate":1}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "INVOICE 7 ...")
+	require.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("1320.55").Equal(inv.TotalAmount))
+	assert.True(t, decimal.NewFromInt(25450).Equal(inv.ExchangeRate))
+	require.NotNil(t, inv.VNDAmounts)
+	assert.True(t, decimal.NewFromInt(33608000).Equal(inv.VNDAmounts.TotalAmount))
+
+	inv, err = extractor.ExtractFromText(context.Background(), "HOA DON 8 ...")
+	require.NoError(t, err)
+	assert.True(t, inv.ExchangeRate.IsZero(), "VND invoices have no rate")
+	assert.Nil(t, inv.VNDAmounts)
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// DefaultEmbeddingModel is used by Client.Embed when no model is given
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// ErrEmbeddingsUnsupported is returned by Client.Embed when the provider has no embeddings API
+var ErrEmbeddingsUnsupported = errors.New("provider does not support embeddings")
+
+// EmbeddingProvider is implemented by providers that can embed text
+type EmbeddingProvider interface {
+	Provider
+	Embed(ctx context.Context, model string, texts []string) ([][]float64, error)
+}
+
+// Embedder turns texts into embedding vectors, one per text in order
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+// Embed calls f
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	return f(ctx, texts)
+}
+
+// Embed embeds texts with model (default: DefaultEmbeddingModel)
+func (c *Client) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	ep, ok := c.provider.(EmbeddingProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", c.provider.Name(), ErrEmbeddingsUnsupported)
+	}
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
+
+	vectors, err := ep.Embed(ctx, model, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(vectors))
+	}
+	return vectors, nil
+}
+
+// Embedder returns an Embedder that embeds with model through the client
+func (c *Client) Embedder(model string) Embedder {
+	return EmbedderFunc(func(ctx context.Context, texts []string) ([][]float64, error) {
+		return c.Embed(ctx, model, texts)
+	})
+}
+
+// Embed calls the embeddings endpoint
+func (p *OpenAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	var opts []option.RequestOption
+	if p.requestOptions != nil {
+		opts = p.requestOptions(model)
+	}
+
+	resp, err := p.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: openai.EmbeddingModel(model),
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, data := range resp.Data {
+		if data.Index >= 0 && int(data.Index) < len(vectors) {
+			vectors[data.Index] = data.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// Embed calls the /api/embed endpoint
+func (p *OllamaProvider) Embed(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	httpReq, _, err := newJSONRequest(ctx, p.baseURL+"/api/embed", ollamaEmbedRequest{Model: model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ollamaEmbedResponse
+	if err := doJSON(p.httpClient, httpReq, ProviderOllama, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
@@ -0,0 +1,58 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestClient_Embed(t *testing.T) {
+	t.Run("openai", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/embeddings", r.URL.Path)
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, llm.DefaultEmbeddingModel, body["model"])
+			assert.Equal(t, []any{"CÔNG TY ABC", "XYZ"}, body["input"])
+
+			// Entries may arrive out of order; index places them
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"object":"list","model":"text-embedding-3-small","data":[
+				{"object":"embedding","index":1,"embedding":[0,1]},
+				{"object":"embedding","index":0,"embedding":[1,0]}
+			]}`))
+		}))
+		defer srv.Close()
+
+		client := llm.NewClient("key", llm.WithBaseURL(srv.URL))
+		vectors, err := client.Embedder("").Embed(context.Background(), []string{"CÔNG TY ABC", "XYZ"})
+		require.NoError(t, err)
+		assert.Equal(t, [][]float64{{1, 0}, {0, 1}}, vectors)
+	})
+
+	t.Run("ollama", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/embed", r.URL.Path)
+			w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[0.5,0.5]]}`))
+		}))
+		defer srv.Close()
+
+		client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+		vectors, err := client.Embed(context.Background(), "nomic-embed-text", []string{"ABC"})
+		require.NoError(t, err)
+		assert.Equal(t, [][]float64{{0.5, 0.5}}, vectors)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		client := llm.NewClient("", llm.WithProvider(&staticProvider{content: "{}"}))
+		_, err := client.Embed(context.Background(), "", []string{"ABC"})
+		assert.ErrorIs(t, err, llm.ErrEmbeddingsUnsupported)
+	})
+}
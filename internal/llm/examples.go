@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxExampleDocumentLen caps example document text injected into prompts
+const maxExampleDocumentLen = 4000
+
+// Example is a labeled document/output pair used for few-shot prompting
+type Example struct {
+	SellerTaxID string          `json:"seller_tax_id,omitempty"` // Matched against tax IDs in the document
+	Layout      string          `json:"layout,omitempty"`        // Matched against the layout hint in the context
+	Document    string          `json:"document"`                // Document text
+	Output      json.RawMessage `json:"output"`                  // Expected JSON output
+}
+
+// ExampleSet holds few-shot examples keyed by seller tax ID or layout class
+type ExampleSet struct {
+	mu       sync.RWMutex
+	examples []Example
+}
+
+// NewExampleSet creates an example set
+func NewExampleSet(examples ...Example) (*ExampleSet, error) {
+	s := &ExampleSet{}
+	for _, ex := range examples {
+		if err := s.Add(ex); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add registers an example
+func (s *ExampleSet) Add(ex Example) error {
+	if ex.SellerTaxID == "" && ex.Layout == "" {
+		return fmt.Errorf("example needs a seller tax ID or layout")
+	}
+	if !json.Valid(ex.Output) {
+		return fmt.Errorf("example output is not valid JSON")
+	}
+	ex.SellerTaxID = digitsOnly(ex.SellerTaxID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples = append(s.examples, ex)
+	return nil
+}
+
+// ReadExamples parses examples from JSON Lines, one Example per line
+func ReadExamples(r io.Reader) ([]Example, error) {
+	var examples []Example
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var ex Example
+		if err := json.Unmarshal([]byte(text), &ex); err != nil {
+			return nil, fmt.Errorf("example line %d: %w", line, err)
+		}
+		examples = append(examples, ex)
+	}
+
+	return examples, scanner.Err()
+}
+
+// Select returns up to n examples best matching the document: a seller tax ID
+// appearing in text outranks a layout match. Registration order breaks ties.
+func (s *ExampleSet) Select(text, layout string, n int) []Example {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	taxIDs := make(map[string]bool)
+	for _, id := range taxIDPattern.FindAllString(text, -1) {
+		taxIDs[digitsOnly(id)] = true
+	}
+
+	type scored struct {
+		example Example
+		score   int
+	}
+	var matches []scored
+	for _, ex := range s.examples {
+		score := 0
+		if ex.SellerTaxID != "" && taxIDs[ex.SellerTaxID] {
+			score += 2
+		}
+		if ex.Layout != "" && ex.Layout == layout {
+			score++
+		}
+		if score > 0 {
+			matches = append(matches, scored{ex, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	var selected []Example
+	for _, m := range matches[:min(n, len(matches))] {
+		selected = append(selected, m.example)
+	}
+	return selected
+}
+
+// taxIDPattern matches Vietnamese tax IDs: 10 digits with an optional 3-digit branch suffix
+var taxIDPattern = regexp.MustCompile(`\b\d{10}(?:-\d{3})?\b`)
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// formatExamples renders examples as a prompt prefix
+func formatExamples(examples []Example) string {
+	if len(examples) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Here are correctly extracted examples of similar documents. Follow the same conventions.\n\n")
+	for i, ex := range examples {
+		doc := ex.Document
+		if len(doc) > maxExampleDocumentLen {
+			doc = doc[:maxExampleDocumentLen] + "\n[...]"
+		}
+		fmt.Fprintf(&b, "Example %d document:\n---\n%s\n---\nExample %d output:\n%s\n\n", i+1, doc, i+1, ex.Output)
+	}
+	b.WriteString("Now extract the following document.\n\n")
+	return b.String()
+}
+
+type layoutKey struct{}
+
+// ContextWithLayout attaches a layout class used to pick few-shot examples
+func ContextWithLayout(ctx context.Context, layout string) context.Context {
+	return context.WithValue(ctx, layoutKey{}, layout)
+}
+
+// LayoutFromContext returns the layout class attached by ContextWithLayout
+func LayoutFromContext(ctx context.Context) string {
+	layout, _ := ctx.Value(layoutKey{}).(string)
+	return layout
+}
@@ -0,0 +1,68 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExampleSet_Select(t *testing.T) {
+	set, err := llm.NewExampleSet(
+		llm.Example{Layout: "table-a", Document: "layout doc", Output: json.RawMessage(`{"invoice_number":"L"}`)},
+		llm.Example{SellerTaxID: "0101243150", Document: "misa doc", Output: json.RawMessage(`{"invoice_number":"M"}`)},
+		llm.Example{SellerTaxID: "0100109106", Document: "viettel doc", Output: json.RawMessage(`{"invoice_number":"V"}`)},
+	)
+	require.NoError(t, err)
+
+	selected := set.Select("MST người bán: 0101243150", "table-a", 5)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "misa doc", selected[0].Document, "tax ID match outranks layout match")
+	assert.Equal(t, "layout doc", selected[1].Document)
+
+	assert.Empty(t, set.Select("no tax id here", "", 5))
+	assert.Len(t, set.Select("0101243150 0100109106", "", 1), 1)
+}
+
+func TestExampleSet_AddValidates(t *testing.T) {
+	set, err := llm.NewExampleSet()
+	require.NoError(t, err)
+
+	assert.Error(t, set.Add(llm.Example{Document: "x", Output: json.RawMessage(`{}`)}), "needs a key")
+	assert.Error(t, set.Add(llm.Example{Layout: "a", Output: json.RawMessage(`{broken`)}), "needs valid JSON")
+}
+
+func TestReadExamples(t *testing.T) {
+	input := `{"seller_tax_id":"0101243150","document":"d1","output":{"invoice_number":"1"}}
+
+{"layout":"receipt-58mm","document":"d2","output":{"receipt_number":"2"}}
+`
+	examples, err := llm.ReadExamples(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, examples, 2)
+	assert.Equal(t, "receipt-58mm", examples[1].Layout)
+	assert.JSONEq(t, `{"invoice_number":"1"}`, string(examples[0].Output))
+}
+
+func TestExtractor_WithExamples(t *testing.T) {
+	set, err := llm.NewExampleSet(
+		llm.Example{SellerTaxID: "0101243150", Document: "MISA sample", Output: json.RawMessage(`{"invoice_number":"0000001"}`)},
+	)
+	require.NoError(t, err)
+
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"2"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithExamples(set, 0))
+
+	_, err = extractor.ExtractFromText(context.Background(), "MST: 0101243150")
+	require.NoError(t, err)
+	assert.Contains(t, provider.requests[0].UserPrompt, "MISA sample")
+
+	_, err = extractor.ExtractFromText(context.Background(), "MST: 0312345678")
+	require.NoError(t, err)
+	assert.NotContains(t, provider.requests[1].UserPrompt, "MISA sample")
+}
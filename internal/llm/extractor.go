@@ -3,22 +3,79 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 
+	"github.com/rezonia/invoice-processor/internal/logging"
 	"github.com/rezonia/invoice-processor/internal/model"
 )
 
 // Extractor uses LLM to extract invoice data
 type Extractor struct {
-	client      *Client
-	textModel   string
-	visionModel string
+	client           *Client
+	textModel        string
+	visionModel      string
+	structuredOutput bool
+
+	// Transient failures are retried per model, then the next fallback model is tried
+	retry                RetryPolicy
+	textFallbackModels   []string
+	visionFallbackModels []string
+
+	streamHandler StreamHandler
+	prompts       PromptSet
+
+	examples    *ExampleSet
+	maxExamples int
+
+	// Self-consistency: samples > 1 runs each extraction that many times and votes
+	samples           int
+	sampleTemperature float64
+
+	// Empty required fields are re-requested with a focused prompt (see WithFieldRecovery)
+	requiredFields []RequiredField
+
+	redactor *Redactor
+
+	// Sampling parameters (see WithGenerationParams)
+	generation      GenerationParams
+	modelGeneration map[string]GenerationParams
+
+	// Amount parsing per currency (see WithNumberFormat)
+	numberFormats map[string]NumberFormat
+
+	// Vision requests ask for field bounding boxes (see WithBoundingBoxes)
+	boundingBoxes bool
+
+	// Inconsistent amounts are sent back for correction (see WithArithmeticCheck)
+	arithmeticCheck     bool
+	arithmeticTolerance decimal.Decimal
+
+	// Tax IDs failing their check digit are rejected (see WithTaxIDCheck)
+	taxIDCheck bool
+
+	// Document text beyond this many estimated tokens is truncated (see WithTextTokenBudget)
+	textTokenBudget int
+
+	// Images are scaled down to the vision model's budget (see WithImageBudget)
+	downscaleImages bool
+	imageBudget     *ImageBudget
+
+	// Retries and fallbacks are logged (see WithExtractorLogger)
+	logger logging.Logger
 }
 
+// ErrNotInvoice is returned by ExtractAuto for documents of no supported type
+var ErrNotInvoice = errors.New("document is not an invoice or receipt")
+
+// DefaultMaxExamples is how many few-shot examples are injected per request
+const DefaultMaxExamples = 2
+
 // ExtractorOption configures the extractor
 type ExtractorOption func(*Extractor)
 
@@ -43,67 +100,395 @@ func WithVisionModel(model string) ExtractorOption {
 	}
 }
 
+// WithStructuredOutput enables or disables schema-constrained output (default: enabled).
+// Disable for models or gateways that reject tool calling.
+func WithStructuredOutput(enabled bool) ExtractorOption {
+	return func(e *Extractor) {
+		e.structuredOutput = enabled
+	}
+}
+
+// WithRetryPolicy sets how transient LLM failures are retried (default: DefaultRetryPolicy)
+func WithRetryPolicy(policy RetryPolicy) ExtractorOption {
+	return func(e *Extractor) {
+		e.retry = policy
+	}
+}
+
+// WithFallbackModels sets models tried in order when the text model keeps failing
+func WithFallbackModels(models ...string) ExtractorOption {
+	return func(e *Extractor) {
+		e.textFallbackModels = models
+	}
+}
+
+// WithVisionFallbackModels sets models tried in order when the vision model keeps failing
+func WithVisionFallbackModels(models ...string) ExtractorOption {
+	return func(e *Extractor) {
+		e.visionFallbackModels = models
+	}
+}
+
+// WithStreamHandler streams responses, passing output to handler as it arrives.
+// Retried attempts stream again from the start.
+func WithStreamHandler(handler StreamHandler) ExtractorOption {
+	return func(e *Extractor) {
+		e.streamHandler = handler
+	}
+}
+
+// WithPrompts overrides extraction prompts; empty fields keep the defaults
+func WithPrompts(prompts PromptSet) ExtractorOption {
+	return func(e *Extractor) {
+		e.prompts = prompts
+	}
+}
+
+// WithExamples injects up to n matching few-shot examples into prompts (n <= 0 uses DefaultMaxExamples).
+// Examples match on seller tax IDs found in the document text and on the layout set with ContextWithLayout.
+func WithExamples(examples *ExampleSet, n int) ExtractorOption {
+	return func(e *Extractor) {
+		if n <= 0 {
+			n = DefaultMaxExamples
+		}
+		e.examples = examples
+		e.maxExamples = n
+	}
+}
+
 // NewExtractor creates a new LLM-based extractor
 func NewExtractor(client *Client, opts ...ExtractorOption) *Extractor {
+	// Models left empty fall back to the client's default model
 	e := &Extractor{
-		client:      client,
-		textModel:   ModelClaude35Sonnet, // Default to Claude for best results
-		visionModel: ModelClaude35Sonnet, // Default to Claude for vision
+		client:           client,
+		structuredOutput: true,
+		retry:            DefaultRetryPolicy,
+		textTokenBudget:  DefaultTextTokenBudget,
+		downscaleImages:  true,
 	}
 
 	for _, opt := range opts {
 		opt(e)
 	}
+	e.prompts = e.prompts.WithDefaults()
 
 	return e
 }
 
+// Prompts returns the prompts in use
+func (e *Extractor) Prompts() PromptSet {
+	return e.prompts
+}
+
 // ExtractFromText extracts invoice data from OCR text
 func (e *Extractor) ExtractFromText(ctx context.Context, text string) (*model.Invoice, error) {
-	prompt := fmt.Sprintf(UserPromptTextExtraction, text)
+	text, redaction := e.redact(text)
+	text, truncated := e.truncate(text)
+	prompt := e.withExamples(ctx, text, fmt.Sprintf(e.promptSet(ctx).Text, text)+redactionNote(redaction))
 
-	response, err := e.client.ChatText(ctx, e.textModel, SystemPromptInvoiceExtractor, prompt)
+	inv, err := e.extractInvoice(ctx, e.textModels(ctx), InvoiceSchema, e.promptSet(ctx).SystemInvoice, prompt, nil)
 	if err != nil {
-		return nil, fmt.Errorf("LLM request failed: %w", err)
+		return nil, err
 	}
 
-	return e.parseResponse(response)
+	inv = e.refine(ctx, inv, e.textModels(ctx), text, nil)
+	inv.TextTruncated = truncated
+	redaction.RestoreInvoice(inv)
+
+	return inv, nil
 }
 
 // ExtractFromImage extracts invoice data directly from an image
 func (e *Extractor) ExtractFromImage(ctx context.Context, imageData []byte, mimeType string) (*model.Invoice, error) {
-	response, err := e.client.ChatWithImage(ctx, e.visionModel, SystemPromptInvoiceExtractor, UserPromptImageExtraction, imageData, mimeType)
+	return e.ExtractFromImages(ctx, []Image{{Data: imageData, MimeType: mimeType}})
+}
+
+// ExtractFromImages extracts one invoice from several page images in a single request
+func (e *Extractor) ExtractFromImages(ctx context.Context, images []Image) (*model.Invoice, error) {
+	inv, err := e.extractInvoice(ctx, e.visionModels(ctx), InvoiceSchema, e.promptSet(ctx).SystemInvoice, e.withExamples(ctx, "", imagePrompt(e.promptSet(ctx).Image, images)), images)
 	if err != nil {
-		return nil, fmt.Errorf("LLM request failed: %w", err)
+		return nil, err
 	}
 
-	return e.parseResponse(response)
+	return e.refine(ctx, inv, e.visionModels(ctx), "", images), nil
 }
 
 // ExtractFromImageAuto extracts data from image, auto-detecting document type (invoice or receipt)
 func (e *Extractor) ExtractFromImageAuto(ctx context.Context, imageData []byte, mimeType string) (*model.Invoice, error) {
-	response, err := e.client.ChatWithImage(ctx, e.visionModel, SystemPromptReceiptExtractor, UserPromptAutoDetectExtraction, imageData, mimeType)
+	return e.ExtractAuto(ctx, []Image{{Data: imageData, MimeType: mimeType}})
+}
+
+// ExtractFromImagesAuto extracts one document from several images, auto-detecting its type
+func (e *Extractor) ExtractFromImagesAuto(ctx context.Context, images []Image) (*model.Invoice, error) {
+	return e.ExtractAuto(ctx, images)
+}
+
+// ExtractAuto classifies the document as invoice, receipt, credit note, delivery
+// note, purchase order or other and extracts the fields that apply to its type.
+// Other documents return ErrNotInvoice.
+func (e *Extractor) ExtractAuto(ctx context.Context, images []Image) (*model.Invoice, error) {
+	llmResp, disagreements, err := e.extractResponse(ctx, e.visionModels(ctx), AutoDetectSchema, e.promptSet(ctx).SystemReceipt, e.withExamples(ctx, "", imagePrompt(e.promptSet(ctx).AutoDetect, images)), images)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := normalizeDocumentType(llmResp); err != nil {
+		return nil, err
+	}
+
+	inv, err := e.convertToInvoice(llmResp)
+	if err != nil {
+		return nil, err
+	}
+	inv.LowConfidenceFields = disagreements
+
+	return e.refine(ctx, inv, e.visionModels(ctx), "", images), nil
+}
+
+// normalizeDocumentType applies an auto-detected document type to resp.
+// Other documents return ErrNotInvoice.
+func normalizeDocumentType(resp *LLMResponse) error {
+	switch strings.ToLower(strings.TrimSpace(resp.DocumentType)) {
+	case "other":
+		return ErrNotInvoice
+	case "receipt":
+		// Receipts carry no series, invoice type or buyer; drop anything the model guessed
+		resp.DocumentType = string(model.DocumentTypeReceipt)
+		resp.Series = ""
+		resp.Type = ""
+		resp.Buyer = LLMParty{}
+	case "credit_note":
+		resp.DocumentType = string(model.DocumentTypeCreditNote)
+		resp.Type = string(model.InvoiceTypeAdjustment)
+	case "delivery_note":
+		resp.DocumentType = string(model.DocumentTypeDeliveryNote)
+		resp.Series = ""
+		resp.Type = ""
+	case "purchase_order":
+		resp.DocumentType = string(model.DocumentTypePurchaseOrder)
+		resp.Series = ""
+		resp.Type = ""
+	default:
+		resp.DocumentType = string(model.DocumentTypeInvoice)
+	}
+	return nil
+}
+
+// ExtractCreditNote extracts a credit note (hóa đơn điều chỉnh giảm) and the invoice it adjusts
+func (e *Extractor) ExtractCreditNote(ctx context.Context, images []Image) (*model.Invoice, error) {
+	return e.extractDocument(ctx, images, CreditNoteSchema, e.promptSet(ctx).CreditNote, "credit_note")
+}
+
+// ExtractDeliveryNote extracts a delivery note (phiếu xuất kho)
+func (e *Extractor) ExtractDeliveryNote(ctx context.Context, images []Image) (*model.Invoice, error) {
+	return e.extractDocument(ctx, images, DeliveryNoteSchema, e.promptSet(ctx).DeliveryNote, "delivery_note")
+}
+
+// ExtractPurchaseOrder extracts a purchase order (đơn đặt hàng)
+func (e *Extractor) ExtractPurchaseOrder(ctx context.Context, images []Image) (*model.Invoice, error) {
+	return e.extractDocument(ctx, images, PurchaseOrderSchema, e.promptSet(ctx).PurchaseOrder, "purchase_order")
+}
+
+// extractDocument extracts a document whose type is known upfront
+func (e *Extractor) extractDocument(ctx context.Context, images []Image, schema *ResponseSchema, prompt, documentType string) (*model.Invoice, error) {
+	llmResp, disagreements, err := e.extractResponse(ctx, e.visionModels(ctx), schema, e.promptSet(ctx).SystemInvoice, e.withExamples(ctx, "", imagePrompt(prompt, images)), images)
+	if err != nil {
+		return nil, err
+	}
+
+	llmResp.DocumentType = documentType
+	if err := normalizeDocumentType(llmResp); err != nil {
+		return nil, err
+	}
+
+	inv, err := e.convertToInvoice(llmResp)
 	if err != nil {
-		return nil, fmt.Errorf("LLM request failed: %w", err)
+		return nil, err
 	}
+	inv.LowConfidenceFields = disagreements
 
-	return e.parseResponse(response)
+	return e.refine(ctx, inv, e.visionModels(ctx), "", images), nil
+}
+
+// ExtractReceiptFromImage extracts a POS receipt using the receipt prompts and schema
+func (e *Extractor) ExtractReceiptFromImage(ctx context.Context, imageData []byte, mimeType string) (*model.Invoice, error) {
+	return e.ExtractReceiptFromImages(ctx, []Image{{Data: imageData, MimeType: mimeType}})
+}
+
+// ExtractReceiptFromImages extracts one receipt from several images (e.g. front and back)
+func (e *Extractor) ExtractReceiptFromImages(ctx context.Context, images []Image) (*model.Invoice, error) {
+	inv, err := e.extractInvoice(ctx, e.visionModels(ctx), ReceiptSchema, e.promptSet(ctx).SystemReceipt, e.withExamples(ctx, "", imagePrompt(e.promptSet(ctx).Receipt, images)), images)
+	if err != nil {
+		return nil, err
+	}
+	inv.DocumentType = model.DocumentTypeReceipt
+
+	return e.refine(ctx, inv, e.visionModels(ctx), "", images), nil
 }
 
 // ExtractFromOCRText extracts invoice data from potentially noisy OCR text
 func (e *Extractor) ExtractFromOCRText(ctx context.Context, ocrText string) (*model.Invoice, error) {
-	prompt := fmt.Sprintf(UserPromptOCRCorrection, ocrText)
+	ocrText, redaction := e.redact(ocrText)
+	ocrText, truncated := e.truncate(ocrText)
+	prompt := e.withExamples(ctx, ocrText, fmt.Sprintf(e.promptSet(ctx).OCR, ocrText)+redactionNote(redaction))
 
-	response, err := e.client.ChatText(ctx, e.textModel, SystemPromptInvoiceExtractor, prompt)
+	inv, err := e.extractInvoice(ctx, e.textModels(ctx), InvoiceSchema, e.promptSet(ctx).SystemInvoice, prompt, nil)
 	if err != nil {
-		return nil, fmt.Errorf("LLM request failed: %w", err)
+		return nil, err
 	}
 
-	return e.parseResponse(response)
+	inv = e.refine(ctx, inv, e.textModels(ctx), ocrText, nil)
+	inv.TextTruncated = truncated
+	redaction.RestoreInvoice(inv)
+
+	return inv, nil
+}
+
+// imagePrompt tells the model how to treat multiple images
+func imagePrompt(prompt string, images []Image) string {
+	if len(images) > 1 {
+		prompt += fmt.Sprintf(PromptMultiImageNote, len(images))
+	}
+	return prompt
+}
+
+// withExamples prefixes prompt with few-shot examples matching the document
+func (e *Extractor) withExamples(ctx context.Context, text, prompt string) string {
+	if e.examples == nil {
+		return prompt
+	}
+	return formatExamples(e.examples.Select(text, LayoutFromContext(ctx), e.maxExamples)) + prompt
+}
+
+// textModels returns the text model of ctx and its fallbacks
+func (e *Extractor) textModels(ctx context.Context) []string {
+	model := e.textModel
+	if m := ModelsFromContext(ctx); m.Text != "" {
+		model = m.Text
+	}
+	return append([]string{model}, e.textFallbackModels...)
+}
+
+// visionModels returns the vision model of ctx and its fallbacks
+func (e *Extractor) visionModels(ctx context.Context) []string {
+	model := e.visionModel
+	if m := ModelsFromContext(ctx); m.Vision != "" {
+		model = m.Vision
+	}
+	return append([]string{model}, e.visionFallbackModels...)
+}
+
+// Models are the primary text and vision models of an extraction
+type Models struct {
+	Text   string
+	Vision string
+}
+
+type modelsKey struct{}
+
+// ContextWithModels replaces the primary models for extractions made with
+// ctx, such as those of a tenant with its own model choices. Empty fields
+// keep the extractor's models; the fallback models still apply.
+func ContextWithModels(ctx context.Context, models Models) context.Context {
+	return context.WithValue(ctx, modelsKey{}, models)
+}
+
+// ModelsFromContext returns the models set by ContextWithModels
+func ModelsFromContext(ctx context.Context) Models {
+	models, _ := ctx.Value(modelsKey{}).(Models)
+	return models
+}
+
+type modelKey struct{}
+
+// ContextWithModel sends the extractions made with ctx to model alone, in
+// place of the configured models and their fallbacks, e.g. to replay a
+// failed document with another model
+func ContextWithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set by ContextWithModel, or ""
+func ModelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelKey{}).(string)
+	return model
+}
+
+// complete sends an extraction request, constraining output to schema when enabled.
+// Each model is retried on transient errors before falling back to the next one.
+func (e *Extractor) complete(ctx context.Context, models []string, schema *ResponseSchema, systemPrompt, userPrompt string, images []Image) (string, error) {
+	return e.completeSample(ctx, 0, models, schema, systemPrompt, userPrompt, images)
+}
+
+// completeSample is complete for one self-consistency sample; sample 0 is a
+// regular deterministic request
+func (e *Extractor) completeSample(ctx context.Context, sample int, models []string, schema *ResponseSchema, systemPrompt, userPrompt string, images []Image) (string, error) {
+	attempts := max(e.retry.MaxAttempts, 1)
+	ctx = withLogger(ctx, e.logger)
+	if model := ModelFromContext(ctx); model != "" {
+		models = []string{model}
+	}
+
+	var lastErr error
+	for fallback, model := range models {
+		if fallback > 0 {
+			logging.Warn(ctx, "falling back to next LLM model", "model", model, "failed_model", models[fallback-1], "error", lastErr)
+		}
+		images := e.fitImages(images, model)
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if attempt > 1 {
+				backoff := e.retry.backoff(attempt - 1)
+				logging.Warn(ctx, "retrying LLM request", "model", model, "attempt", attempt, "backoff", backoff, "error", lastErr)
+				if err := sleep(ctx, backoff); err != nil {
+					return "", errors.Join(lastErr, err)
+				}
+			}
+
+			req := &Request{
+				Model:        model,
+				SystemPrompt: systemPrompt,
+				UserPrompt:   userPrompt,
+				Images:       images,
+				Temperature:  DefaultTemperature,
+				Sample:       sample,
+			}
+			e.generationParams(ctx, model).apply(req)
+			// Samples need diversity whatever temperature is configured
+			if sample > 0 {
+				req.Temperature = e.sampleTemperature
+			}
+			if e.structuredOutput {
+				req.Schema = schema
+			}
+
+			callCtx := contextWithAttempt(ctx, attempt, fallback)
+			var resp *Response
+			var err error
+			if e.streamHandler != nil {
+				resp, err = e.client.CompleteStream(callCtx, req, e.streamHandler)
+			} else {
+				resp, err = e.client.Complete(callCtx, req)
+			}
+			if err == nil {
+				return resp.Content, nil
+			}
+			lastErr = err
+
+			if ctx.Err() != nil {
+				return "", err
+			}
+			if !IsRetryable(err) {
+				break
+			}
+		}
+	}
+
+	return "", lastErr
 }
 
 // LLMResponse represents the JSON structure returned by LLM
 type LLMResponse struct {
+	SchemaVersion  int           `json:"schema_version"` // See ResponseSchemaVersion; 0 = version 1
 	InvoiceNumber  string        `json:"invoice_number"`
 	Series         string        `json:"series"`
 	Date           string        `json:"date"`
@@ -116,6 +501,8 @@ type LLMResponse struct {
 	TotalVAT       json.Number   `json:"total_vat"`
 	TotalAmount    json.Number   `json:"total_amount"`
 	Currency       string        `json:"currency"`
+	ExchangeRate   json.Number   `json:"exchange_rate"`    // VND per unit of a foreign currency
+	TotalAmountVND json.Number   `json:"total_amount_vnd"` // Printed VND equivalent of the total
 	PaymentMethod  string        `json:"payment_method"`
 	Notes          string        `json:"notes"`
 	// Receipt-specific fields
@@ -126,6 +513,30 @@ type LLMResponse struct {
 	Time           string      `json:"time"`
 	AmountTendered json.Number `json:"amount_tendered"`
 	Change         json.Number `json:"change"`
+	PaymentTerms   string      `json:"payment_terms"`
+	// Credit note fields
+	OriginalInvoice  LLMInvoiceReference `json:"original_invoice"`
+	AdjustmentReason string              `json:"adjustment_reason"`
+	// Delivery note and purchase order fields
+	DocumentNumber  string `json:"document_number"`
+	Warehouse       string `json:"warehouse"`
+	DeliveredBy     string `json:"delivered_by"`
+	ReceivedBy      string `json:"received_by"`
+	Vehicle         string `json:"vehicle"`
+	OrderNumber     string `json:"order_number"`
+	DeliveryDate    string `json:"delivery_date"`
+	DeliveryAddress string `json:"delivery_address"`
+	// Field bounding boxes (see WithBoundingBoxes)
+	Locations []LLMFieldLocation `json:"locations"`
+	// Paths of values written by hand (image prompts only)
+	HandwrittenFields []string `json:"handwritten_fields"`
+}
+
+// LLMInvoiceReference identifies the original invoice of a credit note
+type LLMInvoiceReference struct {
+	Number string `json:"number"`
+	Series string `json:"series"`
+	Date   string `json:"date"`
 }
 
 // LLMParty represents a party in the LLM response
@@ -151,21 +562,92 @@ type LLMLineItem struct {
 	DiscountPercent json.Number `json:"discount_percent"`
 	DiscountAmount  json.Number `json:"discount_amount"`
 	Amount          json.Number `json:"amount"`
-	VATRate         json.Number `json:"vat_rate"`
+	VATRate         LLMVATRate  `json:"vat_rate"`
 	VATAmount       json.Number `json:"vat_amount"`
 	Total           json.Number `json:"total"`
 }
 
-func (e *Extractor) parseResponse(response string) (*model.Invoice, error) {
+// decodeResponse extracts and unmarshals the JSON in a model response.
+// Malformed JSON goes through RepairJSON and numeric string coercion first,
+// and responses to an older contract are migrated (see ResponseSchemaVersion).
+func decodeResponse(response string) (*LLMResponse, error) {
+	resp, err := decodeJSON[LLMResponse](response)
+	if err != nil {
+		return nil, err
+	}
+	return migrateResponse(resp, response)
+}
+
+// decodeJSON decodes a model response into T, repairing it like decodeResponse
+func decodeJSON[T any](response string) (*T, error) {
 	// Extract JSON from response
 	jsonStr := ExtractJSON(response)
 
-	var llmResp LLMResponse
-	if err := json.Unmarshal([]byte(jsonStr), &llmResp); err != nil {
-		return nil, fmt.Errorf("failed to parse LLM response: %w", err)
+	var v T
+	err := json.Unmarshal([]byte(jsonStr), &v)
+	if err == nil {
+		return &v, nil
+	}
+
+	if repaired, cerr := coerceNumbers([]byte(RepairJSON(response)), reflect.TypeOf(v)); cerr == nil {
+		var fixed T
+		if json.Unmarshal(repaired, &fixed) == nil {
+			return &fixed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to parse LLM response: %w", err)
+}
+
+// decodeOrFix decodes a response, asking the model once to fix its JSON when
+// local repair is not enough
+func (e *Extractor) decodeOrFix(ctx context.Context, models []string, schema *ResponseSchema, systemPrompt, response string) (*LLMResponse, error) {
+	llmResp, err := decodeResponse(response)
+	if err == nil {
+		return llmResp, nil
+	}
+
+	if len(response) > maxFixJSONResponseLen {
+		response = response[:maxFixJSONResponseLen]
+	}
+	fixed, fixErr := e.complete(ctx, models, schema, systemPrompt, fmt.Sprintf(UserPromptFixJSON, err, response), nil)
+	if fixErr != nil {
+		return nil, err
+	}
+
+	if llmResp, fixErr := decodeResponse(fixed); fixErr == nil {
+		return llmResp, nil
+	}
+	return nil, err
+}
+
+// extractInvoice runs an extraction and converts the result, flagging fields
+// that self-consistency samples disagreed on
+func (e *Extractor) extractInvoice(ctx context.Context, models []string, schema *ResponseSchema, systemPrompt, userPrompt string, images []Image) (*model.Invoice, error) {
+	llmResp, disagreements, err := e.extractResponse(ctx, models, schema, systemPrompt, userPrompt, images)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := e.convertToInvoice(llmResp)
+	if err != nil {
+		return nil, err
 	}
+	inv.LowConfidenceFields = disagreements
 
-	return e.convertToInvoice(&llmResp)
+	return inv, nil
+}
+
+// refine runs the follow-up requests on a first-pass extraction: recovery of
+// missing required fields, including tax IDs rejected by their check, then
+// the arithmetic check. All are opt-in.
+func (e *Extractor) refine(ctx context.Context, inv *model.Invoice, models []string, document string, images []Image) *model.Invoice {
+	rejected := e.rejectTaxIDs(inv)
+	inv = e.recoverFields(ctx, inv, models, document, images)
+	settleTaxIDs(inv, rejected)
+	inv = e.correctArithmetic(ctx, inv, models, document, images)
+	inv.TaxBreakdown = model.SummarizeVAT(inv.Items)
+	return inv
 }
 
 func (e *Extractor) convertToInvoice(resp *LLMResponse) (*model.Invoice, error) {
@@ -174,11 +656,20 @@ func (e *Extractor) convertToInvoice(resp *LLMResponse) (*model.Invoice, error)
 	if docNumber == "" {
 		docNumber = resp.ReceiptNumber
 	}
+	if docNumber == "" {
+		docNumber = resp.DocumentNumber
+	}
+
+	// Amounts are parsed in the document's currency; VND when the model gave none
+	currency := resp.Currency
+	if currency == "" {
+		currency = "VND"
+	}
 
 	inv := &model.Invoice{
 		Number:         docNumber,
 		Series:         resp.Series,
-		Currency:       resp.Currency,
+		Currency:       currency,
 		Remarks:        resp.Notes,
 		Provider:       model.ProviderUnknown, // LLM doesn't identify provider
 		DocumentType:   parseDocumentType(resp.DocumentType),
@@ -187,8 +678,38 @@ func (e *Extractor) convertToInvoice(resp *LLMResponse) (*model.Invoice, error)
 		PaymentMethod:  resp.PaymentMethod,
 		ReceiptNumber:  resp.ReceiptNumber,
 		ReceiptTime:    resp.Time,
-		AmountTendered: parseDecimal(resp.AmountTendered),
-		Change:         parseDecimal(resp.Change),
+		AmountTendered: e.parseAmount(resp.AmountTendered, currency),
+		Change:         e.parseAmount(resp.Change, currency),
+		PaymentTerms:   resp.PaymentTerms,
+
+		AdjustmentReason: resp.AdjustmentReason,
+		FieldLocations:   fieldLocations(resp.Locations),
+
+		HasHandwriting:    len(resp.HandwrittenFields) > 0,
+		HandwrittenFields: resp.HandwrittenFields,
+	}
+
+	if ref := resp.OriginalInvoice; ref.Number != "" || ref.Series != "" {
+		inv.OriginalInvoice = &model.InvoiceReference{Number: ref.Number, Series: ref.Series}
+		if t, err := parseDate(ref.Date); err == nil {
+			inv.OriginalInvoice.Date = t
+		}
+	}
+
+	switch inv.DocumentType {
+	case model.DocumentTypeDeliveryNote:
+		inv.Delivery = &model.DeliveryInfo{
+			Warehouse:   resp.Warehouse,
+			DeliveredBy: resp.DeliveredBy,
+			ReceivedBy:  resp.ReceivedBy,
+			Vehicle:     resp.Vehicle,
+			OrderNumber: resp.OrderNumber,
+		}
+	case model.DocumentTypePurchaseOrder:
+		inv.Order = &model.PurchaseOrderInfo{DeliveryAddress: resp.DeliveryAddress}
+		if t, err := parseDate(resp.DeliveryDate); err == nil {
+			inv.Order.DeliveryDate = t
+		}
 	}
 
 	// Parse date
@@ -233,29 +754,30 @@ func (e *Extractor) convertToInvoice(resp *LLMResponse) (*model.Invoice, error)
 
 		// Parse decimals
 		lineItem.Quantity = parseDecimal(item.Quantity)
-		lineItem.UnitPrice = parseDecimal(item.UnitPrice)
+		lineItem.UnitPrice = e.parseAmount(item.UnitPrice, currency)
 		lineItem.Discount = parseDecimal(item.DiscountPercent)
-		lineItem.DiscountAmt = parseDecimal(item.DiscountAmount)
-		lineItem.Amount = parseDecimal(item.Amount)
-		lineItem.VATAmount = parseDecimal(item.VATAmount)
-		lineItem.Total = parseDecimal(item.Total)
+		lineItem.DiscountAmt = e.parseAmount(item.DiscountAmount, currency)
+		lineItem.Amount = e.parseAmount(item.Amount, currency)
+		lineItem.VATAmount = e.parseAmount(item.VATAmount, currency)
+		lineItem.Total = e.parseAmount(item.Total, currency)
 
 		// Parse VAT rate
-		if rate := parseDecimal(item.VATRate); !rate.IsZero() {
-			lineItem.VATRate = model.VATRate(rate.IntPart())
-		}
+		lineItem.VATRate = item.VATRate.vatRate()
 
 		inv.Items = append(inv.Items, lineItem)
 	}
 
 	// Parse totals
-	inv.SubtotalAmount = parseDecimal(resp.Subtotal)
-	inv.TaxAmount = parseDecimal(resp.TotalVAT)
-	inv.TotalAmount = parseDecimal(resp.TotalAmount)
-
-	// Set default currency if not provided
-	if inv.Currency == "" {
-		inv.Currency = "VND"
+	inv.SubtotalAmount = e.parseAmount(resp.Subtotal, currency)
+	inv.TaxAmount = e.parseAmount(resp.TotalVAT, currency)
+	inv.TotalAmount = e.parseAmount(resp.TotalAmount, currency)
+
+	// Foreign currency invoices print their rate and VND total
+	if inv.IsForeignCurrency() {
+		inv.ExchangeRate = e.parseAmount(resp.ExchangeRate, model.CurrencyVND)
+		if total := e.parseAmount(resp.TotalAmountVND, model.CurrencyVND); !total.IsZero() {
+			inv.VNDAmounts = &model.VNDAmounts{TotalAmount: total}
+		}
 	}
 
 	return inv, nil
@@ -296,26 +818,13 @@ func parseDocumentType(s string) model.DocumentType {
 	switch strings.ToLower(s) {
 	case "receipt":
 		return model.DocumentTypeReceipt
+	case "credit_note":
+		return model.DocumentTypeCreditNote
+	case "delivery_note":
+		return model.DocumentTypeDeliveryNote
+	case "purchase_order":
+		return model.DocumentTypePurchaseOrder
 	default:
 		return model.DocumentTypeInvoice
 	}
 }
-
-func parseDecimal(n json.Number) decimal.Decimal {
-	if n == "" {
-		return decimal.Zero
-	}
-
-	s := string(n)
-
-	// Handle Vietnamese number format
-	s = strings.ReplaceAll(s, ".", "")
-	s = strings.ReplaceAll(s, ",", ".")
-
-	d, err := decimal.NewFromString(s)
-	if err != nil {
-		return decimal.Zero
-	}
-
-	return d
-}
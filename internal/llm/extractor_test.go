@@ -0,0 +1,168 @@
+package llm_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// recordingProvider returns canned responses in order and records every request
+type recordingProvider struct {
+	mu        sync.Mutex
+	responses []string
+	requests  []*llm.Request
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	content := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	return &llm.Response{Content: content, Model: req.Model}, nil
+}
+
+func TestExtractor_ExtractFromImages(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"9","total_amount":500}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	pages := []llm.Image{
+		{Data: []byte("page1"), MimeType: "image/jpeg"},
+		{Data: []byte("page2"), MimeType: "image/jpeg"},
+	}
+	inv, err := extractor.ExtractFromImagesAuto(context.Background(), pages)
+	require.NoError(t, err)
+	assert.Equal(t, "9", inv.Number)
+
+	require.Len(t, provider.requests, 1)
+	req := provider.requests[0]
+	assert.Equal(t, pages, req.Images)
+	assert.Contains(t, req.UserPrompt, "The 2 images are consecutive pages")
+
+	// A single image gets the plain prompt
+	_, err = extractor.ExtractFromImage(context.Background(), []byte("one"), "image/png")
+	require.NoError(t, err)
+	assert.Equal(t, llm.UserPromptImageExtraction, provider.requests[1].UserPrompt)
+}
+
+func TestExtractor_ExtractAuto(t *testing.T) {
+	image := []llm.Image{{Data: []byte("img"), MimeType: "image/jpeg"}}
+
+	tests := []struct {
+		name     string
+		response string
+		wantType model.DocumentType
+		wantErr  error
+	}{
+		{
+			name:     "invoice",
+			response: `{"document_type":"invoice","invoice_number":"12","series":"1C24TAA","buyer":{"tax_id":"0312345678"}}`,
+			wantType: model.DocumentTypeInvoice,
+		},
+		{
+			name:     "receipt drops invoice-only fields",
+			response: `{"document_type":"receipt","receipt_number":"R1","series":"X","buyer":{"name":"guess"}}`,
+			wantType: model.DocumentTypeReceipt,
+		},
+		{
+			name:     "credit note",
+			response: `{"document_type":"credit_note","invoice_number":"45","original_invoice":{"number":"12","series":"1C24TAA","date":"2024-03-01"}}`,
+			wantType: model.DocumentTypeCreditNote,
+		},
+		{
+			name:     "delivery note",
+			response: `{"document_type":"delivery_note","document_number":"PXK-001","warehouse":"Kho Bình Dương"}`,
+			wantType: model.DocumentTypeDeliveryNote,
+		},
+		{
+			name:     "purchase order",
+			response: `{"document_type":"purchase_order","document_number":"PO-77","delivery_date":"2024-04-10"}`,
+			wantType: model.DocumentTypePurchaseOrder,
+		},
+		{
+			name:     "other",
+			response: `{"document_type":"other"}`,
+			wantErr:  llm.ErrNotInvoice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &recordingProvider{responses: []string{tt.response}}
+			extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+			inv, err := extractor.ExtractAuto(context.Background(), image)
+			assert.Equal(t, llm.AutoDetectSchema, provider.requests[0].Schema)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, inv.DocumentType)
+			if tt.wantType == model.DocumentTypeReceipt {
+				assert.Empty(t, inv.Series)
+				assert.Empty(t, inv.Buyer.Name)
+			}
+		})
+	}
+}
+
+func TestExtractor_AccountsPayableDocuments(t *testing.T) {
+	image := []llm.Image{{Data: []byte("img"), MimeType: "image/jpeg"}}
+	ctx := context.Background()
+
+	t.Run("credit note", func(t *testing.T) {
+		provider := &recordingProvider{responses: []string{`{"invoice_number":"45","adjustment_reason":"Trả lại hàng","original_invoice":{"number":"12","series":"1C24TAA","date":"2024-03-01"},"total_amount":110000}`}}
+		inv, err := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider))).ExtractCreditNote(ctx, image)
+		require.NoError(t, err)
+
+		assert.Equal(t, llm.CreditNoteSchema, provider.requests[0].Schema)
+		assert.Equal(t, model.DocumentTypeCreditNote, inv.DocumentType)
+		assert.Equal(t, model.InvoiceTypeAdjustment, inv.Type)
+		assert.Equal(t, "Trả lại hàng", inv.AdjustmentReason)
+		require.NotNil(t, inv.OriginalInvoice)
+		assert.Equal(t, "12", inv.OriginalInvoice.Number)
+		assert.Equal(t, "1C24TAA", inv.OriginalInvoice.Series)
+		assert.Equal(t, 2024, inv.OriginalInvoice.Date.Year())
+	})
+
+	t.Run("delivery note", func(t *testing.T) {
+		provider := &recordingProvider{responses: []string{`{"document_number":"PXK-001","warehouse":"Kho 1","received_by":"Trần B","order_number":"PO-77","items":[{"name":"Thép","quantity":20}]}`}}
+		extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithFieldRecovery(llm.FieldTotalAmount))
+		inv, err := extractor.ExtractDeliveryNote(ctx, image)
+		require.NoError(t, err)
+
+		require.Len(t, provider.requests, 1, "no total is requested for delivery notes")
+		assert.Equal(t, model.DocumentTypeDeliveryNote, inv.DocumentType)
+		assert.Equal(t, "PXK-001", inv.Number)
+		require.NotNil(t, inv.Delivery)
+		assert.Equal(t, "Kho 1", inv.Delivery.Warehouse)
+		assert.Equal(t, "Trần B", inv.Delivery.ReceivedBy)
+		assert.Equal(t, "PO-77", inv.Delivery.OrderNumber)
+		assert.Nil(t, inv.Order)
+	})
+
+	t.Run("purchase order", func(t *testing.T) {
+		provider := &recordingProvider{responses: []string{`{"document_number":"PO-77","delivery_date":"2024-04-10","delivery_address":"KCN Tân Tạo","payment_terms":"30 ngày"}`}}
+		inv, err := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider))).ExtractPurchaseOrder(ctx, image)
+		require.NoError(t, err)
+
+		assert.Equal(t, model.DocumentTypePurchaseOrder, inv.DocumentType)
+		assert.Equal(t, "PO-77", inv.Number)
+		assert.Equal(t, "30 ngày", inv.PaymentTerms)
+		require.NotNil(t, inv.Order)
+		assert.Equal(t, "KCN Tân Tạo", inv.Order.DeliveryAddress)
+		assert.Equal(t, 10, inv.Order.DeliveryDate.Day())
+	})
+}
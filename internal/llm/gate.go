@@ -0,0 +1,33 @@
+package llm
+
+import "context"
+
+// Gate decides whether a call may be sent to the provider, such as a budget
+// check. An error fails the call without sending it; answers from the
+// response cache are free and not gated.
+type Gate func(ctx context.Context, req *Request) error
+
+type gateKey struct{}
+
+// ContextWithGate gates the calls made with ctx. A gate already attached to
+// ctx is checked first.
+func ContextWithGate(ctx context.Context, gate Gate) context.Context {
+	if parent, ok := ctx.Value(gateKey{}).(Gate); ok {
+		child := gate
+		gate = func(ctx context.Context, req *Request) error {
+			if err := parent(ctx, req); err != nil {
+				return err
+			}
+			return child(ctx, req)
+		}
+	}
+	return context.WithValue(ctx, gateKey{}, gate)
+}
+
+// checkGate returns the error of the gate of ctx refusing req, or nil
+func checkGate(ctx context.Context, req *Request) error {
+	if gate, ok := ctx.Value(gateKey{}).(Gate); ok {
+		return gate(ctx, req)
+	}
+	return nil
+}
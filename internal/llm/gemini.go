@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultGeminiBaseURL is the Google Generative Language API endpoint
+const DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiConfig configures a Google Gemini provider
+type GeminiConfig struct {
+	APIKey  string
+	BaseURL string // Default: DefaultGeminiBaseURL
+	Timeout time.Duration
+	HTTP    HTTPOptions
+}
+
+// GeminiProvider calls the Gemini generateContent API
+type GeminiProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewGeminiProvider creates a Google Gemini provider
+func NewGeminiProvider(cfg GeminiConfig) *GeminiProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultGeminiBaseURL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &GeminiProvider{
+		apiKey:     cfg.APIKey,
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTP.httpClient(cfg.Timeout),
+	}
+}
+
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *geminiInlineData `json:"inline_data,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      float64        `json:"temperature"`
+	TopP             float64        `json:"topP,omitempty"`
+	MaxOutputTokens  int64          `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"system_instruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount        int64 `json:"promptTokenCount"`
+		CandidatesTokenCount    int64 `json:"candidatesTokenCount"`
+		CachedContentTokenCount int64 `json:"cachedContentTokenCount"` // Implicit cache hits
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+// Name returns the provider name
+func (p *GeminiProvider) Name() string {
+	return ProviderGemini
+}
+
+// Complete sends a generateContent request
+func (p *GeminiProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	url := fmt.Sprintf("%s/models/%s:generateContent", p.baseURL, req.Model)
+	httpReq, _, err := newJSONRequest(ctx, url, p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	var resp geminiResponse
+	if err := doJSON(p.httpClient, httpReq, ProviderGemini, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("no candidates in response")
+	}
+
+	var content strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		content.WriteString(part.Text)
+	}
+
+	model := resp.ModelVersion
+	if model == "" {
+		model = req.Model
+	}
+
+	return &Response{
+		Content: content.String(),
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:       resp.UsageMetadata.PromptTokenCount,
+			CompletionTokens:   resp.UsageMetadata.CandidatesTokenCount,
+			CachedPromptTokens: resp.UsageMetadata.CachedContentTokenCount,
+		},
+	}, nil
+}
+
+// CompleteStream sends a streamGenerateContent request and reads server-sent events
+func (p *GeminiProvider) CompleteStream(ctx context.Context, req *Request, handler StreamHandler) (*Response, error) {
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.baseURL, req.Model)
+	httpReq, _, err := newJSONRequest(ctx, url, p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	body, err := doStream(p.httpClient, httpReq, ProviderGemini)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	resp := &Response{Model: req.Model}
+	err = readSSE(body, func(data []byte) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to decode gemini stream: %w", err)
+		}
+
+		if chunk.ModelVersion != "" {
+			resp.Model = chunk.ModelVersion
+		}
+		// Usage metadata is cumulative; the last event carries the totals
+		if chunk.UsageMetadata.PromptTokenCount > 0 {
+			resp.Usage.PromptTokens = chunk.UsageMetadata.PromptTokenCount
+			resp.Usage.CompletionTokens = chunk.UsageMetadata.CandidatesTokenCount
+			resp.Usage.CachedPromptTokens = chunk.UsageMetadata.CachedContentTokenCount
+		}
+
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			content.WriteString(part.Text)
+			if err := handler(part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Content = content.String()
+	return resp, nil
+}
+
+func (p *GeminiProvider) buildRequest(req *Request) geminiRequest {
+	parts := []geminiPart{{Text: req.UserPrompt}}
+	for _, img := range req.Images {
+		parts = append(parts, geminiPart{InlineData: &geminiInlineData{
+			MimeType: img.MimeType,
+			Data:     base64.StdEncoding.EncodeToString(img.Data),
+		}})
+	}
+
+	payload := geminiRequest{
+		Contents: []geminiContent{{Role: "user", Parts: parts}},
+		GenerationConfig: geminiGenerationConfig{
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			MaxOutputTokens: req.MaxTokens,
+		},
+	}
+	if req.SystemPrompt != "" {
+		payload.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.SystemPrompt}}}
+	}
+	if req.Schema != nil {
+		payload.GenerationConfig.ResponseMimeType = "application/json"
+		payload.GenerationConfig.ResponseSchema = geminiSchema(req.Schema.Schema)
+	}
+
+	return payload
+}
+
+// geminiSchema converts a JSON schema to the OpenAPI subset Gemini accepts:
+// upper-case type names and no additionalProperties
+func geminiSchema(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch k {
+		case "additionalProperties":
+			continue
+		case "type":
+			if t, ok := v.(string); ok {
+				v = strings.ToUpper(t)
+			}
+		case "items":
+			if m, ok := v.(map[string]any); ok {
+				v = geminiSchema(m)
+			}
+		case "properties":
+			if props, ok := v.(map[string]any); ok {
+				converted := make(map[string]any, len(props))
+				for name, p := range props {
+					if m, ok := p.(map[string]any); ok {
+						converted[name] = geminiSchema(m)
+					}
+				}
+				v = converted
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
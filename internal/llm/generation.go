@@ -0,0 +1,80 @@
+package llm
+
+import "context"
+
+// GenerationParams tunes how a model samples its answer. Zero fields inherit
+// from the next level: per-call, then per-model, then extractor-wide, then
+// DefaultTemperature and DefaultMaxTokens.
+type GenerationParams struct {
+	Temperature *float64 // nil inherits; use Temperature(0) for explicit greedy decoding
+	TopP        float64  // 0 inherits (provider default)
+	MaxTokens   int64    // 0 inherits
+}
+
+// Temperature returns a pointer for GenerationParams.Temperature
+func Temperature(t float64) *float64 {
+	return &t
+}
+
+// merge returns p with the non-zero fields of override applied
+func (p GenerationParams) merge(override GenerationParams) GenerationParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP > 0 {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens > 0 {
+		p.MaxTokens = override.MaxTokens
+	}
+	return p
+}
+
+// apply sets the request's sampling fields
+func (p GenerationParams) apply(req *Request) {
+	if p.Temperature != nil {
+		req.Temperature = *p.Temperature
+	}
+	if p.TopP > 0 {
+		req.TopP = p.TopP
+	}
+	if p.MaxTokens > 0 {
+		req.MaxTokens = p.MaxTokens
+	}
+}
+
+// WithGenerationParams sets generation parameters for every request
+func WithGenerationParams(params GenerationParams) ExtractorOption {
+	return func(e *Extractor) {
+		e.generation = e.generation.merge(params)
+	}
+}
+
+// WithModelGenerationParams sets generation parameters for requests to model,
+// overriding WithGenerationParams. Fallback models can be tuned separately.
+func WithModelGenerationParams(model string, params GenerationParams) ExtractorOption {
+	return func(e *Extractor) {
+		if e.modelGeneration == nil {
+			e.modelGeneration = make(map[string]GenerationParams)
+		}
+		e.modelGeneration[model] = e.modelGeneration[model].merge(params)
+	}
+}
+
+type generationKey struct{}
+
+// ContextWithGenerationParams overrides generation parameters for extractions made with ctx
+func ContextWithGenerationParams(ctx context.Context, params GenerationParams) context.Context {
+	return context.WithValue(ctx, generationKey{}, GenerationParamsFromContext(ctx).merge(params))
+}
+
+// GenerationParamsFromContext returns the parameters attached by ContextWithGenerationParams
+func GenerationParamsFromContext(ctx context.Context) GenerationParams {
+	params, _ := ctx.Value(generationKey{}).(GenerationParams)
+	return params
+}
+
+// generationParams resolves the parameters for a request to model
+func (e *Extractor) generationParams(ctx context.Context, model string) GenerationParams {
+	return e.generation.merge(e.modelGeneration[model]).merge(GenerationParamsFromContext(ctx))
+}
@@ -0,0 +1,76 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_GenerationParamsPrecedence(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"1"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)),
+		llm.WithTextModel("text"),
+		llm.WithVisionModel("vision"),
+		llm.WithGenerationParams(llm.GenerationParams{Temperature: llm.Temperature(0.2), TopP: 0.9, MaxTokens: 2048}),
+		llm.WithModelGenerationParams("vision", llm.GenerationParams{Temperature: llm.Temperature(0), MaxTokens: 8192}),
+	)
+
+	ctx := context.Background()
+	_, err := extractor.ExtractFromText(ctx, "invoice")
+	require.NoError(t, err)
+	_, err = extractor.ExtractFromImage(ctx, []byte("img"), "image/png")
+	require.NoError(t, err)
+	_, err = extractor.ExtractFromText(llm.ContextWithGenerationParams(ctx, llm.GenerationParams{TopP: 0.5}), "invoice")
+	require.NoError(t, err)
+
+	require.Len(t, provider.requests, 3)
+
+	text := provider.requests[0]
+	assert.Equal(t, 0.2, text.Temperature)
+	assert.Equal(t, 0.9, text.TopP)
+	assert.Equal(t, int64(2048), text.MaxTokens)
+
+	vision := provider.requests[1]
+	assert.Equal(t, 0.0, vision.Temperature, "explicit zero overrides the extractor-wide temperature")
+	assert.Equal(t, 0.9, vision.TopP)
+	assert.Equal(t, int64(8192), vision.MaxTokens)
+
+	perCall := provider.requests[2]
+	assert.Equal(t, 0.2, perCall.Temperature)
+	assert.Equal(t, 0.5, perCall.TopP)
+}
+
+func TestExtractor_GenerationParamsDefaults(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"1"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	_, err := extractor.ExtractFromText(context.Background(), "invoice")
+	require.NoError(t, err)
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, llm.DefaultTemperature, provider.requests[0].Temperature)
+	assert.Zero(t, provider.requests[0].TopP)
+	assert.Equal(t, int64(llm.DefaultMaxTokens), provider.requests[0].MaxTokens)
+}
+
+func TestAnthropicProvider_SendsTopP(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"model":"claude","content":[{"type":"text","text":"ok"}]}`))
+	}))
+	defer srv.Close()
+
+	provider := llm.NewAnthropicProvider(llm.AnthropicConfig{BaseURL: srv.URL})
+	resp, err := provider.Complete(context.Background(), &llm.Request{Model: "claude", UserPrompt: "hi", MaxTokens: 10, TopP: 0.8})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.Content)
+	assert.Equal(t, 0.8, body["top_p"])
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// LLMFieldLocation is a bounding box the model reports for one extracted value
+type LLMFieldLocation struct {
+	Field string    `json:"field"` // JSON path, e.g. "seller.tax_id" or "items[0].total"
+	Page  int       `json:"page"`  // 1-based image number
+	Box   []float64 `json:"box"`   // [x0, y0, x1, y1] as fractions of the image size
+}
+
+// groundingFields are LLMResponse properties only requested with WithBoundingBoxes
+var groundingFields = []string{"locations"}
+
+// PromptBoundingBoxes is appended to vision prompts when bounding boxes are requested
+const PromptBoundingBoxes = `
+
+Also report where each extracted value appears in the image. Add a "locations" array with one entry per value:
+{"field": "seller.tax_id", "page": 1, "box": [x0, y0, x1, y1]}
+"field" is the JSON path of the value (use items[0].total for line items), "page" the 1-based image number,
+and "box" the top-left and bottom-right corners as fractions of the image width and height (0 to 1).
+Only report values you extracted; approximate boxes are fine.`
+
+// WithBoundingBoxes asks vision models for the approximate location of each
+// extracted field, recorded in Invoice.FieldLocations for review UIs
+func WithBoundingBoxes(enabled bool) ExtractorOption {
+	return func(e *Extractor) {
+		e.boundingBoxes = enabled
+	}
+}
+
+var groundedSchemas sync.Map // *ResponseSchema -> *ResponseSchema
+
+// groundedSchema returns schema with the locations property added
+func groundedSchema(schema *ResponseSchema) *ResponseSchema {
+	if schema == nil {
+		return nil
+	}
+	if cached, ok := groundedSchemas.Load(schema); ok {
+		return cached.(*ResponseSchema)
+	}
+
+	props, _ := schema.Schema["properties"].(map[string]any)
+	props = maps.Clone(props)
+	full := JSONSchemaFor(LLMResponse{})["properties"].(map[string]any)
+	for _, name := range groundingFields {
+		props[name] = full[name]
+	}
+
+	grounded := &ResponseSchema{
+		Name:        schema.Name,
+		Description: schema.Description,
+		Schema:      maps.Clone(schema.Schema),
+	}
+	grounded.Schema["properties"] = props
+
+	cached, _ := groundedSchemas.LoadOrStore(schema, grounded)
+	return cached.(*ResponseSchema)
+}
+
+// grounding adjusts a request for bounding boxes when enabled and images are sent
+func (e *Extractor) grounding(schema *ResponseSchema, userPrompt string, images []Image) (*ResponseSchema, string) {
+	if !e.boundingBoxes || len(images) == 0 {
+		return schema, userPrompt
+	}
+	return groundedSchema(schema), userPrompt + PromptBoundingBoxes
+}
+
+// fieldLocations converts reported boxes, dropping malformed ones. Boxes on a
+// 0-1000 scale, which some models use, are rescaled.
+func fieldLocations(locations []LLMFieldLocation) map[string]model.BoundingBox {
+	result := make(map[string]model.BoundingBox)
+	for _, loc := range locations {
+		if loc.Field == "" || len(loc.Box) != 4 {
+			continue
+		}
+
+		box := loc.Box
+		scale := 1.0
+		for _, v := range box {
+			if v > 1 {
+				scale = 1000
+			}
+		}
+		x0, y0 := clamp01(box[0]/scale), clamp01(box[1]/scale)
+		x1, y1 := clamp01(box[2]/scale), clamp01(box[3]/scale)
+		if x1 <= x0 || y1 <= y0 {
+			continue
+		}
+
+		result[loc.Field] = model.BoundingBox{
+			Page:   max(loc.Page, 1),
+			X:      x0,
+			Y:      y0,
+			Width:  x1 - x0,
+			Height: y1 - y0,
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func clamp01(v float64) float64 {
+	return min(max(v, 0), 1)
+}
@@ -0,0 +1,58 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_BoundingBoxes(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{
+		"invoice_number": "0000123",
+		"total_amount": 1100000,
+		"locations": [
+			{"field": "invoice_number", "page": 1, "box": [0.7, 0.05, 0.9, 0.08]},
+			{"field": "total_amount", "page": 2, "box": [600, 850, 900, 880]},
+			{"field": "seller.name", "box": [0.5, 0.5]},
+			{"field": "buyer.name", "box": [0.5, 0.5, 0.4, 0.6]}
+		]
+	}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithBoundingBoxes(true))
+
+	inv, err := extractor.ExtractFromImages(context.Background(), []llm.Image{{Data: []byte("p1"), MimeType: "image/png"}, {Data: []byte("p2"), MimeType: "image/png"}})
+	require.NoError(t, err)
+
+	require.Len(t, inv.FieldLocations, 2, "malformed boxes are dropped")
+	number := inv.FieldLocations["invoice_number"]
+	assert.Equal(t, 1, number.Page)
+	assert.InDelta(t, 0.7, number.X, 1e-9)
+	assert.InDelta(t, 0.2, number.Width, 1e-9)
+	assert.InDelta(t, 0.03, number.Height, 1e-9)
+
+	total := inv.FieldLocations["total_amount"]
+	assert.Equal(t, 2, total.Page)
+	assert.InDelta(t, 0.6, total.X, 1e-9, "0-1000 coordinates are rescaled")
+	assert.InDelta(t, 0.3, total.Width, 1e-9)
+
+	require.Len(t, provider.requests, 1)
+	req := provider.requests[0]
+	assert.Contains(t, req.UserPrompt, llm.PromptBoundingBoxes)
+	assert.Contains(t, req.Schema.Schema["properties"], "locations")
+	assert.NotContains(t, llm.InvoiceSchema.Schema["properties"], "locations", "shared schema is not modified")
+}
+
+func TestExtractor_BoundingBoxesTextOnly(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"1"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithBoundingBoxes(true))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "invoice")
+	require.NoError(t, err)
+	assert.Nil(t, inv.FieldLocations)
+
+	require.Len(t, provider.requests, 1)
+	assert.NotContains(t, provider.requests[0].UserPrompt, llm.PromptBoundingBoxes, "text has no page to locate fields on")
+}
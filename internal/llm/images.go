@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // Register PNG for image.Decode
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register WebP for image.Decode
+)
+
+// ImageBudget limits the images sent to a vision model. Larger images cost
+// more tokens and upload time without helping: providers scale them down to
+// these sizes anyway.
+type ImageBudget struct {
+	MaxLongSide int // Pixels on the longest side; 0 = no limit
+	MaxPixels   int // Width × height; 0 = no limit
+	MaxBytes    int // Encoded size; 0 = no limit
+}
+
+// ImageBudgetFor returns the budget matching how the model's provider resizes
+// images, judged from the model name
+func ImageBudgetFor(model string) ImageBudget {
+	name := strings.ToLower(model)
+	base := name[strings.LastIndex(name, "/")+1:] // Without a gateway prefix such as "openai/"
+	switch {
+	case strings.Contains(name, "claude"):
+		// Claude downscales past 1568px or ~1.15 megapixels; Bedrock caps images at 3.75MB
+		return ImageBudget{MaxLongSide: 1568, MaxPixels: 1_150_000, MaxBytes: 3_750_000}
+	case strings.Contains(name, "gemini"):
+		return ImageBudget{MaxLongSide: 3072, MaxPixels: 3072 * 3072, MaxBytes: 7_000_000}
+	case strings.Contains(base, "gpt"), strings.HasPrefix(base, "o1"), strings.HasPrefix(base, "o3"), strings.HasPrefix(base, "o4"):
+		// High detail fits images in 2048×2048, then scales the short side to 768
+		return ImageBudget{MaxLongSide: 2048, MaxPixels: 2048 * 768, MaxBytes: 10_000_000}
+	default:
+		return ImageBudget{MaxLongSide: 2048, MaxPixels: 2048 * 2048, MaxBytes: 5_000_000}
+	}
+}
+
+// WithImageBudget sends images within budget to every vision model instead of
+// the per-model budget from ImageBudgetFor
+func WithImageBudget(budget ImageBudget) ExtractorOption {
+	return func(e *Extractor) {
+		e.imageBudget = &budget
+	}
+}
+
+// WithImageDownscaling enables fitting images to the vision model's budget
+// before they are sent (default: enabled)
+func WithImageDownscaling(enabled bool) ExtractorOption {
+	return func(e *Extractor) {
+		e.downscaleImages = enabled
+	}
+}
+
+// fitImageQualities are the JPEG qualities tried, in order, to meet a byte budget
+var fitImageQualities = []int{85, 75, 60}
+
+// FitImage scales img down to fit budget and re-encodes it as JPEG. Images
+// already within budget, and data that cannot be decoded, are returned as is.
+// It reports whether the image was changed.
+func FitImage(img Image, budget ImageBudget) (Image, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return img, false
+	}
+
+	scale := budgetScale(cfg.Width, cfg.Height, budget)
+	if scale >= 1 && (budget.MaxBytes <= 0 || len(img.Data) <= budget.MaxBytes) {
+		return img, false
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return img, false
+	}
+
+	for {
+		scaled := resize(src, scale)
+		for _, quality := range fitImageQualities {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+				return img, false
+			}
+			if budget.MaxBytes <= 0 || buf.Len() <= budget.MaxBytes || scaled.Bounds().Dx() <= 64 {
+				return Image{Data: buf.Bytes(), MimeType: "image/jpeg"}, true
+			}
+		}
+		// Still too large at the lowest quality: shrink further
+		scale *= 0.75
+	}
+}
+
+// budgetScale returns the factor that brings a width × height image within the
+// pixel limits of budget, or 1 if it is within them
+func budgetScale(width, height int, budget ImageBudget) float64 {
+	scale := 1.0
+	if long := max(width, height); budget.MaxLongSide > 0 && long > budget.MaxLongSide {
+		scale = min(scale, float64(budget.MaxLongSide)/float64(long))
+	}
+	if pixels := width * height; budget.MaxPixels > 0 && pixels > budget.MaxPixels {
+		scale = min(scale, math.Sqrt(float64(budget.MaxPixels)/float64(pixels)))
+	}
+	return scale
+}
+
+// resize scales src by scale onto a white background, which replaces any
+// transparency since JPEG has none
+func resize(src image.Image, scale float64) image.Image {
+	bounds := src.Bounds()
+	width := max(int(float64(bounds.Dx())*scale), 1)
+	height := max(int(float64(bounds.Dy())*scale), 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+// fitImages fits images to the budget of model
+func (e *Extractor) fitImages(images []Image, model string) []Image {
+	if !e.downscaleImages || len(images) == 0 {
+		return images
+	}
+
+	if model == "" {
+		model = e.client.defaultModel
+	}
+	budget := ImageBudgetFor(model)
+	if e.imageBudget != nil {
+		budget = *e.imageBudget
+	}
+
+	var fitted []Image
+	for i, img := range images {
+		if resized, changed := FitImage(img, budget); changed {
+			if fitted == nil {
+				fitted = append([]Image(nil), images...)
+			}
+			fitted[i] = resized
+		}
+	}
+	if fitted == nil {
+		return images
+	}
+	return fitted
+}
@@ -0,0 +1,98 @@
+package llm_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// pngImage encodes a width × height PNG with a gradient, so it compresses like a photo
+func pngImage(t *testing.T, width, height int) llm.Image {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 7), G: uint8(y * 13), B: uint8(x ^ y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return llm.Image{Data: buf.Bytes(), MimeType: "image/png"}
+}
+
+func imageSize(t *testing.T, img llm.Image) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	require.NoError(t, err)
+	return cfg.Width, cfg.Height
+}
+
+func TestFitImage(t *testing.T) {
+	photo := pngImage(t, 1600, 1200)
+
+	fitted, changed := llm.FitImage(photo, llm.ImageBudget{MaxLongSide: 800})
+	require.True(t, changed)
+	assert.Equal(t, "image/jpeg", fitted.MimeType)
+	w, h := imageSize(t, fitted)
+	assert.Equal(t, 800, w)
+	assert.Equal(t, 600, h)
+
+	fitted, changed = llm.FitImage(photo, llm.ImageBudget{MaxPixels: 480_000})
+	require.True(t, changed)
+	w, h = imageSize(t, fitted)
+	assert.LessOrEqual(t, w*h, 480_000)
+	assert.InDelta(t, 4.0/3.0, float64(w)/float64(h), 0.01)
+
+	limit := len(photo.Data) / 10
+	fitted, changed = llm.FitImage(photo, llm.ImageBudget{MaxBytes: limit})
+	require.True(t, changed)
+	assert.LessOrEqual(t, len(fitted.Data), limit)
+}
+
+func TestFitImage_Unchanged(t *testing.T) {
+	small := pngImage(t, 300, 200)
+	fitted, changed := llm.FitImage(small, llm.ImageBudgetFor("claude-3-5-sonnet"))
+	assert.False(t, changed)
+	assert.Equal(t, small, fitted)
+
+	garbage := llm.Image{Data: []byte("not an image"), MimeType: "image/png"}
+	fitted, changed = llm.FitImage(garbage, llm.ImageBudget{MaxLongSide: 10})
+	assert.False(t, changed)
+	assert.Equal(t, garbage, fitted)
+}
+
+func TestImageBudgetFor(t *testing.T) {
+	assert.Equal(t, 1568, llm.ImageBudgetFor("anthropic/claude-3.5-sonnet").MaxLongSide)
+	assert.Equal(t, 2048*768, llm.ImageBudgetFor("openai/gpt-4o").MaxPixels)
+	assert.Equal(t, 2048*768, llm.ImageBudgetFor("o4-mini").MaxPixels)
+	assert.Equal(t, 3072, llm.ImageBudgetFor("gemini-1.5-pro").MaxLongSide)
+	assert.Equal(t, 2048, llm.ImageBudgetFor("llama3.2-vision").MaxLongSide)
+}
+
+func TestExtractor_DownscalesImages(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"1"}`}}
+	photo := pngImage(t, 2400, 1800)
+
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithVisionModel("claude-3-5-sonnet"))
+	_, err := extractor.ExtractFromImages(context.Background(), []llm.Image{photo})
+	require.NoError(t, err)
+
+	require.Len(t, provider.requests, 1)
+	sent := provider.requests[0].Images[0]
+	w, h := imageSize(t, sent)
+	assert.LessOrEqual(t, max(w, h), 1568)
+	assert.LessOrEqual(t, w*h, 1_150_000)
+
+	extractor = llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithImageDownscaling(false))
+	_, err = extractor.ExtractFromImages(context.Background(), []llm.Image{photo})
+	require.NoError(t, err)
+	assert.Equal(t, photo, provider.requests[1].Images[0])
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/logging"
+)
+
+// WithLogger logs every call: at debug level when it succeeds, at warn level
+// with the error when it fails. Calls made with a context that carries a
+// logger (logging.ContextWithLogger) are logged there instead, with the
+// caller's correlation ID.
+func WithLogger(l logging.Logger) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.logger = l
+	}
+}
+
+// WithExtractorLogger logs retries and fallbacks to other models, and passes
+// l on to the client for the calls themselves
+func WithExtractorLogger(l logging.Logger) ExtractorOption {
+	return func(e *Extractor) {
+		e.logger = l
+	}
+}
+
+// withLogger returns ctx logging to l unless it already has a logger
+func withLogger(ctx context.Context, l logging.Logger) context.Context {
+	if logging.LoggerFromContext(ctx) != nil {
+		return ctx
+	}
+	return logging.ContextWithLogger(ctx, l)
+}
+
+// logCall logs a finished call
+func (c *Client) logCall(ctx context.Context, req *Request, resp *Response, err error, start time.Time) {
+	ctx = withLogger(ctx, c.logger)
+	if logging.LoggerFromContext(ctx) == nil {
+		return
+	}
+
+	args := []any{
+		"provider", c.provider.Name(),
+		"model", req.Model,
+		"latency", time.Since(start),
+		"outcome", callOutcome(resp, err),
+	}
+	if doc := DocumentIDFromContext(ctx); doc != "" {
+		args = append(args, "document_id", doc)
+	}
+	if req.Schema != nil {
+		args = append(args, "schema", req.Schema.Name)
+	}
+	if info, ok := ctx.Value(attemptKey{}).(attemptInfo); ok {
+		args = append(args, "attempt", info.attempt, "fallback", info.fallback)
+	}
+	if err != nil {
+		logging.Warn(ctx, "LLM call failed", append(args, "error", err)...)
+		return
+	}
+	args = append(args, "prompt_tokens", resp.Usage.PromptTokens, "completion_tokens", resp.Usage.CompletionTokens)
+	logging.Debug(ctx, "LLM call", args...)
+}
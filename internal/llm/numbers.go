@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// NumberFormat describes how amounts in a currency are written on documents
+type NumberFormat struct {
+	DecimalSep   byte  // '.' or ','
+	ThousandsSep byte  // '.' or ','
+	Decimals     int32 // Minor unit digits; 0 means amounts are whole numbers
+}
+
+// DefaultNumberFormats are the formats for currencies common on Vietnamese invoices
+var DefaultNumberFormats = map[string]NumberFormat{
+	"VND": {DecimalSep: ',', ThousandsSep: '.', Decimals: 0},
+	"USD": {DecimalSep: '.', ThousandsSep: ',', Decimals: 2},
+	"EUR": {DecimalSep: ',', ThousandsSep: '.', Decimals: 2},
+	"GBP": {DecimalSep: '.', ThousandsSep: ',', Decimals: 2},
+	"JPY": {DecimalSep: '.', ThousandsSep: ',', Decimals: 0},
+	"KRW": {DecimalSep: '.', ThousandsSep: ',', Decimals: 0},
+	"CNY": {DecimalSep: '.', ThousandsSep: ',', Decimals: 2},
+	"SGD": {DecimalSep: '.', ThousandsSep: ',', Decimals: 2},
+	"THB": {DecimalSep: '.', ThousandsSep: ',', Decimals: 2},
+}
+
+// PlainNumberFormat reads numbers as JSON does, with ',' as an optional
+// thousands separator. It is used for quantities, rates and unknown currencies.
+var PlainNumberFormat = NumberFormat{DecimalSep: '.', ThousandsSep: ',', Decimals: 2}
+
+// WithNumberFormat sets how amounts in currency are parsed, overriding DefaultNumberFormats
+func WithNumberFormat(currency string, format NumberFormat) ExtractorOption {
+	return func(e *Extractor) {
+		if e.numberFormats == nil {
+			e.numberFormats = make(map[string]NumberFormat)
+		}
+		e.numberFormats[strings.ToUpper(currency)] = format
+	}
+}
+
+// ParseAmount parses a number written in format, such as "1.100.000 đ" for VND
+// or "1,234.56" for USD. A single separator followed by exactly three digits is
+// a thousands separator when it is format's ThousandsSep, when the currency has
+// no minor unit, or when format's DecimalSep is the other one; otherwise it is
+// a decimal point. With both separators present the last one is the decimal
+// point.
+func ParseAmount(s string, format NumberFormat) (decimal.Decimal, error) {
+	cleaned := numberJunk.ReplaceAllString(s, "")
+	if cleaned == "" {
+		return decimal.Zero, fmt.Errorf("no digits in %q", s)
+	}
+
+	lastDot, lastComma := strings.LastIndexByte(cleaned, '.'), strings.LastIndexByte(cleaned, ',')
+	decimalSep := byte(0)
+	switch {
+	case lastDot != -1 && lastComma != -1:
+		decimalSep = cleaned[max(lastDot, lastComma)]
+	case lastDot != -1:
+		decimalSep = format.decimalSep(cleaned, '.')
+	case lastComma != -1:
+		decimalSep = format.decimalSep(cleaned, ',')
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(cleaned); i++ {
+		switch c := cleaned[i]; {
+		case c == decimalSep:
+			b.WriteByte('.')
+		case c == '.' || c == ',':
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	d, err := decimal.NewFromString(b.String())
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid number %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// decimalSep returns sep if its occurrences in s read as a decimal point
+func (f NumberFormat) decimalSep(s string, sep byte) byte {
+	if strings.Count(s, string(sep)) > 1 {
+		return 0
+	}
+	if digits := len(s) - strings.IndexByte(s, sep) - 1; digits == 3 &&
+		(sep == f.ThousandsSep || f.Decimals == 0 || (f.DecimalSep != 0 && sep != f.DecimalSep)) {
+		return 0
+	}
+	return sep
+}
+
+// numberFormat returns the format for amounts in currency
+func (e *Extractor) numberFormat(currency string) NumberFormat {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if format, ok := e.numberFormats[currency]; ok {
+		return format
+	}
+	if format, ok := DefaultNumberFormats[currency]; ok {
+		return format
+	}
+	return PlainNumberFormat
+}
+
+// parseAmount parses a monetary value in currency; unparseable values are zero
+func (e *Extractor) parseAmount(n json.Number, currency string) decimal.Decimal {
+	if n == "" {
+		return decimal.Zero
+	}
+	d, err := ParseAmount(string(n), e.numberFormat(currency))
+	if err != nil {
+		return decimal.Zero
+	}
+	return d
+}
+
+// parseDecimal parses a quantity, percentage or rate; unparseable values are zero
+func parseDecimal(n json.Number) decimal.Decimal {
+	if n == "" {
+		return decimal.Zero
+	}
+	d, err := ParseAmount(string(n), PlainNumberFormat)
+	if err != nil {
+		return decimal.Zero
+	}
+	return d
+}
@@ -0,0 +1,93 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestParseAmount(t *testing.T) {
+	vnd := llm.DefaultNumberFormats["VND"]
+	usd := llm.DefaultNumberFormats["USD"]
+	eur := llm.DefaultNumberFormats["EUR"]
+
+	tests := []struct {
+		name   string
+		input  string
+		format llm.NumberFormat
+		want   string
+	}{
+		{"plain decimal in VND", "1234.56", vnd, "1234.56"},
+		{"VND thousands dots", "1.100.000", vnd, "1100000"},
+		{"VND single thousands dot", "1.100", vnd, "1100"},
+		{"VND thousands commas", "1,100,000", vnd, "1100000"},
+		{"VND decimal comma", "1.234,5", vnd, "1234.5"},
+		{"VND with symbol", "1.100.000 đ", vnd, "1100000"},
+		{"USD thousands comma", "1,234", usd, "1234"},
+		{"USD grouped decimal", "1,234.56", usd, "1234.56"},
+		{"USD three decimals", "1.234", usd, "1.234"},
+		{"EUR thousands dot", "1.234", eur, "1234"},
+		{"EUR decimal comma", "12,50", eur, "12.5"},
+		{"plain quantity", "1.500", llm.PlainNumberFormat, "1.5"},
+		{"decimal comma without grouping", "1.234", llm.NumberFormat{DecimalSep: ',', Decimals: 2}, "1234"},
+		{"decimal point without grouping", "1.234", llm.NumberFormat{DecimalSep: '.', Decimals: 3}, "1.234"},
+		{"negative", "-250.000", vnd, "-250000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := llm.ParseAmount(tt.input, tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+
+	_, err := llm.ParseAmount("n/a", vnd)
+	assert.Error(t, err)
+}
+
+func TestExtractor_AmountsUseCurrencyFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		opts     []llm.ExtractorOption
+		total    string
+		quantity string
+	}{
+		{
+			name:     "decimal amount is kept",
+			response: `{"invoice_number":"1","currency":"USD","total_amount":1234.56,"items":[{"name":"A","quantity":1.5,"unit_price":823.04}]}`,
+			total:    "1234.56",
+			quantity: "1.5",
+		},
+		{
+			name:     "VND thousands separator",
+			response: `{"invoice_number":"1","total_amount":1.100,"items":[{"name":"A","quantity":1.500,"unit_price":1.100}]}`,
+			total:    "1100",
+			quantity: "1.5",
+		},
+		{
+			name:     "configured format",
+			response: `{"invoice_number":"1","currency":"USD","total_amount":1.100,"items":[{"name":"A","quantity":1}]}`,
+			opts:     []llm.ExtractorOption{llm.WithNumberFormat("usd", llm.NumberFormat{DecimalSep: ',', ThousandsSep: '.', Decimals: 2})},
+			total:    "1100",
+			quantity: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := llm.NewClient("", llm.WithProvider(staticProvider{content: tt.response}))
+			inv, err := llm.NewExtractor(client, tt.opts...).ExtractFromText(context.Background(), "invoice")
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.total, inv.TotalAmount.String())
+			require.Len(t, inv.Items, 1)
+			assert.Equal(t, tt.quantity, inv.Items[0].Quantity.String())
+		})
+	}
+}
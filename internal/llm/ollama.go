@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultOllamaBaseURL is the default local Ollama server address
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaConfig configures an Ollama provider
+type OllamaConfig struct {
+	BaseURL string // Default: DefaultOllamaBaseURL
+	Timeout time.Duration
+	HTTP    HTTPOptions
+}
+
+// OllamaProvider calls a local or self-hosted Ollama server
+type OllamaProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewOllamaProvider creates an Ollama provider
+func NewOllamaProvider(cfg OllamaConfig) *OllamaProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultOllamaBaseURL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &OllamaProvider{
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTP.httpClient(cfg.Timeout),
+	}
+}
+
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p,omitempty"`
+	NumPredict  int64   `json:"num_predict,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   map[string]any  `json:"format,omitempty"` // JSON schema for structured output
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+}
+
+// Name returns the provider name
+func (p *OllamaProvider) Name() string {
+	return ProviderOllama
+}
+
+// Complete sends a non-streaming chat request
+func (p *OllamaProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, _, err := newJSONRequest(ctx, p.baseURL+"/api/chat", p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ollamaResponse
+	if err := doJSON(p.httpClient, httpReq, ProviderOllama, &resp); err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Content: resp.Message.Content,
+		Model:   resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+		},
+	}, nil
+}
+
+// CompleteStream sends a streaming chat request; Ollama answers with one JSON object per line
+func (p *OllamaProvider) CompleteStream(ctx context.Context, req *Request, handler StreamHandler) (*Response, error) {
+	httpReq, _, err := newJSONRequest(ctx, p.baseURL+"/api/chat", p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := doStream(p.httpClient, httpReq, ProviderOllama)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var content strings.Builder
+	resp := &Response{Model: req.Model}
+	decoder := json.NewDecoder(body)
+	for {
+		var chunk ollamaResponse
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode ollama stream: %w", err)
+		}
+
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		resp.Usage.PromptTokens += chunk.PromptEvalCount
+		resp.Usage.CompletionTokens += chunk.EvalCount
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if err := handler(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp.Content = content.String()
+	return resp, nil
+}
+
+func (p *OllamaProvider) buildRequest(req *Request, stream bool) ollamaRequest {
+	var messages []ollamaMessage
+	if req.SystemPrompt != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.SystemPrompt})
+	}
+
+	user := ollamaMessage{Role: "user", Content: req.UserPrompt}
+	for _, img := range req.Images {
+		user.Images = append(user.Images, base64.StdEncoding.EncodeToString(img.Data))
+	}
+	messages = append(messages, user)
+
+	payload := ollamaRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   stream,
+		Options: ollamaOptions{
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			NumPredict:  req.MaxTokens,
+		},
+	}
+	if req.Schema != nil {
+		payload.Format = req.Schema.Schema
+	}
+
+	return payload
+}
@@ -0,0 +1,305 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/openai/openai-go/shared"
+)
+
+// DefaultAzureAPIVersion is the Azure OpenAI API version used when none is configured
+const DefaultAzureAPIVersion = "2024-06-01"
+
+// OpenAIConfig configures an OpenAI-compatible provider
+type OpenAIConfig struct {
+	Name    string // Reported provider name, e.g. ProviderLiteLLM (default: ProviderOpenAI)
+	APIKey  string
+	BaseURL string // Default: DefaultBaseURL (OpenRouter)
+	Timeout time.Duration
+	HTTP    HTTPOptions
+
+	// ExtraBody fields are added to every request body as is, for gateway
+	// features the OpenAI API lacks: LiteLLM metadata and tags, OpenRouter
+	// provider routing and model fallbacks, per-user budgets
+	ExtraBody map[string]any
+}
+
+// AzureOpenAIConfig configures an Azure OpenAI provider.
+// Request models are used as deployment names.
+type AzureOpenAIConfig struct {
+	APIKey     string
+	Endpoint   string // https://<resource>.openai.azure.com
+	APIVersion string // Default: DefaultAzureAPIVersion
+	Timeout    time.Duration
+	HTTP       HTTPOptions
+}
+
+// OpenAIProvider talks to OpenAI-compatible chat completion APIs
+type OpenAIProvider struct {
+	name         string
+	client       openai.Client
+	visionClient openai.Client // Separate client for vision requests with special headers
+
+	// requestOptions returns per-request options (Azure deployment routing)
+	requestOptions func(model string) []option.RequestOption
+
+	// extraBody sets the configured OpenAIConfig.ExtraBody fields
+	extraBody []option.RequestOption
+}
+
+// visionHeaderTransport wraps an http.RoundTripper to add vision-specific headers
+type visionHeaderTransport struct {
+	base http.RoundTripper
+}
+
+func (t *visionHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Copilot-Vision-Request", "true")
+	if t.base != nil {
+		return t.base.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// NewOpenAIProvider creates a provider for OpenAI or any OpenAI-compatible gateway
+func NewOpenAIProvider(cfg OpenAIConfig) *OpenAIProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Name == "" {
+		cfg.Name = ProviderOpenAI
+	}
+
+	common := []option.RequestOption{
+		option.WithAPIKey(cfg.APIKey),
+		option.WithBaseURL(cfg.BaseURL),
+		option.WithHeader("HTTP-Referer", "https://github.com/rezonia/invoice-processor"),
+		option.WithHeader("X-Title", "Invoice Processor"),
+	}
+
+	p := newOpenAIProvider(cfg.Name, cfg.HTTP.httpClient(cfg.Timeout), common, nil)
+	// Sorted so request bodies, and so cache keys at the gateway, are stable
+	keys := make([]string, 0, len(cfg.ExtraBody))
+	for key := range cfg.ExtraBody {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p.extraBody = append(p.extraBody, option.WithJSONSet(key, cfg.ExtraBody[key]))
+	}
+	return p
+}
+
+// NewAzureOpenAIProvider creates a provider for Azure OpenAI Service
+func NewAzureOpenAIProvider(cfg AzureOpenAIConfig) *OpenAIProvider {
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = DefaultAzureAPIVersion
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+
+	common := []option.RequestOption{
+		option.WithHeaderDel("Authorization"), // Azure authenticates with api-key, not bearer tokens
+		option.WithHeader("Api-Key", cfg.APIKey),
+		option.WithQueryAdd("api-version", cfg.APIVersion),
+		option.WithBaseURL(endpoint + "/openai/"),
+	}
+
+	// Azure routes by deployment in the path rather than the model field
+	deployment := func(model string) []option.RequestOption {
+		return []option.RequestOption{
+			option.WithBaseURL(fmt.Sprintf("%s/openai/deployments/%s/", endpoint, model)),
+		}
+	}
+
+	return newOpenAIProvider(ProviderAzure, cfg.HTTP.httpClient(cfg.Timeout), common, deployment)
+}
+
+func newOpenAIProvider(name string, httpClient *http.Client, common []option.RequestOption, perRequest func(string) []option.RequestOption) *OpenAIProvider {
+	// Retries are driven by the Extractor's RetryPolicy, not the SDK
+	common = append(common, option.WithMaxRetries(0))
+
+	clientOpts := append([]option.RequestOption{
+		option.WithHTTPClient(httpClient),
+	}, common...)
+
+	// Build client options for vision client with custom transport
+	visionHTTPClient := *httpClient
+	visionHTTPClient.Transport = &visionHeaderTransport{
+		base: httpClient.Transport,
+	}
+	visionClientOpts := append([]option.RequestOption{
+		option.WithHTTPClient(&visionHTTPClient),
+	}, common...)
+
+	return &OpenAIProvider{
+		name:           name,
+		client:         openai.NewClient(clientOpts...),
+		visionClient:   openai.NewClient(visionClientOpts...),
+		requestOptions: perRequest,
+	}
+}
+
+// Name returns the provider name
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// Complete sends a chat completion request
+func (p *OpenAIProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	client, params, opts := p.buildParams(req)
+
+	resp, err := client.Chat.Completions.New(ctx, params, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	return chatCompletionResponse(resp)
+}
+
+// chatCompletionResponse returns the forced tool call arguments, or the message content
+func chatCompletionResponse(resp *openai.ChatCompletion) (*Response, error) {
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	content := resp.Choices[0].Message.Content
+	if toolCalls := resp.Choices[0].Message.ToolCalls; len(toolCalls) > 0 {
+		content = toolCalls[0].Function.Arguments
+	}
+
+	return &Response{
+		Content: content,
+		Model:   resp.Model,
+		Usage: Usage{
+			PromptTokens:       resp.Usage.PromptTokens,
+			CompletionTokens:   resp.Usage.CompletionTokens,
+			CachedPromptTokens: resp.Usage.PromptTokensDetails.CachedTokens,
+		},
+	}, nil
+}
+
+// CompleteStream sends a streaming chat completion request, passing content
+// (or forced tool call arguments) to handler as it arrives
+func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *Request, handler StreamHandler) (*Response, error) {
+	client, params, opts := p.buildParams(req)
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: param.NewOpt(true)}
+
+	stream := client.Chat.Completions.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	var content, arguments strings.Builder
+	resp := &Response{Model: req.Model}
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		resp.Usage.PromptTokens += chunk.Usage.PromptTokens
+		resp.Usage.CompletionTokens += chunk.Usage.CompletionTokens
+		resp.Usage.CachedPromptTokens += chunk.Usage.PromptTokensDetails.CachedTokens
+
+		for _, choice := range chunk.Choices {
+			delta := choice.Delta.Content
+			content.WriteString(delta)
+			for _, call := range choice.Delta.ToolCalls {
+				arguments.WriteString(call.Function.Arguments)
+				delta += call.Function.Arguments
+			}
+			if delta == "" {
+				continue
+			}
+			if err := handler(delta); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("chat completion stream failed: %w", err)
+	}
+
+	resp.Content = content.String()
+	if arguments.Len() > 0 {
+		resp.Content = arguments.String()
+	}
+
+	return resp, nil
+}
+
+// buildParams selects the client and builds completion params for req
+func (p *OpenAIProvider) buildParams(req *Request) (openai.Client, openai.ChatCompletionNewParams, []option.RequestOption) {
+	messages := []openai.ChatCompletionMessageParamUnion{}
+
+	if req.SystemPrompt != "" {
+		messages = append(messages, openai.SystemMessage(req.SystemPrompt))
+	}
+
+	client := p.client
+	if len(req.Images) == 0 {
+		messages = append(messages, openai.UserMessage(req.UserPrompt))
+	} else {
+		// Multimodal message with text and images as base64 data URLs
+		contentParts := []openai.ChatCompletionContentPartUnionParam{
+			openai.TextContentPart(req.UserPrompt),
+		}
+		for _, img := range req.Images {
+			contentParts = append(contentParts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+				URL: dataURL(img),
+			}))
+		}
+		messages = append(messages, openai.UserMessage(contentParts))
+
+		// Use visionClient which has the Copilot-Vision-Request header
+		client = p.visionClient
+	}
+
+	var opts []option.RequestOption
+	if p.requestOptions != nil {
+		opts = p.requestOptions(req.Model)
+	}
+	opts = append(opts, p.extraBody...)
+
+	params := openai.ChatCompletionNewParams{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   param.NewOpt(req.MaxTokens),
+		Temperature: param.NewOpt(req.Temperature),
+	}
+	if req.TopP > 0 {
+		params.TopP = param.NewOpt(req.TopP)
+	}
+
+	// Force a single tool call whose arguments follow the schema; tool calling
+	// is supported more widely across gateways than response_format
+	if req.Schema != nil {
+		params.Tools = []openai.ChatCompletionToolParam{{
+			Function: shared.FunctionDefinitionParam{
+				Name:        req.Schema.Name,
+				Description: param.NewOpt(req.Schema.Description),
+				Parameters:  shared.FunctionParameters(req.Schema.Schema),
+			},
+		}}
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionParamOfChatCompletionNamedToolChoice(
+			openai.ChatCompletionNamedToolChoiceFunctionParam{Name: req.Schema.Name},
+		)
+	}
+
+	return client, params, opts
+}
+
+// dataURL encodes an image as a base64 data URL
+func dataURL(img Image) string {
+	return fmt.Sprintf("data:%s;base64,%s", img.MimeType, base64.StdEncoding.EncodeToString(img.Data))
+}
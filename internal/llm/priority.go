@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Priority is the lane of a request waiting for a concurrency slot (see
+// WithMaxConcurrency). A free slot goes to the longest waiting interactive
+// request, and to batch requests only when none waits, so a backfill cannot
+// starve the documents a user is waiting for.
+type Priority int
+
+// Priorities, highest first
+const (
+	PriorityInteractive Priority = iota // Default: single documents, uploads
+	PriorityBatch                       // Batch runs and backfills
+)
+
+type priorityKey struct{}
+
+// ContextWithPriority sends the calls made with ctx in the lane of p
+func ContextWithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by ContextWithPriority, and
+// whether one was set
+func PriorityFromContext(ctx context.Context) (Priority, bool) {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	return p, ok
+}
+
+// slots is a counting semaphore handing free slots out by priority, first
+// come first served within a lane
+type slots struct {
+	mu      sync.Mutex
+	free    int
+	waiting [PriorityBatch + 1][]chan struct{}
+}
+
+func newSlots(n int) *slots {
+	return &slots{free: n}
+}
+
+// acquire waits for a slot for a request of priority p
+func (s *slots) acquire(ctx context.Context, p Priority) error {
+	p = min(max(p, PriorityInteractive), PriorityBatch)
+	s.mu.Lock()
+	if s.free > 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	s.waiting[p] = append(s.waiting[p], granted)
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	if i := slices.Index(s.waiting[p], granted); i >= 0 {
+		s.waiting[p] = slices.Delete(s.waiting[p], i, i+1)
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+	s.mu.Unlock()
+	s.release() // Granted while giving up; passed on
+	return ctx.Err()
+}
+
+// release hands the slot to the next waiting request, or frees it
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, lane := range s.waiting {
+		if len(lane) > 0 {
+			close(lane[0])
+			s.waiting[p] = lane[1:]
+			return
+		}
+	}
+	s.free++
+}
@@ -29,6 +29,8 @@ Common Vietnamese invoice terms:
 Extract ALL information you can find. If a field is not present, omit it from the output.
 Always output valid JSON that matches the specified schema.
 Numbers should be parsed as integers (for VND) or decimals.
+VAT rates (vat_rate) are percentages such as "10" or "8", or "KCT" (không chịu thuế) and "KKKNT" (không kê khai, tính nộp thuế) for lines outside VAT.
+Amounts are in the invoice's currency (currency, an ISO code). For foreign currency invoices, exchange_rate is the rate to VND (tỷ giá) and total_amount_vnd the total converted to VND (quy đổi) when printed.
 Dates should be in ISO 8601 format (YYYY-MM-DD).`
 
 const UserPromptTextExtraction = `Extract invoice data from the following text:
@@ -39,6 +41,7 @@ const UserPromptTextExtraction = `Extract invoice data from the following text:
 
 Output JSON with this structure:
 {
+  "schema_version": 1,
   "invoice_number": "string",
   "series": "string",
   "date": "YYYY-MM-DD",
@@ -70,7 +73,7 @@ Output JSON with this structure:
       "discount_percent": 0,
       "discount_amount": 0,
       "amount": 100000,
-      "vat_rate": 10,
+      "vat_rate": "10",
       "vat_amount": 10000,
       "total": 110000
     }
@@ -80,6 +83,8 @@ Output JSON with this structure:
   "total_vat": 10000,
   "total_amount": 110000,
   "currency": "VND",
+  "exchange_rate": 0,
+  "total_amount_vnd": 0,
   "payment_method": "string",
   "notes": "string"
 }`
@@ -88,6 +93,7 @@ const UserPromptImageExtraction = `Extract invoice data from this invoice image.
 
 Output JSON with this structure:
 {
+  "schema_version": 1,
   "invoice_number": "string",
   "series": "string",
   "date": "YYYY-MM-DD",
@@ -119,7 +125,7 @@ Output JSON with this structure:
       "discount_percent": 0,
       "discount_amount": 0,
       "amount": 100000,
-      "vat_rate": 10,
+      "vat_rate": "10",
       "vat_amount": 10000,
       "total": 110000
     }
@@ -129,11 +135,13 @@ Output JSON with this structure:
   "total_vat": 10000,
   "total_amount": 110000,
   "currency": "VND",
+  "exchange_rate": 0,
+  "total_amount_vnd": 0,
   "payment_method": "string",
   "notes": "string"
 }
 
-Extract all visible information from the invoice image. For any text that appears blurry or unclear, make your best attempt to read it.`
+Extract all visible information from the invoice image. For any text that appears blurry or unclear, make your best attempt to read it.` + PromptHandwriting
 
 const UserPromptOCRCorrection = `The following is OCR-extracted text from a Vietnamese invoice. It may contain errors.
 
@@ -188,6 +196,7 @@ const UserPromptReceiptExtraction = `Extract receipt data from this receipt imag
 
 Output JSON with this structure:
 {
+  "schema_version": 1,
   "document_type": "receipt",
   "receipt_number": "string",
   "date": "YYYY-MM-DD",
@@ -224,21 +233,27 @@ Notes:
 - payment_method should be one of: cash, card, e-wallet, transfer
 - amount_tendered and change are for cash payments only
 - time field is optional, include if visible
-- Extract store name from header/logo area`
+- Extract store name from header/logo area` + PromptHandwriting
 
 const UserPromptAutoDetectExtraction = `Analyze this document image and extract data.
 
 First, determine the document type:
 - "invoice" = Formal tax invoice with seller/buyer tax IDs, VAT breakdown, invoice series/number
 - "receipt" = Retail POS receipt, thermal paper, no buyer tax ID, simpler format
+- "credit_note" = Invoice that reduces an earlier invoice (Hóa đơn điều chỉnh giảm, credit note), referencing the original invoice
+- "delivery_note" = Goods dispatch or delivery document (Phiếu xuất kho, Phiếu giao hàng, Biên bản giao nhận), often without prices
+- "purchase_order" = Order placed by the buyer (Đơn đặt hàng, Purchase order)
+- "other" = Anything else (quotation, contract, bank statement, photo)
 
-Then extract all available data.
+For "other", output only {"document_type": "other"}. Otherwise extract all available data.
 
 Output JSON with this structure:
 {
-  "document_type": "invoice|receipt",
-  "invoice_number": "string (for invoices)",
+  "schema_version": 1,
+  "document_type": "invoice|receipt|credit_note|delivery_note|purchase_order|other",
+  "invoice_number": "string (for invoices and credit notes)",
   "receipt_number": "string (for receipts)",
+  "document_number": "string (for delivery notes and purchase orders)",
   "series": "string (for invoices only)",
   "date": "YYYY-MM-DD",
   "seller": {
@@ -258,7 +273,255 @@ Output JSON with this structure:
   "total_vat": 0,
   "total_amount": 0,
   "payment_method": "string",
+  "currency": "VND",
+  "exchange_rate": 0,
+  "total_amount_vnd": 0,
+  "original_invoice": {"number": "string", "series": "string", "date": "YYYY-MM-DD"} (for credit notes),
+  "adjustment_reason": "string (for credit notes)",
+  "warehouse": "string (for delivery notes)",
+  "delivered_by": "string (for delivery notes)",
+  "received_by": "string (for delivery notes)",
+  "vehicle": "string (for delivery notes)",
+  "order_number": "string (purchase order a delivery note fulfils)",
+  "delivery_date": "YYYY-MM-DD (for purchase orders)",
+  "delivery_address": "string (for purchase orders)",
+  "payment_terms": "string"
+}
+
+Include only fields that are present in the document.` + PromptHandwriting
+
+// Credit note, delivery note and purchase order prompts use SystemPromptInvoiceExtractor
+
+const UserPromptCreditNoteExtraction = `Extract data from this credit note (Hóa đơn điều chỉnh giảm) image.
+
+A credit note reduces the amounts of an earlier invoice. It usually states "Điều chỉnh giảm cho hóa đơn số ... ký hiệu ... ngày ...".
+
+Output JSON with this structure:
+{
+  "schema_version": 1,
+  "document_type": "credit_note",
+  "invoice_number": "string (number of this credit note)",
+  "series": "string",
+  "date": "YYYY-MM-DD",
+  "type": "adjustment",
+  "original_invoice": {
+    "number": "string",
+    "series": "string",
+    "date": "YYYY-MM-DD"
+  },
+  "adjustment_reason": "string",
+  "seller": {"name": "string", "tax_id": "string", "address": "string"},
+  "buyer": {"name": "string", "tax_id": "string", "address": "string"},
+  "items": [
+    {"number": 1, "name": "string", "unit": "string", "quantity": 1, "unit_price": 100000, "amount": 100000, "vat_rate": "10", "vat_amount": 10000, "total": 110000}
+  ],
+  "subtotal": 100000,
+  "total_vat": 10000,
+  "total_amount": 110000,
   "currency": "VND"
 }
 
-Include only fields that are present in the document.`
+Record amounts as printed, without adding a minus sign; the document type marks them as reductions.` + PromptHandwriting
+
+const UserPromptDeliveryNoteExtraction = `Extract data from this delivery note (Phiếu xuất kho, Phiếu giao hàng) image.
+
+Output JSON with this structure:
+{
+  "schema_version": 1,
+  "document_type": "delivery_note",
+  "document_number": "string",
+  "date": "YYYY-MM-DD",
+  "seller": {"name": "string (shipper)", "tax_id": "string", "address": "string"},
+  "buyer": {"name": "string (recipient)", "tax_id": "string", "address": "string (delivery address)"},
+  "warehouse": "string (Xuất tại kho)",
+  "delivered_by": "string (Người giao hàng)",
+  "received_by": "string (Người nhận hàng)",
+  "vehicle": "string (vehicle plate or carrier)",
+  "order_number": "string (purchase order or contract referenced)",
+  "items": [
+    {"number": 1, "code": "string", "name": "string", "unit": "string", "quantity": 1, "unit_price": 100000, "amount": 100000}
+  ],
+  "total_amount": 100000,
+  "notes": "string"
+}
+
+Delivery notes often show quantities only; omit prices and totals that are not printed.` + PromptHandwriting
+
+const UserPromptPurchaseOrderExtraction = `Extract data from this purchase order (Đơn đặt hàng) image.
+
+The buyer is the company placing the order; the seller is the supplier it is addressed to.
+
+Output JSON with this structure:
+{
+  "schema_version": 1,
+  "document_type": "purchase_order",
+  "document_number": "string (PO number)",
+  "date": "YYYY-MM-DD",
+  "seller": {"name": "string (supplier)", "tax_id": "string", "address": "string"},
+  "buyer": {"name": "string", "tax_id": "string", "address": "string"},
+  "items": [
+    {"number": 1, "code": "string", "name": "string", "unit": "string", "quantity": 1, "unit_price": 100000, "amount": 100000, "vat_rate": "10"}
+  ],
+  "subtotal": 100000,
+  "total_vat": 10000,
+  "total_amount": 110000,
+  "currency": "VND",
+  "delivery_date": "YYYY-MM-DD",
+  "delivery_address": "string",
+  "payment_terms": "string"
+}` + PromptHandwriting
+
+// Bank statement prompts
+
+const SystemPromptStatementExtractor = `You are an expert bank statement data extractor specializing in Vietnamese bank statements (sao kê tài khoản).
+
+Common Vietnamese statement terms:
+- Số tài khoản = Account number
+- Chủ tài khoản = Account holder
+- Số dư đầu kỳ = Opening balance
+- Số dư cuối kỳ = Closing balance
+- Ghi nợ / Rút ra / Phát sinh nợ = Debit (money out)
+- Ghi có / Gửi vào / Phát sinh có = Credit (money in)
+- Nội dung / Diễn giải = Description
+- Số dư = Balance
+- Số bút toán / Số tham chiếu = Reference
+
+Extract EVERY transaction row, in the order printed. Do not summarize or skip rows.
+Always output valid JSON that matches the specified schema.
+Dates should be in ISO 8601 format (YYYY-MM-DD).`
+
+const statementStructure = `Output JSON with this structure:
+{
+  "bank_name": "string",
+  "account_number": "string",
+  "account_holder": "string",
+  "currency": "VND",
+  "period_start": "YYYY-MM-DD",
+  "period_end": "YYYY-MM-DD",
+  "opening_balance": 10000000,
+  "closing_balance": 12500000,
+  "transactions": [
+    {"date": "YYYY-MM-DD", "description": "string", "reference": "string", "counterparty": "string", "amount": 2500000, "balance": 12500000}
+  ]
+}
+
+Amounts are signed: credits (money in) are positive and debits (money out) are negative.
+"balance" is the running balance printed after the transaction; omit it if the statement has no balance column.`
+
+const UserPromptStatementExtraction = `Extract data from this bank statement image.
+
+` + statementStructure
+
+// UserPromptStatementText is the text template for statements; %s is the statement text
+const UserPromptStatementText = `Extract data from the following bank statement text:
+
+---
+%s
+---
+
+` + statementStructure
+
+// Document splitting prompts use SystemPromptInvoiceExtractor
+
+// UserPromptSplitText finds invoice boundaries; %d is the page count and %s the page texts
+const UserPromptSplitText = `The following %d pages come from one file that may contain several separate invoices
+(for example a landlord or utility bundling one invoice per unit or per month).
+
+%s
+Identify each separate invoice. A new invoice usually starts with its own header (HÓA ĐƠN, Số, Ký hiệu)
+and a different invoice number; continuation pages and attachments belong to the invoice before them.
+
+Output JSON: {"documents": [{"start_page": 1, "end_page": 2}, {"start_page": 3, "end_page": 3}]}
+List documents in page order. If the file is a single invoice, return one document covering all pages.`
+
+// UserPromptSplitImages finds invoice boundaries in page images; %d is the page count
+const UserPromptSplitImages = `The %d images are consecutive pages of one file that may contain several separate invoices
+(for example a landlord or utility bundling one invoice per unit or per month).
+
+Identify each separate invoice. A new invoice usually starts with its own header (HÓA ĐƠN, Số, Ký hiệu)
+and a different invoice number; continuation pages and attachments belong to the invoice before them.
+
+Output JSON: {"documents": [{"start_page": 1, "end_page": 2}, {"start_page": 3, "end_page": 3}]}
+List documents in page order. If the file is a single invoice, return one document covering all pages.`
+
+// PromptHandwriting asks image prompts to flag handwritten values
+const PromptHandwriting = `
+
+Also output "handwritten_fields": the JSON paths of extracted values that are handwritten rather than printed
+(for example ["total_amount", "buyer.name", "items[2].quantity"]). Use an empty list when every value is printed.`
+
+// PromptMultiImageNote is appended to image prompts when a request carries several images
+const PromptMultiImageNote = `
+
+The %d images are consecutive pages (or front and back) of ONE document, in order.
+Combine them into a single result: line items may continue across pages and totals usually appear on the last page.`
+
+// UserPromptFieldRecovery asks again for fields a previous extraction missed; %s is the field list
+const UserPromptFieldRecovery = `A previous extraction of this document could not find the following fields:
+%s
+Look carefully at the whole document, including headers, footers, stamps and signature blocks, and extract ONLY these fields.
+Return JSON containing just these fields. Omit a field if it really is not in the document; do not guess.`
+
+// UserPromptArithmeticCorrection asks the model to re-read amounts that do not
+// add up; the first %s lists the discrepancies, the second the amounts as extracted
+const UserPromptArithmeticCorrection = `The amounts extracted from this document do not add up:
+%s
+Amounts as extracted:
+%s
+
+Re-read the line items and totals on the document and return all of these amounts again, correcting any that were misread
+(a dropped or extra digit, a misplaced thousands separator, a value taken from the wrong column or row).
+Keep the items in the same order and return every item. Return a value as printed even if the document's own arithmetic is wrong; do not compute values that are not printed.`
+
+// UserPromptAddresses asks for addresses split into administrative units; %d is
+// the number of addresses and %s the numbered list
+const UserPromptAddresses = `Split each of the following %d Vietnamese addresses into administrative units:
+- street: house number, street, building, hamlet (thôn, ấp) or industrial park
+- ward: phường, xã or thị trấn, with its type, e.g. "Phường Bến Nghé", "Xã Tân Hội"
+- district: quận, huyện, thị xã or provincial city, with its type, e.g. "Quận 1", "Thành phố Thủ Đức"; empty if the address has none
+- province: the province or centrally governed city without "Tỉnh" or "Thành phố", e.g. "Hồ Chí Minh", "Bình Dương"
+
+Expand abbreviations (P., Q., TP., H.) and restore missing Vietnamese diacritics in unit names.
+Return one entry per address, in the same order. Leave a unit empty if it is not in the address; do not guess.
+
+%s`
+
+// UserPromptFixJSON asks the model to resend a malformed response as valid JSON;
+// the first %v is the parse error, the second %s the previous response
+const UserPromptFixJSON = `Your previous response could not be parsed as JSON (%v).
+
+Previous response:
+---
+%s
+---
+
+Return the same data again as a single valid JSON object. Output only the JSON, without code fences or commentary.`
+
+// PromptRedactionNote is appended to text prompts when personal data was replaced by placeholders
+const PromptRedactionNote = `
+
+Some personal data in the document has been replaced by placeholders such as [PHONE_1] or [NAME_1].
+Copy placeholders into the output exactly as written, in the fields where the original values belong.`
+
+// Document classification prompts
+
+const SystemPromptDocumentClassifier = `You sort the documents of an accounts payable inbox before invoice extraction.
+Label each document with one class:
+- invoice: an invoice or bill from a seller, including Vietnamese e-invoices (hóa đơn), utility bills and credit notes
+- receipt: a payment receipt from a shop, restaurant, taxi or POS terminal (hóa đơn bán lẻ, biên lai, phiếu thu)
+- other: anything else, such as contracts (hợp đồng), quotations, letters, delivery photos and product pictures
+Always output valid JSON that matches the specified schema.`
+
+// UserPromptClassifyText classifies a document from its text; %s is the start of the text
+const UserPromptClassifyText = `Classify the following document.
+
+---
+%s
+---
+
+Output JSON: {"class": "invoice|receipt|other", "reason": "a few words"}`
+
+// UserPromptClassifyImage classifies a document from its first page image
+const UserPromptClassifyImage = `Classify the document in the image.
+
+Output JSON: {"class": "invoice|receipt|other", "reason": "a few words"}`
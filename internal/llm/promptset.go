@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// PromptSet holds the prompts used by the Extractor.
+// Empty fields fall back to the defaults in prompts.go.
+type PromptSet struct {
+	SystemInvoice   string // System prompt for invoice extraction
+	SystemReceipt   string // System prompt for receipt and auto-detect extraction
+	Text            string // Text extraction template; %s is replaced by the document text
+	OCR             string // Noisy OCR text template; %s is replaced by the OCR text
+	Image           string // Invoice image extraction
+	Receipt         string // Receipt image extraction
+	AutoDetect      string // Image extraction with document type detection
+	CreditNote      string // Credit note image extraction
+	DeliveryNote    string // Delivery note image extraction
+	PurchaseOrder   string // Purchase order image extraction
+	SystemStatement string // System prompt for bank statement extraction
+	Statement       string // Bank statement image extraction
+	StatementText   string // Bank statement text template; %s is replaced by the statement text
+}
+
+// promptFiles maps file names used by LoadPromptSet to PromptSet fields
+var promptFiles = map[string]func(*PromptSet) *string{
+	"system_invoice.txt":   func(p *PromptSet) *string { return &p.SystemInvoice },
+	"system_receipt.txt":   func(p *PromptSet) *string { return &p.SystemReceipt },
+	"text.txt":             func(p *PromptSet) *string { return &p.Text },
+	"ocr.txt":              func(p *PromptSet) *string { return &p.OCR },
+	"image.txt":            func(p *PromptSet) *string { return &p.Image },
+	"receipt.txt":          func(p *PromptSet) *string { return &p.Receipt },
+	"auto_detect.txt":      func(p *PromptSet) *string { return &p.AutoDetect },
+	"credit_note.txt":      func(p *PromptSet) *string { return &p.CreditNote },
+	"delivery_note.txt":    func(p *PromptSet) *string { return &p.DeliveryNote },
+	"purchase_order.txt":   func(p *PromptSet) *string { return &p.PurchaseOrder },
+	"system_statement.txt": func(p *PromptSet) *string { return &p.SystemStatement },
+	"statement.txt":        func(p *PromptSet) *string { return &p.Statement },
+	"statement_text.txt":   func(p *PromptSet) *string { return &p.StatementText },
+}
+
+// DefaultPrompts returns the built-in prompts
+func DefaultPrompts() PromptSet {
+	return PromptSet{
+		SystemInvoice:   SystemPromptInvoiceExtractor,
+		SystemReceipt:   SystemPromptReceiptExtractor,
+		Text:            UserPromptTextExtraction,
+		OCR:             UserPromptOCRCorrection,
+		Image:           UserPromptImageExtraction,
+		Receipt:         UserPromptReceiptExtraction,
+		AutoDetect:      UserPromptAutoDetectExtraction,
+		CreditNote:      UserPromptCreditNoteExtraction,
+		DeliveryNote:    UserPromptDeliveryNoteExtraction,
+		PurchaseOrder:   UserPromptPurchaseOrderExtraction,
+		SystemStatement: SystemPromptStatementExtractor,
+		Statement:       UserPromptStatementExtraction,
+		StatementText:   UserPromptStatementText,
+	}
+}
+
+// WithDefaults returns a copy with empty fields filled from DefaultPrompts
+func (p PromptSet) WithDefaults() PromptSet {
+	defaults := DefaultPrompts()
+	for _, field := range promptFiles {
+		if *field(&p) == "" {
+			*field(&p) = *field(&defaults)
+		}
+	}
+	return p
+}
+
+// Validate checks that text templates have exactly one %s placeholder
+func (p PromptSet) Validate() error {
+	for name, tmpl := range map[string]string{"text": p.Text, "ocr": p.OCR, "statement_text": p.StatementText} {
+		if tmpl == "" {
+			continue
+		}
+		if n := strings.Count(tmpl, "%s"); n != 1 {
+			return fmt.Errorf("%s prompt must contain exactly one %%s placeholder, found %d", name, n)
+		}
+	}
+	return nil
+}
+
+// LoadPromptSet reads prompt overrides from fsys. Recognized files are
+// system_invoice.txt, system_receipt.txt, text.txt, ocr.txt, image.txt,
+// receipt.txt, auto_detect.txt, credit_note.txt, delivery_note.txt,
+// purchase_order.txt, system_statement.txt, statement.txt and
+// statement_text.txt; missing files keep the defaults.
+func LoadPromptSet(fsys fs.FS) (PromptSet, error) {
+	var p PromptSet
+	for name, field := range promptFiles {
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return PromptSet{}, fmt.Errorf("failed to read prompt %s: %w", name, err)
+		}
+		*field(&p) = string(data)
+	}
+
+	if err := p.Validate(); err != nil {
+		return PromptSet{}, err
+	}
+
+	return p.WithDefaults(), nil
+}
+
+// LoadPromptSetDir reads prompt overrides from a directory
+func LoadPromptSetDir(dir string) (PromptSet, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return PromptSet{}, fmt.Errorf("prompt directory: %w", err)
+	}
+	return LoadPromptSet(os.DirFS(dir))
+}
+
+// merge returns p with the non-empty fields of override applied
+func (p PromptSet) merge(override PromptSet) PromptSet {
+	for _, field := range promptFiles {
+		if v := *field(&override); v != "" {
+			*field(&p) = v
+		}
+	}
+	return p
+}
+
+type promptsKey struct{}
+
+// ContextWithPrompts overrides prompts for extractions made with ctx, such as
+// a prompt tuned for one supplier's layout. Empty fields keep the extractor's
+// prompts; text templates must pass Validate.
+func ContextWithPrompts(ctx context.Context, prompts PromptSet) context.Context {
+	return context.WithValue(ctx, promptsKey{}, PromptsFromContext(ctx).merge(prompts))
+}
+
+// PromptsFromContext returns the overrides attached by ContextWithPrompts
+func PromptsFromContext(ctx context.Context) PromptSet {
+	prompts, _ := ctx.Value(promptsKey{}).(PromptSet)
+	return prompts
+}
+
+// promptSet returns the prompts for an extraction made with ctx
+func (e *Extractor) promptSet(ctx context.Context) PromptSet {
+	overrides, ok := ctx.Value(promptsKey{}).(PromptSet)
+	if !ok {
+		return e.prompts
+	}
+	return e.prompts.merge(overrides)
+}
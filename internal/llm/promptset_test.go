@@ -0,0 +1,45 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestLoadPromptSet(t *testing.T) {
+	fsys := fstest.MapFS{
+		"system_invoice.txt": {Data: []byte("You extract construction invoices.")},
+		"text.txt":           {Data: []byte("Construction invoice:\n%s")},
+	}
+
+	prompts, err := llm.LoadPromptSet(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, "You extract construction invoices.", prompts.SystemInvoice)
+	assert.Equal(t, "Construction invoice:\n%s", prompts.Text)
+	assert.Equal(t, llm.UserPromptOCRCorrection, prompts.OCR, "missing files keep defaults")
+}
+
+func TestLoadPromptSet_InvalidTemplate(t *testing.T) {
+	_, err := llm.LoadPromptSet(fstest.MapFS{"ocr.txt": {Data: []byte("no placeholder")}})
+	require.Error(t, err)
+}
+
+func TestExtractor_WithPrompts(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"1"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)),
+		llm.WithPrompts(llm.PromptSet{SystemInvoice: "pharma system", Text: "pharma: %s"}),
+	)
+
+	_, err := extractor.ExtractFromText(context.Background(), "doc")
+	require.NoError(t, err)
+
+	req := provider.requests[0]
+	assert.Equal(t, "pharma system", req.SystemPrompt)
+	assert.Equal(t, "pharma: doc", req.UserPrompt)
+	assert.Equal(t, llm.UserPromptImageExtraction, extractor.Prompts().Image)
+}
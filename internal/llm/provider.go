@@ -0,0 +1,235 @@
+package llm
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Provider names accepted by NewProvider
+const (
+	ProviderOpenAI  = "openai"  // OpenAI and OpenAI-compatible gateways (OpenRouter by default)
+	ProviderGemini  = "gemini"  // Google Gemini API
+	ProviderAzure   = "azure"   // Azure OpenAI Service
+	ProviderBedrock = "bedrock" // AWS Bedrock Converse API
+	ProviderOllama  = "ollama"  // Local Ollama server
+
+	ProviderAnthropic = "anthropic" // Anthropic Messages API
+
+	// OpenAI-compatible gateways; model names are passed through unchanged
+	ProviderOpenRouter = "openrouter" // OpenRouter
+	ProviderLiteLLM    = "litellm"    // LiteLLM proxy
+)
+
+// DefaultLiteLLMBaseURL is the address of a LiteLLM proxy started with default settings
+const DefaultLiteLLMBaseURL = "http://localhost:4000/v1"
+
+// Default generation parameters
+const (
+	DefaultMaxTokens   = 4096
+	DefaultTemperature = 0.1
+)
+
+// defaultModels holds the model used when a provider is selected without one.
+// Azure and LiteLLM have no default because models are addressed by
+// deployment name or proxy alias.
+var defaultModels = map[string]string{
+	ProviderOpenAI:  ModelClaude35Sonnet,
+	ProviderGemini:  "gemini-1.5-flash",
+	ProviderBedrock: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+	ProviderOllama:  "llama3.2-vision",
+
+	ProviderAnthropic:  "claude-3-5-sonnet-latest",
+	ProviderOpenRouter: ModelClaude35Sonnet,
+}
+
+// Provider sends chat completion requests to an LLM vendor
+type Provider interface {
+	// Name returns the provider name (one of the Provider* constants for built-ins)
+	Name() string
+
+	// Complete sends a single request and returns the model output
+	Complete(ctx context.Context, req *Request) (*Response, error)
+}
+
+// Request is a provider-neutral chat completion request
+type Request struct {
+	Model        string
+	SystemPrompt string
+	UserPrompt   string
+	Images       []Image
+	MaxTokens    int64
+	Temperature  float64
+	TopP         float64         // Nucleus sampling; 0 = provider default
+	Schema       *ResponseSchema // Optional structured output contract
+	Sample       int             // Distinguishes repeated samples of one request in the cache
+	CachePrompt  bool            // Mark the system prompt and schema for provider prompt caching (see WithPromptCaching)
+}
+
+// Image is an inline image attached to a request
+type Image struct {
+	Data     []byte
+	MimeType string
+}
+
+// Response is a provider-neutral chat completion response
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+	Cached  bool // Served from the response cache without calling the provider
+}
+
+// Usage reports token consumption for a request
+type Usage struct {
+	PromptTokens       int64
+	CompletionTokens   int64
+	CachedPromptTokens int64 // Prompt tokens read from the provider's prompt cache, included in PromptTokens
+}
+
+// APIError is returned when a provider responds with a non-2xx status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// ProviderConfig selects and configures a provider backend
+type ProviderConfig struct {
+	Name       string         // One of the Provider* constants (default: openai)
+	APIKey     string         // API key (unused by Ollama; Bedrock reads AWS credentials from env)
+	BaseURL    string         // Endpoint override (OpenAI-compatible base, Azure resource endpoint, Ollama host)
+	APIVersion string         // Azure OpenAI API version
+	Region     string         // AWS region for Bedrock (env: AWS_REGION)
+	Timeout    time.Duration  // HTTP timeout (default: DefaultTimeout)
+	HTTP       HTTPOptions    // Injected client, proxy and extra headers
+	ExtraBody  map[string]any // Extra request body fields for OpenAI-compatible gateways (see OpenAIConfig.ExtraBody)
+}
+
+// NewProvider creates a provider backend from configuration
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	switch cfg.Name {
+	case "", ProviderOpenAI, ProviderOpenRouter:
+		return NewOpenAIProvider(OpenAIConfig{
+			Name:      cmp.Or(cfg.Name, ProviderOpenAI),
+			APIKey:    cfg.APIKey,
+			BaseURL:   cfg.BaseURL,
+			Timeout:   cfg.Timeout,
+			HTTP:      cfg.HTTP,
+			ExtraBody: cfg.ExtraBody,
+		}), nil
+	case ProviderLiteLLM:
+		return NewOpenAIProvider(OpenAIConfig{
+			Name:      ProviderLiteLLM,
+			APIKey:    cfg.APIKey,
+			BaseURL:   cmp.Or(cfg.BaseURL, DefaultLiteLLMBaseURL),
+			Timeout:   cfg.Timeout,
+			HTTP:      cfg.HTTP,
+			ExtraBody: cfg.ExtraBody,
+		}), nil
+	case ProviderGemini:
+		return NewGeminiProvider(GeminiConfig{
+			APIKey:  cfg.APIKey,
+			BaseURL: cfg.BaseURL,
+			Timeout: cfg.Timeout,
+			HTTP:    cfg.HTTP,
+		}), nil
+	case ProviderAzure:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("azure provider requires an endpoint (base URL)")
+		}
+		return NewAzureOpenAIProvider(AzureOpenAIConfig{
+			APIKey:     cfg.APIKey,
+			Endpoint:   cfg.BaseURL,
+			APIVersion: cfg.APIVersion,
+			Timeout:    cfg.Timeout,
+			HTTP:       cfg.HTTP,
+		}), nil
+	case ProviderBedrock:
+		return NewBedrockProvider(BedrockConfig{
+			Region:  cfg.Region,
+			BaseURL: cfg.BaseURL,
+			Timeout: cfg.Timeout,
+			HTTP:    cfg.HTTP,
+		}), nil
+	case ProviderAnthropic:
+		return NewAnthropicProvider(AnthropicConfig{
+			APIKey:  cfg.APIKey,
+			BaseURL: cfg.BaseURL,
+			Timeout: cfg.Timeout,
+			HTTP:    cfg.HTTP,
+		}), nil
+	case ProviderOllama:
+		return NewOllamaProvider(OllamaConfig{
+			BaseURL: cfg.BaseURL,
+			Timeout: cfg.Timeout,
+			HTTP:    cfg.HTTP,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", cfg.Name)
+	}
+}
+
+// RequiresAPIKey reports whether the named provider authenticates with an API
+// key. A LiteLLM proxy may run without one.
+func RequiresAPIKey(provider string) bool {
+	return provider != ProviderOllama && provider != ProviderBedrock && provider != ProviderLiteLLM
+}
+
+// DefaultModelFor returns the default model for a provider name
+func DefaultModelFor(provider string) string {
+	return defaultModels[provider]
+}
+
+// doJSON posts a JSON body and decodes the JSON response into out
+func doJSON(httpClient *http.Client, req *http.Request, provider string, out any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", provider, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", provider, err)
+	}
+
+	return nil
+}
+
+// newJSONRequest builds a POST request with a JSON body
+func newJSONRequest(ctx context.Context, url string, payload any) (*http.Request, []byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, body, nil
+}
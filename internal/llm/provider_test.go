@@ -0,0 +1,250 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      llm.ProviderConfig
+		expected string
+		wantErr  bool
+	}{
+		{name: "default", cfg: llm.ProviderConfig{APIKey: "k"}, expected: llm.ProviderOpenAI},
+		{name: "gemini", cfg: llm.ProviderConfig{Name: llm.ProviderGemini, APIKey: "k"}, expected: llm.ProviderGemini},
+		{name: "azure", cfg: llm.ProviderConfig{Name: llm.ProviderAzure, APIKey: "k", BaseURL: "https://x.openai.azure.com"}, expected: llm.ProviderAzure},
+		{name: "azure without endpoint", cfg: llm.ProviderConfig{Name: llm.ProviderAzure}, wantErr: true},
+		{name: "bedrock", cfg: llm.ProviderConfig{Name: llm.ProviderBedrock, Region: "us-east-1"}, expected: llm.ProviderBedrock},
+		{name: "ollama", cfg: llm.ProviderConfig{Name: llm.ProviderOllama}, expected: llm.ProviderOllama},
+		{name: "openrouter", cfg: llm.ProviderConfig{Name: llm.ProviderOpenRouter, APIKey: "k"}, expected: llm.ProviderOpenRouter},
+		{name: "litellm", cfg: llm.ProviderConfig{Name: llm.ProviderLiteLLM}, expected: llm.ProviderLiteLLM},
+		{name: "unknown", cfg: llm.ProviderConfig{Name: "foo"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := llm.NewProvider(tt.cfg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, p.Name())
+		})
+	}
+}
+
+func TestClient_DefaultModelFromProvider(t *testing.T) {
+	var gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		gotModel, _ = body["model"].(string)
+		w.Write([]byte(`{"model":"llama3.2-vision","message":{"role":"assistant","content":"ok"}}`))
+	}))
+	defer srv.Close()
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+
+	out, err := client.ChatText(context.Background(), "", "sys", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", out)
+	assert.Equal(t, llm.DefaultModelFor(llm.ProviderOllama), gotModel)
+}
+
+func TestGeminiProvider_Complete(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/gemini-1.5-pro:generateContent", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-goog-api-key"))
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `"system_instruction"`)
+		assert.Contains(t, string(body), `"inline_data":{"mime_type":"image/png"`)
+
+		w.Write([]byte(`{
+			"candidates": [{"content": {"parts": [{"text": "{\"invoice_number\":"}, {"text": "\"1\"}"}]}}],
+			"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewGeminiProvider(llm.GeminiConfig{APIKey: "test-key", BaseURL: srv.URL})
+	resp, err := p.Complete(context.Background(), &llm.Request{
+		Model:        "gemini-1.5-pro",
+		SystemPrompt: "sys",
+		UserPrompt:   "extract",
+		Images:       []llm.Image{{Data: []byte{1, 2}, MimeType: "image/png"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"invoice_number":"1"}`, resp.Content)
+	assert.Equal(t, int64(10), resp.Usage.PromptTokens)
+	assert.Equal(t, int64(5), resp.Usage.CompletionTokens)
+}
+
+func TestBedrockProvider_Complete(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse", r.URL.EscapedPath())
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+
+		w.Write([]byte(`{
+			"output": {"message": {"role": "assistant", "content": [{"text": "done"}]}},
+			"usage": {"inputTokens": 7, "outputTokens": 3}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewBedrockProvider(llm.BedrockConfig{
+		Region:      "us-east-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		BaseURL:     srv.URL,
+	})
+	resp, err := p.Complete(context.Background(), &llm.Request{
+		Model:      "anthropic.claude-3-haiku-20240307-v1:0",
+		UserPrompt: "extract",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "done", resp.Content)
+	assert.Equal(t, int64(7), resp.Usage.PromptTokens)
+}
+
+func TestProvider_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`rate limited`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})
+	_, err := p.Complete(context.Background(), &llm.Request{Model: "m", UserPrompt: "x"})
+	require.Error(t, err)
+
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
+
+func TestAzureOpenAIProvider_Complete(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/openai/deployments/invoice-gpt4o/chat/completions", r.URL.Path)
+		assert.Equal(t, "2024-06-01", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "azure-key", r.Header.Get("Api-Key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "1", "object": "chat.completion", "model": "gpt-4o",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "hi"}}],
+			"usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewAzureOpenAIProvider(llm.AzureOpenAIConfig{APIKey: "azure-key", Endpoint: srv.URL})
+	resp, err := p.Complete(context.Background(), &llm.Request{Model: "invoice-gpt4o", UserPrompt: "x", MaxTokens: 10})
+	require.NoError(t, err)
+
+	assert.Equal(t, "hi", resp.Content)
+	assert.Equal(t, int64(3), resp.Usage.PromptTokens)
+}
+
+func TestLiteLLMProvider_Passthrough(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-team-invoices", r.Header.Get("Authorization"))
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "invoice-extractor", body["model"], "proxy aliases are sent as is")
+		assert.Equal(t, map[string]any{"tags": []any{"invoices"}}, body["metadata"])
+		assert.Equal(t, "tenant-7", body["user"])
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "1", "object": "chat.completion", "model": "bedrock/claude-3-5-sonnet",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "hi"}}],
+			"usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+		}`))
+	}))
+	defer srv.Close()
+
+	p, err := llm.NewProvider(llm.ProviderConfig{
+		Name:    llm.ProviderLiteLLM,
+		APIKey:  "sk-team-invoices",
+		BaseURL: srv.URL + "/v1",
+		ExtraBody: map[string]any{
+			"metadata": map[string]any{"tags": []string{"invoices"}},
+			"user":     "tenant-7",
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, llm.RequiresAPIKey(llm.ProviderLiteLLM))
+
+	resp, err := p.Complete(context.Background(), &llm.Request{Model: "invoice-extractor", UserPrompt: "x", MaxTokens: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", resp.Content)
+	assert.Equal(t, "bedrock/claude-3-5-sonnet", resp.Model)
+}
+
+func TestAnthropicProvider_PromptCaching(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"model":"claude","content":[{"type":"text","text":"ok"}],
+			"usage":{"input_tokens":50,"output_tokens":5,"cache_creation_input_tokens":0,"cache_read_input_tokens":1800}}`))
+	}))
+	defer srv.Close()
+
+	provider := llm.NewAnthropicProvider(llm.AnthropicConfig{BaseURL: srv.URL})
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithPromptCaching(true))
+	resp, err := client.Complete(context.Background(), &llm.Request{Model: "claude", SystemPrompt: "sys", UserPrompt: "extract", Schema: llm.InvoiceSchema})
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "sys", "cache_control": map[string]any{"type": "ephemeral"}}}, body["system"])
+	assert.Equal(t, llm.Usage{PromptTokens: 1850, CompletionTokens: 5, CachedPromptTokens: 1800}, resp.Usage)
+
+	// Without caching the system prompt stays a plain string
+	_, err = provider.Complete(context.Background(), &llm.Request{Model: "claude", SystemPrompt: "sys", UserPrompt: "extract"})
+	require.NoError(t, err)
+	assert.Equal(t, "sys", body["system"])
+}
+
+func TestBedrockProvider_PromptCaching(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{
+			"output": {"message": {"role": "assistant", "content": [{"text": "done"}]}},
+			"usage": {"inputTokens": 7, "outputTokens": 3, "cacheReadInputTokens": 1200}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewBedrockProvider(llm.BedrockConfig{
+		Region:      "us-east-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		BaseURL:     srv.URL,
+	})
+	resp, err := p.Complete(context.Background(), &llm.Request{Model: "m", SystemPrompt: "sys", UserPrompt: "extract", CachePrompt: true})
+	require.NoError(t, err)
+
+	assert.Contains(t, body, `"system":[{"text":"sys"},{"cachePoint":{"type":"default"}}]`)
+	assert.Equal(t, int64(1207), resp.Usage.PromptTokens)
+	assert.Equal(t, int64(1200), resp.Usage.CachedPromptTokens)
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// imageTokenEstimate approximates the prompt cost of one image for rate limiting
+const imageTokenEstimate = 1000
+
+// RateLimit caps request and token throughput for a model
+type RateLimit struct {
+	RequestsPerSecond float64 // 0 = unlimited
+	TokensPerMinute   int     // Prompt + completion tokens; 0 = unlimited
+}
+
+// modelLimiter enforces one RateLimit
+type modelLimiter struct {
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+}
+
+func newModelLimiter(limit RateLimit) *modelLimiter {
+	l := &modelLimiter{}
+	if limit.RequestsPerSecond > 0 {
+		l.requests = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), max(1, int(limit.RequestsPerSecond)))
+	}
+	if limit.TokensPerMinute > 0 {
+		l.tokens = rate.NewLimiter(rate.Limit(float64(limit.TokensPerMinute)/60), limit.TokensPerMinute)
+	}
+	return l
+}
+
+// wait blocks until a request with the given prompt tokens may be sent
+func (l *modelLimiter) wait(ctx context.Context, promptTokens int) error {
+	if l.requests != nil {
+		if err := l.requests.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.tokens != nil {
+		if err := l.tokens.WaitN(ctx, min(promptTokens, l.tokens.Burst())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consume charges completion tokens after the fact, delaying later requests
+func (l *modelLimiter) consume(tokens int) {
+	if l.tokens != nil && tokens > 0 {
+		l.tokens.ReserveN(time.Now(), min(tokens, l.tokens.Burst()))
+	}
+}
+
+// limiters holds per-model limiters plus the concurrency semaphore
+type limiters struct {
+	mu       sync.Mutex
+	limits   map[string]RateLimit // "" applies to models without their own entry
+	byModel  map[string]*modelLimiter
+	inFlight *slots
+}
+
+func newLimiters(limits map[string]RateLimit, maxConcurrency int) *limiters {
+	if len(limits) == 0 && maxConcurrency <= 0 {
+		return nil
+	}
+
+	l := &limiters{
+		limits:  limits,
+		byModel: make(map[string]*modelLimiter),
+	}
+	if maxConcurrency > 0 {
+		l.inFlight = newSlots(maxConcurrency)
+	}
+	return l
+}
+
+func (l *limiters) forModel(model string) *modelLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ml, ok := l.byModel[model]; ok {
+		return ml
+	}
+
+	limit, ok := l.limits[model]
+	if !ok {
+		limit, ok = l.limits[""]
+	}
+	var ml *modelLimiter
+	if ok {
+		ml = newModelLimiter(limit)
+	}
+	l.byModel[model] = ml
+	return ml
+}
+
+// throttled runs call once a concurrency slot, given out by priority, and
+// the rate limits allow it
+func (c *Client) throttled(ctx context.Context, req *Request, call func() (*Response, error)) (*Response, error) {
+	if c.limiters == nil {
+		return call()
+	}
+
+	if c.limiters.inFlight != nil {
+		priority, _ := PriorityFromContext(ctx)
+		if err := c.limiters.inFlight.acquire(ctx, priority); err != nil {
+			return nil, err
+		}
+		defer c.limiters.inFlight.release()
+	}
+
+	ml := c.limiters.forModel(req.Model)
+	if ml == nil {
+		return call()
+	}
+
+	if err := ml.wait(ctx, estimatePromptTokens(req)); err != nil {
+		return nil, err
+	}
+
+	resp, err := call()
+	if err == nil {
+		ml.consume(int(resp.Usage.CompletionTokens))
+	}
+	return resp, err
+}
+
+// estimatePromptTokens approximates prompt size at ~4 characters per token
+func estimatePromptTokens(req *Request) int {
+	return (len(req.SystemPrompt)+len(req.UserPrompt))/4 + len(req.Images)*imageTokenEstimate
+}
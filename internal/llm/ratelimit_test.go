@@ -0,0 +1,162 @@
+package llm_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// countingProvider records peak concurrency while holding each request briefly
+type countingProvider struct {
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	delay    time.Duration
+}
+
+func (p *countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) Complete(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(p.delay)
+	return &llm.Response{Content: "ok", Model: req.Model}, nil
+}
+
+func TestClient_MaxConcurrency(t *testing.T) {
+	provider := &countingProvider{delay: 10 * time.Millisecond}
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithMaxConcurrency(2))
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ChatText(context.Background(), "m", "", "x")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), provider.peak.Load())
+}
+
+// queuedProvider holds each request until released, reporting its prompt
+// when it starts
+type queuedProvider struct {
+	started chan string
+	release chan struct{}
+}
+
+func (p *queuedProvider) Name() string { return "queued" }
+
+func (p *queuedProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.started <- req.UserPrompt
+	<-p.release
+	return &llm.Response{Content: "ok", Model: req.Model}, nil
+}
+
+func TestClient_MaxConcurrencyPriority(t *testing.T) {
+	provider := &queuedProvider{started: make(chan string), release: make(chan struct{})}
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithMaxConcurrency(1))
+	batch := llm.ContextWithPriority(context.Background(), llm.PriorityBatch)
+
+	var wg sync.WaitGroup
+	call := func(ctx context.Context, prompt string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ChatText(ctx, "m", "", prompt)
+			assert.NoError(t, err)
+		}()
+	}
+	call(batch, "backfill 1")
+	assert.Equal(t, "backfill 1", <-provider.started)
+	call(batch, "backfill 2")
+	time.Sleep(20 * time.Millisecond) // Queued first
+	call(context.Background(), "upload")
+	time.Sleep(20 * time.Millisecond)
+
+	provider.release <- struct{}{}
+	assert.Equal(t, "upload", <-provider.started, "interactive requests skip the batch lane")
+	provider.release <- struct{}{}
+	assert.Equal(t, "backfill 2", <-provider.started)
+	provider.release <- struct{}{}
+	wg.Wait()
+}
+
+func TestClient_MaxConcurrencyCanceledWaiter(t *testing.T) {
+	provider := &queuedProvider{started: make(chan string), release: make(chan struct{})}
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithMaxConcurrency(1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := client.ChatText(context.Background(), "m", "", "first")
+		assert.NoError(t, err)
+	}()
+	<-provider.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.ChatText(ctx, "m", "", "gave up")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	provider.release <- struct{}{}
+	<-done
+	go func() {
+		_, err := client.ChatText(context.Background(), "m", "", "next")
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, "next", <-provider.started, "the slot is free again")
+	provider.release <- struct{}{}
+}
+
+func TestClient_RateLimitPerModel(t *testing.T) {
+	client := llm.NewClient("",
+		llm.WithProvider(&countingProvider{}),
+		llm.WithRateLimit("slow", llm.RateLimit{RequestsPerSecond: 5}),
+	)
+
+	start := time.Now()
+	for range 6 {
+		_, err := client.ChatText(context.Background(), "fast", "", "x")
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "models without a limit are not throttled")
+
+	start = time.Now()
+	for range 6 {
+		_, err := client.ChatText(context.Background(), "slow", "", "x")
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "burst of 5 then one request per 200ms")
+}
+
+func TestClient_RateLimitHonorsContext(t *testing.T) {
+	client := llm.NewClient("",
+		llm.WithProvider(&countingProvider{}),
+		llm.WithRateLimit("", llm.RateLimit{TokensPerMinute: 60}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// First request drains the token budget; the second must wait about a minute
+	_, err := client.ChatText(ctx, "m", "", string(make([]byte, 240)))
+	require.NoError(t, err)
+	_, err = client.ChatText(ctx, "m", "", string(make([]byte, 240)))
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// RequiredField names a field that is re-requested when extraction leaves it empty
+type RequiredField string
+
+const (
+	FieldSellerTaxID RequiredField = "seller.tax_id"
+	FieldTotalAmount RequiredField = "total_amount"
+	FieldDate        RequiredField = "date"
+)
+
+// DefaultRequiredFields are recovered when WithFieldRecovery is given no fields
+var DefaultRequiredFields = []RequiredField{FieldSellerTaxID, FieldTotalAmount, FieldDate}
+
+// requiredFieldSpecs describes each recoverable field to the model and the schema
+var requiredFieldSpecs = map[RequiredField]struct {
+	description string
+	schema      map[string]any
+}{
+	FieldSellerTaxID: {
+		description: "seller.tax_id: the seller's tax code (Mã số thuế / MST), 10 digits with an optional -XXX branch suffix",
+		schema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"tax_id": map[string]any{"type": "string"}},
+		},
+	},
+	FieldTotalAmount: {
+		description: "total_amount: the grand total payable including VAT (Tổng cộng tiền thanh toán), as a number",
+		schema:      map[string]any{"type": "number"},
+	},
+	FieldDate: {
+		description: "date: the issue date (Ngày ... tháng ... năm ...), as YYYY-MM-DD",
+		schema:      map[string]any{"type": "string"},
+	},
+}
+
+// WithFieldRecovery re-asks the model for required fields the first pass left
+// empty, with a prompt covering only those fields. With no fields given,
+// DefaultRequiredFields are used. Seller tax IDs are not requested for receipts.
+func WithFieldRecovery(fields ...RequiredField) ExtractorOption {
+	return func(e *Extractor) {
+		if len(fields) == 0 {
+			fields = DefaultRequiredFields
+		}
+		e.requiredFields = fields
+	}
+}
+
+// missingFields returns the required fields that inv leaves empty
+func (e *Extractor) missingFields(inv *model.Invoice) []RequiredField {
+	var missing []RequiredField
+	for _, field := range e.requiredFields {
+		switch field {
+		case FieldSellerTaxID:
+			if inv.Seller.TaxID == "" && inv.DocumentType != model.DocumentTypeReceipt {
+				missing = append(missing, field)
+			}
+		case FieldTotalAmount:
+			// Delivery notes often carry quantities only
+			if inv.TotalAmount.IsZero() && inv.DocumentType != model.DocumentTypeDeliveryNote {
+				missing = append(missing, field)
+			}
+		case FieldDate:
+			if inv.Date.IsZero() {
+				missing = append(missing, field)
+			}
+		}
+	}
+	return missing
+}
+
+// recoverFields issues a focused follow-up request for missing required fields
+// and fills in whatever comes back. document is the source text for text
+// extraction; image extraction resends the same images. Recovery is best
+// effort: on failure inv is returned unchanged.
+func (e *Extractor) recoverFields(ctx context.Context, inv *model.Invoice, models []string, document string, images []Image) *model.Invoice {
+	missing := e.missingFields(inv)
+	if len(missing) == 0 {
+		return inv
+	}
+
+	response, err := e.complete(ctx, models, recoverySchema(missing), e.followUpSystemPrompt(ctx, inv), fieldRecoveryPrompt(missing, document), images)
+	if err != nil {
+		return inv
+	}
+
+	resp, err := decodeResponse(response)
+	if err != nil {
+		return inv
+	}
+
+	for _, field := range missing {
+		switch field {
+		case FieldSellerTaxID:
+			inv.Seller.TaxID = strings.TrimSpace(resp.Seller.TaxID)
+		case FieldTotalAmount:
+			inv.TotalAmount = e.parseAmount(resp.TotalAmount, inv.Currency)
+		case FieldDate:
+			if t, err := parseDate(resp.Date); err == nil {
+				inv.Date = t
+			}
+		}
+	}
+
+	return inv
+}
+
+// followUpSystemPrompt is the system prompt for follow-up requests about inv
+func (e *Extractor) followUpSystemPrompt(ctx context.Context, inv *model.Invoice) string {
+	if inv.DocumentType == model.DocumentTypeReceipt {
+		return e.promptSet(ctx).SystemReceipt
+	}
+	return e.promptSet(ctx).SystemInvoice
+}
+
+// recoverySchema restricts the response to the requested fields
+func recoverySchema(fields []RequiredField) *ResponseSchema {
+	properties := make(map[string]any, len(fields))
+	for _, field := range fields {
+		properties[strings.SplitN(string(field), ".", 2)[0]] = requiredFieldSpecs[field].schema
+	}
+
+	return &ResponseSchema{
+		Name:        "record_missing_fields",
+		Description: "Record invoice fields missing from a previous extraction",
+		Schema: map[string]any{
+			"type":       "object",
+			"properties": properties,
+		},
+	}
+}
+
+// fieldRecoveryPrompt lists the missing fields and, for text input, appends the document
+func fieldRecoveryPrompt(fields []RequiredField, document string) string {
+	var list strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&list, "- %s\n", requiredFieldSpecs[field].description)
+	}
+
+	prompt := fmt.Sprintf(UserPromptFieldRecovery, list.String())
+	if document != "" {
+		prompt += fmt.Sprintf("\n\nDocument text:\n---\n%s\n---", document)
+	}
+	return prompt
+}
@@ -0,0 +1,75 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestExtractor_FieldRecovery(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"12","seller":{"name":"ACME"},"total_amount":0}`,
+		`{"seller":{"tax_id":"0312345678"},"total_amount":1100000,"date":"2024-03-15"}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithFieldRecovery())
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 ...")
+	require.NoError(t, err)
+	assert.Equal(t, "12", inv.Number)
+	assert.Equal(t, "0312345678", inv.Seller.TaxID)
+	assert.True(t, decimal.NewFromInt(1100000).Equal(inv.TotalAmount))
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), inv.Date)
+
+	require.Len(t, provider.requests, 2)
+	followUp := provider.requests[1]
+	assert.Contains(t, followUp.UserPrompt, "seller.tax_id")
+	assert.Contains(t, followUp.UserPrompt, "total_amount")
+	assert.Contains(t, followUp.UserPrompt, "HOA DON 12")
+	require.NotNil(t, followUp.Schema)
+	assert.ElementsMatch(t, []string{"seller", "total_amount", "date"}, keys(followUp.Schema.Schema["properties"].(map[string]any)))
+}
+
+func TestExtractor_FieldRecovery_OnlyRequested(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"document_type":"receipt","date":"2024-03-15"}`,
+		`{"total_amount":45000,"date":"2020-01-01"}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithFieldRecovery())
+
+	images := []llm.Image{{Data: []byte("jpeg"), MimeType: "image/jpeg"}}
+	inv, err := extractor.ExtractAuto(context.Background(), images)
+	require.NoError(t, err)
+	assert.Equal(t, model.DocumentTypeReceipt, inv.DocumentType)
+	assert.True(t, decimal.NewFromInt(45000).Equal(inv.TotalAmount))
+	assert.Equal(t, 2024, inv.Date.Year(), "fields present in the first pass are kept")
+
+	require.Len(t, provider.requests, 2)
+	followUp := provider.requests[1]
+	assert.Equal(t, images, followUp.Images)
+	assert.NotContains(t, followUp.UserPrompt, "seller.tax_id", "receipts do not need a seller tax ID")
+	assert.Equal(t, []string{"total_amount"}, keys(followUp.Schema.Schema["properties"].(map[string]any)))
+}
+
+func TestExtractor_FieldRecovery_Disabled(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"12"}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	_, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Len(t, provider.requests, 1)
+}
+
+func keys(m map[string]any) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
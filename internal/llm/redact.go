@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// RedactionKind selects a class of personal data to mask
+type RedactionKind string
+
+const (
+	RedactNames        RedactionKind = "NAME"  // Buyer names on labeled lines
+	RedactPhones       RedactionKind = "PHONE" // Labeled or +84 phone numbers
+	RedactEmails       RedactionKind = "EMAIL"
+	RedactBankAccounts RedactionKind = "BANK_ACCOUNT" // Labeled account numbers
+)
+
+// redactionRules match personal data; the last submatch is the value to mask.
+// Phones and accounts need a label because bare 10-digit numbers are usually tax IDs.
+var redactionRules = map[RedactionKind]*regexp.Regexp{
+	RedactNames:        regexp.MustCompile(`(?im)(?:họ (?:và )?tên người mua(?: hàng)?|người mua hàng|tên khách hàng|khách hàng|buyer name|customer name|buyer|customer)\s*[:：]\s*([^\n:：]*[^\s:：])`),
+	RedactPhones:       regexp.MustCompile(`(?i)(?:(?:điện thoại|đt|sđt|sdt|tel|phone|mobile|di động)\s*[:：.]?\s*((?:\+84|0)[\d .-]{8,13}\d)|(\+84[\d .-]{8,12}\d))`),
+	RedactEmails:       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	RedactBankAccounts: regexp.MustCompile(`(?i)(?:số tài khoản|stk|tài khoản|account(?: no\.?| number)?|bank account)\s*[:：]?\s*(\d[\d .-]{4,}\d)`),
+}
+
+// redactionOrder keeps placeholder numbering stable
+var redactionOrder = []RedactionKind{RedactEmails, RedactBankAccounts, RedactPhones, RedactNames}
+
+// Redactor masks personal data in text before it is sent to an LLM.
+// Only text is redacted; page images are sent as is.
+type Redactor struct {
+	kinds []RedactionKind
+}
+
+// NewRedactor creates a redactor for the given kinds, or all kinds when none are given
+func NewRedactor(kinds ...RedactionKind) *Redactor {
+	if len(kinds) == 0 {
+		return &Redactor{kinds: redactionOrder}
+	}
+
+	r := &Redactor{}
+	for _, kind := range redactionOrder {
+		for _, k := range kinds {
+			if k == kind {
+				r.kinds = append(r.kinds, kind)
+			}
+		}
+	}
+	return r
+}
+
+// Redaction maps placeholders back to the values they replaced
+type Redaction struct {
+	originals map[string]string // placeholder -> original
+}
+
+// Redact replaces personal data in text with placeholders such as [PHONE_1].
+// Repeated values share a placeholder.
+func (r *Redactor) Redact(text string) (string, *Redaction) {
+	red := &Redaction{originals: make(map[string]string)}
+	placeholders := make(map[string]string) // original -> placeholder
+	counts := make(map[RedactionKind]int)
+
+	for _, kind := range r.kinds {
+		rule := redactionRules[kind]
+
+		var b strings.Builder
+		last := 0
+		for _, m := range rule.FindAllStringSubmatchIndex(text, -1) {
+			start, end := lastGroup(m)
+			if start < 0 {
+				continue
+			}
+			value := text[start:end]
+			placeholder, ok := placeholders[value]
+			if !ok {
+				counts[kind]++
+				placeholder = fmt.Sprintf("[%s_%d]", kind, counts[kind])
+				placeholders[value] = placeholder
+				red.originals[placeholder] = value
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(placeholder)
+			last = end
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+
+	// Mask unlabeled repeats of values found above
+	for original, placeholder := range placeholders {
+		text = strings.ReplaceAll(text, original, placeholder)
+	}
+
+	return text, red
+}
+
+// lastGroup returns the bounds of the last submatch that participated, or the whole match
+func lastGroup(m []int) (int, int) {
+	for i := len(m) - 2; i >= 2; i -= 2 {
+		if m[i] >= 0 {
+			return m[i], m[i+1]
+		}
+	}
+	return m[0], m[1]
+}
+
+// Empty reports whether nothing was redacted
+func (r *Redaction) Empty() bool {
+	return r == nil || len(r.originals) == 0
+}
+
+// Restore replaces placeholders in s with the original values
+func (r *Redaction) Restore(s string) string {
+	if r.Empty() || !strings.Contains(s, "[") {
+		return s
+	}
+	for placeholder, original := range r.originals {
+		s = strings.ReplaceAll(s, placeholder, original)
+	}
+	return s
+}
+
+// RestoreInvoice replaces placeholders in every string field of inv
+func (r *Redaction) RestoreInvoice(inv *model.Invoice) {
+	if r.Empty() || inv == nil {
+		return
+	}
+	r.restoreValue(reflect.ValueOf(inv).Elem())
+}
+
+func (r *Redaction) restoreValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(r.Restore(v.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				r.restoreValue(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			r.restoreValue(v.Index(i))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			r.restoreValue(v.Elem())
+		}
+	}
+}
+
+// WithRedactor masks personal data in document text before it is sent to the
+// model and restores the original values in the extracted invoice
+func WithRedactor(r *Redactor) ExtractorOption {
+	return func(e *Extractor) {
+		e.redactor = r
+	}
+}
+
+// redact applies the configured redactor to text; the returned Redaction may be nil
+func (e *Extractor) redact(text string) (string, *Redaction) {
+	if e.redactor == nil {
+		return text, nil
+	}
+	return e.redactor.Redact(text)
+}
+
+// redactionNote tells the model to keep placeholders when anything was redacted
+func redactionNote(red *Redaction) string {
+	if red.Empty() {
+		return ""
+	}
+	return PromptRedactionNote
+}
@@ -0,0 +1,64 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+const redactionSample = `HÓA ĐƠN GIÁ TRỊ GIA TĂNG
+Mã số thuế: 0312345678
+Họ tên người mua hàng: Nguyễn Văn An
+Điện thoại: 0901 234 567
+Email: an.nguyen@example.com
+Số tài khoản: 1903 4567 8901
+Liên hệ lại: 0901 234 567`
+
+func TestRedactor_Redact(t *testing.T) {
+	redacted, redaction := llm.NewRedactor().Redact(redactionSample)
+
+	assert.NotContains(t, redacted, "Nguyễn Văn An")
+	assert.NotContains(t, redacted, "0901 234 567")
+	assert.NotContains(t, redacted, "an.nguyen@example.com")
+	assert.NotContains(t, redacted, "1903 4567 8901")
+	assert.Contains(t, redacted, "0312345678", "tax IDs are kept")
+	assert.Contains(t, redacted, "Họ tên người mua hàng: [NAME_1]")
+	assert.Contains(t, redacted, "Email: [EMAIL_1]")
+
+	assert.Equal(t, redactionSample, redaction.Restore(redacted))
+}
+
+func TestRedactor_Kinds(t *testing.T) {
+	redacted, _ := llm.NewRedactor(llm.RedactEmails).Redact(redactionSample)
+
+	assert.Contains(t, redacted, "Nguyễn Văn An")
+	assert.Contains(t, redacted, "0901 234 567")
+	assert.NotContains(t, redacted, "an.nguyen@example.com")
+}
+
+func TestExtractor_WithRedactor(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"1","seller":{"tax_id":"0312345678"},"buyer":{"name":"[NAME_1]","phone":"[PHONE_1]","email":"[EMAIL_1]","bank_account":"[BANK_ACCOUNT_1]"},"notes":"Pay to [BANK_ACCOUNT_1]"}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithRedactor(llm.NewRedactor()))
+
+	inv, err := extractor.ExtractFromText(context.Background(), redactionSample)
+	require.NoError(t, err)
+	assert.Equal(t, model.Party{
+		Name:  "Nguyễn Văn An",
+		Phone: "0901 234 567",
+		Email: "an.nguyen@example.com",
+	}, inv.Buyer)
+	assert.Equal(t, "Pay to 1903 4567 8901", inv.Remarks)
+
+	require.Len(t, provider.requests, 1)
+	prompt := provider.requests[0].UserPrompt
+	assert.NotContains(t, prompt, "Nguyễn Văn An")
+	assert.NotContains(t, prompt, "1903 4567 8901")
+	assert.Contains(t, prompt, llm.PromptRedactionNote)
+}
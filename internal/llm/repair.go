@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// maxFixJSONResponseLen caps the malformed response echoed back in a fix-JSON re-prompt
+const maxFixJSONResponseLen = 16000
+
+// RepairJSON applies best-effort fixes for common defects in model output:
+// code fences and surrounding prose, trailing commas, and strings, arrays and
+// objects left open by a truncated response. Valid JSON is returned unchanged.
+func RepairJSON(response string) string {
+	s := ExtractJSON(response)
+	if json.Valid([]byte(s)) {
+		return s
+	}
+
+	// Truncated responses lose the closing fence, so ExtractJSON keeps the opening one
+	if strings.HasPrefix(s, "```") {
+		if nl := strings.Index(s, "\n"); nl != -1 {
+			s = s[nl+1:]
+		}
+	}
+	// Drop prose before the first object or array
+	if start := strings.IndexAny(s, "{["); start > 0 {
+		s = s[start:]
+	}
+
+	var (
+		out      strings.Builder
+		stack    []byte
+		inString bool
+		escaped  bool
+		keyStart bool // the open string started where an object key belongs
+		last     byte // last structural character outside strings
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+			keyStart = len(stack) > 0 && stack[len(stack)-1] == '{' && (last == '{' || last == ',')
+		case '{', '[':
+			stack = append(stack, c)
+			last = c
+		case '}', ']':
+			trimTrailingComma(&out)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			last = c
+		case ',', ':':
+			last = c
+		}
+		out.WriteByte(c)
+
+		// Anything after the outermost value closes is trailing prose
+		if len(stack) == 0 && (c == '}' || c == ']') {
+			break
+		}
+	}
+
+	// Close whatever a truncated response left open
+	if inString {
+		if escaped {
+			out.WriteByte('\\')
+		}
+		out.WriteByte('"')
+		if keyStart {
+			out.WriteString(":null")
+		}
+	} else if strings.HasSuffix(strings.TrimRight(out.String(), " \t\r\n"), ":") {
+		out.WriteString("null")
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		trimTrailingComma(&out)
+		if stack[i] == '{' {
+			out.WriteByte('}')
+		} else {
+			out.WriteByte(']')
+		}
+	}
+
+	return out.String()
+}
+
+// trimTrailingComma removes a comma (and whitespace after it) at the end of out
+func trimTrailingComma(out *strings.Builder) {
+	s := strings.TrimRight(out.String(), " \t\r\n")
+	if strings.HasSuffix(s, ",") {
+		s = s[:len(s)-1]
+		out.Reset()
+		out.WriteString(s)
+	}
+}
+
+// numberJunk matches everything but digits, separators and sign in a numeric string
+var numberJunk = regexp.MustCompile(`[^0-9.,\-]`)
+
+// normalizeNumber turns a formatted amount such as "1.100.000 đ" or "1,234.50"
+// into a JSON number. A separator that repeats, or is followed by exactly three
+// digits, is taken as a thousands separator.
+func normalizeNumber(s string) (json.Number, bool) {
+	s = numberJunk.ReplaceAllString(s, "")
+	if s == "" {
+		return "", false
+	}
+
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	decimalSep := byte(0)
+	switch {
+	case lastDot != -1 && lastComma != -1:
+		decimalSep = s[max(lastDot, lastComma)]
+	case lastDot != -1:
+		decimalSep = decimalCandidate(s, '.')
+	case lastComma != -1:
+		decimalSep = decimalCandidate(s, ',')
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == decimalSep:
+			b.WriteByte('.')
+		case c == '.' || c == ',':
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	n := json.Number(b.String())
+	if _, err := n.Float64(); err != nil {
+		return "", false
+	}
+	return n, true
+}
+
+// decimalCandidate returns sep if its single occurrence reads as a decimal point
+func decimalCandidate(s string, sep byte) byte {
+	if strings.Count(s, string(sep)) > 1 {
+		return 0
+	}
+	if digits := len(s) - strings.IndexByte(s, sep) - 1; digits == 3 {
+		return 0
+	}
+	return sep
+}
+
+var numberType = reflect.TypeOf(json.Number(""))
+
+// coerceNumbers decodes data generically and rewrites string values in the
+// numeric fields of target's type as JSON numbers; unparseable ones are dropped
+func coerceNumbers(data []byte, target reflect.Type) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(coerceValue(v, target))
+}
+
+func coerceValue(v any, t reflect.Type) any {
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if value, ok := obj[name]; ok {
+				obj[name] = coerceValue(value, t.Field(i).Type)
+			}
+		}
+		return obj
+
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			return v
+		}
+		for i := range arr {
+			arr[i] = coerceValue(arr[i], t.Elem())
+		}
+		return arr
+
+	case reflect.Int, reflect.Int64:
+		if s, ok := v.(string); ok {
+			if n, ok := normalizeNumber(s); ok {
+				if i, err := n.Int64(); err == nil {
+					return i
+				}
+			}
+			return nil
+		}
+	}
+
+	if t == numberType {
+		switch value := v.(type) {
+		case string:
+			if n, ok := normalizeNumber(value); ok {
+				return n
+			}
+			return nil
+		case bool:
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,80 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"valid", `{"a":1}`, `{"a":1}`},
+		{"code fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"trailing commas", `{"a":[1,2,],"b":1,}`, `{"a":[1,2],"b":1}`},
+		{"prose around", `Here you go: {"a":1} Hope this helps!`, `{"a":1}`},
+		{"truncated array", `{"items":[{"name":"A"},{"name":"B"`, `{"items":[{"name":"A"},{"name":"B"}]}`},
+		{"truncated string", `{"notes":"unfinish`, `{"notes":"unfinish"}`},
+		{"truncated key", `{"a":1,"tot`, `{"a":1,"tot":null}`},
+		{"truncated after colon", `{"a":`, `{"a":null}`},
+		{"truncated after comma", `{"a":[1,2,`, `{"a":[1,2]}`},
+		{"unclosed fence", "```json\n{\"a\":{\"b\":1", `{"a":{"b":1}}`},
+		{"braces in strings", `{"a":"{[,","b":[`, `{"a":"{[,","b":[]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := llm.RepairJSON(tt.input)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, json.Valid([]byte(got)))
+		})
+	}
+}
+
+func TestExtractor_RepairsMalformedJSON(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		"```json\n{\"invoice_number\":\"12\",\"total_amount\":\"1.100.000 đ\",\"total_vat\":\"100,000\",\"items\":[{\"name\":\"A\",\"quantity\":\"2\",\"number\":\"1\"},",
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, "12", inv.Number)
+	assert.True(t, decimal.NewFromInt(1100000).Equal(inv.TotalAmount), inv.TotalAmount.String())
+	assert.True(t, decimal.NewFromInt(100000).Equal(inv.TaxAmount), inv.TaxAmount.String())
+	require.Len(t, inv.Items, 1)
+	assert.Equal(t, 1, inv.Items[0].Number)
+	assert.Len(t, provider.requests, 1, "repaired locally without a re-prompt")
+}
+
+func TestExtractor_FixJSONReprompt(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`I could not decide on the format, sorry`,
+		`{"invoice_number":"12"}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, "12", inv.Number)
+
+	require.Len(t, provider.requests, 2)
+	assert.Contains(t, provider.requests[1].UserPrompt, "I could not decide on the format")
+	assert.Empty(t, provider.requests[1].Images)
+
+	// Only one re-prompt is attempted
+	provider = &recordingProvider{responses: []string{`not json`}}
+	extractor = llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+	_, err = extractor.ExtractFromText(context.Background(), "text")
+	require.Error(t, err)
+	assert.Len(t, provider.requests, 2)
+}
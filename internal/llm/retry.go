@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// RetryPolicy controls how failed LLM requests are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts per model, including the first (1 disables retries)
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound for any single delay
+	Multiplier     float64       // Backoff growth factor between attempts
+	Jitter         float64       // Fraction of each delay randomized (0-1)
+}
+
+// DefaultRetryPolicy retries transient failures three times with exponential backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// NoRetry sends every request exactly once
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// backoff returns the delay before retry number attempt (1-based)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying:
+// rate limiting (429), server errors (5xx), network timeouts and stalled streams
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrStreamIdle) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return retryableStatus(openaiErr.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,169 @@
+package llm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+)
+
+var fastRetry = llm.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+// ollamaServer answers with status(model, call) for each request, recording the models asked for
+func ollamaServer(t *testing.T, status func(model string, call int) int) (*httptest.Server, *[]string) {
+	var models []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		models = append(models, body.Model)
+
+		if code := status(body.Model, len(models)); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		fmt.Fprintf(w, `{"model":%q,"message":{"role":"assistant","content":"{\"invoice_number\":\"42\"}"}}`, body.Model)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &models
+}
+
+func TestExtractor_RetriesTransientErrors(t *testing.T) {
+	srv, models := ollamaServer(t, func(_ string, call int) int {
+		if call < 3 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client, llm.WithModel("primary"), llm.WithRetryPolicy(fastRetry))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, "42", inv.Number)
+	assert.Equal(t, []string{"primary", "primary", "primary"}, *models)
+}
+
+func TestExtractor_FallbackModels(t *testing.T) {
+	srv, models := ollamaServer(t, func(model string, _ int) int {
+		switch model {
+		case "primary":
+			return http.StatusServiceUnavailable
+		case "broken":
+			return http.StatusBadRequest
+		default:
+			return http.StatusOK
+		}
+	})
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client,
+		llm.WithModel("primary"),
+		llm.WithFallbackModels("broken", "backup"),
+		llm.WithRetryPolicy(fastRetry),
+	)
+
+	inv, err := extractor.ExtractFromText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, "42", inv.Number)
+
+	// 5xx is retried, 4xx moves straight to the next model
+	assert.Equal(t, []string{"primary", "primary", "primary", "broken", "backup"}, *models)
+}
+
+func TestContextWithModel(t *testing.T) {
+	srv, models := ollamaServer(t, func(model string, _ int) int {
+		if model == "replay" {
+			return http.StatusOK
+		}
+		return http.StatusServiceUnavailable
+	})
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client, llm.WithModel("primary"), llm.WithFallbackModels("backup"), llm.WithRetryPolicy(llm.NoRetry))
+
+	_, err := extractor.ExtractFromText(llm.ContextWithModel(context.Background(), "replay"), "text")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"replay"}, *models, "no other model is tried")
+}
+
+func TestContextWithModels(t *testing.T) {
+	srv, models := ollamaServer(t, func(model string, _ int) int {
+		if model == "backup" {
+			return http.StatusOK
+		}
+		return http.StatusServiceUnavailable
+	})
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client, llm.WithModel("primary"), llm.WithFallbackModels("backup"), llm.WithRetryPolicy(llm.NoRetry))
+
+	ctx := llm.ContextWithModels(context.Background(), llm.Models{Text: "tenant", Vision: "tenant-vision"})
+	_, err := extractor.ExtractFromText(ctx, "text")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenant", "backup"}, *models, "the fallbacks follow the tenant's model")
+}
+
+func TestExtractor_AllModelsFail(t *testing.T) {
+	srv, _ := ollamaServer(t, func(string, int) int { return http.StatusBadGateway })
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client, llm.WithFallbackModels("backup"), llm.WithRetryPolicy(llm.NoRetry))
+
+	_, err := extractor.ExtractFromText(context.Background(), "text")
+	var apiErr *llm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, llm.IsRetryable(&llm.APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, llm.IsRetryable(fmt.Errorf("wrapped: %w", &llm.APIError{StatusCode: 503})))
+	assert.True(t, llm.IsRetryable(context.DeadlineExceeded))
+	assert.False(t, llm.IsRetryable(&llm.APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, llm.IsRetryable(context.Canceled))
+	assert.False(t, llm.IsRetryable(nil))
+}
+
+func TestExtractor_LogsRetries(t *testing.T) {
+	srv, _ := ollamaServer(t, func(model string, _ int) int {
+		if model == "primary" {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+	extractor := llm.NewExtractor(client,
+		llm.WithModel("primary"),
+		llm.WithFallbackModels("backup"),
+		llm.WithRetryPolicy(llm.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+		llm.WithExtractorLogger(logger),
+	)
+
+	ctx := logging.ContextWithCorrelationID(context.Background(), "doc-1")
+	_, err := extractor.ExtractFromText(ctx, "text")
+	require.NoError(t, err)
+
+	logged := buf.String()
+	assert.Equal(t, 2, strings.Count(logged, `msg="LLM call failed"`))
+	assert.Contains(t, logged, `msg="retrying LLM request" correlation_id=doc-1 model=primary attempt=2`)
+	assert.Contains(t, logged, `msg="falling back to next LLM model" correlation_id=doc-1 model=backup failed_model=primary`)
+	assert.NotContains(t, logged, "level=DEBUG", "successful calls log at debug level")
+}
@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ResponseSchema constrains model output to a JSON schema.
+// Providers enforce it through structured output or forced tool calls.
+type ResponseSchema struct {
+	Name        string         // Tool/schema name (a-z, A-Z, 0-9, _ and -)
+	Description string         // What the output represents
+	Schema      map[string]any // JSON Schema object
+}
+
+// LLMResponse properties that only apply to some document types
+var (
+	receiptFields       = []string{"receipt_number", "cashier", "terminal_id", "time", "amount_tendered", "change"}
+	creditNoteFields    = []string{"original_invoice", "adjustment_reason"}
+	deliveryNoteFields  = []string{"document_number", "warehouse", "delivered_by", "received_by", "vehicle", "order_number"}
+	purchaseOrderFields = []string{"document_number", "delivery_date", "delivery_address"}
+)
+
+// InvoiceSchema is the output contract for invoice and receipt extraction
+var InvoiceSchema = &ResponseSchema{
+	Name:        "record_invoice",
+	Description: "Record the structured data extracted from a Vietnamese invoice or receipt",
+	Schema:      withoutProperties(JSONSchemaFor(LLMResponse{}), slices.Concat(deliveryNoteFields, purchaseOrderFields, groundingFields)...),
+}
+
+// ReceiptSchema is the output contract for POS receipt extraction.
+// It omits invoice-only fields such as series and buyer.
+var ReceiptSchema = &ResponseSchema{
+	Name:        "record_receipt",
+	Description: "Record the structured data extracted from a retail POS receipt",
+	Schema: withoutProperties(JSONSchemaFor(LLMResponse{}), slices.Concat(
+		[]string{"invoice_number", "series", "type", "buyer", "payment_terms"},
+		creditNoteFields, deliveryNoteFields, purchaseOrderFields, groundingFields)...),
+}
+
+// CreditNoteSchema is the output contract for credit notes (hóa đơn điều chỉnh giảm)
+var CreditNoteSchema = &ResponseSchema{
+	Name:        "record_credit_note",
+	Description: "Record the structured data extracted from a Vietnamese credit note and the invoice it adjusts",
+	Schema:      withoutProperties(JSONSchemaFor(LLMResponse{}), slices.Concat(receiptFields, deliveryNoteFields, purchaseOrderFields, groundingFields)...),
+}
+
+// DeliveryNoteSchema is the output contract for delivery notes (phiếu xuất kho)
+var DeliveryNoteSchema = &ResponseSchema{
+	Name:        "record_delivery_note",
+	Description: "Record the structured data extracted from a delivery note or warehouse dispatch note",
+	Schema: withoutProperties(JSONSchemaFor(LLMResponse{}), slices.Concat(
+		[]string{"invoice_number", "series", "type", "payment_method", "payment_terms", "delivery_date", "delivery_address"},
+		receiptFields, creditNoteFields, groundingFields)...),
+}
+
+// PurchaseOrderSchema is the output contract for purchase orders (đơn đặt hàng)
+var PurchaseOrderSchema = &ResponseSchema{
+	Name:        "record_purchase_order",
+	Description: "Record the structured data extracted from a purchase order",
+	Schema: withoutProperties(JSONSchemaFor(LLMResponse{}), slices.Concat(
+		[]string{"invoice_number", "series", "type", "warehouse", "delivered_by", "received_by", "vehicle", "order_number"},
+		receiptFields, creditNoteFields, groundingFields)...),
+}
+
+// AutoDetectSchema is the output contract when the document type is not known upfront
+var AutoDetectSchema = &ResponseSchema{
+	Name:        "record_document",
+	Description: "Record the type of a document and, for supported types, its structured data",
+	Schema: withEnum(withoutProperties(JSONSchemaFor(LLMResponse{}), groundingFields...), "document_type",
+		"invoice", "receipt", "credit_note", "delivery_note", "purchase_order", "other"),
+}
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// JSONSchemaFor derives a JSON schema from a struct using its json tags.
+// json.Number fields map to "number"; all fields are optional.
+func JSONSchemaFor(v any) map[string]any {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == jsonNumberType {
+		return map[string]any{"type": "number"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag := field.Tag.Get("json"); tag != "" {
+				tagName, _, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			properties[name] = schemaForType(field.Type)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	default:
+		return map[string]any{}
+	}
+}
+
+// withoutProperties removes top-level properties from an object schema
+func withoutProperties(schema map[string]any, names ...string) map[string]any {
+	if props, ok := schema["properties"].(map[string]any); ok {
+		for _, name := range names {
+			delete(props, name)
+		}
+	}
+	return schema
+}
+
+// withEnum restricts a top-level string property to the given values
+func withEnum(schema map[string]any, property string, values ...string) map[string]any {
+	if props, ok := schema["properties"].(map[string]any); ok {
+		if prop, ok := props[property].(map[string]any); ok {
+			prop["enum"] = values
+		}
+	}
+	return schema
+}
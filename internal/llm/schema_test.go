@@ -0,0 +1,87 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestJSONSchemaFor(t *testing.T) {
+	schema := llm.JSONSchemaFor(llm.LLMResponse{})
+	assert.Equal(t, "object", schema["type"])
+
+	props := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string"}, props["invoice_number"])
+	assert.Equal(t, map[string]any{"type": "number"}, props["total_amount"])
+
+	items := props["items"].(map[string]any)
+	assert.Equal(t, "array", items["type"])
+	itemProps := items["items"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "integer"}, itemProps["number"])
+
+	seller := props["seller"].(map[string]any)["properties"].(map[string]any)
+	assert.Contains(t, seller, "tax_id")
+}
+
+func TestExtractor_StructuredOutput(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "1", "object": "chat.completion", "model": "m",
+			"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {
+				"role": "assistant", "content": "",
+				"tool_calls": [{"id": "c1", "type": "function", "function": {
+					"name": "record_invoice",
+					"arguments": "{\"invoice_number\":\"0000123\",\"total_amount\":1100000}"
+				}}]
+			}}],
+			"usage": {"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2}
+		}`))
+	}))
+	defer srv.Close()
+
+	client := llm.NewClient("key", llm.WithBaseURL(srv.URL))
+
+	inv, err := llm.NewExtractor(client).ExtractFromText(context.Background(), "HOA DON")
+	require.NoError(t, err)
+	assert.Equal(t, "0000123", inv.Number)
+	assert.Equal(t, "1100000", inv.TotalAmount.String())
+
+	tools := body["tools"].([]any)
+	require.Len(t, tools, 1)
+	fn := tools[0].(map[string]any)["function"].(map[string]any)
+	assert.Equal(t, llm.InvoiceSchema.Name, fn["name"])
+	assert.Equal(t, "record_invoice", body["tool_choice"].(map[string]any)["function"].(map[string]any)["name"])
+
+	// Disabled: plain completion without tools
+	_, _ = llm.NewExtractor(client, llm.WithStructuredOutput(false)).ExtractFromText(context.Background(), "HOA DON")
+	assert.NotContains(t, body, "tools")
+}
+
+func TestGeminiProvider_ResponseSchema(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"{}"}]}}]}`))
+	}))
+	defer srv.Close()
+
+	p := llm.NewGeminiProvider(llm.GeminiConfig{APIKey: "k", BaseURL: srv.URL})
+	_, err := p.Complete(context.Background(), &llm.Request{Model: "g", UserPrompt: "x", Schema: llm.InvoiceSchema})
+	require.NoError(t, err)
+
+	cfg := body["generationConfig"].(map[string]any)
+	assert.Equal(t, "application/json", cfg["responseMimeType"])
+	assert.Equal(t, "OBJECT", cfg["responseSchema"].(map[string]any)["type"])
+}
@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ResponseSchemaVersion is the version of the LLMResponse contract the prompts
+// ask for. Bump it, together with "schema_version" in the prompt templates,
+// when a field is renamed, moved or changes meaning, and append a migration
+// from the previous version to responseMigrations. Adding an optional field
+// needs no new version.
+const ResponseSchemaVersion = 1
+
+// ErrUnsupportedSchemaVersion is returned for responses written against a
+// newer contract than this build understands
+var ErrUnsupportedSchemaVersion = errors.New("unsupported LLM response schema version")
+
+// responseMigrations upgrade a decoded response object by one version: the
+// entry at index i converts version i+1 to version i+2. Responses are
+// migrated when they come from the cache, from batch jobs submitted before an
+// upgrade, or from prompt overrides written for an older contract.
+var responseMigrations []func(obj map[string]any) error
+
+// migrateResponse upgrades resp, decoded from response, to
+// ResponseSchemaVersion. Responses without schema_version predate the field
+// and are version 1.
+func migrateResponse(resp *LLMResponse, response string) (*LLMResponse, error) {
+	return migrateResponseTo(resp, response, ResponseSchemaVersion, responseMigrations)
+}
+
+func migrateResponseTo(resp *LLMResponse, response string, current int, migrations []func(map[string]any) error) (*LLMResponse, error) {
+	version := max(resp.SchemaVersion, 1)
+	switch {
+	case version == current:
+		resp.SchemaVersion = current
+		return resp, nil
+	case version > current:
+		return nil, fmt.Errorf("%w: %d (newest supported: %d)", ErrUnsupportedSchemaVersion, version, current)
+	}
+
+	obj, err := decodeObject(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate LLM response: %w", err)
+	}
+	for v := version; v < current; v++ {
+		if err := migrations[v-1](obj); err != nil {
+			return nil, fmt.Errorf("failed to migrate LLM response from schema version %d: %w", v, err)
+		}
+	}
+	obj["schema_version"] = current
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate LLM response: %w", err)
+	}
+	return decodeJSON[LLMResponse](string(data))
+}
+
+// decodeObject decodes the JSON object in a model response, keeping numbers
+// exact, and repairing it like decodeJSON
+func decodeObject(response string) (map[string]any, error) {
+	var err error
+	for _, candidate := range []string{ExtractJSON(response), RepairJSON(response)} {
+		dec := json.NewDecoder(bytes.NewReader([]byte(candidate)))
+		dec.UseNumber()
+		var obj map[string]any
+		if err = dec.Decode(&obj); err == nil {
+			return obj, nil
+		}
+	}
+	return nil, err
+}
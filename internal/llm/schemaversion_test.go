@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateResponse(t *testing.T) {
+	resp, err := decodeResponse(`{"invoice_number":"1","total_amount":100}`)
+	require.NoError(t, err)
+	assert.Equal(t, ResponseSchemaVersion, resp.SchemaVersion, "unversioned responses are version 1")
+
+	_, err = decodeResponse(`{"schema_version":99,"invoice_number":"1"}`)
+	require.ErrorIs(t, err, ErrUnsupportedSchemaVersion)
+	assert.Len(t, responseMigrations, ResponseSchemaVersion-1)
+}
+
+func TestMigrateResponseTo(t *testing.T) {
+	// A version 3 contract whose version 1 called the seller tax ID "tax_code"
+	// and whose version 2 called the total "grand_total"
+	migrations := []func(map[string]any) error{
+		func(obj map[string]any) error {
+			if seller, ok := obj["seller"].(map[string]any); ok {
+				seller["tax_id"] = seller["tax_code"]
+				delete(seller, "tax_code")
+			}
+			return nil
+		},
+		func(obj map[string]any) error {
+			obj["total_amount"] = obj["grand_total"]
+			delete(obj, "grand_total")
+			return nil
+		},
+	}
+
+	raw := "```json\n" + `{"invoice_number":"7","seller":{"tax_code":"0312345678"},"grand_total":12345678901234567890}` + "\n```"
+	resp, err := decodeJSON[LLMResponse](raw)
+	require.NoError(t, err)
+	migrated, err := migrateResponseTo(resp, raw, 3, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, 3, migrated.SchemaVersion)
+	assert.Equal(t, "7", migrated.InvoiceNumber)
+	assert.Equal(t, "0312345678", migrated.Seller.TaxID)
+	assert.Equal(t, "12345678901234567890", migrated.TotalAmount.String(), "numbers stay exact")
+
+	// Version 2 responses skip the first migration
+	raw = `{"schema_version":2,"seller":{"tax_id":"0109876543"},"grand_total":5}`
+	resp, err = decodeJSON[LLMResponse](raw)
+	require.NoError(t, err)
+	migrated, err = migrateResponseTo(resp, raw, 3, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, "0109876543", migrated.Seller.TaxID)
+	assert.Equal(t, "5", migrated.TotalAmount.String())
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PageRange is an inclusive range of 1-based pages holding one document
+type PageRange struct {
+	Start int `json:"start_page"`
+	End   int `json:"end_page"`
+}
+
+// String formats the range as "3" or "3-5"
+func (r PageRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprint(r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// LLMDocumentSplit is the expected JSON structure for document splitting
+type LLMDocumentSplit struct {
+	Documents []PageRange `json:"documents"`
+}
+
+// SplitSchema is the output contract for finding document boundaries in a multi-page file
+var SplitSchema = &ResponseSchema{
+	Name:        "record_document_boundaries",
+	Description: "Record the page ranges of the separate invoices bundled in one file",
+	Schema:      JSONSchemaFor(LLMDocumentSplit{}),
+}
+
+// Page text sent for splitting keeps the header and footer, where invoice
+// numbers and totals are printed
+const (
+	maxSplitPageHead = 1200
+	maxSplitPageTail = 400
+)
+
+// SplitPages finds the invoices in a file from the text of each page, in page order
+func (e *Extractor) SplitPages(ctx context.Context, pages []string) ([]PageRange, error) {
+	var b strings.Builder
+	for i, text := range pages {
+		if len(text) > maxSplitPageHead+maxSplitPageTail {
+			text = text[:maxSplitPageHead] + "\n[...]\n" + text[len(text)-maxSplitPageTail:]
+		}
+		fmt.Fprintf(&b, "=== Page %d ===\n%s\n", i+1, strings.ToValidUTF8(text, ""))
+	}
+
+	return e.split(ctx, e.textModels(ctx), fmt.Sprintf(UserPromptSplitText, len(pages), b.String()), nil, len(pages))
+}
+
+// SplitPageImages finds the invoices in a file from its page images, in page order
+func (e *Extractor) SplitPageImages(ctx context.Context, images []Image) ([]PageRange, error) {
+	return e.split(ctx, e.visionModels(ctx), fmt.Sprintf(UserPromptSplitImages, len(images)), images, len(images))
+}
+
+func (e *Extractor) split(ctx context.Context, models []string, userPrompt string, images []Image, pageCount int) ([]PageRange, error) {
+	response, err := e.complete(ctx, models, SplitSchema, e.promptSet(ctx).SystemInvoice, userPrompt, images)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+
+	resp, err := decodeJSON[LLMDocumentSplit](response)
+	if err != nil {
+		return nil, err
+	}
+
+	return NormalizePageRanges(resp.Documents, pageCount), nil
+}
+
+// NormalizePageRanges orders ranges and makes them cover pages 1..pageCount
+// without overlap: each range runs until the next one starts, so pages the
+// model skipped stay with the preceding document.
+func NormalizePageRanges(ranges []PageRange, pageCount int) []PageRange {
+	if pageCount < 1 {
+		return nil
+	}
+
+	var starts []int
+	for _, r := range ranges {
+		if r.Start >= 1 && r.Start <= pageCount && !slices.Contains(starts, r.Start) {
+			starts = append(starts, r.Start)
+		}
+	}
+	slices.Sort(starts)
+	if len(starts) == 0 || starts[0] != 1 {
+		starts = append([]int{1}, starts...)
+	}
+
+	normalized := make([]PageRange, len(starts))
+	for i, start := range starts {
+		end := pageCount
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		normalized[i] = PageRange{Start: start, End: end}
+	}
+	return normalized
+}
@@ -0,0 +1,46 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestNormalizePageRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []llm.PageRange
+		pages  int
+		want   []llm.PageRange
+	}{
+		{"in order", []llm.PageRange{{1, 2}, {3, 4}}, 4, []llm.PageRange{{1, 2}, {3, 4}}},
+		{"unordered with gap", []llm.PageRange{{4, 5}, {1, 1}}, 5, []llm.PageRange{{1, 3}, {4, 5}}},
+		{"missing first page", []llm.PageRange{{2, 3}}, 3, []llm.PageRange{{1, 1}, {2, 3}}},
+		{"out of range start", []llm.PageRange{{1, 2}, {9, 9}}, 2, []llm.PageRange{{1, 2}}},
+		{"none", nil, 2, []llm.PageRange{{1, 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, llm.NormalizePageRanges(tt.ranges, tt.pages))
+		})
+	}
+}
+
+func TestExtractor_SplitPages(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"documents":[{"start_page":1,"end_page":1},{"start_page":2,"end_page":3}]}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	ranges, err := extractor.SplitPages(context.Background(), []string{"HÓA ĐƠN tháng 1", "HÓA ĐƠN tháng 2", "Bảng kê"})
+	require.NoError(t, err)
+	assert.Equal(t, []llm.PageRange{{Start: 1, End: 1}, {Start: 2, End: 3}}, ranges)
+	assert.Equal(t, "2-3", ranges[1].String())
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, llm.SplitSchema, provider.requests[0].Schema)
+	assert.Contains(t, provider.requests[0].UserPrompt, "=== Page 3 ===\nBảng kê")
+}
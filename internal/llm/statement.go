@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// LLMStatement is the expected JSON structure for bank statement extraction
+type LLMStatement struct {
+	BankName       string           `json:"bank_name"`
+	AccountNumber  string           `json:"account_number"`
+	AccountHolder  string           `json:"account_holder"`
+	Currency       string           `json:"currency"`
+	PeriodStart    string           `json:"period_start"`
+	PeriodEnd      string           `json:"period_end"`
+	OpeningBalance json.Number      `json:"opening_balance"`
+	ClosingBalance json.Number      `json:"closing_balance"`
+	Transactions   []LLMTransaction `json:"transactions"`
+}
+
+// LLMTransaction is one statement line; Amount is signed (credits positive)
+type LLMTransaction struct {
+	Date         string      `json:"date"`
+	Description  string      `json:"description"`
+	Reference    string      `json:"reference"`
+	Counterparty string      `json:"counterparty"`
+	Amount       json.Number `json:"amount"`
+	Balance      json.Number `json:"balance"`
+}
+
+// StatementSchema is the output contract for bank statement extraction
+var StatementSchema = &ResponseSchema{
+	Name:        "record_statement",
+	Description: "Record the account details and every transaction of a bank statement",
+	Schema:      JSONSchemaFor(LLMStatement{}),
+}
+
+// ExtractStatementFromText extracts a bank statement from its text layer
+func (e *Extractor) ExtractStatementFromText(ctx context.Context, text string) (*model.Statement, error) {
+	return e.extractStatement(ctx, e.textModels(ctx), fmt.Sprintf(e.promptSet(ctx).StatementText, text), nil)
+}
+
+// ExtractStatementFromImages extracts one bank statement from its page images
+func (e *Extractor) ExtractStatementFromImages(ctx context.Context, images []Image) (*model.Statement, error) {
+	return e.extractStatement(ctx, e.visionModels(ctx), imagePrompt(e.promptSet(ctx).Statement, images), images)
+}
+
+func (e *Extractor) extractStatement(ctx context.Context, models []string, userPrompt string, images []Image) (*model.Statement, error) {
+	response, err := e.complete(ctx, models, StatementSchema, e.promptSet(ctx).SystemStatement, userPrompt, images)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+
+	resp, err := decodeJSON[LLMStatement](response)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.convertToStatement(resp), nil
+}
+
+func (e *Extractor) convertToStatement(resp *LLMStatement) *model.Statement {
+	currency := strings.ToUpper(strings.TrimSpace(resp.Currency))
+	if currency == "" {
+		currency = "VND"
+	}
+
+	stmt := &model.Statement{
+		BankName:       resp.BankName,
+		AccountNumber:  resp.AccountNumber,
+		AccountHolder:  resp.AccountHolder,
+		Currency:       currency,
+		OpeningBalance: e.parseAmount(resp.OpeningBalance, currency),
+		ClosingBalance: e.parseAmount(resp.ClosingBalance, currency),
+		Transactions:   make([]model.Transaction, 0, len(resp.Transactions)),
+	}
+	if t, err := parseDate(resp.PeriodStart); err == nil {
+		stmt.PeriodStart = t
+	}
+	if t, err := parseDate(resp.PeriodEnd); err == nil {
+		stmt.PeriodEnd = t
+	}
+
+	for i, llmTx := range resp.Transactions {
+		tx := model.Transaction{
+			Description:  llmTx.Description,
+			Reference:    llmTx.Reference,
+			Counterparty: llmTx.Counterparty,
+			Amount:       e.parseAmount(llmTx.Amount, currency),
+			Balance:      e.parseAmount(llmTx.Balance, currency),
+		}
+		if t, err := parseDate(llmTx.Date); err == nil {
+			tx.Date = t
+		} else {
+			stmt.LowConfidenceFields = append(stmt.LowConfidenceFields, fmt.Sprintf("transactions[%d].date", i))
+		}
+		stmt.Transactions = append(stmt.Transactions, tx)
+	}
+
+	return stmt
+}
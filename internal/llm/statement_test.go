@@ -0,0 +1,53 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_ExtractStatementFromText(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{
+		"bank_name": "Vietcombank",
+		"account_number": "0071000123456",
+		"currency": "VND",
+		"period_start": "2026-01-01",
+		"period_end": "2026-01-31",
+		"opening_balance": "10.000.000",
+		"closing_balance": 12500000,
+		"transactions": [
+			{"date": "2026-01-05", "description": "CTY ABC TT HD 0000123", "reference": "FT2601", "amount": "2.500.000", "balance": 12500000},
+			{"date": "05/01", "description": "Phi SMS", "amount": -11000}
+		]
+	}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	stmt, err := extractor.ExtractStatementFromText(context.Background(), "SAO KE TAI KHOAN")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Vietcombank", stmt.BankName)
+	assert.Equal(t, "0071000123456", stmt.AccountNumber)
+	assert.Equal(t, "2026-01-31", stmt.PeriodEnd.Format("2006-01-02"))
+	assert.Equal(t, "10000000", stmt.OpeningBalance.String())
+	assert.Equal(t, "12500000", stmt.ClosingBalance.String())
+
+	require.Len(t, stmt.Transactions, 2)
+	assert.Equal(t, "2500000", stmt.Transactions[0].Amount.String())
+	assert.Equal(t, "FT2601", stmt.Transactions[0].Reference)
+	assert.Equal(t, "-11000", stmt.Transactions[1].Amount.String())
+	assert.Equal(t, []string{"transactions[1].date"}, stmt.LowConfidenceFields)
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, llm.StatementSchema, provider.requests[0].Schema)
+	assert.Contains(t, provider.requests[0].UserPrompt, "SAO KE TAI KHOAN")
+}
+
+func TestPromptSet_ValidateStatementText(t *testing.T) {
+	prompts := llm.DefaultPrompts()
+	prompts.StatementText = "no placeholder"
+	assert.Error(t, prompts.Validate())
+}
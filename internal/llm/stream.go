@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrStreamIdle is returned when a stream produces no output within the idle timeout
+var ErrStreamIdle = errors.New("stream idle timeout")
+
+// StreamHandler receives incremental output as it arrives.
+// Returning an error aborts the stream.
+type StreamHandler func(delta string) error
+
+// StreamingProvider is implemented by providers that can stream completions
+type StreamingProvider interface {
+	Provider
+	CompleteStream(ctx context.Context, req *Request, handler StreamHandler) (*Response, error)
+}
+
+// StreamEvent is delivered on the channel returned by Client.Stream.
+// The final event carries either Response or Err.
+type StreamEvent struct {
+	Delta    string
+	Response *Response
+	Err      error
+}
+
+// CompleteStream sends a request and passes output to handler as it arrives.
+// Providers without streaming support, and cache hits, deliver the whole
+// response as one delta.
+// With an idle timeout configured, the request is aborted with ErrStreamIdle
+// when no output arrives for that long.
+func (c *Client) CompleteStream(ctx context.Context, req *Request, handler StreamHandler) (*Response, error) {
+	if req.Model == "" {
+		req.Model = c.defaultModel
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = DefaultMaxTokens
+	}
+	if c.promptCaching {
+		req.CachePrompt = true
+	}
+	if handler == nil {
+		handler = func(string) error { return nil }
+	}
+
+	ctx, span := c.startSpan(ctx, req, true)
+	start := time.Now()
+	resp, err := c.cachedComplete(ctx, req, func() (*Response, error) {
+		if err := checkGate(ctx, req); err != nil {
+			return nil, err
+		}
+		return c.guarded(ctx, req, func() (*Response, error) {
+			return c.throttled(ctx, req, func() (*Response, error) {
+				ctx, cancel := c.withRequestTimeout(ctx)
+				defer cancel()
+				return c.streamProvider(ctx, req, handler)
+			})
+		})
+	})
+	endSpan(span, resp, err)
+	c.audit(ctx, req, resp, err, start, true)
+	c.record(ctx, req, resp, err, start, true)
+	c.logCall(ctx, req, resp, err, start)
+	meter(ctx, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cached responses arrive as a single delta
+	if resp.Cached {
+		if err := handler(resp.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) streamProvider(ctx context.Context, req *Request, handler StreamHandler) (*Response, error) {
+	sp, ok := c.provider.(StreamingProvider)
+	if !ok {
+		resp, err := c.provider.Complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := handler(resp.Content); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	if c.streamIdleTimeout <= 0 {
+		return sp.CompleteStream(ctx, req, handler)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	idle := time.AfterFunc(c.streamIdleTimeout, func() { cancel(ErrStreamIdle) })
+	defer idle.Stop()
+
+	resp, err := sp.CompleteStream(ctx, req, func(delta string) error {
+		idle.Reset(c.streamIdleTimeout)
+		return handler(delta)
+	})
+	if err != nil && errors.Is(context.Cause(ctx), ErrStreamIdle) {
+		return nil, fmt.Errorf("%w: no output for %s", ErrStreamIdle, c.streamIdleTimeout)
+	}
+
+	return resp, err
+}
+
+// Stream is the channel form of CompleteStream. The channel is closed after
+// the final event; callers should drain it or cancel ctx.
+func (c *Client) Stream(ctx context.Context, req *Request) <-chan StreamEvent {
+	events := make(chan StreamEvent)
+
+	go func() {
+		defer close(events)
+
+		resp, err := c.CompleteStream(ctx, req, func(delta string) error {
+			select {
+			case events <- StreamEvent{Delta: delta}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+
+		select {
+		case events <- StreamEvent{Response: resp, Err: err}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return events
+}
+
+// doStream sends req and returns the response body for incremental reading
+func doStream(httpClient *http.Client, req *http.Request, provider string) (io.ReadCloser, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", provider, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return resp.Body, nil
+}
+
+// readSSE calls fn with the data of each server-sent event
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var data bytes.Buffer
+	flush := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		defer data.Reset()
+		if bytes.Equal(data.Bytes(), []byte("[DONE]")) {
+			return nil
+		}
+		return fn(data.Bytes())
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(value, []byte(" ")))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+
+	return flush()
+}
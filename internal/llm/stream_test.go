@@ -0,0 +1,130 @@
+package llm_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestClient_CompleteStream_OpenAI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{`{\"invoice_`, `number\":\"7\"}`} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"%s\"}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	client := llm.NewClient("key", llm.WithBaseURL(srv.URL))
+
+	var deltas []string
+	resp, err := client.CompleteStream(context.Background(), &llm.Request{UserPrompt: "x"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"invoice_`, `number":"7"}`}, deltas)
+	assert.Equal(t, `{"invoice_number":"7"}`, resp.Content)
+	assert.Equal(t, int64(5), resp.Usage.PromptTokens)
+}
+
+func TestClient_Stream_Ollama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"model":"m","message":{"role":"assistant","content":"hel"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"m","message":{"role":"assistant","content":"lo"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"m","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":3,"eval_count":2}`)
+	}))
+	defer srv.Close()
+
+	client := llm.NewClient("", llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})))
+
+	var text strings.Builder
+	var final *llm.Response
+	for event := range client.Stream(context.Background(), &llm.Request{UserPrompt: "x"}) {
+		require.NoError(t, event.Err)
+		text.WriteString(event.Delta)
+		if event.Response != nil {
+			final = event.Response
+		}
+	}
+
+	assert.Equal(t, "hello", text.String())
+	require.NotNil(t, final)
+	assert.Equal(t, "hello", final.Content)
+	assert.Equal(t, int64(2), final.Usage.CompletionTokens)
+}
+
+func TestClient_CompleteStream_IdleTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"model":"m","message":{"role":"assistant","content":"partial"}}`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithStreamIdleTimeout(50*time.Millisecond),
+	)
+
+	_, err := client.CompleteStream(context.Background(), &llm.Request{UserPrompt: "x"}, nil)
+	require.ErrorIs(t, err, llm.ErrStreamIdle)
+	assert.True(t, llm.IsRetryable(err))
+}
+
+type staticProvider struct{ content string }
+
+func (p staticProvider) Name() string { return "static" }
+
+func (p staticProvider) Complete(context.Context, *llm.Request) (*llm.Response, error) {
+	return &llm.Response{Content: p.content}, nil
+}
+
+func TestClient_CompleteStream_NonStreamingProvider(t *testing.T) {
+	client := llm.NewClient("", llm.WithProvider(staticProvider{content: "whole"}))
+
+	var deltas []string
+	resp, err := client.CompleteStream(context.Background(), &llm.Request{UserPrompt: "x"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "whole", resp.Content)
+	assert.Equal(t, []string{"whole"}, deltas)
+}
+
+func TestGeminiProvider_CompleteStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/g:streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"a\"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"b\"}]}}],\"usageMetadata\":{\"promptTokenCount\":4,\"candidatesTokenCount\":2}}\n\n")
+	}))
+	defer srv.Close()
+
+	p := llm.NewGeminiProvider(llm.GeminiConfig{APIKey: "k", BaseURL: srv.URL})
+
+	var deltas []string
+	resp, err := p.CompleteStream(context.Background(), &llm.Request{Model: "g", UserPrompt: "x"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, deltas)
+	assert.Equal(t, "ab", resp.Content)
+	assert.Equal(t, int64(4), resp.Usage.PromptTokens)
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// WithTaxIDCheck rejects extracted tax IDs that fail model.ValidateTaxID,
+// most often a digit misread on a scan, rather than passing them on to the
+// ERP. A rejected seller tax ID is asked for again when field recovery is
+// on (see WithFieldRecovery), and the new value kept if it passes, listed in
+// Invoice.Corrections. Tax IDs still failing are cleared and added to
+// Invoice.LowConfidenceFields.
+func WithTaxIDCheck() ExtractorOption {
+	return func(e *Extractor) {
+		e.taxIDCheck = true
+	}
+}
+
+// taxIDFields are the tax IDs of an invoice by JSON path
+func taxIDFields(inv *model.Invoice) map[string]*string {
+	return map[string]*string{
+		"seller.tax_id": &inv.Seller.TaxID,
+		"buyer.tax_id":  &inv.Buyer.TaxID,
+	}
+}
+
+// rejectTaxIDs clears the tax IDs of inv that fail their check and returns
+// their values by JSON path
+func (e *Extractor) rejectTaxIDs(inv *model.Invoice) map[string]string {
+	if !e.taxIDCheck {
+		return nil
+	}
+	rejected := make(map[string]string)
+	for path, taxID := range taxIDFields(inv) {
+		if *taxID != "" && model.ValidateTaxID(*taxID) != nil {
+			rejected[path] = *taxID
+			*taxID = ""
+		}
+	}
+	return rejected
+}
+
+// settleTaxIDs records the rejected tax IDs of inv re-read by field recovery
+// as corrections, and flags those still missing or failing their check
+func settleTaxIDs(inv *model.Invoice, rejected map[string]string) {
+	fields := taxIDFields(inv)
+	for _, path := range []string{"seller.tax_id", "buyer.tax_id"} {
+		original, ok := rejected[path]
+		if !ok {
+			continue
+		}
+		if taxID := fields[path]; *taxID != "" && model.ValidateTaxID(*taxID) == nil {
+			inv.Corrections = append(inv.Corrections, fmt.Sprintf("%s: %s → %s", path, original, *taxID))
+			continue
+		}
+		*fields[path] = ""
+		if !slices.Contains(inv.LowConfidenceFields, path) {
+			inv.LowConfidenceFields = append(inv.LowConfidenceFields, path)
+		}
+	}
+}
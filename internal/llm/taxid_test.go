@@ -0,0 +1,57 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestExtractor_TaxIDCheck(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"12","date":"2024-03-15","total_amount":1100000,"seller":{"tax_id":"0100189106"},"buyer":{"tax_id":"0101248141-002"}}`,
+		`{"seller":{"tax_id":"0100109106"}}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithTaxIDCheck(), llm.WithFieldRecovery())
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 MST 0100109106 ...")
+	require.NoError(t, err)
+	assert.Equal(t, "0100109106", inv.Seller.TaxID, "the seller's is asked again")
+	assert.Equal(t, []string{"seller.tax_id: 0100189106 → 0100109106"}, inv.Corrections)
+	assert.Equal(t, "0101248141-002", inv.Buyer.TaxID, "valid tax IDs are kept")
+	assert.Empty(t, inv.LowConfidenceFields)
+
+	require.Len(t, provider.requests, 2)
+	assert.Contains(t, provider.requests[1].UserPrompt, "seller.tax_id")
+}
+
+func TestExtractor_TaxIDCheck_Unresolved(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"12","seller":{"tax_id":"0100109108"},"buyer":{"tax_id":"0312345678"}}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithTaxIDCheck())
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 ...")
+	require.NoError(t, err)
+	assert.Empty(t, inv.Seller.TaxID)
+	assert.Empty(t, inv.Buyer.TaxID)
+	assert.Equal(t, []string{"seller.tax_id", "buyer.tax_id"}, inv.LowConfidenceFields)
+	assert.Empty(t, inv.Corrections)
+	assert.Len(t, provider.requests, 1, "without field recovery nothing is asked again")
+}
+
+func TestExtractor_TaxIDCheck_PersonalID(t *testing.T) {
+	provider := &recordingProvider{responses: []string{
+		`{"invoice_number":"12","seller":{"tax_id":"001085012345"},"buyer":{"tax_id":"079199000001"}}`,
+	}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithTaxIDCheck())
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 ...")
+	require.NoError(t, err)
+	assert.Equal(t, "001085012345", inv.Seller.TaxID, "12-digit personal IDs are kept")
+	assert.Equal(t, "079199000001", inv.Buyer.TaxID)
+	assert.Empty(t, inv.LowConfidenceFields)
+}
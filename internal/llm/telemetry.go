@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Outcome classifies how an LLM call ended
+type Outcome string
+
+const (
+	OutcomeSuccess     Outcome = "success"
+	OutcomeCached      Outcome = "cached" // Served from the response cache
+	OutcomeRateLimited Outcome = "rate_limited"
+	OutcomeTimeout     Outcome = "timeout"
+	OutcomeCanceled    Outcome = "canceled"
+	OutcomeCircuitOpen Outcome = "circuit_open" // Not sent: the model's circuit breaker is open
+	OutcomeError       Outcome = "error"
+)
+
+// CallRecord is the telemetry of one client call: one provider request, or a
+// cache hit. Retries by the Extractor are separate calls with a higher Attempt.
+type CallRecord struct {
+	Provider   string
+	Model      string
+	DocumentID string // From ContextWithDocumentID
+	Schema     string
+	Streamed   bool
+
+	Attempt  int // 1 for the first try of a model, 2 for its first retry, ...
+	Fallback int // Position of Model in the extractor's fallback chain; 0 = primary
+
+	Latency time.Duration
+	Usage   Usage
+	Outcome Outcome
+	Err     error
+}
+
+// Retried reports whether the call was a retry of an earlier failed one
+func (r CallRecord) Retried() bool {
+	return r.Attempt > 1
+}
+
+// TelemetryHook receives a CallRecord after every client call. It runs
+// synchronously and must be safe for concurrent use; slow work such as
+// network export should be handed off.
+type TelemetryHook interface {
+	RecordCall(ctx context.Context, record CallRecord)
+}
+
+// TelemetryHookFunc adapts a function to TelemetryHook
+type TelemetryHookFunc func(ctx context.Context, record CallRecord)
+
+// RecordCall calls f
+func (f TelemetryHookFunc) RecordCall(ctx context.Context, record CallRecord) {
+	f(ctx, record)
+}
+
+// WithTelemetry adds a telemetry hook; several may be registered
+func WithTelemetry(hook TelemetryHook) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.telemetry = append(cfg.telemetry, hook)
+	}
+}
+
+type attemptKey struct{}
+
+type attemptInfo struct {
+	attempt, fallback int
+}
+
+// contextWithAttempt tags calls made with ctx as the given retry attempt of
+// the given fallback model
+func contextWithAttempt(ctx context.Context, attempt, fallback int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attemptInfo{attempt: attempt, fallback: fallback})
+}
+
+// record reports a finished call to the telemetry hooks
+func (c *Client) record(ctx context.Context, req *Request, resp *Response, err error, start time.Time, streamed bool) {
+	if len(c.telemetry) == 0 {
+		return
+	}
+
+	info, ok := ctx.Value(attemptKey{}).(attemptInfo)
+	if !ok {
+		info.attempt = 1
+	}
+
+	record := CallRecord{
+		Provider:   c.provider.Name(),
+		Model:      req.Model,
+		DocumentID: DocumentIDFromContext(ctx),
+		Streamed:   streamed,
+		Attempt:    info.attempt,
+		Fallback:   info.fallback,
+		Latency:    time.Since(start),
+		Outcome:    callOutcome(resp, err),
+		Err:        err,
+	}
+	if req.Schema != nil {
+		record.Schema = req.Schema.Name
+	}
+	if resp != nil {
+		record.Usage = resp.Usage
+		if resp.Model != "" {
+			record.Model = resp.Model
+		}
+	}
+
+	for _, hook := range c.telemetry {
+		hook.RecordCall(ctx, record)
+	}
+}
+
+// ErrorOutcome classifies a failed call from its error, or an error wrapping
+// it; a nil error is OutcomeSuccess
+func ErrorOutcome(err error) Outcome {
+	return callOutcome(nil, err)
+}
+
+// callOutcome classifies the result of a call
+func callOutcome(resp *Response, err error) Outcome {
+	if err == nil {
+		if resp != nil && resp.Cached {
+			return OutcomeCached
+		}
+		return OutcomeSuccess
+	}
+
+	var apiErr *APIError
+	var openaiErr *openai.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case errors.Is(err, ErrCircuitOpen):
+		return OutcomeCircuitOpen
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests,
+		errors.As(err, &openaiErr) && openaiErr.StatusCode == http.StatusTooManyRequests:
+		return OutcomeRateLimited
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrStreamIdle),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return OutcomeTimeout
+	default:
+		return OutcomeError
+	}
+}
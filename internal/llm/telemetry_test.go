@@ -0,0 +1,99 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+type callRecorder struct {
+	mu      sync.Mutex
+	records []llm.CallRecord
+}
+
+func (r *callRecorder) RecordCall(_ context.Context, record llm.CallRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+func TestTelemetry_RetriesAndFallback(t *testing.T) {
+	srv, _ := ollamaServer(t, func(model string, call int) int {
+		switch {
+		case model == "primary" && call == 1:
+			return http.StatusTooManyRequests
+		case model == "primary":
+			return http.StatusBadRequest
+		default:
+			return http.StatusOK
+		}
+	})
+
+	rec := &callRecorder{}
+	client := llm.NewClient("",
+		llm.WithProvider(llm.NewOllamaProvider(llm.OllamaConfig{BaseURL: srv.URL})),
+		llm.WithTelemetry(rec),
+	)
+	extractor := llm.NewExtractor(client,
+		llm.WithModel("primary"),
+		llm.WithFallbackModels("backup"),
+		llm.WithRetryPolicy(fastRetry),
+	)
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "inv-7.pdf")
+	_, err := extractor.ExtractFromText(ctx, "text")
+	require.NoError(t, err)
+
+	require.Len(t, rec.records, 3)
+	first, retry, fallback := rec.records[0], rec.records[1], rec.records[2]
+
+	assert.Equal(t, "ollama", first.Provider)
+	assert.Equal(t, "primary", first.Model)
+	assert.Equal(t, "inv-7.pdf", first.DocumentID)
+	assert.Equal(t, llm.InvoiceSchema.Name, first.Schema)
+	assert.Equal(t, 1, first.Attempt)
+	assert.Equal(t, llm.OutcomeRateLimited, first.Outcome)
+	assert.Error(t, first.Err)
+
+	assert.True(t, retry.Retried())
+	assert.Equal(t, llm.OutcomeError, retry.Outcome)
+
+	assert.Equal(t, "backup", fallback.Model)
+	assert.Equal(t, 1, fallback.Attempt)
+	assert.Equal(t, 1, fallback.Fallback)
+	assert.Equal(t, llm.OutcomeSuccess, fallback.Outcome)
+	assert.NoError(t, fallback.Err)
+	assert.Positive(t, fallback.Latency)
+}
+
+func TestTelemetry_CachedAndCanceled(t *testing.T) {
+	rec := &callRecorder{}
+	client := llm.NewClient("",
+		llm.WithProvider(staticProvider{content: `{"ok":true}`}),
+		llm.WithTelemetry(rec),
+		llm.WithCache(llm.NewMemoryCache(10), 0),
+	)
+
+	for range 2 {
+		_, err := client.Complete(context.Background(), &llm.Request{Model: "m", UserPrompt: "hi"})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	failing := llm.NewClient("", llm.WithProvider(failingProvider{err: context.Canceled}), llm.WithTelemetry(rec))
+	_, err := failing.Complete(ctx, &llm.Request{Model: "m"})
+	require.Error(t, err)
+
+	require.Len(t, rec.records, 3)
+	assert.Equal(t, llm.OutcomeSuccess, rec.records[0].Outcome)
+	assert.Equal(t, llm.OutcomeCached, rec.records[1].Outcome)
+	assert.Equal(t, llm.OutcomeCanceled, rec.records[2].Outcome)
+	assert.Equal(t, "failing", rec.records[2].Provider)
+}
@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+// WithTracer traces every call in a span named "llm.complete", with the
+// provider, model, schema, attempt, token usage and outcome as attributes
+// (GenAI semantic convention names where one exists). Calls made with a
+// context that carries a tracer (tracing.ContextWithTracer) are traced with
+// that one instead, nested in the caller's spans.
+func WithTracer(t tracing.Tracer) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.tracer = t
+	}
+}
+
+// startSpan starts the span of a call
+func (c *Client) startSpan(ctx context.Context, req *Request, streamed bool) (context.Context, tracing.Span) {
+	if tracing.TracerFromContext(ctx) == nil {
+		ctx = tracing.ContextWithTracer(ctx, c.tracer)
+	}
+
+	info, ok := ctx.Value(attemptKey{}).(attemptInfo)
+	if !ok {
+		info.attempt = 1
+	}
+	attrs := []tracing.Attribute{
+		tracing.String("gen_ai.system", c.provider.Name()),
+		tracing.String("gen_ai.request.model", req.Model),
+		tracing.Int64("gen_ai.request.max_tokens", req.MaxTokens),
+		tracing.Bool("llm.streamed", streamed),
+		tracing.Int("llm.attempt", info.attempt),
+		tracing.Int("llm.fallback", info.fallback),
+		tracing.Int("llm.images", len(req.Images)),
+	}
+	if req.Schema != nil {
+		attrs = append(attrs, tracing.String("llm.schema", req.Schema.Name))
+	}
+	if doc := DocumentIDFromContext(ctx); doc != "" {
+		attrs = append(attrs, tracing.String("llm.document_id", doc))
+	}
+	return tracing.Start(ctx, "llm.complete", attrs...)
+}
+
+// endSpan records the result of a call and ends its span
+func endSpan(span tracing.Span, resp *Response, err error) {
+	span.SetAttributes(tracing.String("llm.outcome", string(callOutcome(resp, err))))
+	if resp != nil {
+		span.SetAttributes(
+			tracing.String("gen_ai.response.model", resp.Model),
+			tracing.Int64("gen_ai.usage.input_tokens", resp.Usage.PromptTokens),
+			tracing.Int64("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens),
+			tracing.Int64("llm.usage.cached_input_tokens", resp.Usage.CachedPromptTokens),
+			tracing.Bool("llm.cached", resp.Cached),
+		)
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,67 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+type spanRecord struct {
+	name  string
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *spanRecord) SetAttributes(attrs ...tracing.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *spanRecord) RecordError(err error) { s.err = err }
+func (s *spanRecord) End()                  { s.ended = true }
+
+type spanRecorder struct{ spans []*spanRecord }
+
+func (r *spanRecorder) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	span := &spanRecord{name: name, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func TestClient_Tracing(t *testing.T) {
+	rec := &spanRecorder{}
+	client := llm.NewClient("", llm.WithProvider(usageProvider{}), llm.WithTracer(rec))
+
+	_, err := client.Complete(llm.ContextWithDocumentID(context.Background(), "inv-7.pdf"), &llm.Request{Model: "m1", Schema: llm.InvoiceSchema})
+	require.NoError(t, err)
+
+	require.Len(t, rec.spans, 1)
+	span := rec.spans[0]
+	assert.Equal(t, "llm.complete", span.name)
+	assert.True(t, span.ended)
+	assert.Equal(t, "usage", span.attrs["gen_ai.system"])
+	assert.Equal(t, "m1", span.attrs["gen_ai.request.model"])
+	assert.Equal(t, llm.InvoiceSchema.Name, span.attrs["llm.schema"])
+	assert.Equal(t, "inv-7.pdf", span.attrs["llm.document_id"])
+	assert.Equal(t, int64(10), span.attrs["gen_ai.usage.input_tokens"])
+	assert.Equal(t, int64(5), span.attrs["gen_ai.usage.output_tokens"])
+	assert.Equal(t, "success", span.attrs["llm.outcome"])
+
+	// A tracer in the context wins over the client's
+	ctxRec := &spanRecorder{}
+	failing := llm.NewClient("", llm.WithProvider(failingProvider{err: errors.New("boom")}), llm.WithTracer(rec))
+	_, err = failing.Complete(tracing.ContextWithTracer(context.Background(), ctxRec), &llm.Request{Model: "m1"})
+	require.Error(t, err)
+	require.Len(t, ctxRec.spans, 1)
+	assert.Len(t, rec.spans, 1)
+	assert.EqualError(t, ctxRec.spans[0].err, "boom")
+	assert.Equal(t, "error", ctxRec.spans[0].attrs["llm.outcome"])
+}
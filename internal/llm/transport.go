@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPOptions configures how a provider reaches its API
+type HTTPOptions struct {
+	Client  *http.Client      // Injected client; its transport is reused and a zero Timeout is filled in
+	Proxy   *url.URL          // Egress proxy (default: HTTP_PROXY/HTTPS_PROXY from the environment)
+	Headers map[string]string // Extra headers sent with every request
+}
+
+// httpClient builds the client a provider uses. The injected client is copied,
+// never modified.
+func (o HTTPOptions) httpClient(timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if o.Client != nil {
+		copied := *o.Client
+		client = &copied
+		if client.Timeout == 0 {
+			client.Timeout = timeout
+		}
+	}
+
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if o.Proxy != nil {
+		if t, ok := transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.Proxy = http.ProxyURL(o.Proxy)
+			transport = t
+		}
+	}
+	if len(o.Headers) > 0 {
+		transport = &headerTransport{base: transport, headers: o.Headers}
+	}
+	client.Transport = transport
+
+	return client
+}
+
+// headerTransport adds fixed headers to every request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// WithHTTPClient sets the http.Client used by the default OpenAI-compatible provider
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.http.Client = client
+	}
+}
+
+// WithProxy routes the default provider's requests through an HTTP proxy
+func WithProxy(proxy *url.URL) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.http.Proxy = proxy
+	}
+}
+
+// WithHeader adds a header to every request of the default provider
+func WithHeader(key, value string) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.http.Headers == nil {
+			cfg.http.Headers = make(map[string]string)
+		}
+		cfg.http.Headers[key] = value
+	}
+}
+
+// WithRequestTimeout bounds each provider call, including streams, separately
+// from time spent waiting on rate limits. Timed-out calls are retryable.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.requestTimeout = d
+	}
+}
+
+// withRequestTimeout applies the per-request timeout to ctx
+func (c *Client) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
+}
@@ -0,0 +1,86 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+const ollamaReply = `{"model":"m","message":{"role":"assistant","content":"ok"},"done":true}`
+
+func TestHTTPOptions_HeadersAndClient(t *testing.T) {
+	var gotHeader atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader.Store(r.Header.Get("X-Tenant"))
+		w.Write([]byte(ollamaReply))
+	}))
+	defer srv.Close()
+
+	injected := &http.Client{}
+	provider := llm.NewOllamaProvider(llm.OllamaConfig{
+		BaseURL: srv.URL,
+		HTTP: llm.HTTPOptions{
+			Client:  injected,
+			Headers: map[string]string{"X-Tenant": "acme"},
+		},
+	})
+
+	_, err := provider.Complete(context.Background(), &llm.Request{Model: "m", UserPrompt: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", gotHeader.Load())
+	assert.Nil(t, injected.Transport, "injected client is not modified")
+	assert.Zero(t, injected.Timeout)
+}
+
+func TestHTTPOptions_Proxy(t *testing.T) {
+	var proxied atomic.Bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL
+		proxied.Store(r.URL.Host == "ollama.internal:11434")
+		w.Write([]byte(ollamaReply))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	provider, err := llm.NewProvider(llm.ProviderConfig{
+		Name:    llm.ProviderOllama,
+		BaseURL: "http://ollama.internal:11434",
+		HTTP:    llm.HTTPOptions{Proxy: proxyURL},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Complete(context.Background(), &llm.Request{Model: "m", UserPrompt: "hi"})
+	require.NoError(t, err)
+	assert.True(t, proxied.Load())
+}
+
+// blockingProvider waits for the request context to end
+type blockingProvider struct{}
+
+func (blockingProvider) Name() string { return "blocking" }
+
+func (blockingProvider) Complete(ctx context.Context, _ *llm.Request) (*llm.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	client := llm.NewClient("", llm.WithProvider(blockingProvider{}), llm.WithRequestTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := client.Complete(context.Background(), &llm.Request{Model: "m"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, llm.IsRetryable(err))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultTextTokenBudget caps the document text sent for text extraction. It
+// leaves room for the prompt and output in the smallest common context windows.
+const DefaultTextTokenBudget = 24000
+
+// WithTextTokenBudget sets the estimated number of tokens of document text sent
+// for extraction (default: DefaultTextTokenBudget; 0 sends all text). Longer
+// text is shortened with TruncateText and the invoice marked TextTruncated.
+func WithTextTokenBudget(tokens int) ExtractorOption {
+	return func(e *Extractor) {
+		e.textTokenBudget = tokens
+	}
+}
+
+// EstimateTokens approximates the number of tokens in s. Vietnamese text
+// tokenizes at roughly three characters per token; most other text at four, so
+// the estimate errs on the high side.
+func EstimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 2) / 3
+}
+
+// Line salience, highest first
+const (
+	salienceKey    = 3 // Header lines and lines labeling numbers, tax IDs or totals
+	salienceFooter = 2 // The last lines, where totals are printed
+	salienceTable  = 1 // Rows with several numbers, likely line items
+)
+
+const (
+	headerLines = 15
+	footerLines = 10
+)
+
+var (
+	// keyLine matches labels of fields the extraction needs
+	keyLine = regexp.MustCompile(`(?i)hóa đơn|hoá đơn|invoice|ký hiệu|số\s*:|mã số thuế|\bmst\b|tax code|tax id|ngày\s+\d|date|người bán|đơn vị bán|người mua|đơn vị mua|seller|buyer|tổng|cộng tiền|thành tiền|thuế gtgt|\bvat\b|thuế suất|bằng chữ|in words|total|subtotal|chiết khấu|discount`)
+
+	// number matches an amount or quantity
+	number = regexp.MustCompile(`\d[\d.,]*`)
+)
+
+// TruncateText shortens text to about maxTokens (see EstimateTokens) while
+// keeping the lines extraction depends on: the header, lines labeling invoice
+// numbers, tax IDs and totals (with their neighbours), the closing lines and
+// then as many table rows as fit. Dropped runs of lines are replaced by a
+// marker. It reports whether anything was dropped.
+func TruncateText(text string, maxTokens int) (string, bool) {
+	if maxTokens <= 0 || EstimateTokens(text) <= maxTokens {
+		return text, false
+	}
+
+	lines := strings.Split(text, "\n")
+	salience := lineSalience(lines)
+
+	// Lines are taken by salience, then in document order
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return salience[order[a]] > salience[order[b]]
+	})
+
+	// Each marker costs a few tokens; reserve them up front
+	budget := maxTokens - maxTokens/20
+	keep := make([]bool, len(lines))
+	for _, i := range order {
+		cost := EstimateTokens(lines[i]) + 1
+		if cost > budget {
+			if salience[i] < salienceKey {
+				break
+			}
+			continue // A long key line is skipped so the shorter ones still fit
+		}
+		keep[i] = true
+		budget -= cost
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		if keep[i] {
+			b.WriteString(lines[i])
+			b.WriteByte('\n')
+			i++
+			continue
+		}
+		omitted := 0
+		for ; i < len(lines) && !keep[i]; i++ {
+			if strings.TrimSpace(lines[i]) != "" {
+				omitted++
+			}
+		}
+		if omitted > 0 {
+			fmt.Fprintf(&b, "[... %d lines omitted ...]\n", omitted)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n"), true
+}
+
+// lineSalience scores each line of a document by how much extraction needs it
+func lineSalience(lines []string) []int {
+	salience := make([]int, len(lines))
+	raise := func(i, s int) {
+		if i >= 0 && i < len(lines) && s > salience[i] {
+			salience[i] = s
+		}
+	}
+
+	seen := 0
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		seen++
+
+		switch {
+		case seen <= headerLines:
+			raise(i, salienceKey)
+		case keyLine.MatchString(line):
+			// The value is often on the line after its label, or in the column before
+			raise(i-1, salienceKey)
+			raise(i, salienceKey)
+			raise(i+1, salienceKey)
+		case len(number.FindAllString(line, 3)) >= 2:
+			raise(i, salienceTable)
+		}
+	}
+
+	for i, n := len(lines)-1, 0; i >= 0 && n < footerLines; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			raise(i, salienceFooter)
+			n++
+		}
+	}
+	return salience
+}
+
+// truncate shortens document text to the extractor's budget
+func (e *Extractor) truncate(text string) (string, bool) {
+	return TruncateText(text, e.textTokenBudget)
+}
@@ -0,0 +1,86 @@
+package llm_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// longInvoice builds invoice text with n line items and filler between the items and totals
+func longInvoice(n int) string {
+	lines := []string{
+		"HÓA ĐƠN GIÁ TRỊ GIA TĂNG",
+		"Ký hiệu: 1C24TAA Số: 0000123",
+		"Ngày 15 tháng 03 năm 2024",
+		"Đơn vị bán hàng: CÔNG TY TNHH ABC",
+		"Mã số thuế: 0312345678",
+	}
+	for i := 1; i <= n; i++ {
+		lines = append(lines, fmt.Sprintf("%d Hàng hóa số %d cái 2 50.000 100.000", i, i))
+	}
+	for i := 0; i < n; i++ {
+		lines = append(lines, "Ghi chú điều khoản giao nhận và bảo hành áp dụng cho đơn hàng")
+	}
+	lines = append(lines,
+		"Cộng tiền hàng: 1.000.000",
+		"Thuế suất GTGT: 10%",
+		"Tổng cộng tiền thanh toán: 1.100.000",
+		"Người bán hàng",
+	)
+	return strings.Join(lines, "\n")
+}
+
+func TestTruncateText(t *testing.T) {
+	text := longInvoice(200)
+
+	out, truncated := llm.TruncateText(text, 2000)
+	require.True(t, truncated)
+	assert.LessOrEqual(t, llm.EstimateTokens(out), 2000)
+
+	assert.Contains(t, out, "Ký hiệu: 1C24TAA Số: 0000123")
+	assert.Contains(t, out, "Mã số thuế: 0312345678")
+	assert.Contains(t, out, "Tổng cộng tiền thanh toán: 1.100.000")
+	assert.Contains(t, out, "Thuế suất GTGT: 10%")
+	assert.Contains(t, out, "1 Hàng hóa số 1 cái 2 50.000 100.000", "the first line items fit")
+	assert.Contains(t, out, "lines omitted ...]")
+
+	// Table rows are kept before filler
+	assert.Less(t, strings.Count(out, "Ghi chú"), strings.Count(out, "Hàng hóa số"))
+}
+
+func TestTruncateText_WithinBudget(t *testing.T) {
+	text := longInvoice(3)
+
+	out, truncated := llm.TruncateText(text, 10000)
+	assert.False(t, truncated)
+	assert.Equal(t, text, out)
+
+	out, truncated = llm.TruncateText(longInvoice(500), 0)
+	assert.False(t, truncated, "a zero budget disables truncation")
+	assert.Equal(t, longInvoice(500), out)
+}
+
+func TestExtractor_TextTokenBudget(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"0000123","total_amount":1100000}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithTextTokenBudget(1000))
+
+	inv, err := extractor.ExtractFromText(context.Background(), longInvoice(300))
+	require.NoError(t, err)
+	assert.True(t, inv.TextTruncated)
+
+	require.Len(t, provider.requests, 1)
+	prompt := provider.requests[0].UserPrompt
+	assert.Contains(t, prompt, "lines omitted ...]")
+	assert.Contains(t, prompt, "Tổng cộng tiền thanh toán: 1.100.000")
+	assert.Less(t, llm.EstimateTokens(prompt), 2000)
+
+	inv, err = extractor.ExtractFromText(context.Background(), longInvoice(3))
+	require.NoError(t, err)
+	assert.False(t, inv.TextTruncated)
+}
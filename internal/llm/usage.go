@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// ModelPrice is what a model costs, in USD per million tokens
+type ModelPrice struct {
+	Prompt       float64
+	Completion   float64
+	CachedPrompt float64 // Prompt tokens read from the prompt cache (0 = same as Prompt)
+}
+
+// Cost returns the price of usage in USD
+func (p ModelPrice) Cost(u Usage) float64 {
+	cached := p.CachedPrompt
+	if cached == 0 {
+		cached = p.Prompt
+	}
+	uncached := u.PromptTokens - u.CachedPromptTokens
+	return (float64(uncached)*p.Prompt + float64(u.CachedPromptTokens)*cached + float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// UsageMeter sums the token usage of LLM calls made with a context from
+// ContextWithUsageMeter, per requested model. Cache hits are free and not
+// counted. It is safe for concurrent use.
+type UsageMeter struct {
+	mu      sync.Mutex
+	byModel map[string]Usage
+	parent  *UsageMeter
+}
+
+// NewUsageMeter returns an empty meter
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{byModel: make(map[string]Usage)}
+}
+
+type usageMeterKey struct{}
+
+// ContextWithUsageMeter counts LLM calls made with ctx in m. A meter already
+// attached to ctx keeps counting them too.
+func ContextWithUsageMeter(ctx context.Context, m *UsageMeter) context.Context {
+	if parent, ok := ctx.Value(usageMeterKey{}).(*UsageMeter); ok && parent != m {
+		m.mu.Lock()
+		m.parent = parent
+		m.mu.Unlock()
+	}
+	return context.WithValue(ctx, usageMeterKey{}, m)
+}
+
+// Total returns the usage summed over all models
+func (m *UsageMeter) Total() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total Usage
+	for _, u := range m.byModel {
+		total.PromptTokens += u.PromptTokens
+		total.CompletionTokens += u.CompletionTokens
+		total.CachedPromptTokens += u.CachedPromptTokens
+	}
+	return total
+}
+
+// ByModel returns the usage of each model
+func (m *UsageMeter) ByModel() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.byModel)
+}
+
+// Cost prices the usage with prices, keyed by model. Models without a price
+// are left out.
+func (m *UsageMeter) Cost(prices map[string]ModelPrice) float64 {
+	var cost float64
+	for model, u := range m.ByModel() {
+		if price, ok := prices[model]; ok {
+			cost += price.Cost(u)
+		}
+	}
+	return cost
+}
+
+func (m *UsageMeter) add(model string, u Usage) {
+	for ; m != nil; m = m.parent {
+		m.mu.Lock()
+		sum := m.byModel[model]
+		sum.PromptTokens += u.PromptTokens
+		sum.CompletionTokens += u.CompletionTokens
+		sum.CachedPromptTokens += u.CachedPromptTokens
+		m.byModel[model] = sum
+		m.mu.Unlock()
+	}
+}
+
+// meter adds the usage of a finished call to the meter attached to ctx
+func meter(ctx context.Context, req *Request, resp *Response) {
+	m, ok := ctx.Value(usageMeterKey{}).(*UsageMeter)
+	if !ok || resp == nil || resp.Cached {
+		return
+	}
+	m.add(req.Model, resp.Usage)
+}
@@ -0,0 +1,76 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// usageProvider reports 10 prompt and 5 completion tokens per call
+type usageProvider struct{}
+
+func (usageProvider) Name() string { return "usage" }
+
+func (usageProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	return &llm.Response{Content: "{}", Model: req.Model, Usage: llm.Usage{PromptTokens: 10, CompletionTokens: 5}}, nil
+}
+
+func TestModelPrice_Cost(t *testing.T) {
+	usage := llm.Usage{PromptTokens: 2_000_000, CompletionTokens: 1_000_000, CachedPromptTokens: 1_000_000}
+
+	assert.InDelta(t, 3+0.3+15, llm.ModelPrice{Prompt: 3, CachedPrompt: 0.3, Completion: 15}.Cost(usage), 1e-9)
+	assert.InDelta(t, 6+15, llm.ModelPrice{Prompt: 3, Completion: 15}.Cost(usage), 1e-9, "cached tokens default to the prompt price")
+}
+
+func TestUsageMeter(t *testing.T) {
+	cache := llm.NewMemoryCache(10)
+	client := llm.NewClient("", llm.WithProvider(usageProvider{}), llm.WithCache(cache, 0))
+
+	outer := llm.NewUsageMeter()
+	inner := llm.NewUsageMeter()
+	ctx := llm.ContextWithUsageMeter(llm.ContextWithUsageMeter(context.Background(), outer), inner)
+
+	req := &llm.Request{Model: "m", UserPrompt: "hi"}
+	_, err := client.Complete(ctx, req)
+	require.NoError(t, err)
+	_, err = client.Complete(ctx, req)
+	require.NoError(t, err)
+
+	want := llm.Usage{PromptTokens: 10, CompletionTokens: 5}
+	assert.Equal(t, want, inner.Total(), "cache hits are free")
+	assert.Equal(t, map[string]llm.Usage{"m": want}, inner.ByModel())
+	assert.Equal(t, want, outer.Total(), "enclosing meters count too")
+	assert.InDelta(t, 10e-6+10e-6, inner.Cost(map[string]llm.ModelPrice{"m": {Prompt: 1, Completion: 2}}), 1e-12)
+	assert.Zero(t, inner.Cost(nil))
+}
+
+func TestContextWithGate(t *testing.T) {
+	cache := llm.NewMemoryCache(10)
+	client := llm.NewClient("", llm.WithProvider(usageProvider{}), llm.WithCache(cache, 0))
+	cached := &llm.Request{Model: "m", UserPrompt: "seen"}
+	_, err := client.Complete(context.Background(), cached)
+	require.NoError(t, err)
+
+	refused := errors.New("over budget")
+	meter := llm.NewUsageMeter()
+	ctx := llm.ContextWithUsageMeter(context.Background(), meter)
+	ctx = llm.ContextWithGate(ctx, func(_ context.Context, req *llm.Request) error {
+		if req.Model == "expensive" {
+			return refused
+		}
+		return nil
+	})
+
+	_, err = client.Complete(ctx, &llm.Request{Model: "expensive", UserPrompt: "hi"})
+	assert.ErrorIs(t, err, refused)
+	_, err = client.Complete(ctx, &llm.Request{Model: "m", UserPrompt: "hi"})
+	assert.NoError(t, err)
+	_, err = client.Complete(llm.ContextWithGate(ctx, func(context.Context, *llm.Request) error { return refused }), cached)
+	assert.NoError(t, err, "cached answers are not gated")
+	assert.Equal(t, map[string]llm.Usage{"m": {PromptTokens: 10, CompletionTokens: 5}}, meter.ByModel())
+}
@@ -0,0 +1,32 @@
+package llm
+
+import (
+	"encoding/json"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// LLMVATRate is a VAT rate as the model writes it: a percentage such as "8"
+// or 10, or "KCT" or "KKKNT" for lines outside VAT
+type LLMVATRate string
+
+// UnmarshalJSON reads a string or a number
+func (r *LLMVATRate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*r = LLMVATRate(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*r = LLMVATRate(n)
+	return nil
+}
+
+// vatRate returns the rate of r, 0% when it can't be read
+func (r LLMVATRate) vatRate() model.VATRate {
+	rate, _ := model.ParseVATRate(string(r))
+	return rate
+}
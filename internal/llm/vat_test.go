@@ -0,0 +1,31 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestExtractor_VATRates(t *testing.T) {
+	provider := &recordingProvider{responses: []string{`{"invoice_number":"12","items":[
+		{"name":"Giấy A4","amount":100000,"vat_rate":8},
+		{"name":"Sách giáo khoa","amount":50000,"vat_rate":"KCT"},
+		{"name":"Phí dịch vụ","amount":20000,"vat_rate":"10%"},
+		{"name":"Ghi chú","vat_rate":"n/a"}
+	]}`}}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	inv, err := extractor.ExtractFromText(context.Background(), "HOA DON 12 ...")
+	require.NoError(t, err)
+	require.Len(t, inv.Items, 4)
+	assert.True(t, model.VATRate8.Equal(inv.Items[0].VATRate))
+	assert.True(t, model.VATRateKCT.Equal(inv.Items[1].VATRate))
+	assert.True(t, model.VATRate10.Equal(inv.Items[2].VATRate))
+	assert.True(t, inv.Items[3].VATRate.IsZero(), "unreadable rates are 0%")
+	assert.Equal(t, map[string]any{"type": "string"}, llm.JSONSchemaFor(llm.LLMLineItem{})["properties"].(map[string]any)["vat_rate"])
+}
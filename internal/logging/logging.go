@@ -0,0 +1,81 @@
+// Package logging carries a logger and a per-document correlation ID through
+// the pipeline stages, the PDF tools and the LLM client, so every record of
+// one document can be found from the ID on its result
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// Logger receives structured records: a message and alternating key/value
+// pairs. *slog.Logger satisfies it.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// CorrelationIDKey is the key the correlation ID is logged under
+const CorrelationIDKey = "correlation_id"
+
+type loggerKey struct{}
+type correlationIDKey struct{}
+
+// ContextWithLogger logs the work done with ctx to l
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger set with ContextWithLogger, or nil
+func LoggerFromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
+
+// ContextWithCorrelationID tags the records logged with ctx with id
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the ID set with ContextWithCorrelationID, or ""
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// EnsureCorrelationID returns ctx with a new random correlation ID unless it
+// already has one
+func EnsureCorrelationID(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return ContextWithCorrelationID(ctx, hex.EncodeToString(b[:]))
+}
+
+// Log writes a record to the logger of ctx, with its correlation ID. Without
+// a logger it does nothing.
+func Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	l := LoggerFromContext(ctx)
+	if l == nil {
+		return
+	}
+	if id := CorrelationID(ctx); id != "" {
+		args = append([]any{CorrelationIDKey, id}, args...)
+	}
+	l.Log(ctx, level, msg, args...)
+}
+
+// Debug logs at slog.LevelDebug
+func Debug(ctx context.Context, msg string, args ...any) { Log(ctx, slog.LevelDebug, msg, args...) }
+
+// Info logs at slog.LevelInfo
+func Info(ctx context.Context, msg string, args ...any) { Log(ctx, slog.LevelInfo, msg, args...) }
+
+// Warn logs at slog.LevelWarn
+func Warn(ctx context.Context, msg string, args ...any) { Log(ctx, slog.LevelWarn, msg, args...) }
@@ -0,0 +1,42 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/logging"
+)
+
+func TestLog_CorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ctx := logging.ContextWithLogger(context.Background(), logger)
+	ctx = logging.ContextWithCorrelationID(ctx, "req-42")
+	logging.Info(ctx, "document processed", "method", "xml")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "document processed", record["msg"])
+	assert.Equal(t, "req-42", record[logging.CorrelationIDKey])
+	assert.Equal(t, "xml", record["method"])
+}
+
+func TestLog_NoLogger(t *testing.T) {
+	assert.NotPanics(t, func() { logging.Warn(context.Background(), "dropped") })
+	assert.Nil(t, logging.LoggerFromContext(logging.ContextWithLogger(context.Background(), nil)))
+}
+
+func TestEnsureCorrelationID(t *testing.T) {
+	ctx := logging.EnsureCorrelationID(context.Background())
+	id := logging.CorrelationID(ctx)
+	assert.Len(t, id, 16)
+	assert.Equal(t, id, logging.CorrelationID(logging.EnsureCorrelationID(ctx)), "an existing ID is kept")
+	assert.NotEqual(t, id, logging.CorrelationID(logging.EnsureCorrelationID(context.Background())))
+}
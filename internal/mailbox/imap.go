@@ -0,0 +1,207 @@
+package mailbox
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLiteralSize bounds a message fetched from the server
+const maxLiteralSize = 100 << 20
+
+// imapConn is a minimal IMAP4rev1 client (RFC 3501): enough to log in,
+// search a mailbox, fetch messages and set flags
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// response is one untagged or tagged server line, with its literals
+type response struct {
+	text     string   // The line with each literal replaced by {n}
+	literals [][]byte // Literal payloads in order
+}
+
+func dialIMAP(addr string, tlsConfig *tls.Config, timeout time.Duration) (*imapConn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read IMAP greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP server refused connection: %s", greeting.text)
+	}
+	return c, nil
+}
+
+func (c *imapConn) Close() error {
+	return c.conn.Close()
+}
+
+// command sends a command and returns the untagged responses before the
+// tagged OK
+func (c *imapConn) command(format string, args ...any) ([]response, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	cmd := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, fmt.Errorf("failed to send IMAP command: %w", err)
+	}
+
+	verb, _, _ := strings.Cut(cmd, " ")
+	var untagged []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IMAP response: %w", err)
+		}
+		if status, ok := strings.CutPrefix(resp.text, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("IMAP %s failed: %s", verb, status)
+			}
+			return untagged, nil
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+// readResponse reads one response line, following {n} literals
+func (c *imapConn) readResponse() (response, error) {
+	var resp response
+	var text strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		text.WriteString(line)
+
+		n, ok := literalSize(line)
+		if !ok {
+			resp.text = text.String()
+			return resp, nil
+		}
+		if n > maxLiteralSize {
+			return resp, fmt.Errorf("IMAP literal of %d bytes is too large", n)
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+// literalSize parses a trailing {n} literal marker
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[open+1:len(line)-1], "+"))
+	return n, err == nil && n >= 0
+}
+
+// quote renders s as an IMAP quoted string
+func quote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", errors.New("IMAP string contains a line break")
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`, nil
+}
+
+func (c *imapConn) login(username, password string) error {
+	user, err := quote(username)
+	if err != nil {
+		return err
+	}
+	pass, err := quote(password)
+	if err != nil {
+		return err
+	}
+	_, err = c.command("LOGIN %s %s", user, pass)
+	return err
+}
+
+func (c *imapConn) selectMailbox(name string) error {
+	mailbox, err := quote(name)
+	if err != nil {
+		return err
+	}
+	_, err = c.command("SELECT %s", mailbox)
+	return err
+}
+
+// search returns the UIDs of messages matching criteria
+func (c *imapConn) search(criteria string) ([]uint32, error) {
+	responses, err := c.command("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, resp := range responses {
+		rest, ok := strings.CutPrefix(resp.text, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UID %q in IMAP SEARCH response", field)
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns the raw RFC 822 message with uid, without setting \Seen
+func (c *imapConn) fetch(uid uint32) ([]byte, error) {
+	responses, err := c.command("UID FETCH %d (BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		if strings.Contains(resp.text, " FETCH ") && len(resp.literals) > 0 {
+			return resp.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("IMAP server returned no body for message %d", uid)
+}
+
+// addFlags sets flags on the message with uid
+func (c *imapConn) addFlags(uid uint32, flags ...string) error {
+	_, err := c.command("UID STORE %d +FLAGS.SILENT (%s)", uid, strings.Join(flags, " "))
+	return err
+}
+
+func (c *imapConn) logout() error {
+	_, err := c.command("LOGOUT")
+	return err
+}
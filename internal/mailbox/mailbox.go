@@ -0,0 +1,234 @@
+// Package mailbox ingests invoices from an accounts-payable IMAP mailbox
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Defaults for Config
+const (
+	DefaultMailbox       = "INBOX"
+	DefaultProcessedFlag = "$InvoiceProcessed"
+	DefaultPollInterval  = time.Minute
+	DefaultMaxMessages   = 50
+)
+
+// Config configures a Connector
+type Config struct {
+	Addr     string // Server host:port; port 993 for implicit TLS
+	Username string
+	Password string
+	Mailbox  string // Folder to poll (default: DefaultMailbox)
+
+	// TLSConfig for the connection; nil uses the system roots. Insecure
+	// connects without TLS, for local bridges and tests.
+	TLSConfig *tls.Config
+	Insecure  bool
+
+	// ProcessedFlag is the keyword set on messages once processed; messages
+	// carrying it are not fetched again. Use `\Seen` on servers without
+	// keyword support (then unread mail is processed).
+	ProcessedFlag string
+
+	PollInterval time.Duration // Time between polls (default: DefaultPollInterval)
+	MaxMessages  int           // Messages processed per poll (default: DefaultMaxMessages)
+	Timeout      time.Duration // Per-message processing timeout (0 = none)
+}
+
+// Message describes a processed email
+type Message struct {
+	UID       uint32
+	MessageID string
+	From      string
+	Subject   string
+	Date      time.Time
+}
+
+// Handler receives the results of one message. When it returns an error
+// the message is not flagged and is processed again on the next poll.
+type Handler func(ctx context.Context, msg Message, results []*processor.Result) error
+
+// Connector polls an IMAP mailbox and runs each new message through the
+// pipeline: attachments (PDF, XML, ZIP, images) are processed one by one,
+// and the HTML body stands in when there are none. Messages are fetched
+// without marking them read and are flagged once the handler accepts them.
+type Connector struct {
+	pipeline *processor.Pipeline
+	cfg      Config
+	handle   Handler
+}
+
+// NewConnector returns a connector passing results to handle
+func NewConnector(pipeline *processor.Pipeline, cfg Config, handle Handler) (*Connector, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("IMAP server address is required")
+	}
+	if handle == nil {
+		return nil, errors.New("handler is required")
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = DefaultMailbox
+	}
+	if cfg.ProcessedFlag == "" {
+		cfg.ProcessedFlag = DefaultProcessedFlag
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = DefaultMaxMessages
+	}
+	if cfg.TLSConfig == nil && !cfg.Insecure {
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IMAP server address: %w", err)
+		}
+		cfg.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	return &Connector{pipeline: pipeline, cfg: cfg, handle: handle}, nil
+}
+
+// Run polls until ctx is canceled, then returns nil. A failed poll, such as
+// a dropped connection, is reported to onError and retried on the next
+// interval.
+func (c *Connector) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Poll(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll connects once, processes up to MaxMessages unflagged messages and
+// returns how many were handled. Once ctx is canceled the message in flight
+// is finished and the others are left for the next run, as is a message the
+// pipeline is stopped before finishing (see processor.Pipeline.Stop).
+func (c *Connector) Poll(ctx context.Context) (int, error) {
+	var tlsConfig *tls.Config
+	if !c.cfg.Insecure {
+		tlsConfig = c.cfg.TLSConfig
+	}
+	conn, err := dialIMAP(c.cfg.Addr, tlsConfig, 30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.login(c.cfg.Username, c.cfg.Password); err != nil {
+		return 0, err
+	}
+	if err := conn.selectMailbox(c.cfg.Mailbox); err != nil {
+		return 0, err
+	}
+
+	uids, err := conn.search(c.searchCriteria())
+	if err != nil {
+		return 0, err
+	}
+	if len(uids) > c.cfg.MaxMessages {
+		uids = uids[:c.cfg.MaxMessages]
+	}
+
+	handled := 0
+	work := context.WithoutCancel(ctx) // Finish the message in flight
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			break
+		}
+		raw, err := conn.fetch(uid)
+		if err != nil {
+			return handled, err
+		}
+		msg := parseMessage(uid, raw)
+		results := c.process(work, msg, raw)
+		if stopped(results) {
+			break // Interrupted: leave the message for the next run
+		}
+		if err := c.handle(work, msg, results); err != nil {
+			continue
+		}
+		if err := conn.addFlags(uid, c.cfg.ProcessedFlag); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+
+	if ctx.Err() == nil {
+		conn.logout()
+	}
+	return handled, nil
+}
+
+// stopped reports whether the pipeline was stopped before finishing results
+func stopped(results []*processor.Result) bool {
+	for _, r := range results {
+		if errors.Is(r.Error, processor.ErrStopped) {
+			return true
+		}
+	}
+	return false
+}
+
+// process runs one message through the pipeline
+func (c *Connector) process(ctx context.Context, msg Message, raw []byte) []*processor.Result {
+	id := msg.MessageID
+	if id == "" {
+		id = fmt.Sprintf("imap:%s/%d", c.cfg.Mailbox, msg.UID)
+	}
+	ctx = llm.ContextWithDocumentID(ctx, id)
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	return c.pipeline.Process(ctx, raw, processor.ProcessOptions{Filename: "message.eml"})
+}
+
+// searchCriteria selects messages not yet flagged as processed
+func (c *Connector) searchCriteria() string {
+	if strings.EqualFold(c.cfg.ProcessedFlag, `\Seen`) {
+		return "UNSEEN"
+	}
+	return "UNKEYWORD " + c.cfg.ProcessedFlag
+}
+
+// parseMessage reads the headers describing a message
+func parseMessage(uid uint32, raw []byte) Message {
+	msg := Message{UID: uid}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return msg
+	}
+	dec := new(mime.WordDecoder)
+	msg.MessageID = strings.Trim(parsed.Header.Get("Message-Id"), "<> ")
+	msg.From = parsed.Header.Get("From")
+	if subject, err := dec.DecodeHeader(parsed.Header.Get("Subject")); err == nil {
+		msg.Subject = subject
+	}
+	if date, err := parsed.Header.Date(); err == nil {
+		msg.Date = date
+	}
+	return msg
+}
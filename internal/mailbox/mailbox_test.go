@@ -0,0 +1,218 @@
+package mailbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/mailbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+// fakeIMAP is a scripted IMAP server holding messages by UID
+type fakeIMAP struct {
+	mu       sync.Mutex
+	messages map[uint32]string
+	flags    map[uint32][]string
+	logins   []string
+}
+
+func newFakeIMAP(t *testing.T, messages map[uint32]string) (*fakeIMAP, string) {
+	t.Helper()
+	srv := &fakeIMAP{messages: messages, flags: make(map[uint32][]string)}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func (s *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		s.mu.Lock()
+		switch fields := strings.Fields(cmd); {
+		case fields[0] == "LOGIN":
+			s.logins = append(s.logins, fields[1])
+		case fields[0] == "SELECT":
+			fmt.Fprintf(conn, "* %d EXISTS\r\n", len(s.messages))
+		case fields[0] == "UID" && fields[1] == "SEARCH":
+			keyword := fields[len(fields)-1]
+			var uids []string
+			for uid := uint32(1); uid <= uint32(len(s.messages)); uid++ {
+				if !contains(s.flags[uid], keyword) {
+					uids = append(uids, strconv.Itoa(int(uid)))
+				}
+			}
+			fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case fields[0] == "UID" && fields[1] == "FETCH":
+			uid, _ := strconv.Atoi(fields[2])
+			body := s.messages[uint32(uid)]
+			fmt.Fprintf(conn, "* %d FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, uid, len(body), body)
+		case fields[0] == "UID" && fields[1] == "STORE":
+			uid, _ := strconv.Atoi(fields[2])
+			s.flags[uint32(uid)] = append(s.flags[uint32(uid)], strings.Trim(fields[4], "()"))
+		case fields[0] == "LOGOUT":
+			fmt.Fprint(conn, "* BYE\r\n")
+		}
+		s.mu.Unlock()
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func emailWithXML(messageID string) string {
+	return strings.Join([]string{
+		"From: billing@example.com",
+		"Subject: =?UTF-8?Q?H=C3=B3a_=C4=91=C6=A1n?= 0000042",
+		"Message-ID: <" + messageID + ">",
+		"Date: Mon, 05 Oct 2026 10:00:00 +0700",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/plain",
+		"",
+		"Invoice attached.",
+		"--b1",
+		`Content-Type: application/xml; name="0000042.xml"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString([]byte(invoiceXML)),
+		"--b1--",
+		"",
+	}, "\r\n")
+}
+
+func TestConnector_Poll(t *testing.T) {
+	srv, addr := newFakeIMAP(t, map[uint32]string{
+		1: emailWithXML("a@example.com"),
+		2: emailWithXML("b@example.com"),
+	})
+
+	var handled []mailbox.Message
+	fail := true
+	handler := func(_ context.Context, msg mailbox.Message, results []*processor.Result) error {
+		if msg.UID == 2 && fail {
+			return errors.New("store unavailable")
+		}
+		require.Len(t, results, 1)
+		assert.NoError(t, results[0].Error)
+		assert.Equal(t, "0000042.xml", results[0].Source)
+		assert.Equal(t, "0000042", results[0].Invoice.Number)
+		handled = append(handled, msg)
+		return nil
+	}
+
+	c, err := mailbox.NewConnector(processor.NewPipeline(), mailbox.Config{Addr: addr, Username: "ap@example.com", Password: `p"w`, Insecure: true}, handler)
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, handled, 1)
+	assert.Equal(t, "a@example.com", handled[0].MessageID)
+	assert.Equal(t, "Hóa đơn 0000042", handled[0].Subject)
+	assert.Equal(t, []string{mailbox.DefaultProcessedFlag}, srv.flags[1])
+	assert.Empty(t, srv.flags[2], "messages the handler rejects are retried")
+
+	fail = false
+	n, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "processed messages are not fetched again")
+	assert.Equal(t, `"ap@example.com"`, srv.logins[0])
+}
+
+func TestConnector_StoppedPipeline(t *testing.T) {
+	srv, addr := newFakeIMAP(t, map[uint32]string{1: emailWithXML("a@example.com")})
+
+	p := processor.NewPipeline()
+	require.NoError(t, p.Stop(context.Background()))
+	handler := func(context.Context, mailbox.Message, []*processor.Result) error {
+		t.Fatal("stopped documents are not handled")
+		return nil
+	}
+	c, err := mailbox.NewConnector(p, mailbox.Config{Addr: addr, Insecure: true}, handler)
+	require.NoError(t, err)
+
+	n, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, srv.flags[1], "left for the next run")
+}
+
+func TestConnector_HTMLBody(t *testing.T) {
+	body := strings.Join([]string{
+		"From: receipts@ride.example",
+		"Subject: Your trip receipt",
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<html><body><table><tr><td>Total</td><td>85,000</td></tr></table></body></html>",
+	}, "\r\n")
+	_, addr := newFakeIMAP(t, map[uint32]string{1: body})
+
+	var results []*processor.Result
+	c, err := mailbox.NewConnector(processor.NewPipeline(), mailbox.Config{Addr: addr, Insecure: true}, func(_ context.Context, _ mailbox.Message, r []*processor.Result) error {
+		results = r
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "body.html", results[0].Source)
+	assert.NotErrorIs(t, results[0].Error, processor.ErrSkipped, "HTML bodies are read as invoices")
+}
+
+func TestNewConnector_Validation(t *testing.T) {
+	handler := func(context.Context, mailbox.Message, []*processor.Result) error { return nil }
+
+	_, err := mailbox.NewConnector(processor.NewPipeline(), mailbox.Config{}, handler)
+	require.Error(t, err)
+	_, err = mailbox.NewConnector(processor.NewPipeline(), mailbox.Config{Addr: "imap.example.com:993"}, nil)
+	require.Error(t, err)
+	_, err = mailbox.NewConnector(processor.NewPipeline(), mailbox.Config{Addr: "imap.example.com"}, handler)
+	require.Error(t, err, "port is required")
+}
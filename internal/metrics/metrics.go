@@ -0,0 +1,281 @@
+// Package metrics is a small registry of counters and histograms exposed in
+// the Prometheus text format, so operators can scrape and alert on the
+// pipeline without the service pulling in a metrics client
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDurationBuckets are histogram bounds in seconds, from a fast XML
+// parse to a slow multi-page vision request
+var DefaultDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Registry holds metrics and writes them in the Prometheus text format. It
+// is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]metric
+}
+
+type metric interface {
+	name() string
+	labelNames() []string
+	write(w io.Writer) error
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]metric)}
+}
+
+// register adds m, or returns the metric already registered under its name
+// so several pipelines can share one registry. A metric of another type or
+// with other labels under the same name panics.
+func register[M metric](r *Registry, m M, labels []string) M {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.names[m.name()]; ok {
+		same, ok := existing.(M)
+		if !ok || !slices.Equal(same.labelNames(), labels) {
+			panic(fmt.Sprintf("metrics: %s registered twice with different types or labels", m.name()))
+		}
+		return same
+	}
+	r.names[m.name()] = m
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// vec holds the series of a metric, one per combination of label values
+type vec[T any] struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](name, help string, labels []string) vec[T] {
+	return vec[T]{metricName: name, help: help, labels: labels, series: make(map[string]*T), values: make(map[string][]string)}
+}
+
+func (v *vec[T]) name() string         { return v.metricName }
+func (v *vec[T]) labelNames() []string { return v.labels }
+
+// with returns the series of values, creating it with init
+func (v *vec[T]) with(values []string, init func() *T) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = init()
+		v.series[key] = s
+		v.values[key] = slices.Clone(values)
+	}
+	return s
+}
+
+// sorted returns the series keys in label order, for stable output
+func (v *vec[T]) sorted() []string {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec[T]) header(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, escapeHelp(v.help), v.metricName, typ)
+	return err
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vec[float64]
+}
+
+// NewCounter registers a counter with the given label names, or returns the
+// one registered before under name
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return register(r, &CounterVec{newVec[float64](name, help, labels)}, labels)
+}
+
+// Add adds delta, which must not be negative, to the series of values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s decreased", c.metricName))
+	}
+	s := c.with(values, func() *float64 { return new(float64) })
+	c.mu.Lock()
+	*s += delta
+	c.mu.Unlock()
+}
+
+// Inc adds one to the series of values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the count of the series of values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[strings.Join(values, "\xff")]; ok {
+		return *s
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.header(w, "counter"); err != nil {
+		return err
+	}
+	for _, k := range c.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.metricName, labelPairs(c.labels, c.values[k]), formatFloat(*c.series[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds
+// (DefaultDurationBuckets when nil) and label names, or returns the one
+// registered before under name
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	return register(r, &HistogramVec{vec: newVec[histogram](name, help, labels), buckets: buckets}, labels)
+}
+
+// Observe records value in the series of values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	s := h.with(values, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} })
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns the number of observations in the series of values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[strings.Join(values, "\xff")]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.header(w, "histogram"); err != nil {
+		return err
+	}
+	labels := append(slices.Clone(h.labels), "le")
+	for _, k := range h.sorted() {
+		s, values := h.series[k], h.values[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelPairs(labels, append(slices.Clone(values), formatFloat(bound))), cumulative); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, labelPairs(labels, append(slices.Clone(values), "+Inf")), s.count,
+			h.metricName, labelPairs(h.labels, values), formatFloat(s.sum),
+			h.metricName, labelPairs(h.labels, values), s.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelPairs renders {name="value",...}, or nothing without labels
+func labelPairs(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
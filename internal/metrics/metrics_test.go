@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/metrics"
+)
+
+func TestRegistry_Exposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	docs := reg.NewCounter("docs_total", "Documents processed", "method")
+	docs.Inc("xml")
+	docs.Add(2, "llm_text")
+	docs.Inc(`say "hi"`)
+
+	durations := reg.NewHistogram("stage_seconds", "Stage duration", []float64{1, 0.1}, "stage")
+	durations.Observe(0.05, "parse")
+	durations.Observe(0.5, "parse")
+	durations.Observe(5, "parse")
+
+	var b strings.Builder
+	require.NoError(t, reg.Write(&b))
+	assert.Equal(t, `# HELP docs_total Documents processed
+# TYPE docs_total counter
+docs_total{method="llm_text"} 2
+docs_total{method="say \"hi\""} 1
+docs_total{method="xml"} 1
+# HELP stage_seconds Stage duration
+# TYPE stage_seconds histogram
+stage_seconds_bucket{stage="parse",le="0.1"} 1
+stage_seconds_bucket{stage="parse",le="1"} 2
+stage_seconds_bucket{stage="parse",le="+Inf"} 3
+stage_seconds_sum{stage="parse"} 5.55
+stage_seconds_count{stage="parse"} 3
+`, b.String())
+
+	assert.Equal(t, 2.0, docs.Value("llm_text"))
+	assert.Equal(t, uint64(3), durations.Count("parse"))
+}
+
+func TestRegistry_SharedMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	a := reg.NewCounter("docs_total", "Documents processed", "method")
+	b := reg.NewCounter("docs_total", "Documents processed", "method")
+	assert.Same(t, a, b)
+
+	assert.Panics(t, func() { reg.NewCounter("docs_total", "Documents processed", "status") })
+	assert.Panics(t, func() { reg.NewHistogram("docs_total", "Documents processed", nil, "method") })
+	assert.Panics(t, func() { a.Inc() }, "missing label value")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.NewCounter("up", "Always one").Inc()
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), "\nup 1\n")
+}
@@ -0,0 +1,12 @@
+package model
+
+// Address is a Vietnamese address split into administrative units. Ward and
+// district keep their unit type ("Phường 5", "Quận 1", "Huyện Củ Chi");
+// province is the bare standardized name ("Hồ Chí Minh"). District is empty
+// for addresses written after the 2025 reform removed the district level.
+type Address struct {
+	Street   string `json:"street,omitempty"`   // House number, street, building or hamlet
+	Ward     string `json:"ward,omitempty"`     // Phường, xã or thị trấn
+	District string `json:"district,omitempty"` // Quận, huyện, thị xã or provincial city
+	Province string `json:"province,omitempty"` // Province or centrally governed city
+}
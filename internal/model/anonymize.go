@@ -0,0 +1,281 @@
+package model
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Anonymizer replaces the parties of invoices with made-up ones, so real
+// invoices can serve as test fixtures or be shared. Pseudonyms keep the
+// format of the values they replace and are derived from them, so a party
+// keeps its pseudonym throughout an invoice and across invoices
+// anonymized with the same key.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer returns an anonymizer keyed with key. Without a secret key
+// anyone can tell the pseudonym of a known tax ID, of which there are few
+// enough to try them all.
+func NewAnonymizer(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+// Anonymize returns a copy of inv with party names, tax IDs, addresses,
+// phones, emails and bank accounts pseudonymized, with NewAnonymizer(nil)
+func Anonymize(inv *Invoice) *Invoice {
+	return NewAnonymizer(nil).Anonymize(inv)
+}
+
+// Anonymize returns a copy of inv with the parties, the people named on it
+// (cashier, signer, delivery) and the delivery address pseudonymized, the
+// values replaced in its remarks and corrections too. Tax IDs keep their
+// province code, branch suffix and a valid check digit; addresses keep
+// their ward, district and province. The raw XML, signature value and
+// certificate serial are dropped. Line items and amounts are kept.
+func (a *Anonymizer) Anonymize(inv *Invoice) *Invoice {
+	out := *inv
+	s := &pseudonyms{a: a, replaced: make(map[string]string)}
+
+	out.Seller = s.party(inv.Seller)
+	out.Buyer = s.party(inv.Buyer)
+	out.Cashier = s.name(inv.Cashier)
+	if inv.Signature != nil {
+		out.Signature = &Signature{
+			Date:           inv.Signature.Date,
+			SignerName:     s.name(inv.Signature.SignerName),
+			SignerPosition: inv.Signature.SignerPosition,
+		}
+	}
+	if inv.Delivery != nil {
+		delivery := *inv.Delivery
+		delivery.DeliveredBy = s.name(delivery.DeliveredBy)
+		delivery.ReceivedBy = s.name(delivery.ReceivedBy)
+		delivery.Vehicle = s.digits("vehicle", delivery.Vehicle, 2)
+		out.Delivery = &delivery
+	}
+	if inv.Order != nil {
+		order := *inv.Order
+		order.DeliveryAddress, _ = s.address(order.DeliveryAddress, nil)
+		out.Order = &order
+	}
+	out.RawXML = nil
+	if inv.SourceFile != "" {
+		out.SourceFile = fmt.Sprintf("invoice-%x%s", a.sum("file", inv.SourceFile)[:4], filepath.Ext(inv.SourceFile))
+	}
+
+	out.Remarks = s.replace(inv.Remarks)
+	out.PaymentTerms = s.replace(inv.PaymentTerms)
+	out.AdjustmentReason = s.replace(inv.AdjustmentReason)
+	if inv.Corrections != nil {
+		out.Corrections = make([]string, len(inv.Corrections))
+		for i, c := range inv.Corrections {
+			out.Corrections[i] = s.replace(c)
+		}
+	}
+	return &out
+}
+
+// sum keys the pseudonyms of a kind of value
+func (a *Anonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// rand returns the source of the pseudonym of value
+func (a *Anonymizer) rand(kind, value string) *rand.Rand {
+	return rand.New(rand.NewChaCha8([32]byte(a.sum(kind, value))))
+}
+
+// pseudonyms pseudonymizes the values of one invoice, remembering them to
+// replace in its free text
+type pseudonyms struct {
+	a        *Anonymizer
+	replaced map[string]string // Original -> pseudonym
+}
+
+func (s *pseudonyms) party(p Party) Party {
+	p.Name = s.name(p.Name)
+	p.TaxID = s.taxID(p.TaxID)
+	p.Address, p.AddressParts = s.address(p.Address, p.AddressParts)
+	p.Phone = s.digits("phone", p.Phone, 3)
+	p.Email = s.email(p.Email)
+	p.BankAccount = s.digits("bank_account", p.BankAccount, 0)
+	return p
+}
+
+// remember records a pseudonym to replace its original in free text;
+// originals too short to be told from other words are not replaced
+func (s *pseudonyms) remember(original, pseudonym string) string {
+	if utf8.RuneCountInString(original) >= 4 {
+		s.replaced[original] = pseudonym
+	}
+	return pseudonym
+}
+
+// replace replaces the values pseudonymized so far in text, longest first
+func (s *pseudonyms) replace(text string) string {
+	if text == "" {
+		return text
+	}
+	originals := make([]string, 0, len(s.replaced))
+	for original := range s.replaced {
+		originals = append(originals, original)
+	}
+	slices.SortFunc(originals, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+	for _, original := range originals {
+		text = strings.ReplaceAll(text, original, s.replaced[original])
+	}
+	return text
+}
+
+// legalForms start the names of companies and businesses, kept in their
+// pseudonyms
+var legalForms = []string{
+	"công ty trách nhiệm hữu hạn một thành viên", "công ty trách nhiệm hữu hạn",
+	"công ty tnhh mtv", "công ty tnhh", "công ty cổ phần", "công ty cp",
+	"chi nhánh công ty", "chi nhánh", "công ty", "doanh nghiệp tư nhân",
+	"hợp tác xã", "hộ kinh doanh", "cửa hàng", "siêu thị", "nhà hàng", "khách sạn",
+}
+
+// Words of made-up names
+var (
+	brandWords  = []string{"An", "Bảo", "Bình", "Đại", "Đông", "Gia", "Hòa", "Hồng", "Hưng", "Khang", "Kim", "Long", "Minh", "Nam", "Ngọc", "Phát", "Phú", "Phúc", "Quang", "Sao", "Tân", "Thành", "Thịnh", "Tiến", "Trường", "Việt", "Vĩnh", "Xuân"}
+	surnames    = []string{"Nguyễn", "Trần", "Lê", "Phạm", "Hoàng", "Huỳnh", "Phan", "Vũ", "Võ", "Đặng", "Bùi", "Đỗ", "Hồ", "Ngô", "Dương", "Lý"}
+	middleNames = []string{"Văn", "Thị", "Minh", "Thanh", "Ngọc", "Hữu", "Đức", "Quang", "Thu", "Hoàng", "Gia", "Bảo"}
+	givenNames  = []string{"An", "Bình", "Chi", "Dũng", "Giang", "Hà", "Hải", "Hạnh", "Hiếu", "Hùng", "Khoa", "Lan", "Linh", "Long", "Mai", "Nam", "Phúc", "Quân", "Sơn", "Tâm", "Thảo", "Trang", "Tuấn", "Vy"}
+	streets     = []string{"Lê Lợi", "Nguyễn Huệ", "Trần Hưng Đạo", "Hai Bà Trưng", "Lý Thường Kiệt", "Phan Chu Trinh", "Quang Trung", "Hùng Vương", "Nguyễn Trãi", "Lê Duẩn", "Điện Biên Phủ", "Cách Mạng Tháng Tám"}
+)
+
+// name pseudonymizes a company or a person: names starting with a legal
+// form keep it, followed by a made-up brand; others are people
+func (s *pseudonyms) name(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+	k := strings.ToLower(strings.Join(strings.Fields(name), " "))
+	r := s.a.rand("name", k)
+
+	pseudonym := ""
+	for _, form := range legalForms {
+		if strings.HasPrefix(k, form+" ") {
+			prefix := strings.Join(strings.Fields(name)[:len(strings.Fields(form))], " ")
+			pseudonym = prefix + " " + pick(r, brandWords) + " " + pick(r, brandWords)
+			break
+		}
+	}
+	if pseudonym == "" {
+		pseudonym = pick(r, surnames) + " " + pick(r, middleNames) + " " + pick(r, givenNames)
+	}
+	if name == strings.ToUpper(name) {
+		pseudonym = strings.ToUpper(pseudonym)
+	}
+	return s.remember(name, pseudonym)
+}
+
+// taxID pseudonymizes a tax ID, keeping its first two digits, the province
+// code, and its branch suffix, with a valid check digit. The branches of a
+// company share the pseudonym of its head office.
+func (s *pseudonyms) taxID(id string) string {
+	m := taxIDFormat.FindStringSubmatch(id)
+	if m == nil {
+		return s.digits("tax_id", id, 0)
+	}
+	r := s.a.rand("tax_id", m[1])
+	for {
+		digits := []byte(m[1][:2])
+		for len(digits) < 9 {
+			digits = append(digits, byte('0'+r.IntN(10)))
+		}
+		sum := 0
+		for i, weight := range taxIDWeights {
+			sum += int(digits[i]-'0') * weight
+		}
+		if check := 10 - sum%11; check < 10 {
+			return s.remember(id, string(append(digits, byte('0'+check)))+id[10:])
+		}
+	}
+}
+
+// address pseudonymizes the street of an address, its first part: the
+// ward, district and province that follow are kept, as are those of parts
+func (s *pseudonyms) address(address string, parts *Address) (string, *Address) {
+	if address == "" && parts == nil {
+		return "", nil
+	}
+	k := strings.ToLower(strings.Join(strings.Fields(address), " "))
+	if address == "" {
+		k = strings.ToLower(parts.Street + "|" + parts.Ward + "|" + parts.District + "|" + parts.Province)
+	}
+	r := s.a.rand("address", k)
+	street := fmt.Sprintf("%d %s", 1+r.IntN(299), pick(r, streets))
+
+	if parts != nil {
+		p := *parts
+		if p.Street != "" {
+			p.Street = s.remember(p.Street, street)
+		}
+		parts = &p
+	}
+	if address == "" {
+		return "", parts
+	}
+	pseudonym := street
+	if _, rest, ok := strings.Cut(address, ","); ok {
+		pseudonym += "," + rest
+	}
+	return s.remember(address, pseudonym), parts
+}
+
+// digits pseudonymizes a number, such as a phone or an account, replacing
+// its digits but the first keep and leaving other characters as they are
+func (s *pseudonyms) digits(kind, value string, keep int) string {
+	if value == "" {
+		return ""
+	}
+	k := strings.Map(func(c rune) rune {
+		if c < '0' || c > '9' {
+			return -1
+		}
+		return c
+	}, value)
+	r := s.a.rand(kind, k)
+	seen := 0
+	pseudonym := strings.Map(func(c rune) rune {
+		if c < '0' || c > '9' {
+			return c
+		}
+		seen++
+		if seen <= keep {
+			return c
+		}
+		return rune('0' + r.IntN(10))
+	}, value)
+	return s.remember(value, pseudonym)
+}
+
+// email pseudonymizes an email address at example.com
+func (s *pseudonyms) email(email string) string {
+	if email == "" {
+		return ""
+	}
+	sum := s.a.sum("email", strings.ToLower(strings.TrimSpace(email)))
+	return s.remember(email, fmt.Sprintf("user-%x@example.com", sum[:4]))
+}
+
+func pick(r *rand.Rand, words []string) string {
+	return words[r.IntN(len(words))]
+}
@@ -0,0 +1,84 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestAnonymize(t *testing.T) {
+	inv := tt78Invoice()
+	inv.Seller = model.Party{
+		Name:         "CÔNG TY TNHH ABC",
+		TaxID:        "0123456787-001",
+		Address:      "123 Lê Lợi, P. Bến Nghé, Q.1, TP.HCM",
+		AddressParts: &model.Address{Street: "123 Lê Lợi", Ward: "Phường Bến Nghé", District: "Quận 1", Province: "Hồ Chí Minh"},
+		Phone:        "028 3823 4567",
+		Email:        "ketoan@abc.vn",
+		BankAccount:  "0071-0012-34567",
+		BankName:     "Vietcombank",
+	}
+	inv.Buyer = model.Party{Name: "Trần Văn Bình", TaxID: "0312345673"}
+	inv.Remarks = "Giao cho Trần Văn Bình, MST 0312345673"
+	inv.Signature = &model.Signature{Value: "MIIB...", SignerName: "CÔNG TY TNHH ABC", CertSerial: "5401"}
+	inv.RawXML = []byte("<HDon/>")
+	inv.SourceFile = "/data/abc/hd-42.xml"
+
+	anon := model.Anonymize(inv)
+	seller := anon.Seller
+
+	assert.True(t, strings.HasPrefix(seller.Name, "CÔNG TY TNHH "), seller.Name)
+	assert.NotEqual(t, inv.Seller.Name, seller.Name)
+	assert.Equal(t, strings.ToUpper(seller.Name), seller.Name)
+	assert.Equal(t, seller.Name, anon.Signature.SignerName, "the same name gets the same pseudonym")
+
+	assert.Regexp(t, `^01\d{8}-001$`, seller.TaxID)
+	assert.NotEqual(t, inv.Seller.TaxID, seller.TaxID)
+	assert.NoError(t, model.ValidateTaxID(seller.TaxID))
+	assert.NoError(t, model.ValidateTaxID(anon.Buyer.TaxID))
+
+	assert.True(t, strings.HasSuffix(seller.Address, ", P. Bến Nghé, Q.1, TP.HCM"), seller.Address)
+	assert.NotEqual(t, inv.Seller.Address, seller.Address)
+	require.NotNil(t, seller.AddressParts)
+	assert.Equal(t, strings.Split(seller.Address, ",")[0], seller.AddressParts.Street)
+	assert.Equal(t, "Quận 1", seller.AddressParts.District)
+	assert.Equal(t, "123 Lê Lợi", inv.Seller.AddressParts.Street, "the original is left as is")
+
+	assert.Regexp(t, `^028 \d{4} \d{4}$`, seller.Phone)
+	assert.Regexp(t, `^user-[0-9a-f]{8}@example\.com$`, seller.Email)
+	assert.Regexp(t, `^\d{4}-\d{4}-\d{5}$`, seller.BankAccount)
+	assert.NotEqual(t, inv.Seller.BankAccount, seller.BankAccount)
+	assert.Equal(t, "Vietcombank", seller.BankName)
+
+	assert.NotEqual(t, inv.Buyer.Name, anon.Buyer.Name)
+	assert.Equal(t, "Giao cho "+anon.Buyer.Name+", MST "+anon.Buyer.TaxID, anon.Remarks)
+
+	assert.Empty(t, anon.Signature.Value)
+	assert.Empty(t, anon.Signature.CertSerial)
+	assert.Nil(t, anon.RawXML)
+	assert.Regexp(t, `^invoice-[0-9a-f]{8}\.xml$`, anon.SourceFile)
+	assert.Equal(t, inv.Items, anon.Items)
+	assert.True(t, inv.TotalAmount.Equal(anon.TotalAmount))
+}
+
+func TestAnonymizer_Consistent(t *testing.T) {
+	a := tt78Invoice()
+	b := tt78Invoice()
+	b.Number = "43"
+	b.Seller.TaxID = "0123456787-002"
+	b.Buyer = model.Party{Name: "công ty tnhh abc", TaxID: "0123456787"}
+
+	anonA, anonB := model.Anonymize(a), model.Anonymize(b)
+	assert.Equal(t, anonA.Seller.Name, anonB.Seller.Name)
+	assert.Equal(t, anonA.Seller.TaxID, anonB.Buyer.TaxID, "across invoices and roles")
+	assert.Equal(t, anonA.Seller.TaxID+"-002", anonB.Seller.TaxID, "branches share the pseudonym of the head office")
+	assert.True(t, strings.EqualFold(anonA.Seller.Name, anonB.Buyer.Name), "names match ignoring case")
+
+	keyed := model.NewAnonymizer([]byte("secret")).Anonymize(a)
+	assert.NotEqual(t, anonA.Seller.TaxID, keyed.Seller.TaxID)
+	assert.Equal(t, keyed, model.NewAnonymizer([]byte("secret")).Anonymize(a))
+}
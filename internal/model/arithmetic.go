@@ -0,0 +1,50 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ArithmeticError is an amount that does not match the amounts it is computed from
+type ArithmeticError struct {
+	Field    string          // JSON path of the inconsistent amount, e.g. "items[2].amount"
+	Actual   decimal.Decimal // Amount on the invoice
+	Expected decimal.Decimal // Amount computed from the others
+	Rule     string          // How Expected is computed, e.g. "quantity × unit_price"
+}
+
+func (e ArithmeticError) Error() string {
+	return fmt.Sprintf("%s is %s but %s is %s", e.Field, e.Actual, e.Rule, e.Expected)
+}
+
+// CheckArithmetic verifies that each line amount is quantity × unit price, that
+// the line amounts (net of discounts) add up to the subtotal, and that subtotal
+// plus VAT gives the total. Differences up to tolerance are accepted. Amounts
+// that are zero are treated as not printed and their checks skipped.
+func (inv *Invoice) CheckArithmetic(tolerance decimal.Decimal) []ArithmeticError {
+	var errs []ArithmeticError
+	check := func(field string, actual, expected decimal.Decimal, rule string) {
+		if actual.Sub(expected).Abs().GreaterThan(tolerance) {
+			errs = append(errs, ArithmeticError{Field: field, Actual: actual, Expected: expected, Rule: rule})
+		}
+	}
+
+	sum := decimal.Zero
+	for i, item := range inv.Items {
+		if !item.Quantity.IsZero() && !item.UnitPrice.IsZero() && !item.Amount.IsZero() {
+			check(fmt.Sprintf("items[%d].amount", i), item.Amount, item.Quantity.Mul(item.UnitPrice).Round(2), "quantity × unit_price")
+		}
+		sum = sum.Add(item.Amount.Sub(item.DiscountAmt))
+	}
+
+	if len(inv.Items) > 0 && !inv.SubtotalAmount.IsZero() && !sum.IsZero() {
+		check("subtotal_amount", inv.SubtotalAmount, sum, "the sum of item amounts")
+	}
+
+	if !inv.SubtotalAmount.IsZero() && !inv.TaxAmount.IsZero() && !inv.TotalAmount.IsZero() {
+		check("total_amount", inv.TotalAmount, inv.SubtotalAmount.Add(inv.TaxAmount), "subtotal_amount + tax_amount")
+	}
+
+	return errs
+}
@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestInvoice_CheckArithmetic(t *testing.T) {
+	inv := model.Invoice{
+		Items: []model.LineItem{
+			{Quantity: decimal.NewFromInt(2), UnitPrice: decimal.NewFromInt(100000), Amount: decimal.NewFromInt(200000)},
+			{Quantity: decimal.NewFromInt(3), UnitPrice: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(1500000)},
+			{Amount: decimal.NewFromInt(50000)}, // no quantity or price printed
+		},
+		SubtotalAmount: decimal.NewFromInt(400000),
+		TaxAmount:      decimal.NewFromInt(40000),
+		TotalAmount:    decimal.NewFromInt(440000),
+	}
+
+	errs := inv.CheckArithmetic(decimal.NewFromInt(1))
+	require.Len(t, errs, 2)
+	assert.Equal(t, "items[1].amount", errs[0].Field)
+	assert.True(t, decimal.NewFromInt(150000).Equal(errs[0].Expected))
+	assert.Equal(t, "subtotal_amount", errs[1].Field)
+	assert.True(t, decimal.NewFromInt(1750000).Equal(errs[1].Expected))
+	assert.Equal(t, "items[1].amount is 1500000 but quantity × unit_price is 150000", errs[0].Error())
+
+	inv.Items[1].Amount = decimal.NewFromInt(150000)
+	assert.Empty(t, inv.CheckArithmetic(decimal.NewFromInt(1)))
+}
+
+func TestInvoice_CheckArithmetic_Tolerance(t *testing.T) {
+	inv := model.Invoice{
+		Items: []model.LineItem{
+			{Quantity: decimal.RequireFromString("1.5"), UnitPrice: decimal.NewFromInt(33333), Amount: decimal.NewFromInt(50000)},
+		},
+		SubtotalAmount: decimal.NewFromInt(50000),
+		TaxAmount:      decimal.NewFromInt(4000),
+		TotalAmount:    decimal.NewFromInt(54001),
+	}
+
+	assert.Empty(t, inv.CheckArithmetic(decimal.NewFromInt(1)), "rounding to whole đồng is accepted")
+
+	errs := inv.CheckArithmetic(decimal.Zero)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "items[0].amount", errs[0].Field)
+	assert.Equal(t, "total_amount", errs[1].Field)
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns a deep copy of inv: its line items, tax breakdown, lists and
+// referenced values are copied too, so changing the copy leaves inv as it
+// was. Clone of nil is nil.
+func (inv *Invoice) Clone() *Invoice {
+	if inv == nil {
+		return nil
+	}
+	out := *inv
+	out.Seller = inv.Seller.clone()
+	out.Buyer = inv.Buyer.clone()
+	out.Items = slices.Clone(inv.Items)
+	out.TaxBreakdown = slices.Clone(inv.TaxBreakdown)
+	out.VNDAmounts = clonePointer(inv.VNDAmounts)
+	out.OriginalInvoice = clonePointer(inv.OriginalInvoice)
+	out.Delivery = clonePointer(inv.Delivery)
+	out.Order = clonePointer(inv.Order)
+	out.LowConfidenceFields = slices.Clone(inv.LowConfidenceFields)
+	out.FieldLocations = maps.Clone(inv.FieldLocations)
+	out.HandwrittenFields = slices.Clone(inv.HandwrittenFields)
+	out.Corrections = slices.Clone(inv.Corrections)
+	out.Signature = clonePointer(inv.Signature)
+	out.RawXML = slices.Clone(inv.RawXML)
+	return &out
+}
+
+func (p Party) clone() Party {
+	p.AddressParts = clonePointer(p.AddressParts)
+	return p
+}
+
+// clonePointer returns a pointer to a copy of *p, or nil
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
@@ -0,0 +1,32 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestInvoice_Clone(t *testing.T) {
+	inv := tt78Invoice()
+	inv.Seller.AddressParts = &model.Address{Province: "Hà Nội"}
+	inv.OriginalInvoice = &model.InvoiceReference{Number: "41"}
+	inv.Corrections = []string{"a"}
+	inv.FieldLocations = map[string]model.BoundingBox{"number": {Page: 1}}
+
+	c := inv.Clone()
+	assert.Equal(t, inv, c)
+	c.Items[0].Name = "edited"
+	c.Seller.AddressParts.Province = "edited"
+	c.OriginalInvoice.Number = "edited"
+	c.Corrections[0] = "edited"
+	c.FieldLocations["number"] = model.BoundingBox{Page: 2}
+	assert.NotEqual(t, "edited", inv.Items[0].Name)
+	assert.Equal(t, "Hà Nội", inv.Seller.AddressParts.Province)
+	assert.Equal(t, "41", inv.OriginalInvoice.Number)
+	assert.Equal(t, []string{"a"}, inv.Corrections)
+	assert.Equal(t, 1, inv.FieldLocations["number"].Page)
+
+	assert.Nil(t, (*model.Invoice)(nil).Clone())
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// IsCreditNote reports whether the invoice reduces an earlier one. Credit
+// notes (hóa đơn điều chỉnh giảm) record their reductions as positive
+// amounts, as they are printed, their document type marking them as
+// reductions: a credit note of 100,000 reduces the invoice it adjusts by
+// 100,000. Lines of a credit note that increase an amount are negative.
+// Signed gives the amounts as they count toward totals across invoices.
+func (inv *Invoice) IsCreditNote() bool {
+	return inv.DocumentType == DocumentTypeCreditNote
+}
+
+// Signed returns an amount of inv as it counts toward totals across
+// invoices: negated on credit notes
+func (inv *Invoice) Signed(amount decimal.Decimal) decimal.Decimal {
+	if inv.IsCreditNote() {
+		return amount.Neg()
+	}
+	return amount
+}
+
+// NormalizeCreditNote makes a tax invoice with a negative total, as XML
+// writes adjustment-decrease invoices, a credit note of positive amounts:
+// its document type becomes credit note, its type adjustment, and its
+// amounts are negated, along with the quantity or, when it is the negative
+// one, the unit price of each line. It reports whether inv was changed.
+func (inv *Invoice) NormalizeCreditNote() bool {
+	negative := inv.TotalAmount.IsNegative() || inv.TotalAmount.IsZero() && inv.SubtotalAmount.IsNegative()
+	if !negative || !inv.IsTaxInvoice() {
+		return false
+	}
+
+	inv.DocumentType = DocumentTypeCreditNote
+	inv.Type = InvoiceTypeAdjustment
+	for i := range inv.Items {
+		item := &inv.Items[i]
+		if item.UnitPrice.IsNegative() {
+			item.UnitPrice = item.UnitPrice.Neg()
+		} else {
+			item.Quantity = item.Quantity.Neg()
+		}
+		item.Amount = item.Amount.Neg()
+		item.DiscountAmt = item.DiscountAmt.Neg()
+		item.VATAmount = item.VATAmount.Neg()
+		item.Total = item.Total.Neg()
+	}
+	inv.SubtotalAmount = inv.SubtotalAmount.Neg()
+	inv.TaxAmount = inv.TaxAmount.Neg()
+	inv.TotalAmount = inv.TotalAmount.Neg()
+	for i := range inv.TaxBreakdown {
+		inv.TaxBreakdown[i].TaxableAmount = inv.TaxBreakdown[i].TaxableAmount.Neg()
+		inv.TaxBreakdown[i].TaxAmount = inv.TaxBreakdown[i].TaxAmount.Neg()
+	}
+	if v := inv.VNDAmounts; v != nil {
+		v.SubtotalAmount, v.TaxAmount, v.TotalAmount = v.SubtotalAmount.Neg(), v.TaxAmount.Neg(), v.TotalAmount.Neg()
+	}
+	return true
+}
+
+// Adjusts reports whether inv, a credit note, adjustment or replacement,
+// refers to original: the same seller, and the number, series and date of
+// its OriginalInvoice, compared as Fingerprint compares them. A series or
+// date the reference leaves out matches any.
+func (inv *Invoice) Adjusts(original *Invoice) bool {
+	ref := inv.OriginalInvoice
+	if ref == nil || original == nil {
+		return false
+	}
+	number := strings.TrimLeft(fingerprintField(ref.Number), "0")
+	if number == "" || number != strings.TrimLeft(fingerprintField(original.Number), "0") {
+		return false
+	}
+	if ref.Series != "" && fingerprintField(ref.Series) != fingerprintField(original.Series) {
+		return false
+	}
+	if !ref.Date.IsZero() && !sameDay(ref.Date, original.Date) {
+		return false
+	}
+	return taxIDDigits(inv.Seller.TaxID) == taxIDDigits(original.Seller.TaxID)
+}
+
+// sameDay reports whether a and b fall on the same day in Vietnam time
+func sameDay(a, b time.Time) bool {
+	return a.In(vietnamTime).Format(time.DateOnly) == b.In(vietnamTime).Format(time.DateOnly)
+}
+
+// checkCreditNote checks that credit notes, adjustments and replacements
+// refer to an earlier invoice, and that credit notes record reductions as
+// positive amounts
+func checkCreditNote(inv *Invoice) []ValidationIssue {
+	adjusting := inv.Type == InvoiceTypeAdjustment || inv.Type == InvoiceTypeReplacement
+	if !inv.IsCreditNote() {
+		if inv.IsTaxInvoice() && inv.TotalAmount.IsNegative() {
+			return []ValidationIssue{{
+				Field:    "total_amount",
+				Message:  fmt.Sprintf("total %s is negative, but the invoice is not a credit note", inv.TotalAmount),
+				Severity: SeverityWarning,
+			}}
+		}
+		if !adjusting {
+			return nil
+		}
+	}
+
+	kind, verb := "credit note", "adjusts"
+	if !inv.IsCreditNote() {
+		kind = strings.ToLower(string(inv.Type)) + " invoice"
+		if inv.Type == InvoiceTypeReplacement {
+			verb = "replaces"
+		}
+	}
+	var findings []ValidationIssue
+	if inv.IsCreditNote() && inv.TotalAmount.IsNegative() {
+		findings = append(findings, ValidationIssue{
+			Field:    "total_amount",
+			Message:  fmt.Sprintf("credit note total %s is negative; reductions are recorded as positive amounts", inv.TotalAmount),
+			Severity: SeverityError,
+		})
+	}
+
+	ref := inv.OriginalInvoice
+	if ref == nil || ref.Number == "" {
+		severity := SeverityWarning
+		if inv.IsCreditNote() {
+			severity = SeverityError
+		}
+		return append(findings, ValidationIssue{
+			Field:    "original_invoice",
+			Message:  fmt.Sprintf("%s does not reference the invoice it %s", kind, verb),
+			Severity: severity,
+		})
+	}
+	if inv.Adjusts(inv) {
+		findings = append(findings, ValidationIssue{
+			Field:    "original_invoice.number",
+			Message:  fmt.Sprintf("%s %s references itself", kind, inv.Number),
+			Severity: SeverityError,
+		})
+	}
+	if !ref.Date.IsZero() && !inv.Date.IsZero() && ref.Date.After(inv.Date) {
+		findings = append(findings, ValidationIssue{
+			Field:    "original_invoice.date",
+			Message:  fmt.Sprintf("%s dated %s %s an invoice of %s, which is later", kind, inv.Date.Format(time.DateOnly), verb, ref.Date.Format(time.DateOnly)),
+			Severity: SeverityError,
+		})
+	}
+	if inv.IsCreditNote() && inv.AdjustmentReason == "" {
+		findings = append(findings, ValidationIssue{
+			Field:    "adjustment_reason",
+			Message:  "credit note gives no reason for the adjustment",
+			Severity: SeverityWarning,
+		})
+	}
+	return findings
+}
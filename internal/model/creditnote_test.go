@@ -0,0 +1,123 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestInvoice_NormalizeCreditNote(t *testing.T) {
+	inv := &model.Invoice{
+		Items: []model.LineItem{
+			{Quantity: decimal.NewFromInt(-2), UnitPrice: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(-100000), VATAmount: decimal.NewFromInt(-10000), VATRate: model.VATRate10},
+			{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(-30000), Amount: decimal.NewFromInt(-30000), VATAmount: decimal.NewFromInt(-3000), VATRate: model.VATRate10},
+			{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(20000), Amount: decimal.NewFromInt(20000), VATAmount: decimal.NewFromInt(2000), VATRate: model.VATRate10},
+		},
+		SubtotalAmount: decimal.NewFromInt(-110000),
+		TaxAmount:      decimal.NewFromInt(-11000),
+		TotalAmount:    decimal.NewFromInt(-121000),
+	}
+	inv.TaxBreakdown = model.SummarizeVAT(inv.Items)
+
+	require.True(t, inv.NormalizeCreditNote())
+	assert.True(t, inv.IsCreditNote())
+	assert.Equal(t, model.InvoiceTypeAdjustment, inv.Type)
+	assert.Equal(t, "121000", inv.TotalAmount.String())
+	assert.Equal(t, "11000", inv.TaxAmount.String())
+	assert.Equal(t, "110000", inv.TaxBreakdown[0].TaxableAmount.String())
+
+	assert.Equal(t, "2", inv.Items[0].Quantity.String(), "the negative quantity is negated")
+	assert.Equal(t, "30000", inv.Items[1].UnitPrice.String(), "the negative unit price is negated")
+	assert.Equal(t, "1", inv.Items[1].Quantity.String())
+	assert.Equal(t, "-1", inv.Items[2].Quantity.String(), "an increase on a credit note is negative")
+	assert.Equal(t, "-20000", inv.Items[2].Amount.String())
+	assert.Empty(t, inv.CheckArithmetic(decimal.NewFromInt(1)))
+
+	assert.False(t, inv.NormalizeCreditNote(), "normalized once")
+	assert.Equal(t, "-121000", inv.Signed(inv.TotalAmount).String())
+
+	refund := &model.Invoice{DocumentType: model.DocumentTypeReceipt, TotalAmount: decimal.NewFromInt(-45000)}
+	assert.False(t, refund.NormalizeCreditNote(), "receipts are left as they are")
+	assert.Equal(t, "-45000", refund.Signed(refund.TotalAmount).String())
+}
+
+func creditNote() *model.Invoice {
+	inv := tt78Invoice()
+	inv.Number = "43"
+	inv.Date = time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)
+	inv.Series = "1C24TAA"
+	inv.DocumentType = model.DocumentTypeCreditNote
+	inv.Type = model.InvoiceTypeAdjustment
+	inv.OriginalInvoice = &model.InvoiceReference{Number: "0000042", Series: "1c24taa", Date: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)}
+	inv.AdjustmentReason = "Hàng trả lại"
+	return inv
+}
+
+func TestInvoice_Adjusts(t *testing.T) {
+	original := tt78Invoice()
+	note := creditNote()
+	assert.True(t, note.Adjusts(original))
+
+	note.OriginalInvoice.Series = ""
+	note.OriginalInvoice.Date = time.Time{}
+	assert.True(t, note.Adjusts(original), "a reference without series or date matches any")
+
+	note.OriginalInvoice.Number = "41"
+	assert.False(t, note.Adjusts(original))
+
+	// Dates compare as days in Vietnam time, whatever their location
+	note = creditNote()
+	note.OriginalInvoice.Date = time.Date(2024, 3, 14, 20, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+	assert.True(t, note.Adjusts(original), "2024-03-15 07:00 in Vietnam")
+	note.OriginalInvoice.Date = time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC)
+	assert.False(t, note.Adjusts(original), "2024-03-16 01:00 in Vietnam")
+
+	note = creditNote()
+	note.Seller.TaxID = "0312345673"
+	assert.False(t, note.Adjusts(original), "another seller's invoice")
+	assert.False(t, tt78Invoice().Adjusts(original), "no reference")
+}
+
+func TestInvoice_ValidateCreditNote(t *testing.T) {
+	rule, ok := model.VietnamRules().Rule(model.RuleCreditNote)
+	require.True(t, ok)
+	set := model.RuleSet{rule}
+
+	assert.Empty(t, creditNote().Validate(set))
+	assert.Empty(t, tt78Invoice().Validate(set))
+
+	note := creditNote()
+	note.OriginalInvoice = nil
+	note.AdjustmentReason = ""
+	issues := note.Validate(set)
+	assert.Equal(t, []string{"credit_note:original_invoice"}, issueRules(issues), "the reason is only checked with a reference")
+	assert.Equal(t, model.SeverityError, issues[0].Severity)
+
+	note = creditNote()
+	note.TotalAmount = note.TotalAmount.Neg()
+	note.OriginalInvoice.Date = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	note.AdjustmentReason = ""
+	issues = note.Validate(set)
+	assert.Equal(t, []string{"credit_note:total_amount", "credit_note:original_invoice.date", "credit_note:adjustment_reason"}, issueRules(issues))
+	assert.Equal(t, "credit note dated 2024-04-02 adjusts an invoice of 2024-05-01, which is later", issues[1].Message)
+
+	note = creditNote()
+	note.OriginalInvoice = &model.InvoiceReference{Number: "43", Series: note.Series}
+	assert.Equal(t, []string{"credit_note:original_invoice.number"}, issueRules(note.Validate(set)))
+
+	replacement := tt78Invoice()
+	replacement.Type = model.InvoiceTypeReplacement
+	issues = replacement.Validate(set)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "replacement invoice does not reference the invoice it replaces", issues[0].Message)
+	assert.Equal(t, model.SeverityWarning, issues[0].Severity)
+
+	negative := tt78Invoice()
+	negative.TotalAmount = decimal.NewFromInt(-110000)
+	assert.Equal(t, []string{"credit_note:total_amount"}, issueRules(negative.Validate(set)))
+}
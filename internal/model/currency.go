@@ -0,0 +1,124 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CurrencyVND is the currency of invoices without one, and the currency
+// invoices are declared in
+const CurrencyVND = "VND"
+
+// ErrExchangeRate is the error of converting a foreign currency invoice
+// without an exchange rate
+var ErrExchangeRate = errors.New("no exchange rate to VND")
+
+// VNDAmounts are the VND equivalents of the totals of a foreign currency
+// invoice (tiền quy đổi), as printed on it
+type VNDAmounts struct {
+	SubtotalAmount decimal.Decimal `json:"subtotal_amount"`
+	TaxAmount      decimal.Decimal `json:"tax_amount"`
+	TotalAmount    decimal.Decimal `json:"total_amount"`
+}
+
+// ConvertToVND converts amount at rate VND per unit, rounded to whole dong
+func ConvertToVND(amount, rate decimal.Decimal) decimal.Decimal {
+	return amount.Mul(rate).Round(0)
+}
+
+// IsForeignCurrency reports whether the amounts of inv are in a currency
+// other than VND
+func (inv *Invoice) IsForeignCurrency() bool {
+	return inv.Currency != "" && inv.Currency != CurrencyVND
+}
+
+// ToVND converts an amount of inv to VND at its exchange rate; VND amounts
+// are returned as is
+func (inv *Invoice) ToVND(amount decimal.Decimal) (decimal.Decimal, error) {
+	if !inv.IsForeignCurrency() {
+		return amount, nil
+	}
+	if !inv.ExchangeRate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%w: %s invoice", ErrExchangeRate, inv.Currency)
+	}
+	return ConvertToVND(amount, inv.ExchangeRate), nil
+}
+
+// ConvertedAmounts returns the totals of inv converted to VND at its
+// exchange rate, whatever VND amounts it prints
+func (inv *Invoice) ConvertedAmounts() (VNDAmounts, error) {
+	var converted VNDAmounts
+	for _, a := range []struct {
+		dst    *decimal.Decimal
+		amount decimal.Decimal
+	}{
+		{&converted.SubtotalAmount, inv.SubtotalAmount},
+		{&converted.TaxAmount, inv.TaxAmount},
+		{&converted.TotalAmount, inv.TotalAmount},
+	} {
+		vnd, err := inv.ToVND(a.amount)
+		if err != nil {
+			return VNDAmounts{}, err
+		}
+		*a.dst = vnd
+	}
+	return converted, nil
+}
+
+// TotalVND returns the total of inv in VND: the printed equivalent of a
+// foreign currency invoice, or else its total converted
+func (inv *Invoice) TotalVND() (decimal.Decimal, error) {
+	if inv.IsForeignCurrency() && inv.VNDAmounts != nil && !inv.VNDAmounts.TotalAmount.IsZero() {
+		return inv.VNDAmounts.TotalAmount, nil
+	}
+	return inv.ToVND(inv.TotalAmount)
+}
+
+// conversionTolerance is the slack between a printed VND equivalent and
+// the converted amount: a minor unit of the currency at the exchange rate,
+// as amounts are converted line by line or from the rounded total, and a
+// dong of rounding
+func (inv *Invoice) conversionTolerance() decimal.Decimal {
+	return inv.ExchangeRate.Mul(inv.RoundingTolerance()).Add(decimal.NewFromInt(1))
+}
+
+func checkCurrency(inv *Invoice) []ValidationIssue {
+	if !inv.IsForeignCurrency() {
+		return nil
+	}
+	converted, err := inv.ConvertedAmounts()
+	if err != nil {
+		return []ValidationIssue{{
+			Field:    "exchange_rate",
+			Message:  fmt.Sprintf("%s invoice has no exchange rate to VND", inv.Currency),
+			Severity: SeverityWarning,
+		}}
+	}
+	if inv.VNDAmounts == nil {
+		return nil
+	}
+
+	tolerance := inv.conversionTolerance()
+	var findings []ValidationIssue
+	for _, a := range []struct {
+		field              string
+		printed, converted decimal.Decimal
+		amount             decimal.Decimal
+	}{
+		{"vnd_amounts.subtotal_amount", inv.VNDAmounts.SubtotalAmount, converted.SubtotalAmount, inv.SubtotalAmount},
+		{"vnd_amounts.tax_amount", inv.VNDAmounts.TaxAmount, converted.TaxAmount, inv.TaxAmount},
+		{"vnd_amounts.total_amount", inv.VNDAmounts.TotalAmount, converted.TotalAmount, inv.TotalAmount},
+	} {
+		if a.printed.IsZero() || a.printed.Sub(a.converted).Abs().LessThanOrEqual(tolerance) {
+			continue
+		}
+		findings = append(findings, ValidationIssue{
+			Field:    a.field,
+			Message:  fmt.Sprintf("%s %s at %s is %s VND, but %s VND is printed", a.amount, inv.Currency, inv.ExchangeRate, a.converted, a.printed),
+			Severity: SeverityError,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func usdInvoice() *model.Invoice {
+	inv := tt78Invoice()
+	inv.Currency = "USD"
+	inv.ExchangeRate = decimal.NewFromInt(25450)
+	inv.SubtotalAmount = decimal.RequireFromString("1200.50")
+	inv.TaxAmount = decimal.RequireFromString("120.05")
+	inv.TotalAmount = decimal.RequireFromString("1320.55")
+	inv.Items[0].UnitPrice = decimal.RequireFromString("600.25")
+	inv.Items[0].Amount = inv.SubtotalAmount
+	return inv
+}
+
+func TestInvoice_ToVND(t *testing.T) {
+	inv := usdInvoice()
+	assert.True(t, inv.IsForeignCurrency())
+
+	converted, err := inv.ConvertedAmounts()
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(30552725).Equal(converted.SubtotalAmount))
+	assert.True(t, decimal.NewFromInt(3055273).Equal(converted.TaxAmount), "rounded to whole dong")
+	assert.True(t, decimal.NewFromInt(33607998).Equal(converted.TotalAmount))
+
+	total, err := inv.TotalVND()
+	require.NoError(t, err)
+	assert.True(t, converted.TotalAmount.Equal(total))
+	inv.VNDAmounts = &model.VNDAmounts{TotalAmount: decimal.NewFromInt(33608000)}
+	total, err = inv.TotalVND()
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(33608000).Equal(total), "the printed equivalent wins")
+
+	inv.ExchangeRate = decimal.Zero
+	_, err = inv.ToVND(inv.TotalAmount)
+	assert.True(t, errors.Is(err, model.ErrExchangeRate))
+
+	vnd := tt78Invoice()
+	assert.False(t, vnd.IsForeignCurrency())
+	total, err = vnd.TotalVND()
+	require.NoError(t, err)
+	assert.True(t, vnd.TotalAmount.Equal(total))
+}
+
+func TestInvoice_ValidateCurrency(t *testing.T) {
+	inv := usdInvoice()
+	inv.VNDAmounts = &model.VNDAmounts{TotalAmount: decimal.NewFromInt(33608000)}
+	assert.Empty(t, inv.Validate(), "within a cent at the rate")
+
+	inv.VNDAmounts.TotalAmount = decimal.NewFromInt(33708000)
+	issues := inv.Validate()
+	require.Len(t, issues, 1)
+	assert.Equal(t, "currency:vnd_amounts.total_amount", issueRules(issues)[0])
+	assert.Equal(t, model.SeverityError, issues[0].Severity)
+	assert.Equal(t, "1320.55 USD at 25450 is 33607998 VND, but 33708000 VND is printed", issues[0].Message)
+
+	inv.ExchangeRate = decimal.Zero
+	issues = inv.Validate()
+	require.Len(t, issues, 1)
+	assert.Equal(t, "currency:exchange_rate", issueRules(issues)[0])
+	assert.Equal(t, model.SeverityWarning, issues[0].Severity)
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// FieldChange is a field that differs between two invoices
+type FieldChange struct {
+	Field string `json:"field"` // JSON path, e.g. "items[1].quantity"
+	Old   string `json:"old"`   // Empty for items added
+	New   string `json:"new"`   // Empty for items removed
+}
+
+// String renders the change as the invoice corrections are, e.g.
+// "total_amount: 110000 → 99000"
+func (c FieldChange) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s", c.Field, c.Old)
+	}
+	return fmt.Sprintf("%s: %s → %s", c.Field, c.Old, c.New)
+}
+
+// Diff lists the fields of the invoice b that differ from a: header,
+// parties, line items, matched by position, and totals. Extraction
+// metadata such as LowConfidenceFields and the source file is not
+// compared, and decimals are compared by value, so 10 and 10.00 are equal.
+func Diff(a, b *Invoice) []FieldChange {
+	d := &differ{}
+	d.text("number", a.Number, b.Number)
+	d.text("series", a.Series, b.Series)
+	d.text("date", formatDiffDate(a.Date), formatDiffDate(b.Date))
+	d.text("type", string(a.Type), string(b.Type))
+	d.text("document_type", string(a.DocumentType), string(b.DocumentType))
+	d.party("seller", a.Seller, b.Seller)
+	d.party("buyer", a.Buyer, b.Buyer)
+
+	for i := range max(len(a.Items), len(b.Items)) {
+		field := fmt.Sprintf("items[%d]", i)
+		switch {
+		case i >= len(a.Items):
+			d.add(field, "", itemLabel(b.Items[i]))
+		case i >= len(b.Items):
+			d.add(field, itemLabel(a.Items[i]), "")
+		default:
+			d.item(field, a.Items[i], b.Items[i])
+		}
+	}
+
+	d.amount("subtotal_amount", a.SubtotalAmount, b.SubtotalAmount)
+	d.amount("tax_amount", a.TaxAmount, b.TaxAmount)
+	d.amount("total_amount", a.TotalAmount, b.TotalAmount)
+	d.text("currency", a.Currency, b.Currency)
+	d.amount("exchange_rate", a.ExchangeRate, b.ExchangeRate)
+	d.text("payment_method", a.PaymentMethod, b.PaymentMethod)
+	d.text("payment_terms", a.PaymentTerms, b.PaymentTerms)
+	d.text("remarks", a.Remarks, b.Remarks)
+	d.text("adjustment_reason", a.AdjustmentReason, b.AdjustmentReason)
+	return d.changes
+}
+
+// differ collects the changes of Diff
+type differ struct {
+	changes []FieldChange
+}
+
+func (d *differ) add(field, old, new string) {
+	d.changes = append(d.changes, FieldChange{Field: field, Old: old, New: new})
+}
+
+func (d *differ) text(field, old, new string) {
+	if old != new {
+		d.add(field, old, new)
+	}
+}
+
+func (d *differ) amount(field string, old, new decimal.Decimal) {
+	if !old.Equal(new) {
+		d.add(field, old.String(), new.String())
+	}
+}
+
+func (d *differ) party(field string, old, new Party) {
+	d.text(field+".name", old.Name, new.Name)
+	d.text(field+".tax_id", old.TaxID, new.TaxID)
+	d.text(field+".address", old.Address, new.Address)
+	d.text(field+".phone", old.Phone, new.Phone)
+	d.text(field+".email", old.Email, new.Email)
+	d.text(field+".bank_account", old.BankAccount, new.BankAccount)
+	d.text(field+".bank_name", old.BankName, new.BankName)
+}
+
+func (d *differ) item(field string, old, new LineItem) {
+	d.text(field+".code", old.Code, new.Code)
+	d.text(field+".name", old.Name, new.Name)
+	d.text(field+".unit", old.Unit, new.Unit)
+	d.amount(field+".quantity", old.Quantity, new.Quantity)
+	d.amount(field+".unit_price", old.UnitPrice, new.UnitPrice)
+	d.amount(field+".discount", old.Discount, new.Discount)
+	if !old.VATRate.Equal(new.VATRate) {
+		d.add(field+".vat_rate", old.VATRate.String(), new.VATRate.String())
+	}
+	d.amount(field+".amount", old.Amount, new.Amount)
+	d.amount(field+".discount_amt", old.DiscountAmt, new.DiscountAmt)
+	d.amount(field+".vat_amount", old.VATAmount, new.VATAmount)
+	d.amount(field+".total", old.Total, new.Total)
+}
+
+// itemLabel names an item added or removed
+func itemLabel(item LineItem) string {
+	if item.Name != "" {
+		return item.Name
+	}
+	return fmt.Sprintf("line %d", item.Number)
+}
+
+func formatDiffDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,36 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestDiff(t *testing.T) {
+	original := tt78Invoice()
+	assert.Empty(t, model.Diff(original, tt78Invoice()))
+
+	adjusted := tt78Invoice()
+	adjusted.Type = model.InvoiceTypeAdjustment
+	adjusted.Items[0].Quantity = decimal.RequireFromString("1.00")
+	adjusted.Items[0].Amount = decimal.NewFromInt(50000)
+	adjusted.Items[0].VATRate = model.VATRate8
+	adjusted.Items = append(adjusted.Items, model.LineItem{Number: 2, Name: "Phí vận chuyển"})
+	adjusted.SubtotalAmount = decimal.RequireFromString("100000.00")
+	adjusted.LowConfidenceFields = []string{"total_amount"}
+
+	changes := model.Diff(original, adjusted)
+	assert.Equal(t, []model.FieldChange{
+		{Field: "type", Old: "", New: string(model.InvoiceTypeAdjustment)},
+		{Field: "items[0].quantity", Old: "2", New: "1"},
+		{Field: "items[0].vat_rate", Old: "10%", New: "8%"},
+		{Field: "items[0].amount", Old: "100000", New: "50000"},
+		{Field: "items[1]", Old: "", New: "Phí vận chuyển"},
+	}, changes, "decimals compare by value and metadata is left out")
+	assert.Equal(t, "items[0].quantity: 2 → 1", changes[1].String())
+	assert.Equal(t, "items[1]: added Phí vận chuyển", changes[4].String())
+	assert.Equal(t, "items[1]: removed Phí vận chuyển", model.Diff(adjusted, original)[4].String())
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// InvoiceReference identifies an earlier invoice, such as the one a credit note adjusts
+type InvoiceReference struct {
+	Number string    `json:"number"`
+	Series string    `json:"series,omitempty"`
+	Date   time.Time `json:"date,omitempty"`
+}
+
+// DeliveryInfo holds the details of a delivery note (phiếu xuất kho)
+type DeliveryInfo struct {
+	Warehouse   string `json:"warehouse,omitempty"`
+	DeliveredBy string `json:"delivered_by,omitempty"`
+	ReceivedBy  string `json:"received_by,omitempty"`
+	Vehicle     string `json:"vehicle,omitempty"`      // Vehicle plate or carrier
+	OrderNumber string `json:"order_number,omitempty"` // Purchase order being fulfilled
+}
+
+// PurchaseOrderInfo holds the details of a purchase order (đơn đặt hàng)
+type PurchaseOrderInfo struct {
+	DeliveryDate    time.Time `json:"delivery_date,omitempty"`
+	DeliveryAddress string    `json:"delivery_address,omitempty"`
+}
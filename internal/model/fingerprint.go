@@ -0,0 +1,75 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fingerprint identifies the invoice by its seller tax ID, series, number,
+// date and total, for finding the same invoice arriving twice. The fields
+// are normalized so the XML and a PDF or photo reading of it match: tax
+// IDs are their digits, series and numbers drop whitespace, diacritics and
+// case, and numbers their leading zeros ("0000042" and "42", "1C24TAA" and
+// "1c24 tâa"), dates are days in Vietnam time whatever location they
+// carry, and totals compare by value. It returns "" when the tax ID or
+// number is missing, as such invoices can't be told apart.
+//
+// Fingerprints stored by earlier versions, which took the day of a date in
+// its own location, differ for dates that fall on another day in Vietnam
+// time, such as midnight in Japan or an evening in Europe; recompute them
+// from the stored invoices to match them against new ones. Dates read
+// without a time of day, at midnight UTC, are unaffected.
+func (inv *Invoice) Fingerprint() string {
+	taxID := taxIDDigits(inv.Seller.TaxID)
+	number := strings.TrimLeft(fingerprintField(inv.Number), "0")
+	if taxID == "" || number == "" {
+		return ""
+	}
+
+	var date string
+	if !inv.Date.IsZero() {
+		date = inv.Date.In(vietnamTime).Format(time.DateOnly)
+	}
+	series := fingerprintField(inv.Series)
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{taxID, series, number, date, inv.TotalAmount.StringFixed(2)}, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// vietnamTime is the zone invoice dates are days of, so the same instant
+// parsed in UTC or in Asia/Ho_Chi_Minh falls on the same day. Vietnam has
+// no daylight saving time.
+var vietnamTime = time.FixedZone("ICT", 7*60*60)
+
+// taxIDDigits is a tax ID without separators or spaces
+func taxIDDigits(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, id)
+}
+
+// fingerprintField uppercases s without whitespace or Vietnamese diacritics
+func fingerprintField(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFC.String(s) {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r == 'đ' || r == 'Đ':
+			r = 'D'
+		case r >= utf8.RuneSelf:
+			r, _ = utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
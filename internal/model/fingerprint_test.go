@@ -0,0 +1,56 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestInvoice_Fingerprint(t *testing.T) {
+	inv := &model.Invoice{
+		Number:      "0000042",
+		Series:      "1C24TAA",
+		Date:        time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Seller:      model.Party{TaxID: "0123456789"},
+		TotalAmount: decimal.NewFromInt(216000),
+	}
+	fp := inv.Fingerprint()
+	require.NotEmpty(t, fp)
+	assert.Equal(t, "96fe77cf63eb675e518e6455a9f462f3", fp, "fingerprints stay stable across releases")
+
+	// A PDF reading of the same invoice
+	same := *inv
+	same.Number = "42"
+	same.Series = "1c24taa "
+	same.Seller.TaxID = "0123 456 789"
+	same.TotalAmount = decimal.RequireFromString("216000.00")
+	assert.Equal(t, fp, same.Fingerprint())
+
+	// A noisy OCR reading of it
+	noisy := same
+	noisy.Number = " 00 0042"
+	noisy.Series = "1C24 TÂA"
+	noisy.Date = time.Date(2024, 3, 15, 14, 30, 0, 0, time.UTC)
+	assert.Equal(t, fp, noisy.Fingerprint())
+
+	// The same date read in Vietnam time, or converted to UTC
+	hcm := time.FixedZone("Asia/Ho_Chi_Minh", 7*60*60)
+	local := *inv
+	local.Date = time.Date(2024, 3, 15, 0, 0, 0, 0, hcm)
+	assert.Equal(t, fp, local.Fingerprint())
+	local.Date = local.Date.UTC()
+	assert.Equal(t, 14, local.Date.Day())
+	assert.Equal(t, fp, local.Fingerprint())
+
+	other := *inv
+	other.TotalAmount = decimal.NewFromInt(216001)
+	assert.NotEqual(t, fp, other.Fingerprint())
+
+	assert.Empty(t, (&model.Invoice{Number: "42"}).Fingerprint(), "no seller tax ID")
+	assert.Empty(t, (&model.Invoice{Number: "000", Seller: inv.Seller}).Fingerprint(), "no number")
+}
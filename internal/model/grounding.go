@@ -0,0 +1,12 @@
+package model
+
+// BoundingBox locates an extracted value on the source document. Coordinates
+// are fractions (0-1) of the page size measured from the top-left corner, so
+// they apply at any rendering resolution.
+type BoundingBox struct {
+	Page   int     `json:"page"` // 1-based page (or image) number
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
@@ -18,15 +18,6 @@ const (
 	ProviderUnknown Provider = "UNKNOWN"
 )
 
-// VATRate represents valid Vietnam VAT rates
-type VATRate int
-
-const (
-	VATRate0  VATRate = 0
-	VATRate5  VATRate = 5
-	VATRate10 VATRate = 10
-)
-
 // InvoiceType represents invoice type
 type InvoiceType string
 
@@ -36,16 +27,24 @@ const (
 	InvoiceTypeAdjustment  InvoiceType = "Adjustment"
 )
 
-// DocumentType distinguishes invoice from receipt
+// DocumentType distinguishes invoices, receipts and related AP documents
 type DocumentType string
 
 const (
-	DocumentTypeInvoice DocumentType = "invoice"
-	DocumentTypeReceipt DocumentType = "receipt"
+	DocumentTypeInvoice       DocumentType = "invoice"
+	DocumentTypeReceipt       DocumentType = "receipt"
+	DocumentTypeCreditNote    DocumentType = "credit_note"    // Hóa đơn điều chỉnh giảm
+	DocumentTypeDeliveryNote  DocumentType = "delivery_note"  // Phiếu xuất kho / phiếu giao hàng
+	DocumentTypePurchaseOrder DocumentType = "purchase_order" // Đơn đặt hàng
+	DocumentTypeOther         DocumentType = "other"          // None of the above
 )
 
 // Invoice represents a Vietnam e-invoice
 type Invoice struct {
+	// Version of the serialization (see InvoiceSchemaVersion), set by the
+	// pipeline and Marshal
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	// Unique identifier
 	ID string `json:"id"`
 
@@ -68,9 +67,13 @@ type Invoice struct {
 	TaxAmount      decimal.Decimal `json:"tax_amount"`
 	TotalAmount    decimal.Decimal `json:"total_amount"`
 
+	// Taxable amount and VAT per rate, for VAT declarations
+	TaxBreakdown []VATLine `json:"tax_breakdown,omitempty"`
+
 	// Currency
 	Currency     string          `json:"currency"` // "VND"
-	ExchangeRate decimal.Decimal `json:"exchange_rate,omitempty"`
+	ExchangeRate decimal.Decimal `json:"exchange_rate,omitempty"` // VND per unit
+	VNDAmounts   *VNDAmounts     `json:"vnd_amounts,omitempty"`   // Printed VND equivalents of foreign currency totals
 
 	// Optional
 	Remarks      string `json:"remarks,omitempty"`
@@ -86,6 +89,30 @@ type Invoice struct {
 	AmountTendered decimal.Decimal `json:"amount_tendered,omitempty"` // Cash given
 	Change         decimal.Decimal `json:"change,omitempty"`          // Change returned
 
+	// Credit note, delivery note and purchase order fields
+	OriginalInvoice  *InvoiceReference  `json:"original_invoice,omitempty"` // Invoice being adjusted
+	AdjustmentReason string             `json:"adjustment_reason,omitempty"`
+	Delivery         *DeliveryInfo      `json:"delivery,omitempty"`
+	Order            *PurchaseOrderInfo `json:"order,omitempty"`
+
+	// Extraction quality: fields the extractor is unsure of, by JSON path (e.g. "seller.tax_id")
+	LowConfidenceFields []string `json:"low_confidence_fields,omitempty"`
+
+	// Where each value was read on the page, keyed by the same paths as LowConfidenceFields
+	FieldLocations map[string]BoundingBox `json:"field_locations,omitempty"`
+
+	// Handwritten values (amounts or names filled in by hand), by JSON path
+	HasHandwriting    bool     `json:"has_handwriting,omitempty"`
+	HandwrittenFields []string `json:"handwritten_fields,omitempty"`
+
+	// Values the extractor corrected after an arithmetic or tax ID check, e.g.
+	// "items[1].amount: 150000 → 105000"
+	Corrections []string `json:"corrections,omitempty"`
+
+	// Set when the document text was too long for the model and only its most
+	// relevant lines (header, totals, as many line items as fit) were sent
+	TextTruncated bool `json:"text_truncated,omitempty"`
+
 	// Signature (if signed)
 	Signature *Signature `json:"signature,omitempty"`
 
@@ -96,13 +123,14 @@ type Invoice struct {
 
 // Party represents seller or buyer
 type Party struct {
-	Name        string `json:"name"`
-	TaxID       string `json:"tax_id"`  // 10 digits
-	Address     string `json:"address"`
-	Phone       string `json:"phone,omitempty"`
-	Email       string `json:"email,omitempty"`
-	BankAccount string `json:"bank_account,omitempty"`
-	BankName    string `json:"bank_name,omitempty"`
+	Name         string   `json:"name"`
+	TaxID        string   `json:"tax_id"` // 10 digits
+	Address      string   `json:"address"`
+	AddressParts *Address `json:"address_parts,omitempty"` // Address split into ward, district and province
+	Phone        string   `json:"phone,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	BankAccount  string   `json:"bank_account,omitempty"`
+	BankName     string   `json:"bank_name,omitempty"`
 }
 
 // LineItem represents invoice line item
@@ -112,6 +140,7 @@ type LineItem struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description,omitempty"`
 	Unit        string          `json:"unit"` // "piece", "kg", "meter"
+	UnitCode    string          `json:"unit_code,omitempty"` // UN/ECE code of Unit, e.g. C62 or KGM (see package uom)
 	Quantity    decimal.Decimal `json:"quantity"`
 	UnitPrice   decimal.Decimal `json:"unit_price"`
 	Discount    decimal.Decimal `json:"discount,omitempty"` // Discount percentage
@@ -145,7 +174,7 @@ func (li *LineItem) Calculate() {
 
 	// VATAmount = (Amount - DiscountAmt) * (VATRate / 100)
 	taxableAmount := li.Amount.Sub(li.DiscountAmt)
-	li.VATAmount = taxableAmount.Mul(decimal.NewFromInt(int64(li.VATRate))).Div(decimal.NewFromInt(100)).Round(0)
+	li.VATAmount = li.VATRate.Tax(taxableAmount).Round(0)
 
 	// Total = Amount - DiscountAmt + VATAmount
 	li.Total = taxableAmount.Add(li.VATAmount).Round(0)
@@ -165,4 +194,5 @@ func (inv *Invoice) CalculateTotals() {
 	inv.SubtotalAmount = subtotal.Round(0)
 	inv.TaxAmount = tax.Round(0)
 	inv.TotalAmount = subtotal.Add(tax).Round(0)
+	inv.TaxBreakdown = SummarizeVAT(inv.Items)
 }
@@ -146,9 +146,12 @@ func TestProviderConstants(t *testing.T) {
 }
 
 func TestVATRates(t *testing.T) {
-	assert.Equal(t, 0, int(model.VATRate0))
-	assert.Equal(t, 5, int(model.VATRate5))
-	assert.Equal(t, 10, int(model.VATRate10))
+	assert.Equal(t, "0%", model.VATRate0.String())
+	assert.Equal(t, "5%", model.VATRate5.String())
+	assert.Equal(t, "8%", model.VATRate8.String())
+	assert.Equal(t, "10%", model.VATRate10.String())
+	assert.Equal(t, "KCT", model.VATRateKCT.String())
+	assert.Equal(t, "KKKNT", model.VATRateKKKNT.String())
 }
 
 func TestParseError(t *testing.T) {
@@ -0,0 +1,310 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InvoiceSchemaVersion is the version of the JSON serialization of Invoice,
+// written to schema_version. Bump it when a field is renamed, moved or
+// changes meaning; adding an optional field needs no new version.
+const InvoiceSchemaVersion = 1
+
+// ErrUnsupportedSchemaVersion is returned for invoices serialized by a newer
+// release than this one understands
+var ErrUnsupportedSchemaVersion = errors.New("unsupported invoice schema version")
+
+// jsonSchemaer is implemented by types serialized otherwise than their
+// fields read, such as VATRate
+type jsonSchemaer interface {
+	JSONSchema() map[string]any
+}
+
+var (
+	decimalType      = reflect.TypeOf(decimal.Decimal{})
+	timeType         = reflect.TypeOf(time.Time{})
+	jsonSchemaerType = reflect.TypeOf((*jsonSchemaer)(nil)).Elem()
+	marshalerType    = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// InvoiceJSONSchema returns the JSON Schema (draft 2020-12) of Invoice as
+// Marshal and json.Marshal write it. Decimals are strings, so amounts keep
+// their precision. Properties written even when empty are required, and
+// unknown properties are allowed, so consumers of this version accept
+// invoices of later releases.
+func InvoiceJSONSchema() map[string]any {
+	schema := schemaOf(reflect.TypeOf(Invoice{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Invoice"
+	schema["description"] = fmt.Sprintf("Vietnam e-invoice, receipt or commercial document, schema version %d", InvoiceSchemaVersion)
+	schema["properties"].(map[string]any)["schema_version"] = map[string]any{"type": "integer", "const": InvoiceSchemaVersion}
+	return schema
+}
+
+func schemaOf(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Implements(jsonSchemaerType):
+		return reflect.Zero(t).Interface().(jsonSchemaer).JSONSchema()
+	case t == decimalType:
+		return map[string]any{"type": "string", "pattern": `^-?\d+(\.\d+)?$`}
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for _, f := range jsonFields(t) {
+			schema := schemaOf(f.Type)
+			if !f.omittable() {
+				required = append(required, f.name)
+				if k := f.Type.Kind(); k == reflect.Pointer || k == reflect.Slice || k == reflect.Map {
+					schema = map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+				}
+			}
+			properties[f.name] = schema
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]any{}
+}
+
+// jsonField is a struct field as encoding/json writes it
+type jsonField struct {
+	reflect.StructField
+	name      string
+	omitEmpty bool
+	omitZero  bool
+}
+
+// omittable reports whether encoding/json may leave the field out; it
+// never leaves out structs under omitempty
+func (f jsonField) omittable() bool {
+	return f.omitZero || f.omitEmpty && f.Type.Kind() != reflect.Struct
+}
+
+// omitted reports whether encoding/json leaves out v, the value of the field
+func (f jsonField) omitted(v reflect.Value) bool {
+	if f.omitZero {
+		if z, ok := v.Interface().(interface{ IsZero() bool }); ok {
+			return z.IsZero()
+		}
+		return v.IsZero()
+	}
+	if !f.omitEmpty {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// jsonFields lists the fields of t encoding/json writes, in order
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		opts := strings.Split(options, ",")
+		fields = append(fields, jsonField{
+			StructField: f,
+			name:        name,
+			omitEmpty:   slices.Contains(opts, "omitempty"),
+			omitZero:    slices.Contains(opts, "omitzero"),
+		})
+	}
+	return fields
+}
+
+// MarshalOption changes how Marshal writes an invoice
+type MarshalOption func(*marshalOptions)
+
+type marshalOptions struct {
+	omitZeroDecimals bool
+	sortKeys         bool
+}
+
+// OmitZeroDecimals leaves out amounts, quantities and rates that are zero,
+// which Invoice otherwise writes as "0"
+func OmitZeroDecimals() MarshalOption {
+	return func(o *marshalOptions) {
+		o.omitZeroDecimals = true
+	}
+}
+
+// SortKeys writes the properties of every object in alphabetical order
+// rather than in the order of the struct fields, so the payload of an
+// invoice does not change with the layout of the model, for hashing and
+// comparing payloads across releases
+func SortKeys() MarshalOption {
+	return func(o *marshalOptions) {
+		o.sortKeys = true
+	}
+}
+
+// Marshal writes inv as JSON stamped with InvoiceSchemaVersion. Without
+// options it writes what json.Marshal does.
+func Marshal(inv *Invoice, opts ...MarshalOption) ([]byte, error) {
+	var o marshalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	stamped := *inv
+	stamped.SchemaVersion = InvoiceSchemaVersion
+	if !o.omitZeroDecimals && !o.sortKeys {
+		return json.Marshal(&stamped)
+	}
+	value, err := encodeValue(reflect.ValueOf(stamped), o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode invoice: %w", err)
+	}
+	return json.Marshal(value)
+}
+
+// Unmarshal reads an invoice written by Marshal or json.Marshal, of this
+// schema version or an earlier one. Invoices without schema_version predate
+// it and are version 1.
+func Unmarshal(data []byte) (*Invoice, error) {
+	var inv Invoice
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("failed to decode invoice: %w", err)
+	}
+	if inv.SchemaVersion > InvoiceSchemaVersion {
+		return nil, fmt.Errorf("%w: %d (newest supported: %d)", ErrUnsupportedSchemaVersion, inv.SchemaVersion, InvoiceSchemaVersion)
+	}
+	inv.SchemaVersion = InvoiceSchemaVersion
+	return &inv, nil
+}
+
+// object is a JSON object written in the order of its members
+type object []member
+
+type member struct {
+	name  string
+	value any
+}
+
+// MarshalJSON writes the members of o in order
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// encodeValue converts v to values json.Marshal writes as encoding/json
+// would v, with the options applied: structs become objects, and values
+// with their own encoding stay as they are
+func encodeValue(v reflect.Value, o marshalOptions) (any, error) {
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Type().Implements(marshalerType) {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var obj object
+		for _, f := range jsonFields(v.Type()) {
+			field := v.FieldByIndex(f.Index)
+			if f.omitted(field) {
+				continue
+			}
+			if o.omitZeroDecimals && f.Type == decimalType && field.Interface().(decimal.Decimal).IsZero() {
+				continue
+			}
+			value, err := encodeValue(field, o)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{f.name, value})
+		}
+		if o.sortKeys {
+			slices.SortFunc(obj, func(a, b member) int { return strings.Compare(a.name, b.name) })
+		}
+		return obj, nil
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		values := make([]any, v.Len())
+		for i := range values {
+			value, err := encodeValue(v.Index(i), o)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		values := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			value, err := encodeValue(iter.Value(), o)
+			if err != nil {
+				return nil, err
+			}
+			values[fmt.Sprint(iter.Key().Interface())] = value // Written sorted by key
+		}
+		return values, nil
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,80 @@
+package model_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestInvoiceJSONSchema_Published(t *testing.T) {
+	published, err := os.ReadFile("../../docs/invoice.schema.json")
+	require.NoError(t, err)
+	generated, err := json.Marshal(model.InvoiceJSONSchema())
+	require.NoError(t, err)
+	assert.JSONEq(t, string(generated), string(published), "regenerate with: invoice-processor schema > docs/invoice.schema.json")
+}
+
+func TestInvoiceJSONSchema(t *testing.T) {
+	schema := model.InvoiceJSONSchema()
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "integer", "const": model.InvoiceSchemaVersion}, properties["schema_version"])
+	assert.Equal(t, "string", properties["total_amount"].(map[string]any)["type"], "decimals are strings")
+	assert.Contains(t, properties["items"].(map[string]any)["anyOf"].([]any)[0].(map[string]any)["items"].(map[string]any)["properties"], "vat_rate")
+	assert.NotContains(t, properties, "RawXML")
+
+	// Every property an invoice is written with is described, and every
+	// required one is written
+	data, err := model.Marshal(tt78Invoice())
+	require.NoError(t, err)
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(data, &obj))
+	for name := range obj {
+		assert.Contains(t, properties, name)
+	}
+	for _, name := range schema["required"].([]string) {
+		assert.Contains(t, obj, name)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	inv := tt78Invoice()
+	data, err := model.Marshal(inv)
+	require.NoError(t, err)
+	plain, err := json.Marshal(inv)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"schema_version":1,`)
+	assert.NotContains(t, string(plain), `schema_version`, "the invoice is not modified")
+
+	data, err = model.Marshal(inv, model.OmitZeroDecimals())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"exchange_rate"`)
+	assert.NotContains(t, string(data), `"discount_amt"`)
+	assert.Contains(t, string(data), `"total_amount":"110000"`)
+	assert.Contains(t, string(data), `"vat_rate":10`)
+
+	data, err = model.Marshal(inv, model.SortKeys())
+	require.NoError(t, err)
+	assert.Regexp(t, `^\{"amount_tendered":"0","buyer":\{"address":"","name":"","tax_id":""\},"change":"0",`, string(data))
+
+	decoded, err := model.Unmarshal(data)
+	require.NoError(t, err)
+	assert.Equal(t, inv.Number, decoded.Number)
+	assert.True(t, inv.TotalAmount.Equal(decoded.TotalAmount))
+	assert.True(t, model.VATRate10.Equal(decoded.Items[0].VATRate))
+}
+
+func TestUnmarshal_SchemaVersion(t *testing.T) {
+	inv, err := model.Unmarshal([]byte(`{"number":"42","total_amount":"110000"}`))
+	require.NoError(t, err)
+	assert.Equal(t, model.InvoiceSchemaVersion, inv.SchemaVersion, "unversioned payloads are version 1")
+	assert.True(t, decimal.NewFromInt(110000).Equal(inv.TotalAmount))
+
+	_, err = model.Unmarshal([]byte(`{"schema_version":2,"number":"42"}`))
+	assert.ErrorIs(t, err, model.ErrUnsupportedSchemaVersion)
+}
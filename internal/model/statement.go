@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement represents a bank account statement (sao kê tài khoản)
+type Statement struct {
+	ID string `json:"id"`
+
+	BankName      string `json:"bank_name"`
+	AccountNumber string `json:"account_number"`
+	AccountHolder string `json:"account_holder,omitempty"`
+	Currency      string `json:"currency"` // "VND"
+
+	PeriodStart time.Time `json:"period_start,omitempty"`
+	PeriodEnd   time.Time `json:"period_end,omitempty"`
+
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+
+	Transactions []Transaction `json:"transactions"`
+
+	// Extraction quality: fields the extractor is unsure of, by JSON path
+	LowConfidenceFields []string `json:"low_confidence_fields,omitempty"`
+
+	SourceFile string `json:"source_file"`
+}
+
+// Transaction is one statement line. Amount is signed: credits (money in) are
+// positive and debits (money out) negative.
+type Transaction struct {
+	Date         time.Time       `json:"date"`
+	Description  string          `json:"description"`
+	Reference    string          `json:"reference,omitempty"` // Bank transaction number
+	Counterparty string          `json:"counterparty,omitempty"`
+	Amount       decimal.Decimal `json:"amount"`
+	Balance      decimal.Decimal `json:"balance,omitempty"` // Running balance after the transaction
+}
+
+// IsCredit reports whether the transaction brought money into the account
+func (t Transaction) IsCredit() bool {
+	return t.Amount.IsPositive()
+}
+
+// TotalCredits sums incoming transactions
+func (s *Statement) TotalCredits() decimal.Decimal {
+	total := decimal.Zero
+	for _, t := range s.Transactions {
+		if t.IsCredit() {
+			total = total.Add(t.Amount)
+		}
+	}
+	return total
+}
+
+// TotalDebits sums outgoing transactions as a positive amount
+func (s *Statement) TotalDebits() decimal.Decimal {
+	total := decimal.Zero
+	for _, t := range s.Transactions {
+		if t.Amount.IsNegative() {
+			total = total.Sub(t.Amount)
+		}
+	}
+	return total
+}
+
+// CheckBalances verifies that the opening balance plus transactions gives the
+// closing balance and that running balances are consistent. Zero balances are
+// treated as not printed and skipped.
+func (s *Statement) CheckBalances() error {
+	balance := s.OpeningBalance
+	for i, t := range s.Transactions {
+		balance = balance.Add(t.Amount)
+		if !t.Balance.IsZero() && !s.OpeningBalance.IsZero() && !balance.Equal(t.Balance) {
+			return fmt.Errorf("transaction %d: running balance %s, expected %s", i+1, t.Balance, balance)
+		}
+		if !t.Balance.IsZero() {
+			balance = t.Balance
+		}
+	}
+
+	if !s.ClosingBalance.IsZero() && !balance.Equal(s.ClosingBalance) {
+		return fmt.Errorf("closing balance %s, expected %s", s.ClosingBalance, balance)
+	}
+	return nil
+}
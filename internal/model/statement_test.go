@@ -0,0 +1,33 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestStatement_CheckBalances(t *testing.T) {
+	d := decimal.NewFromInt
+	stmt := &model.Statement{
+		OpeningBalance: d(1000000),
+		ClosingBalance: d(1350000),
+		Transactions: []model.Transaction{
+			{Amount: d(-150000), Balance: d(850000)},
+			{Amount: d(500000)}, // No balance column on this line
+		},
+	}
+
+	assert.NoError(t, stmt.CheckBalances())
+	assert.Equal(t, "500000", stmt.TotalCredits().String())
+	assert.Equal(t, "150000", stmt.TotalDebits().String())
+
+	stmt.Transactions[0].Balance = d(800000)
+	assert.ErrorContains(t, stmt.CheckBalances(), "transaction 1")
+
+	stmt.Transactions[0].Balance = d(850000)
+	stmt.ClosingBalance = d(1400000)
+	assert.ErrorContains(t, stmt.CheckBalances(), "closing balance")
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Errors of ValidateTaxID
+var (
+	ErrTaxIDFormat   = errors.New("tax ID is not 10 digits with an optional -NNN branch suffix, or a 12-digit personal ID")
+	ErrTaxIDChecksum = errors.New("tax ID check digit does not match")
+)
+
+// taxIDFormat is a Vietnamese tax ID (mã số thuế): 10 digits, with a 3-digit
+// branch suffix for dependent units, usually after a hyphen
+var taxIDFormat = regexp.MustCompile(`^(\d{10})(?:-?(\d{3}))?$`)
+
+// personalTaxIDFormat is the 12-digit personal ID number (số định danh cá
+// nhân) individuals and household businesses use as their tax ID since
+// 1 July 2025
+var personalTaxIDFormat = regexp.MustCompile(`^\d{12}$`)
+
+// taxIDWeights weigh the first nine digits of a tax ID for its check digit
+var taxIDWeights = [9]int{31, 29, 23, 19, 17, 13, 7, 5, 3}
+
+// ValidateTaxID checks a Vietnamese tax ID: its format, 10 digits or 13 as
+// NNNNNNNNNN-NNN, a branch suffix other than 000, and its tenth digit,
+// which is 10 minus the weighted sum of the first nine modulo 11. Most
+// single misread digits fail the check. The 12-digit personal IDs of
+// individuals have no check digit, so only their format is checked.
+func ValidateTaxID(id string) error {
+	if personalTaxIDFormat.MatchString(id) {
+		return nil
+	}
+	m := taxIDFormat.FindStringSubmatch(id)
+	if m == nil {
+		return fmt.Errorf("%w: %q", ErrTaxIDFormat, id)
+	}
+	if m[2] == "000" {
+		return fmt.Errorf("%w: branch suffix 000 of %q", ErrTaxIDFormat, id)
+	}
+	sum := 0
+	for i, weight := range taxIDWeights {
+		sum += int(m[1][i]-'0') * weight
+	}
+	if check := 10 - sum%11; check != int(m[1][9]-'0') {
+		return fmt.Errorf("%w: %q", ErrTaxIDChecksum, id)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestValidateTaxID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want error
+	}{
+		{"0100109106", nil},
+		{"0101243150", nil}, // Check digit 0
+		{"0101248141-001", nil},
+		{"0101248141001", nil},
+		{"001085012345", nil}, // Personal ID, no check digit
+		{"079199000001", nil},
+		{"0100109108", model.ErrTaxIDChecksum}, // Last digit misread
+		{"0100189106", model.ErrTaxIDChecksum}, // 0 read as 8
+		{"0109876543", model.ErrTaxIDChecksum}, // No digit checks out
+		{"0101248141-000", model.ErrTaxIDFormat},
+		{"010010910", model.ErrTaxIDFormat},
+		{"00108501234", model.ErrTaxIDFormat},      // 11 digits
+		{"001085012345-001", model.ErrTaxIDFormat}, // Personal IDs have no branches
+		{"0100-109-106", model.ErrTaxIDFormat},
+		{"MST 0100109106", model.ErrTaxIDFormat},
+		{"", model.ErrTaxIDFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := model.ValidateTaxID(tt.id)
+			if tt.want == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Severity grades a validation issue
+type Severity string
+
+const (
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// ValidationIssue is one problem a validation rule found in an invoice
+type ValidationIssue struct {
+	Rule     string   `json:"rule"`
+	Field    string   `json:"field,omitempty"` // JSON path, e.g. "seller.tax_id"
+	Message  string   `json:"message"`
+	Severity Severity `json:"severity"`
+}
+
+// String renders the issue as a result warning
+func (f ValidationIssue) String() string {
+	return fmt.Sprintf("validation %s: %s", f.Severity, f.Message)
+}
+
+// ValidationRule checks one aspect of an invoice
+type ValidationRule struct {
+	Name  string
+	Check func(inv *Invoice) []ValidationIssue
+}
+
+// RuleSet is a list of validation rules, run in order
+type RuleSet []ValidationRule
+
+// With returns the set with rules added, replacing those of the same name
+func (s RuleSet) With(rules ...ValidationRule) RuleSet {
+	out := slices.Clone(s)
+	for _, rule := range rules {
+		if i := slices.IndexFunc(out, func(r ValidationRule) bool { return r.Name == rule.Name }); i >= 0 {
+			out[i] = rule
+		} else {
+			out = append(out, rule)
+		}
+	}
+	return out
+}
+
+// Without returns the set without the rules named
+func (s RuleSet) Without(names ...string) RuleSet {
+	return slices.DeleteFunc(slices.Clone(s), func(r ValidationRule) bool { return slices.Contains(names, r.Name) })
+}
+
+// Rule returns the rule of the set named name
+func (s RuleSet) Rule(name string) (ValidationRule, bool) {
+	i := slices.IndexFunc(s, func(r ValidationRule) bool { return r.Name == name })
+	if i < 0 {
+		return ValidationRule{}, false
+	}
+	return s[i], true
+}
+
+// Names of the rules of VietnamRules and TT78Rules
+const (
+	RuleRequiredFields = "required_fields"
+	RuleTaxID          = "tax_id"
+	RuleDate           = "date"
+	RuleTotals         = "totals"
+	RuleVATRate        = "vat_rate"
+	RuleCurrency       = "currency"
+	RuleCreditNote     = "credit_note"
+	RuleNumberFormat   = "number_format"
+	RuleSeriesFormat   = "series_format"
+)
+
+// VietnamRules returns the checks of any Vietnamese invoice or receipt:
+// required fields, tax ID format, a date not in the future, item and total
+// arithmetic, legal VAT rates, VND equivalents matching the converted
+// amounts of foreign currency invoices, and credit notes and adjustments
+// referencing the invoice they adjust
+func VietnamRules() RuleSet {
+	return RuleSet{
+		{Name: RuleRequiredFields, Check: checkRequiredFields},
+		{Name: RuleTaxID, Check: checkTaxIDs},
+		{Name: RuleDate, Check: checkDate},
+		{Name: RuleTotals, Check: checkTotals},
+		{Name: RuleVATRate, Check: checkVATRates},
+		{Name: RuleCurrency, Check: checkCurrency},
+		{Name: RuleCreditNote, Check: checkCreditNote},
+	}
+}
+
+// TT78Rules returns VietnamRules with the numbering of e-invoices under
+// Circular 78/2021/TT-BTC: numbers of up to 8 digits, and series such as
+// 1C24TAA matching the year of the invoice
+func TT78Rules() RuleSet {
+	return VietnamRules().With(
+		ValidationRule{Name: RuleNumberFormat, Check: checkTT78Number},
+		ValidationRule{Name: RuleSeriesFormat, Check: checkTT78Series},
+	)
+}
+
+// Validate runs the rules of sets over the invoice, in order, and returns
+// their issues (default: TT78Rules)
+func (inv *Invoice) Validate(sets ...RuleSet) []ValidationIssue {
+	if len(sets) == 0 {
+		sets = []RuleSet{TT78Rules()}
+	}
+	var issues []ValidationIssue
+	for _, set := range sets {
+		for _, rule := range set {
+			for _, issue := range rule.Check(inv) {
+				issue.Rule = rule.Name
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues
+}
+
+// IsTaxInvoice reports whether the document is a tax invoice, which must
+// carry a number, date, seller and total. Receipts and other documents are
+// only expected to have a date and a total.
+func (inv *Invoice) IsTaxInvoice() bool {
+	switch inv.DocumentType {
+	case "", DocumentTypeInvoice, DocumentTypeCreditNote:
+		return true
+	default:
+		return false
+	}
+}
+
+func checkRequiredFields(inv *Invoice) []ValidationIssue {
+	var findings []ValidationIssue
+	missing := func(field, name string, severity Severity) {
+		findings = append(findings, ValidationIssue{Field: field, Message: "missing " + name, Severity: severity})
+	}
+
+	if !inv.IsTaxInvoice() {
+		if inv.Date.IsZero() {
+			missing("date", "document date", SeverityWarning)
+		}
+		if inv.TotalAmount.IsZero() && inv.DocumentType == DocumentTypeReceipt {
+			missing("total_amount", "total amount", SeverityWarning)
+		}
+		return findings
+	}
+
+	if inv.Number == "" {
+		missing("number", "invoice number", SeverityError)
+	}
+	if inv.Date.IsZero() {
+		missing("date", "invoice date", SeverityError)
+	}
+	if inv.Seller.TaxID == "" {
+		missing("seller.tax_id", "seller tax ID", SeverityError)
+	}
+	if inv.Seller.Name == "" {
+		missing("seller.name", "seller name", SeverityWarning)
+	}
+	if inv.TotalAmount.IsZero() {
+		missing("total_amount", "total amount", SeverityError)
+	}
+	return findings
+}
+
+func checkTaxIDs(inv *Invoice) []ValidationIssue {
+	var findings []ValidationIssue
+	for _, party := range []struct {
+		field, name, taxID string
+	}{
+		{"seller.tax_id", "seller", inv.Seller.TaxID},
+		{"buyer.tax_id", "buyer", inv.Buyer.TaxID}, // Individuals may have none
+	} {
+		if party.taxID == "" {
+			continue
+		}
+		message := fmt.Sprintf("%s tax ID %q is not 10, 12 or 13 digits", party.name, party.taxID)
+		switch err := ValidateTaxID(party.taxID); {
+		case err == nil:
+			continue
+		case errors.Is(err, ErrTaxIDChecksum):
+			message = fmt.Sprintf("%s tax ID %q fails its check digit; it may be misread", party.name, party.taxID)
+		}
+		findings = append(findings, ValidationIssue{Field: party.field, Message: message, Severity: SeverityError})
+	}
+	return findings
+}
+
+// earliestInvoiceDate is the floor below which a date is taken for a misread
+var earliestInvoiceDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func checkDate(inv *Invoice) []ValidationIssue {
+	if inv.Date.IsZero() {
+		return nil // Reported by required_fields
+	}
+	// A day of slack for time zones
+	if inv.Date.After(time.Now().AddDate(0, 0, 1)) {
+		return []ValidationIssue{{
+			Field:    "date",
+			Message:  fmt.Sprintf("invoice date %s is in the future", inv.Date.Format(time.DateOnly)),
+			Severity: SeverityError,
+		}}
+	}
+	if inv.Date.Before(earliestInvoiceDate) {
+		return []ValidationIssue{{
+			Field:    "date",
+			Message:  fmt.Sprintf("invoice date %s is implausibly old", inv.Date.Format(time.DateOnly)),
+			Severity: SeverityWarning,
+		}}
+	}
+	return nil
+}
+
+// RoundingTolerance is the slack of an amount check: one unit for VND,
+// which has no minor unit, one cent otherwise
+func (inv *Invoice) RoundingTolerance() decimal.Decimal {
+	if !inv.IsForeignCurrency() {
+		return decimal.NewFromInt(1)
+	}
+	return decimal.New(1, -2)
+}
+
+func checkTotals(inv *Invoice) []ValidationIssue {
+	tolerance := inv.RoundingTolerance()
+	mismatch := func(a, b decimal.Decimal) bool {
+		return a.Sub(b).Abs().GreaterThan(tolerance)
+	}
+
+	var findings []ValidationIssue
+	if !inv.SubtotalAmount.IsZero() && !inv.TotalAmount.IsZero() {
+		if expected := inv.SubtotalAmount.Add(inv.TaxAmount); mismatch(expected, inv.TotalAmount) {
+			findings = append(findings, ValidationIssue{
+				Field:    "total_amount",
+				Message:  fmt.Sprintf("subtotal %s + tax %s = %s, but total is %s", inv.SubtotalAmount, inv.TaxAmount, expected, inv.TotalAmount),
+				Severity: SeverityError,
+			})
+		}
+	}
+
+	if len(inv.Items) == 0 || inv.SubtotalAmount.IsZero() {
+		return findings
+	}
+	sum := decimal.Zero
+	for i, item := range inv.Items {
+		if !item.Quantity.IsZero() && !item.UnitPrice.IsZero() && !item.Amount.IsZero() {
+			if expected := item.Quantity.Mul(item.UnitPrice); mismatch(expected, item.Amount) {
+				findings = append(findings, ValidationIssue{
+					Field:    fmt.Sprintf("items[%d].amount", i),
+					Message:  fmt.Sprintf("item %d: quantity %s × unit price %s = %s, but amount is %s", i+1, item.Quantity, item.UnitPrice, expected, item.Amount),
+					Severity: SeverityWarning,
+				})
+			}
+		}
+		sum = sum.Add(item.Amount.Sub(item.DiscountAmt))
+	}
+	if !sum.IsZero() && mismatch(sum, inv.SubtotalAmount) {
+		findings = append(findings, ValidationIssue{
+			Field:    "subtotal_amount",
+			Message:  fmt.Sprintf("line items add up to %s, but subtotal is %s", sum, inv.SubtotalAmount),
+			Severity: SeverityWarning,
+		})
+	}
+	return findings
+}
+
+// legalVATRates are the Vietnamese VAT rates: 0, 5 and 10%, and 8% under
+// the temporary reductions of Decrees 15/2022 and later. Lines outside VAT
+// (KCT, KKKNT) are legal too.
+var legalVATRates = []VATRate{VATRate0, VATRate5, VATRate8, VATRate10}
+
+func checkVATRates(inv *Invoice) []ValidationIssue {
+	var findings []ValidationIssue
+	for i, item := range inv.Items {
+		if item.VATRate.IsTaxable() && !slices.ContainsFunc(legalVATRates, item.VATRate.Equal) {
+			findings = append(findings, ValidationIssue{
+				Field:    fmt.Sprintf("items[%d].vat_rate", i),
+				Message:  fmt.Sprintf("item %d: VAT rate %s is not a legal rate", i+1, item.VATRate),
+				Severity: SeverityError,
+			})
+		}
+	}
+	return findings
+}
+
+// tt78Number is an e-invoice number under TT78: up to 8 digits
+var tt78Number = regexp.MustCompile(`^\d{1,8}$`)
+
+func checkTT78Number(inv *Invoice) []ValidationIssue {
+	if inv.Number == "" || !inv.IsTaxInvoice() || tt78Number.MatchString(inv.Number) {
+		return nil // A missing number is reported by required_fields
+	}
+	return []ValidationIssue{{
+		Field:    "number",
+		Message:  fmt.Sprintf("invoice number %q is not 1 to 8 digits", inv.Number),
+		Severity: SeverityError,
+	}}
+}
+
+// tt78Series is an e-invoice series under TT78: an optional form digit,
+// C (with a tax authority code) or K (without), the year, the kind of
+// invoice and two letters of the seller's choosing
+var tt78Series = regexp.MustCompile(`^[1-6]?[CK](\d{2})[TDLMNBGH][A-Z0-9]{2}$`)
+
+func checkTT78Series(inv *Invoice) []ValidationIssue {
+	if inv.Series == "" || !inv.IsTaxInvoice() {
+		return nil
+	}
+	// Invoices issued before TT78 took effect have series such as AA/20E
+	m := tt78Series.FindStringSubmatch(inv.Series)
+	if m == nil {
+		return []ValidationIssue{{
+			Field:    "series",
+			Message:  fmt.Sprintf("series %q is not a TT78 series", inv.Series),
+			Severity: SeverityWarning,
+		}}
+	}
+	if year, _ := strconv.Atoi(m[1]); !inv.Date.IsZero() && year != inv.Date.Year()%100 {
+		return []ValidationIssue{{
+			Field:    "series",
+			Message:  fmt.Sprintf("series %q is of 20%s, but the invoice is dated %s", inv.Series, m[1], inv.Date.Format(time.DateOnly)),
+			Severity: SeverityWarning,
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func tt78Invoice() *model.Invoice {
+	return &model.Invoice{
+		Number:         "42",
+		Series:         "1C24TAA",
+		Date:           time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Seller:         model.Party{Name: "Công ty TNHH ABC", TaxID: "0123456787"},
+		SubtotalAmount: decimal.NewFromInt(100000),
+		TaxAmount:      decimal.NewFromInt(10000),
+		TotalAmount:    decimal.NewFromInt(110000),
+		Items: []model.LineItem{{
+			Name:      "Giấy A4",
+			Quantity:  decimal.NewFromInt(2),
+			UnitPrice: decimal.NewFromInt(50000),
+			Amount:    decimal.NewFromInt(100000),
+			VATRate:   model.VATRate10,
+		}},
+	}
+}
+
+func issueRules(issues []model.ValidationIssue) []string {
+	rules := make([]string, len(issues))
+	for i, issue := range issues {
+		rules[i] = issue.Rule + ":" + issue.Field
+	}
+	return rules
+}
+
+func TestInvoice_Validate(t *testing.T) {
+	assert.Empty(t, tt78Invoice().Validate())
+
+	inv := tt78Invoice()
+	inv.Number = "AB-0000042"
+	inv.Series = "1C23TAA"
+	inv.Items[0].VATRate = model.VATPercent(7)
+	issues := inv.Validate()
+	assert.Equal(t, []string{"vat_rate:items[0].vat_rate", "number_format:number", "series_format:series"}, issueRules(issues))
+	assert.Equal(t, model.SeverityError, issues[1].Severity)
+	assert.Equal(t, `series "1C23TAA" is of 2023, but the invoice is dated 2024-03-15`, issues[2].Message)
+
+	inv.Series = "AA/20E"
+	inv.Seller.TaxID = "0123456788"
+	assert.Contains(t, inv.Validate()[0].Message, `seller tax ID "0123456788" fails its check digit`)
+	inv.Seller.TaxID = "001085012345" // Personal ID of a household business
+	assert.NotContains(t, issueRules(inv.Validate()), "tax_id:seller.tax_id")
+	assert.Contains(t, issueRules(inv.Validate()), "series_format:series")
+	assert.NotContains(t, issueRules(inv.Validate(model.VietnamRules())), "series_format:series", "pre-TT78 series pass the base rules")
+}
+
+func TestInvoice_ValidateReceipt(t *testing.T) {
+	receipt := &model.Invoice{DocumentType: model.DocumentTypeReceipt, Number: "R-17", TotalAmount: decimal.NewFromInt(45000)}
+	issues := receipt.Validate()
+	require.Len(t, issues, 1, "receipts are not numbered like invoices")
+	assert.Equal(t, "required_fields:date", issueRules(issues)[0])
+}
+
+func TestRuleSet_Compose(t *testing.T) {
+	requirePO := model.ValidationRule{Name: "po", Check: func(inv *model.Invoice) []model.ValidationIssue {
+		if inv.Order == nil {
+			return []model.ValidationIssue{{Field: "order", Message: "missing purchase order", Severity: model.SeverityWarning}}
+		}
+		return nil
+	}}
+	noSeller := model.ValidationRule{Name: model.RuleRequiredFields, Check: func(*model.Invoice) []model.ValidationIssue { return nil }}
+
+	base := model.TT78Rules()
+	rules := base.Without(model.RuleSeriesFormat, model.RuleNumberFormat).With(requirePO, noSeller)
+	require.Len(t, rules, 8)
+	assert.Len(t, base, 9, "sets are not modified")
+	assert.Equal(t, "po", rules[7].Name)
+
+	inv := tt78Invoice()
+	inv.Seller = model.Party{}
+	inv.Series = "bad"
+	assert.Equal(t, []string{"po:order"}, issueRules(inv.Validate(rules)))
+
+	rule, ok := base.Rule(model.RuleTotals)
+	require.True(t, ok)
+	assert.Equal(t, model.RuleTotals, rule.Name)
+	_, ok = base.Rule("po")
+	assert.False(t, ok)
+
+	// Sets run in order
+	assert.Equal(t, []string{"po:order", "required_fields:seller.tax_id", "required_fields:seller.name"}, issueRules(inv.Validate(model.RuleSet{requirePO}, model.VietnamRules())))
+}
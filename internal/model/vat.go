@@ -0,0 +1,167 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// VATCategory is the VAT treatment of a line item without a percentage rate
+type VATCategory string
+
+const (
+	VATCategoryTaxable     VATCategory = ""      // A percentage rate applies
+	VATCategoryNonTaxable  VATCategory = "KCT"   // Không chịu thuế: not subject to VAT
+	VATCategoryNotDeclared VATCategory = "KKKNT" // Không kê khai, tính nộp thuế: not declared or paid
+)
+
+// VATRate is the VAT rate of a line item: a percentage, 0, 5 and 10 or the
+// reduced 8, or a category of lines outside VAT. The zero value is 0%,
+// which unlike KCT is a taxable rate. Percentage rates are written to JSON
+// as numbers, categories as strings.
+type VATRate struct {
+	Percent  decimal.Decimal
+	Category VATCategory
+}
+
+// Vietnam VAT rates
+var (
+	VATRate0     = VATPercent(0)
+	VATRate5     = VATPercent(5)
+	VATRate8     = VATPercent(8) // Reduced rate of Decree 15/2022 and its successors
+	VATRate10    = VATPercent(10)
+	VATRateKCT   = VATRate{Category: VATCategoryNonTaxable}
+	VATRateKKKNT = VATRate{Category: VATCategoryNotDeclared}
+)
+
+// ErrVATRate is the error of rates ParseVATRate can't read
+var ErrVATRate = errors.New("invalid VAT rate")
+
+// VATPercent returns the taxable rate of percent
+func VATPercent(percent int64) VATRate {
+	return VATRate{Percent: decimal.NewFromInt(percent)}
+}
+
+// vatCategoryNames are the ways documents write the categories: TT78 codes,
+// their Vietnamese names, and the -1 and -2 of some providers' XML
+var vatCategoryNames = map[string]VATCategory{
+	"kct":                         VATCategoryNonTaxable,
+	"-1":                          VATCategoryNonTaxable,
+	"không chịu thuế":             VATCategoryNonTaxable,
+	"khong chiu thue":             VATCategoryNonTaxable,
+	"kkknt":                       VATCategoryNotDeclared,
+	"-2":                          VATCategoryNotDeclared,
+	"không kê khai tính nộp thuế": VATCategoryNotDeclared,
+	"khong ke khai tinh nop thue": VATCategoryNotDeclared,
+}
+
+// ParseVATRate reads a VAT rate as documents write it: "10", "8%", "5.0",
+// "KHAC:3.5%" (the other rates of TT78), "KCT", "KKKNT" or their
+// Vietnamese names. Fractions such as 0.1 are not taken for percentages.
+func ParseVATRate(s string) (VATRate, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	normalized := strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }), " ")
+	if category, ok := vatCategoryNames[normalized]; ok {
+		return VATRate{Category: category}, nil
+	}
+	s = strings.TrimPrefix(s, "khac:")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	percent, err := decimal.NewFromString(s)
+	if err != nil || percent.IsNegative() || percent.GreaterThan(decimal.NewFromInt(100)) {
+		return VATRate{}, fmt.Errorf("%w: %q", ErrVATRate, s)
+	}
+	return VATRate{Percent: percent}, nil
+}
+
+// IsTaxable reports whether a percentage rate applies
+func (r VATRate) IsTaxable() bool {
+	return r.Category == VATCategoryTaxable
+}
+
+// IsZero reports whether r is the 0% rate
+func (r VATRate) IsZero() bool {
+	return r.IsTaxable() && r.Percent.IsZero()
+}
+
+// Equal reports whether r and o are the same rate
+func (r VATRate) Equal(o VATRate) bool {
+	return r.Category == o.Category && r.Percent.Equal(o.Percent)
+}
+
+// Tax returns the VAT on base, unrounded; none for lines outside VAT
+func (r VATRate) Tax(base decimal.Decimal) decimal.Decimal {
+	if !r.IsTaxable() {
+		return decimal.Zero
+	}
+	return base.Mul(r.Percent).Shift(-2)
+}
+
+// String renders r as "10%", "KCT" or "KKKNT"
+func (r VATRate) String() string {
+	if !r.IsTaxable() {
+		return string(r.Category)
+	}
+	return r.Percent.String() + "%"
+}
+
+// MarshalJSON writes percentage rates as numbers and categories as strings
+func (r VATRate) MarshalJSON() ([]byte, error) {
+	if !r.IsTaxable() {
+		return json.Marshal(string(r.Category))
+	}
+	return []byte(r.Percent.String()), nil
+}
+
+// JSONSchema describes the JSON of rates: a percentage or a category
+func (VATRate) JSONSchema() map[string]any {
+	return map[string]any{"oneOf": []any{
+		map[string]any{"type": "number", "minimum": 0, "maximum": 100},
+		map[string]any{"type": "string", "enum": []any{string(VATCategoryNonTaxable), string(VATCategoryNotDeclared)}},
+	}}
+}
+
+// UnmarshalJSON reads a number, a string ParseVATRate reads, or null or ""
+// for 0%
+func (r *VATRate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	if s == "" || s == "null" {
+		*r = VATRate{}
+		return nil
+	}
+	rate, err := ParseVATRate(s)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// VATLine is the taxable amount and VAT of the lines of one rate
+type VATLine struct {
+	Rate          VATRate         `json:"rate"`
+	TaxableAmount decimal.Decimal `json:"taxable_amount"` // Amounts net of discounts
+	TaxAmount     decimal.Decimal `json:"tax_amount"`
+}
+
+// SummarizeVAT adds up the taxable amounts and VAT of items per rate, in
+// order of first appearance
+func SummarizeVAT(items []LineItem) []VATLine {
+	var lines []VATLine
+	for _, item := range items {
+		i := slices.IndexFunc(lines, func(l VATLine) bool { return l.Rate.Equal(item.VATRate) })
+		if i < 0 {
+			lines = append(lines, VATLine{Rate: item.VATRate})
+			i = len(lines) - 1
+		}
+		lines[i].TaxableAmount = lines[i].TaxableAmount.Add(item.Amount.Sub(item.DiscountAmt))
+		lines[i].TaxAmount = lines[i].TaxAmount.Add(item.VATAmount)
+	}
+	return lines
+}
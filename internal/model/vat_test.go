@@ -0,0 +1,98 @@
+package model_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestParseVATRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want model.VATRate
+	}{
+		{"10", model.VATRate10},
+		{"8%", model.VATRate8},
+		{" 5.0 % ", model.VATRate5},
+		{"0", model.VATRate0},
+		{"KHAC:3.5%", model.VATRate{Percent: decimal.RequireFromString("3.5")}},
+		{"KCT", model.VATRateKCT},
+		{"-1", model.VATRateKCT},
+		{"Không chịu thuế", model.VATRateKCT},
+		{"kkknt", model.VATRateKKKNT},
+		{"Không kê khai, tính nộp thuế", model.VATRateKKKNT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rate, err := model.ParseVATRate(tt.in)
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(rate), "got %s", rate)
+		})
+	}
+
+	for _, in := range []string{"", "ten", "-5", "120%"} {
+		_, err := model.ParseVATRate(in)
+		assert.ErrorIs(t, err, model.ErrVATRate, in)
+	}
+}
+
+func TestVATRate_Tax(t *testing.T) {
+	base := decimal.NewFromInt(1000000)
+	assert.True(t, decimal.NewFromInt(80000).Equal(model.VATRate8.Tax(base)))
+	assert.True(t, model.VATRateKCT.Tax(base).IsZero())
+	assert.True(t, model.VATRate0.IsZero())
+	assert.False(t, model.VATRateKCT.IsZero(), "KCT is not the 0% rate")
+
+	item := model.LineItem{Quantity: decimal.NewFromInt(1), UnitPrice: base, VATRate: model.VATRateKKKNT}
+	item.Calculate()
+	assert.True(t, item.VATAmount.IsZero())
+	assert.True(t, base.Equal(item.Total))
+}
+
+func TestVATRate_JSON(t *testing.T) {
+	items := []model.LineItem{{VATRate: model.VATRate8}, {VATRate: model.VATRateKCT}}
+	data, err := json.Marshal(items)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"vat_rate":8,`)
+	assert.Contains(t, string(data), `"vat_rate":"KCT",`)
+
+	var decoded []model.LineItem
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.True(t, model.VATRate8.Equal(decoded[0].VATRate))
+	assert.True(t, model.VATRateKCT.Equal(decoded[1].VATRate))
+
+	var item model.LineItem
+	require.NoError(t, json.Unmarshal([]byte(`{"vat_rate":"10%"}`), &item))
+	assert.True(t, model.VATRate10.Equal(item.VATRate))
+	require.NoError(t, json.Unmarshal([]byte(`{"vat_rate":null}`), &item))
+	assert.True(t, item.VATRate.IsZero())
+	assert.Error(t, json.Unmarshal([]byte(`{"vat_rate":"ten"}`), &item))
+}
+
+func TestInvoice_TaxBreakdown(t *testing.T) {
+	inv := &model.Invoice{Items: []model.LineItem{
+		{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(100000), VATRate: model.VATRate10},
+		{Quantity: decimal.NewFromInt(2), UnitPrice: decimal.NewFromInt(50000), VATRate: model.VATRate8},
+		{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(200000), Discount: decimal.NewFromInt(10), VATRate: model.VATRate10},
+		{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(30000), VATRate: model.VATRateKCT},
+	}}
+	inv.CalculateTotals()
+
+	require.Len(t, inv.TaxBreakdown, 3)
+	assert.True(t, model.VATRate10.Equal(inv.TaxBreakdown[0].Rate))
+	assert.True(t, decimal.NewFromInt(280000).Equal(inv.TaxBreakdown[0].TaxableAmount), "net of discounts")
+	assert.True(t, decimal.NewFromInt(28000).Equal(inv.TaxBreakdown[0].TaxAmount))
+	assert.True(t, model.VATRate8.Equal(inv.TaxBreakdown[1].Rate))
+	assert.True(t, decimal.NewFromInt(8000).Equal(inv.TaxBreakdown[1].TaxAmount))
+	assert.True(t, model.VATRateKCT.Equal(inv.TaxBreakdown[2].Rate))
+	assert.True(t, inv.TaxBreakdown[2].TaxAmount.IsZero())
+
+	data, err := json.Marshal(inv.TaxBreakdown[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"rate":8,"taxable_amount":"100000","tax_amount":"8000"}`, string(data))
+}
@@ -0,0 +1,159 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// azureVersion is the Blob service API version requested
+const azureVersion = "2021-08-06"
+
+// AzureBucket is a Bucket on an Azure Blob Storage container, authorized
+// with a shared access signature
+type AzureBucket struct {
+	container  *url.URL
+	sas        url.Values
+	httpClient *http.Client
+}
+
+// NewAzureBucket returns the container at containerURL, e.g.
+// https://account.blob.core.windows.net/invoices?sv=...&sig=..., whose SAS
+// token must allow list, read, write and create
+func NewAzureBucket(containerURL string, httpClient *http.Client) (*AzureBucket, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid Azure container URL")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+	sas := u.Query()
+	u.RawQuery = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return &AzureBucket{container: u, sas: sas, httpClient: httpClient}, nil
+}
+
+type azureListResult struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string `xml:"Name"`
+			Properties struct {
+				ContentLength int64  `xml:"Content-Length"`
+				LastModified  string `xml:"Last-Modified"`
+			} `xml:"Properties"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// Walk lists the blobs under prefix page by page. The service has no
+// start-after, so the blobs up to the given key are listed and skipped.
+func (b *AzureBucket) Walk(ctx context.Context, prefix, after string, fn func(Object) error) error {
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return err
+		}
+		var page azureListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid Azure list response: %w", err)
+		}
+
+		for _, blob := range page.Blobs.Blob {
+			if blob.Name <= after {
+				continue
+			}
+			modified, _ := time.Parse(time.RFC1123, blob.Properties.LastModified)
+			if err := fn(Object{Key: blob.Name, Size: blob.Properties.ContentLength, LastModified: modified}); err != nil {
+				return err
+			}
+		}
+		if page.NextMarker == "" {
+			return nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// Get reads a blob
+func (b *AzureBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put writes a block blob
+func (b *AzureBucket) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := b.do(ctx, http.MethodPut, key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request for a blob ("" = the container) and returns a
+// successful response
+func (b *AzureBucket) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := *b.container
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath = b.container.EscapedPath() + "/" + escapePath(key)
+	}
+	q := url.Values{}
+	for k, v := range b.sas {
+		q[k] = v
+	}
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureVersion)
+	if method == http.MethodPut {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Azure %s %s failed: %w", method, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	var apiErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	return nil, fmt.Errorf("Azure %s %s returned %s: %s", method, key, resp.Status, strings.TrimSpace(apiErr.Code+" "+strings.SplitN(apiErr.Message, "\n", 2)[0]))
+}
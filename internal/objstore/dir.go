@@ -0,0 +1,77 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirBucket is a Bucket on a local directory, with slash-separated paths
+// as keys, for local backfills and tests
+type DirBucket string
+
+// Walk visits the files under prefix after the given key
+func (d DirBucket) Walk(ctx context.Context, prefix, after string, fn func(Object) error) error {
+	var objects []Object
+	err := filepath.WalkDir(string(d), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(string(d), p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || key <= after || strings.HasSuffix(key, ".tmp") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// WalkDir orders by name within each directory; keys sort across them
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, obj := range objects {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get reads a file
+func (d DirBucket) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes a file, creating its directories, through a temporary file
+func (d DirBucket) Put(_ context.Context, key string, data []byte, _ string) error {
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (d DirBucket) path(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(key))
+}
@@ -0,0 +1,253 @@
+// Package objstore pulls documents from object storage prefixes (S3, GCS,
+// Azure Blob) and writes their results back, checkpointing progress so an
+// interrupted backfill resumes where it stopped
+package objstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// ErrNotFound is returned by Get for a missing object
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Bucket reads and writes objects. Walk visits keys in lexicographic
+// order, as all three services list them.
+type Bucket interface {
+	// Walk calls fn for each object under prefix with a key after the
+	// given one ("" = from the start) until fn returns an error
+	Walk(ctx context.Context, prefix, after string, fn func(Object) error) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+}
+
+// Checkpoint remembers the last key a backfill finished
+type Checkpoint interface {
+	Load(ctx context.Context) (string, error) // "" when there is none
+	Save(ctx context.Context, key string) error
+}
+
+// Suffixes of the objects written by a backfill
+const (
+	ResultSuffix  = ".result.json"
+	InvoiceSuffix = ".invoice.json"
+)
+
+// Config configures a Backfill
+type Config struct {
+	Prefix string // Documents to process
+
+	// OutputPrefix is where results are written: the result of
+	// "in/a.pdf" under Prefix "in/" goes to OutputPrefix+"a.pdf"+ResultSuffix
+	OutputPrefix string
+
+	// WriteInvoices also writes each extracted invoice on its own, as
+	// OutputPrefix+key+InvoiceSuffix (with "-2", "-3"... before the suffix
+	// for archives holding several)
+	WriteInvoices bool
+
+	// Checkpoint records progress after each document (nil = start over on
+	// every run)
+	Checkpoint Checkpoint
+
+	Timeout        time.Duration // Per-document processing timeout (0 = none)
+	SplitDocuments bool          // See processor.ProcessOptions.SplitDocuments
+}
+
+// Summary counts the documents of a backfill run
+type Summary struct {
+	Objects   int // Objects processed in this run
+	Succeeded int // Documents with an invoice
+	Failed    int
+	Skipped   int    // Archive members and attachments that are not invoices
+	LastKey   string // Last object finished
+}
+
+// ObjectResult is the JSON written for each object
+type ObjectResult struct {
+	Key     string                     `json:"key"`
+	Results []*processor.EncodedResult `json:"results"`
+}
+
+// Backfill processes the documents under a prefix of one bucket and writes
+// the results to another (or the same, under another prefix)
+type Backfill struct {
+	pipeline *processor.Pipeline
+	src, dst Bucket
+	cfg      Config
+}
+
+// NewBackfill returns a backfill from src to dst
+func NewBackfill(pipeline *processor.Pipeline, src, dst Bucket, cfg Config) (*Backfill, error) {
+	if src == nil || dst == nil {
+		return nil, errors.New("source and destination buckets are required")
+	}
+	if src == dst && strings.HasPrefix(cfg.OutputPrefix, cfg.Prefix) {
+		return nil, errors.New("output prefix must not be inside the input prefix")
+	}
+	return &Backfill{pipeline: pipeline, src: src, dst: dst, cfg: cfg}, nil
+}
+
+// Run processes the objects after the checkpoint in key order until they
+// run out or ctx is canceled. Failed documents are written as results;
+// storage errors stop the run, and the next one retries the object. The
+// object in flight when ctx is canceled is finished, unless the pipeline is
+// stopped first (see processor.Pipeline.Stop), which leaves it to the next run.
+// LLM calls wait in the batch lane (see llm.Priority) unless ctx sets one.
+func (b *Backfill) Run(ctx context.Context) (*Summary, error) {
+	if _, ok := llm.PriorityFromContext(ctx); !ok {
+		ctx = llm.ContextWithPriority(ctx, llm.PriorityBatch)
+	}
+	summary := &Summary{}
+	after := ""
+	if b.cfg.Checkpoint != nil {
+		var err error
+		if after, err = b.cfg.Checkpoint.Load(ctx); err != nil {
+			return summary, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+	}
+
+	work := context.WithoutCancel(ctx)
+	err := b.src.Walk(ctx, b.cfg.Prefix, after, func(obj Object) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasSuffix(obj.Key, "/") || strings.HasSuffix(obj.Key, ResultSuffix) || strings.HasSuffix(obj.Key, InvoiceSuffix) {
+			return nil // Folder placeholder or the output of a backfill
+		}
+		if err := b.process(work, obj, summary); err != nil {
+			return err
+		}
+		summary.Objects++
+		summary.LastKey = obj.Key
+		if b.cfg.Checkpoint != nil {
+			if err := b.cfg.Checkpoint.Save(work, obj.Key); err != nil {
+				return fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// process runs one object through the pipeline and writes its results
+func (b *Backfill) process(ctx context.Context, obj Object, summary *Summary) error {
+	data, err := b.src.Get(ctx, obj.Key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", obj.Key, err)
+	}
+
+	docCtx := llm.ContextWithDocumentID(ctx, obj.Key)
+	if b.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		docCtx, cancel = context.WithTimeout(docCtx, b.cfg.Timeout)
+		defer cancel()
+	}
+	results := b.pipeline.Process(docCtx, data, processor.ProcessOptions{Filename: path.Base(obj.Key), SplitDocuments: b.cfg.SplitDocuments})
+	for _, r := range results {
+		if errors.Is(r.Error, processor.ErrStopped) {
+			return fmt.Errorf("%s: %w", obj.Key, r.Error)
+		}
+	}
+
+	out := ObjectResult{Key: obj.Key, Results: make([]*processor.EncodedResult, len(results))}
+	invoices := 0
+	for i, r := range results {
+		out.Results[i] = r.Encode()
+		switch {
+		case out.Results[i].Skipped:
+			summary.Skipped++
+		case r.Error != nil:
+			summary.Failed++
+		default:
+			summary.Succeeded++
+		}
+		if r.Error != nil || r.Invoice == nil || !b.cfg.WriteInvoices {
+			continue
+		}
+		invoices++
+		key := b.outputKey(obj.Key)
+		if invoices > 1 {
+			key = fmt.Sprintf("%s-%d", key, invoices)
+		}
+		if err := b.putJSON(ctx, key+InvoiceSuffix, r.Invoice); err != nil {
+			return err
+		}
+	}
+	return b.putJSON(ctx, b.outputKey(obj.Key)+ResultSuffix, out)
+}
+
+// outputKey maps an input key to its output key, before the suffix
+func (b *Backfill) outputKey(key string) string {
+	return b.cfg.OutputPrefix + strings.TrimPrefix(key, b.cfg.Prefix)
+}
+
+func (b *Backfill) putJSON(ctx context.Context, key string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if err := b.dst.Put(ctx, key, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// FileCheckpoint keeps the checkpoint in a local file
+type FileCheckpoint string
+
+// Load reads the checkpoint
+func (f FileCheckpoint) Load(context.Context) (string, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// Save replaces the checkpoint, through a temporary file so a crash leaves
+// the old one
+func (f FileCheckpoint) Save(_ context.Context, key string) error {
+	tmp := string(f) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(key+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
+
+// BucketCheckpoint keeps the checkpoint in an object, for backfills run
+// where there is no persistent disk
+type BucketCheckpoint struct {
+	Bucket Bucket
+	Key    string
+}
+
+// Load reads the checkpoint
+func (c BucketCheckpoint) Load(ctx context.Context) (string, error) {
+	data, err := c.Bucket.Get(ctx, c.Key)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// Save replaces the checkpoint
+func (c BucketCheckpoint) Save(ctx context.Context, key string) error {
+	return c.Bucket.Put(ctx, c.Key, []byte(key+"\n"), "text/plain")
+}
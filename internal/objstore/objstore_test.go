@@ -0,0 +1,175 @@
+package objstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/objstore"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+// stopAfter fails the checkpoint save after n objects, like a crash
+type stopAfter struct {
+	objstore.FileCheckpoint
+	n int
+}
+
+func (s *stopAfter) Save(ctx context.Context, key string) error {
+	if s.n == 0 {
+		return errors.New("interrupted")
+	}
+	s.n--
+	return s.FileCheckpoint.Save(ctx, key)
+}
+
+func newBuckets(t *testing.T, files map[string]string) (src, dst objstore.DirBucket) {
+	t.Helper()
+	src, dst = objstore.DirBucket(t.TempDir()), objstore.DirBucket(t.TempDir())
+	for key, content := range files {
+		require.NoError(t, src.Put(context.Background(), key, []byte(content), ""))
+	}
+	return src, dst
+}
+
+func readResult(t *testing.T, dst objstore.DirBucket, key string) objstore.ObjectResult {
+	t.Helper()
+	data, err := dst.Get(context.Background(), key)
+	require.NoError(t, err)
+	var out objstore.ObjectResult
+	require.NoError(t, json.Unmarshal(data, &out))
+	return out
+}
+
+func TestBackfill_WritesResults(t *testing.T) {
+	src, dst := newBuckets(t, map[string]string{
+		"in/2024/a.xml": invoiceXML,
+		"in/2024/b.txt": "not an invoice",
+		"other/c.xml":   invoiceXML,
+	})
+
+	backfill, err := objstore.NewBackfill(processor.NewPipeline(), src, dst, objstore.Config{
+		Prefix:        "in/",
+		OutputPrefix:  "out/",
+		WriteInvoices: true,
+	})
+	require.NoError(t, err)
+
+	summary, err := backfill.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Objects)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, "in/2024/b.txt", summary.LastKey)
+
+	ok := readResult(t, dst, "out/2024/a.xml"+objstore.ResultSuffix)
+	assert.Equal(t, "in/2024/a.xml", ok.Key)
+	require.Len(t, ok.Results, 1)
+	assert.Empty(t, ok.Results[0].Error)
+	assert.Equal(t, "0000042", ok.Results[0].Invoice.Number)
+
+	failed := readResult(t, dst, "out/2024/b.txt"+objstore.ResultSuffix)
+	require.Len(t, failed.Results, 1)
+	assert.NotEmpty(t, failed.Results[0].Error)
+
+	data, err := dst.Get(context.Background(), "out/2024/a.xml"+objstore.InvoiceSuffix)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "0123456789")
+	_, err = dst.Get(context.Background(), "out/2024/b.txt"+objstore.InvoiceSuffix)
+	assert.ErrorIs(t, err, objstore.ErrNotFound)
+	_, err = dst.Get(context.Background(), "out/c.xml"+objstore.ResultSuffix)
+	assert.ErrorIs(t, err, objstore.ErrNotFound)
+}
+
+func TestBackfill_ResumesFromCheckpoint(t *testing.T) {
+	src, dst := newBuckets(t, map[string]string{
+		"a.xml": invoiceXML,
+		"b.xml": invoiceXML,
+		"c.xml": invoiceXML,
+	})
+	checkpoint := objstore.FileCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+	cfg := objstore.Config{OutputPrefix: "results/", Checkpoint: &stopAfter{FileCheckpoint: checkpoint, n: 1}}
+
+	backfill, err := objstore.NewBackfill(processor.NewPipeline(), src, dst, cfg)
+	require.NoError(t, err)
+	summary, err := backfill.Run(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, 2, summary.Objects)
+
+	saved, err := checkpoint.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "a.xml", saved)
+
+	// b.xml was written but not checkpointed, so it is processed again
+	cfg.Checkpoint = checkpoint
+	backfill, err = objstore.NewBackfill(processor.NewPipeline(), src, dst, cfg)
+	require.NoError(t, err)
+	summary, err = backfill.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Objects)
+	assert.Equal(t, "c.xml", summary.LastKey)
+
+	for _, key := range []string{"a.xml", "b.xml", "c.xml"} {
+		_, err := os.Stat(filepath.Join(string(dst), "results", key+objstore.ResultSuffix))
+		assert.NoError(t, err, key)
+	}
+
+	// Nothing left after the checkpoint
+	summary, err = backfill.Run(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, summary.Objects)
+}
+
+func TestBackfill_StoppedPipeline(t *testing.T) {
+	src, dst := newBuckets(t, map[string]string{"a.xml": invoiceXML})
+	checkpoint := objstore.FileCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+
+	p := processor.NewPipeline()
+	require.NoError(t, p.Stop(context.Background()))
+	backfill, err := objstore.NewBackfill(p, src, dst, objstore.Config{OutputPrefix: "results/", Checkpoint: checkpoint})
+	require.NoError(t, err)
+	summary, err := backfill.Run(context.Background())
+	assert.ErrorIs(t, err, processor.ErrStopped)
+	assert.Zero(t, summary.Objects)
+
+	saved, err := checkpoint.Load(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, saved, "left for the next run")
+	_, err = os.Stat(filepath.Join(string(dst), "results", "a.xml"+objstore.ResultSuffix))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBackfill_BucketCheckpoint(t *testing.T) {
+	src, dst := newBuckets(t, map[string]string{"in/a.xml": invoiceXML})
+	checkpoint := objstore.BucketCheckpoint{Bucket: dst, Key: "checkpoints/in"}
+
+	backfill, err := objstore.NewBackfill(processor.NewPipeline(), src, dst, objstore.Config{Prefix: "in/", Checkpoint: checkpoint})
+	require.NoError(t, err)
+	_, err = backfill.Run(context.Background())
+	require.NoError(t, err)
+
+	saved, err := checkpoint.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "in/a.xml", saved)
+}
+
+func TestNewBackfill_RejectsOutputInsideInput(t *testing.T) {
+	bucket := objstore.DirBucket(t.TempDir())
+	_, err := objstore.NewBackfill(processor.NewPipeline(), bucket, bucket, objstore.Config{Prefix: "in/", OutputPrefix: "in/results/"})
+	assert.Error(t, err)
+
+	_, err = objstore.NewBackfill(processor.NewPipeline(), bucket, bucket, objstore.Config{Prefix: "in/", OutputPrefix: "out/"})
+	assert.NoError(t, err)
+}
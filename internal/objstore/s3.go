@@ -0,0 +1,194 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// S3Config configures an S3Bucket.
+// Empty credentials and region are read from the standard AWS environment variables.
+type S3Config struct {
+	Bucket      string
+	Region      string
+	Credentials sigv4.Credentials
+
+	// Endpoint of an S3-compatible service, such as MinIO or GCS (default:
+	// https://s3.<region>.amazonaws.com). Buckets are addressed by path.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// S3Bucket is a Bucket on Amazon S3 or an S3-compatible service, using its
+// REST API
+type S3Bucket struct {
+	endpoint   *url.URL
+	bucket     string
+	signer     *sigv4.Signer
+	httpClient *http.Client
+}
+
+// NewS3Bucket returns the bucket cfg.Bucket
+func NewS3Bucket(cfg S3Config) (*S3Bucket, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket name is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = sigv4.RegionFromEnv()
+	}
+	if cfg.Credentials.AccessKeyID == "" {
+		cfg.Credentials = sigv4.CredentialsFromEnv()
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+	return &S3Bucket{
+		endpoint:   endpoint,
+		bucket:     cfg.Bucket,
+		signer:     sigv4.NewSigner(cfg.Credentials, cfg.Region, "s3"),
+		httpClient: cfg.HTTPClient,
+	}, nil
+}
+
+// NewGCSBucket returns a Google Cloud Storage bucket through its
+// S3-compatible XML API, with HMAC keys of a service account
+func NewGCSBucket(bucket, accessKey, secret string) (*S3Bucket, error) {
+	return NewS3Bucket(S3Config{
+		Bucket:      bucket,
+		Region:      "auto",
+		Credentials: sigv4.Credentials{AccessKeyID: accessKey, SecretAccessKey: secret},
+		Endpoint:    "https://storage.googleapis.com",
+	})
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Walk lists the objects under prefix page by page (ListObjectsV2)
+func (b *S3Bucket) Walk(ctx context.Context, prefix, after string, fn func(Object) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		} else if after != "" {
+			query.Set("start-after", after)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return err
+		}
+		var page s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid S3 list response: %w", err)
+		}
+
+		for _, c := range page.Contents {
+			if err := fn(Object{Key: c.Key, Size: c.Size, LastModified: c.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Get reads an object
+func (b *S3Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put writes an object
+func (b *S3Bucket) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := b.do(ctx, http.MethodPut, key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for an object ("" = the bucket) and returns a
+// successful response
+func (b *S3Bucket) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = u.Path + "/" + b.bucket + "/" + key
+	u.RawPath = b.endpoint.EscapedPath() + "/" + escapePath(b.bucket) + "/" + escapePath(key)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err := b.signer.Sign(req, body); err != nil {
+		return nil, err
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s %s failed: %w", method, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	var apiErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	return nil, fmt.Errorf("S3 %s %s returned %s: %s", method, key, resp.Status, strings.TrimSpace(apiErr.Code+" "+apiErr.Message))
+}
+
+// escapePath escapes a key as S3 signs it: every byte but unreserved
+// characters and slashes
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
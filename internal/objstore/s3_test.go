@@ -0,0 +1,208 @@
+package objstore_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/objstore"
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// fakeStore holds objects for the fake S3 and Azure servers
+type fakeStore struct {
+	objects map[string]string
+	paths   []string
+}
+
+func (f *fakeStore) keys(prefix, after string) []string {
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveObject handles GET and PUT of an object
+func (f *fakeStore) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(data))
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = string(data)
+	}
+}
+
+// s3 answers the S3 REST API for bucket "docs", one object per page
+func (f *fakeStore) s3(w http.ResponseWriter, r *http.Request) {
+	f.paths = append(f.paths, r.URL.EscapedPath())
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/docs/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if key != "" {
+		f.serveObject(w, r, key)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+	keys := f.keys(q.Get("prefix"), after)
+	fmt.Fprint(w, `<ListBucketResult>`)
+	if len(keys) > 0 {
+		fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2024-05-01T10:00:00.000Z</LastModified></Contents>`,
+			keys[0], len(f.objects[keys[0]]))
+	}
+	if len(keys) > 1 {
+		fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>`, keys[0])
+	}
+	fmt.Fprint(w, `</ListBucketResult>`)
+}
+
+// azure answers the Blob service API for container "docs", one blob per page
+func (f *fakeStore) azure(w http.ResponseWriter, r *http.Request) {
+	f.paths = append(f.paths, r.URL.EscapedPath())
+	q := r.URL.Query()
+	if q.Get("sig") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/docs" && q.Get("comp") == "list" {
+		keys := f.keys(q.Get("prefix"), q.Get("marker"))
+		fmt.Fprint(w, `<EnumerationResults><Blobs>`)
+		if len(keys) > 0 {
+			fmt.Fprintf(w, `<Blob><Name>%s</Name><Properties><Last-Modified>Wed, 01 May 2024 10:00:00 GMT</Last-Modified>`+
+				`<Content-Length>%d</Content-Length></Properties></Blob>`, keys[0], len(f.objects[keys[0]]))
+		}
+		fmt.Fprint(w, `</Blobs>`)
+		if len(keys) > 1 {
+			// Markers are opaque; this one happens to be the last name listed
+			fmt.Fprintf(w, `<NextMarker>%s</NextMarker>`, keys[0])
+		}
+		fmt.Fprint(w, `</EnumerationResults>`)
+		return
+	}
+	if r.Method == http.MethodPut && r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.serveObject(w, r, strings.TrimPrefix(r.URL.Path, "/docs/"))
+}
+
+func walkKeys(t *testing.T, bucket objstore.Bucket, prefix, after string) []string {
+	t.Helper()
+	var keys []string
+	require.NoError(t, bucket.Walk(context.Background(), prefix, after, func(obj objstore.Object) error {
+		assert.NotZero(t, obj.Size)
+		assert.False(t, obj.LastModified.IsZero())
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	return keys
+}
+
+func testBucket(t *testing.T, fake *fakeStore, bucket objstore.Bucket) {
+	ctx := context.Background()
+	assert.Equal(t, []string{"in/a.xml", "in/b c.xml", "in/d.xml"}, walkKeys(t, bucket, "in/", ""))
+	assert.Equal(t, []string{"in/d.xml"}, walkKeys(t, bucket, "in/", "in/b c.xml"))
+
+	data, err := bucket.Get(ctx, "in/b c.xml")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+	assert.Contains(t, fake.paths, "/docs/in/b%20c.xml")
+
+	require.NoError(t, bucket.Put(ctx, "out/a.xml.result.json", []byte(`{}`), "application/json"))
+	assert.Equal(t, `{}`, fake.objects["out/a.xml.result.json"])
+
+	_, err = bucket.Get(ctx, "in/missing.xml")
+	assert.ErrorIs(t, err, objstore.ErrNotFound)
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: map[string]string{
+		"in/a.xml":    "a",
+		"in/b c.xml":  "b",
+		"in/d.xml":    "d",
+		"other/e.xml": "e",
+		"in.txt":      "f",
+	}}
+}
+
+func TestS3Bucket(t *testing.T) {
+	fake := newFakeStore()
+	srv := httptest.NewServer(http.HandlerFunc(fake.s3))
+	defer srv.Close()
+
+	bucket, err := objstore.NewS3Bucket(objstore.S3Config{
+		Bucket:      "docs",
+		Region:      "ap-southeast-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Endpoint:    srv.URL,
+	})
+	require.NoError(t, err)
+	testBucket(t, fake, bucket)
+}
+
+func TestS3Bucket_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	bucket, err := objstore.NewS3Bucket(objstore.S3Config{
+		Bucket:      "docs",
+		Region:      "us-east-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Endpoint:    srv.URL,
+	})
+	require.NoError(t, err)
+	err = bucket.Walk(context.Background(), "", "", func(objstore.Object) error { return nil })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+
+	_, err = objstore.NewS3Bucket(objstore.S3Config{})
+	assert.Error(t, err)
+}
+
+func TestAzureBucket(t *testing.T) {
+	fake := newFakeStore()
+	srv := httptest.NewServer(http.HandlerFunc(fake.azure))
+	defer srv.Close()
+
+	bucket, err := objstore.NewAzureBucket(srv.URL+"/docs?sv=2021-08-06&sig=secret", nil)
+	require.NoError(t, err)
+	testBucket(t, fake, bucket)
+
+	_, err = objstore.NewAzureBucket("https://account.blob.core.windows.net/", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+// Package outbox records an append-only stream of invoice events as
+// documents are processed, and relays it to a publisher, so downstream
+// systems such as an ERP sync consume every change in order, at least once
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Event types
+const (
+	EventExtracted         = "invoice.extracted"
+	EventValidated         = "invoice.validated"
+	EventDuplicateDetected = "invoice.duplicate_detected"
+	EventCancelled         = "invoice.cancelled" // An invoice replaced by a later one
+)
+
+// Event is one entry of the stream
+type Event struct {
+	Sequence      int64     `json:"sequence"` // Position in the stream, from 1, set by Store.Append
+	ID            string    `json:"id"`       // Unique, for consumers to drop redeliveries
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	Tenant        string    `json:"tenant,omitempty"`
+	DocumentID    string    `json:"document_id,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Fingerprint   string    `json:"fingerprint,omitempty"` // See processor.Fingerprint
+
+	// Invoice is the extracted invoice, on invoice.extracted
+	Invoice *model.Invoice `json:"invoice,omitempty"`
+
+	// Valid and Findings are the outcome of the validation stage, on
+	// invoice.validated; Valid is false when a finding is an error
+	Valid    *bool                         `json:"valid,omitempty"`
+	Findings []processor.ValidationFinding `json:"findings,omitempty"`
+
+	// DuplicateOf is the document the invoice was first seen in, on
+	// invoice.duplicate_detected
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// Cancelled is the invoice a replacement invoice voids, with the
+	// replacement's seller, on invoice.cancelled
+	Cancelled   *model.InvoiceReference `json:"cancelled,omitempty"`
+	SellerTaxID string                  `json:"seller_tax_id,omitempty"`
+}
+
+// Store is the append-only log events are kept in. Implementations must be
+// safe for concurrent use.
+type Store interface {
+	// Append adds events at the end of the stream, numbering them
+	Append(ctx context.Context, events ...*Event) error
+	// Read returns up to limit events with a sequence after the given one,
+	// in order
+	Read(ctx context.Context, after int64, limit int) ([]*Event, error)
+}
+
+// Outbox records the events of the documents of a pipeline in a Store
+type Outbox struct {
+	store Store
+}
+
+// New returns an outbox appending to store
+func New(store Store) *Outbox {
+	return &Outbox{store: store}
+}
+
+// Hooks returns pipeline hooks recording the events of every extracted
+// invoice once it is validated. A document whose events can't be recorded
+// fails, so it is retried rather than missing from the stream. Idempotent
+// replays record nothing.
+func (o *Outbox) Hooks() processor.Hooks {
+	return processor.Hooks{
+		OnValidated: func(ctx context.Context, result *processor.Result) error {
+			events := Events(ctx, result)
+			if len(events) == 0 {
+				return nil
+			}
+			if err := o.store.Append(ctx, events...); err != nil {
+				return fmt.Errorf("failed to record invoice events: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// Events returns the events of a validated result: invoice.extracted and
+// invoice.validated, then invoice.duplicate_detected for a duplicate and
+// invoice.cancelled for a replacement invoice naming the one it voids
+func Events(ctx context.Context, result *processor.Result) []*Event {
+	if result.Invoice == nil || result.Error != nil || result.IdempotentReplay {
+		return nil
+	}
+	now := time.Now().UTC()
+	event := func(typ string) *Event {
+		return &Event{
+			ID:            newID(),
+			Type:          typ,
+			Time:          now,
+			Tenant:        processor.TenantFromContext(ctx),
+			DocumentID:    llm.DocumentIDFromContext(ctx),
+			CorrelationID: logging.CorrelationID(ctx),
+			Fingerprint:   result.Fingerprint,
+		}
+	}
+
+	extracted := event(EventExtracted)
+	extracted.Invoice = result.Invoice
+
+	valid := true
+	for _, f := range result.Findings {
+		valid = valid && f.Severity != processor.SeverityError
+	}
+	validated := event(EventValidated)
+	validated.Valid = &valid
+	validated.Findings = result.Findings
+
+	events := []*Event{extracted, validated}
+	if result.Duplicate {
+		duplicate := event(EventDuplicateDetected)
+		duplicate.DuplicateOf = result.DuplicateOf
+		events = append(events, duplicate)
+	}
+	if inv := result.Invoice; inv.Type == model.InvoiceTypeReplacement && inv.OriginalInvoice != nil {
+		cancelled := event(EventCancelled)
+		cancelled.Cancelled = inv.OriginalInvoice
+		cancelled.SellerTaxID = inv.Seller.TaxID
+		events = append(events, cancelled)
+	}
+	return events
+}
+
+// newID returns a random 128-bit hex ID
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
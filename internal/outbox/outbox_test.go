@@ -0,0 +1,106 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+func types(events []*outbox.Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func TestOutbox_Hooks(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	p := processor.NewPipeline(
+		processor.WithValidation(true),
+		processor.WithDuplicateStore(processor.NewMemoryDuplicateStore()),
+		processor.WithHooks(outbox.New(store).Hooks()),
+	)
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "doc-1")
+	require.NoError(t, p.ProcessXMLBytes(ctx, []byte(invoiceXML)).Error)
+	ctx = llm.ContextWithDocumentID(context.Background(), "doc-2")
+	require.NoError(t, p.ProcessXMLBytes(ctx, []byte(invoiceXML)).Error)
+
+	events, err := store.Read(context.Background(), 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		outbox.EventExtracted, outbox.EventValidated,
+		outbox.EventExtracted, outbox.EventValidated, outbox.EventDuplicateDetected,
+	}, types(events))
+
+	ids := make(map[string]bool)
+	for i, e := range events {
+		assert.Equal(t, int64(i+1), e.Sequence)
+		assert.NotEmpty(t, e.Fingerprint)
+		ids[e.ID] = true
+	}
+	assert.Len(t, ids, len(events), "event IDs are unique")
+
+	assert.Equal(t, "doc-1", events[0].DocumentID)
+	require.NotNil(t, events[0].Invoice)
+	assert.Equal(t, "0000042", events[0].Invoice.Number)
+	require.NotNil(t, events[1].Valid)
+	assert.Equal(t, "doc-2", events[4].DocumentID)
+	assert.Equal(t, "doc-1", events[4].DuplicateOf)
+
+	after, err := store.Read(context.Background(), 3, 1)
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+	assert.Equal(t, int64(4), after[0].Sequence)
+}
+
+type failingStore struct{ outbox.Store }
+
+func (failingStore) Append(context.Context, ...*outbox.Event) error {
+	return errors.New("disk full")
+}
+
+func TestOutbox_AppendFailureFailsDocument(t *testing.T) {
+	p := processor.NewPipeline(processor.WithHooks(outbox.New(failingStore{}).Hooks()))
+
+	result := p.ProcessXMLBytes(context.Background(), []byte(invoiceXML))
+	assert.ErrorContains(t, result.Error, "failed to record invoice events: disk full")
+}
+
+func TestEvents(t *testing.T) {
+	ctx := processor.ContextWithTenant(context.Background(), "acme")
+	invoice := &model.Invoice{
+		Number:          "0000043",
+		Type:            model.InvoiceTypeReplacement,
+		Seller:          model.Party{TaxID: "0123456789"},
+		OriginalInvoice: &model.InvoiceReference{Number: "0000042", Series: "1C24TAA"},
+	}
+	findings := []processor.ValidationFinding{{Rule: "total_mismatch", Message: "totals differ", Severity: processor.SeverityError}}
+
+	events := outbox.Events(ctx, &processor.Result{Invoice: invoice, Findings: findings})
+	assert.Equal(t, []string{outbox.EventExtracted, outbox.EventValidated, outbox.EventCancelled}, types(events))
+	assert.Equal(t, "acme", events[0].Tenant)
+	require.NotNil(t, events[1].Valid)
+	assert.False(t, *events[1].Valid)
+	assert.Equal(t, findings, events[1].Findings)
+	assert.Equal(t, "0000042", events[2].Cancelled.Number)
+	assert.Equal(t, "0123456789", events[2].SellerTaxID)
+
+	assert.Empty(t, outbox.Events(ctx, &processor.Result{Invoice: invoice, IdempotentReplay: true}))
+	assert.Empty(t, outbox.Events(ctx, &processor.Result{Error: errors.New("unreadable")}))
+}
@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+// Defaults for RelayConfig
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+)
+
+// Publisher delivers events downstream
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// PublisherFunc adapts a function to Publisher
+type PublisherFunc func(ctx context.Context, event *Event) error
+
+// Publish calls f
+func (f PublisherFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// Message attributes set by QueuePublisher
+const (
+	AttrEventType = "event_type"
+	AttrEventID   = "event_id"
+)
+
+// QueuePublisher publishes events as JSON messages to a queue or topic,
+// with their type and ID as attributes
+func QueuePublisher(p queue.Publisher) Publisher {
+	return PublisherFunc(func(ctx context.Context, event *Event) error {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		return p.Publish(ctx, body, map[string]string{AttrEventType: event.Type, AttrEventID: event.ID})
+	})
+}
+
+// Cursor remembers the sequence of the last event published
+type Cursor interface {
+	Load(ctx context.Context) (int64, error) // 0 when there is none
+	Save(ctx context.Context, sequence int64) error
+}
+
+// RelayConfig configures a Relay
+type RelayConfig struct {
+	// Cursor records progress after each event; nil publishes the stream
+	// from the start on every run
+	Cursor Cursor
+
+	PollInterval time.Duration // Time between reads of the store (default: DefaultPollInterval)
+	BatchSize    int           // Events read at once (default: DefaultBatchSize)
+}
+
+// Relay publishes the events of a store in order. An event is published
+// until the publisher accepts it, and the cursor saved after, so events are
+// delivered at least once: consumers drop redeliveries by Event.ID.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	cfg       RelayConfig
+	position  atomic.Int64
+}
+
+// NewRelay returns a relay from store to publisher
+func NewRelay(store Store, publisher Publisher, cfg RelayConfig) (*Relay, error) {
+	if store == nil || publisher == nil {
+		return nil, errors.New("store and publisher are required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	return &Relay{store: store, publisher: publisher, cfg: cfg}, nil
+}
+
+// Run publishes events as they are appended until ctx is canceled, then
+// returns nil. A failed publish is reported to onError and retried on the
+// next interval.
+func (r *Relay) Run(ctx context.Context, onError func(error)) error {
+	if r.cfg.Cursor != nil {
+		sequence, err := r.cfg.Cursor.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load cursor: %w", err)
+		}
+		r.position.Store(sequence)
+	}
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.flush(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes the events after the cursor until the stream is caught
+// up, and returns how many were published
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	if r.cfg.Cursor != nil {
+		sequence, err := r.cfg.Cursor.Load(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load cursor: %w", err)
+		}
+		r.position.Store(max(sequence, r.position.Load()))
+	}
+	return r.flush(ctx)
+}
+
+func (r *Relay) flush(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := r.store.Read(ctx, r.position.Load(), r.cfg.BatchSize)
+		if err != nil {
+			return published, fmt.Errorf("failed to read events: %w", err)
+		}
+		for _, e := range events {
+			if err := ctx.Err(); err != nil {
+				return published, err
+			}
+			if err := r.publisher.Publish(ctx, e); err != nil {
+				return published, fmt.Errorf("failed to publish event %d: %w", e.Sequence, err)
+			}
+			r.position.Store(e.Sequence)
+			if r.cfg.Cursor != nil {
+				if err := r.cfg.Cursor.Save(ctx, e.Sequence); err != nil {
+					return published, fmt.Errorf("failed to save cursor: %w", err)
+				}
+			}
+			published++
+		}
+		if len(events) < r.cfg.BatchSize {
+			return published, nil
+		}
+	}
+}
+
+// Position returns the sequence of the last event published
+func (r *Relay) Position() int64 {
+	return r.position.Load()
+}
+
+// FileCursor keeps the cursor in a local file
+type FileCursor string
+
+// Load reads the cursor
+func (f FileCursor) Load(context.Context) (int64, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// Save replaces the cursor, through a temporary file so a crash leaves the
+// old one
+func (f FileCursor) Save(_ context.Context, sequence int64) error {
+	tmp := string(f) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(sequence, 10)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
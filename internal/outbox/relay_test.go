@@ -0,0 +1,84 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+func appendEvents(t *testing.T, store outbox.Store, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		require.NoError(t, store.Append(context.Background(), &outbox.Event{ID: id, Type: outbox.EventExtracted}))
+	}
+}
+
+func TestRelay_PublishesInOrderAndResumes(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	appendEvents(t, store, "a", "b", "c")
+	cursor := outbox.FileCursor(filepath.Join(t.TempDir(), "cursor"))
+
+	var published []string
+	failOn := "b"
+	pub := outbox.PublisherFunc(func(_ context.Context, e *outbox.Event) error {
+		if e.ID == failOn {
+			return errors.New("broker down")
+		}
+		published = append(published, e.ID)
+		return nil
+	})
+	relay, err := outbox.NewRelay(store, pub, outbox.RelayConfig{Cursor: cursor, BatchSize: 2})
+	require.NoError(t, err)
+
+	n, err := relay.Flush(context.Background())
+	assert.ErrorContains(t, err, "failed to publish event 2: broker down")
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"a"}, published)
+
+	// A new relay picks up from the saved cursor
+	failOn = ""
+	relay, err = outbox.NewRelay(store, pub, outbox.RelayConfig{Cursor: cursor, BatchSize: 2})
+	require.NoError(t, err)
+	n, err = relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"a", "b", "c"}, published)
+
+	saved, err := cursor.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), saved)
+}
+
+func TestRelay_Run(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	q := queue.NewMemoryQueue()
+	relay, err := outbox.NewRelay(store, outbox.QueuePublisher(q), outbox.RelayConfig{PollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx, nil) }()
+
+	appendEvents(t, store, "a", "b")
+	require.Eventually(t, func() bool { return relay.Position() == 2 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	messages := q.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, outbox.EventExtracted, messages[0].Attributes[outbox.AttrEventType])
+	assert.Equal(t, "a", messages[0].Attributes[outbox.AttrEventID])
+	var event outbox.Event
+	require.NoError(t, json.Unmarshal(messages[1].Body, &event))
+	assert.Equal(t, "b", event.ID)
+	assert.Equal(t, int64(2), event.Sequence)
+}
@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MemoryStore keeps events in memory, for tests and single-process use
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append numbers events and adds them to the stream
+func (s *MemoryStore) Append(_ context.Context, events ...*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		e.Sequence = int64(len(s.events)) + 1
+		s.events = append(s.events, e)
+	}
+	return nil
+}
+
+// Read returns up to limit events after the given sequence
+func (s *MemoryStore) Read(_ context.Context, after int64, limit int) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return page(s.events, after, limit), nil
+}
+
+// page returns up to limit of events, numbered from 1, after the given
+// sequence
+func page[T any](events []T, after int64, limit int) []T {
+	start := min(max(after, 0), int64(len(events)))
+	end := int64(len(events))
+	if limit > 0 {
+		end = min(end, start+int64(limit))
+	}
+	return append([]T(nil), events[start:end]...)
+}
+
+// FileStore keeps events in a JSON lines file, one event per line, synced
+// to disk before Append returns. The offsets of the lines are held in
+// memory to read from any sequence.
+type FileStore struct {
+	mu      sync.Mutex
+	f       *os.File
+	offsets []int64 // Offset of each event, by sequence - 1
+	size    int64
+}
+
+// OpenFileStore opens the stream in the file at path, creating it if
+// missing. A line cut short by a crash is dropped.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	s := &FileStore{f: f}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break // A partial last line is overwritten by the next append
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read event log: %w", err)
+		}
+		s.offsets = append(s.offsets, s.size)
+		s.size += int64(len(line))
+	}
+	if err := f.Truncate(s.size); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to repair event log: %w", err)
+	}
+	return s, nil
+}
+
+// Append numbers events and writes them to the end of the file
+func (s *FileStore) Append(_ context.Context, events ...*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	offsets := make([]int64, len(events))
+	for i, e := range events {
+		e.Sequence = int64(len(s.offsets) + i + 1)
+		offsets[i] = s.size + int64(buf.Len())
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if _, err := s.f.WriteAt(buf.Bytes(), s.size); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	s.offsets = append(s.offsets, offsets...)
+	s.size += int64(buf.Len())
+	return nil
+}
+
+// Read returns up to limit events after the given sequence
+func (s *FileStore) Read(_ context.Context, after int64, limit int) ([]*Event, error) {
+	s.mu.Lock()
+	offsets, size := page(s.offsets, after, limit), s.size
+	s.mu.Unlock()
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(s.f, offsets[0], size-offsets[0]))
+	events := make([]*Event, 0, len(offsets))
+	for range offsets {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event log: %w", err)
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("invalid event in log: %w", err)
+		}
+		events = append(events, &e)
+	}
+	return events, nil
+}
+
+// Close closes the file
+func (s *FileStore) Close() error {
+	return s.f.Close()
+}
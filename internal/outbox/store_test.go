@@ -0,0 +1,54 @@
+package outbox_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/outbox"
+)
+
+func TestFileStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	ctx := context.Background()
+
+	store, err := outbox.OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Append(ctx, &outbox.Event{ID: "a", Type: outbox.EventExtracted}, &outbox.Event{ID: "b", Type: outbox.EventValidated}))
+	require.NoError(t, store.Append(ctx, &outbox.Event{ID: "c", Type: outbox.EventExtracted}))
+	require.NoError(t, store.Close())
+
+	// A crash in the middle of an append leaves a partial line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"sequence":4,"id":"d"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	store, err = outbox.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	events, err := store.Read(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2, "the partial line is dropped")
+	assert.Equal(t, "b", events[0].ID)
+	assert.Equal(t, int64(2), events[0].Sequence)
+	assert.Equal(t, "c", events[1].ID)
+
+	e := &outbox.Event{ID: "e", Type: outbox.EventCancelled}
+	require.NoError(t, store.Append(ctx, e))
+	assert.Equal(t, int64(4), e.Sequence)
+	events, err = store.Read(ctx, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "e", events[0].ID)
+
+	events, err = store.Read(ctx, 4, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,228 @@
+package msg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Compound File Binary format ([MS-CFB]): a FAT file system in a file,
+// holding storages (directories) and streams (files)
+
+// cfbSignature starts every compound file
+const cfbSignature = "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"
+
+// Special sector numbers
+const (
+	endOfChain = 0xFFFFFFFE
+	freeSector = 0xFFFFFFFF
+	noEntry    = 0xFFFFFFFF // No sibling or child in the directory tree
+)
+
+// Directory entry types
+const (
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+// headerDIFAT is how many FAT sector numbers the header holds
+const headerDIFAT = 109
+
+var errNotCompound = errors.New("not an OLE compound file")
+
+var le = binary.LittleEndian
+
+type compoundFile struct {
+	data       []byte
+	sectorSize int
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	miniCutoff uint64
+	entries    []dirEntry
+}
+
+type dirEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+// openCompound reads the allocation tables and directory of a compound file
+func openCompound(data []byte) (*compoundFile, error) {
+	if len(data) < 512 || string(data[:8]) != cfbSignature {
+		return nil, errNotCompound
+	}
+	shift := le.Uint16(data[0x1E:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("invalid sector size 2^%d", shift)
+	}
+	if le.Uint16(data[0x20:]) != 6 {
+		return nil, errors.New("invalid mini sector size")
+	}
+	cf := &compoundFile{data: data, sectorSize: 1 << shift, miniCutoff: uint64(le.Uint32(data[0x38:]))}
+	sectors := (len(data) + cf.sectorSize - 1) / cf.sectorSize
+
+	// The FAT sectors are listed by the header, then by a chain of DIFAT
+	// sectors
+	numFAT := int(le.Uint32(data[0x2C:]))
+	if numFAT > sectors {
+		return nil, errors.New("invalid FAT sector count")
+	}
+	fatSectors := make([]uint32, 0, numFAT)
+	for i := 0; i < headerDIFAT && len(fatSectors) < numFAT; i++ {
+		fatSectors = append(fatSectors, le.Uint32(data[0x4C+4*i:]))
+	}
+	for s, n := le.Uint32(data[0x44:]), 0; s != endOfChain && s != freeSector && len(fatSectors) < numFAT; n++ {
+		if n == sectors {
+			return nil, errors.New("DIFAT chain loops")
+		}
+		sector, err := cf.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		last := cf.sectorSize/4 - 1 // The last entry links the next DIFAT sector
+		for i := 0; i < last && len(fatSectors) < numFAT; i++ {
+			fatSectors = append(fatSectors, le.Uint32(sector[4*i:]))
+		}
+		s = le.Uint32(sector[4*last:])
+	}
+	for _, s := range fatSectors {
+		sector, err := cf.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		cf.fat = appendUint32s(cf.fat, sector)
+	}
+
+	dir, err := cf.chain(cf.fat, le.Uint32(data[0x30:]), cf.sector, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for i := 0; i+128 <= len(dir); i += 128 {
+		e := dir[i : i+128]
+		nameLen := min(int(le.Uint16(e[64:])), 64)
+		units := make([]uint16, 0, nameLen/2)
+		for j := 0; j+1 < nameLen; j += 2 {
+			if u := le.Uint16(e[j:]); u != 0 {
+				units = append(units, u)
+			}
+		}
+		cf.entries = append(cf.entries, dirEntry{
+			name:  string(utf16.Decode(units)),
+			typ:   e[66],
+			left:  le.Uint32(e[68:]),
+			right: le.Uint32(e[72:]),
+			child: le.Uint32(e[76:]),
+			start: le.Uint32(e[116:]),
+			size:  le.Uint64(e[120:]),
+		})
+	}
+	if len(cf.entries) == 0 || cf.entries[0].typ != typeRoot {
+		return nil, errors.New("missing root directory entry")
+	}
+	if shift == 9 {
+		for i := range cf.entries {
+			cf.entries[i].size &= 0xFFFFFFFF // Version 3 files may leave junk in the high half
+		}
+	}
+
+	// Small streams are kept in the mini stream, the root entry's data, in
+	// 64-byte sectors
+	miniFAT, err := cf.chain(cf.fat, le.Uint32(data[0x3C:]), cf.sector, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mini FAT: %w", err)
+	}
+	cf.miniFAT = appendUint32s(nil, miniFAT)
+	root := cf.entries[0]
+	if cf.miniStream, err = cf.chain(cf.fat, root.start, cf.sector, int64(root.size)); err != nil {
+		return nil, fmt.Errorf("failed to read mini stream: %w", err)
+	}
+	return cf, nil
+}
+
+// sector returns a regular sector; the last one may be short
+func (cf *compoundFile) sector(n uint32) ([]byte, error) {
+	start := (int64(n) + 1) * int64(cf.sectorSize)
+	if start >= int64(len(cf.data)) {
+		return nil, fmt.Errorf("sector %d is out of bounds", n)
+	}
+	return cf.data[start:min(start+int64(cf.sectorSize), int64(len(cf.data)))], nil
+}
+
+// miniSector returns a 64-byte sector of the mini stream
+func (cf *compoundFile) miniSector(n uint32) ([]byte, error) {
+	start := int64(n) * 64
+	if start >= int64(len(cf.miniStream)) {
+		return nil, fmt.Errorf("mini sector %d is out of bounds", n)
+	}
+	return cf.miniStream[start:min(start+64, int64(len(cf.miniStream)))], nil
+}
+
+// chain reads the sectors linked from start in fat, up to size bytes (-1 =
+// the whole chain)
+func (cf *compoundFile) chain(fat []uint32, start uint32, sector func(uint32) ([]byte, error), size int64) ([]byte, error) {
+	var out []byte
+	for s, n := start, 0; s != endOfChain && (size < 0 || int64(len(out)) < size); n++ {
+		if n > len(fat) || int(s) >= len(fat) {
+			return nil, errors.New("broken sector chain")
+		}
+		data, err := sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+		s = fat[s]
+	}
+	if size >= 0 {
+		if int64(len(out)) < size {
+			return nil, errors.New("stream is shorter than its size")
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// stream returns the data of a stream entry
+func (cf *compoundFile) stream(e dirEntry) ([]byte, error) {
+	if e.size == 0 {
+		return nil, nil
+	}
+	if e.size > uint64(len(cf.data)) {
+		return nil, errors.New("stream is larger than the file")
+	}
+	if e.size < cf.miniCutoff {
+		return cf.chain(cf.miniFAT, e.start, cf.miniSector, int64(e.size))
+	}
+	return cf.chain(cf.fat, e.start, cf.sector, int64(e.size))
+}
+
+// children returns the directory IDs of the entries of a storage, walking
+// its directory tree
+func (cf *compoundFile) children(storage uint32) []uint32 {
+	var out []uint32
+	seen := make(map[uint32]bool)
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == noEntry || int(id) >= len(cf.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		walk(cf.entries[id].left)
+		out = append(out, id)
+		walk(cf.entries[id].right)
+	}
+	walk(cf.entries[storage].child)
+	return out
+}
+
+func appendUint32s(dst []uint32, data []byte) []uint32 {
+	for i := 0; i+4 <= len(data); i += 4 {
+		dst = append(dst, le.Uint32(data[i:]))
+	}
+	return dst
+}
@@ -0,0 +1,257 @@
+// Package msg reads Outlook .msg files: the sender, subject, body and
+// attachments of a message saved from Outlook, stored as MAPI properties in
+// an OLE compound file ([MS-OXMSG])
+package msg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Message is an Outlook message
+type Message struct {
+	From        string // Sender, as "Name <address>"
+	Subject     string
+	MessageID   string    // Internet Message-ID, without angle brackets
+	Date        time.Time // Time the message was sent
+	Body        string    // Plain text body
+	HTML        []byte    // HTML body, if any
+	Attachments []Attachment
+}
+
+// Attachment is a file, or a message, attached to a message
+type Attachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
+
+	// Hidden is set for inline images of the body, such as logos
+	Hidden bool
+
+	// Message is an attached message, such as a forwarded email; Data is
+	// then empty
+	Message *Message
+}
+
+// MAPI property IDs ([MS-OXPROPS])
+const (
+	propSubject            = 0x0037
+	propClientSubmitTime   = 0x0039
+	propSentRepName        = 0x0042
+	propSentRepAddress     = 0x0065
+	propSenderName         = 0x0C1A
+	propSenderAddress      = 0x0C1F
+	propDeliveryTime       = 0x0E06
+	propBody               = 0x1000
+	propHTML               = 0x1013
+	propInternetMessageID  = 0x1035
+	propAttachDisplayName  = 0x3001
+	propAttachData         = 0x3701
+	propAttachFilename     = 0x3704
+	propAttachMethod       = 0x3705
+	propAttachLongFilename = 0x3707
+	propAttachMimeTag      = 0x370E
+	propSenderSMTPAddress  = 0x5D01
+	propAttachmentHidden   = 0x7FFE
+)
+
+// MAPI property types
+const (
+	typeBoolean = 0x000B
+	typeObject  = 0x000D
+	typeString8 = 0x001E
+	typeUnicode = 0x001F
+	typeTime    = 0x0040
+	typeBinary  = 0x0102
+)
+
+// attachEmbeddedMessage is the attach method of an attached message
+const attachEmbeddedMessage = 5
+
+// maxDepth caps messages attached to attached messages
+const maxDepth = 5
+
+// Read parses an Outlook .msg file
+func Read(data []byte) (*Message, error) {
+	cf, err := openCompound(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Outlook message: %w", err)
+	}
+	m, err := readMessage(cf, 0, 32, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Outlook message: %w", err)
+	}
+	return m, nil
+}
+
+// storage is the properties of a message, attachment or recipient: its
+// variable-length properties are streams, the others are packed in a
+// properties stream
+type storage struct {
+	cf      *compoundFile
+	streams map[string]uint32 // Directory IDs by name
+	fixed   map[uint16]uint64 // Fixed-length values by property ID
+}
+
+// openStorage reads the properties of a storage; headerSize is the length
+// of the header of its properties stream, which depends on the kind of
+// storage
+func openStorage(cf *compoundFile, id uint32, headerSize int) (*storage, error) {
+	s := &storage{cf: cf, streams: make(map[string]uint32), fixed: make(map[uint16]uint64)}
+	for _, child := range cf.children(id) {
+		s.streams[cf.entries[child].name] = child
+	}
+	if child, ok := s.streams["__properties_version1.0"]; ok {
+		props, err := cf.stream(cf.entries[child])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read properties: %w", err)
+		}
+		for i := headerSize; i+16 <= len(props); i += 16 {
+			s.fixed[le.Uint16(props[i+2:])] = le.Uint64(props[i+8:])
+		}
+	}
+	return s, nil
+}
+
+// stream returns the data of a property stream, or nil
+func (s *storage) stream(id, typ uint16) []byte {
+	child, ok := s.streams[fmt.Sprintf("__substg1.0_%04X%04X", id, typ)]
+	if !ok || s.cf.entries[child].typ != typeStream {
+		return nil
+	}
+	data, err := s.cf.stream(s.cf.entries[child])
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// string returns a string property, stored as UTF-16 or 8-bit text
+func (s *storage) string(id uint16) string {
+	if data := s.stream(id, typeUnicode); data != nil {
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			units = append(units, le.Uint16(data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return strings.TrimRight(string(s.stream(id, typeString8)), "\x00")
+}
+
+// time returns a time property, or the zero time
+func (s *storage) time(id uint16) time.Time {
+	filetime, ok := s.fixed[id]
+	if !ok || filetime == 0 {
+		return time.Time{}
+	}
+	// FILETIME counts 100 ns intervals from 1601-01-01
+	const unixEpoch = 116444736000000000
+	return time.Unix(0, 0).UTC().Add(time.Duration(int64(filetime)-unixEpoch) * 100)
+}
+
+// readMessage reads the message in a storage, with its attachments
+func readMessage(cf *compoundFile, id uint32, headerSize, depth int) (*Message, error) {
+	s, err := openStorage(cf, id, headerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Subject:   s.string(propSubject),
+		MessageID: strings.Trim(strings.TrimSpace(s.string(propInternetMessageID)), "<>"),
+		Date:      s.time(propClientSubmitTime),
+		Body:      s.string(propBody),
+		HTML:      s.stream(propHTML, typeBinary),
+	}
+	if m.Date.IsZero() {
+		m.Date = s.time(propDeliveryTime)
+	}
+	if m.HTML == nil {
+		if html := s.string(propHTML); html != "" {
+			m.HTML = []byte(html)
+		}
+	}
+
+	name := firstNonEmpty(s.string(propSenderName), s.string(propSentRepName))
+	address := firstNonEmpty(s.string(propSenderSMTPAddress), s.string(propSenderAddress), s.string(propSentRepAddress))
+	if strings.HasPrefix(strings.ToUpper(address), "/O=") {
+		address = "" // An Exchange address, not an email address
+	}
+	switch {
+	case name != "" && address != "" && name != address:
+		m.From = name + " <" + address + ">"
+	default:
+		m.From = firstNonEmpty(address, name)
+	}
+
+	var attachments []string
+	for name := range s.streams {
+		if strings.HasPrefix(name, "__attach_version1.0_#") {
+			attachments = append(attachments, name)
+		}
+	}
+	slices.Sort(attachments)
+	for _, name := range attachments {
+		a, err := readAttachment(cf, s.streams[name], depth)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", strings.TrimPrefix(name, "__attach_version1.0_#"), err)
+		}
+		m.Attachments = append(m.Attachments, *a)
+	}
+	return m, nil
+}
+
+func readAttachment(cf *compoundFile, id uint32, depth int) (*Attachment, error) {
+	s, err := openStorage(cf, id, 8)
+	if err != nil {
+		return nil, err
+	}
+	a := &Attachment{
+		Name:     firstNonEmpty(s.string(propAttachLongFilename), s.string(propAttachFilename), s.string(propAttachDisplayName)),
+		MimeType: s.string(propAttachMimeTag),
+		Hidden:   s.fixed[propAttachmentHidden]&0xFF != 0,
+	}
+	if s.fixed[propAttachMethod] != attachEmbeddedMessage {
+		a.Data = s.stream(propAttachData, typeBinary)
+		return a, nil
+	}
+
+	child, ok := s.streams[fmt.Sprintf("__substg1.0_%04X%04X", propAttachData, typeObject)]
+	if !ok || cf.entries[child].typ != typeStorage {
+		return nil, errors.New("attached message is missing")
+	}
+	if depth == maxDepth {
+		return nil, errors.New("attached messages nested too deeply")
+	}
+	if a.Message, err = readMessage(cf, child, 24, depth+1); err != nil {
+		return nil, err
+	}
+	if a.Name == "" {
+		a.Name = a.Message.Subject
+	}
+	return a, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// IsMessage reports whether data is an Outlook .msg file: a compound file
+// holding message property streams
+func IsMessage(data []byte) bool {
+	return len(data) >= 512 && string(data[:8]) == cfbSignature && bytes.Contains(data, substgMarker)
+}
+
+// substgMarker is the UTF-16 prefix of the names of property streams,
+// found in the directory of a message
+var substgMarker = []byte("_\x00_\x00s\x00u\x00b\x00s\x00t\x00g\x001\x00.\x000\x00_\x00")
@@ -0,0 +1,283 @@
+package msg_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/parser/msg"
+)
+
+// entry is a storage or stream of a compound file built by compoundFile
+type entry struct {
+	name     string
+	data     []byte
+	children []*entry // Set for storages
+}
+
+func storage(name string, children ...*entry) *entry {
+	return &entry{name: name, children: children}
+}
+
+// compoundFile writes a version 3 compound file (512-byte sectors) with the
+// given entries under its root. Streams under 4096 bytes go to the mini
+// stream, as Outlook writes them. Siblings are chained to the right
+// rather than balanced, which readers accept.
+func compoundFile(entries ...*entry) []byte {
+	const (
+		sectorSize = 512
+		endOfChain = 0xFFFFFFFE
+		fatSector  = 0xFFFFFFFD
+		noEntry    = 0xFFFFFFFF
+	)
+	le := binary.LittleEndian
+	var sectors [][]byte
+	var fat []uint32
+	var miniStream []byte
+	var miniFAT []uint32
+
+	// chain appends data as linked sectors, to the mini stream when sectors
+	// is nil, and returns the first
+	chain := func(data []byte, size int, sectors *[][]byte, fat *[]uint32) uint32 {
+		if len(data) == 0 {
+			return endOfChain
+		}
+		first := uint32(len(*fat))
+		for i := 0; i < len(data); i += size {
+			s := make([]byte, size)
+			copy(s, data[i:])
+			if sectors != nil {
+				*sectors = append(*sectors, s)
+			} else {
+				miniStream = append(miniStream, s...)
+			}
+			next := uint32(len(*fat) + 1)
+			if i+size >= len(data) {
+				next = endOfChain
+			}
+			*fat = append(*fat, next)
+		}
+		return first
+	}
+
+	type dirEntry struct {
+		name               string
+		typ                byte
+		left, right, child uint32
+		start              uint32
+		size               uint64
+	}
+	dir := []dirEntry{{name: "Root Entry", typ: 5, left: noEntry, right: noEntry, child: noEntry}}
+	var add func(parent int, children []*entry)
+	add = func(parent int, children []*entry) {
+		prev := -1
+		for _, c := range children {
+			id := len(dir)
+			e := dirEntry{name: c.name, typ: 2, left: noEntry, right: noEntry, child: noEntry, size: uint64(len(c.data))}
+			switch {
+			case c.children != nil:
+				e.typ, e.size = 1, 0
+			case len(c.data) < 4096:
+				e.start = chain(c.data, 64, nil, &miniFAT)
+			default:
+				e.start = chain(c.data, sectorSize, &sectors, &fat)
+			}
+			dir = append(dir, e)
+			if prev < 0 {
+				dir[parent].child = uint32(id)
+			} else {
+				dir[prev].right = uint32(id)
+			}
+			prev = id
+			if c.children != nil {
+				add(id, c.children)
+			}
+		}
+	}
+	add(0, entries)
+
+	dir[0].start = chain(miniStream, sectorSize, &sectors, &fat)
+	dir[0].size = uint64(len(miniStream))
+	var miniFATData []byte
+	for _, n := range miniFAT {
+		miniFATData = le.AppendUint32(miniFATData, n)
+	}
+	firstMiniFAT := chain(miniFATData, sectorSize, &sectors, &fat)
+
+	var dirData []byte
+	for _, e := range dir {
+		b := make([]byte, 128)
+		units := utf16.Encode([]rune(e.name))
+		for i, u := range units {
+			le.PutUint16(b[2*i:], u)
+		}
+		le.PutUint16(b[64:], uint16(2*len(units)+2))
+		b[66], b[67] = e.typ, 1
+		le.PutUint32(b[68:], e.left)
+		le.PutUint32(b[72:], e.right)
+		le.PutUint32(b[76:], e.child)
+		le.PutUint32(b[116:], e.start)
+		le.PutUint64(b[120:], e.size)
+		dirData = append(dirData, b...)
+	}
+	firstDir := chain(dirData, sectorSize, &sectors, &fat)
+
+	// The FAT covers its own sectors too
+	numFAT := 1
+	for (len(fat)+numFAT+sectorSize/4-1)/(sectorSize/4) > numFAT {
+		numFAT++
+	}
+	var fatSectors []uint32
+	for range numFAT {
+		fatSectors = append(fatSectors, uint32(len(fat)))
+		fat = append(fat, fatSector)
+		sectors = append(sectors, nil)
+	}
+	var fatData []byte
+	for _, n := range fat {
+		fatData = le.AppendUint32(fatData, n)
+	}
+	for len(fatData)%sectorSize != 0 {
+		fatData = le.AppendUint32(fatData, 0xFFFFFFFF)
+	}
+	for i, s := range fatSectors {
+		sectors[s] = fatData[i*sectorSize : (i+1)*sectorSize]
+	}
+
+	header := make([]byte, sectorSize)
+	copy(header, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], uint32(numFAT))
+	le.PutUint32(header[0x30:], firstDir)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3C:], firstMiniFAT)
+	le.PutUint32(header[0x40:], uint32((len(miniFATData)+sectorSize-1)/sectorSize))
+	le.PutUint32(header[0x44:], endOfChain)
+	for i := range 109 {
+		n := uint32(0xFFFFFFFF)
+		if i < len(fatSectors) {
+			n = fatSectors[i]
+		}
+		le.PutUint32(header[0x4C+4*i:], n)
+	}
+	out := header
+	for _, s := range sectors {
+		out = append(out, s...)
+	}
+	return out
+}
+
+func unicode(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+func stringProp(id uint16, value string) *entry {
+	return &entry{name: fmt.Sprintf("__substg1.0_%04X001F", id), data: unicode(value)}
+}
+
+func binaryProp(id uint16, data []byte) *entry {
+	return &entry{name: fmt.Sprintf("__substg1.0_%04X0102", id), data: data}
+}
+
+// properties packs fixed-length properties, by tag, after a header of
+// headerSize bytes
+func properties(headerSize int, props map[uint32]uint64) *entry {
+	data := make([]byte, headerSize)
+	for tag, value := range props {
+		data = binary.LittleEndian.AppendUint32(data, tag)
+		data = binary.LittleEndian.AppendUint32(data, 6)
+		data = binary.LittleEndian.AppendUint64(data, value)
+	}
+	return &entry{name: "__properties_version1.0", data: data}
+}
+
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func TestRead(t *testing.T) {
+	sent := time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC)
+	pdf := make([]byte, 5000) // Stored in regular sectors
+	copy(pdf, "%PDF-1.4\n")
+
+	data := compoundFile(
+		properties(32, map[uint32]uint64{0x00390040: filetime(sent)}),
+		stringProp(0x0037, "Hóa đơn tháng 3"),
+		stringProp(0x0C1A, "Billing"),
+		stringProp(0x0C1F, "/O=EXCHANGE/OU=FIRST/CN=RECIPIENTS/CN=BILLING"),
+		stringProp(0x5D01, "billing@example.com"),
+		stringProp(0x1035, "<abc@example.com>"),
+		stringProp(0x1000, "Please find the invoice attached."),
+		binaryProp(0x1013, []byte("<html><body>Invoice attached</body></html>")),
+		storage("__attach_version1.0_#00000000",
+			properties(8, map[uint32]uint64{0x37050003: 1}),
+			stringProp(0x3707, "0000042.pdf"),
+			stringProp(0x370E, "application/pdf"),
+			binaryProp(0x3701, pdf),
+		),
+		storage("__attach_version1.0_#00000001",
+			properties(8, map[uint32]uint64{0x37050003: 1, 0x7FFE000B: 1}),
+			stringProp(0x3707, "logo.png"),
+			binaryProp(0x3701, []byte("\x89PNG")),
+		),
+		storage("__attach_version1.0_#00000002",
+			properties(8, map[uint32]uint64{0x37050003: 5}),
+			storage("__substg1.0_3701000D",
+				properties(24, nil),
+				stringProp(0x0037, "Fwd: receipt"),
+				storage("__attach_version1.0_#00000000",
+					stringProp(0x3704, "R-7.XML"),
+					binaryProp(0x3701, []byte("<Invoice/>")),
+				),
+			),
+		),
+	)
+	require.True(t, msg.IsMessage(data))
+
+	m, err := msg.Read(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Hóa đơn tháng 3", m.Subject)
+	assert.Equal(t, "Billing <billing@example.com>", m.From)
+	assert.Equal(t, "abc@example.com", m.MessageID)
+	assert.Equal(t, sent, m.Date)
+	assert.Equal(t, "Please find the invoice attached.", m.Body)
+	assert.Equal(t, "<html><body>Invoice attached</body></html>", string(m.HTML))
+
+	require.Len(t, m.Attachments, 3)
+	assert.Equal(t, "0000042.pdf", m.Attachments[0].Name)
+	assert.Equal(t, "application/pdf", m.Attachments[0].MimeType)
+	assert.Equal(t, pdf, m.Attachments[0].Data)
+	assert.False(t, m.Attachments[0].Hidden)
+	assert.True(t, m.Attachments[1].Hidden)
+
+	forwarded := m.Attachments[2]
+	assert.Equal(t, "Fwd: receipt", forwarded.Name)
+	assert.Empty(t, forwarded.Data)
+	require.NotNil(t, forwarded.Message)
+	require.Len(t, forwarded.Message.Attachments, 1)
+	assert.Equal(t, "R-7.XML", forwarded.Message.Attachments[0].Name)
+	assert.Equal(t, "<Invoice/>", string(forwarded.Message.Attachments[0].Data))
+}
+
+func TestRead_Invalid(t *testing.T) {
+	_, err := msg.Read([]byte("From: billing@example.com\r\n\r\nHello"))
+	assert.ErrorContains(t, err, "not an OLE compound file")
+
+	data := compoundFile(stringProp(0x0037, "Hello"))
+	assert.True(t, msg.IsMessage(data))
+	_, err = msg.Read(data[:700])
+	assert.Error(t, err, "truncated")
+}
@@ -13,6 +13,9 @@ import (
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/tracing"
 )
 
 // execCommandContext is a helper to create an exec.Cmd with context
@@ -20,6 +23,25 @@ func execCommandContext(ctx context.Context, name string, args ...string) *exec.
 	return exec.CommandContext(ctx, name, args...)
 }
 
+// runCommand runs an external tool in a span recording its command line and
+// exit code
+func runCommand(ctx context.Context, name string, args ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "exec "+name,
+		tracing.String("process.executable.name", name),
+		tracing.String("process.command_args", strings.Join(append([]string{name}, args...), " ")))
+	defer func() { tracing.End(span, err) }()
+
+	cmd := execCommandContext(ctx, name, args...)
+	err = cmd.Run()
+	if cmd.ProcessState != nil {
+		span.SetAttributes(tracing.Int("process.exit.code", cmd.ProcessState.ExitCode()))
+	}
+	if err != nil {
+		logging.Warn(ctx, "PDF tool failed", "command", name, "error", err)
+	}
+	return err
+}
+
 // TextBlock represents a block of text with position info
 type TextBlock struct {
 	Text   string
@@ -36,6 +58,15 @@ type ExtractedText struct {
 	RawText    string
 	Blocks     []TextBlock
 	PageCount  int
+	Metadata   Metadata
+}
+
+// Metadata holds fields from the PDF document information dictionary
+type Metadata struct {
+	Title    string
+	Author   string
+	Producer string // Software that produced the PDF (often the e-invoice platform)
+	Creator  string // Application that created the source document
 }
 
 // PageText holds text from a single page
@@ -59,12 +90,21 @@ func NewExtractor() *Extractor {
 
 // Extract extracts text from PDF content
 // Note: pdfcpu's text extraction writes to files, so we use a temp directory
-func (e *Extractor) Extract(ctx context.Context, r io.Reader) (*ExtractedText, error) {
+func (e *Extractor) Extract(ctx context.Context, r io.Reader) (result *ExtractedText, err error) {
+	ctx, span := tracing.Start(ctx, "pdf.extract_text")
+	defer func() {
+		if result != nil {
+			span.SetAttributes(tracing.Int("pdf.pages", result.PageCount), tracing.Int("pdf.text_length", len(result.RawText)))
+		}
+		tracing.End(span, err)
+	}()
+
 	// Read all content into buffer
 	content, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read PDF content: %w", err)
 	}
+	span.SetAttributes(tracing.Int("pdf.size", len(content)))
 
 	// Create reader from content
 	reader := bytes.NewReader(content)
@@ -75,11 +115,16 @@ func (e *Extractor) Extract(ctx context.Context, r io.Reader) (*ExtractedText, e
 		return nil, fmt.Errorf("failed to get page count: %w", err)
 	}
 
-	result := &ExtractedText{
+	result = &ExtractedText{
 		Pages:     make([]PageText, 0, pageCount),
 		PageCount: pageCount,
 	}
 
+	// Metadata is best-effort, extraction continues without it
+	if md, err := e.readMetadata(content); err == nil {
+		result.Metadata = *md
+	}
+
 	// Create temp directory for extraction
 	tmpDir, err := os.MkdirTemp("", "pdf-extract-*")
 	if err != nil {
@@ -246,6 +291,70 @@ func isPrintableText(s string) bool {
 	return float64(printable)/float64(len(s)) > 0.5
 }
 
+// ReadMetadata reads the document information dictionary from PDF bytes
+func (e *Extractor) ReadMetadata(ctx context.Context, data []byte) (*Metadata, error) {
+	return e.readMetadata(data)
+}
+
+func (e *Extractor) readMetadata(data []byte) (*Metadata, error) {
+	// PDFInfo mutates its configuration, so use a fresh one
+	info, err := api.PDFInfo(bytes.NewReader(data), "", nil, false, model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF info: %w", err)
+	}
+
+	return &Metadata{
+		Title:    info.Title,
+		Author:   info.Author,
+		Producer: info.Producer,
+		Creator:  info.Creator,
+	}, nil
+}
+
+// Attachment is a file embedded in a PDF
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// ExtractAttachments returns the files embedded in a PDF, such as the XML
+// of a hybrid e-invoice
+func (e *Extractor) ExtractAttachments(ctx context.Context, data []byte) (attachments []Attachment, err error) {
+	_, span := tracing.Start(ctx, "pdf.extract_attachments", tracing.Int("pdf.size", len(data)))
+	defer func() {
+		span.SetAttributes(tracing.Int("pdf.attachments", len(attachments)))
+		tracing.End(span, err)
+	}()
+
+	// Reading mutates its configuration, so use a fresh one
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.EXTRACTATTACHMENTS
+	pdfCtx, err := api.ReadAndValidate(bytes.NewReader(data), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if !pdfCtx.XRefTable.Valid {
+		if err := pdfCtx.XRefTable.LocateNameTree("EmbeddedFiles", false); err != nil {
+			return nil, fmt.Errorf("failed to read PDF attachments: %w", err)
+		}
+	}
+	if pdfCtx.XRefTable.Names["EmbeddedFiles"] == nil {
+		return nil, nil
+	}
+	embedded, err := pdfCtx.ExtractAttachments(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF attachments: %w", err)
+	}
+	for _, a := range embedded {
+		content, err := io.ReadAll(a.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PDF attachment %s: %w", a.FileName, err)
+		}
+		attachments = append(attachments, Attachment{Name: a.FileName, Data: content})
+	}
+	return attachments, nil
+}
+
 // ExtractBytes extracts text from PDF bytes
 func (e *Extractor) ExtractBytes(ctx context.Context, data []byte) (*ExtractedText, error) {
 	return e.Extract(ctx, bytes.NewReader(data))
@@ -355,7 +464,13 @@ func isLabel(s string) bool {
 
 // ConvertToImages converts PDF bytes to PNG images using pdftoppm
 // Returns a slice of PNG image bytes, one per page
-func (e *Extractor) ConvertToImages(ctx context.Context, pdfData []byte) ([][]byte, error) {
+func (e *Extractor) ConvertToImages(ctx context.Context, pdfData []byte) (images [][]byte, err error) {
+	ctx, span := tracing.Start(ctx, "pdf.render", tracing.Int("pdf.size", len(pdfData)))
+	defer func() {
+		span.SetAttributes(tracing.Int("pdf.pages", len(images)))
+		tracing.End(span, err)
+	}()
+
 	// Create temp directory for PDF and images
 	tmpDir, err := os.MkdirTemp("", "pdf-images-*")
 	if err != nil {
@@ -376,7 +491,6 @@ func (e *Extractor) ConvertToImages(ctx context.Context, pdfData []byte) ([][]by
 	}
 
 	// Read generated images
-	var images [][]byte
 	files, err := os.ReadDir(tmpDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read temp dir: %w", err)
@@ -409,11 +523,9 @@ func convertPDFToImages(ctx context.Context, pdfPath, outputPrefix string) error
 	// -jpeg: Use JPEG format for smaller file size
 	// -r 100: 100 DPI is sufficient for invoice text recognition
 	// -jpegopt quality=80: Good quality/size balance
-	cmd := execCommandContext(ctx, "pdftoppm", "-jpeg", "-r", "100", "-jpegopt", "quality=80", pdfPath, outputPrefix)
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, "pdftoppm", "-jpeg", "-r", "100", "-jpegopt", "quality=80", pdfPath, outputPrefix); err != nil {
 		// Try convert from ImageMagick as fallback
-		cmd = execCommandContext(ctx, "convert", "-density", "100", "-quality", "80", pdfPath, outputPrefix+".jpg")
-		if err := cmd.Run(); err != nil {
+		if err := runCommand(ctx, "convert", "-density", "100", "-quality", "80", pdfPath, outputPrefix+".jpg"); err != nil {
 			return fmt.Errorf("pdftoppm and convert both failed: %w", err)
 		}
 	}
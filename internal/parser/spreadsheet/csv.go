@@ -0,0 +1,74 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvDelimiters are the separators ReadCSV recognizes: commas, semicolons
+// (spreadsheets saved in locales with a decimal comma) and tabs
+var csvDelimiters = []rune{',', ';', '\t'}
+
+// ReadCSV returns the rows of a CSV file as a single unnamed sheet, with the
+// same trimming as ReadXLSX. The delimiter is the separator most used in the
+// first line. A UTF-8 byte order mark is skipped.
+func ReadCSV(data []byte) ([]Sheet, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, errors.New("CSV file is not UTF-8 text")
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = sniffDelimiter(data)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var sheet Sheet
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		var values []string
+		for i, v := range record {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, make([]string, i-len(values))...)
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			sheet.Rows = append(sheet.Rows, values)
+		}
+	}
+	return []Sheet{sheet}, nil
+}
+
+// sniffDelimiter returns the separator used most in the first line outside
+// quotes, or a comma
+func sniffDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	counts := make(map[rune]int, len(csvDelimiters))
+	quoted := false
+	for _, c := range string(line) {
+		if c == '"' {
+			quoted = !quoted
+		} else if !quoted {
+			counts[c]++
+		}
+	}
+	best := csvDelimiters[0]
+	for _, d := range csvDelimiters[1:] {
+		if counts[d] > counts[best] {
+			best = d
+		}
+	}
+	return best
+}
@@ -0,0 +1,39 @@
+package spreadsheet_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/parser/spreadsheet"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"comma", "\xef\xbb\xbfItem,Qty,Amount\r\n\"Cà phê, đá\",2,\"45,000\"\r\n,,\r\nTrà,,30000\r\n"},
+		{"semicolon", "Item;Qty;Amount\n\"Cà phê, đá\";2;45,000\nTrà;;30000;\n"},
+		{"tab", "Item\tQty\tAmount\nCà phê, đá\t2\t45,000\n\nTrà\t\t30000\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheets, err := spreadsheet.ReadCSV([]byte(tt.data))
+			require.NoError(t, err)
+			require.Len(t, sheets, 1)
+			assert.False(t, sheets[0].RawNumbers)
+			assert.Equal(t, [][]string{
+				{"Item", "Qty", "Amount"},
+				{"Cà phê, đá", "2", "45,000"},
+				{"Trà", "", "30000"},
+			}, sheets[0].Rows)
+		})
+	}
+}
+
+func TestReadCSV_NotText(t *testing.T) {
+	_, err := spreadsheet.ReadCSV([]byte{0xff, 0xfe, 'a', 0})
+	assert.ErrorContains(t, err, "not UTF-8")
+}
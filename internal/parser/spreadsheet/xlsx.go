@@ -0,0 +1,303 @@
+// Package spreadsheet reads the cells of Office Open XML workbooks (.xlsx)
+// and CSV files
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPartSize caps the uncompressed bytes read per workbook part, against
+// zip bombs
+const maxPartSize = 64 << 20
+
+// Sheet is a worksheet of a workbook. Rows hold the cell text by column,
+// from column A, with empty rows and trailing empty cells dropped.
+type Sheet struct {
+	Name string
+	Rows [][]string
+
+	// RawNumbers is set when number cells are written as stored, such as
+	// "1234.5", rather than as typed in a locale's format ("1.234,5")
+	RawNumbers bool
+}
+
+// ReadXLSX returns the sheets of an XLSX workbook in tab order. Numbers are
+// written as stored, without their display format, and date cells as
+// yyyy-mm-dd (with the time when it isn't midnight).
+func ReadXLSX(data []byte) ([]Sheet, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+	parts := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	read := func(name string, v any) error {
+		f, ok := parts[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", errMissingPart, name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return nil
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := read("xl/workbook.xml", &workbook); err != nil {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := read("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, r := range rels.Relationships {
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.ID] = path.Join("xl", r.Target)
+		}
+	}
+
+	var shared sharedStrings
+	if err := read("xl/sharedStrings.xml", &shared); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	var styles styleSheet
+	if err := read("xl/styles.xml", &styles); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	dates := styles.dateStyles()
+
+	sheets := make([]Sheet, 0, len(workbook.Sheets))
+	for _, s := range workbook.Sheets {
+		target, ok := targets[s.ID]
+		if !ok {
+			return nil, fmt.Errorf("sheet %q has no part", s.Name)
+		}
+		var ws worksheet
+		if err := read(target, &ws); err != nil {
+			return nil, fmt.Errorf("failed to read sheet %q: %w", s.Name, err)
+		}
+		sheet := Sheet{Name: s.Name, RawNumbers: true}
+		for _, row := range ws.Rows {
+			var values []string
+			for i, c := range row.Cells {
+				col := i
+				if c.Ref != "" {
+					if col, err = column(c.Ref); err != nil {
+						return nil, fmt.Errorf("sheet %q: %w", s.Name, err)
+					}
+				}
+				text := c.text(shared.Items, dates)
+				if text == "" {
+					continue
+				}
+				for len(values) <= col {
+					values = append(values, "")
+				}
+				values[col] = text
+			}
+			if len(values) > 0 {
+				sheet.Rows = append(sheet.Rows, values)
+			}
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
+
+var errMissingPart = errors.New("missing part")
+
+// IsXLSX reports whether data is a ZIP archive holding a workbook
+func IsXLSX(data []byte) bool {
+	if len(data) < 4 || string(data[:4]) != "PK\x03\x04" {
+		return false
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// richText is a shared or inline string: plain, or runs of formatted text
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r richText) String() string {
+	if len(r.Runs) == 0 {
+		return r.Text
+	}
+	var b strings.Builder
+	for _, run := range r.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type sharedStrings struct {
+	Items []richText `xml:"si"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Cells []cell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+type cell struct {
+	Ref    string    `xml:"r,attr"`
+	Type   string    `xml:"t,attr"`
+	Style  int       `xml:"s,attr"`
+	Value  string    `xml:"v"`
+	Inline *richText `xml:"is"`
+}
+
+func (c cell) text(shared []richText, dates map[int]bool) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return strings.TrimSpace(shared[i].String())
+	case "inlineStr":
+		if c.Inline == nil {
+			return ""
+		}
+		return strings.TrimSpace(c.Inline.String())
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "", "n":
+		if dates[c.Style] {
+			if serial, err := strconv.ParseFloat(c.Value, 64); err == nil {
+				return serialDate(serial)
+			}
+		}
+	}
+	return strings.TrimSpace(c.Value)
+}
+
+// excelEpoch is day 0 of the 1900 date system, two days before 1900-01-01
+// to absorb Excel's 1900 leap year bug for dates from March 1900
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serialDate formats an Excel date serial number
+func serialDate(serial float64) string {
+	t := excelEpoch.Add(time.Duration(serial * float64(24*time.Hour))).Round(time.Second)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+type styleSheet struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// dateStyles returns the cell styles with a date number format
+func (s styleSheet) dateStyles() map[int]bool {
+	custom := make(map[int]string, len(s.NumFmts))
+	for _, f := range s.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	dates := make(map[int]bool)
+	for i, xf := range s.CellXfs {
+		id := xf.NumFmtID
+		if (id >= 14 && id <= 17) || id == 22 { // Built-in date formats; 18-21 and 45-47 are times
+			dates[i] = true
+		} else if code, ok := custom[id]; ok && isDateFormat(code) {
+			dates[i] = true
+		}
+	}
+	return dates
+}
+
+// isDateFormat reports whether a number format code shows a date, having
+// day or year tokens outside quoted text and [bracketed] sections (m alone
+// is also minutes)
+func isDateFormat(code string) bool {
+	quoted, bracketed := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case bracketed:
+		case strings.IndexByte("dDyY", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// column returns the zero-based column of a cell reference such as "C12"
+func column(ref string) (int, error) {
+	col := 0
+	for i := 0; i < len(ref); i++ {
+		c := ref[i]
+		if c < 'A' || c > 'Z' {
+			if i == 0 {
+				break
+			}
+			return col - 1, nil
+		}
+		col = col*26 + int(c-'A'+1)
+		if col > 16384 {
+			break
+		}
+	}
+	return 0, fmt.Errorf("invalid cell reference %q", ref)
+}
@@ -0,0 +1,93 @@
+package spreadsheet_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/parser/spreadsheet"
+)
+
+func buildZIP(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadXLSX_ExportedWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteXLSX(&buf,
+		export.Sheet{
+			Name:   "Lines",
+			Header: []string{"Item", "Qty", "Amount", "Date"},
+			Rows: [][]any{
+				{"Cà phê", 2, decimal.RequireFromString("45000.5"), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+				{"Trà", nil, 30000, nil},
+			},
+		},
+		export.Sheet{Name: "Notes", Rows: [][]any{{"Net 30"}}},
+	))
+	data := buf.Bytes()
+	require.True(t, spreadsheet.IsXLSX(data))
+
+	sheets, err := spreadsheet.ReadXLSX(data)
+	require.NoError(t, err)
+	require.Len(t, sheets, 2)
+	assert.Equal(t, "Lines", sheets[0].Name)
+	assert.True(t, sheets[0].RawNumbers)
+	assert.Equal(t, [][]string{
+		{"Item", "Qty", "Amount", "Date"},
+		{"Cà phê", "2", "45000.5", "2024-03-01"},
+		{"Trà", "", "30000"},
+	}, sheets[0].Rows)
+	assert.Equal(t, [][]string{{"Net 30"}}, sheets[1].Rows)
+}
+
+func TestReadXLSX_SharedStrings(t *testing.T) {
+	data := buildZIP(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Invoice" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId3" Target="/xl/worksheets/invoice.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Invoice No</t></si><si><r><t>INV-</t></r><r><t>0042</t></r></si></sst>`,
+		"xl/styles.xml": `<styleSheet><numFmts><numFmt numFmtId="170" formatCode="[$-409]h:mm AM/PM"/></numFmts>
+			<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="170"/></cellXfs></styleSheet>`,
+		"xl/worksheets/invoice.xml": `<worksheet><sheetData>
+			<row r="2"><c r="B2" t="s"><v>0</v></c><c r="D2" t="s"><v>1</v></c></row>
+			<row r="3"><c r="B3" s="1"><v>45352.75</v></c><c r="C3" s="2"><v>0.5</v></c><c r="D3" t="b"><v>1</v></c></row>
+			<row r="4"><c r="A4"/></row>
+		</sheetData></worksheet>`,
+	})
+
+	sheets, err := spreadsheet.ReadXLSX(data)
+	require.NoError(t, err)
+	require.Len(t, sheets, 1)
+	assert.Equal(t, [][]string{
+		{"", "Invoice No", "", "INV-0042"},
+		{"", "2024-03-01 18:00:00", "0.5", "TRUE"},
+	}, sheets[0].Rows, "times aren't dates; empty rows are dropped")
+}
+
+func TestReadXLSX_Invalid(t *testing.T) {
+	_, err := spreadsheet.ReadXLSX([]byte("not a zip"))
+	assert.Error(t, err)
+
+	data := buildZIP(t, map[string]string{"word/document.xml": "<document/>"})
+	assert.False(t, spreadsheet.IsXLSX(data))
+	_, err = spreadsheet.ReadXLSX(data)
+	assert.ErrorContains(t, err, "missing part: xl/workbook.xml")
+}
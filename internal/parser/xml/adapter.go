@@ -49,13 +49,20 @@ func (r *Registry) Detect(content []byte) (Adapter, error) {
 	return nil, model.NewParseError(model.ProviderUnknown, "root", "unknown XML format, no matching adapter found", nil)
 }
 
-// Parse parses XML using appropriate adapter
+// Parse parses XML using appropriate adapter. Adjustment-decrease invoices,
+// written with negative amounts, come out as credit notes of positive ones
+// (see model.Invoice.NormalizeCreditNote).
 func (r *Registry) Parse(ctx context.Context, content []byte) (*model.Invoice, error) {
 	adapter, err := r.Detect(content)
 	if err != nil {
 		return nil, err
 	}
-	return adapter.Parse(ctx, bytes.NewReader(content))
+	inv, err := adapter.Parse(ctx, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	inv.NormalizeCreditNote()
+	return inv, nil
 }
 
 // RegisterAdapter adds a custom adapter to the registry
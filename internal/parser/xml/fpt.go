@@ -183,6 +183,7 @@ func (a *FPTAdapter) convertInvoice(inv *fptInvoice, rawXML []byte) (*model.Invo
 	if amt, err := decimal.NewFromString(inv.Totals.GrandTotal); err == nil {
 		result.TotalAmount = amt
 	}
+	result.TaxBreakdown = model.SummarizeVAT(result.Items)
 
 	// Convert seller signature (primary)
 	if inv.Signatures != nil && inv.Signatures.SellerSignature != nil {
@@ -202,8 +203,8 @@ func convertFPTLine(line fptLine) *model.LineItem {
 	}
 
 	// Parse VAT rate
-	if rate, err := decimal.NewFromString(line.VATRatePercent); err == nil {
-		result.VATRate = model.VATRate(rate.IntPart())
+	if rate, err := model.ParseVATRate(line.VATRatePercent); err == nil {
+		result.VATRate = rate
 	}
 
 	// Parse decimal fields
@@ -178,6 +178,7 @@ func (a *MISAAdapter) convertInvoice(inv *misaInvoice, rawXML []byte) (*model.In
 	if amt, err := decimal.NewFromString(inv.TotalSection.TongThanhToan); err == nil {
 		result.TotalAmount = amt
 	}
+	result.TaxBreakdown = model.SummarizeVAT(result.Items)
 
 	// Convert signature
 	if inv.SignatureInfo != nil {
@@ -197,8 +198,8 @@ func convertMISAItem(item misaItem) *model.LineItem {
 	}
 
 	// Parse VAT rate
-	if rate, err := decimal.NewFromString(item.ThueSuat); err == nil {
-		result.VATRate = model.VATRate(rate.IntPart())
+	if rate, err := model.ParseVATRate(item.ThueSuat); err == nil {
+		result.VATRate = rate
 	}
 
 	// Parse decimal fields
@@ -1,6 +1,7 @@
 package xml_test
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
@@ -145,7 +146,7 @@ func TestTCTAdapter_Parse(t *testing.T) {
 	assert.Equal(t, "Software License", invoice.Items[0].Name)
 	assert.True(t, invoice.Items[0].Quantity.Equal(decimal.NewFromInt(2)))
 	assert.True(t, invoice.Items[0].UnitPrice.Equal(decimal.NewFromInt(5000000)))
-	assert.Equal(t, model.VATRate10, invoice.Items[0].VATRate)
+	assert.True(t, model.VATRate10.Equal(invoice.Items[0].VATRate))
 
 	// Verify totals
 	assert.True(t, invoice.SubtotalAmount.Equal(decimal.NewFromInt(22000000)))
@@ -158,6 +159,17 @@ func TestTCTAdapter_Parse(t *testing.T) {
 	assert.Equal(t, "Director", invoice.Signature.SignerPosition)
 }
 
+// TestTCTAdapter_VATCategories tests lines outside VAT
+func TestTCTAdapter_VATCategories(t *testing.T) {
+	content := bytes.Replace(readTestFile(t, "tct_invoice.xml"), []byte("<TaxRatePercent>10</TaxRatePercent>"), []byte("<TaxRatePercent>KCT</TaxRatePercent>"), 1)
+
+	invoice, err := parseWithAdapter(t, xmlparser.NewTCTAdapter(), content)
+	require.NoError(t, err)
+	require.Len(t, invoice.Items, 2)
+	assert.True(t, model.VATRateKCT.Equal(invoice.Items[0].VATRate))
+	assert.True(t, model.VATRate10.Equal(invoice.Items[1].VATRate))
+}
+
 // TestVNPTAdapter tests VNPT XML parsing
 func TestVNPTAdapter_Parse(t *testing.T) {
 	content := readTestFile(t, "vnpt_invoice.xml")
@@ -269,6 +281,86 @@ func TestViettelAdapter_Parse(t *testing.T) {
 	assert.True(t, invoice.SubtotalAmount.Equal(decimal.NewFromInt(4100000)))
 	assert.True(t, invoice.TaxAmount.Equal(decimal.NewFromInt(410000)))
 	assert.True(t, invoice.TotalAmount.Equal(decimal.NewFromInt(4510000)))
+
+	// Without a per-rate summary the breakdown is summed from the items
+	require.Len(t, invoice.TaxBreakdown, 1)
+	assert.True(t, model.VATRate10.Equal(invoice.TaxBreakdown[0].Rate))
+	assert.True(t, invoice.TaxBreakdown[0].TaxAmount.Equal(decimal.NewFromInt(410000)))
+}
+
+// TestViettelAdapter_TaxBreakdown tests the per-rate summary of TToan
+func TestViettelAdapter_TaxBreakdown(t *testing.T) {
+	summary := `<THTTLTSuat>
+            <LTSuat><TSuat>10%</TSuat><ThTien>3600000</ThTien><TThue>360000</TThue></LTSuat>
+            <LTSuat><TSuat>5%</TSuat><ThTien>500000</ThTien><TThue>25000</TThue></LTSuat>
+        </THTTLTSuat>
+    </TToan>`
+	content := bytes.Replace(readTestFile(t, "viettel_invoice.xml"), []byte("</TToan>"), []byte(summary), 1)
+
+	invoice, err := parseWithAdapter(t, xmlparser.NewViettelAdapter(), content)
+	require.NoError(t, err)
+	require.Len(t, invoice.TaxBreakdown, 2)
+	assert.True(t, model.VATRate10.Equal(invoice.TaxBreakdown[0].Rate))
+	assert.True(t, invoice.TaxBreakdown[0].TaxableAmount.Equal(decimal.NewFromInt(3600000)))
+	assert.True(t, model.VATRate5.Equal(invoice.TaxBreakdown[1].Rate))
+	assert.True(t, invoice.TaxBreakdown[1].TaxAmount.Equal(decimal.NewFromInt(25000)))
+}
+
+func TestRegistry_ParseCreditNote(t *testing.T) {
+	content := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<HDon>
+    <TTChung>
+        <KHMSHDon>1C26TVT</KHMSHDon>
+        <SHDon>12</SHDon>
+        <NLap>2026-02-03</NLap>
+        <TTHDLQuan>
+            <TCHDon>2</TCHDon>
+            <KHMSHDCLQuan>1</KHMSHDCLQuan>
+            <KHHDCLQuan>C26TVT</KHHDCLQuan>
+            <SHDCLQuan>4</SHDCLQuan>
+            <NLHDCLQuan>2026-01-18</NLHDCLQuan>
+            <GChu>Giảm giá dịch vụ tháng 1</GChu>
+        </TTHDLQuan>
+    </TTChung>
+    <NBan><MST>0100100100</MST><Ten>Viettel Telecom Corporation</Ten></NBan>
+    <DSHHDVu>
+        <HHDVu>
+            <STT>1</STT>
+            <THHDVu>Fiber Internet 100Mbps</THHDVu>
+            <SLuong>1</SLuong>
+            <DGia>-100000</DGia>
+            <ThTien>-100000</ThTien>
+            <TSuat>10</TSuat>
+            <TThue>-10000</TThue>
+            <TgTToan>-110000</TgTToan>
+        </HHDVu>
+    </DSHHDVu>
+    <TToan>
+        <TgTCThue>-100000</TgTCThue>
+        <TgTThue>-10000</TgTThue>
+        <TgTTTBSo>-110000</TgTTTBSo>
+    </TToan>
+</HDon>`)
+
+	invoice, err := xmlparser.NewRegistry().Parse(context.Background(), content)
+	require.NoError(t, err)
+
+	assert.Equal(t, model.DocumentTypeCreditNote, invoice.DocumentType)
+	assert.Equal(t, model.InvoiceTypeAdjustment, invoice.Type)
+	require.NotNil(t, invoice.OriginalInvoice)
+	assert.Equal(t, "4", invoice.OriginalInvoice.Number)
+	assert.Equal(t, "1C26TVT", invoice.OriginalInvoice.Series)
+	assert.Equal(t, "2026-01-18", invoice.OriginalInvoice.Date.Format("2006-01-02"))
+	assert.Equal(t, "Giảm giá dịch vụ tháng 1", invoice.AdjustmentReason)
+
+	// Reductions are positive amounts
+	assert.True(t, invoice.TotalAmount.Equal(decimal.NewFromInt(110000)))
+	assert.True(t, invoice.TaxBreakdown[0].TaxableAmount.Equal(decimal.NewFromInt(100000)))
+	item := invoice.Items[0]
+	assert.True(t, item.Quantity.Equal(decimal.NewFromInt(1)))
+	assert.True(t, item.UnitPrice.Equal(decimal.NewFromInt(100000)))
+	assert.True(t, item.Amount.Equal(decimal.NewFromInt(100000)))
+	assert.True(t, item.VATAmount.Equal(decimal.NewFromInt(10000)))
 }
 
 // TestFPTAdapter tests FPT XML parsing
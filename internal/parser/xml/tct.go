@@ -36,6 +36,16 @@ type tctInvoice struct {
 	PaymentTerms   string    `xml:"PaymentTerms"`
 	Remarks        string    `xml:"Remarks"`
 	Signature      *tctSig   `xml:"Signature"`
+
+	// Replacements and adjustments
+	OriginalInvoice  *tctReference `xml:"OriginalInvoice"`
+	AdjustmentReason string        `xml:"AdjustmentReason"`
+}
+
+type tctReference struct {
+	InvoiceNo     string `xml:"InvoiceNo"`
+	InvoiceSeries string `xml:"InvoiceSeries"`
+	InvoiceDate   string `xml:"InvoiceDate"`
 }
 
 type tctParty struct {
@@ -62,7 +72,7 @@ type tctItem struct {
 	UnitPrice      string `xml:"UnitPrice"`
 	Discount       string `xml:"Discount"`
 	Amount         string `xml:"Amount"`
-	TaxRatePercent int    `xml:"TaxRatePercent"`
+	TaxRatePercent string `xml:"TaxRatePercent"`
 	TaxAmount      string `xml:"TaxAmount"`
 	LineTotal      string `xml:"LineTotal"`
 }
@@ -143,6 +153,13 @@ func (a *TCTAdapter) convertInvoice(inv *tctInvoice, rawXML []byte) (*model.Invo
 
 	// Parse invoice type
 	result.Type = parseInvoiceType(inv.InvoiceType)
+	if ref := inv.OriginalInvoice; ref != nil && ref.InvoiceNo != "" {
+		result.OriginalInvoice = &model.InvoiceReference{Number: ref.InvoiceNo, Series: ref.InvoiceSeries}
+		if date, err := parseDate(ref.InvoiceDate); err == nil {
+			result.OriginalInvoice.Date = date
+		}
+	}
+	result.AdjustmentReason = inv.AdjustmentReason
 
 	// Parse exchange rate
 	if rate, err := decimal.NewFromString(inv.ExchangeRate); err == nil {
@@ -172,6 +189,7 @@ func (a *TCTAdapter) convertInvoice(inv *tctInvoice, rawXML []byte) (*model.Invo
 	if amt, err := decimal.NewFromString(inv.TotalAmount); err == nil {
 		result.TotalAmount = amt
 	}
+	result.TaxBreakdown = model.SummarizeVAT(result.Items)
 
 	// Convert signature
 	if inv.Signature != nil {
@@ -200,7 +218,9 @@ func convertTCTItem(item tctItem) (*model.LineItem, error) {
 		Name:        item.ItemName,
 		Description: item.Description,
 		Unit:        item.UnitOfMeasure,
-		VATRate:     model.VATRate(item.TaxRatePercent),
+	}
+	if rate, err := model.ParseVATRate(item.TaxRatePercent); err == nil {
+		result.VATRate = rate
 	}
 
 	// Parse decimal fields
@@ -52,6 +52,16 @@ type viettelInvoiceInfo struct {
 	HTTToan   string `xml:"HTTToan"` // Payment method
 	THDon     string `xml:"THDon"` // Invoice status
 	GChu      string `xml:"GChu"` // Notes
+	Related   *viettelRelated `xml:"TTHDLQuan"` // Invoice replaced or adjusted
+}
+
+type viettelRelated struct {
+	TCHDon       string `xml:"TCHDon"` // 1 replacement, 2 adjustment
+	KHMSHDCLQuan string `xml:"KHMSHDCLQuan"` // Form of the related invoice
+	KHHDCLQuan   string `xml:"KHHDCLQuan"` // Series of the related invoice
+	SHDCLQuan    string `xml:"SHDCLQuan"` // Number of the related invoice
+	NLHDCLQuan   string `xml:"NLHDCLQuan"` // Date of the related invoice
+	GChu         string `xml:"GChu"` // Reason
 }
 
 type viettelParty struct {
@@ -88,6 +98,13 @@ type viettelSummary struct {
 	TgTThue   string `xml:"TgTThue"` // Total VAT
 	TgTTTBSo  string `xml:"TgTTTBSo"` // Total payment
 	TgTTTBChu string `xml:"TgTTTBChu"` // Amount in words
+	Rates []viettelRate `xml:"THTTLTSuat>LTSuat"` // Totals per VAT rate
+}
+
+type viettelRate struct {
+	TSuat  string `xml:"TSuat"` // VAT rate
+	ThTien string `xml:"ThTien"` // Amount before tax
+	TThue  string `xml:"TThue"` // VAT amount
 }
 
 type viettelSignBlock struct {
@@ -180,6 +197,7 @@ func (a *ViettelAdapter) convertInvoice(inv *viettelInvoice, rawXML []byte) (*mo
 
 	// Parse invoice type
 	result.Type = parseInvoiceType(invoiceInfo.LHDon)
+	convertViettelRelated(result, invoiceInfo.Related)
 
 	// Parse exchange rate
 	if rate, err := decimal.NewFromString(invoiceInfo.TGia); err == nil {
@@ -223,6 +241,10 @@ func (a *ViettelAdapter) convertInvoice(inv *viettelInvoice, rawXML []byte) (*mo
 	if amt, err := decimal.NewFromString(summary.TgTTTBSo); err == nil {
 		result.TotalAmount = amt
 	}
+	result.TaxBreakdown = convertViettelRates(summary.Rates)
+	if result.TaxBreakdown == nil {
+		result.TaxBreakdown = model.SummarizeVAT(result.Items)
+	}
 
 	// Convert signature (take first if available)
 	if inv.SignatureBlock != nil && len(inv.SignatureBlock.Signatures) > 0 {
@@ -232,6 +254,28 @@ func (a *ViettelAdapter) convertInvoice(inv *viettelInvoice, rawXML []byte) (*mo
 	return result, nil
 }
 
+// convertViettelRelated links a replacement or adjustment to the invoice it
+// replaces or adjusts
+func convertViettelRelated(result *model.Invoice, rel *viettelRelated) {
+	if rel == nil || rel.SHDCLQuan == "" {
+		return
+	}
+	result.OriginalInvoice = &model.InvoiceReference{
+		Number: rel.SHDCLQuan,
+		Series: rel.KHMSHDCLQuan + rel.KHHDCLQuan,
+	}
+	if date, err := parseDate(rel.NLHDCLQuan); err == nil {
+		result.OriginalInvoice.Date = date
+	}
+	result.AdjustmentReason = rel.GChu
+	switch rel.TCHDon {
+	case "1":
+		result.Type = model.InvoiceTypeReplacement
+	case "2":
+		result.Type = model.InvoiceTypeAdjustment
+	}
+}
+
 func convertViettelItem(item viettelItem) *model.LineItem {
 	result := &model.LineItem{
 		Number: item.STT,
@@ -240,9 +284,9 @@ func convertViettelItem(item viettelItem) *model.LineItem {
 		Unit:   item.DVTinh,
 	}
 
-	// Parse VAT rate (may be percentage string like "10" or "10%")
-	if rate, err := decimal.NewFromString(item.TSuat); err == nil {
-		result.VATRate = model.VATRate(rate.IntPart())
+	// Parse VAT rate (may be percentage string like "10" or "10%", or KCT)
+	if rate, err := model.ParseVATRate(item.TSuat); err == nil {
+		result.VATRate = rate
 	}
 
 	// Parse decimal fields
@@ -271,6 +315,27 @@ func convertViettelItem(item viettelItem) *model.LineItem {
 	return result
 }
 
+// convertViettelRates reads the per-rate totals of the summary, nil when
+// there are none or a rate can't be read
+func convertViettelRates(rates []viettelRate) []model.VATLine {
+	var lines []model.VATLine
+	for _, r := range rates {
+		rate, err := model.ParseVATRate(r.TSuat)
+		if err != nil {
+			return nil
+		}
+		line := model.VATLine{Rate: rate}
+		if amt, err := decimal.NewFromString(r.ThTien); err == nil {
+			line.TaxableAmount = amt
+		}
+		if vat, err := decimal.NewFromString(r.TThue); err == nil {
+			line.TaxAmount = vat
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
 func convertViettelSignature(sig *viettelSignature) *model.Signature {
 	result := &model.Signature{
 		Value:          sig.GTCKy,
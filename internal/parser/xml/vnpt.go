@@ -182,6 +182,7 @@ func (a *VNPTAdapter) convertInvoice(inv *vnptInvoice, rawXML []byte) (*model.In
 	if amt, err := decimal.NewFromString(inv.Summary.TotalPayment); err == nil {
 		result.TotalAmount = amt
 	}
+	result.TaxBreakdown = model.SummarizeVAT(result.Items)
 
 	// Convert signature
 	if inv.SignInfo != nil {
@@ -200,8 +201,8 @@ func convertVNPTProduct(prod vnptProduct) *model.LineItem {
 	}
 
 	// Parse VAT rate
-	if rate, err := decimal.NewFromString(prod.VATRate); err == nil {
-		result.VATRate = model.VATRate(rate.IntPart())
+	if rate, err := model.ParseVATRate(prod.VATRate); err == nil {
+		result.VATRate = rate
 	}
 
 	// Parse decimal fields
@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rezonia/invoice-processor/internal/address"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// WithAddressNormalization splits seller and buyer addresses into street, ward,
+// district and province with standardized names (Party.AddressParts). It is
+// rule-based and on by default.
+func WithAddressNormalization(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.addresses = enabled
+	}
+}
+
+// WithLLMAddressParsing sends addresses the rules cannot place down to the
+// ward and province to the LLM, in one request per document
+func WithLLMAddressParsing(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.llmAddresses = enabled
+	}
+}
+
+// normalizeAddresses fills AddressParts for the parties of inv and returns
+// warnings for LLM failures
+func (p *Pipeline) normalizeAddresses(ctx context.Context, inv *model.Invoice) []string {
+	var pending []*model.Party
+	for _, party := range []*model.Party{&inv.Seller, &inv.Buyer} {
+		if party.Address == "" {
+			continue
+		}
+		parts, complete := address.Parse(party.Address)
+		party.AddressParts = &parts
+		if !complete {
+			pending = append(pending, party)
+		}
+	}
+
+	if len(pending) == 0 || !p.llmAddresses || p.llmExtractor == nil {
+		return nil
+	}
+
+	addresses := make([]string, len(pending))
+	for i, party := range pending {
+		addresses[i] = party.Address
+	}
+	parsed, err := p.llmExtractor.ParseAddresses(ctx, addresses)
+	if err != nil {
+		return []string{fmt.Sprintf("LLM address parsing failed: %v", err)}
+	}
+	for i, party := range pending {
+		parts := address.Normalize(parsed[i])
+		party.AddressParts = &parts
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// DefaultBatchWorkers is how many documents ProcessBatch processes at once
+const DefaultBatchWorkers = 4
+
+// ErrBatchAborted is the error of inputs not processed because an earlier
+// one failed and BatchOptions.ContinueOnError is unset
+var ErrBatchAborted = errors.New("batch aborted after an earlier failure")
+
+// BatchInput is one file of a batch
+type BatchInput struct {
+	Name string // File name; used for format detection, Result.Source and audit document IDs
+	Data []byte
+}
+
+// BatchOptions configure ProcessBatch
+type BatchOptions struct {
+	Workers         int           // Inputs processed at once (default: DefaultBatchWorkers)
+	ContinueOnError bool          // Keep going after a failed document; otherwise the remaining inputs are skipped
+	Timeout         time.Duration // Per-input processing timeout (0 = none)
+	SplitDocuments  bool          // See ProcessOptions.SplitDocuments
+
+	// Interactive sends the LLM calls of the batch in the interactive lane.
+	// By default they wait in the batch lane, leaving free concurrency
+	// slots to single documents first (see llm.Priority); a priority set
+	// in the context wins.
+	Interactive bool
+
+	// Prices of the models used, keyed by model name, for BatchSummary.Cost
+	Prices map[string]llm.ModelPrice
+
+	// Done is called from the workers as each input finishes, with its
+	// index in the batch, to checkpoint or stream progress; inputs skipped
+	// or not finished because the pipeline was stopped (see Pipeline.Stop)
+	// are not reported
+	Done func(index int, input BatchInput, results []*Result)
+}
+
+// BatchSummary aggregates the results of a batch
+type BatchSummary struct {
+	Inputs    int // Inputs in the batch
+	Documents int // Documents processed; archives, emails and split PDFs hold several per input
+	Succeeded int
+	Failed    int
+	Skipped   int // Members that are not invoices (see ErrSkipped) and inputs not processed (see ErrBatchAborted, ErrStopped)
+
+	Usage    llm.Usage // LLM tokens used, cache hits excluded
+	Cost     float64   // USD, for the models priced in BatchOptions.Prices
+	Duration time.Duration
+}
+
+// ProcessBatch runs Process on each input with a pool of workers. Results
+// keep input order, with Result.Source naming the input (and the archive
+// member or attachment, if any); failed documents carry Result.Error.
+func (p *Pipeline) ProcessBatch(ctx context.Context, inputs []BatchInput, opts BatchOptions) ([]*Result, *BatchSummary) {
+	start := time.Now()
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	usage := llm.NewUsageMeter()
+	ctx = llm.ContextWithUsageMeter(ctx, usage)
+	ctx = p.withBatchBudget(ctx)
+	if _, ok := llm.PriorityFromContext(ctx); !ok && !opts.Interactive {
+		ctx = llm.ContextWithPriority(ctx, llm.PriorityBatch)
+	}
+
+	perInput := make([][]*Result, len(inputs))
+	jobs := make(chan int)
+	var aborted atomic.Bool
+	var wg sync.WaitGroup
+	for range min(workers, len(inputs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if aborted.Load() {
+					perInput[i] = []*Result{{Error: ErrBatchAborted, Source: inputs[i].Name}}
+					continue
+				}
+				perInput[i] = p.processInput(ctx, inputs[i], opts)
+				for _, result := range perInput[i] {
+					result.Source = joinSource(inputs[i].Name, result.Source)
+				}
+				if opts.Done != nil && !interrupted(perInput[i]) {
+					opts.Done(i, inputs[i], perInput[i])
+				}
+				if !opts.ContinueOnError && hasFailure(perInput[i]) {
+					aborted.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	summary := &BatchSummary{Inputs: len(inputs)}
+	var results []*Result
+	for _, inputResults := range perInput {
+		for _, result := range inputResults {
+			results = append(results, result)
+			switch {
+			case errors.Is(result.Error, ErrBatchAborted), errors.Is(result.Error, ErrSkipped), errors.Is(result.Error, ErrStopped):
+				summary.Skipped++
+			case result.Error != nil:
+				summary.Failed++
+			default:
+				summary.Succeeded++
+			}
+		}
+	}
+	summary.Documents = summary.Succeeded + summary.Failed
+	summary.Usage = usage.Total()
+	summary.Cost = usage.Cost(opts.Prices)
+	summary.Duration = time.Since(start)
+	return results, summary
+}
+
+// processInput processes one batch input under its own timeout and document ID
+func (p *Pipeline) processInput(ctx context.Context, input BatchInput, opts BatchOptions) []*Result {
+	if input.Name != "" {
+		ctx = llm.ContextWithDocumentID(ctx, input.Name)
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return []*Result{{Error: err}}
+	}
+	return p.Process(ctx, input.Data, ProcessOptions{Filename: input.Name, SplitDocuments: opts.SplitDocuments})
+}
+
+// interrupted reports whether the pipeline was stopped before results were
+// all finished
+func interrupted(results []*Result) bool {
+	for _, result := range results {
+		if errors.Is(result.Error, ErrStopped) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFailure(results []*Result) bool {
+	for _, result := range results {
+		if result.Error != nil && !errors.Is(result.Error, ErrSkipped) && !errors.Is(result.Error, ErrStopped) {
+			return true
+		}
+	}
+	return false
+}
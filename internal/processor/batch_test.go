@@ -0,0 +1,123 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestProcessBatch(t *testing.T) {
+	p := processor.NewPipeline()
+	inputs := []processor.BatchInput{
+		{Name: "a.xml", Data: []byte(processXML)},
+		{Name: "notes.txt", Data: []byte("not an invoice")},
+		{Name: "archive.zip", Data: buildZIP(t, map[string]string{"b.xml": processXML, "c.xml": processXML, "readme.txt": "hi"})},
+	}
+
+	results, summary := p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{Workers: 2, ContinueOnError: true})
+	require.Len(t, results, 5)
+	assert.Equal(t, "a.xml", results[0].Source)
+	assert.Equal(t, "notes.txt", results[1].Source)
+	assert.Error(t, results[1].Error)
+	assert.ElementsMatch(t, []string{"archive.zip/b.xml", "archive.zip/c.xml", "archive.zip/readme.txt"}, []string{results[2].Source, results[3].Source, results[4].Source})
+
+	assert.Equal(t, 3, summary.Inputs)
+	assert.Equal(t, 4, summary.Documents)
+	assert.Equal(t, 3, summary.Succeeded)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 1, summary.Skipped, "the readme in the archive")
+	assert.Zero(t, summary.Cost, "XML parsing makes no LLM calls")
+	assert.Positive(t, summary.Duration)
+}
+
+func TestProcessBatch_StopsOnError(t *testing.T) {
+	p := processor.NewPipeline()
+	inputs := []processor.BatchInput{
+		{Name: "bad.txt", Data: []byte("not an invoice")},
+		{Name: "a.xml", Data: []byte(processXML)},
+		{Name: "b.xml", Data: []byte(processXML)},
+	}
+
+	results, summary := p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{Workers: 1})
+	require.Len(t, results, 3)
+	assert.NotErrorIs(t, results[0].Error, processor.ErrBatchAborted)
+	assert.ErrorIs(t, results[1].Error, processor.ErrBatchAborted)
+	assert.ErrorIs(t, results[2].Error, processor.ErrBatchAborted)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 2, summary.Skipped)
+	assert.Equal(t, 1, summary.Documents)
+}
+
+// usageProvider answers with a fixed response reporting fixed token usage
+type usageProvider struct {
+	content string
+	usage   llm.Usage
+}
+
+func (p usageProvider) Name() string { return "usage" }
+
+func (p usageProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	return &llm.Response{Content: p.content, Model: req.Model, Usage: p.usage}, nil
+}
+
+func TestProcessBatch_Cost(t *testing.T) {
+	provider := usageProvider{
+		content: `{"invoice_number":"1","total_amount":1000}`,
+		usage:   llm.Usage{PromptTokens: 1000, CompletionTokens: 200, CachedPromptTokens: 400},
+	}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client, llm.WithVisionModel("vision"))))
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30))))
+	inputs := []processor.BatchInput{
+		{Name: "a.png", Data: buf.Bytes()},
+		{Name: "b.png", Data: buf.Bytes()},
+	}
+
+	// Per document: 600 × $3 + 400 × $1.5 + 200 × $15 per million tokens = $0.0054
+	prices := map[string]llm.ModelPrice{"vision": {Prompt: 3, CachedPrompt: 1.5, Completion: 15}}
+	results, summary := p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{Prices: prices})
+	require.Len(t, results, 2)
+	assert.Equal(t, 2, summary.Succeeded)
+	assert.Equal(t, llm.Usage{PromptTokens: 2000, CompletionTokens: 400, CachedPromptTokens: 800}, summary.Usage)
+	assert.InDelta(t, 0.0108, summary.Cost, 1e-9)
+}
+
+// priorityProvider records the priority of each request
+type priorityProvider struct {
+	mu         sync.Mutex
+	priorities []llm.Priority
+}
+
+func (p *priorityProvider) Name() string { return "priority" }
+
+func (p *priorityProvider) Complete(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	priority, _ := llm.PriorityFromContext(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.priorities = append(p.priorities, priority)
+	return &llm.Response{Content: `{"invoice_number":"1","total_amount":1000}`, Model: req.Model}, nil
+}
+
+func TestProcessBatch_Priority(t *testing.T) {
+	provider := &priorityProvider{}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client)))
+	inputs := []processor.BatchInput{{Name: "a.jpg", Data: []byte("\xff\xd8\xffscan a")}}
+
+	p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{})
+	p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{Interactive: true})
+	p.ProcessImage(context.Background(), []byte("png"), "image/png")
+
+	assert.Equal(t, []llm.Priority{llm.PriorityBatch, llm.PriorityInteractive, llm.PriorityInteractive}, provider.priorities)
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// ErrBudgetExceeded is the error of LLM calls refused because a cap of the
+// pipeline's budget is reached (see WithBudget)
+var ErrBudgetExceeded = errors.New("LLM budget exceeded")
+
+// Budget caps the estimated LLM spend of a pipeline, in USD. Calls are
+// priced as they finish, so a document started under a cap may end above it.
+type Budget struct {
+	Prices    map[string]llm.ModelPrice // By model; calls to other models are not counted
+	Daily     float64                   // Per UTC day, over all documents (0 = no cap)
+	PerTenant float64                   // Per tenant per UTC day (see WithTenants)
+	PerBatch  float64                   // Per ProcessBatch run
+
+	// Downgrade are the models documents are extracted with once a cap is
+	// reached. Without them, the LLM calls of those documents fail with
+	// ErrBudgetExceeded; documents that need none, such as XML invoices,
+	// are still processed.
+	Downgrade llm.Models
+}
+
+// BudgetController tracks the spend of the pipelines it is passed to (see
+// WithBudget) against a Budget. Spend is held in memory and starts over
+// each UTC day. It is safe for concurrent use.
+type BudgetController struct {
+	budget Budget
+	now    func() time.Time
+
+	mu      sync.Mutex
+	day     string
+	total   float64
+	tenants map[string]float64
+}
+
+// NewBudgetController returns a controller enforcing budget
+func NewBudgetController(budget Budget) *BudgetController {
+	return &BudgetController{budget: budget, now: time.Now, tenants: make(map[string]float64)}
+}
+
+// WithBudget enforces the budget of c on the documents of the pipeline.
+// Once a cap is reached, documents are extracted with the budget's
+// Downgrade models, or their LLM calls refused; the decision is recorded
+// in Result.Warnings. Several pipelines may share c.
+func WithBudget(c *BudgetController) PipelineOption {
+	return func(p *Pipeline) {
+		p.budget = c
+	}
+}
+
+// Spent returns the spend of the current UTC day of tenant, or of all
+// documents when tenant is ""
+func (c *BudgetController) Spent(tenant string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollover()
+	if tenant == "" {
+		return c.total
+	}
+	return c.tenants[tenant]
+}
+
+// rollover starts over on a new day. c.mu is held.
+func (c *BudgetController) rollover() {
+	if day := c.now().UTC().Format(time.DateOnly); day != c.day {
+		c.day, c.total = day, 0
+		clear(c.tenants)
+	}
+}
+
+// add counts the cost of a call made for tenant
+func (c *BudgetController) add(tenant string, batch *batchSpend, cost float64) {
+	c.mu.Lock()
+	c.rollover()
+	c.total += cost
+	if tenant != "" {
+		c.tenants[tenant] += cost
+	}
+	c.mu.Unlock()
+	if batch != nil {
+		batch.add(cost)
+	}
+}
+
+// exceeded describes the first cap reached by the documents of tenant, or
+// returns ""
+func (c *BudgetController) exceeded(tenant string, batch *batchSpend) string {
+	b := c.budget
+	c.mu.Lock()
+	c.rollover()
+	total, tenantTotal := c.total, c.tenants[tenant]
+	c.mu.Unlock()
+
+	switch {
+	case b.Daily > 0 && total >= b.Daily:
+		return fmt.Sprintf("daily LLM budget of $%.2f reached ($%.2f spent)", b.Daily, total)
+	case b.PerTenant > 0 && tenant != "" && tenantTotal >= b.PerTenant:
+		return fmt.Sprintf("daily LLM budget of $%.2f of tenant %s reached ($%.2f spent)", b.PerTenant, tenant, tenantTotal)
+	case b.PerBatch > 0 && batch != nil && batch.spent() >= b.PerBatch:
+		return fmt.Sprintf("LLM budget of $%.2f of the batch reached ($%.2f spent)", b.PerBatch, batch.spent())
+	}
+	return ""
+}
+
+// batchSpend sums the spend of one ProcessBatch run
+type batchSpend struct {
+	mu    sync.Mutex
+	total float64
+}
+
+type batchSpendKey struct{}
+
+func (s *batchSpend) add(cost float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total += cost
+}
+
+func (s *batchSpend) spent() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// documentBudget meters the LLM calls of one document and records the
+// budget decision taken for it
+type documentBudget struct {
+	c      *BudgetController
+	tenant string
+	batch  *batchSpend
+
+	mu       sync.Mutex
+	decision string
+}
+
+type documentBudgetKey struct{}
+
+// withBudget meters the LLM calls of a document against the budget. A
+// document started after a cap is reached gets the Downgrade models, or its
+// calls are refused; calls refused for a cap reached while it runs are
+// recorded too.
+func (p *Pipeline) withBudget(ctx context.Context) context.Context {
+	if p.budget == nil || ctx.Value(documentBudgetKey{}) != nil {
+		return ctx // Archive members are metered with their archive
+	}
+	batch, _ := ctx.Value(batchSpendKey{}).(*batchSpend)
+	d := &documentBudget{c: p.budget, tenant: TenantFromContext(ctx), batch: batch}
+	ctx = context.WithValue(ctx, documentBudgetKey{}, d)
+	ctx = llm.ContextWithInterceptor(ctx, d)
+
+	downgrade := p.budget.budget.Downgrade
+	if reason := p.budget.exceeded(d.tenant, batch); reason != "" && downgrade != (llm.Models{}) {
+		d.decide(reason + "; extracted with cheaper models")
+		return llm.ContextWithModels(ctx, downgrade)
+	}
+	if downgrade != (llm.Models{}) {
+		return ctx
+	}
+	return llm.ContextWithGate(ctx, func(ctx context.Context, req *llm.Request) error {
+		if reason := p.budget.exceeded(d.tenant, batch); reason != "" {
+			d.decide(reason + "; LLM extraction stopped")
+			return fmt.Errorf("%w: %s", ErrBudgetExceeded, reason)
+		}
+		return nil
+	})
+}
+
+// Intercept counts the cost of a finished call
+func (d *documentBudget) Intercept(_ context.Context, event *llm.AuditEvent) {
+	if event.Cached {
+		return
+	}
+	model := event.RequestedModel
+	if model == "" {
+		model = event.Model
+	}
+	if price, ok := d.c.budget.Prices[model]; ok {
+		d.c.add(d.tenant, d.batch, price.Cost(event.Usage))
+	}
+}
+
+// decide records the first budget decision taken for the document
+func (d *documentBudget) decide(decision string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.decision == "" {
+		d.decision = decision
+	}
+}
+
+// budgetDecision returns the budget decision taken for the document of ctx,
+// or ""
+func budgetDecision(ctx context.Context) string {
+	d, ok := ctx.Value(documentBudgetKey{}).(*documentBudget)
+	if !ok {
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.decision
+}
+
+// withBatchBudget meters the spend of a ProcessBatch run for Budget.PerBatch
+func (p *Pipeline) withBatchBudget(ctx context.Context) context.Context {
+	if p.budget == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, batchSpendKey{}, &batchSpend{})
+}
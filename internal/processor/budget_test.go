@@ -0,0 +1,108 @@
+package processor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// pricedProvider answers every request with a million prompt tokens, a
+// dollar at the prices of newBudgetPipeline
+type pricedProvider struct {
+	mu     sync.Mutex
+	models []string
+}
+
+func (p *pricedProvider) Name() string { return "priced" }
+
+func (p *pricedProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.models = append(p.models, req.Model)
+	return &llm.Response{
+		Content: `{"invoice_number":"0000042","total_amount":110000}`,
+		Model:   req.Model,
+		Usage:   llm.Usage{PromptTokens: 1_000_000},
+	}, nil
+}
+
+func newBudgetPipeline(budget processor.Budget, opts ...processor.PipelineOption) (*processor.Pipeline, *processor.BudgetController, *pricedProvider) {
+	provider := &pricedProvider{}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	extractor := llm.NewExtractor(client, llm.WithVisionModel("vision"), llm.WithRetryPolicy(llm.NoRetry))
+	budget.Prices = map[string]llm.ModelPrice{"vision": {Prompt: 1}, "cheap": {Prompt: 0.1}}
+	c := processor.NewBudgetController(budget)
+	opts = append(opts, processor.WithLLMExtractor(extractor), processor.WithBudget(c))
+	return processor.NewPipeline(opts...), c, provider
+}
+
+// budgetWarning returns the last warning of result, where the budget
+// decision goes
+func budgetWarning(result *processor.Result) string {
+	if len(result.Warnings) == 0 {
+		return ""
+	}
+	return result.Warnings[len(result.Warnings)-1]
+}
+
+func TestBudget_Stop(t *testing.T) {
+	p, c, _ := newBudgetPipeline(processor.Budget{Daily: 1.5})
+	ctx := context.Background()
+
+	for range 2 {
+		result := p.ProcessImage(ctx, []byte("png"), "image/png")
+		require.NoError(t, result.Error)
+		assert.NotContains(t, budgetWarning(result), "budget")
+	}
+	assert.InDelta(t, 2.0, c.Spent(""), 1e-9)
+
+	result := p.ProcessImage(ctx, []byte("png"), "image/png")
+	require.ErrorIs(t, result.Error, processor.ErrBudgetExceeded)
+	assert.Equal(t, "budget", processor.ErrorClass(result.Error))
+	assert.Contains(t, budgetWarning(result), "daily LLM budget of $1.50 reached")
+
+	result = p.ProcessXMLBytes(ctx, []byte(processXML))
+	assert.NoError(t, result.Error, "documents without LLM calls go on")
+}
+
+func TestBudget_DowngradePerTenant(t *testing.T) {
+	p, c, provider := newBudgetPipeline(
+		processor.Budget{PerTenant: 1, Downgrade: llm.Models{Vision: "cheap"}},
+		processor.WithTenants(map[string]processor.Tenant{"acme": {}, "globex": {}}),
+	)
+	acme := processor.ContextWithTenant(context.Background(), "acme")
+
+	require.NoError(t, p.ProcessImage(acme, []byte("png"), "image/png").Error)
+	result := p.ProcessImage(acme, []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	assert.Contains(t, budgetWarning(result), "of tenant acme reached")
+	assert.Contains(t, budgetWarning(result), "cheaper models")
+
+	result = p.ProcessImage(processor.ContextWithTenant(context.Background(), "globex"), []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	assert.NotContains(t, budgetWarning(result), "budget")
+
+	assert.Equal(t, []string{"vision", "cheap", "vision"}, provider.models)
+	assert.InDelta(t, 1.1, c.Spent("acme"), 1e-9)
+	assert.InDelta(t, 2.1, c.Spent(""), 1e-9)
+}
+
+func TestBudget_PerBatch(t *testing.T) {
+	p, _, _ := newBudgetPipeline(processor.Budget{PerBatch: 1})
+	inputs := []processor.BatchInput{
+		{Name: "a.jpg", Data: []byte("\xff\xd8\xffscan a")},
+		{Name: "b.jpg", Data: []byte("\xff\xd8\xffscan b")},
+	}
+
+	for range 2 {
+		results, summary := p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{Workers: 1, ContinueOnError: true})
+		assert.Equal(t, 1, summary.Succeeded, "each batch has its own budget")
+		assert.ErrorIs(t, results[1].Error, processor.ErrBudgetExceeded)
+	}
+}
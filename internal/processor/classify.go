@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// DocumentClass labels a document before extraction (see
+// WithDocumentClassifier)
+type DocumentClass string
+
+const (
+	ClassInvoice DocumentClass = "invoice"
+	ClassReceipt DocumentClass = "receipt"
+	ClassOther   DocumentClass = "other" // Contracts, quotations, delivery photos...; skipped
+	ClassUnknown DocumentClass = ""      // The classifier can't tell; extracted
+)
+
+// Classification is the class of a document and why it was given
+type Classification struct {
+	Class  DocumentClass
+	Reason string
+}
+
+// DocumentClassifier labels documents before the LLM reads them
+type DocumentClassifier interface {
+	// ClassifyDocument labels a document from its text or, when it has
+	// none, its page images
+	ClassifyDocument(ctx context.Context, text string, images []llm.Image) (Classification, error)
+}
+
+// DocumentClassifierFunc adapts a function to the DocumentClassifier interface
+type DocumentClassifierFunc func(ctx context.Context, text string, images []llm.Image) (Classification, error)
+
+// ClassifyDocument calls f
+func (f DocumentClassifierFunc) ClassifyDocument(ctx context.Context, text string, images []llm.Image) (Classification, error) {
+	return f(ctx, text, images)
+}
+
+var (
+	// Terms counted by KeywordClassifier, each distinct term once
+	invoiceTerms = regexp.MustCompile(`(?i)hóa đơn|hoá đơn|\binvoice\b|mã số thuế|\btax code\b|thuế gtgt|\bvat\b|tổng cộng|tổng tiền|thành tiền|\btotal\b|\bamount due\b|\bbill to\b`)
+	receiptTerms = regexp.MustCompile(`(?i)\breceipt\b|biên lai|bán lẻ|phiếu thu|tiền mặt|tiền thừa|\bcash\b|\bchange\b|\bthank you\b|cảm ơn quý khách`)
+	otherTerms   = regexp.MustCompile(`(?i)hợp đồng|\bcontract\b|\bagreement\b|điều khoản|\bterms and conditions\b|\bbên [ab]\b|\bparty [ab]\b|báo giá|\bquotation\b|biên bản`)
+
+	// classifyAmount matches an amount with thousands separators or cents
+	classifyAmount = regexp.MustCompile(`\d{1,3}(?:[.,]\d{3})+(?:[.,]\d{1,2})?|\d+[.,]\d{2}\b`)
+)
+
+// minProseWords is the length from which text with hardly any amounts reads
+// as prose, such as a contract or a letter
+const minProseWords = 300
+
+// KeywordClassifier labels documents from the terms and amounts of their
+// text, without an LLM. It says other only for text dominated by contract
+// and quotation terms, or long prose with hardly any amounts, and unknown
+// when there is no text, so a scan is never dropped unread.
+type KeywordClassifier struct{}
+
+// ClassifyDocument labels a document from its text; images are not read
+func (KeywordClassifier) ClassifyDocument(_ context.Context, text string, _ []llm.Image) (Classification, error) {
+	if strings.TrimSpace(text) == "" {
+		return Classification{}, nil
+	}
+	invoice := distinctTerms(invoiceTerms, text)
+	receipt := distinctTerms(receiptTerms, text)
+	other := distinctTerms(otherTerms, text)
+	amounts := len(classifyAmount.FindAllString(text, -1))
+	words := len(strings.Fields(text))
+
+	switch {
+	case len(other) >= 2 && len(other) > len(invoice)+len(receipt):
+		return Classification{ClassOther, "terms " + strings.Join(other, ", ")}, nil
+	case words >= minProseWords && amounts*100 < words && len(invoice)+len(receipt) <= 1:
+		return Classification{ClassOther, fmt.Sprintf("%d words of text with %d amounts", words, amounts)}, nil
+	case amounts == 0:
+		return Classification{}, nil
+	case len(receipt) >= 2 && len(receipt) > len(invoice):
+		return Classification{ClassReceipt, "terms " + strings.Join(receipt, ", ")}, nil
+	case len(invoice) >= 2:
+		return Classification{ClassInvoice, "terms " + strings.Join(invoice, ", ")}, nil
+	}
+	return Classification{}, nil
+}
+
+// distinctTerms returns the terms of re found in text, lowercased, in order
+// of first appearance
+func distinctTerms(re *regexp.Regexp, text string) []string {
+	var terms []string
+	for _, m := range re.FindAllString(text, -1) {
+		if term := strings.ToLower(m); !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// LLMClassifier labels documents KeywordClassifier can't tell, such as
+// scans and photos, with one request to a small model: the start of the
+// text, or the first page image
+type LLMClassifier struct {
+	extractor *llm.Extractor
+	model     string
+}
+
+// NewDocumentClassifier returns the classifier for WithDocumentClassifier:
+// an LLMClassifier asking model, or a KeywordClassifier alone without an
+// extractor or a model
+func NewDocumentClassifier(extractor *llm.Extractor, model string) DocumentClassifier {
+	if extractor == nil || model == "" {
+		return KeywordClassifier{}
+	}
+	return &LLMClassifier{extractor: extractor, model: model}
+}
+
+// ClassifyDocument labels a document from its keywords, or asks the model
+func (c *LLMClassifier) ClassifyDocument(ctx context.Context, text string, images []llm.Image) (Classification, error) {
+	if class, _ := (KeywordClassifier{}).ClassifyDocument(ctx, text, images); class.Class != ClassUnknown {
+		return class, nil
+	}
+	if strings.TrimSpace(text) == "" && len(images) == 0 {
+		return Classification{}, nil
+	}
+	resp, err := c.extractor.ClassifyDocument(ctx, c.model, text, images)
+	if err != nil {
+		return Classification{}, err
+	}
+	return Classification{Class: DocumentClass(resp.Class), Reason: resp.Reason}, nil
+}
+
+// WithDocumentClassifier labels documents before LLM extraction and skips
+// those classified other, such as contracts and delivery photos mixed into
+// an inbox, with an ErrSkipped error naming the reason. Documents read
+// from XML, templates or structured HTML and spreadsheets are not
+// classified.
+func WithDocumentClassifier(classifier DocumentClassifier) PipelineOption {
+	return func(p *Pipeline) {
+		p.classifier = classifier
+	}
+}
+
+// preclassify classifies a document before extraction, returning a skipped
+// result for one that is neither an invoice nor a receipt. A failed
+// classification is a warning; the document is extracted.
+func (p *Pipeline) preclassify(ctx context.Context, text string, images []llm.Image) (*Result, []string) {
+	if p.classifier == nil {
+		return nil, nil
+	}
+	var c Classification
+	err := p.runStage(ctx, StageClassify, func(ctx context.Context) (err error) {
+		c, err = p.classifier.ClassifyDocument(ctx, text, images)
+		return err
+	})
+	if err != nil {
+		return nil, []string{fmt.Sprintf("document classification failed: %v", err)}
+	}
+	if c.Class != ClassOther {
+		return nil, nil
+	}
+	return &Result{Error: fmt.Errorf("%w: classified as %s (%s)", ErrSkipped, c.Class, c.Reason)}, nil
+}
@@ -0,0 +1,92 @@
+package processor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const contractText = `HỢP ĐỒNG MUA BÁN HÀNG HÓA
+Số: 12/2024/HĐMB
+Bên A (Bên bán): Công ty TNHH ABC, mã số thuế 0101234567
+Bên B (Bên mua): Công ty CP XYZ
+Điều 1. Hàng hóa và giá trị hợp đồng: 100.000.000 VND
+Điều 2. Điều khoản thanh toán: chuyển khoản trong 30 ngày`
+
+func TestKeywordClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want processor.DocumentClass
+	}{
+		{"vat invoice", "HÓA ĐƠN GIÁ TRỊ GIA TĂNG\nMã số thuế: 0101234567\nThành tiền 1.000.000\nThuế GTGT 100.000\nTổng cộng 1.100.000", processor.ClassInvoice},
+		{"english invoice", "INVOICE #1042\nBill to: Acme Ltd\nSubtotal 90.00\nVAT 10.00\nTotal 100.00", processor.ClassInvoice},
+		{"receipt", "RECEIPT\nCoffee 45,000\nTotal 45,000\nCash 50,000\nChange 5,000\nThank you!", processor.ClassReceipt},
+		{"contract", contractText, processor.ClassOther},
+		{"letter", strings.Repeat("We are pleased to confirm the schedule of our meeting next week. ", 30), processor.ClassOther},
+		{"no amounts", "Invoice attached, VAT included", processor.ClassUnknown},
+		{"scan", "", processor.ClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := processor.KeywordClassifier{}.ClassifyDocument(context.Background(), tt.text, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c.Class, c.Reason)
+		})
+	}
+}
+
+func TestPreclassify_SkipsContract(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"1"}`}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(extractor),
+		processor.WithDocumentClassifier(processor.NewDocumentClassifier(extractor, "")),
+	)
+
+	result := p.ProcessText(context.Background(), contractText)
+	require.ErrorIs(t, result.Error, processor.ErrSkipped)
+	assert.Contains(t, result.Error.Error(), "classified as other (terms hợp đồng, bên a, bên b, điều khoản)")
+	assert.Nil(t, result.Invoice)
+	assert.Empty(t, provider.requests, "the extraction model is not called")
+}
+
+func TestPreclassify_AsksModelAboutImages(t *testing.T) {
+	provider := &stubProvider{content: `{"class":"other","reason":"photo of boxes on a pallet"}`}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(extractor),
+		processor.WithDocumentClassifier(processor.NewDocumentClassifier(extractor, "tiny-model")),
+	)
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.ErrorIs(t, result.Error, processor.ErrSkipped)
+	assert.Contains(t, result.Error.Error(), "photo of boxes on a pallet")
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, "tiny-model", provider.requests[0].Model)
+	assert.Equal(t, llm.SystemPromptDocumentClassifier, provider.requests[0].SystemPrompt)
+	assert.Equal(t, llm.UserPromptClassifyImage, provider.requests[0].UserPrompt)
+	assert.Len(t, provider.requests[0].Images, 1)
+}
+
+func TestPreclassify_FailureIsAWarning(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"0000042","date":"2024-03-15","total_amount":1100000}`}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(extractor),
+		processor.WithDocumentClassifier(processor.NewDocumentClassifier(extractor, "tiny-model")),
+	)
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.Contains(t, result.Warnings, `document classification failed: unknown document class ""`)
+	assert.Len(t, provider.requests, 2)
+}
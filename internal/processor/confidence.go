@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"math"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// ConfidenceSignals is the evidence Result.Confidence is computed from
+type ConfidenceSignals struct {
+	// Prior is the base confidence of the extraction method, such as
+	// ConfidenceLLMText; for ensemble results it also reflects how far the
+	// text and vision paths agree (see ConfidenceEnsembleAgreed)
+	Prior float64 `json:"prior"`
+
+	// Completeness is the share of key fields filled, from 0 to 1. XML
+	// invoices hold what the issuer sent and count as complete.
+	Completeness float64 `json:"completeness"`
+
+	// UncertainFields counts the fields the model reported it was unsure of
+	// (Invoice.LowConfidenceFields)
+	UncertainFields int `json:"uncertain_fields"`
+
+	// Validation findings by severity (see WithValidation)
+	ValidationErrors   int `json:"validation_errors"`
+	ValidationWarnings int `json:"validation_warnings"`
+}
+
+// ConfidenceScorer computes Result.Confidence from its signals
+type ConfidenceScorer func(s ConfidenceSignals) float64
+
+// WithConfidenceScorer replaces the scoring of results (default: ScoreConfidence)
+func WithConfidenceScorer(scorer ConfidenceScorer) PipelineOption {
+	return func(p *Pipeline) {
+		p.scorer = scorer
+	}
+}
+
+// ScoreConfidence is the default scorer. The prior is scaled down by up to
+// 20% for missing fields and 25% for uncertain ones (5% each), then each
+// validation finding subtracts its penalty. A complete LLM text extraction
+// that validates cleanly keeps ConfidenceLLMText; one missing its date and
+// total drops below the default review threshold.
+func ScoreConfidence(s ConfidenceSignals) float64 {
+	score := s.Prior * (0.8 + 0.2*s.Completeness)
+	score *= 1 - math.Min(0.05*float64(s.UncertainFields), 0.25)
+	score -= ValidationErrorPenalty*float64(s.ValidationErrors) + ValidationWarningPenalty*float64(s.ValidationWarnings)
+	return math.Round(math.Min(math.Max(score, 0), 1)*100) / 100
+}
+
+// score sets the confidence of a successful result from its signals
+func (p *Pipeline) score(result *Result) {
+	signals := ConfidenceSignals{
+		Prior:           result.Confidence,
+		Completeness:    1,
+		UncertainFields: len(result.Invoice.LowConfidenceFields),
+	}
+	if result.Method != MethodXML {
+		signals.Completeness = completeness(result.Invoice)
+	}
+	for _, f := range result.Findings {
+		if f.Severity == SeverityError {
+			signals.ValidationErrors++
+		} else {
+			signals.ValidationWarnings++
+		}
+	}
+
+	result.Signals = &signals
+	result.Confidence = p.scorer(signals)
+}
+
+// completeness is the share of the key fields of inv that are filled.
+// Receipts are measured against the fields a till prints.
+func completeness(inv *model.Invoice) float64 {
+	fields := []bool{
+		inv.Number != "",
+		!inv.Date.IsZero(),
+		inv.Seller.Name != "",
+		!inv.TotalAmount.IsZero(),
+		len(inv.Items) > 0,
+	}
+	if inv.IsTaxInvoice() {
+		fields = append(fields,
+			inv.Series != "",
+			inv.Seller.TaxID != "",
+			inv.Buyer.Name != "",
+			!inv.SubtotalAmount.IsZero(),
+			!inv.TaxAmount.IsZero(),
+		)
+	}
+
+	filled := 0
+	for _, ok := range fields {
+		if ok {
+			filled++
+		}
+	}
+	return float64(filled) / float64(len(fields))
+}
@@ -0,0 +1,46 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestScoreConfidence(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals processor.ConfidenceSignals
+		want    float64
+	}{
+		{"clean text extraction", processor.ConfidenceSignals{Prior: processor.ConfidenceLLMText, Completeness: 1}, 0.90},
+		{"half the fields", processor.ConfidenceSignals{Prior: processor.ConfidenceLLMText, Completeness: 0.5}, 0.81},
+		{"uncertain fields", processor.ConfidenceSignals{Prior: processor.ConfidenceLLMText, Completeness: 1, UncertainFields: 2}, 0.81},
+		{"uncertainty is capped", processor.ConfidenceSignals{Prior: 1, Completeness: 1, UncertainFields: 20}, 0.75},
+		{"validation findings", processor.ConfidenceSignals{Prior: 1, Completeness: 1, ValidationErrors: 1, ValidationWarnings: 1}, 0.80},
+		{"never negative", processor.ConfidenceSignals{Prior: 0.5, ValidationErrors: 5}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, processor.ScoreConfidence(tt.signals), 1e-9)
+		})
+	}
+}
+
+func TestPipeline_ConfidenceScorer(t *testing.T) {
+	p, _ := newStubPipeline(`{"invoice_number":"0000042","date":"2024-03-15","seller":{"name":"Công ty TNHH ABC","tax_id":"0123456789"},"total_amount":216000}`)
+	result := p.ProcessHTML(context.Background(), []byte("<html><body><p>Hóa đơn 0000042</p></body></html>"))
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Signals)
+	assert.Equal(t, processor.ConfidenceLLMText, result.Signals.Prior)
+	assert.InDelta(t, 0.5, result.Signals.Completeness, 1e-9)
+	assert.Less(t, result.Confidence, processor.ConfidenceLLMText)
+
+	p = processor.NewPipeline(processor.WithConfidenceScorer(func(s processor.ConfidenceSignals) float64 { return s.Completeness }))
+	result = p.ProcessXMLBytes(context.Background(), []byte(`<?xml version="1.0"?><Invoice><InvoiceNo>1</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller></Invoice>`))
+	require.NoError(t, result.Error)
+	assert.Equal(t, 1.0, result.Confidence, "XML counts as complete")
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadlineExceeded is the error of stages cut off, or not started, because
+// the deadline of their document passed (see WithDocumentDeadline)
+var ErrDeadlineExceeded = errors.New("document deadline exceeded")
+
+// DefaultStageShares caps each stage at a share of the document deadline, so
+// a stage that hangs leaves time for the fallback after it: a stuck PDF tool
+// for vision, a slow text extraction for rendering and vision. Stages not
+// listed may use all the time left.
+var DefaultStageShares = map[Stage]float64{
+	StageXMLParse:  0.2,
+	StagePDFText:   0.2,
+	StagePDFRender: 0.3,
+	StageClassify:  0.1,
+	StageLLMText:   0.6,
+	StageLLMVision: 1,
+}
+
+// WithDocumentDeadline bounds the extraction of each document to d, so one
+// pathological file doesn't hold a worker for minutes. Each stage may use
+// its share of d (see WithStageShares), and no more than is left. A stage
+// cut off fails with ErrDeadlineExceeded and the document returns what was
+// read in time: the page groups of a long scan, the invoices of a
+// multi-invoice PDF found before the deadline, or the error. Such results
+// have DeadlineExceeded set. Postprocessing and hooks are not bounded.
+// 0 = no deadline.
+func WithDocumentDeadline(d time.Duration) PipelineOption {
+	return func(p *Pipeline) {
+		p.deadline = d
+	}
+}
+
+// WithStageShares sets the share of the document deadline each stage may use,
+// from 0 to 1 (default: DefaultStageShares)
+func WithStageShares(shares map[Stage]float64) PipelineOption {
+	return func(p *Pipeline) {
+		p.stageShares = maps.Clone(shares)
+	}
+}
+
+// documentDeadline is the deadline of one document
+type documentDeadline struct {
+	total    time.Duration
+	expires  time.Time
+	exceeded atomic.Bool // A stage was cut off or not started
+}
+
+type deadlineKey struct{}
+
+// withDeadline gives a document its own deadline
+func (p *Pipeline) withDeadline(ctx context.Context) context.Context {
+	if p.deadline <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, deadlineKey{}, &documentDeadline{total: p.deadline, expires: time.Now().Add(p.deadline)})
+}
+
+// errStageDeadline is the cause of stage contexts canceled at their deadline
+var errStageDeadline = errors.New("stage deadline")
+
+// stageContext returns the context a stage runs with, canceled at the end of
+// the stage's share of the document deadline, or ErrDeadlineExceeded when
+// the document has no time left
+func (p *Pipeline) stageContext(ctx context.Context, stage Stage) (context.Context, context.CancelFunc, error) {
+	d, ok := ctx.Value(deadlineKey{}).(*documentDeadline)
+	if !ok {
+		return ctx, func() {}, nil
+	}
+	now := time.Now()
+	if !now.Before(d.expires) {
+		d.exceeded.Store(true)
+		return nil, nil, fmt.Errorf("%w: %s not started", ErrDeadlineExceeded, stage)
+	}
+	shares := p.stageShares
+	if shares == nil {
+		shares = DefaultStageShares
+	}
+	expires := d.expires
+	if share, ok := shares[stage]; ok {
+		expires = minTime(expires, now.Add(time.Duration(share*float64(d.total))))
+	}
+	stageCtx, cancel := context.WithDeadlineCause(ctx, expires, errStageDeadline)
+	return stageCtx, cancel, nil
+}
+
+// stageDeadlineError marks the document of a stage that reached its
+// deadline, which may still have returned part of its work, and returns
+// ErrDeadlineExceeded if the stage failed
+func stageDeadlineError(ctx, stageCtx context.Context, stage Stage, start time.Time, err error) error {
+	if ctx.Err() != nil || !errors.Is(context.Cause(stageCtx), errStageDeadline) {
+		return err
+	}
+	if d, ok := ctx.Value(deadlineKey{}).(*documentDeadline); ok {
+		d.exceeded.Store(true)
+	}
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s cut off after %s", ErrDeadlineExceeded, stage, time.Since(start).Round(time.Millisecond))
+}
+
+// deadlineExceeded marks a result of a document whose stages were cut off
+func deadlineExceeded(ctx context.Context, result *Result) {
+	d, ok := ctx.Value(deadlineKey{}).(*documentDeadline)
+	if !ok || !d.exceeded.Load() {
+		return
+	}
+	result.DeadlineExceeded = true
+	result.Warnings = append(result.Warnings, fmt.Sprintf("document deadline of %s exceeded; the result may be incomplete", d.total))
+	if result.Error != nil && !errors.Is(result.Error, ErrDeadlineExceeded) {
+		result.Error = fmt.Errorf("%w: %w", ErrDeadlineExceeded, result.Error)
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,84 @@
+package processor_test
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// slowProvider answers its first request and hangs on the others until
+// they are canceled
+type slowProvider struct {
+	mu       sync.Mutex
+	content  string
+	requests int
+}
+
+func (p *slowProvider) Name() string { return "slow" }
+
+func (p *slowProvider) Complete(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	p.requests++
+	first := p.requests == 1
+	p.mu.Unlock()
+	if first && p.content != "" {
+		return &llm.Response{Content: p.content, Model: req.Model}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newSlowPipeline(content string, opts ...processor.PipelineOption) *processor.Pipeline {
+	client := llm.NewClient("", llm.WithProvider(&slowProvider{content: content}))
+	return processor.NewPipeline(append([]processor.PipelineOption{processor.WithLLMExtractor(llm.NewExtractor(client))}, opts...)...)
+}
+
+func TestDocumentDeadline_CutsOffStage(t *testing.T) {
+	p := newSlowPipeline("",
+		processor.WithDocumentDeadline(400*time.Millisecond),
+		processor.WithStageShares(map[processor.Stage]float64{processor.StageLLMVision: 0.25}),
+	)
+
+	start := time.Now()
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	assert.Less(t, time.Since(start), 300*time.Millisecond, "the stage gets a quarter of the deadline")
+	require.ErrorIs(t, result.Error, processor.ErrDeadlineExceeded)
+	assert.Contains(t, result.Error.Error(), "llm_vision cut off after")
+	assert.True(t, result.DeadlineExceeded)
+	assert.Equal(t, "deadline", processor.ErrorClass(result.Error))
+}
+
+func TestDocumentDeadline_PartialPages(t *testing.T) {
+	p := newSlowPipeline(`{"invoice_number":"0000042","items":[{"number":1,"name":"Paper","amount":1000}]}`,
+		processor.WithMaxVisionPages(1),
+		processor.WithPageMerge(3),
+		processor.WithDocumentDeadline(200*time.Millisecond),
+	)
+	scan := multiPageTIFF(image.NewGray(image.Rect(0, 0, 40, 30)), image.NewGray(image.Rect(0, 0, 40, 30)), image.NewGray(image.Rect(0, 0, 40, 30)))
+
+	results := p.Process(context.Background(), scan, processor.ProcessOptions{Filename: "fax.tiff"})
+	require.Len(t, results, 1)
+	result := results[0]
+	require.NoError(t, result.Error, "the first page was read in time")
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.Len(t, result.Invoice.Items, 1)
+	assert.True(t, result.DeadlineExceeded)
+	assert.Contains(t, result.Warnings, "document deadline of 200ms exceeded; the result may be incomplete")
+	assert.Contains(t, result.Invoice.LowConfidenceFields, "items")
+}
+
+func TestDocumentDeadline_None(t *testing.T) {
+	p, _ := newStubPipeline(`{"invoice_number":"0000042","total_amount":1000}`)
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.False(t, result.DeadlineExceeded)
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+)
+
+// DebugOptions configures the debug mode (see WithDebug)
+type DebugOptions struct {
+	// ImageDir is where the page images sent to the vision model are
+	// written, for inspection (empty = not written)
+	ImageDir string
+}
+
+// DebugInfo holds the intermediate artifacts of a document: what the
+// extraction saw and what the model was asked and answered
+type DebugInfo struct {
+	Text   string       `json:"text,omitempty"` // Text extracted from, after the OnTextExtracted hooks
+	Images []DebugImage `json:"images,omitempty"`
+	Calls  []DebugCall  `json:"calls,omitempty"`
+}
+
+// DebugImage is a page image prepared for the vision model
+type DebugImage struct {
+	Page     int    `json:"page"` // 1-based
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+	Path     string `json:"path,omitempty"` // File in DebugOptions.ImageDir
+	Data     []byte `json:"-"`
+}
+
+// DebugCall is an LLM request and its raw response, before parsing
+type DebugCall struct {
+	Model        string        `json:"model"`
+	Schema       string        `json:"schema,omitempty"`
+	Images       int           `json:"images,omitempty"`
+	Cached       bool          `json:"cached,omitempty"`
+	Duration     time.Duration `json:"duration_ns"`
+	SystemPrompt string        `json:"system_prompt"`
+	UserPrompt   string        `json:"user_prompt"`
+	Response     string        `json:"response,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// WithDebug fills Result.Debug with the extracted text, the page images and
+// every LLM call of the document, so a wrong field can be traced back to
+// its input. Results get large: use it to investigate, not in production.
+func WithDebug(opts DebugOptions) PipelineOption {
+	return func(p *Pipeline) {
+		p.debug = &opts
+	}
+}
+
+// debugCollector gathers the artifacts of one document, whose stages may run
+// concurrently (see WithEnsemble)
+type debugCollector struct {
+	opts DebugOptions
+
+	mu     sync.Mutex
+	text   string
+	images []DebugImage
+}
+
+type debugKey struct{}
+
+// withDebug gives a document its own collector
+func (p *Pipeline) withDebug(ctx context.Context) context.Context {
+	if p.debug == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, debugKey{}, &debugCollector{opts: *p.debug})
+}
+
+func debugFromContext(ctx context.Context) *debugCollector {
+	c, _ := ctx.Value(debugKey{}).(*debugCollector)
+	return c
+}
+
+// debugText records the text an invoice is extracted from
+func debugText(ctx context.Context, text string) {
+	if c := debugFromContext(ctx); c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.text = text
+	}
+}
+
+// debugImages records the page images sent to the vision model, writing them
+// to the image directory if one is set
+func debugImages(ctx context.Context, images []llm.Image) {
+	c := debugFromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, img := range images {
+		sum := sha256.Sum256(img.Data)
+		debugImage := DebugImage{
+			Page:     i + 1,
+			MimeType: img.MimeType,
+			Size:     len(img.Data),
+			SHA256:   hex.EncodeToString(sum[:]),
+			Data:     img.Data,
+		}
+		if c.opts.ImageDir != "" {
+			path, err := c.writeImage(debugImage)
+			if err != nil {
+				logging.Warn(ctx, "failed to write debug image", "error", err)
+			}
+			debugImage.Path = path
+		}
+		c.images = append(c.images, debugImage)
+	}
+}
+
+func (c *debugCollector) writeImage(img DebugImage) (string, error) {
+	if err := os.MkdirAll(c.opts.ImageDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create debug image directory: %w", err)
+	}
+	ext := "img"
+	if _, sub, ok := strings.Cut(img.MimeType, "/"); ok {
+		ext = sub
+	}
+	// Named by content, so documents never overwrite each other's pages
+	path := filepath.Join(c.opts.ImageDir, img.SHA256[:16]+"."+ext)
+	if err := os.WriteFile(path, img.Data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write debug image: %w", err)
+	}
+	return path, nil
+}
+
+// debugInfo returns the artifacts collected for the document of ctx
+func debugInfo(ctx context.Context) *DebugInfo {
+	c := debugFromContext(ctx)
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := &DebugInfo{Text: c.text, Images: c.images}
+	for _, event := range llmCalls(ctx) {
+		info.Calls = append(info.Calls, DebugCall{
+			Model:        event.Model,
+			Schema:       event.Schema,
+			Images:       event.Images,
+			Cached:       event.Cached,
+			Duration:     event.Duration,
+			SystemPrompt: event.SystemPrompt,
+			UserPrompt:   event.UserPrompt,
+			Response:     event.Response,
+			Error:        event.Error,
+		})
+	}
+	return info
+}
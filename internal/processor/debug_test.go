@@ -0,0 +1,70 @@
+package processor_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func newDebugPipeline(content string, opts processor.DebugOptions) *processor.Pipeline {
+	client := llm.NewClient("", llm.WithProvider(&stubProvider{content: content}))
+	return processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client)),
+		processor.WithDebug(opts),
+	)
+}
+
+func TestDebug_Text(t *testing.T) {
+	p := newDebugPipeline(`{"invoice_number":"0000042","total_amount":110000}`, processor.DebugOptions{})
+
+	result := p.ProcessHTML(context.Background(), []byte("<html><body><p>Số hóa đơn: 0000042</p></body></html>"))
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Debug)
+	assert.Contains(t, result.Debug.Text, "Số hóa đơn: 0000042")
+	assert.Empty(t, result.Debug.Images)
+
+	require.Len(t, result.Debug.Calls, 1)
+	call := result.Debug.Calls[0]
+	assert.NotEmpty(t, call.SystemPrompt)
+	assert.Contains(t, call.UserPrompt, "Số hóa đơn: 0000042")
+	assert.JSONEq(t, `{"invoice_number":"0000042","total_amount":110000}`, call.Response)
+}
+
+func TestDebug_Images(t *testing.T) {
+	dir := t.TempDir()
+	p := newDebugPipeline(`{"invoice_number":"0000042"}`, processor.DebugOptions{ImageDir: dir})
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Debug)
+	require.Len(t, result.Debug.Images, 1)
+
+	img := result.Debug.Images[0]
+	assert.Equal(t, 1, img.Page)
+	assert.Equal(t, 4, img.Size)
+	data, err := os.ReadFile(img.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(data))
+
+	require.Len(t, result.Debug.Calls, 1)
+	assert.Equal(t, 1, result.Debug.Calls[0].Images)
+
+	encoded, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"debug":{`)
+	assert.NotContains(t, string(encoded), `"data"`, "image data stays out of the JSON")
+}
+
+func TestDebug_Off(t *testing.T) {
+	p, _ := newStubPipeline(`{"invoice_number":"0000042"}`)
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Nil(t, result.Debug)
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// DuplicateStore remembers the invoice fingerprints the pipeline has seen.
+// Share one store between the pipelines fed by email, portal downloads and
+// uploads to catch the same invoice arriving twice.
+type DuplicateStore interface {
+	// Remember records fp for the document doc. When fp was recorded
+	// before, it returns the document it was first recorded for and true.
+	// Fingerprints are those of the tenant of ctx (see TenantFromContext).
+	Remember(ctx context.Context, fp, doc string) (first string, seen bool, err error)
+}
+
+// WithDuplicateStore checks the fingerprint of every invoice (see
+// model.Invoice.Fingerprint) against store.
+// An invoice already seen under another document is flagged
+// Result.Duplicate, with a warning naming the first document (its document
+// ID, see llm.ContextWithDocumentID).
+func WithDuplicateStore(store DuplicateStore) PipelineOption {
+	return func(p *Pipeline) {
+		p.duplicates = store
+	}
+}
+
+// checkDuplicate fingerprints a successful result and looks it up in the store
+func (p *Pipeline) checkDuplicate(ctx context.Context, result *Result) {
+	result.Fingerprint = result.Invoice.Fingerprint()
+	if p.duplicates == nil || result.Fingerprint == "" {
+		return
+	}
+
+	doc := llm.DocumentIDFromContext(ctx)
+	first, seen, err := p.duplicates.Remember(ctx, result.Fingerprint, doc)
+	switch {
+	case err != nil:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("duplicate check failed: %v", err))
+	case seen && (first != doc || doc == ""):
+		// The same document processed again is not a duplicate of itself
+		result.Duplicate = true
+		result.DuplicateOf = first
+		if first == "" {
+			first = "an earlier document"
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("possible duplicate of %s", first))
+	}
+}
+
+// MemoryDuplicateStore is a DuplicateStore held in memory, for one process
+type MemoryDuplicateStore struct {
+	mu   sync.Mutex
+	seen map[string]string
+}
+
+// NewMemoryDuplicateStore returns an empty in-memory store
+func NewMemoryDuplicateStore() *MemoryDuplicateStore {
+	return &MemoryDuplicateStore{seen: make(map[string]string)}
+}
+
+// Remember implements DuplicateStore
+func (s *MemoryDuplicateStore) Remember(ctx context.Context, fp, doc string) (string, bool, error) {
+	fp = tenantScoped(TenantFromContext(ctx), fp)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if first, ok := s.seen[fp]; ok {
+		return first, true, nil
+	}
+	s.seen[fp] = doc
+	return "", false, nil
+}
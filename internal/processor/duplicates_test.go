@@ -0,0 +1,42 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+type failingDuplicateStore struct{}
+
+func (failingDuplicateStore) Remember(context.Context, string, string) (string, bool, error) {
+	return "", false, errors.New("database is locked")
+}
+
+func TestPipeline_Duplicates(t *testing.T) {
+	p := processor.NewPipeline(processor.WithDuplicateStore(processor.NewMemoryDuplicateStore()))
+	xmlData := []byte(`<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`)
+
+	result := p.ProcessXMLBytes(llm.ContextWithDocumentID(context.Background(), "portal/0000042.xml"), xmlData)
+	require.NoError(t, result.Error)
+	assert.NotEmpty(t, result.Fingerprint)
+	assert.False(t, result.Duplicate)
+
+	// Reprocessing the same document is not a duplicate
+	result = p.ProcessXMLBytes(llm.ContextWithDocumentID(context.Background(), "portal/0000042.xml"), xmlData)
+	assert.False(t, result.Duplicate)
+
+	result = p.ProcessXMLBytes(llm.ContextWithDocumentID(context.Background(), "email/invoice.xml"), xmlData)
+	assert.True(t, result.Duplicate)
+	assert.Equal(t, "portal/0000042.xml", result.DuplicateOf)
+	assert.Contains(t, result.Warnings, "possible duplicate of portal/0000042.xml")
+
+	result = processor.NewPipeline(processor.WithDuplicateStore(failingDuplicateStore{})).ProcessXMLBytes(context.Background(), xmlData)
+	require.NoError(t, result.Error)
+	assert.Contains(t, result.Warnings, "duplicate check failed: database is locked")
+}
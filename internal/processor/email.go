@@ -0,0 +1,311 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/parser/msg"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// Submission is the email a document was attached to. The results of the
+// documents of one message share it (see GroupBySubmission).
+type Submission struct {
+	ID      string    `json:"id"` // Message-ID, or a digest of the message when it has none
+	From    string    `json:"from,omitempty"`
+	Subject string    `json:"subject,omitempty"`
+	Date    time.Time `json:"date,omitzero"`
+}
+
+type submissionKey struct{}
+
+// contextWithSubmission tags the documents processed with ctx as attached
+// to submission
+func contextWithSubmission(ctx context.Context, submission *Submission) context.Context {
+	return context.WithValue(ctx, submissionKey{}, submission)
+}
+
+func submissionFromContext(ctx context.Context) *Submission {
+	submission, _ := ctx.Value(submissionKey{}).(*Submission)
+	return submission
+}
+
+// SubmissionResults are the results of the documents of one submission
+type SubmissionResults struct {
+	Submission *Submission // Nil for a document that was not emailed
+	Results    []*Result
+}
+
+// GroupBySubmission groups results by the email they came from, in the
+// order of their first result. A result without a submission is a group of
+// its own.
+func GroupBySubmission(results []*Result) []SubmissionResults {
+	var groups []SubmissionResults
+	index := make(map[*Submission]int)
+	for _, r := range results {
+		if i, ok := index[r.Submission]; ok {
+			groups[i].Results = append(groups[i].Results, r)
+			continue
+		}
+		if r.Submission != nil {
+			index[r.Submission] = len(groups)
+		}
+		groups = append(groups, SubmissionResults{Submission: r.Submission, Results: []*Result{r}})
+	}
+	return groups
+}
+
+// ProcessText extracts an invoice from plain text, such as the body of an
+// email sent without attachments, like PDF text
+func (p *Pipeline) ProcessText(ctx context.Context, text string) *Result {
+	ctx, span := p.startDocument(ctx, "text")
+	defer span.End()
+
+	if strings.TrimSpace(text) == "" {
+		return p.finish(ctx, &Result{Error: fmt.Errorf("no text")})
+	}
+	return p.finish(ctx, p.extractText(ctx, text, pdf.Metadata{}))
+}
+
+// email is a message read for the documents it holds
+type email struct {
+	submission *Submission
+	files      []containerFile
+
+	// text is the plain text body of a message without documents, if it
+	// mentions an invoice, to be read as one
+	text string
+}
+
+// A plain text body is worth reading as an invoice when it names one and
+// has an amount
+var (
+	invoiceWords  = regexp.MustCompile(`(?i)\b(invoice|receipt|hóa đơn|hoá đơn|biên lai)\b`)
+	invoiceAmount = regexp.MustCompile(`\d[\d.,]{2,}`)
+)
+
+// readEmail reads an RFC 822 message: its attachments, walking nested
+// multipart bodies. Inline bodies are not returned, except for a message
+// without attachments: its HTML body as "body.html", as some vendors send
+// the invoice itself as the message, or else a plain text body mentioning
+// an invoice.
+func readEmail(data []byte) (*email, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %w", err)
+	}
+
+	var parts mimeParts
+	err = parts.walk(m.Header.Get("Content-Type"), m.Header.Get("Content-Disposition"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %w", err)
+	}
+
+	dec := new(mime.WordDecoder)
+	header := func(name string) string {
+		value := m.Header.Get(name)
+		if decoded, err := dec.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+	date, _ := m.Header.Date()
+	e := &email{
+		submission: &Submission{
+			ID:      submissionID(m.Header.Get("Message-ID"), data),
+			From:    header("From"),
+			Subject: header("Subject"),
+			Date:    date.UTC(),
+		},
+		files: parts.files,
+	}
+	if len(e.files) == 0 {
+		e.bodies(parts.html, string(parts.text))
+	}
+	return e, nil
+}
+
+// readOutlookMessage reads an Outlook .msg file like readEmail. The files
+// of attached messages, such as forwarded emails, are named after the
+// message, as in "Fwd: receipt/0000042.xml".
+func readOutlookMessage(data []byte) (*email, error) {
+	m, err := msg.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	e := &email{submission: &Submission{
+		ID:      submissionID(m.MessageID, data),
+		From:    m.From,
+		Subject: m.Subject,
+		Date:    m.Date,
+	}}
+	if err := e.outlookFiles(m, ""); err != nil {
+		return nil, err
+	}
+	if len(e.files) == 0 {
+		e.bodies(m.HTML, m.Body)
+	}
+	return e, nil
+}
+
+// outlookFiles collects the attachments of an Outlook message and its
+// attached messages, prefixing their names
+func (e *email) outlookFiles(m *msg.Message, prefix string) error {
+	for _, a := range m.Attachments {
+		name := strings.ReplaceAll(a.Name, "/", "_")
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d", len(e.files)+1)
+		}
+		switch {
+		case a.Hidden:
+			continue // Inline image, such as a logo in the body
+		case a.Message != nil:
+			if err := e.outlookFiles(a.Message, prefix+name+"/"); err != nil {
+				return err
+			}
+			continue
+		case len(a.Data) == 0:
+			continue
+		case len(a.Data) > maxMemberSize:
+			return fmt.Errorf("attachment %s is larger than %d bytes", name, maxMemberSize)
+		case len(e.files) == maxContainerMembers:
+			return fmt.Errorf("email has more than %d attachments", maxContainerMembers)
+		}
+		e.files = append(e.files, containerFile{name: prefix + name, data: a.Data})
+	}
+	return nil
+}
+
+// bodies keeps the body of a message without attachments: the HTML body as
+// a document, or else the text body if it reads like an invoice
+func (e *email) bodies(html []byte, text string) {
+	switch {
+	case len(bytes.TrimSpace(html)) > 0:
+		e.files = []containerFile{{name: "body.html", data: html}}
+	case invoiceWords.MatchString(text) && invoiceAmount.MatchString(text):
+		e.text = text
+	}
+}
+
+// submissionID returns a Message-ID without its angle brackets, or a digest
+// of the message
+func submissionID(messageID string, data []byte) string {
+	if id := strings.Trim(strings.TrimSpace(messageID), "<>"); id != "" {
+		return id
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// mimeParts collects the attachments and the first HTML and plain text
+// bodies of a message
+type mimeParts struct {
+	files []containerFile
+	html  []byte
+	text  []byte
+}
+
+// walk collects the attachments of one MIME part and its children
+func (m *mimeParts) walk(contentType, disposition, encoding string, body io.Reader) error {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = m.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	name := attachmentName(disposition, params)
+	if name == "" && mediaType == "text/html" && m.html == nil {
+		content, err := io.ReadAll(io.LimitReader(decodeTransfer(body, encoding), maxMemberSize))
+		if err != nil {
+			return fmt.Errorf("failed to read HTML body: %w", err)
+		}
+		m.html = content
+		return nil
+	}
+	if name == "" && (mediaType == "" || mediaType == "text/plain") && m.text == nil {
+		content, err := io.ReadAll(io.LimitReader(decodeTransfer(body, encoding), maxMemberSize))
+		if err != nil {
+			return fmt.Errorf("failed to read text body: %w", err)
+		}
+		m.text = content
+		return nil
+	}
+	if name == "" && (mediaType == "" || strings.HasPrefix(mediaType, "text/")) {
+		return nil // Message body
+	}
+	if kind, _, _ := mime.ParseMediaType(disposition); name == "" && kind == "inline" {
+		return nil // Unnamed inline image, such as a logo in the body
+	}
+	if len(m.files) == maxContainerMembers {
+		return fmt.Errorf("email has more than %d attachments", maxContainerMembers)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(decodeTransfer(body, encoding), maxMemberSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read attachment %s: %w", name, err)
+	}
+	if len(content) > maxMemberSize {
+		return fmt.Errorf("attachment %s is larger than %d bytes", name, maxMemberSize)
+	}
+	if name == "" {
+		name = fmt.Sprintf("attachment-%d", len(m.files)+1)
+	}
+	m.files = append(m.files, containerFile{name: name, data: content})
+	return nil
+}
+
+// attachmentName returns the file name from Content-Disposition, or the
+// legacy name parameter of Content-Type
+func attachmentName(disposition string, typeParams map[string]string) string {
+	dec := new(mime.WordDecoder)
+	if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+		if name, err := dec.DecodeHeader(params["filename"]); err == nil {
+			return path.Base(name)
+		}
+		return path.Base(params["filename"])
+	}
+	if typeParams["name"] != "" {
+		if name, err := dec.DecodeHeader(typeParams["name"]); err == nil {
+			return path.Base(name)
+		}
+		return path.Base(typeParams["name"])
+	}
+	return ""
+}
+
+// decodeTransfer undoes a Content-Transfer-Encoding
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// Confidence levels for ensemble extraction
+const (
+	ConfidenceEnsembleAgreed   = 0.92 // Text and vision paths agree on every field
+	ConfidenceEnsembleConflict = 0.80 // Paths disagree on some fields, totals match
+	ConfidenceEnsembleTotals   = 0.60 // Paths disagree on totals; below the default review threshold
+)
+
+// WithEnsemble runs the text and vision paths together for PDFs and merges
+// their results field by field instead of using vision only as a fallback
+func WithEnsemble(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.ensemble = enabled
+	}
+}
+
+// tryEnsembleExtraction runs text and vision extraction concurrently
+func (p *Pipeline) tryEnsembleExtraction(ctx context.Context, pdfData []byte, mimeType string) (textResult, visionResult *Result) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		textResult = p.tryLLMTextExtraction(ctx, pdfData)
+	}()
+	go func() {
+		defer wg.Done()
+		visionResult = p.tryLLMVisionExtraction(ctx, pdfData, mimeType)
+	}()
+	wg.Wait()
+
+	return textResult, visionResult
+}
+
+// mergeResults combines text and vision results. When only one path succeeded
+// its result is returned as is; when neither did, nil is returned.
+func mergeResults(textResult, visionResult *Result) *Result {
+	textOK := textResult.Invoice != nil && textResult.Error == nil
+	visionOK := visionResult.Invoice != nil && visionResult.Error == nil
+
+	switch {
+	case textOK && visionOK:
+	case textOK:
+		textResult.Warnings = append(textResult.Warnings, visionResult.Warnings...)
+		return textResult
+	case visionOK:
+		visionResult.Warnings = append(visionResult.Warnings, textResult.Warnings...)
+		return visionResult
+	default:
+		return nil
+	}
+
+	invoice, conflicts := mergeInvoices(textResult.Invoice, visionResult.Invoice)
+
+	result := &Result{
+		Invoice:    invoice,
+		Method:     MethodLLMEnsemble,
+		Confidence: ConfidenceEnsembleAgreed,
+		Warnings:   append(textResult.Warnings, visionResult.Warnings...),
+
+		HasHandwriting: invoice.HasHandwriting,
+	}
+	if len(conflicts) > 0 {
+		result.Confidence = ConfidenceEnsembleConflict
+		for _, field := range conflicts {
+			if isTotalField(field) {
+				result.Confidence = ConfidenceEnsembleTotals
+				break
+			}
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("text and vision extraction disagree on: %s", strings.Join(conflicts, ", ")))
+	}
+
+	return result
+}
+
+// mergeInvoices merges vision into text field by field. Empty text fields are
+// filled from vision; where both are set and differ, the text value (read from
+// the PDF text layer) is kept and the field is reported as a conflict and
+// added to LowConfidenceFields.
+func mergeInvoices(text, vision *model.Invoice) (*model.Invoice, []string) {
+	merged := *text
+	var conflicts []string
+
+	mergeString(&conflicts, "number", &merged.Number, vision.Number)
+	mergeString(&conflicts, "series", &merged.Series, vision.Series)
+	mergeValue(&conflicts, "date", &merged.Date, vision.Date, time.Time.IsZero, time.Time.Equal)
+	mergeParty(&conflicts, "seller", &merged.Seller, vision.Seller)
+	mergeParty(&conflicts, "buyer", &merged.Buyer, vision.Buyer)
+	mergeDecimal(&conflicts, "subtotal_amount", &merged.SubtotalAmount, vision.SubtotalAmount)
+	mergeDecimal(&conflicts, "tax_amount", &merged.TaxAmount, vision.TaxAmount)
+	mergeDecimal(&conflicts, "total_amount", &merged.TotalAmount, vision.TotalAmount)
+	mergeString(&conflicts, "currency", &merged.Currency, vision.Currency)
+
+	switch {
+	case len(merged.Items) == 0:
+		merged.Items = vision.Items
+	case len(vision.Items) == 0:
+	case len(merged.Items) != len(vision.Items):
+		conflicts = append(conflicts, "items")
+	default:
+		merged.Items = append([]model.LineItem(nil), merged.Items...)
+		for i := range merged.Items {
+			mergeDecimal(&conflicts, fmt.Sprintf("items[%d].total", i), &merged.Items[i].Total, vision.Items[i].Total)
+		}
+	}
+
+	// Only the vision path can locate fields on the page or see handwriting
+	if merged.FieldLocations == nil {
+		merged.FieldLocations = vision.FieldLocations
+	}
+	merged.HasHandwriting = text.HasHandwriting || vision.HasHandwriting
+	merged.HandwrittenFields = appendUnique(slices.Clone(text.HandwrittenFields), vision.HandwrittenFields...)
+	merged.Corrections = appendUnique(slices.Clone(text.Corrections), vision.Corrections...)
+
+	merged.LowConfidenceFields = appendUnique(nil, text.LowConfidenceFields...)
+	merged.LowConfidenceFields = appendUnique(merged.LowConfidenceFields, vision.LowConfidenceFields...)
+	merged.LowConfidenceFields = appendUnique(merged.LowConfidenceFields, conflicts...)
+
+	return &merged, conflicts
+}
+
+func mergeParty(conflicts *[]string, path string, dst *model.Party, other model.Party) {
+	mergeString(conflicts, path+".name", &dst.Name, other.Name)
+	mergeString(conflicts, path+".tax_id", &dst.TaxID, other.TaxID)
+	mergeString(conflicts, path+".address", &dst.Address, other.Address)
+	mergeString(conflicts, path+".phone", &dst.Phone, other.Phone)
+	mergeString(conflicts, path+".email", &dst.Email, other.Email)
+	mergeString(conflicts, path+".bank_account", &dst.BankAccount, other.BankAccount)
+	mergeString(conflicts, path+".bank_name", &dst.BankName, other.BankName)
+}
+
+func mergeString(conflicts *[]string, path string, dst *string, other string) {
+	mergeValue(conflicts, path, dst, other, isBlank, sameText)
+}
+
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// sameText compares extracted text ignoring case and spacing
+func sameText(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+func mergeDecimal(conflicts *[]string, path string, dst *decimal.Decimal, other decimal.Decimal) {
+	mergeValue(conflicts, path, dst, other, decimal.Decimal.IsZero, decimal.Decimal.Equal)
+}
+
+// mergeValue fills an empty dst from other and records a conflict when both are set and differ
+func mergeValue[T any](conflicts *[]string, path string, dst *T, other T, isZero func(T) bool, equal func(a, b T) bool) {
+	switch {
+	case isZero(other):
+	case isZero(*dst):
+		*dst = other
+	case !equal(*dst, other):
+		*conflicts = append(*conflicts, path)
+	}
+}
+
+// isTotalField reports whether a conflicting field is a document total
+func isTotalField(field string) bool {
+	return field == "total_amount" || field == "subtotal_amount" || field == "tax_amount"
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
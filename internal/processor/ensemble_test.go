@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestMergeResults(t *testing.T) {
+	date := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	text := &model.Invoice{
+		Number:      "12",
+		Seller:      model.Party{Name: "CONG TY ACME", TaxID: "0312345678"},
+		TotalAmount: decimal.NewFromInt(1100000),
+	}
+	vision := &model.Invoice{
+		Number:      "12",
+		Date:        date,
+		Seller:      model.Party{Name: "Cong ty  ACME", TaxID: "0312345678", Address: "Q1, HCM"},
+		TotalAmount: decimal.NewFromInt(1100000),
+	}
+
+	result := mergeResults(&Result{Invoice: text}, &Result{Invoice: vision})
+	require.NotNil(t, result)
+	assert.Equal(t, MethodLLMEnsemble, result.Method)
+	assert.Equal(t, ConfidenceEnsembleAgreed, result.Confidence)
+	assert.Equal(t, date, result.Invoice.Date, "empty text fields are filled from vision")
+	assert.Equal(t, "Q1, HCM", result.Invoice.Seller.Address)
+	assert.Empty(t, result.Invoice.LowConfidenceFields)
+	assert.Empty(t, text.Seller.Address, "inputs are not modified")
+}
+
+func TestMergeResults_Conflicts(t *testing.T) {
+	text := &model.Invoice{
+		Number:      "12",
+		Seller:      model.Party{TaxID: "0312345678"},
+		TotalAmount: decimal.NewFromInt(1100000),
+	}
+	vision := &model.Invoice{
+		Number:      "12",
+		Seller:      model.Party{TaxID: "0312345679"},
+		TotalAmount: decimal.NewFromInt(1100000),
+	}
+
+	result := mergeResults(&Result{Invoice: text}, &Result{Invoice: vision})
+	assert.Equal(t, ConfidenceEnsembleConflict, result.Confidence)
+	assert.Equal(t, "0312345678", result.Invoice.Seller.TaxID, "text value wins")
+	assert.Equal(t, []string{"seller.tax_id"}, result.Invoice.LowConfidenceFields)
+	assert.Contains(t, result.Warnings, "text and vision extraction disagree on: seller.tax_id")
+
+	vision.TotalAmount = decimal.NewFromInt(1000000)
+	result = mergeResults(&Result{Invoice: text}, &Result{Invoice: vision})
+	assert.Equal(t, ConfidenceEnsembleTotals, result.Confidence)
+	assert.Contains(t, result.Invoice.LowConfidenceFields, "total_amount")
+}
+
+func TestMergeResults_OnePath(t *testing.T) {
+	inv := &model.Invoice{Number: "12"}
+	failed := &Result{Error: errors.New("boom"), Warnings: []string{"vision failed"}}
+
+	result := mergeResults(&Result{Invoice: inv, Method: MethodLLMText}, failed)
+	assert.Equal(t, MethodLLMText, result.Method)
+	assert.Equal(t, []string{"vision failed"}, result.Warnings)
+
+	assert.Nil(t, mergeResults(failed, &Result{Error: errors.New("boom")}))
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hooks are called at stage boundaries so integrators can enrich, filter or
+// veto documents without changing the pipeline. Any hook may be nil. A hook
+// that returns an error fails the document with it; return an error wrapping
+// ErrSkipped to drop a document that is not wanted rather than failed.
+type Hooks struct {
+	// OnFormatDetected is called by Process with the format detected for
+	// each document, and archive member or attachment, before it is read.
+	// Containers (ZIP, email) are reported before they are unpacked.
+	OnFormatDetected func(ctx context.Context, format Format, filename string) error
+
+	// OnTextExtracted is called with the text read from a PDF or HTML
+	// document before an invoice is extracted from it, and returns the text
+	// to extract from
+	OnTextExtracted func(ctx context.Context, text string) (string, error)
+
+	// OnInvoiceExtracted is called with each extracted invoice before
+	// address normalization, vendor matching and validation. It may modify
+	// result.Invoice.
+	OnInvoiceExtracted func(ctx context.Context, result *Result) error
+
+	// OnValidated is called after validation, confidence scoring and the
+	// duplicate check, before the result is returned. It may add warnings
+	// or findings, or adjust the confidence.
+	OnValidated func(ctx context.Context, result *Result) error
+
+	// OnFinished is called with every result, including failed and skipped
+	// documents, once it is final. It can't change the outcome; use it to
+	// notify other systems (see the webhook package).
+	OnFinished func(ctx context.Context, result *Result)
+}
+
+// WithHooks adds hooks. Hooks of several calls run in the order added; the
+// first error stops the others.
+func WithHooks(hooks Hooks) PipelineOption {
+	return func(p *Pipeline) {
+		p.hooks = append(p.hooks, hooks)
+	}
+}
+
+// formatDetected runs the OnFormatDetected hooks
+func (p *Pipeline) formatDetected(ctx context.Context, format Format, filename string) error {
+	for _, h := range p.hooks {
+		if h.OnFormatDetected == nil {
+			continue
+		}
+		if err := h.OnFormatDetected(ctx, format, filename); err != nil {
+			return fmt.Errorf("format hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// textExtracted runs the OnTextExtracted hooks, each on the text returned by
+// the one before
+func (p *Pipeline) textExtracted(ctx context.Context, text string) (string, error) {
+	for _, h := range p.hooks {
+		if h.OnTextExtracted == nil {
+			continue
+		}
+		var err error
+		if text, err = h.OnTextExtracted(ctx, text); err != nil {
+			return "", fmt.Errorf("text hook: %w", err)
+		}
+	}
+	return text, nil
+}
+
+// invoiceExtracted runs the OnInvoiceExtracted hooks
+func (p *Pipeline) invoiceExtracted(ctx context.Context, result *Result) error {
+	for _, h := range p.hooks {
+		if h.OnInvoiceExtracted == nil {
+			continue
+		}
+		if err := h.OnInvoiceExtracted(ctx, result); err != nil {
+			return fmt.Errorf("invoice hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// validated runs the OnValidated hooks
+func (p *Pipeline) validated(ctx context.Context, result *Result) error {
+	for _, h := range p.hooks {
+		if h.OnValidated == nil {
+			continue
+		}
+		if err := h.OnValidated(ctx, result); err != nil {
+			return fmt.Errorf("validation hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// finished runs the OnFinished hooks
+func (p *Pipeline) finished(ctx context.Context, result *Result) {
+	for _, h := range p.hooks {
+		if h.OnFinished != nil {
+			h.OnFinished(ctx, result)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestHooks_FormatDetected(t *testing.T) {
+	var seen []string
+	p := processor.NewPipeline(processor.WithHooks(processor.Hooks{
+		OnFormatDetected: func(_ context.Context, format processor.Format, filename string) error {
+			seen = append(seen, format.String()+" "+filename)
+			if format == processor.FormatPDF {
+				return fmt.Errorf("%w: PDFs are handled elsewhere", processor.ErrSkipped)
+			}
+			return nil
+		},
+	}))
+	data := buildZIP(t, map[string]string{"a.xml": processXML, "b.pdf": "%PDF-1.4\n"})
+
+	results := p.Process(context.Background(), data, processor.ProcessOptions{Filename: "batch.zip"})
+	require.Len(t, results, 2)
+	bySource := make(map[string]*processor.Result)
+	for _, r := range results {
+		bySource[r.Source] = r
+	}
+	assert.NoError(t, bySource["a.xml"].Error)
+	assert.ErrorIs(t, bySource["b.pdf"].Error, processor.ErrSkipped)
+	assert.ElementsMatch(t, []string{"zip batch.zip", "xml a.xml", "pdf b.pdf"}, seen)
+}
+
+func TestHooks_TextExtracted(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"TRIP-7","total_amount":85000}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client)),
+		processor.WithHooks(processor.Hooks{
+			OnTextExtracted: func(_ context.Context, text string) (string, error) {
+				return strings.ReplaceAll(text, "4111 1111 1111 1111", "[card]"), nil
+			},
+		}),
+	)
+
+	result := p.ProcessHTML(context.Background(), []byte("<html><body><p>Trip TRIP-7</p><p>Card 4111 1111 1111 1111</p></body></html>"))
+	require.NoError(t, result.Error)
+	require.Len(t, provider.requests, 1)
+	assert.Contains(t, provider.requests[0].UserPrompt, "Card [card]")
+	assert.NotContains(t, provider.requests[0].UserPrompt, "4111")
+}
+
+func TestHooks_InvoiceExtractedAndValidated(t *testing.T) {
+	var order []string
+	p := processor.NewPipeline(
+		processor.WithValidation(true),
+		processor.WithHooks(processor.Hooks{
+			OnInvoiceExtracted: func(_ context.Context, result *processor.Result) error {
+				order = append(order, "extracted")
+				result.Invoice.Buyer.Name = "Enriched Buyer"
+				return nil
+			},
+			OnValidated: func(_ context.Context, result *processor.Result) error {
+				order = append(order, fmt.Sprintf("validated %d", len(result.Findings)))
+				return nil
+			},
+		}),
+		processor.WithHooks(processor.Hooks{
+			OnValidated: func(_ context.Context, result *processor.Result) error {
+				order = append(order, "veto")
+				if result.Invoice.Seller.TaxID == "0123456789" {
+					return errors.New("seller is blocked")
+				}
+				return nil
+			},
+		}),
+	)
+
+	result := p.ProcessXMLBytes(context.Background(), []byte(processXML))
+	assert.EqualError(t, result.Error, "validation hook: seller is blocked")
+	assert.Equal(t, "Enriched Buyer", result.Invoice.Buyer.Name)
+	require.Len(t, order, 3)
+	assert.Equal(t, "extracted", order[0])
+	assert.True(t, strings.HasPrefix(order[1], "validated "), "validation ran before the hook")
+	assert.Equal(t, "veto", order[2])
+}
+
+func TestHooks_NotCalledForFailures(t *testing.T) {
+	called := false
+	p := processor.NewPipeline(processor.WithHooks(processor.Hooks{
+		OnInvoiceExtracted: func(context.Context, *processor.Result) error { called = true; return nil },
+	}))
+
+	result := p.ProcessXMLBytes(context.Background(), []byte("<Unknown/>"))
+	require.Error(t, result.Error)
+	assert.False(t, called)
+}
+
+func TestHooks_Finished(t *testing.T) {
+	var finished []*processor.Result
+	p := processor.NewPipeline(processor.WithHooks(processor.Hooks{
+		OnFinished: func(_ context.Context, result *processor.Result) { finished = append(finished, result) },
+	}))
+
+	ok := p.ProcessXMLBytes(context.Background(), []byte(processXML))
+	failed := p.ProcessXMLBytes(context.Background(), []byte("<Unknown/>"))
+	require.NoError(t, ok.Error)
+	require.Error(t, failed.Error)
+	require.Len(t, finished, 2)
+	assert.Same(t, ok, finished[0])
+	assert.Same(t, failed, finished[1])
+	assert.NotEmpty(t, finished[0].CorrelationID)
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// ProcessHTML extracts an invoice from an HTML document, such as the body of
+// an email from a vendor that sends invoices without an attachment. The
+// labels and tables of the markup are read first (see ExtractFromHTML); when
+// they don't give an invoice number, a date and a total, the markup is
+// reduced to text, with table cells separated by tabs and rows on their own
+// lines, and read like PDF text. Without an LLM, an incomplete structured
+// read is kept over label rules.
+func (p *Pipeline) ProcessHTML(ctx context.Context, data []byte) *Result {
+	ctx, span := p.startDocument(ctx, "html")
+	defer span.End()
+
+	text := htmlToText(data)
+	if strings.TrimSpace(text) == "" {
+		return p.finish(ctx, &Result{Error: fmt.Errorf("no text in HTML document")})
+	}
+
+	invoice, err := ExtractFromHTML(data)
+	complete := err == nil && invoice.Number != "" && !invoice.Date.IsZero() && !invoice.TotalAmount.IsZero()
+	if complete || (err == nil && p.llmExtractor == nil) {
+		confidence := ConfidenceHTML
+		if !complete {
+			confidence = ConfidenceRules
+		}
+		return p.finish(ctx, &Result{
+			Invoice:    invoice,
+			Method:     MethodHTML,
+			Confidence: confidence,
+			Warnings:   qualityWarnings(invoice),
+		})
+	}
+	return p.finish(ctx, p.extractText(ctx, text, pdf.Metadata{}))
+}
+
+// looksLikeHTML reports whether data is markup of an HTML document rather
+// than XML
+func looksLikeHTML(data []byte) bool {
+	head := bytes.ToLower(data[:min(1024, len(data))])
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
+	}
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html")) || bytes.Contains(head, []byte("<html"))
+}
+
+// htmlToText renders the visible text of an HTML document
+func htmlToText(data []byte) string {
+	var b strings.Builder
+	z := html.NewTokenizer(bytes.NewReader(data))
+	skip := 0 // Depth inside script, style and head
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return tidyText(b.String())
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(strings.Join(strings.Fields(html.UnescapeString(string(z.Text()))), " "))
+				b.WriteByte(' ')
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			start := tt != html.EndTagToken
+			switch tag {
+			case "script", "style", "head", "title":
+				if start {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			case "td", "th":
+				if !start {
+					b.WriteByte('\t')
+				}
+			case "br", "p", "div", "tr", "li", "table", "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// tidyText trims each line and drops empty ones
+func tidyText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == '\t' })
+		for i, f := range fields {
+			fields[i] = strings.TrimSpace(f)
+		}
+		line = strings.TrimSpace(strings.Join(fields, "\t"))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
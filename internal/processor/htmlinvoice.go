@@ -0,0 +1,349 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// MethodHTML marks invoices read from the labels and tables of an HTML
+// document, without an LLM
+const MethodHTML ExtractionMethod = "html"
+
+// ConfidenceHTML is given to HTML invoices read with a number, a date and a
+// total. The markup is read exactly, but the labels are guessed.
+const ConfidenceHTML = 0.80
+
+// Labels of the fields of an HTML invoice, normalized (see normalizeLabel).
+// Vendors send these in English or Vietnamese.
+var (
+	htmlNumberLabels = []string{
+		"invoice number", "invoice no", "invoice no.", "invoice #", "invoice id", "invoice",
+		"receipt number", "receipt no", "receipt no.", "receipt #", "receipt id",
+		"số hóa đơn", "số hoá đơn", "mã hóa đơn", "mã hoá đơn", "số biên lai",
+	}
+	htmlDateLabels = []string{
+		"invoice date", "date", "date of issue", "issue date", "issued", "issued on", "billing date", "date paid", "payment date",
+		"ngày", "ngày hóa đơn", "ngày hoá đơn", "ngày lập", "ngày thanh toán",
+	}
+	htmlSubtotalLabels = []string{"subtotal", "sub-total", "sub total", "tạm tính", "cộng tiền hàng", "tổng tiền hàng"}
+	htmlTaxLabels      = []string{"tax", "vat", "gst", "sales tax", "thuế", "thuế gtgt", "tiền thuế", "tiền thuế gtgt"}
+	htmlTotalLabels    = []string{
+		"total", "total amount", "total due", "amount due", "total paid", "amount paid", "amount charged", "total charged", "grand total",
+		"tổng cộng", "tổng tiền", "tổng thanh toán", "tổng tiền thanh toán", "tổng cộng tiền thanh toán",
+	}
+	htmlTaxIDLabels     = []string{"tax id", "tax code", "vat number", "vat id", "mst", "mã số thuế"}
+	htmlSellerLabels    = []string{"seller", "vendor", "supplier", "merchant", "from", "đơn vị bán hàng", "nhà cung cấp"}
+	htmlBuyerLabels     = []string{"bill to", "billed to", "customer", "buyer", "khách hàng", "người mua"}
+	htmlItemNameColumns = []string{"description", "item", "items", "service", "product", "details", "mô tả", "nội dung", "dịch vụ", "sản phẩm", "tên hàng", "tên hàng hóa, dịch vụ"}
+	htmlQuantityColumns = []string{"qty", "quantity", "số lượng", "sl"}
+	htmlUnitColumns     = []string{"unit", "uom", "đvt", "đơn vị tính"}
+	htmlPriceColumns    = []string{"unit price", "price", "rate", "đơn giá"}
+	htmlAmountColumns   = []string{"amount", "total", "line total", "thành tiền", "số tiền"}
+)
+
+// ExtractFromHTML reads an invoice from the structure of an HTML document,
+// such as a ride-hailing or SaaS receipt emailed without an attachment:
+// label and value pairs in table rows or "Label: value" lines, and the line
+// items of a table found by its header row. It fails when neither an
+// invoice number nor a total is found.
+func ExtractFromHTML(data []byte) (*model.Invoice, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	tables := htmlTables(doc)
+
+	// Label and value pairs: the first and last cells of table rows, then
+	// "Label: value" lines of the text
+	var pairs []labelValue
+	for _, table := range tables {
+		for _, row := range table {
+			cells := nonEmpty(row)
+			if len(cells) >= 2 {
+				pairs = append(pairs, labelValue{normalizeLabel(cells[0]), cells[len(cells)-1]})
+			}
+		}
+	}
+	text := htmlToText(data)
+	for _, line := range strings.Split(text, "\n") {
+		if label, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(value) != "" && len(label) < 40 {
+			pairs = append(pairs, labelValue{normalizeLabel(label), strings.TrimSpace(value)})
+		}
+	}
+	find := func(labels []string) string {
+		return findLabel(pairs, labels)
+	}
+
+	inv := &model.Invoice{
+		Type:         model.InvoiceTypeNormal,
+		DocumentType: model.DocumentTypeInvoice,
+		Number:       firstWord(find(htmlNumberLabels)),
+		Date:         parseHTMLDate(find(htmlDateLabels)),
+	}
+	inv.Seller.Name = find(htmlSellerLabels)
+	inv.Seller.TaxID = cleanTaxID(find(htmlTaxIDLabels))
+	inv.Buyer.Name = find(htmlBuyerLabels)
+
+	total := find(htmlTotalLabels)
+	inv.Currency = detectCurrency(total, text)
+	format := llm.DefaultNumberFormats[inv.Currency]
+	inv.SubtotalAmount = parseHTMLAmount(find(htmlSubtotalLabels), format)
+	inv.TaxAmount = parseHTMLAmount(find(htmlTaxLabels), format)
+	inv.TotalAmount = parseHTMLAmount(total, format)
+	inv.Items = htmlLineItems(tables, format)
+
+	if inv.Number == "" && inv.TotalAmount.IsZero() {
+		return nil, fmt.Errorf("no invoice number or total found in HTML")
+	}
+	for _, f := range []struct {
+		path    string
+		missing bool
+	}{
+		{"invoice_number", inv.Number == ""},
+		{"date", inv.Date.IsZero()},
+		{"seller.name", inv.Seller.Name == ""},
+		{"total_amount", inv.TotalAmount.IsZero()},
+	} {
+		if f.missing {
+			inv.LowConfidenceFields = append(inv.LowConfidenceFields, f.path)
+		}
+	}
+	return inv, nil
+}
+
+// htmlTables returns the rows of the tables of a document, as cell text.
+// Rows holding a nested table are page layout and are left out; the nested
+// table's own rows are read.
+func htmlTables(doc *html.Node) [][][]string {
+	var tables [][][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Table {
+			var rows [][]string
+			for tr := range n.Descendants() {
+				if tr.DataAtom != atom.Tr || closestTable(tr) != n || hasDescendant(tr, atom.Table) {
+					continue
+				}
+				var cells []string
+				for td := range tr.ChildNodes() {
+					if td.DataAtom == atom.Td || td.DataAtom == atom.Th {
+						cells = append(cells, strings.Join(strings.Fields(nodeText(td)), " "))
+					}
+				}
+				rows = append(rows, cells)
+			}
+			if len(rows) > 0 {
+				tables = append(tables, rows)
+			}
+		}
+		for c := range n.ChildNodes() {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return tables
+}
+
+func closestTable(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Table {
+			return p
+		}
+	}
+	return nil
+}
+
+func hasDescendant(n *html.Node, a atom.Atom) bool {
+	for d := range n.Descendants() {
+		if d.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText returns the text of a node, without scripts and styles
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode && d.Parent.DataAtom != atom.Script && d.Parent.DataAtom != atom.Style {
+			b.WriteString(d.Data)
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// firstWord returns the first word of s without a leading number sign, as
+// in "#A1B2C3 (paid)"
+func firstWord(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return strings.TrimPrefix(fields[0], "#")
+	}
+	return ""
+}
+
+func nonEmpty(cells []string) []string {
+	var out []string
+	for _, c := range cells {
+		if c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// labelNoise is what normalizeLabel drops: parenthesized translations or
+// currencies, and trailing colons
+var labelNoise = regexp.MustCompile(`\([^)]*\)|[:：]+\s*$`)
+
+// normalizeLabel lowercases a label and drops its noise and extra spaces
+func normalizeLabel(s string) string {
+	s = labelNoise.ReplaceAllString(strings.ToLower(s), " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// htmlLineItems reads the line items of the first table with a header row
+// naming an item column and an amount or price column
+func htmlLineItems(tables [][][]string, format llm.NumberFormat) []model.LineItem {
+	for _, table := range tables {
+		for h, header := range table {
+			cols := map[string]int{"name": -1, "quantity": -1, "unit": -1, "price": -1, "amount": -1}
+			for i, cell := range header {
+				label := normalizeLabel(cell)
+				for key, names := range map[string][]string{
+					"name": htmlItemNameColumns, "quantity": htmlQuantityColumns, "unit": htmlUnitColumns,
+					"price": htmlPriceColumns, "amount": htmlAmountColumns,
+				} {
+					if cols[key] == -1 && slices.Contains(names, label) {
+						cols[key] = i
+					}
+				}
+			}
+			if cols["name"] == -1 || (cols["amount"] == -1 && cols["price"] == -1) {
+				continue
+			}
+
+			cell := func(row []string, key string) string {
+				if i := cols[key]; i >= 0 && i < len(row) {
+					return row[i]
+				}
+				return ""
+			}
+			var items []model.LineItem
+			for _, row := range table[h+1:] {
+				name := cell(row, "name")
+				label := normalizeLabel(name)
+				if name == "" || slices.Contains(htmlSubtotalLabels, label) || slices.Contains(htmlTaxLabels, label) || slices.Contains(htmlTotalLabels, label) {
+					continue
+				}
+				item := model.LineItem{
+					Number:    len(items) + 1,
+					Name:      name,
+					Unit:      cell(row, "unit"),
+					Quantity:  parseHTMLAmount(cell(row, "quantity"), llm.PlainNumberFormat),
+					UnitPrice: parseHTMLAmount(cell(row, "price"), format),
+					Amount:    parseHTMLAmount(cell(row, "amount"), format),
+				}
+				if item.Quantity.IsZero() {
+					item.Quantity = decimal.NewFromInt(1)
+				}
+				switch {
+				case item.Amount.IsZero() && !item.UnitPrice.IsZero():
+					item.Amount = item.Quantity.Mul(item.UnitPrice)
+				case item.UnitPrice.IsZero() && !item.Amount.IsZero():
+					item.UnitPrice = item.Amount.Div(item.Quantity)
+				}
+				if item.Amount.IsZero() {
+					continue // A heading or note row
+				}
+				item.Total = item.Amount
+				items = append(items, item)
+			}
+			if len(items) > 0 {
+				return items
+			}
+		}
+	}
+	return nil
+}
+
+// parseHTMLAmount reads the first number of a value; values without one are
+// zero. A leading minus sign, or accounting parentheses, make it negative.
+func parseHTMLAmount(s string, format llm.NumberFormat) decimal.Decimal {
+	value := amountPattern.FindString(s)
+	if value == "" {
+		return decimal.Zero
+	}
+	amount, err := llm.ParseAmount(value, format)
+	if err != nil {
+		return decimal.Zero
+	}
+	if before, _, _ := strings.Cut(s, value); strings.ContainsAny(before, "-−(") {
+		amount = amount.Neg()
+	}
+	return amount
+}
+
+// currencySymbols maps the currency marks of amounts to ISO codes, longest
+// first so "US$" is not read as "$"
+var currencySymbols = []struct{ mark, code string }{
+	{"US$", "USD"}, {"S$", "SGD"}, {"VNĐ", "VND"}, {"VND", "VND"}, {"USD", "USD"}, {"EUR", "EUR"},
+	{"GBP", "GBP"}, {"SGD", "SGD"}, {"JPY", "JPY"}, {"₫", "VND"}, {"đ", "VND"}, {"$", "USD"},
+	{"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"},
+}
+
+// detectCurrency returns the currency of the total, or else the first one
+// marked in the text; VND when none is
+func detectCurrency(total, text string) string {
+	for _, s := range []string{total, text} {
+		for _, c := range currencySymbols {
+			if strings.Contains(s, c.mark) {
+				return c.code
+			}
+		}
+	}
+	return "VND"
+}
+
+// htmlDateLayouts are the date formats of English and Vietnamese receipts;
+// day-first numeric dates are the Vietnamese convention
+var htmlDateLayouts = []string{
+	"2006-01-02", "2/1/2006", "02/01/2006", "2-1-2006", "2.1.2006",
+	"January 2, 2006", "Jan 2, 2006", "2 January 2006", "2 Jan 2006", "Monday, January 2, 2006", "Mon, Jan 2, 2006",
+}
+
+// htmlDatePrefix finds the date in a value that may go on with a time
+var htmlDatePrefix = regexp.MustCompile(`^(?:[A-Za-z]+,? )?(?:\d{4}-\d{2}-\d{2}|\d{1,2}[/.-]\d{1,2}[/.-]\d{4}|[A-Za-z]+\.? \d{1,2},? \d{4}|\d{1,2} [A-Za-z]+\.? \d{4})`)
+
+// parseHTMLDate reads a date value, or returns the zero time
+func parseHTMLDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	if date := findDate(&pdf.ExtractedText{RawText: "ngày: " + s}); !date.IsZero() {
+		return date
+	}
+	if m := htmlDatePrefix.FindString(s); m != "" {
+		m = strings.Replace(m, ". ", " ", 1) // "Jan. 2, 2024"
+		for _, layout := range htmlDateLayouts {
+			if date, err := time.Parse(layout, m); err == nil {
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,129 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// rideReceipt is laid out with nested tables, as email templates are
+const rideReceipt = `<!DOCTYPE html><html><head><style>td{padding:4px}</style></head><body>
+<table width="600"><tr><td>
+  <table><tr><td><img src="logo.png" alt="RideCo"></td><td>Your trip receipt</td></tr></table>
+  <p>Receipt No: #A-8841-XK (paid)</p>
+  <table>
+    <tr><td>Date</td><td>Mar 15, 2024 8:42 PM</td></tr>
+    <tr><td>Merchant</td><td>RideCo Vietnam Co., Ltd</td></tr>
+    <tr><td>Tax ID (MST)</td><td>0312 345 678</td></tr>
+    <tr><td>Trip fare</td><td>80.000 ₫</td></tr>
+    <tr><td>Booking fee</td><td>5.000 ₫</td></tr>
+    <tr><td><b>Total</b></td><td><b>85.000 ₫</b></td></tr>
+  </table>
+</td></tr></table>
+</body></html>`
+
+func TestExtractFromHTML_RideReceipt(t *testing.T) {
+	inv, err := processor.ExtractFromHTML([]byte(rideReceipt))
+	require.NoError(t, err)
+	assert.Equal(t, "A-8841-XK", inv.Number)
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "RideCo Vietnam Co., Ltd", inv.Seller.Name)
+	assert.Equal(t, "0312345678", inv.Seller.TaxID)
+	assert.Equal(t, "VND", inv.Currency)
+	assert.Equal(t, "85000", inv.TotalAmount.String())
+	assert.Empty(t, inv.Items, "no item table")
+	assert.Empty(t, inv.LowConfidenceFields)
+}
+
+func TestExtractFromHTML_SaaSInvoice(t *testing.T) {
+	page := `<html><body>
+<h2>Invoice</h2>
+<div>Invoice number: INV-2024-0311</div>
+<div>Date of issue: 2024-03-11</div>
+<div>Bill to: Acme Vietnam JSC</div>
+<table>
+  <thead><tr><th>Description</th><th>Qty</th><th>Unit price</th><th>Amount</th></tr></thead>
+  <tbody>
+    <tr><td>Team plan (Mar 11 – Apr 10)</td><td>5</td><td>$12.00</td><td>$60.00</td></tr>
+    <tr><td>Extra storage</td><td></td><td></td><td>$4.50</td></tr>
+    <tr><td>Discount</td><td></td><td></td><td>-$4.50</td></tr>
+    <tr><td colspan="3">Subtotal</td><td>$60.00</td></tr>
+    <tr><td colspan="3">VAT (10%)</td><td>$6.00</td></tr>
+    <tr><td colspan="3">Amount due</td><td>US$66.00</td></tr>
+  </tbody>
+</table>
+</body></html>`
+
+	inv, err := processor.ExtractFromHTML([]byte(page))
+	require.NoError(t, err)
+	assert.Equal(t, "INV-2024-0311", inv.Number)
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "Acme Vietnam JSC", inv.Buyer.Name)
+	assert.Equal(t, "USD", inv.Currency)
+	assert.Equal(t, "60", inv.SubtotalAmount.String())
+	assert.Equal(t, "6", inv.TaxAmount.String())
+	assert.Equal(t, "66", inv.TotalAmount.String())
+
+	require.Len(t, inv.Items, 3)
+	assert.Equal(t, "Team plan (Mar 11 – Apr 10)", inv.Items[0].Name)
+	assert.Equal(t, "5", inv.Items[0].Quantity.String())
+	assert.Equal(t, "12", inv.Items[0].UnitPrice.String())
+	assert.Equal(t, "60", inv.Items[0].Amount.String())
+	assert.Equal(t, "1", inv.Items[1].Quantity.String())
+	assert.Equal(t, "4.5", inv.Items[1].UnitPrice.String())
+	assert.Equal(t, "-4.5", inv.Items[2].Amount.String())
+	assert.Equal(t, []string{"seller.name"}, inv.LowConfidenceFields)
+}
+
+func TestExtractFromHTML_Vietnamese(t *testing.T) {
+	page := `<html><body><table>
+<tr><td>Số hóa đơn:</td><td>0000123</td></tr>
+<tr><td>Ngày (Date):</td><td>ngày 05 tháng 02 năm 2024</td></tr>
+<tr><td>Đơn vị bán hàng:</td><td>Công ty TNHH Dịch vụ ABC</td></tr>
+<tr><td>Tổng cộng tiền thanh toán:</td><td>1.100.000 đ</td></tr>
+</table></body></html>`
+
+	inv, err := processor.ExtractFromHTML([]byte(page))
+	require.NoError(t, err)
+	assert.Equal(t, "0000123", inv.Number)
+	assert.Equal(t, time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "Công ty TNHH Dịch vụ ABC", inv.Seller.Name)
+	assert.Equal(t, "1100000", inv.TotalAmount.String())
+}
+
+func TestExtractFromHTML_NotAnInvoice(t *testing.T) {
+	_, err := processor.ExtractFromHTML([]byte("<html><body><p>Thanks for signing up!</p></body></html>"))
+	assert.ErrorContains(t, err, "no invoice number or total")
+}
+
+func TestProcessHTML_Structured(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"unused"}`)
+
+	result := p.ProcessHTML(context.Background(), []byte(rideReceipt))
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodHTML, result.Method)
+	assert.Equal(t, "A-8841-XK", result.Invoice.Number)
+	assert.Empty(t, provider.requests, "no LLM call for a complete read")
+}
+
+func TestProcessHTML_LLMFallback(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"TRIP-7","invoice_date":"2024-03-15","total_amount":85000}`)
+	page := []byte("<html><body><p>Thanks for riding! Trip TRIP-7</p><table><tr><td>Total</td><td>85,000 ₫</td></tr></table></body></html>")
+
+	result := p.ProcessHTML(context.Background(), page)
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMText, result.Method, "no number label: read by the LLM")
+	require.Len(t, provider.requests, 1)
+
+	// Without an LLM, the partial read is kept
+	result = processor.NewPipeline().ProcessHTML(context.Background(), page)
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodHTML, result.Method)
+	assert.Equal(t, "85000", result.Invoice.TotalAmount.String())
+	assert.Contains(t, result.Invoice.LowConfidenceFields, "invoice_number")
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// IdempotencyStore keeps the results of documents by idempotency key.
+// Share one store between pipelines to answer a document submitted to any
+// of them once.
+type IdempotencyStore interface {
+	// Load returns the results saved under key, and whether there are any
+	Load(ctx context.Context, key string) ([]*Result, bool, error)
+
+	// Save keeps results under key
+	Save(ctx context.Context, key string, results []*Result) error
+}
+
+// WithIdempotency returns the results of a document submitted before with
+// the same idempotency key instead of processing it again, marked
+// Result.IdempotentReplay. Keys come from ProcessOptions.IdempotencyKey, or
+// from the content (see IdempotencyKey). Concurrent submissions of a key
+// wait for the first one, so each document is extracted, and paid for,
+// once. Results failing for a reason that may not happen again (see
+// IsTransient) or canceled are not kept.
+func WithIdempotency(store IdempotencyStore) PipelineOption {
+	return func(p *Pipeline) {
+		p.idempotency = &idempotency{store: store, calls: make(map[string]*idempotentCall)}
+	}
+}
+
+// IdempotencyKey derives the key of a document from its content and the
+// options that change how it is read
+func IdempotencyKey(data []byte, opts ProcessOptions) string {
+	h := sha256.New()
+	h.Write(data)
+	fmt.Fprintf(h, "\x00split=%t", opts.SplitDocuments)
+	for _, s := range opts.Strategies {
+		fmt.Fprintf(h, "\x00%s", s)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotency is the store of WithIdempotency and the calls in flight
+type idempotency struct {
+	store IdempotencyStore
+
+	mu    sync.Mutex
+	calls map[string]*idempotentCall
+}
+
+// idempotentCall is the first submission of a key, waited on by the others
+type idempotentCall struct {
+	done    chan struct{}
+	results []*Result
+	saved   bool // The results are final, not to be recomputed
+}
+
+// Idempotent returns the results saved under key, or the results of fn,
+// saving them. Submissions of key while fn runs wait for its results.
+// Without WithIdempotency, or with an empty key, it just calls fn. Keys are
+// those of the tenant of ctx (see WithTenants).
+func (p *Pipeline) Idempotent(ctx context.Context, key string, fn func(context.Context) []*Result) []*Result {
+	if p.idempotency == nil || key == "" {
+		return fn(ctx)
+	}
+	return p.idempotency.do(ctx, tenantScoped(p.tenantOf(ctx), key), fn)
+}
+
+func (s *idempotency) do(ctx context.Context, key string, fn func(context.Context) []*Result) []*Result {
+	for {
+		s.mu.Lock()
+		call, running := s.calls[key]
+		if !running {
+			call = &idempotentCall{done: make(chan struct{})}
+			s.calls[key] = call
+		}
+		s.mu.Unlock()
+
+		if running {
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return []*Result{{Error: fmt.Errorf("waiting for the earlier submission: %w", ctx.Err())}}
+			}
+			if call.saved {
+				return replayed(call.results)
+			}
+			continue // The first submission failed for now; try again
+		}
+
+		results, saved := s.run(ctx, key, fn)
+		if saved {
+			// Kept apart from results, which the caller may change
+			call.results, call.saved = cloneResults(results), true
+		}
+		s.mu.Lock()
+		delete(s.calls, key)
+		s.mu.Unlock()
+		close(call.done)
+		return results
+	}
+}
+
+// run loads the results of key, or computes and saves them. It reports
+// whether the results are final.
+func (s *idempotency) run(ctx context.Context, key string, fn func(context.Context) []*Result) ([]*Result, bool) {
+	results, ok, err := s.store.Load(ctx, key)
+	if err == nil && ok {
+		return replayed(results), true
+	}
+
+	results = fn(ctx)
+	if ctx.Err() != nil || !final(results) {
+		return results, false
+	}
+	if err != nil {
+		// The store can't be read: don't overwrite what it may hold
+		warnAll(results, fmt.Sprintf("idempotency lookup failed: %v", err))
+		return results, false
+	}
+	if err := s.store.Save(ctx, key, results); err != nil {
+		warnAll(results, fmt.Sprintf("failed to save results for idempotency: %v", err))
+		return results, false
+	}
+	return results, true
+}
+
+// final reports whether results are worth keeping: none failed for a
+// reason that may not happen again, or was cut short by its deadline
+func final(results []*Result) bool {
+	for _, r := range results {
+		if r.DeadlineExceeded {
+			return false
+		}
+		if r.Error != nil && (IsTransient(r.Error) || errors.Is(r.Error, ErrStopped) || errors.Is(r.Error, ErrUnknownTenant) || errors.Is(r.Error, ErrBudgetExceeded) || errors.Is(r.Error, context.Canceled) || errors.Is(r.Error, context.DeadlineExceeded)) {
+			return false
+		}
+	}
+	return true
+}
+
+// replayed returns copies of results answered from an earlier submission
+func replayed(results []*Result) []*Result {
+	copies := cloneResults(results)
+	for _, c := range copies {
+		c.IdempotentReplay = true
+	}
+	return copies
+}
+
+// cloneResults returns deep copies of results, so that what callers do with
+// the results they are answered doesn't change those kept for replay. The
+// raw LLM calls and debug data are shared.
+func cloneResults(results []*Result) []*Result {
+	copies := make([]*Result, len(results))
+	for i, r := range results {
+		c := *r
+		c.Invoice = r.Invoice.Clone()
+		c.Warnings = slices.Clone(r.Warnings)
+		c.Pages = clonePointer(r.Pages)
+		c.Vendor = clonePointer(r.Vendor)
+		c.Submission = clonePointer(r.Submission)
+		c.Findings = slices.Clone(r.Findings)
+		c.Signals = clonePointer(r.Signals)
+		copies[i] = &c
+	}
+	return copies
+}
+
+// clonePointer returns a pointer to a copy of *p, or nil
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func warnAll(results []*Result, warning string) {
+	for _, r := range results {
+		r.Warnings = append(r.Warnings, warning)
+	}
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore held in memory, for one
+// process
+type MemoryIdempotencyStore struct {
+	mu      sync.RWMutex
+	results map[string][]*Result
+}
+
+// NewMemoryIdempotencyStore returns an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{results: make(map[string][]*Result)}
+}
+
+// Load implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Load(_ context.Context, key string) ([]*Result, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results, ok := s.results[key]
+	return results, ok, nil
+}
+
+// Save implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Save(_ context.Context, key string, results []*Result) error {
+	kept := cloneResults(results)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[key] = kept
+	return nil
+}
@@ -0,0 +1,113 @@
+package processor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestIdempotency(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"0000042","total_amount":110000}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client)),
+		processor.WithIdempotency(processor.NewMemoryIdempotencyStore()),
+	)
+	scan := []byte("\xff\xd8\xffscanned invoice")
+	ctx := context.Background()
+
+	// Concurrent submissions of the same document cost one extraction
+	var wg sync.WaitGroup
+	results := make([][]*processor.Result, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = p.Process(ctx, scan, processor.ProcessOptions{Filename: "scan.jpg"})
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, provider.requests, 1)
+	replays := 0
+	for _, r := range results {
+		require.Len(t, r, 1)
+		require.NoError(t, r[0].Error)
+		assert.Equal(t, "0000042", r[0].Invoice.Number)
+		if r[0].IdempotentReplay {
+			replays++
+		}
+	}
+	assert.Equal(t, len(results)-1, replays)
+
+	// Other options read the document differently
+	p.Process(ctx, scan, processor.ProcessOptions{Filename: "scan.jpg", Strategies: []processor.Strategy{processor.StrategyVision}})
+	assert.Len(t, provider.requests, 2)
+
+	// A caller key answers whatever the content
+	first := p.Process(ctx, scan, processor.ProcessOptions{IdempotencyKey: "upload-1"})
+	again := p.Process(ctx, []byte("\xff\xd8\xffanother scan"), processor.ProcessOptions{IdempotencyKey: "upload-1"})
+	assert.Len(t, provider.requests, 3)
+	assert.False(t, first[0].IdempotentReplay)
+	assert.True(t, again[0].IdempotentReplay)
+	assert.Equal(t, first[0].Invoice, again[0].Invoice)
+}
+
+func TestIdempotency_ReplaysAreCopies(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"0000042","total_amount":110000,"items":[{"name":"Giấy A4","quantity":1,"unit_price":100000}]}`}
+	store := processor.NewMemoryIdempotencyStore()
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))),
+		processor.WithIdempotency(store),
+	)
+	ctx := context.Background()
+	opts := processor.ProcessOptions{Filename: "scan.jpg", IdempotencyKey: "upload-1"}
+
+	first := p.Process(ctx, []byte("\xff\xd8\xffscanned invoice"), opts)
+	require.NoError(t, first[0].Error)
+	require.Len(t, first[0].Invoice.Items, 1)
+	first[0].Invoice.Number = "edited"
+	first[0].Invoice.Items[0].Name = "edited"
+
+	replay := p.Process(ctx, []byte("\xff\xd8\xffscanned invoice"), opts)
+	require.True(t, replay[0].IdempotentReplay)
+	assert.Equal(t, "0000042", replay[0].Invoice.Number, "the saved results are copies")
+	replay[0].Invoice.Number = "edited"
+	replay[0].Invoice.Items[0].Name = "edited"
+	replay[0].Warnings = append(replay[0].Warnings, "edited")
+
+	saved, ok, err := store.Load(ctx, "upload-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "0000042", saved[0].Invoice.Number, "replays are copies")
+	assert.Equal(t, "Giấy A4", saved[0].Invoice.Items[0].Name)
+	assert.NotContains(t, saved[0].Warnings, "edited")
+	assert.Len(t, provider.requests, 1)
+}
+
+func TestIdempotency_TransientFailuresNotKept(t *testing.T) {
+	provider := &flakyProvider{failures: 1, status: 503}
+	p := newFlakyPipeline(provider, processor.WithIdempotency(processor.NewMemoryIdempotencyStore()))
+	scan := []byte("\xff\xd8\xffscanned invoice")
+
+	results := p.Process(context.Background(), scan, processor.ProcessOptions{})
+	require.Error(t, results[0].Error)
+
+	results = p.Process(context.Background(), scan, processor.ProcessOptions{})
+	require.NoError(t, results[0].Error)
+	assert.False(t, results[0].IdempotentReplay)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	data := []byte("<Invoice/>")
+	key := processor.IdempotencyKey(data, processor.ProcessOptions{})
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, key)
+	assert.Equal(t, key, processor.IdempotencyKey(data, processor.ProcessOptions{Filename: "other.xml"}), "the name does not change the document")
+	assert.NotEqual(t, key, processor.IdempotencyKey(data, processor.ProcessOptions{SplitDocuments: true}))
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// MethodTemplate marks invoices read by a layout's deterministic template
+const MethodTemplate ExtractionMethod = "template"
+
+// ConfidenceTemplate is the confidence of a deterministic template extraction
+const ConfidenceTemplate = 0.95
+
+// Template reads invoices of one known layout without an LLM
+type Template interface {
+	Extract(text string) (*model.Invoice, error)
+}
+
+// TemplateFunc adapts a function to the Template interface
+type TemplateFunc func(text string) (*model.Invoice, error)
+
+// Extract calls f(text)
+func (f TemplateFunc) Extract(text string) (*model.Invoice, error) {
+	return f(text)
+}
+
+// Layout describes a recurring supplier or document layout and how to extract it
+type Layout struct {
+	Name         string   // Layout class; also selects few-shot examples with the same Layout
+	SellerTaxIDs []string // Seller tax IDs printed on documents of this layout
+	Markers      []string // Text that identifies the layout, matched case-insensitively
+	Producers    []string // PDF Producer/Creator substrings
+
+	Prompts  llm.PromptSet // Prompt overrides; empty fields keep the extractor's prompts
+	Template Template      // Deterministic extraction tried before the LLM, if set
+}
+
+// LayoutClassifier identifies the layout of a document from its text and PDF metadata
+type LayoutClassifier interface {
+	// Classify returns the matching layout, or nil if the document is unknown
+	Classify(ctx context.Context, text string, meta pdf.Metadata) *Layout
+}
+
+// Signal weights for layout classification
+const (
+	layoutWeightTaxID    = 2
+	layoutWeightMarker   = 1
+	layoutWeightProducer = 1
+
+	// layoutMinScore needs a tax ID, or two weaker signals, to match
+	layoutMinScore = 2
+)
+
+// HeuristicClassifier matches layouts by seller tax ID, marker text and PDF producer
+type HeuristicClassifier struct {
+	layouts []Layout
+}
+
+// NewHeuristicClassifier creates a classifier over layouts; earlier layouts win ties
+func NewHeuristicClassifier(layouts ...Layout) *HeuristicClassifier {
+	return &HeuristicClassifier{layouts: layouts}
+}
+
+// Classify returns the best scoring layout
+func (c *HeuristicClassifier) Classify(_ context.Context, text string, meta pdf.Metadata) *Layout {
+	lower := strings.ToLower(text)
+	producer := strings.ToLower(meta.Producer + " " + meta.Creator)
+
+	var best *Layout
+	bestScore := layoutMinScore - 1
+	for i := range c.layouts {
+		layout := &c.layouts[i]
+		score := 0
+		for _, id := range layout.SellerTaxIDs {
+			if id != "" && strings.Contains(text, id) {
+				score += layoutWeightTaxID
+				break
+			}
+		}
+		for _, marker := range layout.Markers {
+			if marker != "" && strings.Contains(lower, strings.ToLower(marker)) {
+				score += layoutWeightMarker
+			}
+		}
+		for _, p := range layout.Producers {
+			if p != "" && strings.Contains(producer, strings.ToLower(p)) {
+				score += layoutWeightProducer
+				break
+			}
+		}
+		if score > bestScore {
+			best, bestScore = layout, score
+		}
+	}
+	return best
+}
+
+// WithLayoutClassifier selects prompts, few-shot examples or a template per document layout
+func WithLayoutClassifier(classifier LayoutClassifier) PipelineOption {
+	return func(p *Pipeline) {
+		p.layoutClassifier = classifier
+	}
+}
+
+// classifyLayout identifies the document layout and returns ctx carrying its
+// prompts and example class for the LLM extractor
+func (p *Pipeline) classifyLayout(ctx context.Context, text string, meta pdf.Metadata) (context.Context, *Layout) {
+	if p.layoutClassifier == nil {
+		return ctx, nil
+	}
+	layout := p.layoutClassifier.Classify(ctx, text, meta)
+	if layout == nil {
+		return ctx, nil
+	}
+	if layout.Name != "" {
+		ctx = llm.ContextWithLayout(ctx, layout.Name)
+	}
+	return llm.ContextWithPrompts(ctx, layout.Prompts), layout
+}
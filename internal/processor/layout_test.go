@@ -0,0 +1,73 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestHeuristicClassifier(t *testing.T) {
+	classifier := processor.NewHeuristicClassifier(
+		processor.Layout{Name: "evn", SellerTaxIDs: []string{"0100100079"}, Markers: []string{"Tổng công ty Điện lực"}},
+		processor.Layout{Name: "misa-retail", Markers: []string{"Phiếu thanh toán", "Cảm ơn quý khách"}, Producers: []string{"meinvoice"}},
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		text string
+		meta pdf.Metadata
+		want string
+	}{
+		{"tax ID alone", "MST: 0100100079\nHóa đơn tiền điện", pdf.Metadata{}, "evn"},
+		{"two markers", "PHIẾU THANH TOÁN ... cảm ơn quý khách", pdf.Metadata{}, "misa-retail"},
+		{"marker and producer", "Phiếu thanh toán", pdf.Metadata{Producer: "MeInvoice PDF"}, "misa-retail"},
+		{"single weak signal", "Phiếu thanh toán", pdf.Metadata{}, ""},
+		{"unknown", "Hóa đơn GTGT", pdf.Metadata{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := classifier.Classify(ctx, tt.text, tt.meta)
+			if tt.want == "" {
+				assert.Nil(t, layout)
+				return
+			}
+			require.NotNil(t, layout)
+			assert.Equal(t, tt.want, layout.Name)
+		})
+	}
+}
+
+// layoutClassifierFunc classifies every document as one layout
+type layoutClassifierFunc func(text string, meta pdf.Metadata) *processor.Layout
+
+func (f layoutClassifierFunc) Classify(_ context.Context, text string, meta pdf.Metadata) *processor.Layout {
+	return f(text, meta)
+}
+
+func TestPipeline_LayoutPrompts(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"42"}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	classifier := layoutClassifierFunc(func(string, pdf.Metadata) *processor.Layout {
+		return &processor.Layout{Name: "acme", Prompts: llm.PromptSet{AutoDetect: "Acme invoices print the number top right."}}
+	})
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client)),
+		processor.WithLayoutClassifier(classifier),
+	)
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, "42", result.Invoice.Number)
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, "Acme invoices print the number top right.", provider.requests[0].UserPrompt)
+	assert.Equal(t, llm.SystemPromptReceiptExtractor, provider.requests[0].SystemPrompt, "unset prompts keep the defaults")
+}
@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+// ErrStopped is the error of documents the pipeline did not finish because
+// it was stopped (see Pipeline.Stop): submitted after Stop, or still running
+// when its deadline passed. They can be submitted again to another pipeline
+// or after a restart.
+var ErrStopped = errors.New("pipeline stopped")
+
+// lifecycle counts the documents in flight so Stop can drain them
+type lifecycle struct {
+	mu       sync.Mutex
+	stopping bool
+	inflight int
+	drained  chan struct{} // Closed when the last document in flight leaves after Stop
+
+	abort  context.Context // Canceled when Stop gives up waiting
+	cancel context.CancelFunc
+}
+
+type inflightKey struct{}
+
+// Stop stops the pipeline from accepting documents and waits for the ones
+// in flight to finish. When ctx is done first, they are canceled, killing
+// the PDF tools and LLM requests they wait on, and Stop returns once they
+// have returned, with an error. Documents submitted after Stop, and those
+// canceled, fail with ErrStopped. Calling Stop again waits again.
+func (p *Pipeline) Stop(ctx context.Context) error {
+	l := &p.lifecycle
+	l.mu.Lock()
+	l.init()
+	l.stopping = true
+	if l.inflight == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	if l.drained == nil {
+		l.drained = make(chan struct{})
+	}
+	drained := l.drained
+	l.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+	l.cancel()
+	<-drained
+	return fmt.Errorf("in-flight documents canceled: %w", ctx.Err())
+}
+
+// Stopped reports whether Stop was called
+func (p *Pipeline) Stopped() bool {
+	p.lifecycle.mu.Lock()
+	defer p.lifecycle.mu.Unlock()
+	return p.lifecycle.stopping
+}
+
+func (l *lifecycle) init() {
+	if l.abort == nil {
+		l.abort, l.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// enter admits a document, returning its context and the function to call
+// when it is done. Documents of a stopped pipeline get a canceled context.
+// Documents started by another one in flight, such as the members of an
+// archive, are part of it.
+func (l *lifecycle) enter(ctx context.Context) (context.Context, func()) {
+	if ctx.Value(inflightKey{}) != nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, inflightKey{}, true))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	if l.stopping {
+		cancel(ErrStopped)
+		return ctx, func() {}
+	}
+	l.inflight++
+	stop := context.AfterFunc(l.abort, func() { cancel(ErrStopped) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		l.leave()
+	}
+}
+
+func (l *lifecycle) leave() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.inflight == 0 && l.drained != nil {
+		close(l.drained)
+		l.drained = nil
+	}
+}
+
+// stopped returns the error of a result whose document the pipeline was
+// stopped before it finished, or nil
+func stopped(ctx context.Context, result *Result) error {
+	if !errors.Is(context.Cause(ctx), ErrStopped) {
+		return nil
+	}
+	if result.Error == nil || errors.Is(result.Error, ErrStopped) {
+		return ErrStopped
+	}
+	return fmt.Errorf("%w: %w", ErrStopped, result.Error)
+}
+
+// documentSpan leaves the lifecycle when the span of a document ends
+type documentSpan struct {
+	tracing.Span
+	leave func()
+}
+
+func (s documentSpan) End() {
+	s.Span.End()
+	s.leave()
+}
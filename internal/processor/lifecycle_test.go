@@ -0,0 +1,139 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// blockingProvider answers once release is closed, or fails when the
+// request is canceled
+type blockingProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (p *blockingProvider) Name() string { return "blocking" }
+
+func (p *blockingProvider) Complete(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	p.started <- struct{}{}
+	select {
+	case <-p.release:
+		return &llm.Response{Content: `{"invoice_number":"0000042","total_amount":110000}`, Model: req.Model}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newBlockingPipeline(provider *blockingProvider) *processor.Pipeline {
+	client := llm.NewClient("", llm.WithProvider(provider))
+	return processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client, llm.WithRetryPolicy(llm.NoRetry))))
+}
+
+func TestStop_Idle(t *testing.T) {
+	p := processor.NewPipeline()
+	require.NoError(t, p.Stop(context.Background()))
+	assert.True(t, p.Stopped())
+
+	results := p.Process(context.Background(), []byte(processXML), processor.ProcessOptions{Filename: "invoice.xml"})
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Error, processor.ErrStopped)
+
+	result := p.ProcessXMLBytes(context.Background(), []byte(processXML))
+	assert.ErrorIs(t, result.Error, processor.ErrStopped)
+}
+
+func TestStop_Drains(t *testing.T) {
+	provider := newBlockingProvider()
+	p := newBlockingPipeline(provider)
+
+	done := make(chan *processor.Result)
+	go func() { done <- p.ProcessImage(context.Background(), []byte("\xff\xd8\xffscanned"), "image/jpeg") }()
+	<-provider.started
+
+	stopped := make(chan error)
+	go func() { stopped <- p.Stop(context.Background()) }()
+	require.Eventually(t, p.Stopped, time.Second, time.Millisecond)
+
+	// New work is refused while the document in flight finishes
+	results := p.Process(context.Background(), []byte("\xff\xd8\xffanother"), processor.ProcessOptions{Filename: "b.jpg"})
+	assert.ErrorIs(t, results[0].Error, processor.ErrStopped)
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the document finished")
+	default:
+	}
+
+	close(provider.release)
+	result := <-done
+	require.NoError(t, result.Error)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.NoError(t, <-stopped)
+}
+
+func TestStop_Deadline(t *testing.T) {
+	provider := newBlockingProvider()
+	p := newBlockingPipeline(provider)
+
+	done := make(chan []*processor.Result)
+	go func() {
+		done <- p.Process(context.Background(), []byte("\xff\xd8\xffscanned"), processor.ProcessOptions{Filename: "scan.jpg"})
+	}()
+	<-provider.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.Stop(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	results := <-done
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Error, processor.ErrStopped)
+	assert.Equal(t, "stopped", processor.ErrorClass(results[0].Error))
+}
+
+func TestProcessBatch_Stopped(t *testing.T) {
+	provider := newBlockingProvider()
+	p := newBlockingPipeline(provider)
+
+	var finished []string
+	inputs := []processor.BatchInput{
+		{Name: "a.jpg", Data: []byte("\xff\xd8\xffscan a")},
+		{Name: "b.jpg", Data: []byte("\xff\xd8\xffscan b")},
+	}
+	done := make(chan *processor.BatchSummary)
+	go func() {
+		_, summary := p.ProcessBatch(context.Background(), inputs, processor.BatchOptions{
+			Workers:         1,
+			ContinueOnError: true,
+			Done: func(_ int, input processor.BatchInput, _ []*processor.Result) {
+				finished = append(finished, input.Name)
+			},
+		})
+		done <- summary
+	}()
+	<-provider.started
+
+	stopped := make(chan error)
+	go func() { stopped <- p.Stop(context.Background()) }()
+	require.Eventually(t, p.Stopped, time.Second, time.Millisecond)
+	close(provider.release)
+
+	summary := <-done
+	require.NoError(t, <-stopped)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Skipped, "not started before Stop")
+	assert.Equal(t, []string{"a.jpg"}, finished)
+}
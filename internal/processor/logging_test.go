@@ -0,0 +1,72 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// logRecords decodes the JSON lines logged to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestPipeline_Logging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	provider := &stubProvider{content: `{"receipt_number":"R-17","date":"2024-03-15","total_amount":45000}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client)), processor.WithLogger(logger))
+
+	result := p.ProcessReceipt(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	require.NotEmpty(t, result.CorrelationID)
+
+	var messages []string
+	for _, record := range logRecords(t, &buf) {
+		assert.Equal(t, result.CorrelationID, record[logging.CorrelationIDKey], record["msg"])
+		messages = append(messages, record["msg"].(string))
+	}
+	assert.Equal(t, []string{
+		"document started",
+		"stage started", "LLM call", "stage finished",
+		"stage started", "stage finished",
+		"document processed",
+	}, messages, "the LLM client logs through the context")
+}
+
+func TestPipeline_LoggingFailure(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	p := processor.NewPipeline(processor.WithLogger(logger))
+
+	ctx := logging.ContextWithCorrelationID(context.Background(), "upload-7")
+	result := p.ProcessXMLBytes(ctx, []byte("<Unknown/>"))
+	require.Error(t, result.Error)
+	assert.Equal(t, "upload-7", result.CorrelationID)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 2, "debug records are filtered")
+	assert.Equal(t, "stage failed", records[0]["msg"])
+	assert.Equal(t, "xml_parse", records[0]["stage"])
+	assert.Equal(t, "parse", records[0]["class"])
+	assert.Equal(t, "document failed", records[1]["msg"])
+	assert.Equal(t, "upload-7", records[1][logging.CorrelationIDKey])
+	assert.NotEmpty(t, records[1]["error"])
+}
@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/metrics"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// Stage names a step of the pipeline
+type Stage string
+
+const (
+	StageXMLParse    Stage = "xml_parse"   // Parsing an XML invoice
+	StagePDFText     Stage = "pdf_text"    // Reading the PDF text layer
+	StagePDFRender   Stage = "pdf_render"  // Rendering PDF pages to images
+	StageClassify    Stage = "classify"    // Labelling the document before LLM extraction
+	StageLLMText     Stage = "llm_text"    // LLM extraction from text
+	StageLLMVision   Stage = "llm_vision"  // LLM extraction from images
+	StagePostprocess Stage = "postprocess" // Addresses, vendor matching, validation, scoring, duplicates
+)
+
+// Document outcomes counted by Metrics
+const (
+	statusSuccess = "success"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// Metrics counts documents, stage durations and failures, and LLM calls and
+// tokens, in a metrics registry. Pass it to WithMetrics, and to
+// llm.WithTelemetry for the LLM series.
+type Metrics struct {
+	documents     *metrics.CounterVec
+	confidence    *metrics.HistogramVec
+	stageDuration *metrics.HistogramVec
+	stageFailures *metrics.CounterVec
+	llmCalls      *metrics.CounterVec
+	llmDuration   *metrics.HistogramVec
+	llmTokens     *metrics.CounterVec
+}
+
+// NewMetrics registers the pipeline metrics in reg
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		documents: reg.NewCounter("invoice_documents_total",
+			"Documents processed, by extraction method and status (success, failed, skipped)", "method", "status"),
+		confidence: reg.NewHistogram("invoice_confidence",
+			"Confidence of successful extractions, by method", []float64{0.5, 0.6, 0.7, 0.8, 0.85, 0.9, 0.95, 1}, "method"),
+		stageDuration: reg.NewHistogram("invoice_stage_duration_seconds",
+			"Duration of pipeline stages", nil, "stage"),
+		stageFailures: reg.NewCounter("invoice_stage_failures_total",
+			"Failed pipeline stages, by error class", "stage", "class"),
+		llmCalls: reg.NewCounter("invoice_llm_calls_total",
+			"LLM calls, by outcome", "provider", "model", "outcome"),
+		llmDuration: reg.NewHistogram("invoice_llm_call_duration_seconds",
+			"Latency of LLM calls", nil, "provider", "model"),
+		llmTokens: reg.NewCounter("invoice_llm_tokens_total",
+			"LLM tokens used, by type (prompt, completion, cached_prompt); cache hits are not counted", "provider", "model", "type"),
+	}
+}
+
+// WithMetrics records document, stage and failure metrics in m
+func WithMetrics(m *Metrics) PipelineOption {
+	return func(p *Pipeline) {
+		p.metrics = m
+	}
+}
+
+// RecordCall implements llm.TelemetryHook
+func (m *Metrics) RecordCall(_ context.Context, record llm.CallRecord) {
+	m.llmCalls.Inc(record.Provider, record.Model, string(record.Outcome))
+	m.llmDuration.Observe(record.Latency.Seconds(), record.Provider, record.Model)
+	if record.Outcome == llm.OutcomeCached {
+		return
+	}
+	m.llmTokens.Add(float64(record.Usage.PromptTokens-record.Usage.CachedPromptTokens), record.Provider, record.Model, "prompt")
+	m.llmTokens.Add(float64(record.Usage.CachedPromptTokens), record.Provider, record.Model, "cached_prompt")
+	m.llmTokens.Add(float64(record.Usage.CompletionTokens), record.Provider, record.Model, "completion")
+}
+
+// observeStage records the duration of a stage started at start, and its
+// failure when err is set
+func (p *Pipeline) observeStage(stage Stage, start time.Time, err error) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.stageDuration.Observe(time.Since(start).Seconds(), string(stage))
+	if err != nil {
+		p.metrics.stageFailures.Inc(string(stage), ErrorClass(err))
+	}
+}
+
+// observeDocument counts a finished document
+func (p *Pipeline) observeDocument(result *Result) {
+	if p.metrics == nil {
+		return
+	}
+	switch {
+	case errors.Is(result.Error, ErrSkipped):
+		p.metrics.documents.Inc(string(result.Method), statusSkipped)
+	case result.Error != nil || result.Invoice == nil:
+		p.metrics.documents.Inc(string(result.Method), statusFailed)
+	default:
+		p.metrics.documents.Inc(string(result.Method), statusSuccess)
+		p.metrics.confidence.Observe(result.Confidence, string(result.Method))
+	}
+}
+
+// ErrorClass groups errors for the failure metrics and quarantined
+// documents: "parse", "not_invoice", or the outcome of the LLM call that
+// failed ("timeout", "rate_limited", "circuit_open", "canceled", "error")
+func ErrorClass(err error) string {
+	var parseErr *model.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return "parse"
+	case errors.Is(err, llm.ErrNotInvoice):
+		return "not_invoice"
+	case errors.Is(err, ErrStopped):
+		return "stopped"
+	case errors.Is(err, ErrUnknownTenant):
+		return "tenant"
+	case errors.Is(err, ErrBudgetExceeded):
+		return "budget"
+	case errors.Is(err, ErrDeadlineExceeded):
+		return "deadline"
+	default:
+		return string(llm.ErrorOutcome(err))
+	}
+}
+
+var _ llm.TelemetryHook = (*Metrics)(nil)
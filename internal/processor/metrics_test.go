@@ -0,0 +1,63 @@
+package processor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/metrics"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestPipeline_Metrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := processor.NewMetrics(reg)
+
+	provider := &stubProvider{content: `{"receipt_number":"R-17","date":"2024-03-15","total_amount":45000}`}
+	client := llm.NewClient("", llm.WithProvider(provider), llm.WithTelemetry(m))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client)), processor.WithMetrics(m))
+
+	require.NoError(t, p.ProcessReceipt(context.Background(), []byte("jpeg"), "image/jpeg").Error)
+	require.NoError(t, p.ProcessXMLBytes(context.Background(), []byte(processXML)).Error)
+	require.Error(t, p.ProcessXMLBytes(context.Background(), []byte(`<Unknown/>`)).Error)
+	p.Process(context.Background(), []byte("plain text"), processor.ProcessOptions{})
+
+	var b strings.Builder
+	require.NoError(t, reg.Write(&b))
+	out := b.String()
+	model := provider.requests[0].Model
+
+	assert.Contains(t, out, `invoice_documents_total{method="llm_vision",status="success"} 1`)
+	assert.Contains(t, out, `invoice_documents_total{method="xml",status="success"} 1`)
+	assert.Contains(t, out, `invoice_documents_total{method="",status="failed"} 2`)
+	assert.Contains(t, out, `invoice_stage_duration_seconds_count{stage="llm_vision"} 1`)
+	assert.Contains(t, out, `invoice_stage_duration_seconds_count{stage="xml_parse"} 2`)
+	assert.Contains(t, out, `invoice_stage_failures_total{stage="xml_parse",class="parse"} 1`)
+	assert.Contains(t, out, `invoice_confidence_count{method="xml"} 1`)
+	assert.Contains(t, out, `invoice_llm_calls_total{provider="stub",model="`+model+`",outcome="success"} 1`)
+}
+
+func TestMetrics_RecordCall(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := processor.NewMetrics(reg)
+
+	usage := llm.Usage{PromptTokens: 1200, CachedPromptTokens: 1000, CompletionTokens: 300}
+	m.RecordCall(context.Background(), llm.CallRecord{Provider: "openai", Model: "gpt-4o", Latency: 2 * time.Second, Usage: usage, Outcome: llm.OutcomeSuccess})
+	m.RecordCall(context.Background(), llm.CallRecord{Provider: "openai", Model: "gpt-4o", Usage: usage, Outcome: llm.OutcomeCached})
+	m.RecordCall(context.Background(), llm.CallRecord{Provider: "openai", Model: "gpt-4o", Outcome: llm.OutcomeRateLimited})
+
+	var b strings.Builder
+	require.NoError(t, reg.Write(&b))
+	out := b.String()
+
+	assert.Contains(t, out, `invoice_llm_tokens_total{provider="openai",model="gpt-4o",type="prompt"} 200`)
+	assert.Contains(t, out, `invoice_llm_tokens_total{provider="openai",model="gpt-4o",type="cached_prompt"} 1000`)
+	assert.Contains(t, out, `invoice_llm_tokens_total{provider="openai",model="gpt-4o",type="completion"} 300`, "cache hits are not counted")
+	assert.Contains(t, out, `invoice_llm_calls_total{provider="openai",model="gpt-4o",outcome="rate_limited"} 1`)
+	assert.Contains(t, out, `invoice_llm_call_duration_seconds_count{provider="openai",model="gpt-4o"} 3`)
+}
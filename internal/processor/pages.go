@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// DefaultMaxMergedPages is how many pages of a long PDF are extracted in
+// groups and merged (see WithPageMerge)
+const DefaultMaxMergedPages = 30
+
+// WithPageMerge extracts up to maxPages pages of PDFs longer than
+// WithMaxVisionPages: each group of pages is extracted on its own and the
+// groups are merged into one invoice, with line items in order and the
+// totals of the last page (default: DefaultMaxMergedPages, 0 = only the
+// first group of pages is read)
+func WithPageMerge(maxPages int) PipelineOption {
+	return func(p *Pipeline) {
+		p.maxMergedPages = maxPages
+	}
+}
+
+// visionPageLimit is how many pages the vision path renders and reads
+func (p *Pipeline) visionPageLimit() int {
+	if p.maxVisionPages > 0 && p.maxMergedPages > p.maxVisionPages {
+		return p.maxMergedPages
+	}
+	return p.maxVisionPages
+}
+
+// pageGroup is the invoice read from consecutive pages of a document
+type pageGroup struct {
+	first, last int // 1-based pages
+	invoice     *model.Invoice
+}
+
+// extractPages extracts each group of WithMaxVisionPages pages and merges
+// them. The first group decides the document type; later groups are read as
+// that type, since a page of line items alone does not look like a document.
+func (p *Pipeline) extractPages(ctx context.Context, images []llm.Image, extract func(context.Context, []llm.Image) (*model.Invoice, error)) (*model.Invoice, []string, error) {
+	size := p.maxVisionPages
+	var groups []pageGroup
+	for first := 0; first < len(images); first += size {
+		groups = append(groups, pageGroup{first: first + 1, last: min(first+size, len(images))})
+	}
+
+	first, err := extract(ctx, images[:groups[0].last])
+	if err != nil {
+		return nil, nil, err
+	}
+	groups[0].invoice = first
+
+	rest := p.llmExtractor.ExtractFromImages
+	if first.DocumentType == model.DocumentTypeReceipt {
+		rest = p.llmExtractor.ExtractReceiptFromImages
+	}
+
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for i := 1; i < len(groups); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			groups[i].invoice, errs[i] = rest(ctx, images[groups[i].first-1:groups[i].last])
+		}(i)
+	}
+	wg.Wait()
+
+	warnings := []string{fmt.Sprintf("%d pages extracted in %d groups and merged", len(images), len(groups))}
+	var read []pageGroup
+	for i, g := range groups {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("pages %d-%d extraction failed: %v", g.first, g.last, errs[i]))
+			continue
+		}
+		read = append(read, g)
+	}
+
+	merged, continuity := mergePages(read)
+	warnings = append(warnings, continuity...)
+	if len(read) < len(groups) || len(continuity) > 0 {
+		merged.LowConfidenceFields = appendUnique(merged.LowConfidenceFields, "items")
+	}
+	return merged, warnings, nil
+}
+
+// mergePages combines the invoices read from consecutive page groups (see
+// stitchTiles) and checks that they continue each other: item numbers
+// should run on across pages, and a subtotal printed at the foot of an
+// inner page should carry forward the items so far.
+func mergePages(groups []pageGroup) (*model.Invoice, []string) {
+	var warnings []string
+	sum := decimal.Zero
+	lastNumber := 0
+	for i, g := range groups {
+		items := g.invoice.Items
+		if len(items) > 0 && i > 0 && lastNumber > 0 && items[0].Number > 0 && items[0].Number != lastNumber+1 {
+			warnings = append(warnings, fmt.Sprintf("line items jump from %d to %d at page %d", lastNumber, items[0].Number, g.first))
+		}
+		for j, item := range items {
+			if j > 0 && item.Number > 0 && items[j-1].Number > 0 && item.Number != items[j-1].Number+1 {
+				warnings = append(warnings, fmt.Sprintf("line items jump from %d to %d within pages %d-%d", items[j-1].Number, item.Number, g.first, g.last))
+			}
+			sum = sum.Add(item.Amount.Sub(item.DiscountAmt))
+		}
+		if len(items) > 0 && items[len(items)-1].Number > 0 {
+			lastNumber = items[len(items)-1].Number
+		}
+
+		// A subtotal before the last page is carried forward ("cộng chuyển
+		// trang"), or is the subtotal of the page alone
+		if i < len(groups)-1 && !g.invoice.SubtotalAmount.IsZero() && !sum.IsZero() {
+			if amountsDiffer(g.invoice, sum, g.invoice.SubtotalAmount) && amountsDiffer(g.invoice, pageSum(items), g.invoice.SubtotalAmount) {
+				warnings = append(warnings, fmt.Sprintf("subtotal %s at page %d does not carry forward the line items so far (%s)", g.invoice.SubtotalAmount, g.last, sum))
+			}
+		}
+	}
+
+	parts := make([]*model.Invoice, len(groups))
+	for i, g := range groups {
+		parts[i] = g.invoice
+	}
+	merged := stitchTiles(parts)
+	// The totals are those of the last page printing a total; subtotals of
+	// the pages before are carried forward, not the invoice's
+	for i := len(parts) - 1; i > 0; i-- {
+		if !parts[i].TotalAmount.IsZero() {
+			merged.SubtotalAmount, merged.TaxAmount, merged.TotalAmount = parts[i].SubtotalAmount, parts[i].TaxAmount, parts[i].TotalAmount
+			break
+		}
+	}
+	return merged, warnings
+}
+
+func pageSum(items []model.LineItem) decimal.Decimal {
+	sum := decimal.Zero
+	for _, item := range items {
+		sum = sum.Add(item.Amount.Sub(item.DiscountAmt))
+	}
+	return sum
+}
+
+// amountsDiffer reports whether two amounts of inv differ by more than rounding
+func amountsDiffer(inv *model.Invoice, a, b decimal.Decimal) bool {
+	return a.Sub(b).Abs().GreaterThan(inv.RoundingTolerance())
+}
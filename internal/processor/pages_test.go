@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func numberedItems(from, to int) []model.LineItem {
+	var items []model.LineItem
+	for n := from; n <= to; n++ {
+		items = append(items, model.LineItem{Number: n, Name: fmt.Sprintf("Item %d", n), Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(1000)})
+	}
+	return items
+}
+
+func TestMergePages(t *testing.T) {
+	groups := []pageGroup{
+		{first: 1, last: 2, invoice: &model.Invoice{
+			Number:         "0000042",
+			Seller:         model.Party{TaxID: "0123456789"},
+			Items:          numberedItems(1, 20),
+			SubtotalAmount: decimal.NewFromInt(20000), // Carried forward
+		}},
+		{first: 3, last: 4, invoice: &model.Invoice{
+			Items:          numberedItems(21, 35),
+			SubtotalAmount: decimal.NewFromInt(15000), // Subtotal of the page alone
+		}},
+		{first: 5, last: 5, invoice: &model.Invoice{
+			Items:          numberedItems(36, 40),
+			SubtotalAmount: decimal.NewFromInt(40000),
+			TaxAmount:      decimal.NewFromInt(4000),
+			TotalAmount:    decimal.NewFromInt(44000),
+		}},
+	}
+
+	merged, warnings := mergePages(groups)
+	assert.Empty(t, warnings)
+	assert.Equal(t, "0000042", merged.Number)
+	require.Len(t, merged.Items, 40)
+	assert.Equal(t, 40, merged.Items[39].Number)
+	assert.True(t, decimal.NewFromInt(40000).Equal(merged.SubtotalAmount))
+	assert.True(t, decimal.NewFromInt(44000).Equal(merged.TotalAmount))
+}
+
+func TestMergePages_Continuity(t *testing.T) {
+	groups := []pageGroup{
+		{first: 1, last: 1, invoice: &model.Invoice{Items: numberedItems(1, 10), SubtotalAmount: decimal.NewFromInt(12000)}},
+		{first: 2, last: 2, invoice: &model.Invoice{Items: numberedItems(14, 20), TotalAmount: decimal.NewFromInt(17000)}},
+	}
+
+	_, warnings := mergePages(groups)
+	assert.Equal(t, []string{
+		"subtotal 12000 at page 1 does not carry forward the line items so far (10000)",
+		"line items jump from 10 to 14 at page 2",
+	}, warnings)
+}
+
+// pageProvider answers with the line items of the pages it is sent,
+// recognized by the page number in the image data
+type pageProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *pageProvider) Name() string { return "pages" }
+
+func (p *pageProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	var first, last int
+	fmt.Sscanf(string(req.Images[0].Data), "page %d", &first)
+	fmt.Sscanf(string(req.Images[len(req.Images)-1].Data), "page %d", &last)
+	items := ""
+	for n := first; n <= last; n++ {
+		if items != "" {
+			items += ","
+		}
+		items += fmt.Sprintf(`{"number":%d,"name":"Item %d","quantity":1,"amount":1000}`, n, n)
+	}
+	content := fmt.Sprintf(`{"document_type":"invoice","items":[%s]}`, items)
+	if first == 1 {
+		content = fmt.Sprintf(`{"document_type":"invoice","invoice_number":"0000042","items":[%s]}`, items)
+	}
+	if last == 7 {
+		content = fmt.Sprintf(`{"items":[%s],"subtotal_amount":7000,"total_amount":7700}`, items)
+	}
+	return &llm.Response{Content: content, Model: req.Model}, nil
+}
+
+func TestExtractPages(t *testing.T) {
+	provider := &pageProvider{}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := NewPipeline(WithLLMExtractor(llm.NewExtractor(client)), WithMaxVisionPages(3))
+
+	var images []llm.Image
+	for n := 1; n <= 7; n++ {
+		images = append(images, llm.Image{Data: []byte(fmt.Sprintf("page %d", n)), MimeType: "image/jpeg"})
+	}
+
+	inv, warnings, err := p.extractVision(context.Background(), images, p.llmExtractor.ExtractFromImagesAuto)
+	require.NoError(t, err)
+	assert.Equal(t, 3, provider.calls)
+	assert.Equal(t, []string{"7 pages extracted in 3 groups and merged"}, warnings)
+	assert.Equal(t, "0000042", inv.Number)
+	require.Len(t, inv.Items, 7)
+	assert.Equal(t, "Item 7", inv.Items[6].Name)
+	assert.True(t, decimal.NewFromInt(7700).Equal(inv.TotalAmount))
+
+	assert.Equal(t, 30, p.visionPageLimit())
+	assert.Equal(t, 3, NewPipeline(WithMaxVisionPages(3), WithPageMerge(0)).visionPageLimit())
+}
@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// RulePDFMatch names the findings of ProcessPair for fields on which the
+// PDF copy of an invoice doesn't match its XML
+const RulePDFMatch = "pdf_match"
+
+// Discrepancy is a key field on which the PDF copy of an invoice differs
+// from its XML
+type Discrepancy struct {
+	Field string `json:"field"` // JSON path, e.g. "seller.tax_id"
+	XML   string `json:"xml"`
+	PDF   string `json:"pdf"`
+}
+
+// String renders the discrepancy for a warning
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s: XML %q, PDF %q", d.Field, d.XML, d.PDF)
+}
+
+// PairResult is the result of ProcessPair
+type PairResult struct {
+	XML           *Result       // The invoice read from the XML, the legally binding copy
+	PDF           *Result       // What was read from the PDF copy
+	Discrepancies []Discrepancy // Key fields the PDF gets different from the XML
+}
+
+// ProcessPair reads an invoice delivered as XML with a PDF copy, and checks
+// the PDF against the XML. The XML result is returned with a finding per
+// discrepancy (see RulePDFMatch); a mismatched total is an error. Fields
+// missing from the PDF are not discrepancies. The PDF result is not
+// post-processed or checked for duplicates.
+func (p *Pipeline) ProcessPair(ctx context.Context, xmlData, pdfData []byte) *PairResult {
+	ctx, span := p.startDocument(ctx, "pair")
+	defer span.End()
+
+	pair := &PairResult{PDF: p.processPDF(ctx, nil, pdfData, "application/pdf")}
+
+	stageCtx, stage := p.startStage(ctx, StageXMLParse)
+	inv, err := p.xmlRegistry.Parse(stageCtx, xmlData)
+	stage.end(err)
+	if err != nil {
+		pair.XML = p.finish(ctx, &Result{Error: fmt.Errorf("XML parsing failed: %w", err)})
+		return pair
+	}
+
+	result := &Result{Invoice: inv, Method: MethodXML, Confidence: 1.0}
+	if pair.PDF.Invoice != nil && pair.PDF.Error == nil {
+		pair.Discrepancies = compareInvoices(inv, pair.PDF.Invoice)
+		for _, d := range pair.Discrepancies {
+			finding := ValidationFinding{
+				Rule:     RulePDFMatch,
+				Field:    d.Field,
+				Message:  "PDF copy differs from the XML on " + d.String(),
+				Severity: SeverityWarning,
+			}
+			if isTotalField(d.Field) {
+				finding.Severity = SeverityError
+			}
+			result.Findings = append(result.Findings, finding)
+			result.Warnings = append(result.Warnings, finding.String())
+		}
+	} else {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("PDF copy could not be read: %v", pair.PDF.Error))
+	}
+	pair.XML = p.finish(ctx, result)
+	return pair
+}
+
+// compareInvoices lists the key fields of pdf that are set and differ from
+// xml. Text is compared ignoring case and spacing, as in the ensemble merge.
+func compareInvoices(xml, pdf *model.Invoice) []Discrepancy {
+	var d []Discrepancy
+	text := func(field, a, b string) {
+		if !isBlank(b) && !sameText(a, b) {
+			d = append(d, Discrepancy{Field: field, XML: a, PDF: b})
+		}
+	}
+	amount := func(field string, a, b decimal.Decimal) {
+		if !b.IsZero() && !a.Equal(b) {
+			d = append(d, Discrepancy{Field: field, XML: a.String(), PDF: b.String()})
+		}
+	}
+
+	text("number", xml.Number, pdf.Number)
+	text("series", xml.Series, pdf.Series)
+	if !pdf.Date.IsZero() && !xml.Date.Equal(pdf.Date) {
+		d = append(d, Discrepancy{Field: "date", XML: formatPairDate(xml.Date), PDF: formatPairDate(pdf.Date)})
+	}
+	text("seller.tax_id", xml.Seller.TaxID, pdf.Seller.TaxID)
+	text("buyer.tax_id", xml.Buyer.TaxID, pdf.Buyer.TaxID)
+	amount("subtotal_amount", xml.SubtotalAmount, pdf.SubtotalAmount)
+	amount("tax_amount", xml.TaxAmount, pdf.TaxAmount)
+	amount("total_amount", xml.TotalAmount, pdf.TotalAmount)
+	text("currency", xml.Currency, pdf.Currency)
+	if len(pdf.Items) > 0 && len(pdf.Items) != len(xml.Items) {
+		d = append(d, Discrepancy{Field: "items", XML: strconv.Itoa(len(xml.Items)), PDF: strconv.Itoa(len(pdf.Items))})
+	}
+	return d
+}
+
+func formatPairDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func TestCompareInvoices(t *testing.T) {
+	xml := &model.Invoice{
+		Number:      "0000042",
+		Series:      "C24TAA",
+		Date:        time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Seller:      model.Party{Name: "Công ty ABC", TaxID: "0123456789"},
+		TaxAmount:   decimal.NewFromInt(16000),
+		TotalAmount: decimal.NewFromInt(216000),
+		Items:       []model.LineItem{{Name: "A"}, {Name: "B"}},
+	}
+
+	same := *xml
+	same.Series = "c24taa "
+	same.Seller.Name = "Cong ty ABC" // Names are not compared
+	same.TaxAmount = decimal.Zero    // Not read from the PDF
+	assert.Empty(t, compareInvoices(xml, &same))
+
+	differs := *xml
+	differs.Seller.TaxID = "0123456780"
+	differs.Date = xml.Date.AddDate(0, 0, 1)
+	differs.TotalAmount = decimal.NewFromInt(261000)
+	differs.Items = differs.Items[:1]
+	assert.Equal(t, []Discrepancy{
+		{Field: "date", XML: "2024-03-15", PDF: "2024-03-16"},
+		{Field: "seller.tax_id", XML: "0123456789", PDF: "0123456780"},
+		{Field: "total_amount", XML: "216000", PDF: "261000"},
+		{Field: "items", XML: "2", PDF: "1"},
+	}, compareInvoices(xml, &differs))
+}
+
+func TestProcessPair_UnreadablePDF(t *testing.T) {
+	p := NewPipeline()
+	xmlData := []byte(`<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`)
+
+	pair := p.ProcessPair(context.Background(), xmlData, []byte("%PDF-1.4\n"))
+	require.NoError(t, pair.XML.Error)
+	assert.Equal(t, "0000042", pair.XML.Invoice.Number)
+	assert.Error(t, pair.PDF.Error)
+	assert.Empty(t, pair.Discrepancies)
+	assert.Contains(t, pair.XML.Warnings[0], "PDF copy could not be read")
+
+	pair = p.ProcessPair(context.Background(), []byte("<Unknown/>"), []byte("%PDF-1.4\n"))
+	assert.Error(t, pair.XML.Error)
+}
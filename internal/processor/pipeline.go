@@ -2,13 +2,22 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
 	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/msg"
 	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+	"github.com/rezonia/invoice-processor/internal/parser/spreadsheet"
 	"github.com/rezonia/invoice-processor/internal/parser/xml"
+	"github.com/rezonia/invoice-processor/internal/tracing"
+	"github.com/rezonia/invoice-processor/internal/uom"
 )
 
 // ExtractionMethod indicates how the invoice was extracted
@@ -18,14 +27,22 @@ const (
 	MethodXML       ExtractionMethod = "xml"
 	MethodLLMText   ExtractionMethod = "llm_text"
 	MethodLLMVision ExtractionMethod = "llm_vision"
+
+	// MethodLLMEnsemble merges the text and vision paths (see WithEnsemble)
+	MethodLLMEnsemble ExtractionMethod = "llm_ensemble"
 )
 
-// Confidence levels for extraction methods
+// Prior confidence of the extraction methods; the final score also weighs
+// completeness, uncertain fields and validation (see ScoreConfidence)
 const (
-	ConfidenceVisionInvoice = 0.80 // Standard document OCR quality
-	ConfidenceVisionReceipt = 0.75 // Lower due to thermal paper degradation
+	ConfidenceLLMText       = 0.90 // Text layer read by the LLM
+	ConfidenceVisionInvoice = 0.85 // Standard document OCR quality
+	ConfidenceVisionReceipt = 0.80 // Lower due to thermal paper degradation
 )
 
+// DefaultMaxVisionPages is how many PDF pages are sent in one vision request
+const DefaultMaxVisionPages = 5
+
 // Result represents the extraction result with metadata
 type Result struct {
 	Invoice    *model.Invoice   `json:"invoice"`
@@ -33,6 +50,86 @@ type Result struct {
 	Confidence float64          `json:"confidence"`
 	Warnings   []string         `json:"warnings,omitempty"`
 	Error      error            `json:"-"`
+
+	// HasHandwriting is set when key values were written by hand; such documents need manual review
+	HasHandwriting bool `json:"has_handwriting,omitempty"`
+
+	// Pages holding the invoice when a file bundles several (see ProcessPDFDocuments)
+	Pages *llm.PageRange `json:"pages,omitempty"`
+
+	// Vendor the seller was matched to, with the match score (see WithVendorMatcher)
+	Vendor *VendorMatch `json:"vendor,omitempty"`
+
+	// Source is the archive member or email attachment the document came
+	// from, such as "export.zip/0000123.xml" (see Process)
+	Source string `json:"source,omitempty"`
+
+	// Submission is the email the document was attached to, shared by the
+	// results of its other attachments (see Process)
+	Submission *Submission `json:"submission,omitempty"`
+
+	// Findings of the validation stage, also listed in Warnings (see WithValidation)
+	Findings []ValidationFinding `json:"findings,omitempty"`
+
+	// Signals Confidence was computed from (see ScoreConfidence)
+	Signals *ConfidenceSignals `json:"signals,omitempty"`
+
+	// Fingerprint of the invoice, and whether it was seen before under
+	// another document (see WithDuplicateStore)
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Duplicate   bool   `json:"duplicate,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// CorrelationID tags every log record of the document (see WithLogger)
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Tenant the document was processed for (see WithTenants)
+	Tenant string `json:"tenant,omitempty"`
+
+	// Retries counts the stages run again after transient failures (see
+	// WithStageRetry)
+	Retries int `json:"retries,omitempty"`
+
+	// Raw holds every LLM call of the document as sent and received, for
+	// audit (see WithRawResponses)
+	Raw []llm.AuditEvent `json:"raw,omitempty"`
+
+	// Debug holds the text, page images and LLM calls the invoice was
+	// extracted from (see WithDebug)
+	Debug *DebugInfo `json:"debug,omitempty"`
+
+	// IdempotentReplay is set on the results of a document submitted before
+	// with the same idempotency key, returned without processing it again
+	// (see WithIdempotency)
+	IdempotentReplay bool `json:"idempotent_replay,omitempty"`
+
+	// DeadlineExceeded is set when stages of the document were cut off by
+	// its deadline; the result holds what was read in time (see
+	// WithDocumentDeadline)
+	DeadlineExceeded bool `json:"deadline_exceeded,omitempty"`
+
+	// Data is the document the result was read from, set by Process, so a
+	// result that needs review can be stored with it. Archive members and
+	// attachments are unpacked.
+	Data []byte `json:"-"`
+}
+
+// EncodedResult is a Result as connectors write it to JSON, with the error
+// Result doesn't encode
+type EncodedResult struct {
+	*Result
+	Error   string `json:"error,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"` // Archive member or attachment that is not an invoice (see ErrSkipped)
+}
+
+// Encode returns r with its error as text
+func (r *Result) Encode() *EncodedResult {
+	encoded := &EncodedResult{Result: r}
+	if r.Error != nil {
+		encoded.Error = r.Error.Error()
+		encoded.Skipped = errors.Is(r.Error, ErrSkipped)
+	}
+	return encoded
 }
 
 // Pipeline orchestrates the hybrid extraction process
@@ -40,6 +137,39 @@ type Pipeline struct {
 	xmlRegistry  *xml.Registry
 	pdfExtractor *pdf.Extractor
 	llmExtractor *llm.Extractor
+
+	maxVisionPages   int
+	maxMergedPages   int
+	ensemble         bool
+	race             bool
+	layoutClassifier LayoutClassifier
+	classifier       DocumentClassifier
+	tiling           TilingOptions
+	addresses        bool
+	llmAddresses     bool
+	units            *uom.Normalizer // nil = units are not normalized
+	vendorMatcher    VendorMatcher
+	validation       bool
+	validationRules  []ValidationRule
+	scorer           ConfidenceScorer
+	duplicates       DuplicateStore
+	metrics          *Metrics
+	tracer           tracing.Tracer
+	logger           logging.Logger
+	hooks            []Hooks
+	stageRetry       map[Stage]StageRetryPolicy
+	retryBudget      int
+	debug            *DebugOptions
+	rawResponses     bool
+	strategies       []Strategy
+	idempotency      *idempotency
+	tenants          map[string]Tenant
+	defaultTenant    string
+	budget           *BudgetController
+	deadline         time.Duration
+	stageShares      map[Stage]float64
+	sheetMapping     SpreadsheetMapping
+	lifecycle        lifecycle
 }
 
 // PipelineOption configures the pipeline
@@ -52,16 +182,35 @@ func WithLLMExtractor(extractor *llm.Extractor) PipelineOption {
 	}
 }
 
+// WithMaxVisionPages caps the PDF pages sent to the vision model (default: DefaultMaxVisionPages)
+func WithMaxVisionPages(n int) PipelineOption {
+	return func(p *Pipeline) {
+		p.maxVisionPages = n
+	}
+}
+
 // NewPipeline creates a new extraction pipeline
 func NewPipeline(opts ...PipelineOption) *Pipeline {
 	p := &Pipeline{
-		xmlRegistry:  xml.NewRegistry(),
-		pdfExtractor: pdf.NewExtractor(),
+		xmlRegistry:    xml.NewRegistry(),
+		pdfExtractor:   pdf.NewExtractor(),
+		maxVisionPages: DefaultMaxVisionPages,
+		maxMergedPages: DefaultMaxMergedPages,
+		tiling:         DefaultTilingOptions(),
+		addresses:      true,
+		units:          uom.NewNormalizer(nil),
+		validation:     true,
+		scorer:         ScoreConfidence,
+		stageRetry:     defaultStageRetry(),
+		retryBudget:    DefaultRetryBudget,
 	}
 
 	for _, opt := range opts {
 		opt(p)
 	}
+	if p.validationRules == nil {
+		p.validationRules = DefaultValidationRules()
+	}
 
 	return p
 }
@@ -79,28 +228,39 @@ func (p *Pipeline) ProcessXML(ctx context.Context, r io.Reader) *Result {
 
 // ProcessXMLBytes processes XML invoice from bytes
 func (p *Pipeline) ProcessXMLBytes(ctx context.Context, data []byte) *Result {
-	inv, err := p.xmlRegistry.Parse(ctx, data)
+	ctx, span := p.startDocument(ctx, "xml")
+	defer span.End()
+
+	var inv *model.Invoice
+	err := p.runStage(ctx, StageXMLParse, func(ctx context.Context) (err error) {
+		inv, err = p.xmlRegistry.Parse(ctx, data)
+		return err
+	})
 	if err != nil {
-		return &Result{
+		return p.finish(ctx, &Result{
 			Error: fmt.Errorf("XML parsing failed: %w", err),
-		}
+		})
 	}
 
-	return &Result{
+	return p.finish(ctx, &Result{
 		Invoice:    inv,
 		Method:     MethodXML,
 		Confidence: 1.0, // XML is deterministic
-	}
+	})
 }
 
-// ProcessPDF processes a PDF invoice using LLM extraction
+// ProcessPDF processes a PDF invoice with the strategy chain (see
+// WithStrategies): by default LLM text extraction, then vision. Without an
+// LLM extractor, the text layer is read with a layout template or label
+// rules.
 func (p *Pipeline) ProcessPDF(ctx context.Context, r io.Reader, imageData []byte, mimeType string) *Result {
-	if p.llmExtractor == nil {
-		return &Result{
-			Error: fmt.Errorf("LLM extractor not configured - required for PDF processing"),
-		}
-	}
+	ctx, span := p.startDocument(ctx, "pdf")
+	defer span.End()
+
+	return p.finish(ctx, p.processPDF(ctx, r, imageData, mimeType))
+}
 
+func (p *Pipeline) processPDF(ctx context.Context, r io.Reader, imageData []byte, mimeType string) *Result {
 	// Read PDF data
 	var pdfData []byte
 	var err error
@@ -120,57 +280,133 @@ func (p *Pipeline) ProcessPDF(ctx context.Context, r io.Reader, imageData []byte
 		}
 	}
 
-	// Step 1: Try LLM text extraction (extract text from PDF, then use LLM)
-	textResult := p.tryLLMTextExtraction(ctx, pdfData)
-	if textResult.Invoice != nil && textResult.Error == nil {
-		return textResult
-	}
+	return p.runStrategies(ctx, pdfData, mimeType)
+}
 
-	// Step 2: Try LLM vision extraction as fallback
-	visionResult := p.tryLLMVisionExtraction(ctx, pdfData, mimeType)
-	if visionResult.Invoice != nil {
-		return visionResult
+// ProcessImage processes an image invoice using LLM vision. The pages of a
+// TIFF are converted to PNG and sent together.
+func (p *Pipeline) ProcessImage(ctx context.Context, imageData []byte, mimeType string) *Result {
+	ctx, span := p.startDocument(ctx, "image", tracing.String("document.mime_type", mimeType))
+	defer span.End()
+
+	if p.llmExtractor == nil {
+		return p.finish(ctx, &Result{
+			Error: fmt.Errorf("LLM extractor not configured"),
+		})
 	}
 
-	// Return error with context from both attempts
-	warnings := textResult.Warnings
-	if visionResult.Error != nil {
-		warnings = append(warnings, visionResult.Warnings...)
+	return p.finish(ctx, p.tryLLMVisionExtraction(ctx, imageData, mimeType))
+}
+
+// ProcessReceipt processes a POS receipt image (or PDF scan) with the receipt prompts
+func (p *Pipeline) ProcessReceipt(ctx context.Context, data []byte, mimeType string) *Result {
+	ctx, span := p.startDocument(ctx, "receipt", tracing.String("document.mime_type", mimeType))
+	defer span.End()
+
+	if p.llmExtractor == nil {
+		return p.finish(ctx, &Result{
+			Error: fmt.Errorf("LLM extractor not configured"),
+		})
 	}
 
-	if visionResult.Error != nil {
-		return &Result{
-			Error:    fmt.Errorf("PDF extraction failed (text: %v, vision: %v)", textResult.Error, visionResult.Error),
-			Warnings: warnings,
-		}
+	images, warnings, _, err := p.visionImages(ctx, data, mimeType, p.visionPageLimit())
+	if err != nil {
+		return p.finish(ctx, &Result{Error: err, Warnings: warnings})
 	}
 
-	if textResult.Error != nil {
-		return &Result{
-			Error:    fmt.Errorf("PDF extraction failed: %w", textResult.Error),
-			Warnings: textResult.Warnings,
-		}
+	var receipt *model.Invoice
+	var tileWarnings []string
+	err = p.runStage(ctx, StageLLMVision, func(ctx context.Context) (err error) {
+		receipt, tileWarnings, err = p.extractVision(ctx, images, p.llmExtractor.ExtractReceiptFromImages)
+		return err
+	})
+	warnings = append(warnings, tileWarnings...)
+	if err != nil {
+		return p.finish(ctx, &Result{
+			Error:    err,
+			Warnings: append(warnings, fmt.Sprintf("LLM receipt extraction failed: %v", err)),
+		})
 	}
 
-	return &Result{
-		Error: fmt.Errorf("PDF extraction failed"),
+	return p.finish(ctx, &Result{
+		Invoice:    receipt,
+		Method:     MethodLLMVision,
+		Confidence: ConfidenceVisionReceipt,
+		Warnings:   append(warnings, qualityWarnings(receipt)...),
+
+		HasHandwriting: receipt.HasHandwriting,
+	})
+}
+
+// finish post-processes a successful result before it is returned, with the
+// hooks around it, and records the document in the metrics, trace and log
+func (p *Pipeline) finish(ctx context.Context, result *Result) *Result {
+	if result.Submission == nil {
+		result.Submission = submissionFromContext(ctx)
+	}
+	if err := stopped(ctx, result); err != nil {
+		result.Error = err
+	} else if err := unknownTenant(ctx); err != nil {
+		result.Error = err
+	}
+	if result.Invoice != nil {
+		result.Invoice.SchemaVersion = model.InvoiceSchemaVersion
+	}
+	if result.Invoice != nil && result.Error == nil {
+		result.Error = p.invoiceExtracted(ctx, result)
+	}
+	if result.Invoice != nil && result.Error == nil {
+		p.postprocess(ctx, result)
+		result.Error = p.validated(ctx, result)
+	}
+	deadlineExceeded(ctx, result)
+	result.Retries = retriesUsed(ctx)
+	result.Debug = debugInfo(ctx)
+	if p.rawResponses {
+		result.Raw = llmCalls(ctx)
+	}
+	if decision := budgetDecision(ctx); decision != "" {
+		result.Warnings = append(result.Warnings, decision)
 	}
+	recordResult(ctx, result)
+	p.observeDocument(result)
+	p.finished(ctx, result)
+	return result
 }
 
-// ProcessImage processes an image invoice using LLM vision
-func (p *Pipeline) ProcessImage(ctx context.Context, imageData []byte, mimeType string) *Result {
-	if p.llmExtractor == nil {
-		return &Result{
-			Error: fmt.Errorf("LLM extractor not configured"),
+// postprocess normalizes credit notes, addresses and units, matches the
+// vendor, validates, scores and checks for a duplicate
+func (p *Pipeline) postprocess(ctx context.Context, result *Result) {
+	stageCtx, stage := p.startStage(ctx, StagePostprocess)
+	result.Invoice.NormalizeCreditNote()
+	if p.addresses {
+		result.Warnings = append(result.Warnings, p.normalizeAddresses(stageCtx, result.Invoice)...)
+	}
+	if p.units != nil {
+		p.units.Normalize(result.Invoice)
+	}
+	if p.vendorMatcher != nil {
+		vendor, err := p.vendorMatcher.Match(stageCtx, result.Invoice.Seller)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("vendor matching failed: %v", err))
 		}
+		result.Vendor = vendor
 	}
-
-	return p.tryLLMVisionExtraction(ctx, imageData, mimeType)
+	if p.validation {
+		p.validate(ctx, result)
+	}
+	p.score(result)
+	p.checkDuplicate(stageCtx, result)
+	stage.end(nil)
 }
 
 func (p *Pipeline) tryLLMTextExtraction(ctx context.Context, pdfData []byte) *Result {
 	// Extract text from PDF
-	extracted, err := p.pdfExtractor.ExtractBytes(ctx, pdfData)
+	var extracted *pdf.ExtractedText
+	err := p.runStage(ctx, StagePDFText, func(ctx context.Context) (err error) {
+		extracted, err = p.pdfExtractor.ExtractBytes(ctx, pdfData)
+		return err
+	})
 	if err != nil {
 		return &Result{
 			Error:    err,
@@ -185,53 +421,111 @@ func (p *Pipeline) tryLLMTextExtraction(ctx context.Context, pdfData []byte) *Re
 		}
 	}
 
+	return p.extractText(ctx, extracted.RawText, extracted.Metadata)
+}
+
+// extractText extracts an invoice from PDF text with the layout template or the
+// LLM, or with label rules when no LLM is configured
+func (p *Pipeline) extractText(ctx context.Context, text string, meta pdf.Metadata) *Result {
+	text, err := p.textExtracted(ctx, text)
+	if err != nil {
+		return &Result{Error: err}
+	}
+	debugText(ctx, text)
+
+	// Recurring layouts may have a template or tuned prompts
+	ctx, layout := p.classifyLayout(ctx, text, meta)
+	var warnings []string
+	if layout != nil && layout.Template != nil {
+		invoice, err := layout.Template.Extract(text)
+		if err == nil && invoice != nil {
+			if invoice.Provider == model.ProviderUnknown {
+				invoice.Provider = InferProvider(invoice, text, meta)
+			}
+			return &Result{
+				Invoice:    invoice,
+				Method:     MethodTemplate,
+				Confidence: ConfidenceTemplate,
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("layout %q template failed: %v", layout.Name, err))
+	}
+
+	skipped, classifyWarnings := p.preclassify(ctx, text, nil)
+	if skipped != nil {
+		return skipped
+	}
+	warnings = append(warnings, classifyWarnings...)
+
+	if p.llmExtractor == nil {
+		return extractRules(text, meta, warnings)
+	}
+
 	// Use LLM to extract from text
-	invoice, err := p.llmExtractor.ExtractFromOCRText(ctx, extracted.RawText)
+	var invoice *model.Invoice
+	err = p.runStage(ctx, StageLLMText, func(ctx context.Context) (err error) {
+		invoice, err = p.llmExtractor.ExtractFromOCRText(ctx, text)
+		return err
+	})
 	if err != nil {
 		return &Result{
 			Error:    err,
-			Warnings: []string{fmt.Sprintf("LLM text extraction failed: %v", err)},
+			Warnings: append(warnings, fmt.Sprintf("LLM text extraction failed: %v", err)),
 		}
 	}
 
+	if invoice.Provider == model.ProviderUnknown {
+		invoice.Provider = InferProvider(invoice, text, meta)
+	}
+
 	return &Result{
 		Invoice:    invoice,
 		Method:     MethodLLMText,
-		Confidence: 0.85, // LLM text extraction generally reliable
+		Confidence: ConfidenceLLMText,
+		Warnings:   append(warnings, qualityWarnings(invoice)...),
 	}
 }
 
 func (p *Pipeline) tryLLMVisionExtraction(ctx context.Context, data []byte, mimeType string) *Result {
-	var imageData []byte
-	var imageMimeType string
+	images, warnings, meta, err := p.visionImages(ctx, data, mimeType, p.visionPageLimit())
+	if err != nil {
+		return &Result{Error: err, Warnings: warnings}
+	}
 
-	// If data is PDF, convert to image first
-	if mimeType == "application/pdf" || (len(data) >= 4 && string(data[:4]) == "%PDF") {
-		images, err := p.pdfExtractor.ConvertToImages(ctx, data)
-		if err != nil {
-			return &Result{
-				Error:    fmt.Errorf("failed to convert PDF to images: %w", err),
-				Warnings: []string{fmt.Sprintf("PDF to image conversion failed: %v", err)},
-			}
-		}
-		// Use first page for vision extraction
-		imageData = images[0]
-		// Detect image format from magic bytes
-		imageMimeType = detectImageMimeType(imageData)
-	} else {
-		imageData = data
-		imageMimeType = mimeType
+	return p.extractImages(ctx, images, meta, warnings)
+}
+
+// extractImages extracts an invoice or receipt from page images
+func (p *Pipeline) extractImages(ctx context.Context, images []llm.Image, meta pdf.Metadata, warnings []string) *Result {
+	// Without text, only PDF metadata can identify the layout
+	ctx, _ = p.classifyLayout(ctx, "", meta)
+
+	skipped, classifyWarnings := p.preclassify(ctx, "", images)
+	if skipped != nil {
+		skipped.Warnings = warnings
+		return skipped
 	}
+	warnings = append(warnings, classifyWarnings...)
 
 	// Use auto-detect extraction for images (handles both invoices and receipts)
-	invoice, err := p.llmExtractor.ExtractFromImageAuto(ctx, imageData, imageMimeType)
+	var invoice *model.Invoice
+	var tileWarnings []string
+	err := p.runStage(ctx, StageLLMVision, func(ctx context.Context) (err error) {
+		invoice, tileWarnings, err = p.extractVision(ctx, images, p.llmExtractor.ExtractFromImagesAuto)
+		return err
+	})
+	warnings = append(warnings, tileWarnings...)
 	if err != nil {
 		return &Result{
 			Error:    err,
-			Warnings: []string{fmt.Sprintf("LLM vision extraction failed: %v", err)},
+			Warnings: append(warnings, fmt.Sprintf("LLM vision extraction failed: %v", err)),
 		}
 	}
 
+	if invoice != nil && invoice.Provider == model.ProviderUnknown {
+		invoice.Provider = InferProvider(invoice, "", meta)
+	}
+
 	// Set confidence based on document type
 	confidence := ConfidenceVisionInvoice
 	if invoice != nil && invoice.DocumentType == model.DocumentTypeReceipt {
@@ -242,9 +536,95 @@ func (p *Pipeline) tryLLMVisionExtraction(ctx context.Context, data []byte, mime
 		Invoice:    invoice,
 		Method:     MethodLLMVision,
 		Confidence: confidence,
+		Warnings:   append(warnings, qualityWarnings(invoice)...),
+
+		HasHandwriting: invoice != nil && invoice.HasHandwriting,
 	}
 }
 
+// qualityWarnings reports uncertain, handwritten and corrected fields
+func qualityWarnings(inv *model.Invoice) []string {
+	warnings := lowConfidenceWarnings(inv)
+	if inv != nil && inv.HasHandwriting {
+		warnings = append(warnings, fmt.Sprintf("handwritten fields: %s", strings.Join(inv.HandwrittenFields, ", ")))
+	}
+	if inv != nil && len(inv.Corrections) > 0 {
+		warnings = append(warnings, fmt.Sprintf("amounts corrected after arithmetic check: %s", strings.Join(inv.Corrections, "; ")))
+	}
+	if inv != nil && inv.TextTruncated {
+		warnings = append(warnings, "document text was truncated to fit the model context; line items may be incomplete")
+	}
+	return warnings
+}
+
+// lowConfidenceWarnings reports fields the extractor flagged as uncertain
+func lowConfidenceWarnings(inv *model.Invoice) []string {
+	if inv == nil || len(inv.LowConfidenceFields) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("low confidence fields: %s", strings.Join(inv.LowConfidenceFields, ", "))}
+}
+
+// visionImages prepares data for a vision request, rendering up to maxPages
+// PDF pages to images
+func (p *Pipeline) visionImages(ctx context.Context, data []byte, mimeType string, maxPages int) ([]llm.Image, []string, pdf.Metadata, error) {
+	var meta pdf.Metadata
+
+	if isTIFF(data) {
+		pages, err := tiffPages(data)
+		if err != nil {
+			return nil, nil, meta, fmt.Errorf("failed to read TIFF image: %w", err)
+		}
+		var warnings []string
+		if maxPages > 0 && len(pages) > maxPages {
+			warnings = append(warnings, fmt.Sprintf("only the first %d of %d pages were sent for vision extraction", maxPages, len(pages)))
+			pages = pages[:maxPages]
+		}
+		images := toImages(pages)
+		debugImages(ctx, images)
+		return images, warnings, meta, nil
+	}
+	if mimeType != "application/pdf" && !(len(data) >= 4 && string(data[:4]) == "%PDF") {
+		images := []llm.Image{{Data: data, MimeType: mimeType}}
+		debugImages(ctx, images)
+		return images, nil, meta, nil
+	}
+
+	if md, err := p.pdfExtractor.ReadMetadata(ctx, data); err == nil {
+		meta = *md
+	}
+
+	var pages [][]byte
+	err := p.runStage(ctx, StagePDFRender, func(ctx context.Context) (err error) {
+		pages, err = p.pdfExtractor.ConvertToImages(ctx, data)
+		return err
+	})
+	if err != nil {
+		return nil, []string{fmt.Sprintf("PDF to image conversion failed: %v", err)}, meta, fmt.Errorf("failed to convert PDF to images: %w", err)
+	}
+
+	// Send all pages together so multi-page documents are extracted coherently
+	var warnings []string
+	if maxPages > 0 && len(pages) > maxPages {
+		warnings = append(warnings, fmt.Sprintf("only the first %d of %d pages were sent for vision extraction", maxPages, len(pages)))
+		pages = pages[:maxPages]
+	}
+
+	images := toImages(pages)
+	debugImages(ctx, images)
+	return images, warnings, meta, nil
+}
+
+// toImages wraps rendered PDF pages for the vision model
+func toImages(pages [][]byte) []llm.Image {
+	images := make([]llm.Image, 0, len(pages))
+	for _, page := range pages {
+		// Detect image format from magic bytes
+		images = append(images, llm.Image{Data: page, MimeType: detectImageMimeType(page)})
+	}
+	return images
+}
+
 // detectImageMimeType detects the MIME type of image data from magic bytes
 func detectImageMimeType(data []byte) string {
 	if len(data) >= 3 {
@@ -269,6 +649,25 @@ func DetectFormat(data []byte) Format {
 		return FormatUnknown
 	}
 
+	// ZIP local file header, or the end record of an empty archive. Checked
+	// first: member names and stored XML appear in the opening bytes. XLSX
+	// workbooks are ZIP archives too.
+	if len(data) >= 4 && (string(data[:4]) == "PK\x03\x04" || string(data[:4]) == "PK\x05\x06") {
+		if spreadsheet.IsXLSX(data) {
+			return FormatSpreadsheet
+		}
+		return FormatZIP
+	}
+
+	// Outlook messages are OLE compound files, like legacy Office documents
+	if msg.IsMessage(data) {
+		return FormatMSG
+	}
+
+	if looksLikeHTML(data) {
+		return FormatHTML
+	}
+
 	// Check for XML declaration or common XML patterns
 	if len(data) > 5 {
 		header := string(data[:min(100, len(data))])
@@ -292,19 +691,49 @@ func DetectFormat(data []byte) Format {
 		if data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF {
 			return FormatImage
 		}
-		// TIFF (little-endian)
-		if data[0] == 0x49 && data[1] == 0x49 && data[2] == 0x2A && data[3] == 0x00 {
-			return FormatImage
-		}
-		// TIFF (big-endian)
-		if data[0] == 0x4D && data[1] == 0x4D && data[2] == 0x00 && data[3] == 0x2A {
+		// TIFF, possibly multi-page (see ProcessImage)
+		if isTIFF(data) {
 			return FormatImage
 		}
 	}
 
+	if looksLikeEmail(data) {
+		return FormatEmail
+	}
+
 	return FormatUnknown
 }
 
+// emailHeaders are header fields of which at least one opens every saved email
+var emailHeaders = []string{"from", "to", "subject", "date", "received", "return-path", "message-id", "mime-version", "delivered-to"}
+
+// looksLikeEmail reports whether data starts with an RFC 5322 header block
+// holding a header common to all emails
+func looksLikeEmail(data []byte) bool {
+	header := string(data[:min(4096, len(data))])
+	found := false
+	for i, line := range strings.Split(header, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			return found && i > 0
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if i == 0 {
+				return false
+			}
+			continue // Folded continuation of the previous field
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return false
+		}
+		if slices.Contains(emailHeaders, strings.ToLower(name)) {
+			found = true
+		}
+	}
+	return found
+}
+
 // Format represents the invoice file format
 type Format int
 
@@ -313,6 +742,11 @@ const (
 	FormatXML
 	FormatPDF
 	FormatImage
+	FormatZIP
+	FormatEmail       // RFC 822 message (.eml)
+	FormatHTML        // HTML document, such as an emailed invoice body
+	FormatSpreadsheet // XLSX workbook
+	FormatMSG         // Outlook message (.msg)
 )
 
 func (f Format) String() string {
@@ -323,6 +757,16 @@ func (f Format) String() string {
 		return "pdf"
 	case FormatImage:
 		return "image"
+	case FormatZIP:
+		return "zip"
+	case FormatEmail:
+		return "email"
+	case FormatHTML:
+		return "html"
+	case FormatSpreadsheet:
+		return "spreadsheet"
+	case FormatMSG:
+		return "msg"
 	default:
 		return "unknown"
 	}
@@ -1,13 +1,22 @@
 package processor_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
 	"github.com/rezonia/invoice-processor/internal/processor"
 )
 
@@ -16,6 +25,24 @@ func TestNewPipeline(t *testing.T) {
 	require.NotNil(t, p)
 }
 
+func TestResult_Encode(t *testing.T) {
+	data, err := json.Marshal(&processor.Result{Method: processor.MethodXML, Error: fmt.Errorf("member a.txt: %w", processor.ErrSkipped)})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"method":"xml"`)
+	assert.NotContains(t, string(data), "skipped", "Result doesn't encode its error")
+
+	encoded := (&processor.Result{Error: fmt.Errorf("member a.txt: %w", processor.ErrSkipped)}).Encode()
+	assert.True(t, encoded.Skipped)
+	assert.Contains(t, encoded.Error, "a.txt")
+
+	data, err = json.Marshal((&processor.Result{Method: processor.MethodXML}).Encode())
+	require.NoError(t, err)
+	var decoded processor.EncodedResult
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, processor.MethodXML, decoded.Method)
+	assert.Empty(t, decoded.Error)
+}
+
 func TestNewPipeline_WithOptions(t *testing.T) {
 	p := processor.NewPipeline(
 		processor.WithLLMExtractor(nil),
@@ -33,11 +60,11 @@ func TestProcessXML_TCT(t *testing.T) {
 	<InvoiceSeries>AA/23E</InvoiceSeries>
 	<InvoiceDate>2026-01-15</InvoiceDate>
 	<Seller>
-		<TaxID>0123456789</TaxID>
+		<TaxID>0123456787</TaxID>
 		<Name>ABC Company</Name>
 	</Seller>
 	<Buyer>
-		<TaxID>9876543210</TaxID>
+		<TaxID>0312345673</TaxID>
 		<Name>XYZ Corp</Name>
 	</Buyer>
 	<TotalAmount>1100000</TotalAmount>
@@ -52,7 +79,7 @@ func TestProcessXML_TCT(t *testing.T) {
 	assert.Equal(t, 1.0, result.Confidence)
 	assert.Equal(t, "0000001", result.Invoice.Number)
 	assert.Equal(t, "AA/23E", result.Invoice.Series)
-	assert.Equal(t, "0123456789", result.Invoice.Seller.TaxID)
+	assert.Equal(t, "0123456787", result.Invoice.Seller.TaxID)
 	assert.Equal(t, "ABC Company", result.Invoice.Seller.Name)
 }
 
@@ -150,6 +177,9 @@ func TestFormatString(t *testing.T) {
 		{processor.FormatXML, "xml"},
 		{processor.FormatPDF, "pdf"},
 		{processor.FormatImage, "image"},
+		{processor.FormatHTML, "html"},
+		{processor.FormatSpreadsheet, "spreadsheet"},
+		{processor.FormatMSG, "msg"},
 		{processor.FormatUnknown, "unknown"},
 	}
 
@@ -217,3 +247,189 @@ func BenchmarkProcessXML(b *testing.B) {
 		p.ProcessXML(ctx, strings.NewReader(xmlData))
 	}
 }
+
+func TestInferProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		inv      *model.Invoice
+		text     string
+		meta     pdf.Metadata
+		expected model.Provider
+	}{
+		{
+			name:     "lookup URL",
+			inv:      &model.Invoice{},
+			text:     "Tra cứu hóa đơn tại: https://vinvoice.viettel.vn/utilities/invoice-search",
+			expected: model.ProviderViettel,
+		},
+		{
+			name:     "template marker and provider tax ID",
+			inv:      &model.Invoice{},
+			text:     "Phát hành bởi phần mềm MISA meInvoice - Công ty Cổ phần MISA - MST 0101243150",
+			expected: model.ProviderMISA,
+		},
+		{
+			name:     "PDF producer metadata",
+			inv:      &model.Invoice{},
+			meta:     pdf.Metadata{Producer: "VNPT-Invoice PDF Engine"},
+			expected: model.ProviderVNPT,
+		},
+		{
+			name:     "seller is the platform",
+			inv:      &model.Invoice{Seller: model.Party{TaxID: "0101248141-001"}},
+			expected: model.ProviderFPT,
+		},
+		{
+			name:     "lookup URL in remarks",
+			inv:      &model.Invoice{Remarks: "Tra cứu tại https://www.meinvoice.vn/tra-cuu, mã: ABC123"},
+			expected: model.ProviderMISA,
+		},
+		{
+			name:     "no signals",
+			inv:      &model.Invoice{Seller: model.Party{TaxID: "0123456789"}},
+			text:     "HÓA ĐƠN GIÁ TRỊ GIA TĂNG",
+			expected: model.ProviderUnknown,
+		},
+		{
+			name:     "tied signals",
+			inv:      &model.Invoice{},
+			meta:     pdf.Metadata{Producer: "MISA", Creator: "FPT"},
+			expected: model.ProviderUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, processor.InferProvider(tt.inv, tt.text, tt.meta))
+		})
+	}
+}
+
+// stubProvider answers every LLM request with a fixed response and records prompts
+type stubProvider struct {
+	mu       sync.Mutex
+	content  string
+	requests []*llm.Request
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	return &llm.Response{Content: p.content, Model: req.Model}, nil
+}
+
+func newStubPipeline(content string) (*processor.Pipeline, *stubProvider) {
+	provider := &stubProvider{content: content}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	return processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client))), provider
+}
+
+func TestProcessReceipt(t *testing.T) {
+	p, provider := newStubPipeline(`{"receipt_number":"R-17","date":"2024-03-15","total_amount":45000,"payment_method":"cash"}`)
+
+	result := p.ProcessReceipt(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMVision, result.Method)
+	assert.Equal(t, processor.ConfidenceVisionReceipt, result.Signals.Prior)
+	assert.Equal(t, 0.74, result.Confidence, "store name and items are missing")
+	assert.Equal(t, model.DocumentTypeReceipt, result.Invoice.DocumentType)
+	assert.Equal(t, "R-17", result.Invoice.Number)
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, llm.SystemPromptReceiptExtractor, provider.requests[0].SystemPrompt)
+	assert.Equal(t, llm.UserPromptReceiptExtraction, provider.requests[0].UserPrompt)
+	assert.Equal(t, llm.ReceiptSchema, provider.requests[0].Schema)
+}
+
+func TestProcessReceipt_NoLLM(t *testing.T) {
+	result := processor.NewPipeline().ProcessReceipt(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.Error(t, result.Error)
+}
+
+func TestProcessStatement(t *testing.T) {
+	p, provider := newStubPipeline(`{"bank_name":"VCB","account_number":"0071000123456","opening_balance":1000000,"closing_balance":900000,
+		"transactions":[{"date":"2026-01-05","description":"TT HD 0000123","amount":-150000,"balance":850000},{"date":"2026-01-06","description":"Nhan tien","amount":100000,"balance":950000}]}`)
+
+	result := p.ProcessStatement(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMVision, result.Method)
+	assert.Equal(t, processor.ConfidenceStatementVision, result.Confidence)
+	require.Len(t, result.Statement.Transactions, 2)
+	assert.Equal(t, "-150000", result.Statement.Transactions[0].Amount.String())
+
+	require.Len(t, result.Warnings, 1, "closing balance 900000 does not match 950000")
+	assert.Contains(t, result.Warnings[0], "balances do not reconcile")
+
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, llm.SystemPromptStatementExtractor, provider.requests[0].SystemPrompt)
+	assert.Equal(t, llm.StatementSchema, provider.requests[0].Schema)
+}
+
+func TestProcessReceipt_TallImageTiled(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 100, 400))))
+
+	p, provider := newStubPipeline(`{"receipt_number":"R-17","total_amount":45000,"items":[{"name":"Cà phê","quantity":1,"total":45000}]}`)
+
+	result := p.ProcessReceipt(context.Background(), buf.Bytes(), "image/png")
+	require.NoError(t, result.Error)
+	assert.Len(t, provider.requests, 3, "one request per tile")
+	assert.Contains(t, result.Warnings, "tall image split into 3 tiles for vision extraction")
+	require.Len(t, result.Invoice.Items, 1, "the line repeated in every tile is stitched once")
+	assert.Equal(t, "R-17", result.Invoice.Number)
+}
+
+func TestProcessReceipt_Handwriting(t *testing.T) {
+	p, _ := newStubPipeline(`{"receipt_number":"R-18","total_amount":120000,"handwritten_fields":["total_amount"]}`)
+
+	result := p.ProcessReceipt(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.True(t, result.HasHandwriting)
+	assert.True(t, result.Invoice.HasHandwriting)
+	assert.Contains(t, result.Warnings, "handwritten fields: total_amount")
+}
+
+func TestProcessImage_Addresses(t *testing.T) {
+	// The stub answers every request alike: the invoice for extraction and
+	// "addresses" for the follow-up on the seller address the rules cannot place
+	provider := &stubProvider{content: `{
+		"invoice_number": "0000123",
+		"seller": {"address": "45 Hai Bà Trưng, Quận 1"},
+		"buyer": {"address": "123 Lê Lợi, P. Bến Nghé, Q.1, TP.HCM"},
+		"addresses": [{"street": "45 Hai Bà Trưng", "ward": "P. Bến Nghé", "district": "Q.1", "province": "TP HCM"}]
+	}`}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	t.Run("rules", func(t *testing.T) {
+		p := processor.NewPipeline(processor.WithLLMExtractor(extractor))
+		result := p.ProcessImage(context.Background(), []byte("png"), "image/png")
+		require.NoError(t, result.Error)
+
+		buyer := result.Invoice.Buyer.AddressParts
+		require.NotNil(t, buyer)
+		assert.Equal(t, model.Address{Street: "123 Lê Lợi", Ward: "Phường Bến Nghé", District: "Quận 1", Province: "Hồ Chí Minh"}, *buyer)
+		assert.Equal(t, model.Address{Street: "45 Hai Bà Trưng", District: "Quận 1"}, *result.Invoice.Seller.AddressParts)
+	})
+
+	t.Run("llm", func(t *testing.T) {
+		provider.requests = nil
+		p := processor.NewPipeline(processor.WithLLMExtractor(extractor), processor.WithLLMAddressParsing(true))
+		result := p.ProcessImage(context.Background(), []byte("png"), "image/png")
+		require.NoError(t, result.Error)
+
+		assert.Equal(t, model.Address{Street: "45 Hai Bà Trưng", Ward: "Phường Bến Nghé", District: "Quận 1", Province: "Hồ Chí Minh"}, *result.Invoice.Seller.AddressParts)
+		require.Len(t, provider.requests, 2)
+		assert.Equal(t, llm.AddressSchema, provider.requests[1].Schema)
+		assert.NotContains(t, provider.requests[1].UserPrompt, "Lê Lợi", "complete addresses are not sent")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p := processor.NewPipeline(processor.WithLLMExtractor(extractor), processor.WithAddressNormalization(false))
+		result := p.ProcessImage(context.Background(), []byte("png"), "image/png")
+		require.NoError(t, result.Error)
+		assert.Nil(t, result.Invoice.Buyer.AddressParts)
+	})
+}
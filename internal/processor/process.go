@@ -0,0 +1,343 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/image/tiff"
+
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+// Limits on unpacking archives and emails, against zip bombs and mail loops
+const (
+	maxContainerDepth   = 3        // Archives within emails within archives
+	maxContainerMembers = 1000     // Members processed per archive or email
+	maxMemberSize       = 64 << 20 // Uncompressed bytes read per member
+)
+
+// ErrSkipped marks archive members and email attachments that were not
+// processed: files that are not invoices, and PDF or image renderings of an
+// XML invoice shipped next to them, as in provider portal exports
+var ErrSkipped = errors.New("skipped")
+
+// ProcessOptions describe an input to Process
+type ProcessOptions struct {
+	// Filename is the original file name. Its extension is used when the
+	// content alone does not identify the format.
+	Filename string
+
+	// SplitDocuments returns one Result per invoice for PDFs bundling several
+	// (see ProcessPDFDocuments)
+	SplitDocuments bool
+
+	// Strategies overrides the strategy chain of PDFs (see WithStrategies)
+	Strategies []Strategy
+
+	// IdempotencyKey identifies the submission with WithIdempotency; empty
+	// derives it from the content (see IdempotencyKey)
+	IdempotencyKey string
+
+	// Tenant processes the document with the settings of a tenant (see
+	// WithTenants)
+	Tenant string
+}
+
+// Process detects the format of data and runs the matching path: XML
+// parsing, PDF extraction, structured or text extraction for HTML
+// documents and XLSX or CSV spreadsheets, or vision extraction for images
+// (TIFF scans are converted first, page by page). ZIP archives and emails
+// (.eml or Outlook .msg) are unpacked and each member or attachment is
+// processed in turn, with Result.Source naming it and Result.Submission
+// the email; members that are not invoices come back with an ErrSkipped
+// error. It returns one Result per document found; Result.Method tells
+// which path read it. With WithIdempotency, a document submitted before
+// gets its earlier results.
+func (p *Pipeline) Process(ctx context.Context, data []byte, opts ProcessOptions) []*Result {
+	if p.Stopped() {
+		return []*Result{{Error: ErrStopped}}
+	}
+	if opts.Tenant != "" {
+		ctx = ContextWithTenant(ctx, opts.Tenant)
+	}
+	if p.idempotency != nil {
+		key := opts.IdempotencyKey
+		if key == "" {
+			key = IdempotencyKey(data, opts)
+		}
+		return p.Idempotent(ctx, key, func(ctx context.Context) []*Result {
+			return p.processDocument(ctx, data, opts)
+		})
+	}
+	return p.processDocument(ctx, data, opts)
+}
+
+func (p *Pipeline) processDocument(ctx context.Context, data []byte, opts ProcessOptions) []*Result {
+	ctx, span := p.startDocument(ctx, "process", tracing.String("document.filename", opts.Filename))
+	defer span.End()
+	if len(opts.Strategies) > 0 {
+		ctx = ContextWithStrategies(ctx, opts.Strategies...)
+	}
+
+	results := p.process(ctx, data, opts, 0)
+	span.SetAttributes(tracing.Int("pipeline.documents", len(results)))
+	return results
+}
+
+func (p *Pipeline) process(ctx context.Context, data []byte, opts ProcessOptions, depth int) []*Result {
+	format := detectFormatNamed(data, opts.Filename)
+	if err := p.formatDetected(ctx, format, opts.Filename); err != nil {
+		return []*Result{p.finish(ctx, &Result{Error: err})}
+	}
+	// Documents keep their bytes (see Result.Data)
+	read := func(results ...*Result) []*Result {
+		for _, r := range results {
+			r.Data = data
+		}
+		return results
+	}
+
+	switch format {
+	case FormatXML:
+		if depth > 0 {
+			if _, err := p.xmlRegistry.Detect(data); err != nil {
+				return []*Result{p.finish(ctx, &Result{Error: fmt.Errorf("%w: not a known XML invoice format", ErrSkipped)})}
+			}
+		}
+		return read(p.ProcessXMLBytes(ctx, data))
+	case FormatPDF:
+		if opts.SplitDocuments {
+			return read(p.ProcessPDFDocuments(ctx, data)...)
+		}
+		return read(p.ProcessPDF(ctx, nil, data, "application/pdf"))
+	case FormatImage:
+		mimeType := detectImageMimeType(data)
+		if isTIFF(data) {
+			mimeType = "image/tiff"
+		}
+		return read(p.ProcessImage(ctx, data, mimeType))
+	case FormatHTML:
+		return read(p.ProcessHTML(ctx, data))
+	case FormatSpreadsheet:
+		return read(p.ProcessSpreadsheet(ctx, data))
+	case FormatZIP, FormatEmail, FormatMSG:
+		if depth >= maxContainerDepth {
+			return []*Result{{Error: fmt.Errorf("%s nested too deeply", format)}}
+		}
+		var files []containerFile
+		var err error
+		if format == FormatZIP {
+			files, err = zipMembers(data)
+		} else {
+			var e *email
+			if format == FormatEmail {
+				e, err = readEmail(data)
+			} else {
+				e, err = readOutlookMessage(data)
+			}
+			if err != nil {
+				return []*Result{{Error: err}}
+			}
+			// The documents of the message are its submission
+			ctx = contextWithSubmission(ctx, e.submission)
+			if len(e.files) == 0 && e.text != "" {
+				result := p.ProcessText(ctx, e.text)
+				result.Source = "body.txt"
+				return []*Result{result}
+			}
+			files = e.files
+		}
+		if err != nil {
+			return []*Result{{Error: err}}
+		}
+		if len(files) == 0 {
+			return []*Result{{Error: fmt.Errorf("%s holds no documents", format), Submission: submissionFromContext(ctx)}}
+		}
+
+		renderings := p.xmlRenderings(files)
+		var results []*Result
+		for _, f := range files {
+			if ctx.Err() != nil {
+				results = append(results, &Result{Source: f.name, Error: ctx.Err(), Submission: submissionFromContext(ctx)})
+				continue
+			}
+			if xmlName, ok := renderings[f.name]; ok {
+				results = append(results, p.finish(ctx, &Result{Source: f.name, Error: fmt.Errorf("%w: rendering of %s", ErrSkipped, xmlName)}))
+				continue
+			}
+			for _, result := range p.process(ctx, f.data, ProcessOptions{Filename: f.name, SplitDocuments: opts.SplitDocuments}, depth+1) {
+				result.Source = joinSource(f.name, result.Source)
+				results = append(results, result)
+			}
+		}
+		return results
+	default:
+		if depth > 0 {
+			return []*Result{p.finish(ctx, &Result{Error: fmt.Errorf("%w: not an invoice format", ErrSkipped)})}
+		}
+		return []*Result{p.finish(ctx, &Result{Error: fmt.Errorf("unsupported file format")})}
+	}
+}
+
+// xmlRenderings maps PDF and image members to the XML member with the same
+// path and base name, such as 0000042.pdf to 0000042.xml. The XML is the
+// legally binding copy and is read exactly, so the rendering is skipped.
+func (p *Pipeline) xmlRenderings(files []containerFile) map[string]string {
+	stem := func(name string) string {
+		return strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+	}
+
+	xmlByStem := make(map[string]string)
+	for _, f := range files {
+		if DetectFormat(f.data) != FormatXML {
+			continue
+		}
+		if _, err := p.xmlRegistry.Detect(f.data); err == nil {
+			xmlByStem[stem(f.name)] = f.name
+		}
+	}
+
+	renderings := make(map[string]string)
+	for _, f := range files {
+		switch DetectFormat(f.data) {
+		case FormatPDF, FormatImage:
+			if xmlName, ok := xmlByStem[stem(f.name)]; ok {
+				renderings[f.name] = xmlName
+			}
+		}
+	}
+	return renderings
+}
+
+// detectFormatNamed is DetectFormat with the file extension as a tiebreaker
+func detectFormatNamed(data []byte, filename string) Format {
+	if format := DetectFormat(data); format != FormatUnknown {
+		return format
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".eml":
+		return FormatEmail
+	case ".msg":
+		return FormatMSG
+	case ".xml":
+		return FormatXML
+	case ".html", ".htm":
+		return FormatHTML
+	case ".csv", ".tsv":
+		return FormatSpreadsheet
+	default:
+		return FormatUnknown
+	}
+}
+
+// joinSource prefixes the source of a nested document with its container member
+func joinSource(name, nested string) string {
+	if nested == "" {
+		return name
+	}
+	return name + "/" + nested
+}
+
+// containerFile is a member of an archive or an email attachment
+type containerFile struct {
+	name string
+	data []byte
+}
+
+// zipMembers returns the files of a ZIP archive, skipping directories and
+// macOS metadata
+func zipMembers(data []byte) ([]containerFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP archive: %w", err)
+	}
+
+	var files []containerFile
+	for _, f := range zr.File {
+		base := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		if len(files) == maxContainerMembers {
+			return nil, fmt.Errorf("ZIP archive has more than %d files", maxContainerMembers)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in ZIP archive: %w", f.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxMemberSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in ZIP archive: %w", f.Name, err)
+		}
+		if len(content) > maxMemberSize {
+			return nil, fmt.Errorf("%s in ZIP archive is larger than %d bytes", f.Name, maxMemberSize)
+		}
+		files = append(files, containerFile{name: f.Name, data: content})
+	}
+	return files, nil
+}
+
+// isTIFF reports whether data starts with a TIFF byte-order mark
+func isTIFF(data []byte) bool {
+	return len(data) >= 8 && (string(data[:4]) == "II*\x00" || string(data[:4]) == "MM\x00*")
+}
+
+// maxTIFFPages caps the pages read from a TIFF file, against IFD loops
+const maxTIFFPages = 1000
+
+// tiffPages converts the pages of a TIFF scan to PNG, since vision models do
+// not accept TIFF. Fax and scanner software saves multi-page documents as
+// one TIFF with an image file directory (IFD) per page.
+func tiffPages(data []byte) ([][]byte, error) {
+	if !isTIFF(data) {
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	var pages [][]byte
+	seen := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:8]); offset != 0; {
+		if seen[offset] || len(pages) == maxTIFFPages {
+			return nil, fmt.Errorf("TIFF has more than %d pages or a loop", maxTIFFPages)
+		}
+		seen[offset] = true
+		if uint64(offset)+2 > uint64(len(data)) {
+			return nil, fmt.Errorf("TIFF page %d is out of bounds", len(pages)+1)
+		}
+		end := uint64(offset) + 2 + 12*uint64(order.Uint16(data[offset:])) // Entry count, then 12-byte entries
+		if end+4 > uint64(len(data)) {
+			return nil, fmt.Errorf("TIFF page %d is out of bounds", len(pages)+1)
+		}
+
+		// The decoder reads the IFD the header points to, so point it at this one
+		page := bytes.Clone(data)
+		order.PutUint32(page[4:8], offset)
+		img, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			return nil, fmt.Errorf("TIFF page %d: %w", len(pages)+1, err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		pages = append(pages, buf.Bytes())
+		offset = order.Uint32(data[end : end+4])
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("TIFF has no pages")
+	}
+	return pages, nil
+}
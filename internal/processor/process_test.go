@@ -0,0 +1,424 @@
+package processor_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/tiff"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const processXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+func buildZIP(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestDetectFormat_Containers(t *testing.T) {
+	zipData := buildZIP(t, map[string]string{"a.xml": processXML})
+	assert.Equal(t, processor.FormatZIP, processor.DetectFormat(zipData))
+
+	email := "From: billing@example.com\r\nSubject: Invoice\r\nMIME-Version: 1.0\r\n\r\nSee attached."
+	assert.Equal(t, processor.FormatEmail, processor.DetectFormat([]byte(email)))
+
+	assert.Equal(t, "zip", processor.FormatZIP.String())
+	assert.Equal(t, "email", processor.FormatEmail.String())
+}
+
+// outlookMessage returns the opening of an Outlook .msg compound file
+func outlookMessage() []byte {
+	data := make([]byte, 1024)
+	copy(data, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	for i, c := range "__substg1.0_0037001F" {
+		data[600+2*i] = byte(c)
+	}
+	return data
+}
+
+func TestDetectFormat_Documents(t *testing.T) {
+	var xlsx bytes.Buffer
+	require.NoError(t, export.WriteXLSX(&xlsx, export.Sheet{Rows: [][]any{{"Item", 1}}}))
+	assert.Equal(t, processor.FormatSpreadsheet, processor.DetectFormat(xlsx.Bytes()))
+	assert.Equal(t, processor.FormatZIP, processor.DetectFormat(buildZIP(t, map[string]string{"xl/report.pdf": "%PDF-1.4\n"})))
+
+	assert.Equal(t, processor.FormatHTML, processor.DetectFormat([]byte("\xef\xbb\xbf\n  <!DOCTYPE html><html><body>Invoice</body></html>")))
+	assert.Equal(t, processor.FormatHTML, processor.DetectFormat([]byte(`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><body/></html>`)))
+	assert.Equal(t, processor.FormatXML, processor.DetectFormat([]byte(processXML)))
+
+	assert.Equal(t, processor.FormatMSG, processor.DetectFormat(outlookMessage()))
+	legacyWorkbook := outlookMessage()
+	clear(legacyWorkbook[600:])
+	assert.Equal(t, processor.FormatUnknown, processor.DetectFormat(legacyWorkbook), "other compound files")
+}
+
+func TestProcess_XML(t *testing.T) {
+	p := processor.NewPipeline()
+
+	results := p.Process(context.Background(), []byte(processXML), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodXML, results[0].Method)
+	assert.Equal(t, "0000042", results[0].Invoice.Number)
+	assert.Empty(t, results[0].Source)
+}
+
+func TestProcess_ZIP(t *testing.T) {
+	p := processor.NewPipeline()
+	data := buildZIP(t, map[string]string{
+		"invoices/0000042.xml":      processXML,
+		"invoices/notes.txt":        "not an invoice",
+		"__MACOSX/invoices/._a.xml": "metadata",
+		"nested.zip":                string(buildZIP(t, map[string]string{"inner.xml": processXML})),
+	})
+
+	results := p.Process(context.Background(), data, processor.ProcessOptions{Filename: "batch.zip"})
+	require.Len(t, results, 3)
+
+	bySource := make(map[string]*processor.Result)
+	for _, r := range results {
+		bySource[r.Source] = r
+	}
+	require.Contains(t, bySource, "invoices/0000042.xml")
+	assert.NoError(t, bySource["invoices/0000042.xml"].Error)
+	assert.Equal(t, processor.MethodXML, bySource["invoices/0000042.xml"].Method)
+
+	require.Contains(t, bySource, "nested.zip/inner.xml")
+	assert.Equal(t, "0000042", bySource["nested.zip/inner.xml"].Invoice.Number)
+	assert.Equal(t, processXML, string(bySource["nested.zip/inner.xml"].Data), "members keep their unpacked bytes")
+
+	require.Contains(t, bySource, "invoices/notes.txt")
+	assert.ErrorIs(t, bySource["invoices/notes.txt"].Error, processor.ErrSkipped, "non-invoice members are flagged")
+}
+
+func TestProcess_ZIPPortalExport(t *testing.T) {
+	p := processor.NewPipeline()
+	data := buildZIP(t, map[string]string{
+		"0000042.xml":  processXML,
+		"0000042.pdf":  "%PDF-1.4\n",
+		"manifest.xml": `<?xml version="1.0"?><Manifest><Count>1</Count></Manifest>`,
+		"0000043.pdf":  "%PDF-1.4\n",
+	})
+
+	results := p.Process(context.Background(), data, processor.ProcessOptions{})
+	require.Len(t, results, 4)
+
+	bySource := make(map[string]*processor.Result)
+	for _, r := range results {
+		bySource[r.Source] = r
+	}
+	assert.NoError(t, bySource["0000042.xml"].Error)
+	assert.ErrorIs(t, bySource["0000042.pdf"].Error, processor.ErrSkipped)
+	assert.ErrorContains(t, bySource["0000042.pdf"].Error, "rendering of 0000042.xml")
+	assert.ErrorIs(t, bySource["manifest.xml"].Error, processor.ErrSkipped)
+	assert.NotErrorIs(t, bySource["0000043.pdf"].Error, processor.ErrSkipped, "PDFs without an XML twin are processed")
+}
+
+func TestProcess_Email(t *testing.T) {
+	p := processor.NewPipeline()
+	email := strings.Join([]string{
+		"From: billing@example.com",
+		"To: ap@example.com",
+		"Subject: Invoice 0000042",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		"Please find the invoice attached.",
+		"--b1",
+		`Content-Type: application/xml; name="0000042.xml"`,
+		`Content-Disposition: attachment; filename="0000042.xml"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString([]byte(processXML)),
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	results := p.Process(context.Background(), []byte(email), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, "0000042.xml", results[0].Source)
+	assert.Equal(t, "0000042", results[0].Invoice.Number)
+}
+
+func TestProcess_EmailSubmissions(t *testing.T) {
+	p := processor.NewPipeline()
+	email := func(id, number string) string {
+		return strings.Join([]string{
+			"From: =?UTF-8?Q?C=C3=B4ng_ty_ABC?= <billing@example.com>",
+			"Subject: Invoice " + number,
+			"Date: Fri, 15 Mar 2024 16:30:00 +0700",
+			"Message-ID: " + id,
+			`Content-Type: multipart/mixed; boundary="b1"`,
+			"",
+			"--b1",
+			`Content-Type: application/xml; name="` + number + `.xml"`,
+			"",
+			strings.Replace(processXML, "0000042", number, 1),
+			"--b1",
+			`Content-Type: application/xml; name="` + number + `-copy.xml"`,
+			"",
+			strings.Replace(processXML, "0000042", number, 1),
+			"--b1--",
+			"",
+		}, "\r\n")
+	}
+	archive := buildZIP(t, map[string]string{
+		"march/a.eml": email("<a@example.com>", "0000042"),
+		"march/b.eml": email("", "0000043"),
+	})
+
+	results := p.Process(context.Background(), archive, processor.ProcessOptions{Filename: "march.zip"})
+	require.Len(t, results, 4)
+	groups := processor.GroupBySubmission(results)
+	require.Len(t, groups, 2, "one submission per email")
+	for _, g := range groups {
+		require.Len(t, g.Results, 2)
+		require.NotNil(t, g.Submission)
+		assert.Equal(t, "Công ty ABC <billing@example.com>", g.Submission.From)
+		assert.Equal(t, time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC), g.Submission.Date)
+		assert.Equal(t, "Invoice "+g.Results[0].Invoice.Number, g.Submission.Subject)
+	}
+	ids := []string{groups[0].Submission.ID, groups[1].Submission.ID}
+	assert.Contains(t, ids, "a@example.com")
+	assert.NotContains(t, ids, "", "a digest stands in for a missing Message-ID")
+
+	assert.Len(t, processor.GroupBySubmission([]*processor.Result{{}, {}}), 2, "documents not emailed stay apart")
+}
+
+func TestProcess_EmailTextBody(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"SUB-2024-03","total_amount":199000}`)
+	email := "From: billing@saas.example\r\nSubject: Your receipt\r\n\r\nReceipt SUB-2024-03\r\nPro plan, March: 199,000 VND\r\n"
+
+	results := p.Process(context.Background(), []byte(email), processor.ProcessOptions{Filename: "receipt.eml"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, "body.txt", results[0].Source)
+	assert.Equal(t, "SUB-2024-03", results[0].Invoice.Number)
+	require.NotNil(t, results[0].Submission)
+	assert.Equal(t, "Your receipt", results[0].Submission.Subject)
+	require.Len(t, provider.requests, 1)
+	assert.Contains(t, provider.requests[0].UserPrompt, "Pro plan, March: 199,000 VND")
+}
+
+func TestProcess_EmailWithoutAttachments(t *testing.T) {
+	p := processor.NewPipeline()
+	email := "From: billing@example.com\r\nSubject: Hello\r\n\r\nNo invoice here."
+
+	results := p.Process(context.Background(), []byte(email), processor.ProcessOptions{Filename: "hello.eml"})
+	require.Len(t, results, 1)
+	assert.ErrorContains(t, results[0].Error, "email holds no documents")
+}
+
+func TestProcess_TIFF(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"0000042","total_amount":1000}`)
+
+	var buf bytes.Buffer
+	require.NoError(t, tiff.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30)), nil))
+
+	results := p.Process(context.Background(), buf.Bytes(), processor.ProcessOptions{Filename: "scan.tif"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodLLMVision, results[0].Method)
+	require.Len(t, provider.requests, 1)
+	require.NotEmpty(t, provider.requests[0].Images)
+	assert.Equal(t, "image/png", provider.requests[0].Images[0].MimeType, "TIFF is converted for vision models")
+}
+
+// multiPageTIFF encodes uncompressed grayscale pages in one little-endian
+// TIFF, an image file directory per page
+func multiPageTIFF(pages ...*image.Gray) []byte {
+	le := binary.LittleEndian
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	link := 4 // Where the offset of the next IFD goes
+	for _, page := range pages {
+		w, h := page.Rect.Dx(), page.Rect.Dy()
+		pixels := len(data)
+		data = append(data, page.Pix...)
+		le.PutUint32(data[link:], uint32(len(data)))
+
+		type entry struct{ tag, typ, value uint32 }
+		entries := []entry{
+			{256, 4, uint32(w)}, {257, 4, uint32(h)}, {258, 3, 8}, {259, 3, 1}, {262, 3, 1},
+			{273, 4, uint32(pixels)}, {277, 3, 1}, {278, 4, uint32(h)}, {279, 4, uint32(w * h)},
+		}
+		data = le.AppendUint16(data, uint16(len(entries)))
+		for _, e := range entries {
+			data = le.AppendUint16(data, uint16(e.tag))
+			data = le.AppendUint16(data, uint16(e.typ))
+			data = le.AppendUint32(data, 1)
+			data = le.AppendUint32(data, e.value) // SHORT values sit in the low bytes
+		}
+		link = len(data)
+		data = le.AppendUint32(data, 0)
+	}
+	return data
+}
+
+func TestProcess_MultiPageTIFF(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"0000042","total_amount":1000}`)
+	scan := multiPageTIFF(image.NewGray(image.Rect(0, 0, 40, 30)), image.NewGray(image.Rect(0, 0, 20, 10)), image.NewGray(image.Rect(0, 0, 8, 8)))
+
+	results := p.Process(context.Background(), scan, processor.ProcessOptions{Filename: "fax.tiff"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	require.Len(t, provider.requests, 1)
+	require.Len(t, provider.requests[0].Images, 3, "every page is sent")
+	for _, img := range provider.requests[0].Images {
+		assert.Equal(t, "image/png", img.MimeType)
+	}
+
+	// An IFD pointing back at itself
+	loop := multiPageTIFF(image.NewGray(image.Rect(0, 0, 4, 4)))
+	binary.LittleEndian.PutUint32(loop[len(loop)-4:], binary.LittleEndian.Uint32(loop[4:]))
+	results = p.Process(context.Background(), loop, processor.ProcessOptions{})
+	assert.ErrorContains(t, results[0].Error, "loop")
+}
+
+func TestProcess_TruncatedTIFF(t *testing.T) {
+	p, _ := newStubPipeline(`{"invoice_number":"0000042","total_amount":1000}`)
+	scan := multiPageTIFF(image.NewGray(image.Rect(0, 0, 4, 4)))
+	ifd := binary.LittleEndian.Uint32(scan[4:])
+
+	for name, data := range map[string][]byte{
+		"byte-order mark only":  []byte("II*\x00"),
+		"big-endian mark only":  []byte("MM\x00*\x00"),
+		"IFD past the end":      []byte("II*\x00\xff\xff\x00\x00"),
+		"IFD count only":        scan[:ifd+2],
+		"next IFD link missing": scan[:len(scan)-2],
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				p.ProcessImage(context.Background(), data, "image/tiff")
+				p.Process(context.Background(), data, processor.ProcessOptions{Filename: "scan.tif"})
+			})
+		})
+	}
+}
+
+func TestProcess_HTML(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"INV-2024-118","total_amount":1200000}`)
+	page := "\n<!DOCTYPE html>\n<html><body><h1>Invoice INV-2024-118</h1><table><tr><td>Plan</td><td>1,200,000</td></tr></table></body></html>"
+
+	results := p.Process(context.Background(), []byte(page), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodLLMText, results[0].Method)
+	assert.Contains(t, provider.requests[0].UserPrompt, "Plan\t1,200,000")
+}
+
+func TestProcess_Spreadsheet(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"M-2024-03","total_amount":90000}`)
+	var xlsx bytes.Buffer
+	require.NoError(t, export.WriteXLSX(&xlsx,
+		export.Sheet{Name: "Summary", Rows: [][]any{{"Invoice", "M-2024-03"}}},
+		export.Sheet{Name: "Lines", Header: []string{"Item", "Qty", "Amount"}, Rows: [][]any{{"Water", 3, 30000}, {"Rice", nil, 60000}}},
+	))
+
+	results := p.Process(context.Background(), xlsx.Bytes(), processor.ProcessOptions{Filename: "march.xlsx"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodLLMText, results[0].Method)
+	prompt := provider.requests[0].UserPrompt
+	assert.Contains(t, prompt, "Summary\nInvoice\tM-2024-03\n\nLines\nItem\tQty\tAmount\nWater\t3\t30000\nRice\t\t60000")
+}
+
+func TestProcess_OutlookMessage(t *testing.T) {
+	p := processor.NewPipeline()
+	data, err := os.ReadFile("testdata/invoices.msg")
+	require.NoError(t, err)
+
+	results := p.Process(context.Background(), data, processor.ProcessOptions{Filename: "invoices.msg"})
+	require.Len(t, results, 2, "the hidden logo is skipped")
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, "0000042.xml", results[0].Source)
+	assert.Equal(t, "0000042", results[0].Invoice.Number)
+	require.NoError(t, results[1].Error)
+	assert.Equal(t, "Fwd: invoice 0000043/0000043.xml", results[1].Source)
+	assert.Equal(t, "0000043", results[1].Invoice.Number)
+
+	submission := results[0].Submission
+	require.NotNil(t, submission)
+	assert.Same(t, submission, results[1].Submission)
+	assert.Equal(t, &processor.Submission{
+		ID:      "inv-42@example.com",
+		From:    "Billing <billing@example.com>",
+		Subject: "Invoices 0000042 and 0000043",
+		Date:    time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC),
+	}, submission)
+
+	results = p.Process(context.Background(), outlookMessage(), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	assert.ErrorContains(t, results[0].Error, "failed to read Outlook message")
+}
+
+func TestProcess_Unknown(t *testing.T) {
+	p := processor.NewPipeline()
+
+	results := p.Process(context.Background(), []byte("plain text"), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	assert.ErrorContains(t, results[0].Error, "unsupported file format")
+}
+
+func TestProcess_HTMLEmailBody(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"TRIP-7","total_amount":85000}`)
+	email := strings.Join([]string{
+		"From: receipts@ride.example",
+		"Subject: Your trip receipt",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/plain",
+		"",
+		"Total 85,000",
+		"--b1",
+		"Content-Type: text/html; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"<html><head><style>td{color:red}</style></head><body><p>Receipt TRIP-7</p>",
+		"<table><tr><td>Total</td><td>85,000=C2=A0=E2=82=AB</td></tr></table></body></html>",
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	results := p.Process(context.Background(), []byte(email), processor.ProcessOptions{})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, "body.html", results[0].Source)
+	assert.Equal(t, processor.MethodLLMText, results[0].Method)
+	assert.Equal(t, "TRIP-7", results[0].Invoice.Number)
+
+	require.Len(t, provider.requests, 1)
+	prompt := provider.requests[0].UserPrompt
+	assert.Contains(t, prompt, "Receipt TRIP-7\nTotal\t85,000")
+	assert.NotContains(t, prompt, "color:red")
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// Signal weights for provider inference
+const (
+	weightLookupURL = 3 // Lookup URLs are printed only by the issuing platform
+	weightMarker    = 2 // Branding text in template headers/footers
+	weightProducer  = 2 // PDF Producer/Creator metadata
+	weightTaxID     = 2 // Platform tax ID printed in the "solution provider" footer
+	weightSeller    = 1 // Seller is the platform itself
+)
+
+// providerSignature lists the markers that identify an e-invoice platform
+type providerSignature struct {
+	provider  model.Provider
+	taxIDs    []string // Tax IDs of the platform operator
+	urls      []string // Invoice lookup domains
+	markers   []string // Template branding text (lowercase)
+	producers []string // PDF Producer/Creator substrings (lowercase)
+}
+
+var providerSignatures = []providerSignature{
+	{
+		provider:  model.ProviderVNPT,
+		taxIDs:    []string{"0100684378"},
+		urls:      []string{"vnpt-invoice.com.vn", "tracuuhoadon.vnpt.vn", "einvoice.vnpt.vn"},
+		markers:   []string{"vnpt invoice", "vnpt-invoice", "tập đoàn bưu chính viễn thông"},
+		producers: []string{"vnpt"},
+	},
+	{
+		provider:  model.ProviderViettel,
+		taxIDs:    []string{"0100109106"},
+		urls:      []string{"sinvoice.viettel.vn", "vinvoice.viettel.vn"},
+		markers:   []string{"s-invoice", "sinvoice", "viettel"},
+		producers: []string{"viettel", "sinvoice"},
+	},
+	{
+		provider:  model.ProviderMISA,
+		taxIDs:    []string{"0101243150"},
+		urls:      []string{"meinvoice.vn"},
+		markers:   []string{"meinvoice", "misa"},
+		producers: []string{"misa", "meinvoice"},
+	},
+	{
+		provider:  model.ProviderFPT,
+		taxIDs:    []string{"0101248141"},
+		urls:      []string{"einvoice.fpt.com.vn", "hoadon.fpt.com.vn"},
+		markers:   []string{"fpt.einvoice", "fpt einvoice", "fpt e-invoice"},
+		producers: []string{"fpt"},
+	},
+	{
+		provider: model.ProviderTCT,
+		urls:     []string{"hoadondientu.gdt.gov.vn"},
+	},
+}
+
+// InferProvider guesses the e-invoice platform for invoices extracted without
+// XML, using the seller tax ID, lookup URLs and template markers in the text,
+// and the PDF producer metadata. Returns ProviderUnknown when no signal is
+// found or the signals are tied.
+func InferProvider(inv *model.Invoice, text string, meta pdf.Metadata) model.Provider {
+	lowerText := strings.ToLower(text)
+	if inv != nil {
+		// Remarks often carry the lookup URL and code on vision extractions
+		lowerText += "\n" + strings.ToLower(inv.Remarks)
+	}
+	producer := strings.ToLower(meta.Producer + " " + meta.Creator)
+
+	best := model.ProviderUnknown
+	bestScore := 0
+	tied := false
+
+	for _, sig := range providerSignatures {
+		score := 0
+
+		for _, url := range sig.urls {
+			if strings.Contains(lowerText, url) {
+				score += weightLookupURL
+				break
+			}
+		}
+		for _, marker := range sig.markers {
+			if strings.Contains(lowerText, marker) {
+				score += weightMarker
+				break
+			}
+		}
+		for _, p := range sig.producers {
+			if strings.Contains(producer, p) {
+				score += weightProducer
+				break
+			}
+		}
+		for _, taxID := range sig.taxIDs {
+			if strings.Contains(lowerText, taxID) {
+				score += weightTaxID
+			}
+			if inv != nil && normalizeTaxID(inv.Seller.TaxID) == taxID {
+				score += weightSeller
+			}
+		}
+
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = sig.provider, score, false
+		case score > 0 && score == bestScore:
+			tied = true
+		}
+	}
+
+	if tied {
+		return model.ProviderUnknown
+	}
+	return best
+}
+
+// normalizeTaxID strips separators and the branch suffix from a tax ID
+func normalizeTaxID(taxID string) string {
+	taxID = strings.ReplaceAll(strings.TrimSpace(taxID), " ", "")
+	if idx := strings.Index(taxID, "-"); idx >= 0 {
+		taxID = taxID[:idx]
+	}
+	return taxID
+}
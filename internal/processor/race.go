@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"context"
+	"errors"
+)
+
+// WithRace runs the text and vision paths of PDFs together and returns the
+// first invoice that passes validation, canceling the other path. It about
+// halves the latency of interactive uploads that would otherwise fall back
+// to vision, at the cost of vision calls for PDFs the text path reads on
+// its own. When neither invoice passes, the first found in the strategy
+// chain's order is returned. WithEnsemble takes precedence.
+func WithRace(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.race = enabled
+	}
+}
+
+// raceExtraction runs the text and vision paths concurrently, in the order
+// of first and its other path, and returns the first result that passes
+// validation or is skipped, or nil and the attempts of both in that order
+func (p *Pipeline) raceExtraction(ctx context.Context, pdfData []byte, mimeType string, first Strategy) (*Result, []strategyAttempt) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	strategies := []Strategy{first, otherPath(first)}
+	results := make([]*Result, len(strategies))
+	done := make(chan int, len(strategies))
+	for i, strategy := range strategies {
+		go func() {
+			if strategy == StrategyText {
+				results[i] = p.tryLLMTextExtraction(ctx, pdfData)
+			} else {
+				results[i] = p.tryLLMVisionExtraction(ctx, pdfData, mimeType)
+			}
+			done <- i
+		}()
+	}
+
+	var winner *Result
+	for range strategies {
+		i := <-done
+		if winner == nil && (p.passesValidation(ctx, results[i]) || errors.Is(results[i].Error, ErrSkipped)) {
+			// The other path is canceled and waited for, so no work of
+			// the document outlives it
+			winner = results[i]
+			cancel()
+		}
+	}
+	if winner != nil {
+		return winner, nil
+	}
+	return nil, []strategyAttempt{{strategies[0], results[0]}, {strategies[1], results[1]}}
+}
+
+// passesValidation reports whether result holds an invoice without
+// validation errors
+func (p *Pipeline) passesValidation(ctx context.Context, result *Result) bool {
+	if result.Invoice == nil || result.Error != nil {
+		return false
+	}
+	if !p.validation {
+		return true
+	}
+	for _, f := range Validate(result.Invoice, p.validationRulesFor(ctx)) {
+		if f.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
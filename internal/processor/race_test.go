@@ -0,0 +1,122 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// raceProvider answers text and vision requests apart, and hangs on vision
+// requests until they are canceled when vision is empty
+type raceProvider struct {
+	mu       sync.Mutex
+	text     string
+	vision   string
+	canceled bool
+}
+
+func (p *raceProvider) Name() string { return "race" }
+
+func (p *raceProvider) Complete(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	if len(req.Images) == 0 {
+		return &llm.Response{Content: p.text, Model: req.Model}, nil
+	}
+	if p.vision != "" {
+		return &llm.Response{Content: p.vision, Model: req.Model}, nil
+	}
+	<-ctx.Done()
+	p.mu.Lock()
+	p.canceled = true
+	p.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+// requireNumber fails invoices without a number
+var requireNumber = processor.ValidationRule{Name: "number", Check: func(inv *model.Invoice) []processor.ValidationFinding {
+	if inv.Number != "" {
+		return nil
+	}
+	return []processor.ValidationFinding{{Message: "invoice number missing", Severity: processor.SeverityError}}
+}}
+
+func newRacePipeline(provider *raceProvider) *processor.Pipeline {
+	client := llm.NewClient("", llm.WithProvider(provider))
+	return processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client)),
+		processor.WithValidationRules(requireNumber),
+		processor.WithRace(true),
+	)
+}
+
+// textPDF builds a one-page PDF with a text layer, sent to vision as is: the
+// leading newline hides it from the renderer, not from the text extractor
+func textPDF(text string) []byte {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\n%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestRace_TextWins(t *testing.T) {
+	provider := &raceProvider{text: `{"invoice_number":"0000042","total_amount":1100000}`}
+	p := newRacePipeline(provider)
+
+	result := p.ProcessPDF(context.Background(), nil, textPDF("HOA DON 0000042 Total 1.100.000"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMText, result.Method)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.True(t, provider.canceled, "the vision request is canceled")
+}
+
+func TestRace_VisionWins(t *testing.T) {
+	provider := &raceProvider{
+		text:   `{"total_amount":1100000}`,
+		vision: `{"invoice_number":"0000042","total_amount":1100000}`,
+	}
+	p := newRacePipeline(provider)
+
+	result := p.ProcessPDF(context.Background(), nil, textPDF("HOA DON Total 1.100.000"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMVision, result.Method)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+}
+
+func TestRace_NoneValid(t *testing.T) {
+	provider := &raceProvider{
+		text:   `{"total_amount":1100000}`,
+		vision: `{"total_amount":1000000}`,
+	}
+	p := newRacePipeline(provider)
+
+	result := p.ProcessPDF(context.Background(), nil, textPDF("HOA DON Total 1.100.000"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMText, result.Method, "the first path of the chain is kept")
+	assert.Contains(t, result.Warnings, "validation error: invoice number missing")
+}
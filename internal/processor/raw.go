@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// WithRawResponses keeps every LLM call of a document in Result.Raw: the
+// exact prompts, model and generation parameters, image hashes and the
+// unparsed response, so an extracted value can be reproduced and verified
+// long after. Prompts and responses are kept unredacted.
+func WithRawResponses(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.rawResponses = enabled
+	}
+}
+
+// callLog records the LLM calls of one document, for Result.Raw and
+// Result.Debug
+type callLog struct {
+	mu     sync.Mutex
+	events []llm.AuditEvent
+}
+
+// Intercept records a call, unless made for a document nested in this one,
+// such as an archive member, which has a log of its own
+func (l *callLog) Intercept(ctx context.Context, event *llm.AuditEvent) {
+	if log, _ := ctx.Value(callLogKey{}).(*callLog); log != l {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, *event)
+}
+
+type callLogKey struct{}
+
+// withCallLog gives a document its own call log when its calls are kept
+func (p *Pipeline) withCallLog(ctx context.Context) context.Context {
+	if !p.rawResponses && p.debug == nil {
+		return ctx
+	}
+	l := &callLog{}
+	ctx = context.WithValue(ctx, callLogKey{}, l)
+	return llm.ContextWithInterceptor(ctx, l)
+}
+
+// llmCalls returns the LLM calls of the document of ctx
+func llmCalls(ctx context.Context) []llm.AuditEvent {
+	l, ok := ctx.Value(callLogKey{}).(*callLog)
+	if !ok {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]llm.AuditEvent(nil), l.events...)
+}
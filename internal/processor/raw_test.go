@@ -0,0 +1,61 @@
+package processor_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestRawResponses(t *testing.T) {
+	client := llm.NewClient("", llm.WithProvider(&stubProvider{content: `{"invoice_number":"0000042","total_amount":110000}`}))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client, llm.WithVisionModel("vision-model"))),
+		processor.WithRawResponses(true),
+	)
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "scan.jpg")
+	result := p.ProcessImage(ctx, []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	require.Len(t, result.Raw, 1)
+	assert.Nil(t, result.Debug, "debug artifacts are separate")
+
+	raw := result.Raw[0]
+	assert.NotEmpty(t, raw.ID)
+	assert.Equal(t, "scan.jpg", raw.DocumentID)
+	assert.Equal(t, "stub", raw.Provider)
+	assert.Equal(t, "vision-model", raw.Model)
+	assert.NotEmpty(t, raw.RequestHash)
+	assert.NotEmpty(t, raw.SystemPrompt)
+	assert.NotEmpty(t, raw.UserPrompt)
+	assert.Len(t, raw.ImageHashes, 1)
+	assert.JSONEq(t, `{"invoice_number":"0000042","total_amount":110000}`, raw.Response)
+
+	encoded, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"raw":[{`)
+}
+
+func TestRawResponses_Off(t *testing.T) {
+	p, _ := newStubPipeline(`{"invoice_number":"0000042"}`)
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Nil(t, result.Raw)
+}
+
+func TestRawResponses_ArchiveMembers(t *testing.T) {
+	client := llm.NewClient("", llm.WithProvider(&stubProvider{content: `{"invoice_number":"0000042"}`}))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client)), processor.WithRawResponses(true))
+
+	results := p.Process(context.Background(), buildZIP(t, map[string]string{"a.jpg": "\xff\xd8\xffpage a", "b.jpg": "\xff\xd8\xffpage b"}), processor.ProcessOptions{})
+	require.Len(t, results, 2)
+	for _, r := range results {
+		require.NoError(t, r.Error)
+		assert.Len(t, r.Raw, 1, "each member keeps only its own calls")
+	}
+}
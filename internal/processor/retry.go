@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+)
+
+// StageRetryPolicy controls how a failed stage is run again
+type StageRetryPolicy struct {
+	MaxAttempts    int           // Attempts including the first (0 or 1 = no retries)
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound for any single delay (0 = none)
+	Multiplier     float64       // Backoff growth factor between attempts (0 = 2)
+
+	// Retryable reports whether an error is worth another attempt (default:
+	// IsTransient)
+	Retryable func(error) bool
+}
+
+// DefaultStageRetryPolicy retries the PDF tools once: they fail under
+// memory pressure or when the process table is full. LLM stages are not
+// retried by default; the extractor already retries each request (see
+// llm.WithRetryPolicy).
+var DefaultStageRetryPolicy = StageRetryPolicy{
+	MaxAttempts:    2,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// DefaultRetryBudget is how many stage retries a document may use in all
+const DefaultRetryBudget = 4
+
+// WithStageRetry sets the retry policy of a stage (default:
+// DefaultStageRetryPolicy for StagePDFText and StagePDFRender, none for the
+// others)
+func WithStageRetry(stage Stage, policy StageRetryPolicy) PipelineOption {
+	return func(p *Pipeline) {
+		p.stageRetry[stage] = policy
+	}
+}
+
+// WithRetryBudget caps the retries of all stages of one document, so a
+// document failing everywhere gives up early (default: DefaultRetryBudget,
+// 0 = no retries)
+func WithRetryBudget(n int) PipelineOption {
+	return func(p *Pipeline) {
+		p.retryBudget = n
+	}
+}
+
+func defaultStageRetry() map[Stage]StageRetryPolicy {
+	return map[Stage]StageRetryPolicy{
+		StagePDFText:   DefaultStageRetryPolicy,
+		StagePDFRender: DefaultStageRetryPolicy,
+	}
+}
+
+// IsTransient reports whether err is a failure that may not happen again:
+// LLM timeouts, rate limits and server errors (see llm.IsRetryable), tools
+// killed by a signal, and temporary resource shortages such as EAGAIN or
+// too many open files
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if llm.IsRetryable(err) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ProcessState != nil && !exitErr.ProcessState.Exited() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.EBUSY, syscall.EINTR, syscall.EMFILE, syscall.ENFILE, syscall.ETXTBSY} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before retry number retry (1-based)
+func (s StageRetryPolicy) backoff(retry int) time.Duration {
+	multiplier := s.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(s.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+	}
+	if s.MaxBackoff > 0 && delay > float64(s.MaxBackoff) {
+		delay = float64(s.MaxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+// retryBudget counts the stage retries left to a document, whose stages
+// may run concurrently (see WithEnsemble)
+type retryBudget struct {
+	mu   sync.Mutex
+	left int
+	used int
+}
+
+// take uses up a retry, if any is left
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.left <= 0 {
+		return false
+	}
+	b.left--
+	b.used++
+	return true
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget gives a document its own retry budget
+func (p *Pipeline) withRetryBudget(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, &retryBudget{left: p.retryBudget})
+}
+
+// retriesUsed returns the stage retries of the document of ctx
+func retriesUsed(ctx context.Context) int {
+	if budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget); ok {
+		budget.mu.Lock()
+		defer budget.mu.Unlock()
+		return budget.used
+	}
+	return 0
+}
+
+// runStage runs fn as stage, again after transient failures as the stage's
+// policy and the document's retry budget allow. Each attempt is a stage of
+// its own in the metrics and traces.
+func (p *Pipeline) runStage(ctx context.Context, stage Stage, fn func(ctx context.Context) error) error {
+	policy := p.stageRetry[stage]
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	budget, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+
+	for attempt := 1; ; attempt++ {
+		deadlineCtx, cancel, err := p.stageContext(ctx, stage)
+		if err != nil {
+			return err
+		}
+		stageCtx, run := p.startStage(deadlineCtx, stage)
+		err = fn(stageCtx)
+		cancel()
+		err = stageDeadlineError(ctx, deadlineCtx, stage, run.start, err)
+		run.end(err)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if budget == nil || !budget.take() {
+			logging.Warn(ctx, "retry budget exhausted", "stage", stage, "error", err)
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		logging.Warn(ctx, "retrying stage", "stage", stage, "attempt", attempt+1, "backoff", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// flakyProvider fails the first calls with an HTTP status, then answers
+type flakyProvider struct {
+	failures int
+	status   int
+	calls    int
+}
+
+func (p *flakyProvider) Name() string { return "flaky" }
+
+func (p *flakyProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, &llm.APIError{Provider: "flaky", StatusCode: p.status, Body: "unavailable"}
+	}
+	return &llm.Response{Content: `{"invoice_number":"0000042","total_amount":110000}`, Model: req.Model}, nil
+}
+
+func newFlakyPipeline(provider *flakyProvider, opts ...processor.PipelineOption) *processor.Pipeline {
+	client := llm.NewClient("", llm.WithProvider(provider))
+	extractor := llm.NewExtractor(client, llm.WithRetryPolicy(llm.NoRetry))
+	return processor.NewPipeline(append([]processor.PipelineOption{processor.WithLLMExtractor(extractor)}, opts...)...)
+}
+
+func TestStageRetry(t *testing.T) {
+	provider := &flakyProvider{failures: 2, status: 503}
+	p := newFlakyPipeline(provider, processor.WithStageRetry(processor.StageLLMVision, processor.StageRetryPolicy{MaxAttempts: 3}))
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.Equal(t, 3, provider.calls)
+	assert.Equal(t, 2, result.Retries)
+}
+
+func TestStageRetry_NotByDefault(t *testing.T) {
+	provider := &flakyProvider{failures: 1, status: 503}
+	result := newFlakyPipeline(provider).ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.Error(t, result.Error)
+	assert.Equal(t, 1, provider.calls)
+	assert.Zero(t, result.Retries)
+}
+
+func TestStageRetry_PermanentError(t *testing.T) {
+	provider := &flakyProvider{failures: 1, status: 400}
+	p := newFlakyPipeline(provider, processor.WithStageRetry(processor.StageLLMVision, processor.StageRetryPolicy{MaxAttempts: 3}))
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.Error(t, result.Error)
+	assert.Equal(t, 1, provider.calls)
+}
+
+func TestStageRetry_Budget(t *testing.T) {
+	provider := &flakyProvider{failures: 5, status: 429}
+	p := newFlakyPipeline(provider,
+		processor.WithStageRetry(processor.StageLLMVision, processor.StageRetryPolicy{MaxAttempts: 5}),
+		processor.WithRetryBudget(1),
+	)
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.Error(t, result.Error)
+	assert.Equal(t, 2, provider.calls, "one attempt and the one retry of the budget")
+	assert.Equal(t, 1, result.Retries)
+
+	// Each document has a budget of its own
+	provider.calls, provider.failures = 0, 1
+	result = p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, 1, result.Retries)
+}
+
+func TestStageRetry_CustomRetryable(t *testing.T) {
+	provider := &flakyProvider{failures: 1, status: 400}
+	p := newFlakyPipeline(provider, processor.WithStageRetry(processor.StageLLMVision, processor.StageRetryPolicy{
+		MaxAttempts: 2,
+		Retryable:   func(error) bool { return true },
+	}))
+
+	result := p.ProcessImage(context.Background(), []byte("jpeg"), "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"timeout", context.DeadlineExceeded, true},
+		{"server error", &llm.APIError{StatusCode: 502}, true},
+		{"bad request", &llm.APIError{StatusCode: 400}, false},
+		{"too many open files", &os.PathError{Op: "open", Path: "/tmp/x", Err: syscall.EMFILE}, true},
+		{"try again", fmt.Errorf("fork: %w", syscall.EAGAIN), true},
+		{"missing file", &os.PathError{Op: "open", Path: "/tmp/x", Err: syscall.ENOENT}, false},
+		{"other", errors.New("malformed PDF"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, processor.IsTransient(tt.err))
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// MethodRules marks invoices read by label rules, without an LLM
+const MethodRules ExtractionMethod = "rules"
+
+// ConfidenceRules is below the default review threshold: rules read only the
+// labeled header fields and totals, and no line items
+const ConfidenceRules = 0.50
+
+// Label rules for documents printed in the MST/TCT layout most e-invoice
+// platforms share. Labels may carry an English translation in parentheses.
+var (
+	seriesPattern = regexp.MustCompile(`(?i)k[ýy]\s*hi[ệe]u\s*(?:\([^)]*\))?\s*:\s*([0-9A-Z]{1,2}[0-9A-Z/-]{3,10})`)
+
+	datePattern = regexp.MustCompile(`(?i)ng[àa]y\s*(?:\([^)]*\))?\s*(\d{1,2})\s*th[áa]ng\s*(?:\([^)]*\))?\s*(\d{1,2})\s*n[ăa]m\s*(?:\([^)]*\))?\s*(\d{4})`)
+
+	// numericDatePattern is the fallback "Ngày: 15/03/2024"
+	numericDatePattern = regexp.MustCompile(`(?i)(?:ng[àa]y|date)[^:\n]{0,20}:\s*(\d{1,2})[/.-](\d{1,2})[/.-](\d{4})`)
+
+	taxIDPattern = regexp.MustCompile(`(?i)(?:m[ãa]\s*s[ốo]\s*thu[ếe]|\bmst\b|tax\s*code)\s*(?:\([^)]*\))?\s*:\s*([\d][\d -]{8,16}\d)`)
+
+	// amountPattern finds the first number in a labeled value
+	amountPattern = regexp.MustCompile(`\d[\d.,]*`)
+)
+
+// Labels of the values read by FindNear, most specific first
+var (
+	sellerNameLabels = []string{"đơn vị bán hàng", "tên người bán", "người bán hàng", "seller"}
+	buyerNameLabels  = []string{"tên đơn vị", "đơn vị mua hàng", "họ tên người mua hàng", "tên người mua", "buyer"}
+	subtotalLabels   = []string{"cộng tiền hàng", "tổng tiền hàng", "tổng tiền trước thuế"}
+	taxLabels        = []string{"tiền thuế gtgt", "tổng tiền thuế", "tiền thuế"}
+	totalLabels      = []string{"tổng cộng tiền thanh toán", "tổng tiền thanh toán", "tổng cộng", "total amount"}
+)
+
+// ExtractWithRules reads an invoice from PDF text with label rules and
+// regular expressions only: number, series, date, party names and tax IDs,
+// and the totals. Line items are not read. It fails when neither an invoice
+// number nor a total is found.
+func ExtractWithRules(et *pdf.ExtractedText) (*model.Invoice, error) {
+	inv := &model.Invoice{
+		Type:         model.InvoiceTypeNormal,
+		DocumentType: model.DocumentTypeInvoice,
+		Currency:     "VND",
+	}
+
+	if matches, _ := et.FindPattern(invoiceNumberPattern.String()); len(matches) > 0 {
+		inv.Number = invoiceNumberPattern.FindStringSubmatch(matches[0])[1]
+	}
+	if matches, _ := et.FindPattern(seriesPattern.String()); len(matches) > 0 {
+		inv.Series = seriesPattern.FindStringSubmatch(matches[0])[1]
+	}
+	inv.Date = findDate(et)
+
+	if matches, _ := et.FindPattern(taxIDPattern.String()); len(matches) > 0 {
+		// The seller block is printed before the buyer block
+		ids := make([]string, 0, len(matches))
+		for _, m := range matches {
+			if id := cleanTaxID(taxIDPattern.FindStringSubmatch(m)[1]); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			inv.Seller.TaxID = ids[0]
+		}
+		if len(ids) > 1 {
+			inv.Buyer.TaxID = ids[1]
+		}
+	}
+	inv.Seller.Name = findNear(et, sellerNameLabels)
+	inv.Buyer.Name = findNear(et, buyerNameLabels)
+
+	inv.SubtotalAmount = findAmount(et, subtotalLabels)
+	inv.TaxAmount = findAmount(et, taxLabels)
+	inv.TotalAmount = findAmount(et, totalLabels)
+
+	if inv.Number == "" && inv.TotalAmount.IsZero() {
+		return nil, fmt.Errorf("no invoice number or total found by label rules")
+	}
+
+	// Rules cannot check what they read; flag the fields they left empty
+	for _, f := range []struct {
+		path    string
+		missing bool
+	}{
+		{"invoice_number", inv.Number == ""},
+		{"date", inv.Date.IsZero()},
+		{"seller.name", inv.Seller.Name == ""},
+		{"seller.tax_id", inv.Seller.TaxID == ""},
+		{"total_amount", inv.TotalAmount.IsZero()},
+	} {
+		if f.missing {
+			inv.LowConfidenceFields = append(inv.LowConfidenceFields, f.path)
+		}
+	}
+
+	return inv, nil
+}
+
+// findDate reads the issue date written out ("Ngày 15 tháng 03 năm 2024") or numerically
+func findDate(et *pdf.ExtractedText) time.Time {
+	for _, pattern := range []*regexp.Regexp{datePattern, numericDatePattern} {
+		matches, _ := et.FindPattern(pattern.String())
+		for _, m := range matches {
+			parts := pattern.FindStringSubmatch(m)
+			day, _ := strconv.Atoi(parts[1])
+			month, _ := strconv.Atoi(parts[2])
+			year, _ := strconv.Atoi(parts[3])
+			date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+			if date.Day() == day && int(date.Month()) == month {
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// findNear returns the value next to the first label found
+func findNear(et *pdf.ExtractedText, labels []string) string {
+	for _, label := range labels {
+		if value := et.FindNear(label, 1); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// findAmount returns the first number next to the first label found
+func findAmount(et *pdf.ExtractedText, labels []string) decimal.Decimal {
+	value := amountPattern.FindString(findNear(et, labels))
+	if value == "" {
+		return decimal.Zero
+	}
+	amount, err := llm.ParseAmount(value, llm.DefaultNumberFormats["VND"])
+	if err != nil {
+		return decimal.Zero
+	}
+	return amount
+}
+
+// cleanTaxID removes spacing from a tax ID and keeps it only if it has 10
+// digits, optionally followed by a 3-digit branch suffix
+func cleanTaxID(s string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	switch len(digits) {
+	case 10:
+		return digits
+	case 13:
+		return digits[:10] + "-" + digits[10:]
+	default:
+		return ""
+	}
+}
+
+// extractRules is the extraction used when no LLM is configured
+func extractRules(text string, meta pdf.Metadata, warnings []string) *Result {
+	invoice, err := ExtractWithRules(&pdf.ExtractedText{RawText: text, Metadata: meta})
+	if err != nil {
+		return &Result{
+			Error:    err,
+			Warnings: append(warnings, fmt.Sprintf("rule extraction failed: %v", err)),
+		}
+	}
+
+	if invoice.Provider == model.ProviderUnknown {
+		invoice.Provider = InferProvider(invoice, text, meta)
+	}
+
+	return &Result{
+		Invoice:    invoice,
+		Method:     MethodRules,
+		Confidence: ConfidenceRules,
+		Warnings:   append(append(warnings, "no LLM configured: read with label rules, line items not extracted"), qualityWarnings(invoice)...),
+	}
+}
@@ -0,0 +1,58 @@
+package processor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+const rulesInvoiceText = `HÓA ĐƠN GIÁ TRỊ GIA TĂNG
+(VAT INVOICE)
+Ký hiệu (Serial): 1C24TAA
+Số (No.): 0000123
+Ngày (Date) 15 tháng (month) 03 năm (year) 2024
+Đơn vị bán hàng (Seller): CÔNG TY TNHH ABC
+Mã số thuế (Tax code): 0312 345 678
+Địa chỉ (Address): 123 Lê Lợi, Q.1, TP.HCM
+Tên đơn vị (Company name): CÔNG TY CỔ PHẦN XYZ
+Mã số thuế (Tax code): 0109876543-001
+STT Tên hàng hóa Đơn vị tính Số lượng Đơn giá Thành tiền
+1 Bút bi Cái 10 5.000 50.000
+Cộng tiền hàng (Sub total): 50.000
+Tiền thuế GTGT (VAT amount): 5.000
+Tổng cộng tiền thanh toán (Total payment): 55.000`
+
+func TestExtractWithRules(t *testing.T) {
+	inv, err := processor.ExtractWithRules(&pdf.ExtractedText{RawText: rulesInvoiceText})
+	require.NoError(t, err)
+
+	assert.Equal(t, "0000123", inv.Number)
+	assert.Equal(t, "1C24TAA", inv.Series)
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "CÔNG TY TNHH ABC", inv.Seller.Name)
+	assert.Equal(t, "0312345678", inv.Seller.TaxID)
+	assert.Equal(t, "CÔNG TY CỔ PHẦN XYZ", inv.Buyer.Name)
+	assert.Equal(t, "0109876543-001", inv.Buyer.TaxID)
+	assert.True(t, decimal.NewFromInt(50000).Equal(inv.SubtotalAmount))
+	assert.True(t, decimal.NewFromInt(5000).Equal(inv.TaxAmount))
+	assert.True(t, decimal.NewFromInt(55000).Equal(inv.TotalAmount))
+	assert.Empty(t, inv.Items, "line items are left to the LLM")
+	assert.Empty(t, inv.LowConfidenceFields)
+}
+
+func TestExtractWithRules_Partial(t *testing.T) {
+	inv, err := processor.ExtractWithRules(&pdf.ExtractedText{RawText: "PHIẾU THU\nNgày: 02/01/2024\nTổng cộng: 1.250.000 đ"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.True(t, decimal.NewFromInt(1250000).Equal(inv.TotalAmount))
+	assert.Equal(t, []string{"invoice_number", "seller.name", "seller.tax_id"}, inv.LowConfidenceFields)
+
+	_, err = processor.ExtractWithRules(&pdf.ExtractedText{RawText: "Biên bản họp giao ban tuần"})
+	assert.Error(t, err)
+}
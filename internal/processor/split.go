@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// MaxSplitPages caps the pages sent to the LLM to find invoice boundaries;
+// longer files are processed as one document
+const MaxSplitPages = 30
+
+// invoiceNumberPattern matches the invoice number in a page header, such as
+// "Số: 0000123", "Số (No.): 123" or "Số hóa đơn: 123". The colon keeps street
+// numbers ("Số 12 Lê Lợi") out.
+var invoiceNumberPattern = regexp.MustCompile(`(?i)(?:\bs[ốo](?:\s+h[óo]a\s+đ[ơo]n)?|invoice\s+no\.?)\s*(?:\(no\.?\))?\s*:\s*(\d{1,8})\b`)
+
+// invoiceSeriesPattern matches the series in a page header, such as
+// "Ký hiệu: 1C24TAA" or "Ký hiệu (Serial): AA/23E"
+var invoiceSeriesPattern = regexp.MustCompile(`(?i)(?:\bk[ýy]\s+hi[ệe]u|\bserial(?:\s+no\.?)?)\s*(?:\((?:serial|series)(?:\s+no\.?)?\))?\s*:\s*([0-9A-Z]{1,2}[0-9A-Z/]{2,10})\b`)
+
+// invoiceTitlePattern matches the title printed at the top of an invoice,
+// such as "HÓA ĐƠN GIÁ TRỊ GIA TĂNG"
+var invoiceTitlePattern = regexp.MustCompile(`(?i)h[óo]a\s+đ[ơo]n\s+(?:gi[áa]\s+tr[ịi]\s+gia\s+t[ăa]ng|b[áa]n\s+h[àa]ng|đi[ệe]n\s+t[ửu])|\bvat\s+invoice\b`)
+
+// continuationPattern matches the marks of a page continuing the invoice
+// before it: "(tiếp theo)", "continued", or a page number after the first
+// ("Trang 2/3")
+var continuationPattern = regexp.MustCompile(`(?i)ti[ếe]p\s+theo|\bcontinued\b|\b(?:trang|page)\s+(?:[2-9]|\d{2,})\s*/\s*\d+`)
+
+// ProcessPDFDocuments extracts every invoice in a PDF that may bundle several,
+// such as consolidated landlord or utility bills, returning one Result per
+// invoice in page order. Boundaries come from the invoice headers printed on
+// the pages (title, series and number) when every page has text; otherwise
+// the LLM is asked to find them. Without an LLM, files the headers do not
+// split are read as one document.
+func (p *Pipeline) ProcessPDFDocuments(ctx context.Context, data []byte) []*Result {
+	ctx, span := p.startDocument(ctx, "pdf_documents")
+	defer span.End()
+
+	extracted, err := p.pdfExtractor.ExtractBytes(ctx, data)
+	if err != nil || extracted.PageCount < 2 {
+		return []*Result{p.ProcessPDF(ctx, nil, data, "application/pdf")}
+	}
+
+	pageTexts := make([]string, extracted.PageCount)
+	for _, page := range extracted.Pages {
+		if page.PageNum >= 1 && page.PageNum <= len(pageTexts) {
+			pageTexts[page.PageNum-1] = page.Text
+		}
+	}
+
+	// Page images are rendered at most once, and only if needed
+	var images []llm.Image
+	var renderErr error
+	render := func() ([]llm.Image, error) {
+		if images == nil && renderErr == nil {
+			var pages [][]byte
+			pages, renderErr = p.pdfExtractor.ConvertToImages(ctx, data)
+			images = toImages(pages)
+		}
+		return images, renderErr
+	}
+
+	ranges, warnings := p.splitPages(ctx, pageTexts, render)
+	if len(ranges) < 2 {
+		result := p.ProcessPDF(ctx, nil, data, "application/pdf")
+		result.Warnings = append(warnings, result.Warnings...)
+		return []*Result{result}
+	}
+
+	results := make([]*Result, len(ranges))
+	for i := range ranges {
+		result := p.finish(ctx, p.processPageRange(ctx, ranges[i], pageTexts, extracted.Metadata, render))
+		result.Pages = &ranges[i]
+		results[i] = result
+	}
+	results[0].Warnings = append(warnings, results[0].Warnings...)
+
+	return results
+}
+
+// splitPages finds the page ranges of the invoices in a file
+func (p *Pipeline) splitPages(ctx context.Context, pageTexts []string, render func() ([]llm.Image, error)) ([]llm.PageRange, []string) {
+	if ranges, ok := splitByHeaders(pageTexts); ok {
+		return ranges, nil
+	}
+	if p.llmExtractor == nil {
+		return nil, nil
+	}
+	if len(pageTexts) > MaxSplitPages {
+		return nil, []string{fmt.Sprintf("%d pages are too many to look for separate invoices; processed as one document", len(pageTexts))}
+	}
+
+	hasText := true
+	for _, text := range pageTexts {
+		hasText = hasText && strings.TrimSpace(text) != ""
+	}
+
+	if hasText {
+		ranges, err := p.llmExtractor.SplitPages(ctx, pageTexts)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("LLM document splitting failed: %v", err)}
+		}
+		return ranges, nil
+	}
+
+	images, err := render()
+	if err != nil {
+		return nil, []string{fmt.Sprintf("PDF to image conversion failed: %v", err)}
+	}
+	ranges, err := p.llmExtractor.SplitPageImages(ctx, images)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("LLM document splitting failed: %v", err)}
+	}
+	return ranges, nil
+}
+
+// pageHeader is what identifies the invoice a page belongs to
+type pageHeader struct {
+	title        bool   // The invoice title is printed
+	series       string // Upper case, empty when not printed
+	number       string // Without leading zeros, empty when not printed
+	continuation bool   // The page says it continues the one before
+}
+
+func readPageHeader(text string) pageHeader {
+	h := pageHeader{
+		title:        invoiceTitlePattern.MatchString(text),
+		continuation: continuationPattern.MatchString(text),
+	}
+	if m := invoiceNumberPattern.FindStringSubmatch(text); m != nil {
+		h.number = strings.TrimLeft(m[1], "0")
+	}
+	if m := invoiceSeriesPattern.FindStringSubmatch(text); m != nil {
+		h.series = strings.ToUpper(m[1])
+	}
+	return h
+}
+
+// splitByHeaders starts a new document at each page whose invoice header
+// differs from the current document's: another series or number, or the
+// invoice title on a page with no number that does not say it continues the
+// page before. It is only conclusive when every page has text and the first
+// page shows a title or a number.
+func splitByHeaders(pageTexts []string) ([]llm.PageRange, bool) {
+	var ranges []llm.PageRange
+	var current pageHeader
+	for i, text := range pageTexts {
+		if strings.TrimSpace(text) == "" {
+			return nil, false
+		}
+
+		h := readPageHeader(text)
+		if i == 0 {
+			if h.number == "" && !h.title {
+				return nil, false
+			}
+			ranges = append(ranges, llm.PageRange{Start: 1, End: 1})
+			current = h
+			continue
+		}
+
+		newDocument := false
+		switch {
+		case h.number != "" && current.number != "":
+			newDocument = h.number != current.number ||
+				(h.series != "" && current.series != "" && h.series != current.series)
+		case h.title:
+			newDocument = !h.continuation
+		}
+
+		if newDocument {
+			ranges = append(ranges, llm.PageRange{Start: i + 1, End: i + 1})
+			current = h
+			continue
+		}
+		ranges[len(ranges)-1].End = i + 1
+		if current.series == "" {
+			current.series = h.series
+		}
+		if current.number == "" {
+			current.number = h.number
+		}
+	}
+	return ranges, true
+}
+
+// processPageRange extracts the invoice on one range of pages, from text when
+// the pages have it and from page images otherwise
+func (p *Pipeline) processPageRange(ctx context.Context, r llm.PageRange, pageTexts []string, meta pdf.Metadata, render func() ([]llm.Image, error)) *Result {
+	var texts []string
+	for _, text := range pageTexts[r.Start-1 : r.End] {
+		if strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	var warnings []string
+	if len(texts) > 0 {
+		result := p.extractText(ctx, strings.Join(texts, "\n"), meta)
+		if (result.Invoice != nil && result.Error == nil) || p.llmExtractor == nil || errors.Is(result.Error, ErrSkipped) {
+			return result
+		}
+		warnings = result.Warnings
+	}
+
+	images, err := render()
+	if err != nil {
+		return &Result{
+			Error:    fmt.Errorf("failed to convert PDF to images: %w", err),
+			Warnings: append(warnings, fmt.Sprintf("PDF to image conversion failed: %v", err)),
+		}
+	}
+	if r.End > len(images) {
+		return &Result{Error: fmt.Errorf("pages %s: PDF rendered only %d pages", r, len(images)), Warnings: warnings}
+	}
+
+	pages := images[r.Start-1 : r.End]
+	if p.maxVisionPages > 0 && len(pages) > p.maxVisionPages {
+		warnings = append(warnings, fmt.Sprintf("only the first %d of %d pages were sent for vision extraction", p.maxVisionPages, len(pages)))
+		pages = pages[:p.maxVisionPages]
+	}
+
+	return p.extractImages(ctx, pages, meta, warnings)
+}
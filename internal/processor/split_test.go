@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+func TestSplitByHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		pages  []string
+		want   []llm.PageRange
+		wantOK bool
+	}{
+		{
+			name:   "one invoice per page",
+			pages:  []string{"HÓA ĐƠN Số: 0000101", "HÓA ĐƠN Số (No.): 0000102", "HÓA ĐƠN Số hóa đơn: 103"},
+			want:   []llm.PageRange{{Start: 1, End: 1}, {Start: 2, End: 2}, {Start: 3, End: 3}},
+			wantOK: true,
+		},
+		{
+			name:   "continuation pages",
+			pages:  []string{"Số: 0000101", "Bảng kê kèm theo, Số 12 Lê Lợi", "Số: 101 (tiếp theo)", "Số: 0000102"},
+			want:   []llm.PageRange{{Start: 1, End: 3}, {Start: 4, End: 4}},
+			wantOK: true,
+		},
+		{
+			name: "repeated titles without numbers",
+			pages: []string{
+				"HÓA ĐƠN GIÁ TRỊ GIA TĂNG\nĐơn vị bán: Công ty A",
+				"Trang 2/2",
+				"HÓA ĐƠN GIÁ TRỊ GIA TĂNG\nĐơn vị bán: Công ty B",
+				"HÓA ĐƠN GIÁ TRỊ GIA TĂNG (tiếp theo)",
+			},
+			want:   []llm.PageRange{{Start: 1, End: 2}, {Start: 3, End: 4}},
+			wantOK: true,
+		},
+		{
+			name: "new series with the same number",
+			pages: []string{
+				"Ký hiệu: 1C24TAA Số: 0000101",
+				"Ký hiệu (Serial): 1C24TAA Số: 0000101 Trang 2/2",
+				"Ký hiệu: 1C24TBB Số: 0000101",
+			},
+			want:   []llm.PageRange{{Start: 1, End: 2}, {Start: 3, End: 3}},
+			wantOK: true,
+		},
+		{
+			name:   "number on a later page",
+			pages:  []string{"VAT INVOICE", "Invoice No.: 77", "VAT INVOICE Invoice No.: 78"},
+			want:   []llm.PageRange{{Start: 1, End: 2}, {Start: 3, End: 3}},
+			wantOK: true,
+		},
+		{
+			name:  "scanned page",
+			pages: []string{"Số: 0000101", ""},
+		},
+		{
+			name:  "no number on first page",
+			pages: []string{"Bảng kê", "Số: 0000101"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := splitByHeaders(tt.pages)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+	"github.com/rezonia/invoice-processor/internal/parser/spreadsheet"
+)
+
+// MethodSpreadsheet marks invoices read from the columns of a spreadsheet,
+// without an LLM
+const MethodSpreadsheet ExtractionMethod = "spreadsheet"
+
+// ConfidenceSpreadsheet is given to spreadsheet invoices read with a
+// number, a date and line items. Cells are read exactly, but the columns
+// are matched by their header.
+const ConfidenceSpreadsheet = 0.85
+
+// SpreadsheetField is a value read from a column of a spreadsheet
+type SpreadsheetField string
+
+// Spreadsheet fields. The invoice fields may also be given as a label cell
+// followed by its value, above the line items.
+const (
+	SheetInvoiceNumber SpreadsheetField = "invoice_number"
+	SheetDate          SpreadsheetField = "date"
+	SheetSellerName    SpreadsheetField = "seller_name"
+	SheetSellerTaxID   SpreadsheetField = "seller_tax_id"
+	SheetBuyerName     SpreadsheetField = "buyer_name"
+	SheetBuyerTaxID    SpreadsheetField = "buyer_tax_id"
+	SheetCurrency      SpreadsheetField = "currency"
+	SheetItemCode      SpreadsheetField = "item_code"
+	SheetItemName      SpreadsheetField = "item_name"
+	SheetUnit          SpreadsheetField = "unit"
+	SheetQuantity      SpreadsheetField = "quantity"
+	SheetUnitPrice     SpreadsheetField = "unit_price"
+	SheetVATRate       SpreadsheetField = "vat_rate"
+	SheetVATAmount     SpreadsheetField = "vat_amount"
+	SheetAmount        SpreadsheetField = "amount"
+	SheetTotal         SpreadsheetField = "total" // Line total, with VAT
+)
+
+// sheetFields is the order header cells are matched to fields in: a cell
+// naming several fields goes to the first one not matched yet
+var sheetFields = []SpreadsheetField{
+	SheetInvoiceNumber, SheetDate, SheetSellerTaxID, SheetBuyerTaxID, SheetSellerName, SheetBuyerName, SheetCurrency,
+	SheetItemCode, SheetItemName, SheetUnit, SheetQuantity, SheetUnitPrice, SheetVATRate, SheetVATAmount, SheetAmount, SheetTotal,
+}
+
+// DefaultSpreadsheetColumns returns the header names of each field, in
+// English and Vietnamese
+func DefaultSpreadsheetColumns() map[SpreadsheetField][]string {
+	return map[SpreadsheetField][]string{
+		SheetInvoiceNumber: slices.Clone(htmlNumberLabels),
+		SheetDate:          slices.Clone(htmlDateLabels),
+		SheetSellerName:    append([]string{"seller name", "vendor name", "supplier name", "tên người bán"}, htmlSellerLabels...),
+		SheetSellerTaxID:   append([]string{"seller tax id", "seller tax code", "supplier tax id", "mst người bán"}, htmlTaxIDLabels...),
+		SheetBuyerName:     append([]string{"buyer name", "customer name", "tên người mua", "tên đơn vị mua"}, htmlBuyerLabels...),
+		SheetBuyerTaxID:    {"buyer tax id", "buyer tax code", "customer tax id", "mst người mua", "mã số thuế người mua"},
+		SheetCurrency:      {"currency", "ccy", "loại tiền", "tiền tệ"},
+		SheetItemCode:      {"code", "item code", "sku", "product code", "mã", "mã hàng"},
+		SheetItemName:      slices.Clone(htmlItemNameColumns),
+		SheetUnit:          slices.Clone(htmlUnitColumns),
+		SheetQuantity:      slices.Clone(htmlQuantityColumns),
+		SheetUnitPrice:     slices.Clone(htmlPriceColumns),
+		SheetVATRate:       {"vat rate", "vat %", "tax rate", "tax %", "thuế suất", "ts"},
+		SheetVATAmount:     {"vat amount", "vat", "tax amount", "tax", "tiền thuế", "tiền thuế gtgt", "thuế gtgt"},
+		SheetAmount:        {"amount", "net amount", "amount before tax", "subtotal", "thành tiền", "thành tiền trước thuế", "số tiền"},
+		SheetTotal:         {"total", "line total", "total amount", "amount incl. vat", "tổng cộng", "tổng tiền", "thành tiền sau thuế"},
+	}
+}
+
+// maxSheetHeaderRow is how deep in a sheet the header row is looked for
+const maxSheetHeaderRow = 30
+
+// SpreadsheetMapping tells how the columns of a spreadsheet invoice are read
+type SpreadsheetMapping struct {
+	// Columns are the header names of fields, matched case-insensitively
+	// without colons and parenthesized notes. Fields not given keep
+	// DefaultSpreadsheetColumns.
+	Columns map[SpreadsheetField][]string
+
+	Sheet     string // Sheet holding the line items; empty: the first with a header row
+	HeaderRow int    // Row of the header, from 1; 0: the row naming the most fields
+}
+
+// WithSpreadsheetMapping sets how the columns of spreadsheet invoices are
+// read, for supplier exports whose headers the defaults miss
+func WithSpreadsheetMapping(m SpreadsheetMapping) PipelineOption {
+	return func(p *Pipeline) {
+		p.sheetMapping = m
+	}
+}
+
+// ProcessSpreadsheet extracts an invoice from an XLSX workbook or a CSV
+// file, such as the line-item sheet of a supplier's monthly invoice. The
+// line items are read from the columns under a header row (see
+// ExtractFromSpreadsheet). A sheet without one, or a read missing the
+// invoice number or date, is read as text, one row per line with cells
+// separated by tabs, like PDF text.
+func (p *Pipeline) ProcessSpreadsheet(ctx context.Context, data []byte) *Result {
+	ctx, span := p.startDocument(ctx, "spreadsheet")
+	defer span.End()
+
+	var sheets []spreadsheet.Sheet
+	var err error
+	if spreadsheet.IsXLSX(data) {
+		sheets, err = spreadsheet.ReadXLSX(data)
+	} else {
+		sheets, err = spreadsheet.ReadCSV(data)
+	}
+	if err != nil {
+		return p.finish(ctx, &Result{Error: err})
+	}
+	text := sheetsToText(sheets)
+	if strings.TrimSpace(text) == "" {
+		return p.finish(ctx, &Result{Error: fmt.Errorf("no cells in workbook")})
+	}
+
+	invoice, err := ExtractFromSpreadsheet(sheets, p.sheetMapping)
+	complete := err == nil && invoice.Number != "" && !invoice.Date.IsZero()
+	if complete || (err == nil && p.llmExtractor == nil) {
+		confidence := ConfidenceSpreadsheet
+		if !complete {
+			confidence = ConfidenceRules
+		}
+		return p.finish(ctx, &Result{
+			Invoice:    invoice,
+			Method:     MethodSpreadsheet,
+			Confidence: confidence,
+			Warnings:   qualityWarnings(invoice),
+		})
+	}
+	return p.finish(ctx, p.extractText(ctx, text, pdf.Metadata{}))
+}
+
+// ExtractFromSpreadsheet reads an invoice from the line items of a sheet.
+// The header row is found by the column names of mapping, and each row
+// under it naming an item is a line item. Invoice fields are read from
+// their columns, the same on every row, or from label and value cells
+// outside the items, as are subtotal, VAT and total rows; totals missing
+// are summed from the items. It fails when no sheet has a header row with
+// an item name and an amount or price column.
+func ExtractFromSpreadsheet(sheets []spreadsheet.Sheet, mapping SpreadsheetMapping) (*model.Invoice, error) {
+	names := DefaultSpreadsheetColumns()
+	for field, columns := range mapping.Columns {
+		labels := make([]string, len(columns))
+		for i, c := range columns {
+			labels[i] = normalizeLabel(c)
+		}
+		names[field] = labels
+	}
+
+	var sheet spreadsheet.Sheet
+	header, cols := -1, map[SpreadsheetField]int(nil)
+	for _, s := range sheets {
+		if mapping.Sheet != "" && !strings.EqualFold(s.Name, mapping.Sheet) {
+			continue
+		}
+		if header, cols = sheetHeader(s.Rows, names, mapping.HeaderRow); header >= 0 {
+			sheet = s
+			break
+		}
+	}
+	if header < 0 {
+		return nil, fmt.Errorf("no header row with item and amount columns found in spreadsheet")
+	}
+
+	// Rows under the header naming an item are line items; the others, and
+	// those above, hold label and value cells
+	var items [][]string
+	var pairs []labelValue
+	for _, row := range sheet.Rows[:header] {
+		pairs = append(pairs, rowLabels(row)...)
+	}
+	summary := slices.Concat(htmlSubtotalLabels, htmlTaxLabels, htmlTotalLabels)
+	for _, row := range sheet.Rows[header+1:] {
+		name := sheetCell(row, cols, SheetItemName)
+		if cells := nonEmpty(row); name == "" || (len(cells) > 0 && slices.Contains(summary, normalizeLabel(cells[0]))) {
+			if len(cells) >= 2 {
+				pairs = append(pairs, labelValue{normalizeLabel(cells[0]), cells[len(cells)-1]})
+			}
+			continue
+		}
+		items = append(items, row)
+	}
+
+	// An invoice field is the first value of its column, or else of its label
+	field := func(f SpreadsheetField) string {
+		if _, ok := cols[f]; ok {
+			for _, row := range items {
+				if v := sheetCell(row, cols, f); v != "" {
+					return v
+				}
+			}
+		}
+		return findLabel(pairs, names[f])
+	}
+
+	inv := &model.Invoice{
+		Type:         model.InvoiceTypeNormal,
+		DocumentType: model.DocumentTypeInvoice,
+		Number:       firstWord(field(SheetInvoiceNumber)),
+		Date:         parseHTMLDate(field(SheetDate)),
+	}
+	inv.Seller.Name = field(SheetSellerName)
+	inv.Seller.TaxID = cleanTaxID(field(SheetSellerTaxID))
+	inv.Buyer.Name = field(SheetBuyerName)
+	inv.Buyer.TaxID = cleanTaxID(field(SheetBuyerTaxID))
+
+	total := findLabel(pairs, htmlTotalLabels)
+	if code := strings.ToUpper(strings.TrimSpace(field(SheetCurrency))); len(code) == 3 {
+		inv.Currency = code
+	} else {
+		var text strings.Builder
+		for _, row := range sheet.Rows {
+			text.WriteString(strings.Join(row, " "))
+			text.WriteByte('\n')
+		}
+		inv.Currency = detectCurrency(total, text.String())
+	}
+	format, ok := llm.DefaultNumberFormats[inv.Currency]
+	if !ok {
+		format = llm.PlainNumberFormat
+	}
+	amount := func(s string) decimal.Decimal {
+		if sheet.RawNumbers {
+			if d, err := decimal.NewFromString(strings.TrimSpace(s)); err == nil {
+				return d
+			}
+		}
+		return parseHTMLAmount(s, format)
+	}
+
+	var subtotal, vat decimal.Decimal
+	for _, row := range items {
+		item := model.LineItem{
+			Number:    len(inv.Items) + 1,
+			Code:      sheetCell(row, cols, SheetItemCode),
+			Name:      sheetCell(row, cols, SheetItemName),
+			Unit:      sheetCell(row, cols, SheetUnit),
+			Quantity:  amount(sheetCell(row, cols, SheetQuantity)),
+			UnitPrice: amount(sheetCell(row, cols, SheetUnitPrice)),
+			Amount:    amount(sheetCell(row, cols, SheetAmount)),
+			VATAmount: amount(sheetCell(row, cols, SheetVATAmount)),
+			Total:     amount(sheetCell(row, cols, SheetTotal)),
+		}
+		rate := amount(sheetCell(row, cols, SheetVATRate))
+		if sheet.RawNumbers && rate.GreaterThan(decimal.Zero) && rate.LessThan(decimal.NewFromInt(1)) {
+			rate = rate.Shift(2) // A percentage cell, stored as a fraction
+		}
+		item.VATRate = model.VATRate{Percent: rate}
+		if category, err := model.ParseVATRate(sheetCell(row, cols, SheetVATRate)); err == nil && !category.IsTaxable() {
+			item.VATRate = category
+		}
+
+		if item.Quantity.IsZero() {
+			item.Quantity = decimal.NewFromInt(1)
+		}
+		if item.Amount.IsZero() && !item.Total.IsZero() && item.VATAmount.IsZero() && (!item.VATRate.IsTaxable() || item.VATRate.IsZero()) {
+			item.Amount = item.Total
+		}
+		switch {
+		case item.Amount.IsZero() && !item.UnitPrice.IsZero():
+			item.Amount = item.Quantity.Mul(item.UnitPrice)
+		case item.UnitPrice.IsZero() && !item.Amount.IsZero():
+			item.UnitPrice = item.Amount.Div(item.Quantity)
+		}
+		if item.Amount.IsZero() {
+			continue // A heading or note row
+		}
+		if item.VATAmount.IsZero() {
+			item.VATAmount = item.VATRate.Tax(item.Amount).Round(format.Decimals)
+		}
+		if item.Total.IsZero() {
+			item.Total = item.Amount.Add(item.VATAmount)
+		}
+		subtotal = subtotal.Add(item.Amount)
+		vat = vat.Add(item.VATAmount)
+		inv.Items = append(inv.Items, item)
+	}
+
+	inv.SubtotalAmount = amount(findLabel(pairs, htmlSubtotalLabels))
+	if inv.SubtotalAmount.IsZero() {
+		inv.SubtotalAmount = subtotal
+	}
+	inv.TaxAmount = amount(findLabel(pairs, htmlTaxLabels))
+	if inv.TaxAmount.IsZero() {
+		inv.TaxAmount = vat
+	}
+	inv.TotalAmount = amount(total)
+	if inv.TotalAmount.IsZero() {
+		inv.TotalAmount = inv.SubtotalAmount.Add(inv.TaxAmount)
+	}
+
+	if len(inv.Items) == 0 {
+		return nil, fmt.Errorf("no line items found in spreadsheet")
+	}
+	inv.TaxBreakdown = model.SummarizeVAT(inv.Items)
+
+	for _, f := range []struct {
+		path    string
+		missing bool
+	}{
+		{"invoice_number", inv.Number == ""},
+		{"date", inv.Date.IsZero()},
+		{"seller.name", inv.Seller.Name == ""},
+	} {
+		if f.missing {
+			inv.LowConfidenceFields = append(inv.LowConfidenceFields, f.path)
+		}
+	}
+	return inv, nil
+}
+
+// sheetHeader returns the header row of rows and the column of each field
+// it names, or -1. The header is the row at headerRow (from 1), or else the
+// one naming the most fields; it must name an item and an amount or price.
+func sheetHeader(rows [][]string, names map[SpreadsheetField][]string, headerRow int) (int, map[SpreadsheetField]int) {
+	best, bestCols := -1, map[SpreadsheetField]int(nil)
+	for r, row := range rows[:min(len(rows), maxSheetHeaderRow)] {
+		if headerRow > 0 && r != headerRow-1 {
+			continue
+		}
+		cols := make(map[SpreadsheetField]int)
+		for i, cell := range row {
+			label := normalizeLabel(cell)
+			for _, f := range sheetFields {
+				if _, ok := cols[f]; !ok && label != "" && slices.Contains(names[f], label) {
+					cols[f] = i
+					break
+				}
+			}
+		}
+		_, name := cols[SheetItemName]
+		_, amount := cols[SheetAmount]
+		_, price := cols[SheetUnitPrice]
+		_, total := cols[SheetTotal]
+		if name && (amount || price || total) && len(cols) > len(bestCols) {
+			best, bestCols = r, cols
+		}
+	}
+	return best, bestCols
+}
+
+// sheetCell returns the cell of a field in row, or ""
+func sheetCell(row []string, cols map[SpreadsheetField]int, f SpreadsheetField) string {
+	if i, ok := cols[f]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// labelValue is a label, normalized, and the value given for it
+type labelValue struct{ label, value string }
+
+// rowLabels returns the label and value pairs of a row: "Label: value"
+// cells, and label cells followed by their value
+func rowLabels(row []string) []labelValue {
+	cells := nonEmpty(row)
+	var pairs []labelValue
+	for i := 0; i < len(cells); i++ {
+		if label, value, ok := strings.Cut(cells[i], ":"); ok && strings.TrimSpace(value) != "" {
+			pairs = append(pairs, labelValue{normalizeLabel(label), strings.TrimSpace(value)})
+		} else if i+1 < len(cells) {
+			pairs = append(pairs, labelValue{normalizeLabel(cells[i]), cells[i+1]})
+			i++
+		}
+	}
+	return pairs
+}
+
+// findLabel returns the value of the first pair with one of labels
+func findLabel(pairs []labelValue, labels []string) string {
+	for _, p := range pairs {
+		if slices.Contains(labels, p.label) {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// sheetsToText renders sheets as tab-separated rows, each sheet after its
+// name when there are several. Empty cells are kept so columns line up.
+func sheetsToText(sheets []spreadsheet.Sheet) string {
+	var b strings.Builder
+	for _, sheet := range sheets {
+		if len(sheet.Rows) == 0 {
+			continue
+		}
+		if len(sheets) > 1 {
+			fmt.Fprintf(&b, "%s\n", sheet.Name)
+		}
+		for _, row := range sheet.Rows {
+			b.WriteString(strings.Join(row, "\t"))
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,136 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/parser/spreadsheet"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// monthlyInvoice is a supplier's consolidated invoice: header fields above
+// the line items, and a total row
+func monthlyInvoice(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteXLSX(&buf, export.Sheet{
+		Name: "Invoice",
+		Rows: [][]any{
+			{"Công ty TNHH Nước Sạch"},
+			{"Invoice No:", "HD-2024-03"},
+			{"Date:", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+			{"Mã số thuế:", "0301234567"},
+			{"Bill to:", "Nhà hàng Phố Cổ"},
+			{},
+			{"STT", "Tên hàng hóa, dịch vụ", "ĐVT", "Số lượng", "Đơn giá", "Thuế suất", "Thành tiền"},
+			{1, "Nước đóng bình 20L", "bình", 40, 50000, "8%", 2000000},
+			{2, "Phí giao hàng", nil, nil, nil, "8%", 150000},
+			{nil, "Tổng cộng", nil, nil, nil, nil, 2322000},
+		},
+	}))
+	return buf.Bytes()
+}
+
+func TestExtractFromSpreadsheet_MonthlyInvoice(t *testing.T) {
+	sheets, err := spreadsheet.ReadXLSX(monthlyInvoice(t))
+	require.NoError(t, err)
+
+	inv, err := processor.ExtractFromSpreadsheet(sheets, processor.SpreadsheetMapping{})
+	require.NoError(t, err)
+	assert.Equal(t, "HD-2024-03", inv.Number)
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "0301234567", inv.Seller.TaxID)
+	assert.Equal(t, "Nhà hàng Phố Cổ", inv.Buyer.Name)
+	assert.Equal(t, "VND", inv.Currency)
+
+	require.Len(t, inv.Items, 2)
+	assert.Equal(t, "Nước đóng bình 20L", inv.Items[0].Name)
+	assert.Equal(t, "bình", inv.Items[0].Unit)
+	assert.Equal(t, "40", inv.Items[0].Quantity.String())
+	assert.Equal(t, "50000", inv.Items[0].UnitPrice.String())
+	assert.Equal(t, "8%", inv.Items[0].VATRate.String())
+	assert.Equal(t, "160000", inv.Items[0].VATAmount.String())
+	assert.Equal(t, "2160000", inv.Items[0].Total.String())
+	assert.Equal(t, "1", inv.Items[1].Quantity.String())
+	assert.Equal(t, "150000", inv.Items[1].UnitPrice.String())
+
+	assert.Equal(t, "2150000", inv.SubtotalAmount.String(), "summed from the items")
+	assert.Equal(t, "172000", inv.TaxAmount.String())
+	assert.Equal(t, "2322000", inv.TotalAmount.String())
+	assert.Equal(t, []string{"seller.name"}, inv.LowConfidenceFields)
+}
+
+func TestExtractFromSpreadsheet_CSVExport(t *testing.T) {
+	// Every row repeats the invoice fields, as in a billing system export
+	csv := "Invoice #;Invoice date;Supplier;Currency;SKU;Description;Qty;Unit price;Net amount;VAT amount\n" +
+		"INV-88;01/03/2024;Acme Pte Ltd;EUR;A-1;Widgets;10;2,50;25,00;5,00\n" +
+		"INV-88;01/03/2024;Acme Pte Ltd;EUR;B-2;Gadgets;1;1.250,00;1.250,00;250,00\n"
+	sheets, err := spreadsheet.ReadCSV([]byte(csv))
+	require.NoError(t, err)
+
+	inv, err := processor.ExtractFromSpreadsheet(sheets, processor.SpreadsheetMapping{})
+	require.NoError(t, err)
+	assert.Equal(t, "INV-88", inv.Number)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), inv.Date)
+	assert.Equal(t, "Acme Pte Ltd", inv.Seller.Name)
+	assert.Equal(t, "EUR", inv.Currency)
+	require.Len(t, inv.Items, 2)
+	assert.Equal(t, "A-1", inv.Items[0].Code)
+	assert.Equal(t, "2.5", inv.Items[0].UnitPrice.String())
+	assert.Equal(t, "1250", inv.Items[1].Amount.String())
+	assert.Equal(t, "1275", inv.SubtotalAmount.String())
+	assert.Equal(t, "255", inv.TaxAmount.String())
+	assert.Equal(t, "1530", inv.TotalAmount.String())
+	assert.Empty(t, inv.LowConfidenceFields)
+}
+
+func TestExtractFromSpreadsheet_Mapping(t *testing.T) {
+	csv := "Bill,Posted,Line,Count,Charge\nB-7,2024-04-02,Hosting,2,\"1,200\"\n"
+	sheets, err := spreadsheet.ReadCSV([]byte(csv))
+	require.NoError(t, err)
+
+	_, err = processor.ExtractFromSpreadsheet(sheets, processor.SpreadsheetMapping{})
+	assert.ErrorContains(t, err, "no header row")
+
+	inv, err := processor.ExtractFromSpreadsheet(sheets, processor.SpreadsheetMapping{
+		Columns: map[processor.SpreadsheetField][]string{
+			processor.SheetInvoiceNumber: {"Bill"},
+			processor.SheetDate:          {"posted"},
+			processor.SheetItemName:      {"Line"},
+			processor.SheetQuantity:      {"Count"},
+			processor.SheetAmount:        {"Charge"},
+		},
+		HeaderRow: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "B-7", inv.Number)
+	assert.Equal(t, time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), inv.Date)
+	require.Len(t, inv.Items, 1)
+	assert.Equal(t, "1200", inv.Items[0].Amount.String())
+	assert.Equal(t, "600", inv.Items[0].UnitPrice.String())
+}
+
+func TestProcess_SpreadsheetColumns(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"unused"}`)
+
+	results := p.Process(context.Background(), monthlyInvoice(t), processor.ProcessOptions{Filename: "march.xlsx"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodSpreadsheet, results[0].Method)
+	assert.Equal(t, "HD-2024-03", results[0].Invoice.Number)
+	assert.Empty(t, provider.requests, "no LLM call for a complete read")
+
+	// CSV is recognized by its extension
+	csv := []byte("Invoice No,Date,Item,Amount\nC-1,2024-05-01,Paper,90000\n")
+	results = processor.NewPipeline().Process(context.Background(), csv, processor.ProcessOptions{Filename: "may.csv"})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodSpreadsheet, results[0].Method)
+	assert.Equal(t, "90000", results[0].Invoice.TotalAmount.String())
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// Confidence levels for statement extraction
+const (
+	ConfidenceStatementText   = 0.85
+	ConfidenceStatementVision = 0.75
+)
+
+// StatementResult is the extraction result for a bank statement
+type StatementResult struct {
+	Statement  *model.Statement `json:"statement"`
+	Method     ExtractionMethod `json:"method"`
+	Confidence float64          `json:"confidence"`
+	Warnings   []string         `json:"warnings,omitempty"`
+	Error      error            `json:"-"`
+}
+
+// ProcessStatement extracts a bank statement from a PDF or image. PDFs with a
+// text layer are read as text; scans fall back to vision. Balances that do not
+// add up are reported as warnings.
+func (p *Pipeline) ProcessStatement(ctx context.Context, data []byte, mimeType string) *StatementResult {
+	if p.llmExtractor == nil {
+		return &StatementResult{
+			Error: fmt.Errorf("LLM extractor not configured"),
+		}
+	}
+
+	var warnings []string
+	if mimeType == "application/pdf" || DetectFormat(data) == FormatPDF {
+		extracted, err := p.pdfExtractor.ExtractBytes(ctx, data)
+		switch {
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("PDF text extraction failed: %v", err))
+		case strings.TrimSpace(extracted.RawText) == "":
+			warnings = append(warnings, "PDF contains no extractable text")
+		default:
+			stmt, err := p.llmExtractor.ExtractStatementFromText(ctx, extracted.RawText)
+			if err == nil {
+				return statementResult(stmt, MethodLLMText, ConfidenceStatementText, warnings)
+			}
+			warnings = append(warnings, fmt.Sprintf("LLM text extraction failed: %v", err))
+		}
+	}
+
+	images, imageWarnings, _, err := p.visionImages(ctx, data, mimeType, p.maxVisionPages)
+	warnings = append(warnings, imageWarnings...)
+	if err != nil {
+		return &StatementResult{Error: err, Warnings: warnings}
+	}
+
+	stmt, err := p.llmExtractor.ExtractStatementFromImages(ctx, images)
+	if err != nil {
+		return &StatementResult{
+			Error:    err,
+			Warnings: append(warnings, fmt.Sprintf("LLM statement extraction failed: %v", err)),
+		}
+	}
+
+	return statementResult(stmt, MethodLLMVision, ConfidenceStatementVision, warnings)
+}
+
+func statementResult(stmt *model.Statement, method ExtractionMethod, confidence float64, warnings []string) *StatementResult {
+	if err := stmt.CheckBalances(); err != nil {
+		warnings = append(warnings, fmt.Sprintf("balances do not reconcile: %v", err))
+	}
+	if len(stmt.LowConfidenceFields) > 0 {
+		warnings = append(warnings, fmt.Sprintf("low confidence fields: %s", strings.Join(stmt.LowConfidenceFields, ", ")))
+	}
+
+	return &StatementResult{
+		Statement:  stmt,
+		Method:     method,
+		Confidence: confidence,
+		Warnings:   warnings,
+	}
+}
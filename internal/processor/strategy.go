@@ -0,0 +1,240 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/parser/pdf"
+)
+
+// Strategy is a way of extracting an invoice from a PDF. ProcessPDF tries
+// the strategies of its chain in order until one returns an invoice.
+type Strategy string
+
+const (
+	// StrategyEmbeddedXML parses an XML invoice embedded in the PDF, as
+	// hybrid e-invoices carry one; no LLM is needed
+	StrategyEmbeddedXML Strategy = "embedded_xml"
+
+	// StrategyText reads the text layer with a layout template, the LLM or,
+	// without an LLM, label rules
+	StrategyText Strategy = "text"
+
+	// StrategyVision renders the pages for the vision model. It is skipped
+	// without an LLM.
+	StrategyVision Strategy = "vision"
+)
+
+// DefaultStrategies reads the text layer, falling back to vision for scans
+var DefaultStrategies = []Strategy{StrategyText, StrategyVision}
+
+// WithStrategies sets the strategy chain of PDFs (default:
+// DefaultStrategies), e.g. vision first for photographed receipts saved as
+// PDF, or text only for providers whose PDFs are always digital. With
+// WithEnsemble or WithRace, text and vision run together where the first of
+// them is in the chain.
+func WithStrategies(strategies ...Strategy) PipelineOption {
+	return func(p *Pipeline) {
+		p.strategies = strategies
+	}
+}
+
+// ParseStrategies parses a comma-separated strategy chain, such as
+// "embedded_xml,text"
+func ParseStrategies(s string) ([]Strategy, error) {
+	var strategies []Strategy
+	for _, name := range strings.Split(s, ",") {
+		strategy := Strategy(strings.TrimSpace(name))
+		switch strategy {
+		case StrategyEmbeddedXML, StrategyText, StrategyVision:
+		default:
+			return nil, fmt.Errorf("unknown extraction strategy %q (embedded_xml, text, vision)", name)
+		}
+		if slices.Contains(strategies, strategy) {
+			return nil, fmt.Errorf("extraction strategy %q listed twice", strategy)
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+type strategiesKey struct{}
+
+// ContextWithStrategies overrides the strategy chain for the documents
+// processed with ctx (see ProcessOptions.Strategies)
+func ContextWithStrategies(ctx context.Context, strategies ...Strategy) context.Context {
+	return context.WithValue(ctx, strategiesKey{}, strategies)
+}
+
+// strategyChain returns the strategies for the document of ctx
+func (p *Pipeline) strategyChain(ctx context.Context) []Strategy {
+	if strategies, ok := ctx.Value(strategiesKey{}).([]Strategy); ok && len(strategies) > 0 {
+		return strategies
+	}
+	if len(p.strategies) > 0 {
+		return p.strategies
+	}
+	return DefaultStrategies
+}
+
+// strategyAttempt is the result of a strategy that found no invoice
+type strategyAttempt struct {
+	strategy Strategy
+	result   *Result
+}
+
+// runStrategies tries the strategy chain on a PDF in order, returning the
+// first invoice found
+func (p *Pipeline) runStrategies(ctx context.Context, pdfData []byte, mimeType string) *Result {
+	var attempts []strategyAttempt
+	done := map[Strategy]bool{}
+	for _, strategy := range p.strategyChain(ctx) {
+		if done[strategy] {
+			continue
+		}
+		done[strategy] = true
+
+		switch strategy {
+		case StrategyEmbeddedXML:
+			result := p.tryEmbeddedXML(ctx, pdfData)
+			if result.Invoice != nil && result.Error == nil {
+				return result
+			}
+			attempts = append(attempts, strategyAttempt{strategy, result})
+
+		case StrategyText, StrategyVision:
+			if p.llmExtractor == nil && strategy == StrategyVision {
+				continue
+			}
+			if p.ensemble && p.llmExtractor != nil && slices.Contains(p.strategyChain(ctx), otherPath(strategy)) {
+				// Run both paths and merge them field by field
+				done[otherPath(strategy)] = true
+				textResult, visionResult := p.tryEnsembleExtraction(ctx, pdfData, mimeType)
+				if errors.Is(textResult.Error, ErrSkipped) {
+					return textResult
+				}
+				if merged := mergeResults(textResult, visionResult); merged != nil {
+					return merged
+				}
+				attempts = append(attempts, strategyAttempt{StrategyText, textResult}, strategyAttempt{StrategyVision, visionResult})
+				continue
+			}
+			if p.race && p.llmExtractor != nil && slices.Contains(p.strategyChain(ctx), otherPath(strategy)) {
+				// Run both paths and keep the first valid invoice
+				done[otherPath(strategy)] = true
+				winner, raced := p.raceExtraction(ctx, pdfData, mimeType, strategy)
+				if winner != nil {
+					return winner
+				}
+				for _, a := range raced {
+					if a.result.Invoice != nil && a.result.Error == nil {
+						return a.result
+					}
+				}
+				attempts = append(attempts, raced...)
+				continue
+			}
+
+			var result *Result
+			if strategy == StrategyText {
+				result = p.tryLLMTextExtraction(ctx, pdfData)
+			} else {
+				result = p.tryLLMVisionExtraction(ctx, pdfData, mimeType)
+			}
+			if (result.Invoice != nil && result.Error == nil) || errors.Is(result.Error, ErrSkipped) {
+				return result
+			}
+			attempts = append(attempts, strategyAttempt{strategy, result})
+
+		default:
+			attempts = append(attempts, strategyAttempt{strategy, &Result{Error: fmt.Errorf("unknown extraction strategy %q", strategy)}})
+		}
+	}
+	return p.strategiesFailed(attempts)
+}
+
+// otherPath returns vision for text and text for vision
+func otherPath(strategy Strategy) Strategy {
+	if strategy == StrategyText {
+		return StrategyVision
+	}
+	return StrategyText
+}
+
+// strategiesFailed returns the error of a PDF no strategy found an invoice in
+func (p *Pipeline) strategiesFailed(attempts []strategyAttempt) *Result {
+	if len(attempts) == 0 {
+		return &Result{Error: fmt.Errorf("PDF extraction failed: no extraction strategy applies")}
+	}
+
+	var warnings []string
+	var errs []string
+	for _, a := range attempts {
+		warnings = append(warnings, a.result.Warnings...)
+		if a.result.Error != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", a.strategy, a.result.Error))
+		}
+	}
+
+	switch {
+	case len(attempts) == 1 && attempts[0].result.Error != nil:
+		if p.llmExtractor == nil && attempts[0].strategy == StrategyText {
+			return &Result{Error: fmt.Errorf("PDF extraction without an LLM failed: %w", attempts[0].result.Error), Warnings: warnings}
+		}
+		return &Result{Error: fmt.Errorf("PDF extraction failed: %w", attempts[0].result.Error), Warnings: warnings}
+	case len(errs) > 0:
+		return &Result{Error: fmt.Errorf("PDF extraction failed (%s)", strings.Join(errs, ", ")), Warnings: warnings}
+	default:
+		return &Result{Error: fmt.Errorf("PDF extraction failed"), Warnings: warnings}
+	}
+}
+
+// tryEmbeddedXML parses the first XML invoice embedded in a PDF
+func (p *Pipeline) tryEmbeddedXML(ctx context.Context, pdfData []byte) *Result {
+	var attachments []pdf.Attachment
+	err := p.runStage(ctx, StagePDFText, func(ctx context.Context) (err error) {
+		attachments, err = p.pdfExtractor.ExtractAttachments(ctx, pdfData)
+		return err
+	})
+	if err != nil {
+		return &Result{
+			Error:    err,
+			Warnings: []string{fmt.Sprintf("PDF attachment extraction failed: %v", err)},
+		}
+	}
+
+	var parseErrors []string
+	for _, a := range attachments {
+		if !strings.EqualFold(filepath.Ext(a.Name), ".xml") && DetectFormat(a.Data) != FormatXML {
+			continue
+		}
+		var inv *model.Invoice
+		err := p.runStage(ctx, StageXMLParse, func(ctx context.Context) (err error) {
+			inv, err = p.xmlRegistry.Parse(ctx, a.Data)
+			return err
+		})
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Sprintf("%s: %v", a.Name, err))
+			continue
+		}
+		return &Result{
+			Invoice:    inv,
+			Method:     MethodXML,
+			Confidence: 1.0, // XML is deterministic
+			Source:     a.Name,
+		}
+	}
+
+	if len(parseErrors) > 0 {
+		return &Result{
+			Error:    fmt.Errorf("no embedded XML invoice could be parsed"),
+			Warnings: []string{fmt.Sprintf("embedded XML parsing failed: %s", strings.Join(parseErrors, "; "))},
+		}
+	}
+	return &Result{Error: fmt.Errorf("PDF has no embedded XML invoice")}
+}
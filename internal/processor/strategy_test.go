@@ -0,0 +1,117 @@
+package processor_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// buildPDF returns a one-page PDF with files embedded as attachments
+func buildPDF(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	if len(files) == 0 {
+		return buf.Bytes()
+	}
+
+	dir := t.TempDir()
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		paths = append(paths, path)
+	}
+	var out bytes.Buffer
+	require.NoError(t, api.AddAttachments(bytes.NewReader(buf.Bytes()), &out, paths, false, nil))
+	return out.Bytes()
+}
+
+func TestStrategies_EmbeddedXML(t *testing.T) {
+	p, provider := newStubPipeline(`{"invoice_number":"9999999"}`)
+	data := buildPDF(t, map[string]string{"readme.txt": "not an invoice", "invoice.xml": processXML})
+
+	ctx := processor.ContextWithStrategies(context.Background(), processor.StrategyEmbeddedXML, processor.StrategyText)
+	result := p.ProcessPDF(ctx, nil, data, "application/pdf")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodXML, result.Method)
+	assert.Equal(t, "0000042", result.Invoice.Number)
+	assert.Equal(t, "invoice.xml", result.Source)
+	assert.Empty(t, provider.requests, "no LLM call")
+
+	// Through Process, per request
+	results := p.Process(context.Background(), data, processor.ProcessOptions{Strategies: []processor.Strategy{processor.StrategyEmbeddedXML}})
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, processor.MethodXML, results[0].Method)
+}
+
+func TestStrategies_EmbeddedXMLMissing(t *testing.T) {
+	p := processor.NewPipeline(processor.WithStrategies(processor.StrategyEmbeddedXML))
+
+	result := p.ProcessPDF(context.Background(), nil, buildPDF(t, nil), "application/pdf")
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "no embedded XML invoice")
+}
+
+func TestStrategies_Order(t *testing.T) {
+	// The data is not a PDF, so the text layer can't be read and vision
+	// sends it as is
+	image := []byte("jpeg")
+
+	p, provider := newStubPipeline(`{"invoice_number":"0000042"}`)
+	result := p.ProcessPDF(processor.ContextWithStrategies(context.Background(), processor.StrategyVision, processor.StrategyText), nil, image, "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMVision, result.Method)
+	assert.Len(t, provider.requests, 1)
+	for _, w := range result.Warnings {
+		assert.NotContains(t, w, "text extraction", "text was never tried")
+	}
+
+	result = p.ProcessPDF(context.Background(), nil, image, "image/jpeg")
+	require.NoError(t, result.Error)
+	assert.Equal(t, processor.MethodLLMVision, result.Method, "default chain falls back to vision")
+
+	provider.requests = nil
+	textOnly := processor.ContextWithStrategies(context.Background(), processor.StrategyText)
+	result = p.ProcessPDF(textOnly, nil, image, "image/jpeg")
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "PDF extraction failed")
+	assert.Empty(t, provider.requests)
+}
+
+func TestParseStrategies(t *testing.T) {
+	strategies, err := processor.ParseStrategies("embedded_xml, text,vision")
+	require.NoError(t, err)
+	assert.Equal(t, []processor.Strategy{processor.StrategyEmbeddedXML, processor.StrategyText, processor.StrategyVision}, strategies)
+
+	_, err = processor.ParseStrategies("text,ocr")
+	assert.Error(t, err)
+	_, err = processor.ParseStrategies("text,text")
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+)
+
+// ErrUnknownTenant is the error of documents processed for a tenant the
+// pipeline has no settings for (see WithTenants)
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Tenant holds the settings of a client company whose documents go through a
+// pipeline shared with others. Zero fields keep the pipeline's settings.
+type Tenant struct {
+	Prompts    llm.PromptSet // Overrides of the extraction prompts (see llm.ContextWithPrompts)
+	Models     llm.Models    // Primary text and vision models; the fallbacks still apply
+	Strategies []Strategy    // Strategy chain of PDFs (see WithStrategies)
+
+	// ValidationRules replace the rules of the validation stage
+	ValidationRules []ValidationRule
+}
+
+// WithTenants sets the tenants documents can be processed for, by ID (see
+// ContextWithTenant). Their idempotency keys and invoice fingerprints are
+// kept apart in the shared stores, so tenants never see each other's results
+// or duplicates. Documents of other tenants fail with
+// ErrUnknownTenant; those without a tenant use the pipeline's settings.
+func WithTenants(tenants map[string]Tenant) PipelineOption {
+	return func(p *Pipeline) {
+		p.tenants = tenants
+	}
+}
+
+// WithDefaultTenant processes the documents whose context names no tenant
+// for tenant, such as those of a connector dedicated to one client company
+func WithDefaultTenant(tenant string) PipelineOption {
+	return func(p *Pipeline) {
+		p.defaultTenant = tenant
+	}
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant processes the documents of ctx for tenant (see
+// WithTenants and ProcessOptions.Tenant)
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by ContextWithTenant, or ""
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Tenants returns the IDs of the tenants set with WithTenants, sorted
+func (p *Pipeline) Tenants() []string {
+	return slices.Sorted(maps.Keys(p.tenants))
+}
+
+// HasTenant reports whether documents can be processed for tenant
+func (p *Pipeline) HasTenant(tenant string) bool {
+	if tenant == "" {
+		return true
+	}
+	_, ok := p.tenants[tenant]
+	return ok
+}
+
+// withTenant applies the settings of the tenant of ctx, leaving those the
+// caller set in ctx. Documents of an unknown tenant get a context canceled
+// with ErrUnknownTenant.
+func (p *Pipeline) withTenant(ctx context.Context) context.Context {
+	id := p.tenantOf(ctx)
+	if id == "" {
+		return ctx
+	}
+	ctx = ContextWithTenant(ctx, id)
+	tenant, ok := p.tenants[id]
+	if !ok {
+		ctx, cancel := context.WithCancelCause(ctx)
+		cancel(fmt.Errorf("%w %q", ErrUnknownTenant, id))
+		return ctx
+	}
+
+	ctx = llm.ContextWithPrompts(ctx, tenant.Prompts)
+	if llm.ModelsFromContext(ctx) == (llm.Models{}) {
+		ctx = llm.ContextWithModels(ctx, tenant.Models)
+	}
+	if _, ok := ctx.Value(strategiesKey{}).([]Strategy); !ok && len(tenant.Strategies) > 0 {
+		ctx = ContextWithStrategies(ctx, tenant.Strategies...)
+	}
+	return ctx
+}
+
+// tenantOf returns the tenant the document of ctx is processed for
+func (p *Pipeline) tenantOf(ctx context.Context) string {
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		return tenant
+	}
+	return p.defaultTenant
+}
+
+// unknownTenant returns the error of a document whose tenant has no
+// settings, or nil
+func unknownTenant(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrUnknownTenant) {
+		return cause
+	}
+	return nil
+}
+
+// validationRulesFor returns the rules of the tenant of ctx
+func (p *Pipeline) validationRulesFor(ctx context.Context) []ValidationRule {
+	if tenant, ok := p.tenants[TenantFromContext(ctx)]; ok && tenant.ValidationRules != nil {
+		return tenant.ValidationRules
+	}
+	return p.validationRules
+}
+
+// tenantScoped prefixes key with tenant, keeping the keys of tenants apart
+// in shared stores
+func tenantScoped(tenant, key string) string {
+	if tenant != "" {
+		return tenant + "/" + key
+	}
+	return key
+}
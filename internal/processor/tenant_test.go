@@ -0,0 +1,111 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestTenants_ModelsAndPrompts(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"0000042","total_amount":110000}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(
+		processor.WithLLMExtractor(llm.NewExtractor(client, llm.WithVisionModel("shared-vision"))),
+		processor.WithTenants(map[string]processor.Tenant{
+			"acme": {
+				Models:  llm.Models{Vision: "acme-vision"},
+				Prompts: llm.PromptSet{SystemInvoice: "You read Acme's invoices.", SystemReceipt: "You read Acme's invoices."},
+			},
+		}),
+	)
+	assert.Equal(t, []string{"acme"}, p.Tenants())
+
+	result := p.ProcessImage(processor.ContextWithTenant(context.Background(), "acme"), []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	assert.Equal(t, "acme", result.Tenant)
+
+	result = p.ProcessImage(context.Background(), []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	assert.Empty(t, result.Tenant)
+
+	require.Len(t, provider.requests, 2)
+	assert.Equal(t, "acme-vision", provider.requests[0].Model)
+	assert.Equal(t, "You read Acme's invoices.", provider.requests[0].SystemPrompt)
+	assert.Equal(t, "shared-vision", provider.requests[1].Model, "documents without a tenant keep the pipeline's settings")
+	assert.NotEqual(t, "You read Acme's invoices.", provider.requests[1].SystemPrompt)
+}
+
+func TestTenants_ValidationRules(t *testing.T) {
+	requirePO := processor.ValidationRule{Name: "po", Check: func(*model.Invoice) []processor.ValidationFinding {
+		return []processor.ValidationFinding{{Message: "purchase order number missing", Severity: processor.SeverityWarning}}
+	}}
+	p := processor.NewPipeline(processor.WithTenants(map[string]processor.Tenant{
+		"acme":   {ValidationRules: []processor.ValidationRule{requirePO}},
+		"globex": {},
+	}))
+
+	result := p.ProcessXMLBytes(processor.ContextWithTenant(context.Background(), "acme"), []byte(processXML))
+	require.NoError(t, result.Error)
+	require.Len(t, result.Findings, 1)
+	assert.Equal(t, "po", result.Findings[0].Rule)
+
+	result = p.ProcessXMLBytes(processor.ContextWithTenant(context.Background(), "globex"), []byte(processXML))
+	require.NoError(t, result.Error)
+	for _, f := range result.Findings {
+		assert.NotEqual(t, "po", f.Rule)
+	}
+}
+
+func TestTenants_Unknown(t *testing.T) {
+	p := processor.NewPipeline(processor.WithTenants(map[string]processor.Tenant{"acme": {}}))
+	assert.True(t, p.HasTenant("acme"))
+	assert.False(t, p.HasTenant("initech"))
+
+	results := p.Process(context.Background(), []byte(processXML), processor.ProcessOptions{Filename: "invoice.xml", Tenant: "initech"})
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Error, processor.ErrUnknownTenant)
+	assert.Equal(t, "tenant", processor.ErrorClass(results[0].Error))
+}
+
+func TestTenants_SeparateIdempotencyKeys(t *testing.T) {
+	p := processor.NewPipeline(
+		processor.WithIdempotency(processor.NewMemoryIdempotencyStore()),
+		processor.WithDuplicateStore(processor.NewMemoryDuplicateStore()),
+		processor.WithTenants(map[string]processor.Tenant{"acme": {}, "globex": {}}),
+	)
+	process := func(tenant string) *processor.Result {
+		results := p.Process(context.Background(), []byte(processXML), processor.ProcessOptions{Filename: "invoice.xml", Tenant: tenant})
+		require.Len(t, results, 1)
+		require.NoError(t, results[0].Error)
+		return results[0]
+	}
+
+	assert.False(t, process("acme").IdempotentReplay)
+	assert.True(t, process("acme").IdempotentReplay)
+
+	globex := process("globex")
+	assert.False(t, globex.IdempotentReplay, "tenants don't share results")
+	assert.False(t, globex.Duplicate, "nor duplicates")
+}
+
+func TestWithDefaultTenant(t *testing.T) {
+	tenants := processor.WithTenants(map[string]processor.Tenant{"acme": {}, "globex": {}})
+	p := processor.NewPipeline(tenants, processor.WithDefaultTenant("acme"))
+
+	result := p.ProcessXMLBytes(context.Background(), []byte(processXML))
+	require.NoError(t, result.Error)
+	assert.Equal(t, "acme", result.Tenant)
+
+	result = p.ProcessXMLBytes(processor.ContextWithTenant(context.Background(), "globex"), []byte(processXML))
+	require.NoError(t, result.Error)
+	assert.Equal(t, "globex", result.Tenant, "the context wins")
+
+	p = processor.NewPipeline(tenants, processor.WithDefaultTenant("initech"))
+	assert.ErrorIs(t, p.ProcessXMLBytes(context.Background(), []byte(processXML)).Error, processor.ErrUnknownTenant)
+}
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // Register PNG for image.Decode
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// TilingOptions controls how tall images such as thermal receipts are split
+// into overlapping tiles so the vision model sees them at full resolution
+type TilingOptions struct {
+	MinAspect  float64 // Images taller than MinAspect times their width are tiled; 0 disables tiling
+	TileAspect float64 // Tile height as a multiple of the image width
+	Overlap    float64 // Fraction of each tile repeated at the top of the next
+	MaxTiles   int     // Tiles are made taller when more would be needed
+}
+
+// DefaultTilingOptions returns the tiling used unless WithTiling overrides it
+func DefaultTilingOptions() TilingOptions {
+	return TilingOptions{
+		MinAspect:  3.0,
+		TileAspect: 1.5,
+		Overlap:    0.15,
+		MaxTiles:   6,
+	}
+}
+
+// WithTiling configures tall image tiling in the vision path
+func WithTiling(opts TilingOptions) PipelineOption {
+	return func(p *Pipeline) {
+		p.tiling = opts
+	}
+}
+
+// tileImage splits a tall image into overlapping JPEG tiles, top to bottom.
+// It returns nil when the image is not tall enough or cannot be decoded.
+func tileImage(data []byte, opts TilingOptions) [][]byte {
+	if opts.MinAspect <= 0 {
+		return nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || float64(cfg.Height) <= float64(cfg.Width)*opts.MinAspect {
+		return nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	tileHeight := int(float64(width) * opts.TileAspect)
+	if opts.MaxTiles > 1 {
+		// Tiles needed so that (n-1) steps plus one tile cover the image
+		minHeight := int(float64(height)/(float64(opts.MaxTiles-1)*(1-opts.Overlap)+1)) + 1
+		tileHeight = max(tileHeight, minHeight)
+	}
+	step := max(int(float64(tileHeight)*(1-opts.Overlap)), 1)
+
+	var tiles [][]byte
+	for y := 0; ; y += step {
+		end := min(y+tileHeight, height)
+		rect := image.Rect(bounds.Min.X, bounds.Min.Y+y, bounds.Max.X, bounds.Min.Y+end)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, sub.SubImage(rect), &jpeg.Options{Quality: 90}); err != nil {
+			return nil
+		}
+		tiles = append(tiles, buf.Bytes())
+
+		if end == height {
+			break
+		}
+	}
+	return tiles
+}
+
+// extractVision runs extract on images, tiling a single tall image first and
+// extracting more pages than WithMaxVisionPages in groups
+func (p *Pipeline) extractVision(ctx context.Context, images []llm.Image, extract func(context.Context, []llm.Image) (*model.Invoice, error)) (*model.Invoice, []string, error) {
+	if p.maxVisionPages > 0 && len(images) > p.maxVisionPages {
+		return p.extractPages(ctx, images, extract)
+	}
+	if len(images) == 1 {
+		if tiles := tileImage(images[0].Data, p.tiling); len(tiles) > 1 {
+			return p.extractTiled(ctx, tiles, extract)
+		}
+	}
+	inv, err := extract(ctx, images)
+	return inv, nil, err
+}
+
+// extractTiled extracts each tile and stitches the results. The first tile
+// decides the document type; later tiles are read as that type, because a
+// tile showing only line items would otherwise not look like a document.
+func (p *Pipeline) extractTiled(ctx context.Context, tiles [][]byte, extract func(context.Context, []llm.Image) (*model.Invoice, error)) (*model.Invoice, []string, error) {
+	first, err := extract(ctx, []llm.Image{{Data: tiles[0], MimeType: "image/jpeg"}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rest := p.llmExtractor.ExtractFromImages
+	if first.DocumentType == model.DocumentTypeReceipt {
+		rest = p.llmExtractor.ExtractReceiptFromImages
+	}
+
+	invoices := make([]*model.Invoice, len(tiles))
+	errs := make([]error, len(tiles))
+	invoices[0] = first
+
+	var wg sync.WaitGroup
+	for i := 1; i < len(tiles); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			invoices[i], errs[i] = rest(ctx, []llm.Image{{Data: tiles[i], MimeType: "image/jpeg"}})
+		}(i)
+	}
+	wg.Wait()
+
+	warnings := []string{fmt.Sprintf("tall image split into %d tiles for vision extraction", len(tiles))}
+	var parts []*model.Invoice
+	for i, inv := range invoices {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("tile %d extraction failed: %v", i+1, errs[i]))
+			continue
+		}
+		parts = append(parts, inv)
+	}
+
+	stitched := stitchTiles(parts)
+	if len(parts) < len(tiles) {
+		stitched.LowConfidenceFields = appendUnique(stitched.LowConfidenceFields, "items")
+	}
+	return stitched, warnings, nil
+}
+
+// stitchTiles combines invoices read from consecutive tiles of one document.
+// Header fields come from the first tile that has them and totals from the
+// last, since both are printed at the ends of a receipt. Line items repeated
+// in the overlap between tiles are kept once.
+func stitchTiles(parts []*model.Invoice) *model.Invoice {
+	stitched := *parts[0]
+	stitched.Items = append([]model.LineItem(nil), parts[0].Items...)
+	stitched.HandwrittenFields = slices.Clone(parts[0].HandwrittenFields)
+	stitched.Corrections = slices.Clone(parts[0].Corrections)
+	stitched.FieldLocations = nil // Boxes are relative to a tile, not the original image
+	var conflicts []string
+
+	for _, part := range parts[1:] {
+		mergeString(&conflicts, "number", &stitched.Number, part.Number)
+		mergeString(&conflicts, "series", &stitched.Series, part.Series)
+		mergeParty(&conflicts, "seller", &stitched.Seller, part.Seller)
+		mergeParty(&conflicts, "buyer", &stitched.Buyer, part.Buyer)
+		mergeString(&conflicts, "currency", &stitched.Currency, part.Currency)
+		mergeString(&conflicts, "receipt_number", &stitched.ReceiptNumber, part.ReceiptNumber)
+		mergeString(&conflicts, "cashier", &stitched.Cashier, part.Cashier)
+		mergeString(&conflicts, "terminal_id", &stitched.TerminalID, part.TerminalID)
+		mergeString(&conflicts, "receipt_time", &stitched.ReceiptTime, part.ReceiptTime)
+		mergeString(&conflicts, "payment_method", &stitched.PaymentMethod, part.PaymentMethod)
+		if stitched.Date.IsZero() {
+			stitched.Date = part.Date
+		}
+
+		// Bottom tiles hold the printed totals
+		overrideDecimal(&stitched.SubtotalAmount, part.SubtotalAmount)
+		overrideDecimal(&stitched.TaxAmount, part.TaxAmount)
+		overrideDecimal(&stitched.TotalAmount, part.TotalAmount)
+		overrideDecimal(&stitched.AmountTendered, part.AmountTendered)
+		overrideDecimal(&stitched.Change, part.Change)
+
+		overlap := itemOverlap(stitched.Items, part.Items)
+		stitched.Items = append(stitched.Items, part.Items[overlap:]...)
+		stitched.LowConfidenceFields = appendUnique(stitched.LowConfidenceFields, part.LowConfidenceFields...)
+		stitched.HandwrittenFields = appendUnique(stitched.HandwrittenFields, part.HandwrittenFields...)
+		stitched.HasHandwriting = stitched.HasHandwriting || part.HasHandwriting
+		stitched.Corrections = append(stitched.Corrections, part.Corrections...)
+	}
+
+	for i := range stitched.Items {
+		stitched.Items[i].Number = i + 1
+	}
+	stitched.TaxBreakdown = model.SummarizeVAT(stitched.Items)
+	stitched.LowConfidenceFields = appendUnique(stitched.LowConfidenceFields, conflicts...)
+
+	return &stitched
+}
+
+// overrideDecimal replaces dst with a non-zero value from a later tile
+func overrideDecimal(dst *decimal.Decimal, later decimal.Decimal) {
+	if !later.IsZero() {
+		*dst = later
+	}
+}
+
+// itemOverlap returns how many leading items of next repeat the trailing items of prev
+func itemOverlap(prev, next []model.LineItem) int {
+	for k := min(len(prev), len(next)); k > 0; k-- {
+		if slices.EqualFunc(prev[len(prev)-k:], next[:k], sameItem) {
+			return k
+		}
+	}
+	return 0
+}
+
+// sameItem compares the fields a model reads consistently from a printed line
+func sameItem(a, b model.LineItem) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a.Name), " "), strings.Join(strings.Fields(b.Name), " ")) &&
+		a.Quantity.Equal(b.Quantity) &&
+		a.Total.Add(a.Amount).Equal(b.Total.Add(b.Amount))
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestTileImage(t *testing.T) {
+	opts := DefaultTilingOptions()
+
+	assert.Nil(t, tileImage(encodePNG(t, 100, 250), opts), "short images are not tiled")
+	assert.Nil(t, tileImage([]byte("not an image"), opts))
+	assert.Nil(t, tileImage(encodePNG(t, 100, 1000), TilingOptions{}), "tiling disabled")
+
+	tiles := tileImage(encodePNG(t, 100, 400), opts)
+	require.Len(t, tiles, 3) // 150px tiles every 127px
+	for _, tile := range tiles {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(tile))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 100, cfg.Width)
+	}
+
+	assert.Len(t, tileImage(encodePNG(t, 100, 5000), opts), opts.MaxTiles, "tiles grow instead of exceeding MaxTiles")
+}
+
+func TestStitchTiles(t *testing.T) {
+	item := func(name string, total int64) model.LineItem {
+		return model.LineItem{Name: name, Quantity: decimal.NewFromInt(1), Total: decimal.NewFromInt(total)}
+	}
+
+	top := &model.Invoice{
+		DocumentType: model.DocumentTypeReceipt,
+		Seller:       model.Party{Name: "Circle K"},
+		Items:        []model.LineItem{item("Nước suối", 10000), item("Bánh mì", 20000)},
+		TotalAmount:  decimal.NewFromInt(30000), // Running subtotal misread as a total
+	}
+	middle := &model.Invoice{
+		Items: []model.LineItem{item("Bánh  mì", 20000), item("Cà phê", 25000)},
+	}
+	bottom := &model.Invoice{
+		ReceiptNumber: "R-9",
+		Items:         []model.LineItem{item("Cà phê", 25000), item("Cà phê", 25000)},
+		TotalAmount:   decimal.NewFromInt(80000),
+		PaymentMethod: "cash",
+	}
+
+	stitched := stitchTiles([]*model.Invoice{top, middle, bottom})
+
+	assert.Equal(t, "Circle K", stitched.Seller.Name)
+	assert.Equal(t, "R-9", stitched.ReceiptNumber)
+	assert.Equal(t, "cash", stitched.PaymentMethod)
+	assert.Equal(t, "80000", stitched.TotalAmount.String())
+
+	require.Len(t, stitched.Items, 4, "overlapping lines are kept once, repeated purchases twice")
+	assert.Equal(t, []string{"Nước suối", "Bánh mì", "Cà phê", "Cà phê"},
+		[]string{stitched.Items[0].Name, stitched.Items[1].Name, stitched.Items[2].Name, stitched.Items[3].Name})
+	assert.Equal(t, 4, stitched.Items[3].Number)
+	assert.Len(t, top.Items, 2, "tiles are not modified")
+}
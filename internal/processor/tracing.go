@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+// WithTracer traces every document in a span ("pipeline.pdf", "pipeline.xml",
+// ...) with a child span per stage (see Stage). The tracer is passed on in
+// the context, so PDF rendering, external tools and LLM calls nest below.
+// A tracer already in the caller's context (tracing.ContextWithTracer) takes
+// precedence.
+func WithTracer(t tracing.Tracer) PipelineOption {
+	return func(p *Pipeline) {
+		p.tracer = t
+	}
+}
+
+// startDocument starts the span of a document processed by a public method,
+// and gives it a correlation ID unless the caller's context has one. The
+// document is in flight (see Pipeline.Stop) until the span ends.
+func (p *Pipeline) startDocument(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	if tracing.TracerFromContext(ctx) == nil {
+		ctx = tracing.ContextWithTracer(ctx, p.tracer)
+	}
+	if logging.LoggerFromContext(ctx) == nil {
+		ctx = logging.ContextWithLogger(ctx, p.logger)
+	}
+	ctx = logging.EnsureCorrelationID(ctx)
+	ctx = p.withRetryBudget(ctx)
+	ctx = p.withDeadline(ctx)
+	ctx = p.withDebug(ctx)
+	ctx = p.withCallLog(ctx)
+
+	attrs = append(attrs, tracing.String("correlation.id", logging.CorrelationID(ctx)))
+	doc := llm.DocumentIDFromContext(ctx)
+	if doc != "" {
+		attrs = append(attrs, tracing.String("document.id", doc))
+	}
+	ctx = p.withTenant(ctx)
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		attrs = append(attrs, tracing.String("tenant.id", tenant))
+	}
+	ctx = p.withBudget(ctx)
+	logging.Debug(ctx, "document started", "path", name, "document_id", doc)
+	ctx, span := tracing.Start(ctx, "pipeline."+name, attrs...)
+	ctx, leave := p.lifecycle.enter(ctx)
+	return ctx, documentSpan{Span: span, leave: leave}
+}
+
+// stageRun is a running stage, timed for the metrics and traced
+type stageRun struct {
+	ctx   context.Context
+	p     *Pipeline
+	stage Stage
+	start time.Time
+	span  tracing.Span
+}
+
+// startStage starts a stage. Work of the stage is done with the returned
+// context so its spans nest under the stage.
+func (p *Pipeline) startStage(ctx context.Context, stage Stage) (context.Context, *stageRun) {
+	logging.Debug(ctx, "stage started", "stage", stage)
+	ctx, span := tracing.Start(ctx, "pipeline."+string(stage))
+	return ctx, &stageRun{ctx: ctx, p: p, stage: stage, start: time.Now(), span: span}
+}
+
+// end finishes the stage, failed when err is set
+func (r *stageRun) end(err error) {
+	r.p.observeStage(r.stage, r.start, err)
+	if err != nil {
+		class := ErrorClass(err)
+		r.span.SetAttributes(tracing.String("error.class", class))
+		logging.Warn(r.ctx, "stage failed", "stage", r.stage, "duration", time.Since(r.start), "class", class, "error", err)
+	} else {
+		logging.Debug(r.ctx, "stage finished", "stage", r.stage, "duration", time.Since(r.start))
+	}
+	tracing.End(r.span, err)
+}
+
+// recordResult stamps a finished document with its correlation ID and
+// records its outcome on its span and in the log
+func recordResult(ctx context.Context, result *Result) {
+	result.CorrelationID = logging.CorrelationID(ctx)
+	result.Tenant = TenantFromContext(ctx)
+	span := tracing.SpanFromContext(ctx)
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		logging.Warn(ctx, "document failed", "source", result.Source, "error", result.Error, "warnings", result.Warnings)
+		return
+	}
+	logging.Info(ctx, "document processed", "source", result.Source, "method", result.Method,
+		"confidence", result.Confidence, "warnings", len(result.Warnings), "duplicate", result.Duplicate)
+	span.SetAttributes(
+		tracing.String("invoice.method", string(result.Method)),
+		tracing.Float64("invoice.confidence", result.Confidence),
+		tracing.Int("invoice.warnings", len(result.Warnings)),
+		tracing.Bool("invoice.duplicate", result.Duplicate),
+	)
+}
+
+// WithLogger logs document and stage transitions, failures with their error
+// class, and (passed on in the context) LLM calls and retries. Each document
+// gets a correlation ID, logged with every record and returned in
+// Result.CorrelationID; set one with logging.ContextWithCorrelationID to
+// reuse a request ID. A logger already in the caller's context takes
+// precedence.
+func WithLogger(l logging.Logger) PipelineOption {
+	return func(p *Pipeline) {
+		p.logger = l
+	}
+}
@@ -0,0 +1,90 @@
+package processor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+type testSpan struct {
+	name   string
+	parent string
+	attrs  map[string]any
+	err    error
+}
+
+func (s *testSpan) SetAttributes(attrs ...tracing.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  {}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	span := &testSpan{name: name, attrs: map[string]any{}}
+	if parent, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (t *testTracer) span(name string) *testSpan {
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestPipeline_Tracing(t *testing.T) {
+	tracer := &testTracer{}
+	provider := &stubProvider{content: `{"receipt_number":"R-17","date":"2024-03-15","total_amount":45000}`}
+	client := llm.NewClient("", llm.WithProvider(provider))
+	p := processor.NewPipeline(processor.WithLLMExtractor(llm.NewExtractor(client)), processor.WithTracer(tracer))
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "scan-17.jpg")
+	require.NoError(t, p.ProcessReceipt(ctx, []byte("jpeg"), "image/jpeg").Error)
+
+	doc := tracer.span("pipeline.receipt")
+	require.NotNil(t, doc)
+	assert.Equal(t, "scan-17.jpg", doc.attrs["document.id"])
+	assert.Equal(t, "llm_vision", doc.attrs["invoice.method"])
+	assert.Equal(t, 0.74, doc.attrs["invoice.confidence"])
+
+	assert.Equal(t, "pipeline.receipt", tracer.span("pipeline.llm_vision").parent)
+	assert.Equal(t, "pipeline.receipt", tracer.span("pipeline.postprocess").parent)
+
+	call := tracer.span("llm.complete")
+	require.NotNil(t, call, "the tracer reaches the LLM client through the context")
+	assert.Equal(t, "pipeline.llm_vision", call.parent)
+	assert.Equal(t, "stub", call.attrs["gen_ai.system"])
+	assert.Equal(t, llm.ReceiptSchema.Name, call.attrs["llm.schema"])
+	assert.Equal(t, "success", call.attrs["llm.outcome"])
+
+	// Failures are recorded on the stage and the document
+	tracer.spans = nil
+	require.Error(t, p.ProcessXMLBytes(context.Background(), []byte(`<Unknown/>`)).Error)
+	assert.Error(t, tracer.span("pipeline.xml_parse").err)
+	assert.Equal(t, "parse", tracer.span("pipeline.xml_parse").attrs["error.class"])
+	assert.Error(t, tracer.span("pipeline.xml").err)
+}
@@ -0,0 +1,23 @@
+package processor
+
+import "github.com/rezonia/invoice-processor/internal/uom"
+
+// WithUnitNormalization sets the UN/ECE code of the unit of each line item
+// (LineItem.UnitCode), so quantities add up across suppliers writing "cái",
+// "Chiếc" or "pcs". It is rule-based and on by default.
+func WithUnitNormalization(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.units = nil
+		if enabled {
+			p.units = uom.NewNormalizer(nil)
+		}
+	}
+}
+
+// WithUnitMapping adds units to codes to the defaults of unit normalization
+// (uom.DefaultMapping), turning it on; an empty code unmaps a unit
+func WithUnitMapping(mapping map[string]string) PipelineOption {
+	return func(p *Pipeline) {
+		p.units = uom.NewNormalizer(mapping)
+	}
+}
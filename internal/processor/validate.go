@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// Severity grades a validation finding
+type Severity = model.Severity
+
+const (
+	SeverityWarning = model.SeverityWarning
+	SeverityError   = model.SeverityError
+)
+
+// Confidence lost per validation finding (see ScoreConfidence)
+const (
+	ValidationWarningPenalty = 0.05
+	ValidationErrorPenalty   = 0.15
+)
+
+// ValidationFinding is one problem a validation rule found in an invoice
+type ValidationFinding = model.ValidationIssue
+
+// ValidationRule checks one aspect of an extracted invoice
+type ValidationRule = model.ValidationRule
+
+// Names of the default validation rules
+const (
+	RuleRequiredFields = model.RuleRequiredFields
+	RuleTaxID          = model.RuleTaxID
+	RuleDate           = model.RuleDate
+	RuleTotals         = model.RuleTotals
+	RuleVATRate        = model.RuleVATRate
+	RuleCurrency       = model.RuleCurrency
+)
+
+// DefaultValidationRules returns the rules run after extraction unless
+// replaced with WithValidationRules: model.VietnamRules
+func DefaultValidationRules() []ValidationRule {
+	return model.VietnamRules()
+}
+
+// WithValidation turns the validation stage on or off. It is on by default:
+// findings are appended to Result.Warnings and Result.Findings and lower
+// Result.Confidence (see ScoreConfidence).
+func WithValidation(enabled bool) PipelineOption {
+	return func(p *Pipeline) {
+		p.validation = enabled
+	}
+}
+
+// WithValidationRules replaces the rules of the validation stage (default:
+// DefaultValidationRules)
+func WithValidationRules(rules ...ValidationRule) PipelineOption {
+	return func(p *Pipeline) {
+		p.validationRules = rules
+	}
+}
+
+// Validate runs rules over inv and returns their findings
+func Validate(inv *model.Invoice, rules []ValidationRule) []ValidationFinding {
+	return inv.Validate(rules)
+}
+
+// validate applies the validation stage to a successful result
+func (p *Pipeline) validate(ctx context.Context, result *Result) {
+	findings := Validate(result.Invoice, p.validationRulesFor(ctx))
+	for _, f := range findings {
+		result.Warnings = append(result.Warnings, f.String())
+	}
+	result.Findings = append(result.Findings, findings...)
+}
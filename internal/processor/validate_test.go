@@ -0,0 +1,110 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func validInvoice() *model.Invoice {
+	return &model.Invoice{
+		Number:         "0000042",
+		Date:           time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Seller:         model.Party{Name: "Công ty TNHH ABC", TaxID: "0123456787"},
+		Buyer:          model.Party{TaxID: "0312345673-001"},
+		Currency:       "VND",
+		SubtotalAmount: decimal.NewFromInt(200000),
+		TaxAmount:      decimal.NewFromInt(16000),
+		TotalAmount:    decimal.NewFromInt(216000),
+		Items: []model.LineItem{{
+			Name:      "Dịch vụ",
+			Quantity:  decimal.NewFromInt(2),
+			UnitPrice: decimal.NewFromInt(100000),
+			Amount:    decimal.NewFromInt(200000),
+			VATRate:   model.VATRate8,
+		}},
+	}
+}
+
+func findingRules(findings []processor.ValidationFinding) []string {
+	rules := make([]string, len(findings))
+	for i, f := range findings {
+		rules[i] = f.Rule + ":" + f.Field
+	}
+	return rules
+}
+
+func TestValidate_Valid(t *testing.T) {
+	assert.Empty(t, processor.Validate(validInvoice(), processor.DefaultValidationRules()))
+}
+
+func TestValidate_Findings(t *testing.T) {
+	inv := validInvoice()
+	inv.Number = ""
+	inv.Seller.TaxID = "01234"
+	inv.Date = time.Now().AddDate(1, 0, 0)
+	inv.TotalAmount = decimal.NewFromInt(226000)
+	inv.Items[0].Amount = decimal.NewFromInt(190000)
+	inv.Items[0].VATRate = model.VATPercent(7)
+
+	findings := processor.Validate(inv, processor.DefaultValidationRules())
+	assert.Equal(t, []string{
+		"required_fields:number",
+		"tax_id:seller.tax_id",
+		"date:date",
+		"totals:total_amount",
+		"totals:items[0].amount",
+		"totals:subtotal_amount",
+		"vat_rate:items[0].vat_rate",
+	}, findingRules(findings))
+	assert.Equal(t, processor.SeverityError, findings[0].Severity)
+	assert.Equal(t, processor.SeverityWarning, findings[4].Severity)
+}
+
+func TestValidate_Receipt(t *testing.T) {
+	// Receipts carry no tax ID or invoice number
+	receipt := &model.Invoice{DocumentType: model.DocumentTypeReceipt, TotalAmount: decimal.NewFromInt(45000)}
+	findings := processor.Validate(receipt, processor.DefaultValidationRules())
+	require.Len(t, findings, 1)
+	assert.Equal(t, "date", findings[0].Field)
+	assert.Equal(t, processor.SeverityWarning, findings[0].Severity)
+}
+
+func TestPipeline_ValidationStage(t *testing.T) {
+	xmlData := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456787</TaxID><Name>Công ty TNHH ABC</Name></Seller>
+	<SubtotalAmount>200000</SubtotalAmount>
+	<TaxAmount>16000</TaxAmount>
+	<TotalAmount>226000</TotalAmount>
+</Invoice>`)
+
+	result := processor.NewPipeline().ProcessXMLBytes(context.Background(), xmlData)
+	require.NoError(t, result.Error)
+	assert.Equal(t, []string{"required_fields:date", "totals:total_amount"}, findingRules(result.Findings))
+	assert.Contains(t, result.Warnings, "validation error: missing invoice date")
+	assert.InDelta(t, 1.0-2*processor.ValidationErrorPenalty, result.Confidence, 1e-9)
+
+	result = processor.NewPipeline(processor.WithValidation(false)).ProcessXMLBytes(context.Background(), xmlData)
+	assert.Empty(t, result.Findings)
+	assert.Equal(t, 1.0, result.Confidence)
+
+	// Custom rules replace the defaults
+	seriesRule := processor.ValidationRule{Name: "series", Check: func(inv *model.Invoice) []processor.ValidationFinding {
+		if inv.Series == "" {
+			return []processor.ValidationFinding{{Field: "series", Message: "missing series", Severity: processor.SeverityWarning}}
+		}
+		return nil
+	}}
+	result = processor.NewPipeline(processor.WithValidationRules(seriesRule)).ProcessXMLBytes(context.Background(), xmlData)
+	assert.Equal(t, []string{"series:series"}, findingRules(result.Findings))
+	assert.InDelta(t, 1.0-processor.ValidationWarningPenalty, result.Confidence, 1e-9)
+}
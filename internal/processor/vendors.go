@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// DefaultVendorMatchThreshold is the lowest cosine similarity accepted as a vendor match
+const DefaultVendorMatchThreshold = 0.85
+
+// Vendor is an entity in a user-supplied vendor master list
+type Vendor struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`              // Canonical name
+	TaxID   string   `json:"tax_id,omitempty"`  // Matched exactly, ignoring the branch suffix
+	Aliases []string `json:"aliases,omitempty"` // Other names the vendor is known or written under
+}
+
+// VendorMatch is the vendor an extracted seller was mapped to
+type VendorMatch struct {
+	VendorID string  `json:"vendor_id"`
+	Name     string  `json:"name"`
+	Score    float64 `json:"score"`               // Cosine similarity of the names; 1 for a tax ID match
+	ByTaxID  bool    `json:"by_tax_id,omitempty"` // Matched on the seller tax ID rather than the name
+}
+
+// VendorMatcher maps extracted sellers to canonical vendors. Match returns nil
+// when no vendor is close enough.
+type VendorMatcher interface {
+	Match(ctx context.Context, seller model.Party) (*VendorMatch, error)
+}
+
+// WithVendorMatcher maps each extracted seller to a vendor, exposed as Result.Vendor
+func WithVendorMatcher(m VendorMatcher) PipelineOption {
+	return func(p *Pipeline) {
+		p.vendorMatcher = m
+	}
+}
+
+// EmbeddingMatcher matches seller names to vendors by embedding similarity, so
+// OCR noise and spelling variants ("CTY TNHH ABC", "Công ty TNHH A.B.C") still
+// match. A seller whose tax ID is on the list matches without embedding.
+type EmbeddingMatcher struct {
+	embedder  llm.Embedder
+	vendors   []Vendor
+	threshold float64
+
+	// Vendor names are embedded on first use and kept
+	mu      sync.Mutex
+	entries []vendorEntry
+
+	// Embeddings of seller names already seen, by normalized name
+	cache sync.Map
+}
+
+// vendorEntry is the embedding of one vendor name or alias
+type vendorEntry struct {
+	vendor int
+	vector []float64
+}
+
+// EmbeddingMatcherOption configures an EmbeddingMatcher
+type EmbeddingMatcherOption func(*EmbeddingMatcher)
+
+// WithMatchThreshold sets the lowest similarity accepted as a match (default: DefaultVendorMatchThreshold)
+func WithMatchThreshold(threshold float64) EmbeddingMatcherOption {
+	return func(m *EmbeddingMatcher) {
+		m.threshold = threshold
+	}
+}
+
+// NewEmbeddingMatcher creates a matcher for vendors. Names are embedded on the
+// first Match, in one request.
+func NewEmbeddingMatcher(embedder llm.Embedder, vendors []Vendor, opts ...EmbeddingMatcherOption) *EmbeddingMatcher {
+	m := &EmbeddingMatcher{
+		embedder:  embedder,
+		vendors:   vendors,
+		threshold: DefaultVendorMatchThreshold,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Match returns the vendor whose name or alias is most similar to the seller
+// name, or nil if none reaches the threshold
+func (m *EmbeddingMatcher) Match(ctx context.Context, seller model.Party) (*VendorMatch, error) {
+	if taxID := normalizeTaxID(seller.TaxID); taxID != "" {
+		for _, v := range m.vendors {
+			if normalizeTaxID(v.TaxID) == taxID {
+				return &VendorMatch{VendorID: v.ID, Name: v.Name, Score: 1, ByTaxID: true}, nil
+			}
+		}
+	}
+
+	name := NormalizeVendorName(seller.Name)
+	if name == "" {
+		return nil, nil
+	}
+
+	entries, err := m.vendorEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vector, err := m.embed(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	best, bestScore := -1, 0.0
+	for _, entry := range entries {
+		if score := cosine(vector, entry.vector); score > bestScore {
+			best, bestScore = entry.vendor, score
+		}
+	}
+	if best < 0 || bestScore < m.threshold {
+		return nil, nil
+	}
+
+	v := m.vendors[best]
+	return &VendorMatch{VendorID: v.ID, Name: v.Name, Score: bestScore}, nil
+}
+
+// vendorEntries embeds the vendor names and aliases once; a failed attempt is retried on the next call
+func (m *EmbeddingMatcher) vendorEntries(ctx context.Context) ([]vendorEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries != nil {
+		return m.entries, nil
+	}
+
+	var names []string
+	var owners []int
+	for i, v := range m.vendors {
+		for _, name := range append([]string{v.Name}, v.Aliases...) {
+			if name = NormalizeVendorName(name); name != "" {
+				names = append(names, name)
+				owners = append(owners, i)
+			}
+		}
+	}
+
+	entries := make([]vendorEntry, 0, len(names))
+	if len(names) > 0 {
+		vectors, err := m.embedder.Embed(ctx, names)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed vendor names: %w", err)
+		}
+		for i, vector := range vectors {
+			entries = append(entries, vendorEntry{vendor: owners[i], vector: vector})
+		}
+	}
+
+	m.entries = entries
+	return entries, nil
+}
+
+func (m *EmbeddingMatcher) embed(ctx context.Context, name string) ([]float64, error) {
+	if vector, ok := m.cache.Load(name); ok {
+		return vector.([]float64), nil
+	}
+
+	vectors, err := m.embedder.Embed(ctx, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed seller name: %w", err)
+	}
+	m.cache.Store(name, vectors[0])
+	return vectors[0], nil
+}
+
+// vendorAbbreviations expands the abbreviations common in Vietnamese company names
+var vendorAbbreviations = map[string]string{
+	"CTY": "CÔNG TY",
+	"CT":  "CÔNG TY",
+	"CP":  "CỔ PHẦN",
+	"MTV": "MỘT THÀNH VIÊN",
+	"TM":  "THƯƠNG MẠI",
+	"DV":  "DỊCH VỤ",
+	"SX":  "SẢN XUẤT",
+	"XD":  "XÂY DỰNG",
+	"XNK": "XUẤT NHẬP KHẨU",
+	"VN":  "VIỆT NAM",
+}
+
+var (
+	// initialism matches letters separated by dots, as in "A.B.C"
+	initialism = regexp.MustCompile(`\b(?:\pL\.){2,}\pL?\b`)
+
+	// dottedCompany matches "C.TY" and "C. TY", short for "CÔNG TY"
+	dottedCompany = regexp.MustCompile(`\bC\.\s*TY\b`)
+)
+
+// NormalizeVendorName upper-cases a company name, joins dotted initialisms
+// ("A.B.C" to "ABC"), drops punctuation and expands abbreviations such as
+// "CTY" and "CP", so that spelling variants embed alike
+func NormalizeVendorName(name string) string {
+	name = strings.ToUpper(name)
+	name = dottedCompany.ReplaceAllString(name, "CTY")
+	name = initialism.ReplaceAllStringFunc(name, func(s string) string {
+		return strings.ReplaceAll(s, ".", "")
+	})
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '&'
+	})
+	for i, word := range words {
+		if expanded, ok := vendorAbbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 if either is empty
+// or their lengths differ
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
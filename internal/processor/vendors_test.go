@@ -0,0 +1,113 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// trigramEmbedder embeds texts as hashed character trigram counts and records each call
+type trigramEmbedder struct {
+	calls [][]string
+	err   error
+}
+
+func (e *trigramEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	e.calls = append(e.calls, texts)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector := make([]float64, 64)
+		runes := []rune(" " + text + " ")
+		for j := 0; j+3 <= len(runes); j++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[j : j+3])))
+			vector[h.Sum32()%64]++
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+var testVendors = []processor.Vendor{
+	{ID: "V1", Name: "Công ty TNHH ABC"},
+	{ID: "V2", Name: "Công ty Cổ phần Thương mại XYZ", TaxID: "0312345678", Aliases: []string{"XYZ Mart"}},
+}
+
+func TestNormalizeVendorName(t *testing.T) {
+	assert.Equal(t, "CÔNG TY TNHH ABC", processor.NormalizeVendorName("CTY TNHH ABC"))
+	assert.Equal(t, "CÔNG TY TNHH ABC", processor.NormalizeVendorName("Công ty TNHH A.B.C"))
+	assert.Equal(t, "CÔNG TY TNHH ABC", processor.NormalizeVendorName("C.TY  TNHH  ABC."))
+	assert.Equal(t, "CÔNG TY CỔ PHẦN THƯƠNG MẠI XYZ", processor.NormalizeVendorName("Cty CP TM XYZ"))
+}
+
+func TestEmbeddingMatcher(t *testing.T) {
+	embedder := &trigramEmbedder{}
+	matcher := processor.NewEmbeddingMatcher(embedder, testVendors)
+	ctx := context.Background()
+
+	match, err := matcher.Match(ctx, model.Party{Name: "CTY TNHH A.B.C"})
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "V1", match.VendorID)
+	assert.Equal(t, "Công ty TNHH ABC", match.Name)
+	assert.InDelta(t, 1.0, match.Score, 1e-9)
+
+	match, err = matcher.Match(ctx, model.Party{Name: "Cty CP Thương mai XYZ"})
+	require.NoError(t, err)
+	require.NotNil(t, match, "a dropped diacritic still matches")
+	assert.Equal(t, "V2", match.VendorID)
+	assert.Less(t, match.Score, 1.0)
+	assert.GreaterOrEqual(t, match.Score, processor.DefaultVendorMatchThreshold)
+
+	match, err = matcher.Match(ctx, model.Party{Name: "Nhà hàng Phở Bò Hà Nội"})
+	require.NoError(t, err)
+	assert.Nil(t, match)
+
+	_, err = matcher.Match(ctx, model.Party{Name: "CTY TNHH A.B.C"})
+	require.NoError(t, err)
+	assert.Len(t, embedder.calls, 4, "vendor names once, then each new seller name once")
+	assert.Len(t, embedder.calls[0], 3, "names and aliases are embedded together")
+}
+
+func TestEmbeddingMatcher_TaxID(t *testing.T) {
+	embedder := &trigramEmbedder{}
+	matcher := processor.NewEmbeddingMatcher(embedder, testVendors)
+
+	match, err := matcher.Match(context.Background(), model.Party{Name: "Siêu thị", TaxID: "0312345678-001"})
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, processor.VendorMatch{VendorID: "V2", Name: "Công ty Cổ phần Thương mại XYZ", Score: 1, ByTaxID: true}, *match)
+	assert.Empty(t, embedder.calls)
+}
+
+func TestProcessImage_VendorMatch(t *testing.T) {
+	provider := &stubProvider{content: `{"invoice_number":"1","seller":{"name":"CTY TNHH A.B.C"}}`}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)))
+
+	p := processor.NewPipeline(processor.WithLLMExtractor(extractor),
+		processor.WithVendorMatcher(processor.NewEmbeddingMatcher(&trigramEmbedder{}, testVendors)))
+	result := p.ProcessImage(context.Background(), []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Vendor)
+	assert.Equal(t, "V1", result.Vendor.VendorID)
+	assert.Equal(t, "CTY TNHH A.B.C", result.Invoice.Seller.Name, "the extracted name is kept")
+
+	p = processor.NewPipeline(processor.WithLLMExtractor(extractor),
+		processor.WithVendorMatcher(processor.NewEmbeddingMatcher(&trigramEmbedder{err: errors.New("quota exceeded")}, testVendors)))
+	result = p.ProcessImage(context.Background(), []byte("png"), "image/png")
+	require.NoError(t, result.Error)
+	assert.Nil(t, result.Vendor)
+	assert.Contains(t, result.Warnings, "vendor matching failed: failed to embed vendor names: quota exceeded")
+}
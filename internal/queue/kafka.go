@@ -0,0 +1,1484 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for KafkaConfig
+const (
+	DefaultKafkaBroker           = "localhost:9092"
+	DefaultKafkaGroup            = "invoice-processor"
+	DefaultKafkaSessionTimeout   = 30 * time.Second
+	DefaultKafkaRebalanceTimeout = 5 * time.Minute
+	DefaultKafkaWait             = 5 * time.Second
+	DefaultKafkaRetryDelay       = 10 * time.Second
+)
+
+// kafkaTimeout bounds dialing and requests, beyond the time the broker is
+// asked to wait
+const kafkaTimeout = 10 * time.Second
+
+// kafkaClientID names the client in the brokers' logs and quotas
+const kafkaClientID = "invoice-processor"
+
+// KafkaConfig configures a KafkaQueue
+type KafkaConfig struct {
+	Brokers   []string    // Bootstrap brokers, host:port (default: DefaultKafkaBroker)
+	TLSConfig *tls.Config // Connect with TLS when set
+
+	// User and Password authenticate with SASL PLAIN when User is set
+	User, Password string
+
+	Topic string // Topic published to and consumed
+
+	// Group names the consumer group reading Topic; its committed offsets
+	// are where reading resumes (default: DefaultKafkaGroup). Consumers of a
+	// group must all read the same topic.
+	Group string
+
+	// SessionTimeout is how long the group waits for the heartbeats of a
+	// consumer that crashed before handing its partitions to the others
+	// (default: DefaultKafkaSessionTimeout)
+	SessionTimeout time.Duration
+
+	// RebalanceTimeout is how long a rebalance waits for a consumer to
+	// finish the messages it received and rejoin (default:
+	// DefaultKafkaRebalanceTimeout)
+	RebalanceTimeout time.Duration
+
+	Wait time.Duration // Wait for new messages per receive (default: DefaultKafkaWait)
+
+	// RetryDelay is how long a message the consumer failed to handle waits
+	// before it is delivered again (default: DefaultKafkaRetryDelay)
+	RetryDelay time.Duration
+}
+
+// KafkaQueue is a Source and Publisher on a Kafka topic, speaking the Kafka
+// protocol. Messages are read as a member of a consumer group, whose
+// partitions are spread over its consumers, and attributes travel as record
+// headers.
+//
+// The offset of a partition is committed only up to its oldest message not
+// yet acknowledged, so a consumer that crashes, or loses the partition in a
+// rebalance, leaves that message and the ones after it for the next owner.
+// Messages that fail are delivered again after RetryDelay while the others
+// go on; attempts are counted in memory, starting over when the partition
+// changes hands. Records must be uncompressed or compressed with gzip.
+type KafkaQueue struct {
+	cfg KafkaConfig
+
+	mu      sync.Mutex
+	conns   map[string]*kafkaConn // By address
+	brokers map[int32]string      // Addresses by node ID
+	leaders map[int32]int32       // Leader node by partition of Topic, nil until looked up
+	next    int                   // Partition published to next, round robin
+
+	// The group membership, held by Receive, Ack and Nack
+	gmu           sync.Mutex
+	joined        bool
+	rejoin        atomic.Bool // Set by the heartbeat when the group rebalances
+	coordinator   string
+	memberID      string
+	generation    int32
+	assigned      map[int32]*kafkaPartition
+	stopHeartbeat context.CancelFunc
+	heartbeatDone chan struct{}
+}
+
+// kafkaPartition tracks the delivery of an assigned partition
+type kafkaPartition struct {
+	position  int64          // Next offset to fetch
+	committed int64          // Offset last committed, -1 if none
+	unacked   map[int64]bool // Offsets delivered and not acknowledged yet
+	retries   []*kafkaRetry  // Failed messages waiting to be delivered again
+}
+
+type kafkaRetry struct {
+	msg *Message
+	at  time.Time
+}
+
+// NewKafkaQueue returns the queue on cfg.Topic. It connects on first use,
+// and joins the group on the first receive.
+func NewKafkaQueue(cfg KafkaConfig) (*KafkaQueue, error) {
+	if len(cfg.Brokers) == 0 {
+		cfg.Brokers = []string{DefaultKafkaBroker}
+	}
+	for _, b := range cfg.Brokers {
+		if _, port, err := net.SplitHostPort(b); err != nil || port == "" {
+			return nil, fmt.Errorf("invalid Kafka broker %q, want host:port", b)
+		}
+	}
+	if !validKafkaName(cfg.Topic) {
+		return nil, fmt.Errorf("invalid Kafka topic %q", cfg.Topic)
+	}
+	if cfg.Group == "" {
+		cfg.Group = DefaultKafkaGroup
+	}
+	if cfg.SessionTimeout <= 0 {
+		cfg.SessionTimeout = DefaultKafkaSessionTimeout
+	}
+	if cfg.RebalanceTimeout <= 0 {
+		cfg.RebalanceTimeout = DefaultKafkaRebalanceTimeout
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = DefaultKafkaWait
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultKafkaRetryDelay
+	}
+	return &KafkaQueue{cfg: cfg, conns: make(map[string]*kafkaConn)}, nil
+}
+
+// validKafkaName reports whether name is a valid topic name
+func validKafkaName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 249 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Receive returns up to n messages: failed ones due for another attempt,
+// then new ones, waiting up to Wait for the first
+func (q *KafkaQueue) Receive(ctx context.Context, n int) ([]*Message, error) {
+	q.gmu.Lock()
+	defer q.gmu.Unlock()
+	if err := q.ensureGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	n = max(n, 1)
+	now := time.Now()
+	wait := q.cfg.Wait
+	var msgs []*Message
+	partitions := slices.Sorted(maps.Keys(q.assigned))
+	for _, id := range partitions {
+		p := q.assigned[id]
+		p.retries = slices.DeleteFunc(p.retries, func(r *kafkaRetry) bool {
+			if len(msgs) == n || r.at.After(now) {
+				wait = min(wait, r.at.Sub(now))
+				return false
+			}
+			r.msg.Attempts++
+			msgs = append(msgs, r.msg)
+			return true
+		})
+	}
+	if len(msgs) == n {
+		return msgs, nil
+	}
+	if len(msgs) > 0 {
+		wait = 0
+	}
+	if len(partitions) == 0 {
+		// More consumers than partitions: wait for a rebalance
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		return msgs, nil
+	}
+
+	offsets := make(map[int32]int64, len(partitions))
+	for _, id := range partitions {
+		offsets[id] = q.assigned[id].position
+	}
+	fetched, err := q.fetch(ctx, offsets, max(wait, 0))
+	if err != nil {
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+		return nil, err
+	}
+	for _, id := range partitions {
+		f, ok := fetched[id]
+		if !ok {
+			continue
+		}
+		p := q.assigned[id]
+		if f.outOfRange {
+			earliest, err := q.listOffsets(ctx, []int32{id})
+			if err != nil {
+				return msgs, nil
+			}
+			p.position = earliest[id]
+			continue
+		}
+		all := true
+		for _, r := range f.records {
+			if r.offset < p.position {
+				continue
+			}
+			if len(msgs) == n {
+				all = false
+				break
+			}
+			msgs = append(msgs, &Message{
+				ID:         fmt.Sprintf("%s/%d/%d", q.cfg.Topic, id, r.offset),
+				Body:       r.value,
+				Attributes: r.headers,
+				Attempts:   1,
+				Handle:     fmt.Sprintf("%d/%d/%d", q.generation, id, r.offset),
+			})
+			p.unacked[r.offset] = true
+			p.position = r.offset + 1
+		}
+		if all {
+			// Past control records and those of aborted transactions
+			p.position = max(p.position, f.next)
+		}
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges a message, committing the offset of its partition up to
+// the oldest message not acknowledged yet
+func (q *KafkaQueue) Ack(ctx context.Context, msg *Message) error {
+	q.gmu.Lock()
+	defer q.gmu.Unlock()
+	partition, p, offset, err := q.delivery(msg)
+	if err != nil {
+		return err
+	}
+	delete(p.unacked, offset)
+	p.retries = slices.DeleteFunc(p.retries, func(r *kafkaRetry) bool { return r.msg == msg })
+
+	commit := p.position
+	for o := range p.unacked {
+		commit = min(commit, o)
+	}
+	if commit <= p.committed {
+		return nil
+	}
+	if err := q.commit(ctx, partition, commit); err != nil {
+		return err
+	}
+	p.committed = commit
+	return nil
+}
+
+// Nack hands a message back, to be delivered again after RetryDelay. Its
+// offset stays uncommitted until it is acknowledged.
+func (q *KafkaQueue) Nack(ctx context.Context, msg *Message) error {
+	q.gmu.Lock()
+	defer q.gmu.Unlock()
+	_, p, offset, err := q.delivery(msg)
+	if err != nil {
+		return err
+	}
+	if p.unacked[offset] && !slices.ContainsFunc(p.retries, func(r *kafkaRetry) bool { return r.msg == msg }) {
+		p.retries = append(p.retries, &kafkaRetry{msg: msg, at: time.Now().Add(q.cfg.RetryDelay)})
+	}
+	return nil
+}
+
+// delivery returns the partition and offset of a message, which must have
+// been delivered since the consumer last joined the group. Its handle is
+// <generation>/<partition>/<offset>.
+func (q *KafkaQueue) delivery(msg *Message) (int32, *kafkaPartition, int64, error) {
+	parts := strings.Split(msg.Handle, "/")
+	if len(parts) != 3 {
+		return 0, nil, 0, fmt.Errorf("invalid Kafka message handle %q", msg.Handle)
+	}
+	generation, err1 := strconv.ParseInt(parts[0], 10, 32)
+	partition, err2 := strconv.ParseInt(parts[1], 10, 32)
+	offset, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if errors.Join(err1, err2, err3) != nil {
+		return 0, nil, 0, fmt.Errorf("invalid Kafka message handle %q", msg.Handle)
+	}
+	p := q.assigned[int32(partition)]
+	if !q.joined || int32(generation) != q.generation || p == nil {
+		return 0, nil, 0, fmt.Errorf("partition %d was reassigned; message %s will be delivered again", partition, msg.ID)
+	}
+	return int32(partition), p, offset, nil
+}
+
+// Publish appends a record to a partition of Topic, chosen round robin,
+// with attributes as headers, waiting for all in-sync replicas
+func (q *KafkaQueue) Publish(ctx context.Context, body []byte, attributes map[string]string) error {
+	leaders, err := q.metadata(ctx)
+	if err != nil {
+		return err
+	}
+	partitions := slices.Sorted(maps.Keys(leaders))
+	q.mu.Lock()
+	partition := partitions[q.next%len(partitions)]
+	q.next++
+	q.mu.Unlock()
+
+	var req kafkaEncoder
+	req.nullString()
+	req.int16(-1) // acks: all in-sync replicas
+	req.int32(int32(kafkaTimeout / time.Millisecond))
+	req.array(1)
+	req.string(q.cfg.Topic)
+	req.array(1)
+	req.int32(partition)
+	req.bytes(encodeKafkaRecordBatch(body, attributes, time.Now()))
+
+	resp, err := q.request(ctx, q.leaderAddr(leaders[partition]), kafkaProduce, 3, req, 0)
+	if err == nil {
+		for range resp.array() {
+			resp.string()
+			for range resp.array() {
+				resp.int32()
+				if code := resp.int16(); code != 0 && err == nil {
+					err = kafkaError(code)
+				}
+				resp.int64()
+				resp.int64()
+			}
+		}
+		if err == nil {
+			err = resp.err
+		}
+	}
+	if err != nil {
+		q.forgetMetadata(err)
+		return fmt.Errorf("failed to publish to %s: %w", q.cfg.Topic, err)
+	}
+	return nil
+}
+
+// Close leaves the group, so its partitions are handed to the other
+// consumers at once, and closes the connections
+func (q *KafkaQueue) Close() error {
+	q.gmu.Lock()
+	if q.stopHeartbeat != nil {
+		q.stopHeartbeat()
+		<-q.heartbeatDone
+		q.stopHeartbeat = nil
+	}
+	if q.joined {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+		var req kafkaEncoder
+		req.string(q.cfg.Group)
+		req.string(q.memberID)
+		q.request(ctx, q.coordinator, kafkaLeaveGroup, 1, req, 0)
+		cancel()
+		q.joined = false
+	}
+	q.gmu.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var errs []error
+	for addr, c := range q.conns {
+		if err := c.close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(q.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+// ensureGroup joins the group if the consumer is not a member, or the group
+// is rebalancing. Its partitions start at their committed offsets.
+func (q *KafkaQueue) ensureGroup(ctx context.Context) error {
+	if q.joined && !q.rejoin.Load() {
+		return nil
+	}
+	if q.stopHeartbeat != nil {
+		q.stopHeartbeat()
+		<-q.heartbeatDone
+		q.stopHeartbeat = nil
+	}
+	q.joined, q.assigned = false, nil
+
+	var err error
+	for attempt := 1; attempt <= 5; attempt++ {
+		if err = q.join(ctx); err == nil {
+			q.joined = true
+			q.rejoin.Store(false)
+			q.startHeartbeat()
+			return nil
+		}
+		var ke kafkaError
+		if !errors.As(err, &ke) {
+			break
+		}
+		switch ke {
+		case kafkaUnknownMemberID:
+			q.memberID = ""
+		case kafkaNotCoordinator, kafkaCoordinatorNotAvailable:
+			q.coordinator = ""
+		case kafkaRebalanceInProgress, kafkaIllegalGeneration, kafkaCoordinatorLoadInProgress:
+		default:
+			attempt = 5
+			continue
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("failed to join consumer group %s: %w", q.cfg.Group, err)
+}
+
+// join joins the group and syncs it; the member elected leader assigns the
+// partitions of Topic round robin
+func (q *KafkaQueue) join(ctx context.Context) error {
+	if q.coordinator == "" {
+		addr, err := q.findCoordinator(ctx)
+		if err != nil {
+			return err
+		}
+		q.coordinator = addr
+	}
+
+	var subscription kafkaEncoder
+	subscription.int16(0)
+	subscription.array(1)
+	subscription.string(q.cfg.Topic)
+	subscription.bytes(nil)
+
+	var req kafkaEncoder
+	req.string(q.cfg.Group)
+	req.int32(int32(q.cfg.SessionTimeout / time.Millisecond))
+	req.int32(int32(q.cfg.RebalanceTimeout / time.Millisecond))
+	req.string(q.memberID)
+	req.string("consumer")
+	req.array(1)
+	req.string("roundrobin")
+	req.bytes(subscription)
+	resp, err := q.request(ctx, q.coordinator, kafkaJoinGroup, 2, req, q.cfg.RebalanceTimeout)
+	if err != nil {
+		return err
+	}
+	resp.int32()
+	code := resp.int16()
+	generation := resp.int32()
+	resp.string()
+	leader := resp.string()
+	memberID := resp.string()
+	var members []string
+	subscribed := make(map[string]bool)
+	for range resp.array() {
+		member := resp.string()
+		metadata := kafkaDecoder{b: resp.bytes()}
+		metadata.int16()
+		for range metadata.array() {
+			if metadata.string() == q.cfg.Topic {
+				subscribed[member] = true
+			}
+		}
+		members = append(members, member)
+	}
+	if resp.err != nil {
+		return resp.err
+	}
+	if code != 0 {
+		return kafkaError(code)
+	}
+	q.memberID, q.generation = memberID, generation
+
+	req = nil
+	req.string(q.cfg.Group)
+	req.int32(generation)
+	req.string(memberID)
+	if leader == memberID {
+		assignments, err := q.assign(ctx, members, subscribed)
+		if err != nil {
+			return err
+		}
+		req.array(len(assignments))
+		for _, member := range members {
+			if a, ok := assignments[member]; ok {
+				req.string(member)
+				req.bytes(a)
+			}
+		}
+	} else {
+		req.array(0)
+	}
+	resp, err = q.request(ctx, q.coordinator, kafkaSyncGroup, 1, req, q.cfg.RebalanceTimeout)
+	if err != nil {
+		return err
+	}
+	resp.int32()
+	code = resp.int16()
+	assignment := kafkaDecoder{b: resp.bytes()}
+	if resp.err != nil {
+		return resp.err
+	}
+	if code != 0 {
+		return kafkaError(code)
+	}
+	var partitions []int32
+	if len(assignment.b) > 0 {
+		assignment.int16()
+		for range assignment.array() {
+			topic := assignment.string()
+			for range assignment.array() {
+				if p := assignment.int32(); topic == q.cfg.Topic {
+					partitions = append(partitions, p)
+				}
+			}
+		}
+		if assignment.err != nil {
+			return fmt.Errorf("invalid partition assignment: %w", assignment.err)
+		}
+	}
+
+	committed, err := q.committedOffsets(ctx, partitions)
+	if err != nil {
+		return err
+	}
+	q.assigned = make(map[int32]*kafkaPartition, len(partitions))
+	for _, id := range partitions {
+		q.assigned[id] = &kafkaPartition{position: committed[id], committed: committed[id], unacked: make(map[int64]bool)}
+	}
+	return nil
+}
+
+// assign spreads the partitions of Topic over the members subscribed to it,
+// returning the assignment of each member
+func (q *KafkaQueue) assign(ctx context.Context, members []string, subscribed map[string]bool) (map[string][]byte, error) {
+	leaders, err := q.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var consumers []string
+	for _, m := range members {
+		if subscribed[m] {
+			consumers = append(consumers, m)
+		}
+	}
+	if len(consumers) == 0 {
+		return nil, fmt.Errorf("no member of group %s reads %s", q.cfg.Group, q.cfg.Topic)
+	}
+	slices.Sort(consumers)
+	byMember := make(map[string][]int32)
+	for i, p := range slices.Sorted(maps.Keys(leaders)) {
+		m := consumers[i%len(consumers)]
+		byMember[m] = append(byMember[m], p)
+	}
+
+	assignments := make(map[string][]byte, len(members))
+	for _, m := range members {
+		var a kafkaEncoder
+		a.int16(0)
+		a.array(1)
+		a.string(q.cfg.Topic)
+		a.array(len(byMember[m]))
+		for _, p := range byMember[m] {
+			a.int32(p)
+		}
+		a.bytes(nil)
+		assignments[m] = a
+	}
+	return assignments, nil
+}
+
+// committedOffsets returns where to read the partitions from: the offsets
+// committed by the group, or the earliest ones for partitions it never
+// committed, so nothing published before the group started is missed
+func (q *KafkaQueue) committedOffsets(ctx context.Context, partitions []int32) (map[int32]int64, error) {
+	offsets := make(map[int32]int64, len(partitions))
+	if len(partitions) == 0 {
+		return offsets, nil
+	}
+	var req kafkaEncoder
+	req.string(q.cfg.Group)
+	req.array(1)
+	req.string(q.cfg.Topic)
+	req.array(len(partitions))
+	for _, p := range partitions {
+		req.int32(p)
+	}
+	resp, err := q.request(ctx, q.coordinator, kafkaOffsetFetch, 1, req, 0)
+	if err != nil {
+		return nil, err
+	}
+	var missing []int32
+	for range resp.array() {
+		resp.string()
+		for range resp.array() {
+			p := resp.int32()
+			offset := resp.int64()
+			resp.string()
+			if code := resp.int16(); code != 0 && err == nil {
+				err = kafkaError(code)
+			}
+			if offset < 0 {
+				missing = append(missing, p)
+			} else {
+				offsets[p] = offset
+			}
+		}
+	}
+	if err == nil {
+		err = resp.err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	for _, p := range partitions {
+		if _, ok := offsets[p]; !ok && !slices.Contains(missing, p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		earliest, err := q.listOffsets(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for p, offset := range earliest {
+			offsets[p] = offset
+		}
+	}
+	for _, p := range partitions {
+		offsets[p] = max(offsets[p], 0)
+	}
+	return offsets, nil
+}
+
+// listOffsets returns the earliest offsets of partitions, asking their
+// leaders
+func (q *KafkaQueue) listOffsets(ctx context.Context, partitions []int32) (map[int32]int64, error) {
+	leaders, err := q.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byLeader := make(map[int32][]int32)
+	for _, p := range partitions {
+		byLeader[leaders[p]] = append(byLeader[leaders[p]], p)
+	}
+	offsets := make(map[int32]int64, len(partitions))
+	for leader, ps := range byLeader {
+		var req kafkaEncoder
+		req.int32(-1)
+		req.array(1)
+		req.string(q.cfg.Topic)
+		req.array(len(ps))
+		for _, p := range ps {
+			req.int32(p)
+			req.int64(-2) // Earliest
+		}
+		resp, err := q.request(ctx, q.leaderAddr(leader), kafkaListOffsets, 1, req, 0)
+		if err != nil {
+			return nil, err
+		}
+		for range resp.array() {
+			resp.string()
+			for range resp.array() {
+				p := resp.int32()
+				if code := resp.int16(); code != 0 && err == nil {
+					err = kafkaError(code)
+				}
+				resp.int64()
+				offsets[p] = resp.int64()
+			}
+		}
+		if err == nil {
+			err = resp.err
+		}
+		if err != nil {
+			q.forgetMetadata(err)
+			return nil, fmt.Errorf("failed to list offsets of %s: %w", q.cfg.Topic, err)
+		}
+	}
+	return offsets, nil
+}
+
+// commit commits the offset of a partition, the next one to read
+func (q *KafkaQueue) commit(ctx context.Context, partition int32, offset int64) error {
+	var req kafkaEncoder
+	req.string(q.cfg.Group)
+	req.int32(q.generation)
+	req.string(q.memberID)
+	req.int64(-1) // Retention: the broker's
+	req.array(1)
+	req.string(q.cfg.Topic)
+	req.array(1)
+	req.int32(partition)
+	req.int64(offset)
+	req.nullString()
+	resp, err := q.request(ctx, q.coordinator, kafkaOffsetCommit, 2, req, 0)
+	if err == nil {
+		for range resp.array() {
+			resp.string()
+			for range resp.array() {
+				resp.int32()
+				if code := resp.int16(); code != 0 && err == nil {
+					err = kafkaError(code)
+				}
+			}
+		}
+		if err == nil {
+			err = resp.err
+		}
+	}
+	if err != nil {
+		var ke kafkaError
+		if errors.As(err, &ke) && ke.rebalance() {
+			q.rejoin.Store(true)
+		}
+		return fmt.Errorf("failed to commit offset %d of partition %d: %w", offset, partition, err)
+	}
+	return nil
+}
+
+// startHeartbeat keeps the membership alive until stopped, flagging a
+// rejoin once the group rebalances
+func (q *KafkaQueue) startHeartbeat() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	q.stopHeartbeat, q.heartbeatDone = cancel, done
+
+	var req kafkaEncoder
+	req.string(q.cfg.Group)
+	req.int32(q.generation)
+	req.string(q.memberID)
+	coordinator := q.coordinator
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(max(q.cfg.SessionTimeout/10, 100*time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			resp, err := q.request(ctx, coordinator, kafkaHeartbeat, 1, req, 0)
+			if err != nil {
+				continue
+			}
+			resp.int32()
+			if code := kafkaError(resp.int16()); code.rebalance() || code == kafkaNotCoordinator {
+				q.rejoin.Store(true)
+				return
+			}
+		}
+	}()
+}
+
+// findCoordinator returns the address of the broker coordinating the group
+func (q *KafkaQueue) findCoordinator(ctx context.Context) (string, error) {
+	var req kafkaEncoder
+	req.string(q.cfg.Group)
+	req.int8(0) // Group
+	resp, err := q.bootstrap(ctx, kafkaFindCoordinator, 1, req)
+	if err != nil {
+		return "", err
+	}
+	resp.int32()
+	code := resp.int16()
+	resp.string()
+	resp.int32()
+	host := resp.string()
+	port := resp.int32()
+	if resp.err != nil {
+		return "", resp.err
+	}
+	if code != 0 {
+		return "", kafkaError(code)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// metadata returns the leader of each partition of Topic, looked up once
+// and again after a request failed for a moved partition
+func (q *KafkaQueue) metadata(ctx context.Context) (map[int32]int32, error) {
+	q.mu.Lock()
+	leaders := q.leaders
+	q.mu.Unlock()
+	if leaders != nil {
+		return leaders, nil
+	}
+
+	var req kafkaEncoder
+	req.array(1)
+	req.string(q.cfg.Topic)
+	req.int8(0) // Don't create the topic
+	resp, err := q.bootstrap(ctx, kafkaMetadata, 4, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.int32()
+	brokers := make(map[int32]string)
+	for range resp.array() {
+		id := resp.int32()
+		host := resp.string()
+		port := resp.int32()
+		resp.string()
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	resp.string()
+	resp.int32()
+	leaders = make(map[int32]int32)
+	for range resp.array() {
+		code := resp.int16()
+		name := resp.string()
+		resp.int8()
+		for range resp.array() {
+			resp.int16()
+			p := resp.int32()
+			leader := resp.int32()
+			for range resp.array() {
+				resp.int32()
+			}
+			for range resp.array() {
+				resp.int32()
+			}
+			if name == q.cfg.Topic {
+				leaders[p] = leader
+			}
+		}
+		if code != 0 && name == q.cfg.Topic && err == nil {
+			err = kafkaError(code)
+		}
+	}
+	if err == nil {
+		err = resp.err
+	}
+	if err == nil && len(leaders) == 0 {
+		err = kafkaUnknownTopicOrPartition
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up topic %s: %w", q.cfg.Topic, err)
+	}
+
+	q.mu.Lock()
+	q.brokers, q.leaders = brokers, leaders
+	q.mu.Unlock()
+	return leaders, nil
+}
+
+// forgetMetadata drops the partition leaders after an error that may mean
+// they moved, so they are looked up again
+func (q *KafkaQueue) forgetMetadata(err error) {
+	var ke kafkaError
+	if errors.As(err, &ke) && !ke.moved() {
+		return
+	}
+	q.mu.Lock()
+	q.leaders = nil
+	q.mu.Unlock()
+}
+
+func (q *KafkaQueue) leaderAddr(node int32) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.brokers[node]
+}
+
+// kafkaFetched is what a fetch returned for a partition
+type kafkaFetched struct {
+	records    []kafkaRecord
+	next       int64 // Offset after the last record batch
+	outOfRange bool  // The offset asked for no longer exists
+}
+
+// fetch reads the partitions from their offsets, asking their leaders at
+// the same time and waiting up to wait for records
+func (q *KafkaQueue) fetch(ctx context.Context, offsets map[int32]int64, wait time.Duration) (map[int32]kafkaFetched, error) {
+	leaders, err := q.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byLeader := make(map[int32][]int32)
+	for p := range offsets {
+		byLeader[leaders[p]] = append(byLeader[leaders[p]], p)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	fetched := make(map[int32]kafkaFetched, len(offsets))
+	for leader, partitions := range byLeader {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := q.fetchFrom(ctx, q.leaderAddr(leader), partitions, offsets, wait)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for p, f := range result {
+				fetched[p] = f
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		q.forgetMetadata(err)
+		return nil, fmt.Errorf("failed to fetch from %s: %w", q.cfg.Topic, err)
+	}
+	return fetched, nil
+}
+
+func (q *KafkaQueue) fetchFrom(ctx context.Context, addr string, partitions []int32, offsets map[int32]int64, wait time.Duration) (map[int32]kafkaFetched, error) {
+	var req kafkaEncoder
+	req.int32(-1) // Replica: a consumer
+	req.int32(int32(wait / time.Millisecond))
+	req.int32(1)        // Min bytes
+	req.int32(50 << 20) // Max bytes
+	req.int8(0)         // Read uncommitted
+	req.array(1)
+	req.string(q.cfg.Topic)
+	req.array(len(partitions))
+	for _, p := range partitions {
+		req.int32(p)
+		req.int64(offsets[p])
+		req.int32(1 << 20) // Max bytes of the partition, past its first batch
+	}
+	resp, err := q.request(ctx, addr, kafkaFetch, 4, req, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.int32()
+	fetched := make(map[int32]kafkaFetched, len(partitions))
+	for range resp.array() {
+		resp.string()
+		for range resp.array() {
+			p := resp.int32()
+			code := kafkaError(resp.int16())
+			resp.int64()
+			resp.int64()
+			for range resp.array() {
+				resp.int64()
+				resp.int64()
+			}
+			data := resp.bytes()
+			switch {
+			case code == kafkaOffsetOutOfRange:
+				fetched[p] = kafkaFetched{outOfRange: true}
+			case code.moved():
+				if err == nil {
+					err = code
+				}
+			case code != 0:
+				return nil, code
+			default:
+				records, next, err := decodeKafkaRecordBatches(data)
+				if err != nil {
+					return nil, fmt.Errorf("partition %d: %w", p, err)
+				}
+				fetched[p] = kafkaFetched{records: records, next: max(next, offsets[p])}
+			}
+		}
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return fetched, err
+}
+
+// bootstrap sends a request to the first bootstrap broker that answers
+func (q *KafkaQueue) bootstrap(ctx context.Context, key int16, version int16, body kafkaEncoder) (*kafkaDecoder, error) {
+	var errs []error
+	for _, addr := range q.cfg.Brokers {
+		resp, err := q.request(ctx, addr, key, version, body, 0)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// request sends a request to the broker at addr, connecting if needed,
+// allowing wait beyond kafkaTimeout for its answer
+func (q *KafkaQueue) request(ctx context.Context, addr string, key int16, version int16, body kafkaEncoder, wait time.Duration) (*kafkaDecoder, error) {
+	if addr == "" {
+		return nil, kafkaLeaderNotAvailable
+	}
+	c, err := q.connect(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.request(ctx, key, version, body, wait)
+}
+
+// connect returns the connection to addr, dialing it if there is none or
+// it failed
+func (q *KafkaQueue) connect(ctx context.Context, addr string) (*kafkaConn, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if c := q.conns[addr]; c != nil && !c.failed.Load() {
+		return c, nil
+	}
+	c, err := q.dial(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka at %s: %w", addr, err)
+	}
+	q.conns[addr] = c
+	return c, nil
+}
+
+// dial connects, with TLS when configured, and authenticates
+func (q *KafkaQueue) dial(ctx context.Context, addr string) (*kafkaConn, error) {
+	d := net.Dialer{Timeout: kafkaTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if q.cfg.TLSConfig != nil {
+		cfg := q.cfg.TLSConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+	c := &kafkaConn{conn: conn}
+	if q.cfg.User != "" {
+		if err := c.authenticate(ctx, q.cfg.User, q.cfg.Password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Kafka API keys
+const (
+	kafkaProduce          = 0
+	kafkaFetch            = 1
+	kafkaListOffsets      = 2
+	kafkaMetadata         = 3
+	kafkaOffsetCommit     = 8
+	kafkaOffsetFetch      = 9
+	kafkaFindCoordinator  = 10
+	kafkaJoinGroup        = 11
+	kafkaHeartbeat        = 12
+	kafkaLeaveGroup       = 13
+	kafkaSyncGroup        = 14
+	kafkaSASLHandshake    = 17
+	kafkaSASLAuthenticate = 36
+)
+
+// kafkaError is an error code returned by a broker
+type kafkaError int16
+
+// Kafka error codes the queue acts on
+const (
+	kafkaOffsetOutOfRange          kafkaError = 1
+	kafkaUnknownTopicOrPartition   kafkaError = 3
+	kafkaLeaderNotAvailable        kafkaError = 5
+	kafkaNotLeader                 kafkaError = 6
+	kafkaCoordinatorLoadInProgress kafkaError = 14
+	kafkaCoordinatorNotAvailable   kafkaError = 15
+	kafkaNotCoordinator            kafkaError = 16
+	kafkaIllegalGeneration         kafkaError = 22
+	kafkaUnknownMemberID           kafkaError = 25
+	kafkaRebalanceInProgress       kafkaError = 27
+)
+
+var kafkaErrorNames = map[kafkaError]string{
+	1: "OFFSET_OUT_OF_RANGE", 2: "CORRUPT_MESSAGE", 3: "UNKNOWN_TOPIC_OR_PARTITION",
+	5: "LEADER_NOT_AVAILABLE", 6: "NOT_LEADER_OR_FOLLOWER", 7: "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE", 14: "COORDINATOR_LOAD_IN_PROGRESS", 15: "COORDINATOR_NOT_AVAILABLE",
+	16: "NOT_COORDINATOR", 19: "NOT_ENOUGH_REPLICAS", 20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	22: "ILLEGAL_GENERATION", 23: "INCONSISTENT_GROUP_PROTOCOL", 24: "INVALID_GROUP_ID",
+	25: "UNKNOWN_MEMBER_ID", 26: "INVALID_SESSION_TIMEOUT", 27: "REBALANCE_IN_PROGRESS",
+	29: "TOPIC_AUTHORIZATION_FAILED", 30: "GROUP_AUTHORIZATION_FAILED", 33: "UNSUPPORTED_SASL_MECHANISM",
+	35: "UNSUPPORTED_VERSION", 58: "SASL_AUTHENTICATION_FAILED",
+}
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrorNames[e]; ok {
+		return fmt.Sprintf("Kafka returned error %d (%s)", int16(e), name)
+	}
+	return fmt.Sprintf("Kafka returned error %d", int16(e))
+}
+
+// rebalance reports whether the error means the member must rejoin
+func (e kafkaError) rebalance() bool {
+	return e == kafkaRebalanceInProgress || e == kafkaIllegalGeneration || e == kafkaUnknownMemberID
+}
+
+// moved reports whether the error means a partition's leader changed
+func (e kafkaError) moved() bool {
+	return e == kafkaUnknownTopicOrPartition || e == kafkaLeaderNotAvailable || e == kafkaNotLeader
+}
+
+// kafkaConn is a connection to a broker, carrying one request at a time
+type kafkaConn struct {
+	conn   net.Conn
+	failed atomic.Bool // Set once a request failed, so the connection is replaced
+
+	mu          sync.Mutex
+	correlation int32
+}
+
+// request sends a request and reads its response, past the response header
+func (c *kafkaConn) request(ctx context.Context, key int16, version int16, body kafkaEncoder, wait time.Duration) (*kafkaDecoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed.Load() {
+		return nil, errors.New("Kafka connection lost")
+	}
+	c.correlation++
+	var req kafkaEncoder
+	req.int32(0) // Size, set below
+	req.int16(key)
+	req.int16(version)
+	req.int32(c.correlation)
+	req.string(kafkaClientID)
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	deadline := time.Now().Add(kafkaTimeout + wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	resp, err := c.roundTrip(req)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.failed.Store(true)
+		c.conn.Close()
+		return nil, err
+	}
+	if correlation := resp.int32(); correlation != c.correlation {
+		c.failed.Store(true)
+		c.conn.Close()
+		return nil, fmt.Errorf("Kafka answered request %d with %d", c.correlation, correlation)
+	}
+	return resp, nil
+}
+
+func (c *kafkaConn) roundTrip(req []byte) (*kafkaDecoder, error) {
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 256<<20 {
+		return nil, fmt.Errorf("invalid Kafka response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+	return &kafkaDecoder{b: resp}, nil
+}
+
+// authenticate logs in with SASL PLAIN
+func (c *kafkaConn) authenticate(ctx context.Context, user, password string) error {
+	var req kafkaEncoder
+	req.string("PLAIN")
+	resp, err := c.request(ctx, kafkaSASLHandshake, 1, req, 0)
+	if err != nil {
+		return err
+	}
+	if code := resp.int16(); code != 0 {
+		return fmt.Errorf("SASL PLAIN refused: %w", kafkaError(code))
+	}
+
+	req = nil
+	req.bytes([]byte("\x00" + user + "\x00" + password))
+	resp, err = c.request(ctx, kafkaSASLAuthenticate, 0, req, 0)
+	if err != nil {
+		return err
+	}
+	code := resp.int16()
+	message := resp.string()
+	if code != 0 {
+		return fmt.Errorf("SASL authentication failed: %s: %w", message, kafkaError(code))
+	}
+	return resp.err
+}
+
+func (c *kafkaConn) close() error {
+	c.failed.Store(true)
+	return c.conn.Close()
+}
+
+// kafkaRecord is a record read from a partition
+type kafkaRecord struct {
+	offset  int64
+	value   []byte
+	headers map[string]string
+}
+
+// kafkaCRC is the Castagnoli CRC-32 of record batches
+var kafkaCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeKafkaRecordBatch encodes a batch of one record, without a key
+func encodeKafkaRecordBatch(value []byte, headers map[string]string, now time.Time) []byte {
+	var record kafkaEncoder
+	record.int8(0)    // Attributes
+	record.varint(0)  // Timestamp delta
+	record.varint(0)  // Offset delta
+	record.varint(-1) // No key
+	record.varint(int64(len(value)))
+	record = append(record, value...)
+	keys := slices.Sorted(maps.Keys(headers))
+	record.varint(int64(len(keys)))
+	for _, k := range keys {
+		record.varint(int64(len(k)))
+		record = append(record, k...)
+		record.varint(int64(len(headers[k])))
+		record = append(record, headers[k]...)
+	}
+
+	var batch kafkaEncoder
+	batch.int16(0) // Attributes: uncompressed
+	batch.int32(0) // Last offset delta
+	batch.int64(now.UnixMilli())
+	batch.int64(now.UnixMilli())
+	batch.int64(-1) // Producer ID
+	batch.int16(-1) // Producer epoch
+	batch.int32(-1) // Base sequence
+	batch.int32(1)
+	batch.varint(int64(len(record)))
+	batch = append(batch, record...)
+
+	var out kafkaEncoder
+	out.int64(0)
+	out.int32(int32(4 + 1 + 4 + len(batch)))
+	out.int32(-1) // Partition leader epoch
+	out.int8(2)   // Magic
+	out.int32(int32(crc32.Checksum(batch, kafkaCRC)))
+	return append(out, batch...)
+}
+
+// decodeKafkaRecordBatches reads the records of the batches a fetch
+// returned, skipping control batches, and the offset after the last batch.
+// A batch cut short at the end, as brokers may return, is left out.
+func decodeKafkaRecordBatches(data []byte) ([]kafkaRecord, int64, error) {
+	var records []kafkaRecord
+	next := int64(-1)
+	for len(data) >= 12 {
+		base := int64(binary.BigEndian.Uint64(data))
+		length := int(int32(binary.BigEndian.Uint32(data[8:])))
+		if length > len(data)-12 {
+			break
+		}
+		batch := data[12 : 12+length]
+		data = data[12+length:]
+		if len(batch) < 49 {
+			return nil, 0, fmt.Errorf("corrupt record batch at offset %d", base)
+		}
+		if magic := batch[4]; magic != 2 {
+			return nil, 0, fmt.Errorf("record format v%d at offset %d is not supported", magic, base)
+		}
+		if crc32.Checksum(batch[9:], kafkaCRC) != binary.BigEndian.Uint32(batch[5:]) {
+			return nil, 0, fmt.Errorf("corrupt record batch at offset %d", base)
+		}
+		attributes := binary.BigEndian.Uint16(batch[9:])
+		next = base + int64(int32(binary.BigEndian.Uint32(batch[11:]))) + 1
+		if attributes&0x20 != 0 {
+			continue // Transaction markers
+		}
+		count := int(int32(binary.BigEndian.Uint32(batch[45:])))
+		payload := batch[49:]
+		switch attributes & 7 {
+		case 0:
+		case 1:
+			zr, err := gzip.NewReader(bytes.NewReader(payload))
+			if err == nil {
+				payload, err = io.ReadAll(zr)
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("corrupt gzip record batch at offset %d: %w", base, err)
+			}
+		default:
+			names := []string{2: "snappy", 3: "lz4", 4: "zstd"}
+			name := "unknown"
+			if c := int(attributes & 7); c < len(names) {
+				name = names[c]
+			}
+			return nil, 0, fmt.Errorf("record batch at offset %d is compressed with %s; only gzip is supported", base, name)
+		}
+
+		d := kafkaDecoder{b: payload}
+		for range count {
+			d.varint() // Length
+			d.int8()
+			d.varint() // Timestamp delta
+			r := kafkaRecord{offset: base + d.varint()}
+			d.varbytes() // Key
+			r.value = d.varbytes()
+			for range int(d.varint()) {
+				k := string(d.varbytes())
+				v := string(d.varbytes())
+				if d.err != nil {
+					break
+				}
+				if r.headers == nil {
+					r.headers = make(map[string]string)
+				}
+				r.headers[k] = v
+			}
+			if d.err != nil {
+				return nil, 0, fmt.Errorf("corrupt record batch at offset %d: %w", base, d.err)
+			}
+			records = append(records, r)
+		}
+	}
+	return records, next, nil
+}
+
+// kafkaEncoder encodes the fields of a request
+type kafkaEncoder []byte
+
+func (e *kafkaEncoder) int8(v int8)   { *e = append(*e, byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { *e = binary.BigEndian.AppendUint16(*e, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { *e = binary.BigEndian.AppendUint32(*e, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { *e = binary.BigEndian.AppendUint64(*e, uint64(v)) }
+func (e *kafkaEncoder) array(n int)   { e.int32(int32(n)) }
+func (e *kafkaEncoder) nullString()   { e.int16(-1) }
+
+// varint appends a zigzag varint, as records encode their fields
+func (e *kafkaEncoder) varint(v int64) { *e = binary.AppendVarint(*e, v) }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	*e = append(*e, s...)
+}
+
+// bytes appends b, or null when b is nil
+func (e *kafkaEncoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	*e = append(*e, b...)
+}
+
+// errKafkaShort is returned for responses that end before their fields
+var errKafkaShort = errors.New("truncated Kafka response")
+
+// kafkaDecoder decodes the fields of a response. Once a field is missing
+// err is set and the following fields read as zero.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errKafkaShort
+		return nil
+	}
+	p := d.b[:n:n]
+	d.b = d.b[n:]
+	return p
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if p := d.take(1); p != nil {
+		return int8(p[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if p := d.take(2); p != nil {
+		return int16(binary.BigEndian.Uint16(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if p := d.take(4); p != nil {
+		return int32(binary.BigEndian.Uint32(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if p := d.take(8); p != nil {
+		return int64(binary.BigEndian.Uint64(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// bytes reads a byte array, nil when null
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// array reads the length of an array, 0 when null
+func (d *kafkaDecoder) array() int {
+	n := int(d.int32())
+	if n < 0 {
+		return 0
+	}
+	if n > len(d.b) {
+		d.err = errKafkaShort
+		return 0
+	}
+	return n
+}
+
+func (d *kafkaDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errKafkaShort
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varbytes reads a varint-prefixed byte array, nil when null
+func (d *kafkaDecoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
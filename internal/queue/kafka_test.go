@@ -0,0 +1,751 @@
+package queue_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+// fakeKafka serves the part of the Kafka protocol the queue uses, as a
+// single broker leading every partition. Groups have one member at a time,
+// which the broker answers as their leader; fetches return each partition
+// as one record batch from offset 0, compressed with gzip when gzip is set.
+type fakeKafka struct {
+	listener net.Listener
+	gzip     bool
+
+	mu         sync.Mutex
+	topics     map[string][][]fakeKafkaRecord // Records by partition
+	committed  map[string]int64               // By group/topic/partition
+	commits    []string                       // partition:offset of each commit
+	generation int32
+	auths      []string // SASL PLAIN messages
+	left       []string // Members that left their group
+}
+
+type fakeKafkaRecord struct {
+	value   string
+	headers map[string]string
+}
+
+// newFakeKafka returns a broker with topics of the given partition counts
+func newFakeKafka(t *testing.T, topics map[string]int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeKafka{listener: l, topics: make(map[string][][]fakeKafkaRecord), committed: make(map[string]int64)}
+	for name, n := range topics {
+		f.topics[name] = make([][]fakeKafkaRecord, n)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeKafka) addr() string {
+	return f.listener.Addr().String()
+}
+
+// stored returns the values of the records of a partition
+func (f *fakeKafka) stored(topic string, partition int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var values []string
+	for _, r := range f.topics[topic][partition] {
+		values = append(values, r.value)
+	}
+	return values
+}
+
+func (f *fakeKafka) commitLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commits...)
+}
+
+func (f *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		r := &kafkaReader{b: req}
+		key := r.int16()
+		r.int16() // Version
+		correlation := r.int32()
+		r.string() // Client ID
+
+		w := &kafkaWriter{}
+		w.int32(correlation)
+		f.handle(key, r, w)
+		if _, err := conn.Write(binary.BigEndian.AppendUint32(nil, uint32(len(w.b)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(w.b); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a request, with the versions the queue sends
+func (f *fakeKafka) handle(key int16, r *kafkaReader, w *kafkaWriter) {
+	host, portText, _ := net.SplitHostPort(f.addr())
+	port, _ := strconv.Atoi(portText)
+	switch key {
+	case 17: // SaslHandshake v1
+		if r.string() == "PLAIN" {
+			w.int16(0)
+		} else {
+			w.int16(33)
+		}
+		w.int32(1)
+		w.string("PLAIN")
+
+	case 36: // SaslAuthenticate v0
+		auth := string(r.bytes())
+		f.mu.Lock()
+		f.auths = append(f.auths, auth)
+		f.mu.Unlock()
+		if strings.HasSuffix(auth, "\x00secret") {
+			w.int16(0)
+			w.int16(-1)
+		} else {
+			w.int16(58)
+			w.string("Authentication failed: Invalid username or password")
+		}
+		w.int32(0)
+
+	case 3: // Metadata v4
+		var names []string
+		for range r.int32() {
+			names = append(names, r.string())
+		}
+		w.int32(0)
+		w.int32(1)
+		w.int32(0)
+		w.string(host)
+		w.int32(int32(port))
+		w.int16(-1)
+		w.int16(-1)
+		w.int32(0)
+		w.int32(int32(len(names)))
+		f.mu.Lock()
+		for _, name := range names {
+			partitions, ok := f.topics[name]
+			if ok {
+				w.int16(0)
+			} else {
+				w.int16(3)
+			}
+			w.string(name)
+			w.int8(0)
+			w.int32(int32(len(partitions)))
+			for i := range partitions {
+				w.int16(0)
+				w.int32(int32(i))
+				w.int32(0) // Leader
+				w.int32(1)
+				w.int32(0)
+				w.int32(1)
+				w.int32(0)
+			}
+		}
+		f.mu.Unlock()
+
+	case 10: // FindCoordinator v1
+		w.int32(0)
+		w.int16(0)
+		w.int16(-1)
+		w.int32(0)
+		w.string(host)
+		w.int32(int32(port))
+
+	case 11: // JoinGroup v2
+		r.string()
+		r.int32()
+		r.int32()
+		member := r.string()
+		r.string()
+		r.int32()
+		protocol := r.string()
+		metadata := r.bytes()
+		if member == "" {
+			member = "member-1"
+		}
+		f.mu.Lock()
+		f.generation++
+		generation := f.generation
+		f.mu.Unlock()
+		w.int32(0)
+		w.int16(0)
+		w.int32(generation)
+		w.string(protocol)
+		w.string(member)
+		w.string(member)
+		w.int32(1)
+		w.string(member)
+		w.bytes(metadata)
+
+	case 14: // SyncGroup v1
+		r.string()
+		r.int32()
+		r.string()
+		var assignment []byte
+		for range r.int32() {
+			r.string()
+			assignment = r.bytes()
+		}
+		w.int32(0)
+		w.int16(0)
+		w.bytes(assignment)
+
+	case 12: // Heartbeat v1
+		w.int32(0)
+		w.int16(0)
+
+	case 13: // LeaveGroup v1
+		group, member := r.string(), r.string()
+		f.mu.Lock()
+		f.left = append(f.left, group+"/"+member)
+		f.mu.Unlock()
+		w.int32(0)
+		w.int16(0)
+
+	case 9: // OffsetFetch v1
+		group := r.string()
+		n := r.int32()
+		w.int32(n)
+		f.mu.Lock()
+		for range n {
+			topic := r.string()
+			w.string(topic)
+			partitions := r.int32()
+			w.int32(partitions)
+			for range partitions {
+				p := r.int32()
+				offset, ok := f.committed[group+"/"+topic+"/"+strconv.Itoa(int(p))]
+				if !ok {
+					offset = -1
+				}
+				w.int32(p)
+				w.int64(offset)
+				w.int16(-1)
+				w.int16(0)
+			}
+		}
+		f.mu.Unlock()
+
+	case 8: // OffsetCommit v2
+		group := r.string()
+		r.int32()
+		r.string()
+		r.int64()
+		n := r.int32()
+		w.int32(n)
+		f.mu.Lock()
+		for range n {
+			topic := r.string()
+			w.string(topic)
+			partitions := r.int32()
+			w.int32(partitions)
+			for range partitions {
+				p := r.int32()
+				offset := r.int64()
+				r.string()
+				f.committed[group+"/"+topic+"/"+strconv.Itoa(int(p))] = offset
+				f.commits = append(f.commits, strconv.Itoa(int(p))+":"+strconv.FormatInt(offset, 10))
+				w.int32(p)
+				w.int16(0)
+			}
+		}
+		f.mu.Unlock()
+
+	case 2: // ListOffsets v1
+		r.int32()
+		n := r.int32()
+		w.int32(n)
+		for range n {
+			w.string(r.string())
+			partitions := r.int32()
+			w.int32(partitions)
+			for range partitions {
+				w.int32(r.int32())
+				r.int64()
+				w.int16(0)
+				w.int64(-1)
+				w.int64(0) // Earliest
+			}
+		}
+
+	case 1: // Fetch v4
+		r.int32()
+		wait := time.Duration(r.int32()) * time.Millisecond
+		r.int32()
+		r.int32()
+		r.int8()
+		type request struct {
+			topic     string
+			partition int32
+			offset    int64
+		}
+		var reqs []request
+		for range r.int32() {
+			topic := r.string()
+			for range r.int32() {
+				reqs = append(reqs, request{topic, r.int32(), r.int64()})
+				r.int32()
+			}
+		}
+		available := func() bool {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for _, req := range reqs {
+				if int64(len(f.topics[req.topic][req.partition])) > req.offset {
+					return true
+				}
+			}
+			return false
+		}
+		for deadline := time.Now().Add(wait); !available() && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		w.int32(0)
+		w.int32(int32(len(reqs)))
+		f.mu.Lock()
+		for _, req := range reqs {
+			records := f.topics[req.topic][req.partition]
+			w.string(req.topic)
+			w.int32(1)
+			w.int32(req.partition)
+			w.int16(0)
+			w.int64(int64(len(records)))
+			w.int64(int64(len(records)))
+			w.int32(-1)
+			if int64(len(records)) > req.offset {
+				w.bytes(encodeTestBatch(records, f.gzip))
+			} else {
+				w.bytes(nil)
+			}
+		}
+		f.mu.Unlock()
+
+	case 0: // Produce v3
+		r.string()
+		r.int16()
+		r.int32()
+		n := r.int32()
+		w.int32(n)
+		f.mu.Lock()
+		for range n {
+			topic := r.string()
+			w.string(topic)
+			partitions := r.int32()
+			w.int32(partitions)
+			for range partitions {
+				p := r.int32()
+				batch := r.bytes()
+				w.int32(p)
+				if _, ok := f.topics[topic]; !ok {
+					w.int16(3)
+					w.int64(-1)
+					w.int64(-1)
+					continue
+				}
+				records, err := decodeTestBatch(batch)
+				if err != nil {
+					w.int16(2) // CORRUPT_MESSAGE
+					w.int64(-1)
+					w.int64(-1)
+					continue
+				}
+				w.int16(0)
+				w.int64(int64(len(f.topics[topic][p])))
+				w.int64(-1)
+				f.topics[topic][p] = append(f.topics[topic][p], records...)
+			}
+		}
+		f.mu.Unlock()
+		w.int32(0)
+	}
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeTestBatch encodes records as a batch from offset 0
+func encodeTestBatch(records []fakeKafkaRecord, compress bool) []byte {
+	payload := &kafkaWriter{}
+	for i, r := range records {
+		rec := &kafkaWriter{}
+		rec.int8(0)
+		rec.varint(0)
+		rec.varint(int64(i))
+		rec.varint(-1)
+		rec.varint(int64(len(r.value)))
+		rec.b = append(rec.b, r.value...)
+		rec.varint(int64(len(r.headers)))
+		for k, v := range r.headers {
+			rec.varint(int64(len(k)))
+			rec.b = append(rec.b, k...)
+			rec.varint(int64(len(v)))
+			rec.b = append(rec.b, v...)
+		}
+		payload.varint(int64(len(rec.b)))
+		payload.b = append(payload.b, rec.b...)
+	}
+	attributes := int16(0)
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(payload.b)
+		zw.Close()
+		payload.b, attributes = buf.Bytes(), 1
+	}
+
+	batch := &kafkaWriter{}
+	batch.int16(attributes)
+	batch.int32(int32(len(records) - 1))
+	batch.int64(0)
+	batch.int64(0)
+	batch.int64(-1)
+	batch.int16(-1)
+	batch.int32(-1)
+	batch.int32(int32(len(records)))
+	batch.b = append(batch.b, payload.b...)
+
+	out := &kafkaWriter{}
+	out.int64(0)
+	out.int32(int32(9 + len(batch.b)))
+	out.int32(-1)
+	out.int8(2)
+	out.int32(int32(crc32.Checksum(batch.b, castagnoli)))
+	return append(out.b, batch.b...)
+}
+
+// decodeTestBatch decodes an uncompressed record batch of format v2
+func decodeTestBatch(b []byte) ([]fakeKafkaRecord, error) {
+	if len(b) < 61 || b[16] != 2 || crc32.Checksum(b[21:], castagnoli) != binary.BigEndian.Uint32(b[17:]) {
+		return nil, errors.New("invalid record batch")
+	}
+	r := &kafkaReader{b: b[61:]}
+	var records []fakeKafkaRecord
+	for range binary.BigEndian.Uint32(b[57:]) {
+		r.varint()
+		r.int8()
+		r.varint()
+		r.varint()
+		r.varbytes()
+		rec := fakeKafkaRecord{value: string(r.varbytes())}
+		for range r.varint() {
+			if rec.headers == nil {
+				rec.headers = make(map[string]string)
+			}
+			k := string(r.varbytes())
+			rec.headers[k] = string(r.varbytes())
+		}
+		records = append(records, rec)
+	}
+	return records, r.err
+}
+
+type kafkaWriter struct{ b []byte }
+
+func (w *kafkaWriter) int8(v int8)     { w.b = append(w.b, byte(v)) }
+func (w *kafkaWriter) int16(v int16)   { w.b = binary.BigEndian.AppendUint16(w.b, uint16(v)) }
+func (w *kafkaWriter) int32(v int32)   { w.b = binary.BigEndian.AppendUint32(w.b, uint32(v)) }
+func (w *kafkaWriter) int64(v int64)   { w.b = binary.BigEndian.AppendUint64(w.b, uint64(v)) }
+func (w *kafkaWriter) varint(v int64)  { w.b = binary.AppendVarint(w.b, v) }
+func (w *kafkaWriter) string(s string) { w.int16(int16(len(s))); w.b = append(w.b, s...) }
+
+func (w *kafkaWriter) bytes(b []byte) {
+	if b == nil {
+		w.int32(-1)
+		return
+	}
+	w.int32(int32(len(b)))
+	w.b = append(w.b, b...)
+}
+
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.b) {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, max(n, 8))
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *kafkaReader) int8() int8   { return int8(r.take(1)[0]) }
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.take(2))) }
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.take(4))) }
+func (r *kafkaReader) int64() int64 { return int64(binary.BigEndian.Uint64(r.take(8))) }
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func (r *kafkaReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) varbytes() []byte {
+	n := r.varint()
+	if n < 0 {
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func newKafka(t *testing.T, fake *fakeKafka, topic string) *queue.KafkaQueue {
+	q, err := queue.NewKafkaQueue(queue.KafkaConfig{
+		Brokers:    []string{fake.addr()},
+		Topic:      topic,
+		Wait:       100 * time.Millisecond,
+		RetryDelay: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestKafkaQueue(t *testing.T) {
+	fake := newFakeKafka(t, map[string]int{"invoices": 2})
+	q, err := queue.NewKafkaQueue(queue.KafkaConfig{
+		Brokers:  []string{fake.addr()},
+		Topic:    "invoices",
+		User:     "processor",
+		Password: "secret",
+		Wait:     100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, q.Publish(ctx, []byte("<Invoice/>"), map[string]string{queue.AttrDocumentID: "doc-1", queue.AttrFilename: "a.xml"}))
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":"doc-2"}`), nil))
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":"doc-3"}`), nil))
+	assert.Equal(t, []string{"<Invoice/>", `{"id":"doc-3"}`}, fake.stored("invoices", 0), "round robin")
+	assert.Equal(t, []string{`{"id":"doc-2"}`}, fake.stored("invoices", 1))
+
+	msgs, err := q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "invoices/0/0", msgs[0].ID)
+	assert.Equal(t, "<Invoice/>", string(msgs[0].Body))
+	assert.Equal(t, 1, msgs[0].Attempts)
+	assert.Equal(t, map[string]string{queue.AttrDocumentID: "doc-1", queue.AttrFilename: "a.xml"}, msgs[0].Attributes)
+	assert.Equal(t, "invoices/0/1", msgs[1].ID)
+	assert.Nil(t, msgs[1].Attributes)
+	assert.Equal(t, "invoices/1/0", msgs[2].ID)
+
+	for _, msg := range msgs {
+		require.NoError(t, q.Ack(ctx, msg))
+	}
+	assert.Equal(t, []string{"0:1", "0:2", "1:1"}, fake.commitLog())
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	// A new member of the group resumes from the committed offsets
+	require.NoError(t, q.Close())
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":"doc-4"}`), nil))
+	q = newKafka(t, fake, "invoices")
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "invoices/1/1", msgs[0].ID)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, []string{"\x00processor\x00secret", "\x00processor\x00secret"}, fake.auths, "connected again after Close")
+	assert.Equal(t, []string{queue.DefaultKafkaGroup + "/member-1"}, fake.left)
+}
+
+func TestKafkaQueue_CommitsOnlyAcknowledged(t *testing.T) {
+	fake := newFakeKafka(t, map[string]int{"invoices": 1})
+	q := newKafka(t, fake, "invoices")
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Publish(ctx, []byte(id), nil))
+	}
+
+	msgs, err := q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+
+	// The offset stops at a failed message until it is acknowledged
+	require.NoError(t, q.Nack(ctx, msgs[0]))
+	require.NoError(t, q.Ack(ctx, msgs[1]))
+	require.NoError(t, q.Ack(ctx, msgs[2]))
+	assert.Empty(t, fake.commitLog())
+
+	time.Sleep(60 * time.Millisecond)
+	retried, err := q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, retried, 1)
+	assert.Equal(t, "invoices/0/0", retried[0].ID)
+	assert.Equal(t, 2, retried[0].Attempts)
+	require.NoError(t, q.Ack(ctx, retried[0]))
+	assert.Equal(t, []string{"0:3"}, fake.commitLog())
+
+	// Messages left unacknowledged go to the next member of the group
+	require.NoError(t, q.Publish(ctx, []byte("d"), nil))
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.NoError(t, q.Close())
+	assert.ErrorContains(t, q.Ack(ctx, msgs[0]), "will be delivered again")
+
+	q = newKafka(t, fake, "invoices")
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "d", string(msgs[0].Body))
+	assert.Equal(t, 1, msgs[0].Attempts)
+}
+
+func TestKafkaQueue_Gzip(t *testing.T) {
+	fake := newFakeKafka(t, map[string]int{"invoices": 1})
+	fake.gzip = true
+	q := newKafka(t, fake, "invoices")
+	ctx := context.Background()
+	require.NoError(t, q.Publish(ctx, []byte("a"), map[string]string{queue.AttrFilename: "a.xml"}))
+	require.NoError(t, q.Publish(ctx, []byte("b"), nil))
+
+	msgs, err := q.Receive(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "a", string(msgs[0].Body))
+	assert.Equal(t, "a.xml", msgs[0].Attributes[queue.AttrFilename])
+
+	// The rest of the batch is skipped to the next offset
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "b", string(msgs[0].Body))
+}
+
+func TestKafkaQueue_Consumer(t *testing.T) {
+	fake := newFakeKafka(t, map[string]int{"invoices": 2, "results": 1, "invoices-dlq": 1})
+	in, out, dlq := newKafka(t, fake, "invoices"), newKafka(t, fake, "results"), newKafka(t, fake, "invoices-dlq")
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), map[string]string{queue.AttrDocumentID: "raw-1"}))
+	require.NoError(t, in.Publish(ctx, []byte(`{"id":"x"}`), nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"0:1", "1:1"}, fake.commitLog())
+
+	results := fake.stored("results", 0)
+	require.Len(t, results, 1)
+	var output queue.Output
+	require.NoError(t, json.Unmarshal([]byte(results[0]), &output))
+	assert.Equal(t, "invoices/0/0", output.MessageID)
+	assert.Equal(t, "raw-1", output.DocumentID)
+	require.Len(t, output.Results, 1)
+	assert.Equal(t, "0000042", output.Results[0].Invoice.Number)
+
+	assert.Equal(t, []string{`{"id":"x"}`}, fake.stored("invoices-dlq", 0))
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	dead := fake.topics["invoices-dlq"][0][0]
+	assert.Equal(t, "invoices/1/0", dead.headers[queue.AttrMessageID])
+	assert.Contains(t, dead.headers[queue.AttrError], "neither data nor url")
+}
+
+func TestKafkaQueue_RetriesThenDeadLetters(t *testing.T) {
+	fake := newFakeKafka(t, map[string]int{"invoices": 1, "results": 1, "invoices-dlq": 1})
+	in, out, dlq := newKafka(t, fake, "invoices"), newKafka(t, fake, "results"), newKafka(t, fake, "invoices-dlq")
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(`{"id":"x","url":"http://docs.example.com/x.pdf"}`), nil))
+
+	fetch := func(context.Context, string) ([]byte, error) { return nil, errors.New("connection refused") }
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq, Fetch: fetch, MaxAttempts: 2})
+	require.NoError(t, err)
+	_, err = c.Poll(ctx)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Empty(t, fake.commitLog(), "not committed while it may be retried")
+
+	time.Sleep(60 * time.Millisecond)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"0:1"}, fake.commitLog())
+	assert.Len(t, fake.stored("invoices-dlq", 0), 1)
+}
+
+func TestKafkaQueue_Errors(t *testing.T) {
+	for _, cfg := range []queue.KafkaConfig{
+		{Topic: ""},
+		{Topic: "invoices/2024"},
+		{Topic: "invoices", Brokers: []string{"localhost"}},
+	} {
+		_, err := queue.NewKafkaQueue(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+
+	fake := newFakeKafka(t, map[string]int{"invoices": 1})
+	ctx := context.Background()
+	q := newKafka(t, fake, "nowhere")
+	assert.ErrorContains(t, q.Publish(ctx, []byte("x"), nil), "failed to look up topic nowhere: Kafka returned error 3 (UNKNOWN_TOPIC_OR_PARTITION)")
+
+	q, err := queue.NewKafkaQueue(queue.KafkaConfig{Brokers: []string{fake.addr()}, Topic: "invoices", User: "processor", Password: "wrong"})
+	require.NoError(t, err)
+	_, err = q.Receive(ctx, 1)
+	assert.ErrorContains(t, err, "SASL authentication failed: Authentication failed: Invalid username or password")
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultVisibilityTimeout is how long a received message is hidden from
+// other receives before it is delivered again, unless acknowledged
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// MemoryQueue is a Source and Publisher held in memory, for tests and
+// single-process deployments
+type MemoryQueue struct {
+	// VisibilityTimeout (default: DefaultVisibilityTimeout; negative
+	// redelivers unacknowledged messages on the next receive)
+	VisibilityTimeout time.Duration
+
+	mu       sync.Mutex
+	messages []*memoryMessage
+	nextID   int
+}
+
+type memoryMessage struct {
+	msg       Message
+	invisible time.Time
+}
+
+// NewMemoryQueue returns an empty queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{VisibilityTimeout: DefaultVisibilityTimeout}
+}
+
+// Publish appends a message
+func (q *MemoryQueue) Publish(_ context.Context, body []byte, attributes map[string]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	attrs := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	id := strconv.Itoa(q.nextID)
+	q.messages = append(q.messages, &memoryMessage{msg: Message{ID: id, Body: body, Attributes: attrs}})
+	return nil
+}
+
+// Receive returns up to n visible messages, oldest first, and hides them
+// for the visibility timeout
+func (q *MemoryQueue) Receive(_ context.Context, n int) ([]*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var msgs []*Message
+	for _, m := range q.messages {
+		if len(msgs) == n {
+			break
+		}
+		if now.Before(m.invisible) {
+			continue
+		}
+		m.msg.Attempts++
+		m.msg.Handle = m.msg.ID + "/" + strconv.Itoa(m.msg.Attempts)
+		m.invisible = now.Add(q.VisibilityTimeout)
+		msg := m.msg
+		msgs = append(msgs, &msg)
+	}
+	return msgs, nil
+}
+
+// Ack removes a message. Acknowledging a delivery that has timed out and
+// been received again does nothing, as with SQS receipt handles.
+func (q *MemoryQueue) Ack(_ context.Context, msg *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, m := range q.messages {
+		if m.msg.Handle == msg.Handle {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Messages returns the messages in the queue, received or not
+func (q *MemoryQueue) Messages() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msgs := make([]Message, len(q.messages))
+	for i, m := range q.messages {
+		msgs[i] = m.msg
+	}
+	return msgs
+}
@@ -0,0 +1,694 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for NATSConfig
+const (
+	DefaultNATSURL      = "nats://localhost:4222"
+	DefaultNATSDurable  = "invoice-processor"
+	DefaultNATSAckWait  = 5 * time.Minute
+	DefaultNATSWait     = 5 * time.Second
+	DefaultNATSNakDelay = 10 * time.Second
+)
+
+// natsTimeout bounds the handshake, writes and requests (JetStream API
+// calls, publishes and acks)
+const natsTimeout = 10 * time.Second
+
+// NATSConfig configures a NATSQueue
+type NATSConfig struct {
+	// URL of the server, nats:// or tls://, with user:password@ or token@
+	// credentials (default: DefaultNATSURL)
+	URL       string
+	TLSConfig *tls.Config // For tls:// URLs and servers requiring TLS
+
+	Subject string // Subject published to and consumed
+	Stream  string // JetStream stream storing Subject (default: looked up by subject)
+
+	// Durable names the pull consumer reading Subject, created if missing
+	// (default: DefaultNATSDurable)
+	Durable string
+
+	// AckWait is how long a delivered message may stay unacknowledged, e.g.
+	// by a consumer that crashed, before it is redelivered; set when the
+	// consumer is created (default: DefaultNATSAckWait)
+	AckWait time.Duration
+	Wait    time.Duration // Wait for new messages per receive (default: DefaultNATSWait)
+
+	// NakDelay is how long a message the consumer failed to handle waits
+	// before it is redelivered (default: DefaultNATSNakDelay)
+	NakDelay time.Duration
+}
+
+// NATSQueue is a Source and Publisher on a subject of a NATS JetStream
+// stream, speaking the NATS text protocol. Messages are read through a
+// durable pull consumer with explicit acks, with JetStream's delivery count
+// as attempts; messages that fail are negatively acknowledged, to be
+// redelivered after NakDelay. Attributes travel as message headers.
+type NATSQueue struct {
+	cfg                   NATSConfig
+	addr                  string
+	tls                   bool
+	user, password, token string
+
+	mu    sync.Mutex
+	conn  *natsConn
+	ready bool // Stream and consumer set up
+}
+
+// NewNATSQueue returns the queue on cfg.Subject. It connects on first use,
+// and again after the connection is lost.
+func NewNATSQueue(cfg NATSConfig) (*NATSQueue, error) {
+	if cfg.URL == "" {
+		cfg.URL = DefaultNATSURL
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "nats" && u.Scheme != "tls") {
+		return nil, fmt.Errorf("invalid NATS URL %q", cfg.URL)
+	}
+	if cfg.Subject == "" || strings.ContainsAny(cfg.Subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid NATS subject %q", cfg.Subject)
+	}
+	if cfg.Durable == "" {
+		cfg.Durable = DefaultNATSDurable
+	}
+	for _, name := range []string{cfg.Stream, cfg.Durable} {
+		if strings.ContainsAny(name, " \t\r\n.*>") {
+			return nil, fmt.Errorf("invalid JetStream name %q", name)
+		}
+	}
+	if cfg.AckWait <= 0 {
+		cfg.AckWait = DefaultNATSAckWait
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = DefaultNATSWait
+	}
+	if cfg.NakDelay <= 0 {
+		cfg.NakDelay = DefaultNATSNakDelay
+	}
+
+	q := &NATSQueue{cfg: cfg, addr: u.Host, tls: u.Scheme == "tls"}
+	if u.Port() == "" {
+		q.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if password, ok := u.User.Password(); ok {
+		q.user, q.password = u.User.Username(), password
+	} else if u.User != nil {
+		q.token = u.User.Username()
+	}
+	return q, nil
+}
+
+// Receive pulls up to n messages, waiting up to Wait for the first
+func (q *NATSQueue) Receive(ctx context.Context, n int) ([]*Message, error) {
+	c, err := q.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.ensureConsumer(ctx, c); err != nil {
+		return nil, err
+	}
+
+	n = max(n, 1)
+	sid, reply, replies, err := c.subscribe(n + 1)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unsubscribe(sid)
+	req, _ := json.Marshal(map[string]int64{"batch": int64(n), "expires": int64(q.cfg.Wait)})
+	if err := c.publish("$JS.API.CONSUMER.MSG.NEXT."+q.cfg.Stream+"."+q.cfg.Durable, reply, nil, req); err != nil {
+		return nil, err
+	}
+
+	// The server ends a short batch with a status once Wait expires
+	timer := time.NewTimer(q.cfg.Wait + time.Second)
+	defer timer.Stop()
+	msgs := make([]*Message, 0, n)
+	for len(msgs) < n {
+		select {
+		case m := <-replies:
+			switch {
+			case m.status == 0:
+				msgs = append(msgs, natsMessage(m))
+			case m.status == 404 || m.status == 408 || len(msgs) > 0:
+				return msgs, nil
+			default:
+				return nil, fmt.Errorf("failed to pull messages: NATS returned %d %s", m.status, m.description)
+			}
+		case <-timer.C:
+			return msgs, nil
+		case <-ctx.Done():
+			return msgs, nil
+		case <-c.done:
+			if len(msgs) > 0 {
+				return msgs, nil
+			}
+			return nil, c.failure()
+		}
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges a message, waiting for the server to confirm it
+func (q *NATSQueue) Ack(ctx context.Context, msg *Message) error {
+	c, err := q.connect(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.request(ctx, msg.Handle, nil, []byte("+ACK"))
+	return err
+}
+
+// Nack negatively acknowledges a message, for JetStream to redeliver it
+// after NakDelay rather than AckWait
+func (q *NATSQueue) Nack(ctx context.Context, msg *Message) error {
+	c, err := q.connect(ctx)
+	if err != nil {
+		return err
+	}
+	return c.publish(msg.Handle, "", nil, fmt.Appendf(nil, `-NAK {"delay":%d}`, int64(q.cfg.NakDelay)))
+}
+
+// Publish stores a message in the stream of Subject, with attributes as
+// headers
+func (q *NATSQueue) Publish(ctx context.Context, body []byte, attributes map[string]string) error {
+	c, err := q.connect(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := c.request(ctx, q.cfg.Subject, attributes, body)
+	if errors.Is(err, errNoResponders) {
+		return fmt.Errorf("no JetStream stream stores subject %s", q.cfg.Subject)
+	}
+	if err != nil {
+		return err
+	}
+	var ack struct {
+		Error *natsAPIError `json:"error"`
+	}
+	if err := json.Unmarshal(m.data, &ack); err != nil {
+		return fmt.Errorf("invalid JetStream publish acknowledgement: %w", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("failed to publish to %s: %w", q.cfg.Subject, ack.Error)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (q *NATSQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.conn == nil {
+		return nil
+	}
+	err := q.conn.conn.Close()
+	<-q.conn.done
+	q.conn = nil
+	return err
+}
+
+// connect returns the connection, dialing it if there is none or it was lost
+func (q *NATSQueue) connect(ctx context.Context) (*natsConn, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.conn != nil {
+		select {
+		case <-q.conn.done:
+			q.conn = nil
+		default:
+			return q.conn, nil
+		}
+	}
+	c, err := q.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS at %s: %w", q.addr, err)
+	}
+	q.conn = c
+	return c, nil
+}
+
+// ensureConsumer looks up the stream of Subject and creates the durable
+// consumer once
+func (q *NATSQueue) ensureConsumer(ctx context.Context, c *natsConn) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready {
+		return nil
+	}
+	if q.cfg.Stream == "" {
+		var resp struct {
+			Streams []string `json:"streams"`
+		}
+		if err := c.api(ctx, "STREAM.NAMES", map[string]string{"subject": q.cfg.Subject}, &resp); err != nil {
+			return fmt.Errorf("failed to look up the stream of %s: %w", q.cfg.Subject, err)
+		}
+		if len(resp.Streams) == 0 {
+			return fmt.Errorf("no JetStream stream stores subject %s", q.cfg.Subject)
+		}
+		q.cfg.Stream = resp.Streams[0]
+	}
+
+	name := q.cfg.Stream + "." + q.cfg.Durable
+	err := c.api(ctx, "CONSUMER.INFO."+name, nil, nil)
+	var apiErr *natsAPIError
+	if errors.As(err, &apiErr) && apiErr.ErrCode == natsConsumerNotFound {
+		err = c.api(ctx, "CONSUMER.DURABLE.CREATE."+name, map[string]any{
+			"stream_name": q.cfg.Stream,
+			"config": map[string]any{
+				"durable_name":   q.cfg.Durable,
+				"deliver_policy": "all",
+				"ack_policy":     "explicit",
+				"ack_wait":       int64(q.cfg.AckWait),
+				"filter_subject": q.cfg.Subject,
+			},
+		}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up consumer %s: %w", q.cfg.Durable, err)
+	}
+	q.ready = true
+	return nil
+}
+
+// dial connects and authenticates, upgrading to TLS when asked or required
+func (q *NATSQueue) dial(ctx context.Context) (*natsConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", q.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+		Headers     bool `json:"headers"`
+		MaxPayload  int  `json:"max_payload"`
+	}
+	if !ok || json.Unmarshal([]byte(infoJSON), &info) != nil {
+		conn.Close()
+		return nil, errors.New("not a NATS server")
+	}
+	if !info.Headers {
+		conn.Close()
+		return nil, errors.New("NATS server doesn't support headers")
+	}
+
+	if q.tls || info.TLSRequired {
+		cfg := &tls.Config{}
+		if q.cfg.TLSConfig != nil {
+			cfg = q.cfg.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(q.addr)
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect, _ := json.Marshal(map[string]any{
+		"verbose": false, "pedantic": false, "tls_required": q.tls || info.TLSRequired,
+		"name": "invoice-processor", "lang": "go", "version": "1", "protocol": 1,
+		"headers": true, "no_responders": true,
+		"user": q.user, "pass": q.password, "auth_token": q.token,
+	})
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, fmt.Errorf("NATS refused the connection: %s", natsErrorText(line))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	token := make([]byte, 8)
+	rand.Read(token)
+	c := &natsConn{
+		conn:       conn,
+		r:          r,
+		inbox:      "_INBOX." + hex.EncodeToString(token),
+		maxPayload: info.MaxPayload,
+		replies:    make(map[int]chan *natsMsg),
+		done:       make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// natsConsumerNotFound is JetStream's error code for a missing consumer
+const natsConsumerNotFound = 10014
+
+// errNoResponders is returned for requests to subjects nobody serves
+var errNoResponders = errors.New("no responders")
+
+// natsAPIError is an error returned by JetStream
+type natsAPIError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *natsAPIError) Error() string {
+	return fmt.Sprintf("JetStream returned %d: %s", e.Code, e.Description)
+}
+
+// natsMsg is a message delivered by the server
+type natsMsg struct {
+	subject, reply string
+	status         int // Of status messages, such as 404 for no messages
+	description    string
+	header         map[string]string
+	data           []byte
+}
+
+// natsConn is a connection to a NATS server. A reader goroutine routes
+// messages to the subscriptions of pending requests.
+type natsConn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	inbox      string
+	maxPayload int
+
+	wmu sync.Mutex // Serializes writes
+
+	mu      sync.Mutex
+	nextSID int
+	replies map[int]chan *natsMsg // By subscription ID
+	err     error                 // Why the connection was lost
+	done    chan struct{}         // Closed once it is
+}
+
+// api calls the JetStream API, decoding the response into out
+func (c *natsConn) api(ctx context.Context, subject string, in, out any) error {
+	var payload []byte
+	if in != nil {
+		payload, _ = json.Marshal(in)
+	}
+	m, err := c.request(ctx, "$JS.API."+subject, nil, payload)
+	if errors.Is(err, errNoResponders) {
+		return errors.New("JetStream is not enabled")
+	}
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Error *natsAPIError `json:"error"`
+	}
+	if err := json.Unmarshal(m.data, &resp); err != nil {
+		return fmt.Errorf("invalid JetStream %s response: %w", subject, err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(m.data, out)
+}
+
+// request publishes data to subject and waits for the reply
+func (c *natsConn) request(ctx context.Context, subject string, header map[string]string, data []byte) (*natsMsg, error) {
+	sid, reply, replies, err := c.subscribe(1)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unsubscribe(sid)
+	if err := c.publish(subject, reply, header, data); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(natsTimeout)
+	defer timer.Stop()
+	select {
+	case m := <-replies:
+		if m.status == 503 {
+			return nil, errNoResponders
+		}
+		return m, nil
+	case <-c.done:
+		return nil, c.failure()
+	case <-timer.C:
+		return nil, fmt.Errorf("NATS request to %s timed out", subject)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// subscribe subscribes to a new inbox subject, returning the channel its
+// messages are sent to; messages that don't fit are dropped
+func (c *natsConn) subscribe(size int) (sid int, subject string, replies chan *natsMsg, err error) {
+	c.mu.Lock()
+	c.nextSID++
+	sid = c.nextSID
+	replies = make(chan *natsMsg, size)
+	c.replies[sid] = replies
+	c.mu.Unlock()
+
+	subject = c.inbox + "." + strconv.Itoa(sid)
+	if err := c.write(fmt.Appendf(nil, "SUB %s %d\r\n", subject, sid)); err != nil {
+		c.unsubscribe(sid)
+		return 0, "", nil, err
+	}
+	return sid, subject, replies, nil
+}
+
+func (c *natsConn) unsubscribe(sid int) {
+	c.mu.Lock()
+	delete(c.replies, sid)
+	c.mu.Unlock()
+	c.write(fmt.Appendf(nil, "UNSUB %d\r\n", sid))
+}
+
+// publish sends a message, with headers when header is not nil
+func (c *natsConn) publish(subject, reply string, header map[string]string, data []byte) error {
+	var buf bytes.Buffer
+	if header == nil {
+		fmt.Fprintf(&buf, "PUB %s %s%d\r\n", subject, natsReplyArg(reply), len(data))
+	} else {
+		hdr := encodeNATSHeader(header)
+		fmt.Fprintf(&buf, "HPUB %s %s%d %d\r\n", subject, natsReplyArg(reply), len(hdr), len(hdr)+len(data))
+		buf.Write(hdr)
+	}
+	if size := buf.Len() + len(data); c.maxPayload > 0 && size > c.maxPayload {
+		return fmt.Errorf("message of %d bytes is larger than the NATS maximum of %d", size, c.maxPayload)
+	}
+	buf.Write(data)
+	buf.WriteString("\r\n")
+	return c.write(buf.Bytes())
+}
+
+func (c *natsConn) write(p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(natsTimeout))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// failure returns why the connection was lost
+func (c *natsConn) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Errorf("NATS connection lost: %w", c.err)
+}
+
+func (c *natsConn) readLoop() {
+	err := c.read()
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	c.conn.Close()
+	close(c.done)
+}
+
+// read reads server operations until the connection fails. Errors the
+// server reports before closing the connection are returned instead.
+func (c *natsConn) read() error {
+	var serverErr error
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			if serverErr != nil {
+				return serverErr
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "MSG", "HMSG":
+			sid, m, err := c.readMsg(strings.EqualFold(op, "HMSG"), strings.Fields(args))
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			replies := c.replies[sid]
+			c.mu.Unlock()
+			if replies != nil {
+				select {
+				case replies <- m:
+				default:
+				}
+			}
+		case "PING":
+			if err := c.write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case "-ERR":
+			serverErr = errors.New(natsErrorText(line))
+		}
+	}
+}
+
+// readMsg reads the payload of a MSG or HMSG operation, whose arguments are
+// <subject> <sid> [reply] [<header bytes>] <total bytes>
+func (c *natsConn) readMsg(headers bool, args []string) (int, *natsMsg, error) {
+	n := 3
+	if headers {
+		n = 4
+	}
+	if len(args) != n && len(args) != n+1 {
+		return 0, nil, fmt.Errorf("invalid NATS message arguments %q", strings.Join(args, " "))
+	}
+	sid, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid NATS subscription ID %q", args[1])
+	}
+	total, err := strconv.Atoi(args[len(args)-1])
+	hdrLen := 0
+	if err == nil && headers {
+		hdrLen, err = strconv.Atoi(args[len(args)-2])
+	}
+	if err != nil || total < 0 || hdrLen < 0 || hdrLen > total {
+		return 0, nil, fmt.Errorf("invalid NATS message size %q", strings.Join(args, " "))
+	}
+
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return 0, nil, err
+	}
+	m := &natsMsg{subject: args[0], data: buf[hdrLen:total]}
+	if len(args) == n+1 {
+		m.reply = args[2]
+	}
+	if headers {
+		parseNATSHeader(m, buf[:hdrLen])
+	}
+	return sid, m, nil
+}
+
+// natsMessage reads a message pulled from a consumer. Its ack subject,
+// $JS.ACK.[<domain>.<account hash>.]<stream>.<consumer>.<deliveries>.<stream sequence>...,
+// gives the attempts and the ID.
+func natsMessage(m *natsMsg) *Message {
+	msg := &Message{ID: m.reply, Body: m.data, Handle: m.reply}
+	tokens := strings.Split(m.reply, ".")
+	i := 0
+	switch {
+	case len(tokens) == 9:
+		i = 4
+	case len(tokens) >= 11:
+		i = 6
+	}
+	if i > 0 {
+		msg.Attempts, _ = strconv.Atoi(tokens[i])
+		msg.ID = tokens[i+1]
+	}
+	if len(m.header) > 0 {
+		msg.Attributes = m.header
+	}
+	return msg
+}
+
+// natsHeaderValue drops line breaks, which would end a header
+var natsHeaderValue = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// encodeNATSHeader encodes a header block, keeping the case of keys
+func encodeNATSHeader(header map[string]string) []byte {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b bytes.Buffer
+	b.WriteString("NATS/1.0\r\n")
+	for _, k := range keys {
+		b.WriteString(k + ": " + natsHeaderValue.Replace(header[k]) + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// parseNATSHeader reads a header block, whose first line may carry a
+// status such as "NATS/1.0 404 No Messages"
+func parseNATSHeader(m *natsMsg, data []byte) {
+	lines := strings.Split(string(data), "\r\n")
+	if status, ok := strings.CutPrefix(lines[0], "NATS/1.0"); ok {
+		code, description, _ := strings.Cut(strings.TrimSpace(status), " ")
+		m.status, _ = strconv.Atoi(code)
+		m.description = description
+	}
+	for _, line := range lines[1:] {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || k == "" {
+			continue
+		}
+		if m.header == nil {
+			m.header = make(map[string]string)
+		}
+		m.header[k] = strings.TrimSpace(v)
+	}
+}
+
+func natsReplyArg(reply string) string {
+	if reply == "" {
+		return ""
+	}
+	return reply + " "
+}
+
+// natsErrorText returns the message of an -ERR operation
+func natsErrorText(line string) string {
+	return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'")
+}
@@ -0,0 +1,355 @@
+package queue_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+// fakeNATS serves the part of the NATS protocol and JetStream API the queue
+// uses, for a stream INVOICES storing every subject. Unacknowledged
+// messages are delivered again on every pull.
+type fakeNATS struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	connects  []map[string]any
+	consumers map[string]map[string]any // Config by durable name
+	messages  []*fakeNATSMessage
+	naks      []string // Ack subjects and payloads of negative acks
+}
+
+type fakeNATSMessage struct {
+	subject    string
+	header     string
+	data       string
+	deliveries int
+	acked      bool
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeNATS{listener: l, consumers: make(map[string]map[string]any)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) url() string {
+	return "nats://" + f.listener.Addr().String()
+}
+
+// stored returns the data and headers of the messages published to subject
+func (f *fakeNATS) stored(subject string) (data, headers []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.messages {
+		if m.subject == subject {
+			data = append(data, m.data)
+			headers = append(headers, m.header)
+		}
+	}
+	return data, headers
+}
+
+// consumer returns the config of a durable consumer
+func (f *fakeNATS) consumer(durable string) map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.consumers[durable]
+}
+
+// unacked counts the messages of subject not acknowledged
+func (f *fakeNATS) unacked(subject string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, m := range f.messages {
+		if m.subject == subject && !m.acked {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	subs := make(map[string]string) // Subscription IDs by subject
+	send := func(format string, args ...any) { fmt.Fprintf(conn, format, args...) }
+	reply := func(to, data string) {
+		if sid, ok := subs[to]; ok {
+			send("MSG %s %s %d\r\n%s\r\n", to, sid, len(data), data)
+		}
+	}
+	status := func(to, line string) {
+		if sid, ok := subs[to]; ok {
+			hdr := "NATS/1.0 " + line + "\r\n\r\n"
+			send("HMSG %s %s %d %d\r\n%s\r\n", to, sid, len(hdr), len(hdr), hdr)
+		}
+	}
+
+	send("INFO {\"server_id\":\"fake\",\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		fields := strings.Fields(args)
+		switch op {
+		case "CONNECT":
+			var opts map[string]any
+			json.Unmarshal([]byte(args), &opts)
+			f.mu.Lock()
+			f.connects = append(f.connects, opts)
+			f.mu.Unlock()
+			if opts["auth_token"] == "wrong" {
+				send("-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			send("PONG\r\n")
+		case "SUB":
+			subs[fields[0]] = fields[1]
+		case "UNSUB":
+			for subject, sid := range subs {
+				if sid == fields[0] {
+					delete(subs, subject)
+				}
+			}
+		case "PUB", "HPUB":
+			to := ""
+			if len(fields) == 3 || (op == "HPUB" && len(fields) == 4) {
+				to = fields[1]
+			}
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			hdrLen := 0
+			if op == "HPUB" {
+				hdrLen, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			payload := make([]byte, total+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			f.handle(fields[0], to, string(payload[:hdrLen]), string(payload[hdrLen:total]), subs, send, reply, status)
+		}
+	}
+}
+
+// handle answers a published message
+func (f *fakeNATS) handle(subject, to, header, data string, subs map[string]string, send func(string, ...any), reply, status func(string, string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case subject == "$JS.API.STREAM.NAMES":
+		reply(to, `{"total":1,"streams":["INVOICES"]}`)
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.INFO.INVOICES."):
+		durable := strings.TrimPrefix(subject, "$JS.API.CONSUMER.INFO.INVOICES.")
+		if _, ok := f.consumers[durable]; !ok {
+			reply(to, `{"error":{"code":404,"err_code":10014,"description":"consumer not found"}}`)
+			return
+		}
+		reply(to, `{"name":"`+durable+`"}`)
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.DURABLE.CREATE.INVOICES."):
+		var req struct {
+			Config map[string]any `json:"config"`
+		}
+		json.Unmarshal([]byte(data), &req)
+		f.consumers[req.Config["durable_name"].(string)] = req.Config
+		reply(to, `{"name":"`+req.Config["durable_name"].(string)+`"}`)
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.MSG.NEXT.INVOICES."):
+		durable := strings.TrimPrefix(subject, "$JS.API.CONSUMER.MSG.NEXT.INVOICES.")
+		var req struct {
+			Batch int `json:"batch"`
+		}
+		json.Unmarshal([]byte(data), &req)
+		filter, _ := f.consumers[durable]["filter_subject"].(string)
+		sent := 0
+		for seq, m := range f.messages {
+			if sent == req.Batch {
+				return
+			}
+			if m.acked || m.subject != filter {
+				continue
+			}
+			m.deliveries++
+			sent++
+			ack := fmt.Sprintf("$JS.ACK.INVOICES.%s.%d.%d.%d.1700000000000000000.0", durable, m.deliveries, seq+1, sent)
+			if m.header == "" {
+				send("MSG %s %s %s %d\r\n%s\r\n", m.subject, subs[to], ack, len(m.data), m.data)
+			} else {
+				send("HMSG %s %s %s %d %d\r\n%s%s\r\n", m.subject, subs[to], ack, len(m.header), len(m.header)+len(m.data), m.header, m.data)
+			}
+		}
+		status(to, "408 Request Timeout")
+	case strings.HasPrefix(subject, "$JS.ACK.INVOICES.") && strings.HasPrefix(data, "-NAK"):
+		f.naks = append(f.naks, subject+" "+data)
+	case strings.HasPrefix(subject, "$JS.ACK.INVOICES."):
+		seq, _ := strconv.Atoi(strings.Split(subject, ".")[5])
+		f.messages[seq-1].acked = true
+		reply(to, "")
+	case strings.HasPrefix(subject, "$JS."), subject == "nowhere":
+		status(to, "503")
+	default:
+		f.messages = append(f.messages, &fakeNATSMessage{subject: subject, header: header, data: data})
+		reply(to, fmt.Sprintf(`{"stream":"INVOICES","seq":%d}`, len(f.messages)))
+	}
+}
+
+func newNATS(t *testing.T, fake *fakeNATS, subject string) *queue.NATSQueue {
+	q, err := queue.NewNATSQueue(queue.NATSConfig{URL: fake.url(), Subject: subject, Wait: 100 * time.Millisecond})
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestNATSQueue(t *testing.T) {
+	fake := newFakeNATS(t)
+	q := newNATS(t, fake, "invoices")
+	ctx := context.Background()
+
+	require.NoError(t, q.Publish(ctx, []byte("<Invoice/>"), map[string]string{queue.AttrDocumentID: "doc-1", queue.AttrError: "line\r\nbreak"}))
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":"doc-2"}`), nil))
+	data, headers := fake.stored("invoices")
+	assert.Equal(t, []string{"<Invoice/>", `{"id":"doc-2"}`}, data)
+	assert.Equal(t, "NATS/1.0\r\ndocument_id: doc-1\r\nerror: line break\r\n\r\n", headers[0])
+	assert.Empty(t, headers[1])
+
+	msgs, err := q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "1", msgs[0].ID)
+	assert.Equal(t, "<Invoice/>", string(msgs[0].Body))
+	assert.Equal(t, 1, msgs[0].Attempts)
+	assert.Equal(t, "doc-1", msgs[0].Attributes[queue.AttrDocumentID])
+	assert.Equal(t, "2", msgs[1].ID)
+	assert.Nil(t, msgs[1].Attributes)
+
+	config := fake.consumer(queue.DefaultNATSDurable)
+	assert.Equal(t, "invoices", config["filter_subject"])
+	assert.Equal(t, "explicit", config["ack_policy"])
+	assert.Equal(t, float64(queue.DefaultNATSAckWait), config["ack_wait"])
+
+	require.NoError(t, q.Ack(ctx, msgs[0]))
+	assert.Equal(t, 1, fake.unacked("invoices"))
+
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1, "the unacknowledged message is redelivered")
+	assert.Equal(t, "2", msgs[0].ID)
+	assert.Equal(t, 2, msgs[0].Attempts)
+
+	// The connection is dialed again once lost
+	require.NoError(t, q.Close())
+	require.NoError(t, q.Ack(ctx, msgs[0]))
+	assert.Equal(t, 0, fake.unacked("invoices"))
+	msgs, err = q.Receive(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Len(t, fake.connects, 2)
+	assert.Equal(t, true, fake.connects[0]["headers"])
+}
+
+func TestNATSQueue_Consumer(t *testing.T) {
+	fake := newFakeNATS(t)
+	in, out, dlq := newNATS(t, fake, "invoices"), newNATS(t, fake, "results"), newNATS(t, fake, "invoices-dlq")
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), map[string]string{queue.AttrDocumentID: "raw-1"}))
+	require.NoError(t, in.Publish(ctx, []byte(`{"id":"x"}`), nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, fake.unacked("invoices"))
+
+	results, headers := fake.stored("results")
+	require.Len(t, results, 1)
+	var output queue.Output
+	require.NoError(t, json.Unmarshal([]byte(results[0]), &output))
+	assert.Equal(t, "1", output.MessageID)
+	assert.Equal(t, "raw-1", output.DocumentID)
+	require.Len(t, output.Results, 1)
+	assert.Equal(t, "0000042", output.Results[0].Invoice.Number)
+	assert.Contains(t, headers[0], "document_id: raw-1\r\n")
+
+	dead, headers := fake.stored("invoices-dlq")
+	assert.Equal(t, []string{`{"id":"x"}`}, dead)
+	assert.Contains(t, headers[0], "message_id: 2\r\n")
+	assert.Contains(t, headers[0], "neither data nor url")
+}
+
+func TestNATSQueue_Nack(t *testing.T) {
+	fake := newFakeNATS(t)
+	in, out := newNATS(t, fake, "invoices"), newNATS(t, fake, "results")
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(`{"id":"x","url":"http://docs.example.com/x.pdf"}`), nil))
+
+	fetch := func(context.Context, string) ([]byte, error) { return nil, errors.New("connection refused") }
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{Fetch: fetch})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 0, n)
+
+	// The failed message is handed back rather than left to AckWait
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.naks) == 1
+	}, time.Second, 10*time.Millisecond)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, fmt.Sprintf(`$JS.ACK.INVOICES.%s.1.1.1.1700000000000000000.0 -NAK {"delay":%d}`, queue.DefaultNATSDurable, int64(queue.DefaultNATSNakDelay)), fake.naks[0])
+	assert.False(t, fake.messages[0].acked)
+}
+
+func TestNATSQueue_Errors(t *testing.T) {
+	for _, cfg := range []queue.NATSConfig{
+		{URL: "http://localhost:4222", Subject: "invoices"},
+		{Subject: ""},
+		{Subject: "invoices.*"},
+		{Subject: "invoices", Durable: "a.b"},
+	} {
+		_, err := queue.NewNATSQueue(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+
+	fake := newFakeNATS(t)
+	ctx := context.Background()
+	q := newNATS(t, fake, "nowhere")
+	assert.EqualError(t, q.Publish(ctx, []byte("x"), nil), "no JetStream stream stores subject nowhere")
+
+	q, err := queue.NewNATSQueue(queue.NATSConfig{URL: "nats://wrong@" + strings.TrimPrefix(fake.url(), "nats://"), Subject: "invoices"})
+	require.NoError(t, err)
+	_, err = q.Receive(ctx, 1)
+	assert.ErrorContains(t, err, "NATS refused the connection: Authorization Violation")
+}
@@ -0,0 +1,350 @@
+// Package queue consumes documents from message queues and publishes their
+// results, for event-driven deployments.
+//
+// Brokers plug in through Source and Publisher; SQS, NATS JetStream, Kafka
+// and an in-memory queue are included. Delivery is at least once: a message
+// is acknowledged only after its results are published, so a crash or a
+// failed publish redelivers it.
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Defaults for Config
+const (
+	DefaultPollInterval = time.Second
+	DefaultMaxMessages  = 10
+	DefaultMaxAttempts  = 5
+
+	DefaultMaxDocumentSize = 64 << 20
+)
+
+// Message attributes read from raw (non-JSON) documents, and set on
+// published results and dead letters
+const (
+	AttrDocumentID = "document_id"
+	AttrFilename   = "filename"
+	AttrError      = "error"      // Why a message was dead-lettered
+	AttrMessageID  = "message_id" // Source message of a result or dead letter
+
+	AttrIdempotencyKey = "idempotency_key" // See Document.IdempotencyKey
+	AttrTenant         = "tenant"          // See Document.Tenant
+)
+
+// Message is a message read from a queue
+type Message struct {
+	ID         string
+	Body       []byte
+	Attributes map[string]string
+
+	// Attempts counts the deliveries of the message, this one included (0
+	// when the broker doesn't count them)
+	Attempts int
+
+	// Handle identifies this delivery to the source for Ack
+	Handle string
+}
+
+// Source receives messages. Messages that are not acknowledged are
+// delivered again after a broker-specific timeout.
+type Source interface {
+	Receive(ctx context.Context, n int) ([]*Message, error)
+	Ack(ctx context.Context, msg *Message) error
+}
+
+// Nacker is a Source that can hand a message back for redelivery without
+// waiting out its timeout. The consumer calls Nack on messages it failed to
+// handle and left for another attempt.
+type Nacker interface {
+	Nack(ctx context.Context, msg *Message) error
+}
+
+// Publisher sends messages to a queue or topic
+type Publisher interface {
+	Publish(ctx context.Context, body []byte, attributes map[string]string) error
+}
+
+// Queue is a queue both read from and published to
+type Queue interface {
+	Source
+	Publisher
+}
+
+// Document is the JSON body of a message: a payload, or a reference to
+// fetch. Bodies that are not a JSON object are taken as the document
+// itself, named by the document_id and filename attributes.
+type Document struct {
+	ID       string `json:"id,omitempty"`       // Document ID for logs, audit and results
+	Filename string `json:"filename,omitempty"` // Helps format detection
+	URL      string `json:"url,omitempty"`      // Fetched when Data is empty
+	Data     []byte `json:"data,omitempty"`     // Base64 in JSON
+
+	// IdempotencyKey identifies the submission for a pipeline built with
+	// processor.WithIdempotency, so a message published twice is extracted
+	// once; empty derives it from the content
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// Tenant processes the document with the settings of a tenant of a
+	// pipeline built with processor.WithTenants
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Output is the JSON body published for each message
+type Output struct {
+	MessageID  string                     `json:"message_id"`
+	DocumentID string                     `json:"document_id,omitempty"`
+	Results    []*processor.EncodedResult `json:"results"`
+}
+
+// Config configures a Consumer
+type Config struct {
+	// DeadLetter receives messages that can't be processed: bodies that
+	// don't decode at once, and references that can't be fetched or results
+	// that can't be published after MaxAttempts deliveries. Without it they
+	// are redelivered until the broker drops them.
+	DeadLetter Publisher
+
+	PollInterval   time.Duration // Wait after an empty receive (default: DefaultPollInterval)
+	MaxMessages    int           // Messages per receive (default: DefaultMaxMessages)
+	MaxAttempts    int           // Deliveries before dead-lettering (default: DefaultMaxAttempts)
+	Timeout        time.Duration // Per-message processing timeout (0 = none)
+	SplitDocuments bool          // See processor.ProcessOptions.SplitDocuments
+
+	// Fetch reads the document at a reference URL (default: HTTP GET with
+	// HTTPClient)
+	Fetch      func(ctx context.Context, url string) ([]byte, error)
+	HTTPClient *http.Client
+
+	// MaxDocumentSize is the most bytes the default Fetch reads; larger
+	// documents are dead-lettered (default: DefaultMaxDocumentSize)
+	MaxDocumentSize int64
+}
+
+// errTooLarge is returned by fetch for documents over MaxDocumentSize,
+// which no redelivery will fix
+var errTooLarge = errors.New("document is too large")
+
+// Consumer reads documents from a source, runs them through the pipeline
+// and publishes their results
+type Consumer struct {
+	pipeline *processor.Pipeline
+	source   Source
+	output   Publisher
+	cfg      Config
+}
+
+// NewConsumer returns a consumer publishing results to output
+func NewConsumer(pipeline *processor.Pipeline, source Source, output Publisher, cfg Config) (*Consumer, error) {
+	if source == nil {
+		return nil, errors.New("queue source is required")
+	}
+	if output == nil {
+		return nil, errors.New("output publisher is required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = DefaultMaxMessages
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: time.Minute}
+	}
+	if cfg.MaxDocumentSize <= 0 {
+		cfg.MaxDocumentSize = DefaultMaxDocumentSize
+	}
+	c := &Consumer{pipeline: pipeline, source: source, output: output, cfg: cfg}
+	if c.cfg.Fetch == nil {
+		c.cfg.Fetch = c.fetch
+	}
+	return c, nil
+}
+
+// Run polls until ctx is canceled, then returns nil. Errors, such as a
+// failed receive or a message left for redelivery, are reported to onError.
+func (c *Consumer) Run(ctx context.Context, onError func(error)) error {
+	for {
+		n, err := c.Poll(ctx)
+		if err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.cfg.PollInterval):
+		}
+	}
+}
+
+// Poll receives up to MaxMessages messages and handles them one by one,
+// returning how many were acknowledged. Once ctx is canceled the message
+// being handled is finished and the others are left for redelivery; stop the
+// pipeline (see processor.Pipeline.Stop) to bound how long that takes.
+func (c *Consumer) Poll(ctx context.Context) (int, error) {
+	msgs, err := c.source.Receive(ctx, c.cfg.MaxMessages)
+	if err != nil {
+		return 0, fmt.Errorf("failed to receive messages: %w", err)
+	}
+
+	acked := 0
+	var errs []error
+	work := context.WithoutCancel(ctx)
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := c.handle(work, msg); err != nil {
+			errs = append(errs, fmt.Errorf("message %s: %w", msg.ID, err))
+			if nacker, ok := c.source.(Nacker); ok {
+				if err := nacker.Nack(work, msg); err != nil {
+					errs = append(errs, fmt.Errorf("failed to return message %s: %w", msg.ID, err))
+				}
+			}
+			continue
+		}
+		if err := c.source.Ack(work, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to acknowledge message %s: %w", msg.ID, err))
+			continue
+		}
+		acked++
+	}
+	return acked, errors.Join(errs...)
+}
+
+// handle processes a message and publishes its results, or dead-letters
+// it. An error leaves the message for redelivery.
+func (c *Consumer) handle(ctx context.Context, msg *Message) error {
+	doc, err := decodeDocument(msg)
+	if err != nil {
+		return c.deadLetter(ctx, msg, err)
+	}
+	if len(doc.Data) == 0 {
+		if doc.Data, err = c.cfg.Fetch(ctx, doc.URL); err != nil {
+			if errors.Is(err, errTooLarge) {
+				return c.deadLetter(ctx, msg, fmt.Errorf("failed to fetch %s: %w", doc.URL, err))
+			}
+			return c.retryOrDeadLetter(ctx, msg, fmt.Errorf("failed to fetch %s: %w", doc.URL, err))
+		}
+	}
+
+	docCtx := ctx
+	if doc.ID != "" {
+		docCtx = llm.ContextWithDocumentID(docCtx, doc.ID)
+	}
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		docCtx, cancel = context.WithTimeout(docCtx, c.cfg.Timeout)
+		defer cancel()
+	}
+	results := c.pipeline.Process(docCtx, doc.Data, processor.ProcessOptions{Filename: doc.Filename, SplitDocuments: c.cfg.SplitDocuments, IdempotencyKey: doc.IdempotencyKey, Tenant: doc.Tenant})
+	for _, r := range results {
+		if errors.Is(r.Error, processor.ErrStopped) {
+			return r.Error // Redelivered to a running consumer
+		}
+	}
+
+	out := Output{MessageID: msg.ID, DocumentID: doc.ID, Results: make([]*processor.EncodedResult, len(results))}
+	for i, r := range results {
+		out.Results[i] = r.Encode()
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return c.deadLetter(ctx, msg, fmt.Errorf("failed to encode results: %w", err))
+	}
+	attrs := map[string]string{AttrMessageID: msg.ID}
+	if doc.ID != "" {
+		attrs[AttrDocumentID] = doc.ID
+	}
+	if err := c.output.Publish(ctx, body, attrs); err != nil {
+		return c.retryOrDeadLetter(ctx, msg, fmt.Errorf("failed to publish results: %w", err))
+	}
+	return nil
+}
+
+// retryOrDeadLetter leaves msg for redelivery, returning err, until its
+// last attempt, when it is dead-lettered
+func (c *Consumer) retryOrDeadLetter(ctx context.Context, msg *Message, err error) error {
+	if msg.Attempts < c.cfg.MaxAttempts {
+		return err
+	}
+	return c.deadLetter(ctx, msg, err)
+}
+
+// deadLetter publishes msg to the dead-letter queue with the reason, so it
+// can be acknowledged. Without one, the reason is returned.
+func (c *Consumer) deadLetter(ctx context.Context, msg *Message, reason error) error {
+	if c.cfg.DeadLetter == nil {
+		return reason
+	}
+	attrs := make(map[string]string, len(msg.Attributes)+2)
+	for k, v := range msg.Attributes {
+		attrs[k] = v
+	}
+	attrs[AttrError] = reason.Error()
+	attrs[AttrMessageID] = msg.ID
+	if err := c.cfg.DeadLetter.Publish(ctx, msg.Body, attrs); err != nil {
+		return errors.Join(reason, fmt.Errorf("failed to dead-letter: %w", err))
+	}
+	return nil
+}
+
+// decodeDocument reads the document of a message
+func decodeDocument(msg *Message) (*Document, error) {
+	body := bytes.TrimSpace(msg.Body)
+	if len(body) == 0 || body[0] != '{' {
+		if len(msg.Body) == 0 {
+			return nil, errors.New("empty message")
+		}
+		return &Document{ID: msg.Attributes[AttrDocumentID], Filename: msg.Attributes[AttrFilename], Data: msg.Body, IdempotencyKey: msg.Attributes[AttrIdempotencyKey], Tenant: msg.Attributes[AttrTenant]}, nil
+	}
+
+	var doc Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document message: %w", err)
+	}
+	if len(doc.Data) == 0 && doc.URL == "" {
+		return nil, errors.New("document message has neither data nor url")
+	}
+	return &doc, nil
+}
+
+// fetch reads a reference with an HTTP GET, up to MaxDocumentSize bytes
+func (c *Consumer) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.MaxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.cfg.MaxDocumentSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", errTooLarge, c.cfg.MaxDocumentSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,257 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/queue"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+// failingPublisher fails every publish
+type failingPublisher struct{ calls int }
+
+func (p *failingPublisher) Publish(context.Context, []byte, map[string]string) error {
+	p.calls++
+	return errors.New("broker unavailable")
+}
+
+func newQueues() (in, out, dlq *queue.MemoryQueue) {
+	in, out, dlq = queue.NewMemoryQueue(), queue.NewMemoryQueue(), queue.NewMemoryQueue()
+	// Unacknowledged messages come back on the next receive
+	in.VisibilityTimeout = -1
+	return in, out, dlq
+}
+
+func readOutput(t *testing.T, msg queue.Message) queue.Output {
+	t.Helper()
+	var out queue.Output
+	require.NoError(t, json.Unmarshal(msg.Body, &out))
+	return out
+}
+
+func TestConsumer_PayloadsAndReferences(t *testing.T) {
+	docs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(invoiceXML))
+	}))
+	defer docs.Close()
+
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), map[string]string{queue.AttrDocumentID: "raw-1"}))
+	ref, _ := json.Marshal(queue.Document{ID: "ref-1", Filename: "a.xml", URL: docs.URL + "/a.xml"})
+	require.NoError(t, in.Publish(ctx, ref, nil))
+	payload := `{"id":"b64-1","data":"` + base64.StdEncoding.EncodeToString([]byte(invoiceXML)) + `"}`
+	require.NoError(t, in.Publish(ctx, []byte(payload), nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Empty(t, in.Messages())
+	assert.Empty(t, dlq.Messages())
+
+	published := out.Messages()
+	require.Len(t, published, 3)
+	for i, id := range []string{"raw-1", "ref-1", "b64-1"} {
+		output := readOutput(t, published[i])
+		assert.Equal(t, id, output.DocumentID)
+		assert.Equal(t, id, published[i].Attributes[queue.AttrDocumentID])
+		require.Len(t, output.Results, 1)
+		assert.Empty(t, output.Results[0].Error)
+		assert.Equal(t, "0000042", output.Results[0].Invoice.Number)
+	}
+}
+
+func TestConsumer_FailedDocumentsArePublished(t *testing.T) {
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte("not an invoice"), nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	_, err = c.Poll(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, out.Messages(), 1)
+	output := readOutput(t, out.Messages()[0])
+	require.Len(t, output.Results, 1)
+	assert.NotEmpty(t, output.Results[0].Error)
+	assert.Empty(t, dlq.Messages())
+}
+
+func TestConsumer_IdempotencyKey(t *testing.T) {
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), map[string]string{queue.AttrIdempotencyKey: "doc-1"}))
+	again, _ := json.Marshal(queue.Document{IdempotencyKey: "doc-1", Data: []byte("published twice")})
+	require.NoError(t, in.Publish(ctx, again, nil))
+
+	p := processor.NewPipeline(processor.WithIdempotency(processor.NewMemoryIdempotencyStore()))
+	c, err := queue.NewConsumer(p, in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	_, err = c.Poll(ctx)
+	require.NoError(t, err)
+
+	published := out.Messages()
+	require.Len(t, published, 2)
+	output := readOutput(t, published[1])
+	require.Len(t, output.Results, 1)
+	assert.True(t, output.Results[0].IdempotentReplay)
+	assert.Equal(t, "0000042", output.Results[0].Invoice.Number)
+}
+
+func TestConsumer_Tenant(t *testing.T) {
+	in, out, _ := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), map[string]string{queue.AttrTenant: "acme"}))
+	unknown, _ := json.Marshal(queue.Document{Tenant: "initech", Data: []byte(invoiceXML)})
+	require.NoError(t, in.Publish(ctx, unknown, nil))
+
+	p := processor.NewPipeline(processor.WithTenants(map[string]processor.Tenant{"acme": {}}))
+	c, err := queue.NewConsumer(p, in, out, queue.Config{})
+	require.NoError(t, err)
+	_, err = c.Poll(ctx)
+	require.NoError(t, err)
+
+	published := out.Messages()
+	require.Len(t, published, 2)
+	output := readOutput(t, published[0])
+	require.Len(t, output.Results, 1)
+	assert.Equal(t, "acme", output.Results[0].Tenant)
+	output = readOutput(t, published[1])
+	assert.Contains(t, output.Results[0].Error, "unknown tenant")
+}
+
+func TestConsumer_InvalidMessagesAreDeadLettered(t *testing.T) {
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(`{"id":"x"}`), map[string]string{"tenant": "acme"}))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Empty(t, in.Messages())
+	assert.Empty(t, out.Messages())
+	require.Len(t, dlq.Messages(), 1)
+	dead := dlq.Messages()[0]
+	assert.Equal(t, `{"id":"x"}`, string(dead.Body))
+	assert.Equal(t, "acme", dead.Attributes["tenant"])
+	assert.Contains(t, dead.Attributes[queue.AttrError], "neither data nor url")
+	assert.Equal(t, "1", dead.Attributes[queue.AttrMessageID])
+}
+
+func TestConsumer_LargeReferencesAreDeadLettered(t *testing.T) {
+	docs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(invoiceXML))
+	}))
+	defer docs.Close()
+
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	ref, _ := json.Marshal(queue.Document{ID: "ref-1", URL: docs.URL + "/a.xml"})
+	require.NoError(t, in.Publish(ctx, ref, nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{DeadLetter: dlq, MaxDocumentSize: 16})
+	require.NoError(t, err)
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "dead-lettered without redelivery")
+
+	assert.Empty(t, out.Messages())
+	require.Len(t, dlq.Messages(), 1)
+	assert.Contains(t, dlq.Messages()[0].Attributes[queue.AttrError], "more than 16 bytes")
+}
+
+func TestConsumer_RetriesPublishThenDeadLetters(t *testing.T) {
+	in, _, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), nil))
+
+	output := &failingPublisher{}
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, output, queue.Config{DeadLetter: dlq, MaxAttempts: 3})
+	require.NoError(t, err)
+
+	for attempt := 1; attempt < 3; attempt++ {
+		n, err := c.Poll(ctx)
+		require.ErrorContains(t, err, "broker unavailable")
+		assert.Equal(t, 0, n)
+		require.Len(t, in.Messages(), 1, "left for redelivery")
+	}
+	n, err := c.Poll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 3, output.calls)
+	assert.Empty(t, in.Messages())
+	require.Len(t, dlq.Messages(), 1)
+	assert.Contains(t, dlq.Messages()[0].Attributes[queue.AttrError], "failed to publish results")
+}
+
+func TestConsumer_NoDeadLetterQueue(t *testing.T) {
+	in, out, _ := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, nil, nil))
+
+	c, err := queue.NewConsumer(processor.NewPipeline(), in, out, queue.Config{})
+	require.NoError(t, err)
+	_, err = c.Poll(ctx)
+	assert.ErrorContains(t, err, "empty message")
+	assert.Len(t, in.Messages(), 1)
+}
+
+func TestConsumer_StoppedPipeline(t *testing.T) {
+	in, out, dlq := newQueues()
+	ctx := context.Background()
+	require.NoError(t, in.Publish(ctx, []byte(invoiceXML), nil))
+
+	p := processor.NewPipeline()
+	require.NoError(t, p.Stop(ctx))
+	c, err := queue.NewConsumer(p, in, out, queue.Config{DeadLetter: dlq, MaxAttempts: 1})
+	require.NoError(t, err)
+	acked, err := c.Poll(ctx)
+	assert.ErrorIs(t, err, processor.ErrStopped)
+	assert.Zero(t, acked)
+	assert.Empty(t, out.Messages())
+	assert.Empty(t, dlq.Messages())
+	assert.Len(t, in.Messages(), 1, "left for redelivery")
+}
+
+func TestMemoryQueue_Visibility(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	ctx := context.Background()
+	require.NoError(t, q.Publish(ctx, []byte("a"), nil))
+	require.NoError(t, q.Publish(ctx, []byte("b"), nil))
+
+	first, err := q.Receive(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	assert.Equal(t, "a", string(first[0].Body))
+	assert.Equal(t, 1, first[0].Attempts)
+
+	// a is hidden until acknowledged or timed out
+	second, err := q.Receive(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, "b", string(second[0].Body))
+
+	require.NoError(t, q.Ack(ctx, first[0]))
+	assert.Len(t, q.Messages(), 1)
+}
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// SQSConfig configures an SQS queue.
+// Empty credentials and region are read from the standard AWS environment variables.
+type SQSConfig struct {
+	QueueURL    string // e.g. https://sqs.ap-southeast-1.amazonaws.com/123456789012/invoices
+	Region      string
+	Credentials sigv4.Credentials
+	WaitTime    time.Duration // Long polling wait per receive, at most 20s (default: 20s)
+	HTTPClient  *http.Client
+}
+
+// SQSQueue is a Source and Publisher on an Amazon SQS queue, using its JSON
+// API. Message bodies must be text: send documents as Document JSON, or
+// raw XML. Receive counts are the queue's ApproximateReceiveCount.
+type SQSQueue struct {
+	queueURL   string
+	endpoint   string
+	waitTime   int
+	signer     *sigv4.Signer
+	httpClient *http.Client
+}
+
+// NewSQSQueue returns the queue at cfg.QueueURL
+func NewSQSQueue(cfg SQSConfig) (*SQSQueue, error) {
+	u, err := url.Parse(cfg.QueueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q", cfg.QueueURL)
+	}
+	if cfg.Region == "" {
+		cfg.Region = sigv4.RegionFromEnv()
+	}
+	if cfg.Credentials.AccessKeyID == "" {
+		cfg.Credentials = sigv4.CredentialsFromEnv()
+	}
+	if cfg.WaitTime <= 0 || cfg.WaitTime > 20*time.Second {
+		cfg.WaitTime = 20 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: cfg.WaitTime + 30*time.Second}
+	}
+	return &SQSQueue{
+		queueURL:   cfg.QueueURL,
+		endpoint:   u.Scheme + "://" + u.Host + "/",
+		waitTime:   int(cfg.WaitTime / time.Second),
+		signer:     sigv4.NewSigner(cfg.Credentials, cfg.Region, "sqs"),
+		httpClient: cfg.HTTPClient,
+	}, nil
+}
+
+type sqsAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue,omitempty"`
+}
+
+type sqsMessage struct {
+	MessageID         string                  `json:"MessageId"`
+	ReceiptHandle     string                  `json:"ReceiptHandle"`
+	Body              string                  `json:"Body"`
+	Attributes        map[string]string       `json:"Attributes"`
+	MessageAttributes map[string]sqsAttribute `json:"MessageAttributes"`
+}
+
+// Receive long-polls for up to n messages (at most 10)
+func (q *SQSQueue) Receive(ctx context.Context, n int) ([]*Message, error) {
+	var resp struct {
+		Messages []sqsMessage `json:"Messages"`
+	}
+	err := q.call(ctx, "ReceiveMessage", map[string]any{
+		"QueueUrl":                    q.queueURL,
+		"MaxNumberOfMessages":         min(max(n, 1), 10),
+		"WaitTimeSeconds":             q.waitTime,
+		"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+		"MessageAttributeNames":       []string{"All"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*Message, len(resp.Messages))
+	for i, m := range resp.Messages {
+		attempts, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+		msg := &Message{ID: m.MessageID, Body: []byte(m.Body), Attempts: attempts, Handle: m.ReceiptHandle}
+		for name, attr := range m.MessageAttributes {
+			if attr.StringValue == "" {
+				continue
+			}
+			if msg.Attributes == nil {
+				msg.Attributes = make(map[string]string)
+			}
+			msg.Attributes[name] = attr.StringValue
+		}
+		msgs[i] = msg
+	}
+	return msgs, nil
+}
+
+// Ack deletes a received message
+func (q *SQSQueue) Ack(ctx context.Context, msg *Message) error {
+	return q.call(ctx, "DeleteMessage", map[string]any{
+		"QueueUrl":      q.queueURL,
+		"ReceiptHandle": msg.Handle,
+	}, nil)
+}
+
+// Publish sends a message. Empty attributes are dropped; SQS rejects them.
+func (q *SQSQueue) Publish(ctx context.Context, body []byte, attributes map[string]string) error {
+	req := map[string]any{
+		"QueueUrl":    q.queueURL,
+		"MessageBody": string(body),
+	}
+	attrs := make(map[string]sqsAttribute)
+	for name, value := range attributes {
+		if value != "" {
+			attrs[name] = sqsAttribute{DataType: "String", StringValue: value}
+		}
+	}
+	if len(attrs) > 0 {
+		req["MessageAttributes"] = attrs
+	}
+	return q.call(ctx, "SendMessage", req, nil)
+}
+
+// call posts a signed request to the SQS JSON API
+func (q *SQSQueue) call(ctx context.Context, action string, in, out any) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	if err := q.signer.Sign(req, payload); err != nil {
+		return err
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return fmt.Errorf("SQS %s returned %s: %s", action, resp.Status, strings.TrimSpace(apiErr.Type+" "+apiErr.Message))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid SQS %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/queue"
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// fakeSQS answers the SQS JSON API and records the requests
+type fakeSQS struct {
+	requests []map[string]any
+	targets  []string
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]any
+	json.NewDecoder(r.Body).Decode(&req)
+	f.requests = append(f.requests, req)
+	target := r.Header.Get("X-Amz-Target")
+	f.targets = append(f.targets, target)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch target {
+	case "AmazonSQS.ReceiveMessage":
+		w.Write([]byte(`{"Messages":[{"MessageId":"m-1","ReceiptHandle":"rh-1","Body":"<Invoice/>",` +
+			`"Attributes":{"ApproximateReceiveCount":"2"},` +
+			`"MessageAttributes":{"document_id":{"DataType":"String","StringValue":"doc-1"}}}]}`))
+	case "AmazonSQS.SendMessage":
+		w.Write([]byte(`{"MessageId":"m-2"}`))
+	case "AmazonSQS.DeleteMessage":
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.sqs#InvalidAction","message":"unknown action"}`))
+	}
+}
+
+func newSQS(t *testing.T) (*fakeSQS, *queue.SQSQueue) {
+	fake := &fakeSQS{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	q, err := queue.NewSQSQueue(queue.SQSConfig{
+		QueueURL:    srv.URL + "/123456789012/invoices",
+		Region:      "ap-southeast-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+	require.NoError(t, err)
+	return fake, q
+}
+
+func TestSQSQueue(t *testing.T) {
+	fake, q := newSQS(t)
+	ctx := context.Background()
+
+	msgs, err := q.Receive(ctx, 25)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "m-1", msgs[0].ID)
+	assert.Equal(t, "<Invoice/>", string(msgs[0].Body))
+	assert.Equal(t, 2, msgs[0].Attempts)
+	assert.Equal(t, "doc-1", msgs[0].Attributes[queue.AttrDocumentID])
+	assert.Equal(t, float64(10), fake.requests[0]["MaxNumberOfMessages"])
+	assert.Equal(t, float64(20), fake.requests[0]["WaitTimeSeconds"])
+	assert.True(t, strings.HasSuffix(fake.requests[0]["QueueUrl"].(string), "/123456789012/invoices"))
+
+	require.NoError(t, q.Ack(ctx, msgs[0]))
+	assert.Equal(t, "rh-1", fake.requests[1]["ReceiptHandle"])
+
+	require.NoError(t, q.Publish(ctx, []byte(`{"results":[]}`), map[string]string{queue.AttrDocumentID: "doc-1", "empty": ""}))
+	assert.Equal(t, `{"results":[]}`, fake.requests[2]["MessageBody"])
+	attrs := fake.requests[2]["MessageAttributes"].(map[string]any)
+	assert.Len(t, attrs, 1)
+	assert.Equal(t, map[string]any{"DataType": "String", "StringValue": "doc-1"}, attrs[queue.AttrDocumentID])
+
+	assert.Equal(t, []string{"AmazonSQS.ReceiveMessage", "AmazonSQS.DeleteMessage", "AmazonSQS.SendMessage"}, fake.targets)
+}
+
+func TestSQSQueue_Errors(t *testing.T) {
+	_, err := queue.NewSQSQueue(queue.SQSConfig{QueueURL: "invoices"})
+	assert.Error(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"The specified queue does not exist."}`))
+	}))
+	defer srv.Close()
+	q, err := queue.NewSQSQueue(queue.SQSConfig{
+		QueueURL:    srv.URL + "/1/missing",
+		Region:      "ap-southeast-1",
+		Credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+	require.NoError(t, err)
+	_, err = q.Receive(context.Background(), 1)
+	assert.ErrorContains(t, err, "QueueDoesNotExist The specified queue does not exist.")
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ttfFont is a TrueType font PDFs embed, its metrics in thousandths of
+// the font size as PDF measures glyphs
+type ttfFont struct {
+	data []byte
+	font *sfnt.Font
+	name string // PostScript name
+
+	ascent, descent, capHeight int
+	bbox                       [4]int
+}
+
+func parseFont(data []byte) (*ttfFont, error) {
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	var buf sfnt.Buffer
+	name, err := f.Name(&buf, sfnt.NameIDPostScript)
+	if err != nil || name == "" {
+		name = "Embedded"
+	}
+
+	ppem := fixed.I(1000)
+	metrics, err := f.Metrics(&buf, ppem, font.HintingNone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font metrics: %w", err)
+	}
+	bounds, err := f.Bounds(&buf, ppem, font.HintingNone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font bounds: %w", err)
+	}
+	// sfnt measures y downward
+	return &ttfFont{
+		data:      data,
+		font:      f,
+		name:      name,
+		ascent:    metrics.Ascent.Round(),
+		descent:   -metrics.Descent.Round(),
+		capHeight: metrics.CapHeight.Round(),
+		bbox:      [4]int{bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round()},
+	}, nil
+}
+
+// glyph returns the glyph of r, its advance in thousandths of the font
+// size, and the letter it draws. Letters the font lacks fall back to
+// their base letter, so "ạ" is drawn "a" rather than a blank.
+func (f *ttfFont) glyph(buf *sfnt.Buffer, r rune) (sfnt.GlyphIndex, int, rune) {
+	index, err := f.font.GlyphIndex(buf, r)
+	if (err != nil || index == 0) && r >= utf8.RuneSelf {
+		base := r
+		switch r {
+		case 'đ':
+			base = 'd'
+		case 'Đ':
+			base = 'D'
+		default:
+			base, _ = utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+		}
+		if base != r {
+			return f.glyph(buf, base)
+		}
+	}
+	advance, err := f.font.GlyphAdvance(buf, index, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return index, 0, r
+	}
+	return index, advance.Round(), r
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head>
+<meta charset="utf-8">
+<title>{{.Title.VI}}{{range .Meta}} {{.Value}}{{end}}</title>
+<style>
+body { font-family: "Roboto", "Noto Sans", "Segoe UI", Arial, sans-serif; font-size: 13px; color: #222; max-width: 960px; margin: 24px auto; padding: 0 16px; }
+h1 { text-align: center; font-size: 20px; margin: 0; }
+h1 .en, th .en, dt .en, h2 .en { display: block; font-weight: normal; font-size: 0.85em; color: #666; }
+h2 { font-size: 14px; margin: 0 0 6px; }
+dl { display: grid; grid-template-columns: max-content 1fr; gap: 4px 12px; margin: 0; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+.meta { display: flex; justify-content: center; gap: 24px; margin: 12px 0 20px; }
+.parties { display: grid; grid-template-columns: 1fr 1fr; gap: 16px; margin-bottom: 20px; }
+.party { border: 1px solid #ccc; padding: 10px; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 16px; }
+th, td { border: 1px solid #ccc; padding: 4px 6px; vertical-align: top; }
+th { background: #f3f3f3; }
+.num { text-align: right; white-space: nowrap; }
+.totals { margin-left: auto; width: 50%; }
+.totals dd { text-align: right; }
+.notes { margin-top: 16px; }
+footer { margin-top: 24px; font-size: 11px; color: #666; text-align: center; }
+</style>
+</head>
+<body>
+<h1>{{.Title.VI}}<span class="en">{{.Title.EN}}</span></h1>
+{{- with .Meta}}
+<div class="meta">
+{{- range .}}
+<div><b>{{.Label.VI}}</b> <small>({{.Label.EN}})</small>: {{.Value}}</div>
+{{- end}}
+</div>
+{{- end}}
+{{- with .Parties}}
+<div class="parties">
+{{- range .}}
+<section class="party">
+<h2>{{.Title.VI}}<span class="en">{{.Title.EN}}</span></h2>
+<dl>
+{{- range .Fields}}
+<dt>{{.Label.VI}}<span class="en">{{.Label.EN}}</span></dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+</section>
+{{- end}}
+</div>
+{{- end}}
+{{template "table" .Items}}
+{{- if .VAT.Columns}}
+{{template "table" .VAT}}
+{{- end}}
+<dl class="totals">
+{{- range .Totals}}
+<dt>{{.Label.VI}}<span class="en">{{.Label.EN}}</span></dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- with .Notes}}
+<dl class="notes">
+{{- range .}}
+<dt>{{.Label.VI}}<span class="en">{{.Label.EN}}</span></dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+{{- with .Footer}}
+<footer>{{.}}</footer>
+{{- end}}
+</body>
+</html>
+{{define "table"}}
+<table>
+<thead><tr>
+{{- range .Columns}}
+<th{{if .Right}} class="num"{{end}}>{{.Label.VI}}<span class="en">{{.Label.EN}}</span></th>
+{{- end}}
+</tr></thead>
+<tbody>
+{{- $columns := .Columns}}
+{{- range .Rows}}
+<tr>
+{{- range $i, $cell := .}}
+<td{{if (index $columns $i).Right}} class="num"{{end}}>{{$cell}}</td>
+{{- end}}
+</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+`))
+
+// HTML writes inv as a standalone HTML page, its styles inline
+func (r *Renderer) HTML(w io.Writer, inv *model.Invoice) error {
+	if err := htmlTemplate.Execute(w, r.layout(inv)); err != nil {
+		return fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font/sfnt"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// A4 page, in points
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	margin       = 40.0
+	contentWidth = pageWidth - 2*margin
+	cellPadding  = 3.0
+	lineSpacing  = 1.25 // Leading, in font sizes
+)
+
+// Font sizes
+const (
+	sizeTitle = 15.0
+	sizeText  = 9.0
+	sizeSmall = 7.5
+)
+
+// PDF writes inv as an A4 PDF, its font embedded so the document reads the
+// same anywhere. The items table continues over pages with its header
+// repeated, and pages are numbered.
+func (r *Renderer) PDF(w io.Writer, inv *model.Invoice) error {
+	p := &pdfWriter{font: r.font, glyphs: make(map[sfnt.GlyphIndex]pdfGlyph)}
+	p.newPage()
+	p.draw(r.layout(inv))
+
+	if _, err := w.Write(p.bytes(inv)); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// pdfGlyph is a glyph the document uses
+type pdfGlyph struct {
+	rune  rune
+	width int
+}
+
+// pdfWriter lays a document out on pages of PDF content
+type pdfWriter struct {
+	font   *ttfFont
+	buf    sfnt.Buffer
+	glyphs map[sfnt.GlyphIndex]pdfGlyph
+
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // Top of the free space on the page
+
+	// header redraws the header of the table being drawn on a new page
+	header func()
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = pageHeight - margin
+	if p.header != nil {
+		p.header()
+	}
+}
+
+// ensure starts a new page unless height fits on this one
+func (p *pdfWriter) ensure(height float64) {
+	if p.y-height < margin+sizeSmall*2 {
+		p.newPage()
+	}
+}
+
+// width returns the width of s at size, in points
+func (p *pdfWriter) width(s string, size float64) float64 {
+	var total int
+	for _, r := range s {
+		_, advance, _ := p.font.glyph(&p.buf, r)
+		total += advance
+	}
+	return float64(total) * size / 1000
+}
+
+// text draws s with its baseline at x, y
+func (p *pdfWriter) text(x, y, size float64, s string, bold bool) {
+	var hex strings.Builder
+	for _, r := range s {
+		index, advance, drawn := p.font.glyph(&p.buf, r)
+		if _, ok := p.glyphs[index]; !ok {
+			p.glyphs[index] = pdfGlyph{rune: drawn, width: advance}
+		}
+		fmt.Fprintf(&hex, "%04X", uint16(index))
+	}
+	if bold {
+		// Fill and stroke the outlines, as the font has no bold face
+		fmt.Fprintf(p.page, "BT /F1 %s Tf 2 Tr %s w %s %s Td <%s> Tj ET\n", num(size), num(size/30), num(x), num(y), hex.String())
+		return
+	}
+	fmt.Fprintf(p.page, "BT /F1 %s Tf 0 Tr %s %s Td <%s> Tj ET\n", num(size), num(x), num(y), hex.String())
+}
+
+// wrap breaks s into lines no wider than width, between words where it can
+func (p *pdfWriter) wrap(s string, size, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if p.width(candidate, size) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Words wider than a line are broken anywhere
+			line = ""
+			for _, r := range word {
+				if line != "" && p.width(line+string(r), size) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// baseline is the baseline of a line of size text whose top is at y
+func (p *pdfWriter) baseline(y, size float64) float64 {
+	return y - float64(p.font.ascent)*size/1000
+}
+
+// paragraph draws s wrapped to width from x, aligned "left", "center" or
+// "right", and moves below it
+func (p *pdfWriter) paragraph(x, width, size float64, s string, bold bool, align string) {
+	for _, line := range p.wrap(s, size, width) {
+		p.ensure(size * lineSpacing)
+		lx := x
+		switch align {
+		case "center":
+			lx = x + (width-p.width(line, size))/2
+		case "right":
+			lx = x + width - p.width(line, size)
+		}
+		p.text(lx, p.baseline(p.y, size), size, line, bold)
+		p.y -= size * lineSpacing
+	}
+}
+
+func (p *pdfWriter) rule(y float64) {
+	fmt.Fprintf(p.page, "0.5 w %s %s m %s %s l S\n", num(margin), num(y), num(pageWidth-margin), num(y))
+}
+
+func (p *pdfWriter) draw(doc *document) {
+	p.paragraph(margin, contentWidth, sizeTitle, doc.Title.VI, true, "center")
+	p.paragraph(margin, contentWidth, sizeText, doc.Title.EN, false, "center")
+	p.y -= sizeText / 2
+	var meta []string
+	for _, f := range doc.Meta {
+		meta = append(meta, fmt.Sprintf("%s (%s): %s", f.Label.VI, f.Label.EN, f.Value))
+	}
+	if len(meta) > 0 {
+		p.paragraph(margin, contentWidth, sizeText, strings.Join(meta, "    "), false, "center")
+	}
+	p.y -= sizeText
+	p.rule(p.y)
+	p.y -= sizeText
+
+	p.parties(doc.Parties)
+	p.table(doc.Items)
+	if len(doc.VAT.Columns) > 0 {
+		p.table(doc.VAT)
+	}
+
+	for _, f := range doc.Totals {
+		p.ensure(sizeText * lineSpacing)
+		half := contentWidth / 2
+		p.text(margin+half, p.baseline(p.y, sizeText), sizeText, f.Label.String(), true)
+		p.paragraph(margin+half, half, sizeText, f.Value, false, "right")
+	}
+	p.y -= sizeText
+	for _, f := range doc.Notes {
+		p.paragraph(margin, contentWidth, sizeText, f.Label.String()+": "+f.Value, false, "left")
+	}
+
+	if doc.Footer != "" {
+		// At the foot of the last page, above the page number
+		lines := p.wrap(doc.Footer, sizeSmall, contentWidth)
+		lead := sizeSmall * lineSpacing
+		if p.y-float64(len(lines))*lead < margin {
+			p.newPage()
+		}
+		for i, line := range lines {
+			y := margin + float64(len(lines)-1-i)*lead
+			p.text(margin+(contentWidth-p.width(line, sizeSmall))/2, y, sizeSmall, line, false)
+		}
+	}
+	for i, page := range p.pages {
+		p.page = page
+		number := fmt.Sprintf("Trang / Page %d/%d", i+1, len(p.pages))
+		p.text(pageWidth-margin-p.width(number, sizeSmall), margin/2, sizeSmall, number, false)
+	}
+}
+
+// parties draws the seller and buyer side by side
+func (p *pdfWriter) parties(parties []section) {
+	if len(parties) == 0 {
+		return
+	}
+	gap := 16.0
+	width := (contentWidth - gap*float64(len(parties)-1)) / float64(len(parties))
+	type line struct {
+		text string
+		bold bool
+	}
+	columns := make([][]line, len(parties))
+	height := 0.0
+	for i, s := range parties {
+		columns[i] = append(columns[i], line{s.Title.String(), true})
+		for _, f := range s.Fields {
+			for _, l := range p.wrap(f.Label.VI+" ("+f.Label.EN+"): "+f.Value, sizeText, width) {
+				columns[i] = append(columns[i], line{l, false})
+			}
+		}
+		height = max(height, float64(len(columns[i]))*sizeText*lineSpacing)
+	}
+	p.ensure(height)
+	for i, lines := range columns {
+		x := margin + float64(i)*(width+gap)
+		for j, l := range lines {
+			p.text(x, p.baseline(p.y-float64(j)*sizeText*lineSpacing, sizeText), sizeText, l.text, l.bold)
+		}
+	}
+	p.y -= height + sizeText
+}
+
+// table draws t with borders, its header repeated on each page it spans
+func (p *pdfWriter) table(t table) {
+	widths := make([]float64, len(t.Columns))
+	for i, c := range t.Columns {
+		widths[i] = c.Width * contentWidth
+	}
+	row := func(cells [][]string, sizes []float64, fill bool) {
+		height := 0.0
+		for i := range cells {
+			height = max(height, float64(len(cells[i]))*sizes[i]*lineSpacing)
+		}
+		height += 2 * cellPadding
+		p.ensure(height)
+		if fill {
+			fmt.Fprintf(p.page, "0.95 g %s %s %s %s re f 0 g\n", num(margin), num(p.y-height), num(contentWidth), num(height))
+		}
+		x := margin
+		for i, lines := range cells {
+			fmt.Fprintf(p.page, "0.5 w %s %s %s %s re S\n", num(x), num(p.y-height), num(widths[i]), num(height))
+			top := p.y - cellPadding
+			for _, l := range lines {
+				lx := x + cellPadding
+				if t.Columns[i].Right {
+					lx = x + widths[i] - cellPadding - p.width(l, sizes[i])
+				}
+				p.text(lx, p.baseline(top, sizes[i]), sizes[i], l, false)
+				top -= sizes[i] * lineSpacing
+			}
+			x += widths[i]
+		}
+		p.y -= height
+	}
+
+	header := func() {
+		cells := make([][]string, len(t.Columns))
+		sizes := make([]float64, len(t.Columns))
+		for i, c := range t.Columns {
+			inner := widths[i] - 2*cellPadding
+			cells[i] = append(p.wrap(c.Label.VI, sizeSmall, inner), p.wrap(c.Label.EN, sizeSmall, inner)...)
+			sizes[i] = sizeSmall
+		}
+		row(cells, sizes, true)
+	}
+	p.ensure(sizeSmall * lineSpacing * 6)
+	header()
+	p.header = header
+	for _, values := range t.Rows {
+		cells := make([][]string, len(values))
+		sizes := make([]float64, len(values))
+		for i, v := range values {
+			cells[i] = p.wrap(v, sizeText, widths[i]-2*cellPadding)
+			sizes[i] = sizeText
+		}
+		row(cells, sizes, false)
+	}
+	p.header = nil
+	p.y -= sizeText
+}
+
+// bytes assembles the PDF: catalog, pages, the embedded font and the
+// cross-reference table
+func (p *pdfWriter) bytes(inv *model.Invoice) []byte {
+	var objects [][]byte
+	add := func(format string, args ...any) int {
+		objects = append(objects, fmt.Appendf(nil, format, args...))
+		return len(objects)
+	}
+	stream := func(dict string, data []byte) int {
+		compressed := deflate(data)
+		return add("<< %s /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", dict, len(compressed), compressed)
+	}
+
+	f := p.font
+	fontFile := stream(fmt.Sprintf("/Length1 %d", len(f.data)), f.data)
+	capHeight := f.capHeight
+	if capHeight == 0 {
+		capHeight = f.ascent
+	}
+	descriptor := add("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		f.name, f.bbox[0], f.bbox[1], f.bbox[2], f.bbox[3], f.ascent, f.descent, capHeight, fontFile)
+
+	indexes := make([]int, 0, len(p.glyphs))
+	for index := range p.glyphs {
+		indexes = append(indexes, int(index))
+	}
+	sort.Ints(indexes)
+	var widths, cmap strings.Builder
+	for i, index := range indexes {
+		g := p.glyphs[sfnt.GlyphIndex(index)]
+		fmt.Fprintf(&widths, "%d [%d] ", index, g.width)
+		// A bfchar block holds at most 100 mappings
+		if i%100 == 0 {
+			if i > 0 {
+				cmap.WriteString("endbfchar\n")
+			}
+			fmt.Fprintf(&cmap, "%d beginbfchar\n", min(100, len(indexes)-i))
+		}
+		fmt.Fprintf(&cmap, "<%04X> <%s>\n", index, utf16Hex(string(g.rune)))
+	}
+	if len(indexes) > 0 {
+		cmap.WriteString("endbfchar\n")
+	}
+	cidFont := add("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /DW 1000 /CIDToGIDMap /Identity >>",
+		f.name, descriptor, widths.String())
+	toUnicode := stream("", []byte(fmt.Sprintf(toUnicodeCMap, cmap.String())))
+	font := add("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		f.name, cidFont, toUnicode)
+
+	pagesID := len(objects) + 1 + 2*len(p.pages)
+	var kids []string
+	for _, page := range p.pages {
+		content := stream("", page.Bytes())
+		id := add("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesID, num(pageWidth), num(pageHeight), font, content)
+		kids = append(kids, fmt.Sprintf("%d 0 R", id))
+	}
+	add("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+	catalog := add("<< /Type /Catalog /Pages %d 0 R >>", pagesID)
+	documentTitle := strings.TrimSpace(strings.Join([]string{title(inv).VI, inv.Series, inv.Number}, " "))
+	info := add("<< /Title <%s> /Producer (invoice-processor) >>", "FEFF"+utf16Hex(documentTitle))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, info, xref)
+	return out.Bytes()
+}
+
+// toUnicodeCMap maps the glyphs of the document back to text, so it can be
+// searched and copied from
+const toUnicodeCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def
+/CMapName /Adobe-Identity-UCS def
+/CMapType 2 def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+%sendcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data) // Writes to a bytes.Buffer don't fail
+	zw.Close()
+	return buf.Bytes()
+}
+
+// utf16Hex is s in UTF-16BE, as hex digits
+func utf16Hex(s string) string {
+	var b strings.Builder
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	return b.String()
+}
+
+// num writes a coordinate with at most two decimals
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
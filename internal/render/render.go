@@ -0,0 +1,291 @@
+// Package render draws invoices as clean, standardized documents with
+// Vietnamese and English labels: HTML for review UIs, and PDF for
+// archiving a normalized copy alongside the original
+package render
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+//go:embed fonts/Roboto-Regular.ttf
+var defaultFont []byte
+
+// Renderer renders invoices as HTML and PDF
+type Renderer struct {
+	fontData []byte
+	font     *ttfFont
+	note     string
+}
+
+// Option configures a Renderer
+type Option func(*Renderer)
+
+// WithFont sets the TrueType font PDFs are drawn and embedded with
+// (default: Roboto). It must cover Vietnamese; letters it lacks are drawn
+// without their diacritics.
+func WithFont(ttf []byte) Option {
+	return func(r *Renderer) {
+		r.fontData = ttf
+	}
+}
+
+// WithNote replaces the footer saying the document is a normalized copy
+// of the original ("" = no footer)
+func WithNote(note string) Option {
+	return func(r *Renderer) {
+		r.note = note
+	}
+}
+
+// defaultNote is the footer of rendered documents
+const defaultNote = "Bản sao chuẩn hóa từ dữ liệu trích xuất, không thay thế hóa đơn gốc / " +
+	"Normalized copy of the extracted data, not a substitute for the original invoice"
+
+// New returns a Renderer. It fails when the font of WithFont can't be
+// read.
+func New(opts ...Option) (*Renderer, error) {
+	r := &Renderer{fontData: defaultFont, note: defaultNote}
+	for _, opt := range opts {
+		opt(r)
+	}
+	font, err := parseFont(r.fontData)
+	if err != nil {
+		return nil, err
+	}
+	r.font = font
+	return r, nil
+}
+
+// label is a caption in Vietnamese and English
+type label struct {
+	VI, EN string
+}
+
+func (l label) String() string {
+	return l.VI + " / " + l.EN
+}
+
+// field is a labelled value
+type field struct {
+	Label label
+	Value string
+}
+
+// section is a titled group of fields, such as a party
+type section struct {
+	Title  label
+	Fields []field
+}
+
+// column is a column of a table
+type column struct {
+	Label label
+	Width float64 // Share of the table width, in PDFs
+	Right bool    // Numbers
+}
+
+// table is the items or the VAT summary of a document
+type table struct {
+	Columns []column
+	Rows    [][]string
+}
+
+// document is what both formats render: an invoice laid out as labelled
+// text, amounts formatted as Vietnamese documents print them
+type document struct {
+	Title   label
+	Meta    []field
+	Parties []section
+	Items   table
+	VAT     table
+	Totals  []field
+	Notes   []field
+	Footer  string
+}
+
+var (
+	labelSeller  = label{"Đơn vị bán hàng", "Seller"}
+	labelBuyer   = label{"Người mua hàng", "Buyer"}
+	labelName    = label{"Tên đơn vị", "Name"}
+	labelTaxID   = label{"Mã số thuế", "Tax ID"}
+	labelAddress = label{"Địa chỉ", "Address"}
+	labelPhone   = label{"Điện thoại", "Phone"}
+	labelEmail   = label{"Email", "Email"}
+	labelAccount = label{"Số tài khoản", "Bank account"}
+)
+
+// title is the heading of a document of inv's type
+func title(inv *model.Invoice) label {
+	switch inv.DocumentType {
+	case model.DocumentTypeCreditNote:
+		return label{"HÓA ĐƠN ĐIỀU CHỈNH GIẢM", "CREDIT NOTE"}
+	case model.DocumentTypeReceipt:
+		return label{"HÓA ĐƠN BÁN HÀNG", "SALES RECEIPT"}
+	case model.DocumentTypeDeliveryNote:
+		return label{"PHIẾU XUẤT KHO", "DELIVERY NOTE"}
+	case model.DocumentTypePurchaseOrder:
+		return label{"ĐƠN ĐẶT HÀNG", "PURCHASE ORDER"}
+	}
+	switch inv.Type {
+	case model.InvoiceTypeAdjustment:
+		return label{"HÓA ĐƠN ĐIỀU CHỈNH", "ADJUSTMENT INVOICE"}
+	case model.InvoiceTypeReplacement:
+		return label{"HÓA ĐƠN THAY THẾ", "REPLACEMENT INVOICE"}
+	}
+	return label{"HÓA ĐƠN GIÁ TRỊ GIA TĂNG", "VAT INVOICE"}
+}
+
+// layout lays inv out as a document; fields inv leaves empty are left out
+func (r *Renderer) layout(inv *model.Invoice) *document {
+	currency := inv.Currency
+	if currency == "" {
+		currency = model.CurrencyVND
+	}
+	doc := &document{Title: title(inv), Footer: r.note}
+
+	add := func(fields *[]field, l label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			*fields = append(*fields, field{l, value})
+		}
+	}
+	add(&doc.Meta, label{"Ký hiệu", "Series"}, inv.Series)
+	add(&doc.Meta, label{"Số", "Number"}, inv.Number)
+	add(&doc.Meta, label{"Ngày", "Date"}, formatDate(inv.Date))
+	if ref := inv.OriginalInvoice; ref != nil && ref.Number != "" {
+		original := ref.Number
+		if ref.Series != "" {
+			original = ref.Series + " - " + original
+		}
+		if !ref.Date.IsZero() {
+			original += ", " + formatDate(ref.Date)
+		}
+		add(&doc.Meta, label{"Hóa đơn gốc", "Original invoice"}, original)
+	}
+	add(&doc.Meta, label{"Lý do điều chỉnh", "Reason"}, inv.AdjustmentReason)
+
+	for _, p := range []struct {
+		title label
+		party model.Party
+	}{{labelSeller, inv.Seller}, {labelBuyer, inv.Buyer}} {
+		s := section{Title: p.title}
+		add(&s.Fields, labelName, p.party.Name)
+		add(&s.Fields, labelTaxID, p.party.TaxID)
+		add(&s.Fields, labelAddress, p.party.Address)
+		add(&s.Fields, labelPhone, p.party.Phone)
+		add(&s.Fields, labelEmail, p.party.Email)
+		account := p.party.BankAccount
+		if account != "" && p.party.BankName != "" {
+			account += " - " + p.party.BankName
+		}
+		add(&s.Fields, labelAccount, account)
+		if len(s.Fields) > 0 {
+			doc.Parties = append(doc.Parties, s)
+		}
+	}
+
+	doc.Items.Columns = []column{
+		{Label: label{"STT", "No."}, Width: 0.06},
+		{Label: label{"Tên hàng hóa, dịch vụ", "Description"}, Width: 0.30},
+		{Label: label{"ĐVT", "Unit"}, Width: 0.08},
+		{Label: label{"Số lượng", "Quantity"}, Width: 0.09, Right: true},
+		{Label: label{"Đơn giá", "Unit price"}, Width: 0.12, Right: true},
+		{Label: label{"Thuế suất", "VAT rate"}, Width: 0.09, Right: true},
+		{Label: label{"Thành tiền", "Amount"}, Width: 0.14, Right: true},
+		{Label: label{"Tiền thuế", "VAT"}, Width: 0.12, Right: true},
+	}
+	for i, item := range inv.Items {
+		number := item.Number
+		if number == 0 {
+			number = i + 1
+		}
+		name := item.Name
+		if item.Description != "" {
+			name += " - " + item.Description
+		}
+		amount := item.Amount.Sub(item.DiscountAmt)
+		doc.Items.Rows = append(doc.Items.Rows, []string{
+			fmt.Sprint(number), name, item.Unit, formatNumber(item.Quantity), formatNumber(item.UnitPrice),
+			item.VATRate.String(), formatNumber(amount), formatNumber(item.VATAmount),
+		})
+	}
+
+	breakdown := inv.TaxBreakdown
+	if breakdown == nil {
+		breakdown = model.SummarizeVAT(inv.Items)
+	}
+	if len(breakdown) > 1 {
+		doc.VAT.Columns = []column{
+			{Label: label{"Thuế suất", "VAT rate"}, Width: 0.4},
+			{Label: label{"Tiền chịu thuế", "Taxable amount"}, Width: 0.3, Right: true},
+			{Label: label{"Tiền thuế", "VAT"}, Width: 0.3, Right: true},
+		}
+		for _, line := range breakdown {
+			doc.VAT.Rows = append(doc.VAT.Rows, []string{line.Rate.String(), formatNumber(line.TaxableAmount), formatNumber(line.TaxAmount)})
+		}
+	}
+
+	doc.Totals = []field{
+		{label{"Cộng tiền hàng", "Subtotal"}, formatNumber(inv.SubtotalAmount)},
+		{label{"Tiền thuế GTGT", "VAT"}, formatNumber(inv.TaxAmount)},
+		{label{"Tổng cộng thanh toán", "Total"}, formatNumber(inv.TotalAmount) + " " + currency},
+	}
+	if inv.IsForeignCurrency() && !inv.ExchangeRate.IsZero() {
+		add(&doc.Totals, label{"Tỷ giá", "Exchange rate"}, formatNumber(inv.ExchangeRate)+" VND/"+currency)
+		total := model.ConvertToVND(inv.TotalAmount, inv.ExchangeRate)
+		if inv.VNDAmounts != nil && !inv.VNDAmounts.TotalAmount.IsZero() {
+			total = inv.VNDAmounts.TotalAmount
+		}
+		add(&doc.Totals, label{"Quy đổi", "In VND"}, formatNumber(total)+" VND")
+	}
+
+	add(&doc.Notes, label{"Hình thức thanh toán", "Payment method"}, inv.PaymentMethod)
+	add(&doc.Notes, label{"Điều khoản thanh toán", "Payment terms"}, inv.PaymentTerms)
+	add(&doc.Notes, label{"Ghi chú", "Remarks"}, inv.Remarks)
+	if s := inv.Signature; s != nil && s.SignerName != "" {
+		signed := s.SignerName
+		if !s.Date.IsZero() {
+			signed += ", " + formatDate(s.Date)
+		}
+		add(&doc.Notes, label{"Ký bởi", "Signed by"}, signed)
+	}
+	return doc
+}
+
+// formatDate writes t as Vietnamese documents do: 02/01/2006
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("02/01/2006")
+}
+
+// formatNumber writes d with dots between thousands and a decimal comma,
+// as Vietnamese documents do: 1.234.567,5
+func formatNumber(d decimal.Decimal) string {
+	s := d.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString("," + frac)
+	}
+	return b.String()
+}
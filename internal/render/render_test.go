@@ -0,0 +1,152 @@
+package render_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/render"
+)
+
+func testInvoice() *model.Invoice {
+	inv := &model.Invoice{
+		Number: "0000042",
+		Series: "1C24TAA",
+		Date:   time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Seller: model.Party{Name: "Công ty TNHH Thương mại <ABC>", TaxID: "0123456787", Address: "123 Lê Lợi, Quận 1, TP.HCM"},
+		Buyer:  model.Party{Name: "Trần Văn Bình", TaxID: "0312345673"},
+		Items: []model.LineItem{
+			{Number: 1, Name: "Giấy A4 Double A", Unit: "ram", Quantity: decimal.NewFromInt(10), UnitPrice: decimal.NewFromInt(65000), VATRate: model.VATRate10},
+			{Number: 2, Name: "Sách giáo khoa", Unit: "cuốn", Quantity: decimal.RequireFromString("2.5"), UnitPrice: decimal.NewFromInt(1234567), VATRate: model.VATRateKCT},
+		},
+		Currency:      "VND",
+		PaymentMethod: "Chuyển khoản",
+	}
+	inv.CalculateTotals()
+	return inv
+}
+
+func TestRenderer_HTML(t *testing.T) {
+	r, err := render.New()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.HTML(&buf, testInvoice()))
+	html := buf.String()
+
+	assert.Contains(t, html, `HÓA ĐƠN GIÁ TRỊ GIA TĂNG<span class="en">VAT INVOICE</span>`)
+	assert.Contains(t, html, "Công ty TNHH Thương mại &lt;ABC&gt;", "values are escaped")
+	assert.Contains(t, html, "Mã số thuế")
+	assert.Contains(t, html, "15/03/2024")
+	assert.Contains(t, html, `<td class="num">3.086.417,5</td>`, "amounts as Vietnamese documents print them")
+	assert.Contains(t, html, "<td>KCT</td>")
+	assert.Contains(t, html, "Tiền chịu thuế", "a VAT summary for several rates")
+	assert.Contains(t, html, "Normalized copy")
+	assert.NotContains(t, html, "Lý do điều chỉnh", "empty fields are left out")
+
+	note := testInvoice()
+	note.DocumentType = model.DocumentTypeCreditNote
+	note.OriginalInvoice = &model.InvoiceReference{Series: "1C24TAA", Number: "0000041", Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	r, err = render.New(render.WithNote(""))
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, r.HTML(&buf, note))
+	assert.Contains(t, buf.String(), "CREDIT NOTE")
+	assert.Contains(t, buf.String(), "1C24TAA - 0000041, 01/03/2024")
+	assert.NotContains(t, buf.String(), "<footer>")
+}
+
+// pdfText returns the text of the content streams of a PDF rendered with
+// the default font, mapped back through its ToUnicode map
+func pdfText(t *testing.T, data []byte) string {
+	t.Helper()
+	var streams []string
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		streams = append(streams, string(content))
+	}
+
+	glyphs := make(map[string]string)
+	for _, s := range streams {
+		for _, m := range regexp.MustCompile(`<([0-9A-F]{4})> <([0-9A-F]+)>`).FindAllStringSubmatch(s, -1) {
+			var runes []rune
+			for i := 0; i < len(m[2]); i += 4 {
+				var u rune
+				for _, c := range m[2][i : i+4] {
+					u = u*16 + rune(strings.IndexRune("0123456789ABCDEF", c))
+				}
+				runes = append(runes, u)
+			}
+			glyphs[m[1]] = string(runes)
+		}
+	}
+
+	var text strings.Builder
+	for _, s := range streams {
+		for _, m := range regexp.MustCompile(`<([0-9A-F]*)> Tj`).FindAllStringSubmatch(s, -1) {
+			for i := 0; i < len(m[1]); i += 4 {
+				text.WriteString(glyphs[m[1][i:i+4]])
+			}
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
+
+func TestRenderer_PDF(t *testing.T) {
+	r, err := render.New()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.PDF(&buf, testInvoice()))
+	require.NoError(t, api.Validate(bytes.NewReader(buf.Bytes()), nil))
+	pages, err := api.PageCount(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	text := pdfText(t, buf.Bytes())
+	assert.Contains(t, text, "HÓA ĐƠN GIÁ TRỊ GIA TĂNG\nVAT INVOICE\n")
+	assert.Contains(t, text, "Công ty TNHH Thương mại <ABC>")
+	assert.Contains(t, text, "3.086.417,5")
+	assert.Contains(t, text, "Trang / Page 1/1")
+}
+
+func TestRenderer_PDFPages(t *testing.T) {
+	r, err := render.New()
+	require.NoError(t, err)
+
+	inv := testInvoice()
+	for i := 3; i <= 80; i++ {
+		inv.Items = append(inv.Items, model.LineItem{Number: i, Name: strings.Repeat("Văn phòng phẩm các loại ", 3), Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(1000), VATRate: model.VATRate8})
+	}
+	inv.CalculateTotals()
+
+	var buf bytes.Buffer
+	require.NoError(t, r.PDF(&buf, inv))
+	require.NoError(t, api.Validate(bytes.NewReader(buf.Bytes()), nil))
+	pages, err := api.PageCount(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	assert.Greater(t, pages, 2)
+
+	text := pdfText(t, buf.Bytes())
+	assert.GreaterOrEqual(t, strings.Count(text, "Thành tiền\n"), pages-1, "the items header repeated on the pages it spans")
+	assert.Contains(t, text, "Trang / Page 2/")
+}
+
+func TestNew_Font(t *testing.T) {
+	_, err := render.New(render.WithFont([]byte("not a font")))
+	assert.ErrorContains(t, err, "failed to read font")
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Limits of the events endpoint
+const (
+	DefaultEventsLimit = 100
+	MaxEventsLimit     = 1000
+)
+
+// EventListResponse is a page of the event stream. Next is the sequence to
+// pass as after for the following page; it moves past events of other
+// tenants too, so a page may hold fewer events than the limit while more
+// follow.
+type EventListResponse struct {
+	Events []*outbox.Event `json:"events"`
+	Next   int64           `json:"next"`
+}
+
+func (s *Server) handleListEvents(c *gin.Context) {
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid after", Details: "after must be a sequence number"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = DefaultEventsLimit
+	}
+	limit = min(limit, MaxEventsLimit)
+
+	events, err := s.config.Events.Read(c.Request.Context(), after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to read events", Details: err.Error()})
+		return
+	}
+	resp := EventListResponse{Events: []*outbox.Event{}, Next: after}
+	tenant := processor.TenantFromContext(c.Request.Context())
+	for _, e := range events {
+		if e.Tenant == tenant {
+			resp.Events = append(resp.Events, e)
+		}
+		resp.Next = e.Sequence
+	}
+	c.JSON(http.StatusOK, resp)
+}
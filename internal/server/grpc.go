@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// grpcServicePath prefixes the paths of the methods of the gRPC service
+const grpcServicePath = "/invoice.InvoiceService/"
+
+// maxGRPCMessageSize is the largest request message read
+const maxGRPCMessageSize = 64 << 20
+
+// gRPC status codes (see https://grpc.github.io/grpc/core/md_doc_statuscodes.html)
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// grpcError is an error returned to a gRPC client with its status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// GRPCHandler returns the handler of the gRPC API defined in
+// api/grpc/proto/invoice.proto, for use with custom servers; it must be
+// served over HTTP/2. Only Process and ProcessBatch are implemented.
+func (s *Server) GRPCHandler() http.Handler {
+	return http.HandlerFunc(s.serveGRPC)
+}
+
+// serveGRPC answers a gRPC call. The x-tenant-id and x-request-id metadata
+// act as the X-Tenant-ID and X-Request-ID headers of the REST API.
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	ctx := r.Context()
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		ctx = logging.ContextWithCorrelationID(ctx, id)
+	}
+	ctx = logging.EnsureCorrelationID(ctx)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("X-Request-ID", logging.CorrelationID(ctx))
+
+	stream := &grpcStream{w: w, body: r.Body}
+	stream.finish(s.callGRPC(ctx, r, stream))
+}
+
+// callGRPC runs the method of a call under its deadline and tenant
+func (s *Server) callGRPC(ctx context.Context, r *http.Request, stream *grpcStream) error {
+	if timeout := r.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseGRPCTimeout(timeout)
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	tenant := r.Header.Get("X-Tenant-ID")
+	if !s.pipeline.HasTenant(tenant) {
+		return grpcErrorf(grpcInvalidArgument, "unknown tenant %q", tenant)
+	}
+	if tenant != "" {
+		ctx = processor.ContextWithTenant(ctx, tenant)
+	}
+
+	switch method, _ := strings.CutPrefix(r.URL.Path, grpcServicePath); method {
+	case "Process":
+		return s.grpcProcess(ctx, stream)
+	case "ProcessBatch":
+		return s.grpcProcessBatch(ctx, stream)
+	}
+	return grpcErrorf(grpcUnimplemented, "method %s is not implemented", r.URL.Path)
+}
+
+// grpcProcess answers Process with the results of the document, failed
+// ones included
+func (s *Server) grpcProcess(ctx context.Context, stream *grpcStream) error {
+	msg, err := stream.recv()
+	if err != nil {
+		return err
+	}
+	req, err := decodeProcessRequest(msg)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid ProcessRequest: %v", err)
+	}
+	if len(req.content) == 0 {
+		return grpcErrorf(grpcInvalidArgument, "empty content")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+	}
+	if req.documentID != "" {
+		ctx = llm.ContextWithDocumentID(ctx, req.documentID)
+	}
+
+	results := s.pipeline.Process(ctx, req.content, processor.ProcessOptions{Filename: req.filename, SplitDocuments: req.splitDocuments})
+	if err := grpcUnfinished(ctx, results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		s.saveForReview(ctx, req.documentID, result, req.content)
+	}
+	return stream.send(encodeProcessResults(results))
+}
+
+// grpcProcessBatch streams the results of ProcessBatch as each document
+// finishes, then the summary
+func (s *Server) grpcProcessBatch(ctx context.Context, stream *grpcStream) error {
+	msg, err := stream.recv()
+	if err != nil {
+		return err
+	}
+	req, err := decodeProcessBatchRequest(msg)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid ProcessBatchRequest: %v", err)
+	}
+	if len(req.documents) == 0 {
+		return grpcErrorf(grpcInvalidArgument, "no documents")
+	}
+
+	// Workers finish documents concurrently; their results are sent one at
+	// a time, and those of inputs never reported (skipped after a failure)
+	// after the batch
+	var mu sync.Mutex
+	var sendErr error
+	reported := make([]bool, len(req.documents))
+	send := func(index int, results []*processor.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported[index] = true
+		for _, result := range results {
+			if sendErr != nil {
+				return
+			}
+			sendErr = stream.send(encodeBatchItem(index, result))
+		}
+	}
+	results, summary := s.pipeline.ProcessBatch(ctx, req.documents, processor.BatchOptions{
+		Workers:         req.workers,
+		ContinueOnError: req.continueOnError,
+		Timeout:         req.timeout,
+		SplitDocuments:  req.splitDocuments,
+		Done: func(index int, input processor.BatchInput, results []*processor.Result) {
+			for _, result := range results {
+				s.saveForReview(ctx, input.Name, result, input.Data)
+			}
+			send(index, results)
+		},
+	})
+	if err := grpcUnfinished(ctx, results); err != nil {
+		return err
+	}
+	for i, document := range req.documents {
+		if !reported[i] {
+			send(i, []*processor.Result{{Error: processor.ErrBatchAborted, Source: document.Name}})
+		}
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.send(encodeBatchSummary(summary))
+}
+
+// grpcUnfinished returns the status of a call whose documents were not all
+// finished: unavailable when the server is shutting down, so the client
+// retries elsewhere, or the deadline or cancellation of the call. Documents
+// that failed on their own are answered with their error in Result.
+func grpcUnfinished(ctx context.Context, results []*processor.Result) error {
+	for _, result := range results {
+		if errors.Is(result.Error, processor.ErrStopped) {
+			return grpcErrorf(grpcUnavailable, "server is shutting down")
+		}
+	}
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcErrorf(grpcDeadlineExceeded, "deadline exceeded")
+	case err != nil:
+		return grpcErrorf(grpcCanceled, "call canceled")
+	}
+	return nil
+}
+
+// grpcStream reads the request messages of a call and writes its response
+// messages and status
+type grpcStream struct {
+	w    http.ResponseWriter
+	body io.Reader
+	sent bool // A message was written
+}
+
+// recv reads a length-prefixed message
+func (st *grpcStream) recv() ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(st.body, prefix[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "failed to read request message: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessageSize {
+		return nil, grpcErrorf(grpcResourceExhausted, "request message of %d bytes is larger than %d", size, maxGRPCMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(st.body, msg); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "failed to read request message: %v", err)
+	}
+	return msg, nil
+}
+
+// send writes a length-prefixed message and flushes it to the client
+func (st *grpcStream) send(msg protoMessage) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	st.sent = true
+	if _, err := st.w.Write(append(prefix[:], msg...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(st.w).Flush()
+}
+
+// finish writes the status of the call as trailers
+func (st *grpcStream) finish(err error) {
+	code, message := grpcOK, ""
+	var ge *grpcError
+	switch {
+	case errors.As(err, &ge):
+		code, message = ge.code, ge.message
+	case err != nil:
+		code, message = grpcInternal, err.Error()
+	}
+	st.w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		st.w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(message))
+	}
+	if !st.sent {
+		st.w.WriteHeader(http.StatusOK)
+	}
+}
+
+// parseGRPCTimeout reads a grpc-timeout header, such as 100m (milliseconds)
+// or 5S
+func parseGRPCTimeout(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// encodeGRPCMessage percent-encodes a status message, as grpc-message
+// requires for bytes outside printable ASCII
+func encodeGRPCMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
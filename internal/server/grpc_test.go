@@ -0,0 +1,268 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/server"
+)
+
+const grpcInvoiceXML = `<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`
+
+// grpcResponse is the answer to a gRPC call
+type grpcResponse struct {
+	header   http.Header
+	messages [][]byte
+	status   string
+	message  string
+}
+
+// grpcCall sends a request message to a method of the invoice service
+func grpcCall(t *testing.T, client *http.Client, baseURL, method string, msg []byte, header http.Header) *grpcResponse {
+	t.Helper()
+	body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/invoice.InvoiceService/"+method, bytes.NewReader(append(body, msg...)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+
+	out := &grpcResponse{header: resp.Header}
+	for {
+		var prefix [5]byte
+		_, err := io.ReadFull(resp.Body, prefix[:])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		_, err = io.ReadFull(resp.Body, msg)
+		require.NoError(t, err)
+		out.messages = append(out.messages, msg)
+	}
+	out.status = resp.Trailer.Get("Grpc-Status")
+	out.message = resp.Trailer.Get("Grpc-Message")
+	return out
+}
+
+// protoValues decodes a message into its values by field number: []byte
+// for length-delimited fields, uint64 for varints
+func protoValues(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	values := make(map[protowire.Number][]any)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		values[num] = append(values[num], v)
+	}
+	return values
+}
+
+// protoString returns the string field num of a decoded message
+func protoString(values map[protowire.Number][]any, num protowire.Number) string {
+	if len(values[num]) == 0 {
+		return ""
+	}
+	return string(values[num][0].([]byte))
+}
+
+func processRequest(content []byte, filename, documentID string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, content)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, filename)
+	if documentID != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, documentID)
+	}
+	return b
+}
+
+func newGRPCServer(t *testing.T, config *server.Config) *httptest.Server {
+	ts := httptest.NewUnstartedServer(server.NewServer(config).GRPCHandler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGRPCProcess(t *testing.T) {
+	ts := newGRPCServer(t, &server.Config{})
+
+	resp := grpcCall(t, ts.Client(), ts.URL, "Process", processRequest([]byte(grpcInvoiceXML), "a.xml", "doc-1"), http.Header{"X-Request-Id": {"req-1"}})
+	assert.Equal(t, "0", resp.status, resp.message)
+	assert.Equal(t, "req-1", resp.header.Get("X-Request-ID"))
+	require.Len(t, resp.messages, 1)
+	results := protoValues(t, resp.messages[0])[1]
+	require.Len(t, results, 1)
+
+	result := protoValues(t, results[0].([]byte))
+	assert.Equal(t, "xml", protoString(result, 2))
+	assert.Empty(t, protoString(result, 5))
+	assert.Equal(t, "req-1", protoString(result, 8))
+	assert.NotEmpty(t, protoString(result, 10), "fingerprint")
+	invoice := protoValues(t, result[1][0].([]byte))
+	assert.Equal(t, "0000042", protoString(invoice, 2))
+	assert.Equal(t, "216000", protoString(invoice, 12))
+	seller := protoValues(t, invoice[7][0].([]byte))
+	assert.Equal(t, "0123456789", protoString(seller, 2))
+
+	// Failed documents are answered with their error
+	resp = grpcCall(t, ts.Client(), ts.URL, "Process", processRequest([]byte("not an invoice"), "b.xml", ""), nil)
+	assert.Equal(t, "0", resp.status, resp.message)
+	require.Len(t, resp.messages, 1)
+	result = protoValues(t, protoValues(t, resp.messages[0])[1][0].([]byte))
+	assert.NotEmpty(t, protoString(result, 5))
+	assert.Empty(t, result[1], "no invoice")
+}
+
+func TestGRPCProcess_Errors(t *testing.T) {
+	ts := newGRPCServer(t, &server.Config{Tenants: map[string]processor.Tenant{"acme": {}}})
+
+	resp := grpcCall(t, ts.Client(), ts.URL, "Process", processRequest(nil, "a.xml", ""), nil)
+	assert.Equal(t, "3", resp.status)
+	assert.Equal(t, "empty content", resp.message)
+	assert.Empty(t, resp.messages)
+
+	resp = grpcCall(t, ts.Client(), ts.URL, "Process", processRequest([]byte(grpcInvoiceXML), "a.xml", ""), http.Header{"X-Tenant-Id": {"globex"}})
+	assert.Equal(t, "3", resp.status)
+	assert.Equal(t, `unknown tenant "globex"`, resp.message)
+
+	resp = grpcCall(t, ts.Client(), ts.URL, "Process", processRequest([]byte(grpcInvoiceXML), "a.xml", ""), http.Header{"X-Tenant-Id": {"acme"}})
+	assert.Equal(t, "0", resp.status, resp.message)
+
+	resp = grpcCall(t, ts.Client(), ts.URL, "ProcessXML", nil, nil)
+	assert.Equal(t, "12", resp.status)
+
+	resp = grpcCall(t, ts.Client(), ts.URL, "Process", []byte{0xff}, nil)
+	assert.Equal(t, "3", resp.status)
+	assert.Contains(t, resp.message, "invalid ProcessRequest")
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/invoice.InvoiceService/Process", nil)
+	httpResp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	httpResp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, httpResp.StatusCode)
+}
+
+func TestGRPCProcessBatch(t *testing.T) {
+	ts := newGRPCServer(t, &server.Config{})
+
+	var req []byte
+	for _, doc := range []struct{ name, content string }{
+		{"a.xml", grpcInvoiceXML},
+		{"b.xml", "not an invoice"},
+		{"c.xml", grpcInvoiceXML},
+	} {
+		var d []byte
+		d = protowire.AppendTag(d, 1, protowire.BytesType)
+		d = protowire.AppendString(d, doc.name)
+		d = protowire.AppendTag(d, 2, protowire.BytesType)
+		d = protowire.AppendString(d, doc.content)
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, d)
+	}
+	req = protowire.AppendTag(req, 2, protowire.VarintType)
+	req = protowire.AppendVarint(req, 1) // One worker, so b.xml fails before c.xml starts
+
+	resp := grpcCall(t, ts.Client(), ts.URL, "ProcessBatch", req, nil)
+	assert.Equal(t, "0", resp.status, resp.message)
+	require.Len(t, resp.messages, 4)
+
+	for i, want := range []struct {
+		source string
+		failed bool
+	}{{"a.xml", false}, {"b.xml", true}, {"c.xml", true}} {
+		item := protoValues(t, protoValues(t, resp.messages[i])[1][0].([]byte))
+		if i == 0 {
+			assert.Empty(t, item[1], "index 0")
+		} else {
+			assert.Equal(t, []any{uint64(i)}, item[1])
+		}
+		result := protoValues(t, item[2][0].([]byte))
+		assert.Equal(t, want.source, protoString(result, 7))
+		assert.Equal(t, want.failed, protoString(result, 5) != "", want.source)
+	}
+	last := protoValues(t, protoValues(t, resp.messages[2])[1][0].([]byte))
+	assert.Equal(t, processor.ErrBatchAborted.Error(), protoString(protoValues(t, last[2][0].([]byte)), 5))
+
+	summary := protoValues(t, protoValues(t, resp.messages[3])[2][0].([]byte))
+	assert.Equal(t, []any{uint64(3)}, summary[1], "inputs")
+	assert.Equal(t, []any{uint64(2)}, summary[2], "documents")
+	assert.Equal(t, []any{uint64(1)}, summary[3], "succeeded")
+	assert.Equal(t, []any{uint64(1)}, summary[4], "failed")
+	assert.Equal(t, []any{uint64(1)}, summary[5], "skipped")
+
+	resp = grpcCall(t, ts.Client(), ts.URL, "ProcessBatch", nil, nil)
+	assert.Equal(t, "3", resp.status)
+	assert.Equal(t, "no documents", resp.message)
+}
+
+// freeAddress returns a local address nothing listens on
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestGRPCServer(t *testing.T) {
+	grpcAddr := freeAddress(t)
+	srv := server.NewServer(&server.Config{Address: freeAddress(t), GRPCAddress: grpcAddr})
+	done := make(chan error)
+	go func() { done <- srv.Run() }()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", grpcAddr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	resp := grpcCall(t, client, "http://"+grpcAddr, "Process", processRequest([]byte(grpcInvoiceXML), "a.xml", ""), nil)
+	assert.Equal(t, "0", resp.status, resp.message)
+	require.Len(t, resp.messages, 1)
+
+	require.NoError(t, srv.Stop(context.Background()))
+	require.NoError(t, <-done)
+}
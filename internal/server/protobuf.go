@@ -0,0 +1,321 @@
+package server
+
+import (
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// The messages of the gRPC API are encoded by hand after
+// api/grpc/proto/invoice.proto; keep the field numbers in sync with it.
+
+// protoMessage is an encoded protobuf message. Fields with their zero value
+// are left out, as proto3 does.
+type protoMessage []byte
+
+func (m *protoMessage) addString(num protowire.Number, s string) {
+	if s != "" {
+		*m = protowire.AppendTag(*m, num, protowire.BytesType)
+		*m = protowire.AppendString(*m, s)
+	}
+}
+
+func (m *protoMessage) addMessage(num protowire.Number, sub protoMessage) {
+	*m = protowire.AppendTag(*m, num, protowire.BytesType)
+	*m = protowire.AppendBytes(*m, sub)
+}
+
+func (m *protoMessage) addInt(num protowire.Number, v int64) {
+	if v != 0 {
+		*m = protowire.AppendTag(*m, num, protowire.VarintType)
+		*m = protowire.AppendVarint(*m, uint64(v))
+	}
+}
+
+func (m *protoMessage) addBool(num protowire.Number, v bool) {
+	if v {
+		*m = protowire.AppendTag(*m, num, protowire.VarintType)
+		*m = protowire.AppendVarint(*m, 1)
+	}
+}
+
+func (m *protoMessage) addDouble(num protowire.Number, v float64) {
+	if v != 0 {
+		*m = protowire.AppendTag(*m, num, protowire.Fixed64Type)
+		*m = protowire.AppendFixed64(*m, math.Float64bits(v))
+	}
+}
+
+// protoField is a field of a decoded message
+type protoField struct {
+	num    protowire.Number
+	bytes  []byte // Of length-delimited fields
+	varint uint64 // Of varint fields
+}
+
+// protoFields decodes the fields of a message, skipping those of types the
+// API doesn't use
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := protoField{num: num}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// processRequest is the ProcessRequest message
+type processRequest struct {
+	content        []byte
+	filename       string
+	documentID     string
+	splitDocuments bool
+}
+
+func decodeProcessRequest(b []byte) (*processRequest, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	req := &processRequest{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			req.content = f.bytes
+		case 2:
+			req.filename = string(f.bytes)
+		case 3:
+			req.documentID = string(f.bytes)
+		case 4:
+			req.splitDocuments = f.varint != 0
+		}
+	}
+	return req, nil
+}
+
+// processBatchRequest is the ProcessBatchRequest message
+type processBatchRequest struct {
+	documents       []processor.BatchInput
+	workers         int
+	continueOnError bool
+	timeout         time.Duration
+	splitDocuments  bool
+}
+
+func decodeProcessBatchRequest(b []byte) (*processBatchRequest, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	req := &processBatchRequest{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			doc, err := decodeBatchDocument(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			req.documents = append(req.documents, doc)
+		case 2:
+			req.workers = int(int32(f.varint))
+		case 3:
+			req.continueOnError = f.varint != 0
+		case 4:
+			req.timeout = time.Duration(int64(f.varint)) * time.Millisecond
+		case 5:
+			req.splitDocuments = f.varint != 0
+		}
+	}
+	return req, nil
+}
+
+// decodeBatchDocument decodes a BatchDocument message
+func decodeBatchDocument(b []byte) (processor.BatchInput, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return processor.BatchInput{}, err
+	}
+	var doc processor.BatchInput
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			doc.Name = string(f.bytes)
+		case 2:
+			doc.Data = f.bytes
+		}
+	}
+	return doc, nil
+}
+
+// encodeProcessResults encodes a ProcessResults message
+func encodeProcessResults(results []*processor.Result) protoMessage {
+	var m protoMessage
+	for _, r := range results {
+		m.addMessage(1, encodeResult(r))
+	}
+	return m
+}
+
+// encodeBatchItem encodes a ProcessBatchResponse carrying the result of the
+// document at index
+func encodeBatchItem(index int, r *processor.Result) protoMessage {
+	var item protoMessage
+	item.addInt(1, int64(index))
+	item.addMessage(2, encodeResult(r))
+	var m protoMessage
+	m.addMessage(1, item)
+	return m
+}
+
+// encodeBatchSummary encodes a ProcessBatchResponse carrying the summary
+func encodeBatchSummary(s *processor.BatchSummary) protoMessage {
+	var summary protoMessage
+	summary.addInt(1, int64(s.Inputs))
+	summary.addInt(2, int64(s.Documents))
+	summary.addInt(3, int64(s.Succeeded))
+	summary.addInt(4, int64(s.Failed))
+	summary.addInt(5, int64(s.Skipped))
+	var m protoMessage
+	m.addMessage(2, summary)
+	return m
+}
+
+// encodeResult encodes a Result message
+func encodeResult(r *processor.Result) protoMessage {
+	e := r.Encode()
+	var m protoMessage
+	if r.Invoice != nil {
+		m.addMessage(1, encodeInvoice(r.Invoice))
+	}
+	m.addString(2, string(r.Method))
+	m.addDouble(3, r.Confidence)
+	for _, w := range r.Warnings {
+		m.addString(4, w)
+	}
+	m.addString(5, e.Error)
+	m.addBool(6, e.Skipped)
+	m.addString(7, r.Source)
+	m.addString(8, r.CorrelationID)
+	for _, f := range r.Findings {
+		var finding protoMessage
+		finding.addString(1, f.Rule)
+		finding.addString(2, f.Field)
+		finding.addString(3, f.Message)
+		finding.addString(4, string(f.Severity))
+		m.addMessage(9, finding)
+	}
+	m.addString(10, r.Fingerprint)
+	m.addBool(11, r.Duplicate)
+	m.addString(12, r.DuplicateOf)
+	m.addBool(13, r.HasHandwriting)
+	return m
+}
+
+// encodeInvoice encodes an Invoice message
+func encodeInvoice(inv *model.Invoice) protoMessage {
+	var m protoMessage
+	m.addString(1, inv.ID)
+	m.addString(2, inv.Number)
+	m.addString(3, inv.Series)
+	if !inv.Date.IsZero() {
+		m.addString(4, inv.Date.Format(time.DateOnly))
+	}
+	m.addString(5, string(inv.Type))
+	m.addString(6, string(inv.Provider))
+	m.addMessage(7, encodeParty(inv.Seller))
+	m.addMessage(8, encodeParty(inv.Buyer))
+	for _, item := range inv.Items {
+		m.addMessage(9, encodeLineItem(item))
+	}
+	m.addString(10, inv.SubtotalAmount.String())
+	m.addString(11, inv.TaxAmount.String())
+	m.addString(12, inv.TotalAmount.String())
+	m.addString(13, inv.Currency)
+	m.addString(14, optionalDecimal(inv.ExchangeRate))
+	m.addString(15, inv.Remarks)
+	m.addString(16, inv.PaymentTerms)
+	if sig := inv.Signature; sig != nil {
+		var s protoMessage
+		s.addString(1, sig.Value)
+		if !sig.Date.IsZero() {
+			s.addString(2, sig.Date.Format(time.RFC3339))
+		}
+		s.addString(3, sig.SignerName)
+		s.addString(4, sig.SignerPosition)
+		s.addString(5, sig.CertSerial)
+		m.addMessage(17, s)
+	}
+	return m
+}
+
+func encodeParty(p model.Party) protoMessage {
+	var m protoMessage
+	m.addString(1, p.Name)
+	m.addString(2, p.TaxID)
+	m.addString(3, p.Address)
+	m.addString(4, p.Phone)
+	m.addString(5, p.Email)
+	m.addString(6, p.BankAccount)
+	m.addString(7, p.BankName)
+	return m
+}
+
+func encodeLineItem(item model.LineItem) protoMessage {
+	var m protoMessage
+	m.addInt(1, int64(item.Number))
+	m.addString(2, item.Code)
+	m.addString(3, item.Name)
+	m.addString(4, item.Description)
+	m.addString(5, item.Unit)
+	m.addString(6, item.Quantity.String())
+	m.addString(7, item.UnitPrice.String())
+	m.addString(8, optionalDecimal(item.Discount))
+	m.addInt(9, int64(vatRateNumber(item.VATRate)))
+	m.addString(10, item.Amount.String())
+	m.addString(11, item.DiscountAmt.String())
+	m.addString(12, item.VATAmount.String())
+	m.addString(13, item.Total.String())
+	return m
+}
+
+// vatRateNumber is the int32 vat_rate of a rate: its whole percentage, or
+// the -1 (KCT) and -2 (KKKNT) providers write for the categories
+func vatRateNumber(rate model.VATRate) int32 {
+	switch rate.Category {
+	case model.VATCategoryNonTaxable:
+		return -1
+	case model.VATCategoryNotDeclared:
+		return -2
+	}
+	return int32(rate.Percent.IntPart())
+}
+
+// optionalDecimal leaves out zero amounts of optional fields
+func optionalDecimal(d decimal.Decimal) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+// ReplayRequest is the body of the replay endpoint. Empty fields keep the
+// server's configuration.
+type ReplayRequest struct {
+	Strategies string `json:"strategies,omitempty"` // e.g. "embedded_xml,vision" (see processor.ParseStrategies)
+	Model      string `json:"model,omitempty"`
+}
+
+func (s *Server) handleListQuarantine(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	q := store.Query{Tenant: processor.TenantFromContext(c.Request.Context()), Failed: true, ErrorClass: c.Query("error_class"), Limit: limit, Offset: offset}
+	records, err := s.store.Query(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list quarantined documents", Details: err.Error()})
+		return
+	}
+	for _, rec := range records {
+		withoutArtifactData(rec)
+	}
+	c.JSON(http.StatusOK, ReviewListResponse{Records: records})
+}
+
+func (s *Server) handleReplay(c *gin.Context) {
+	var req ReplayRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request", Details: err.Error()})
+			return
+		}
+	}
+	opts := store.ReplayOptions{Model: req.Model, ReviewThreshold: s.config.ReviewThreshold}
+	if strings.TrimSpace(req.Strategies) != "" {
+		strategies, err := processor.ParseStrategies(req.Strategies)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid strategies", Details: err.Error()})
+			return
+		}
+		opts.Strategies = strategies
+	}
+
+	rec, err := store.Replay(c.Request.Context(), s.store, s.pipeline, c.Param("id"), opts)
+	if errors.Is(err, store.ErrNoArtifact) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	withoutArtifactData(rec)
+	c.JSON(http.StatusOK, rec)
+}
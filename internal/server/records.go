@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+// StatusRequest is the body of the status endpoint
+type StatusRequest struct {
+	Status string `json:"status" binding:"required"` // See store.Status
+	Actor  string `json:"actor" binding:"required"`
+	Note   string `json:"note,omitempty"`
+}
+
+func (s *Server) handleListRecords(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	q := store.Query{Tenant: processor.TenantFromContext(c.Request.Context()), Limit: limit, Offset: offset}
+	if c.Query("status") != "" {
+		status, err := store.ParseStatus(c.Query("status"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid status", Details: err.Error()})
+			return
+		}
+		q.Status = status
+	}
+	records, err := s.store.Query(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list records", Details: err.Error()})
+		return
+	}
+	for _, rec := range records {
+		withoutArtifactData(rec)
+	}
+	c.JSON(http.StatusOK, ReviewListResponse{Records: records})
+}
+
+func (s *Server) handleSetStatus(c *gin.Context) {
+	var req StatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request", Details: err.Error()})
+		return
+	}
+	status, err := store.ParseStatus(req.Status)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid status", Details: err.Error()})
+		return
+	}
+	rec, err := s.store.SetStatus(c.Request.Context(), c.Param("id"), status, req.Actor, req.Note)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	withoutArtifactData(rec)
+	c.JSON(http.StatusOK, rec)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+// DefaultReviewThreshold is the confidence below which results are queued
+// for review when Config.ReviewThreshold is not set
+const DefaultReviewThreshold = 0.7
+
+// ReviewRequest is the body of the claim, approve and correct endpoints
+type ReviewRequest struct {
+	Reviewer string         `json:"reviewer" binding:"required"`
+	Invoice  *model.Invoice `json:"invoice,omitempty"` // Corrected invoice (correct only)
+}
+
+// ReviewListResponse is the response of the review list endpoint
+type ReviewListResponse struct {
+	Records []*store.Record `json:"records"`
+}
+
+// saveForReview stores a result that needs review with the uploaded
+// document, returning its record ID, or "" when it doesn't need review or
+// there is no store
+func (s *Server) saveForReview(ctx context.Context, documentID string, result *processor.Result, body []byte) string {
+	if s.store == nil || result.IdempotentReplay {
+		return "" // Queued when first processed
+	}
+	if errors.Is(result.Error, processor.ErrStopped) {
+		return "" // Submitted again by the client
+	}
+	if result.Data == nil {
+		result.Data = body
+	}
+	rec := store.NewRecord(documentID, result, s.config.ReviewThreshold)
+	if !rec.NeedsReview {
+		return ""
+	}
+	if err := s.store.SaveResult(ctx, rec); err != nil {
+		result.Warnings = append(result.Warnings, "failed to queue for review: "+err.Error())
+		return ""
+	}
+	return rec.ID
+}
+
+func (s *Server) handleListReviews(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	records, err := s.store.Query(c.Request.Context(), store.Query{Tenant: processor.TenantFromContext(c.Request.Context()), PendingReview: true, Limit: limit, Offset: offset})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list reviews", Details: err.Error()})
+		return
+	}
+	for _, rec := range records {
+		withoutArtifactData(rec)
+	}
+	c.JSON(http.StatusOK, ReviewListResponse{Records: records})
+}
+
+func (s *Server) handleGetReview(c *gin.Context) {
+	rec, err := s.store.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	withoutArtifactData(rec)
+	c.JSON(http.StatusOK, rec)
+}
+
+func (s *Server) handleGetArtifact(c *gin.Context) {
+	rec, err := s.store.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	if rec.Artifact == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "record has no artifact"})
+		return
+	}
+	c.Data(http.StatusOK, rec.Artifact.MimeType, rec.Artifact.Data)
+}
+
+func (s *Server) handleClaimReview(c *gin.Context) {
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request", Details: err.Error()})
+		return
+	}
+	rec, err := s.store.Claim(c.Request.Context(), c.Param("id"), req.Reviewer)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	withoutArtifactData(rec)
+	c.JSON(http.StatusOK, rec)
+}
+
+func (s *Server) handleCorrectReview(c *gin.Context) {
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request", Details: err.Error()})
+		return
+	}
+	if req.Invoice == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "missing corrected invoice"})
+		return
+	}
+	if err := s.store.Correct(c.Request.Context(), c.Param("id"), req.Reviewer, req.Invoice); err != nil {
+		reviewError(c, err)
+		return
+	}
+	s.handleGetReview(c)
+}
+
+func (s *Server) handleApproveReview(c *gin.Context) {
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request", Details: err.Error()})
+		return
+	}
+	// Claiming first keeps off records another reviewer is working on
+	ctx, id := c.Request.Context(), c.Param("id")
+	_, err := s.store.Claim(ctx, id, req.Reviewer)
+	if err == nil {
+		err = s.store.MarkReviewed(ctx, id, req.Reviewer)
+	}
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	s.handleGetReview(c)
+}
+
+// tenantRecord answers 404 for records of another tenant than the request's,
+// as if they did not exist
+func (s *Server) tenantRecord(c *gin.Context) {
+	ctx := c.Request.Context()
+	rec, err := s.store.GetByID(ctx, c.Param("id"))
+	if err == nil && rec.Tenant != processor.TenantFromContext(ctx) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		c.Abort()
+		reviewError(c, err)
+		return
+	}
+	c.Next()
+}
+
+// withoutArtifactData drops the document from a record sent as JSON; it is
+// served by the artifact endpoint
+func withoutArtifactData(rec *store.Record) {
+	if rec.Artifact != nil {
+		artifact := *rec.Artifact
+		artifact.Data = nil
+		rec.Artifact = &artifact
+	}
+}
+
+// reviewError writes the response for a store error
+func reviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, store.ErrClaimed), errors.Is(err, store.ErrReviewed), errors.Is(err, store.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "review store failed", Details: err.Error()})
+	}
+}
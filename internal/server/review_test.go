@@ -0,0 +1,189 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/server"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+func TestReviewQueue(t *testing.T) {
+	srv := server.NewServer(&server.Config{Address: ":8080", Store: store.NewMemoryStore()})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Document-ID", "upload-1.xml")
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// A document that fails to parse is queued with its upload
+	w := do(http.MethodPost, "/api/v1/process/xml", "<Unknown/>")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var failed server.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+	require.NotEmpty(t, failed.ID)
+
+	w = do(http.MethodGet, "/api/v1/reviews", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list server.ReviewListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Records, 1)
+	assert.Equal(t, "upload-1.xml", list.Records[0].DocumentID)
+	assert.Equal(t, 10, list.Records[0].Artifact.Size)
+	assert.Empty(t, list.Records[0].Artifact.Data, "the document is served separately")
+
+	w = do(http.MethodGet, "/api/v1/reviews/"+failed.ID+"/artifact", "")
+	assert.Equal(t, "<Unknown/>", w.Body.String())
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/v1/reviews/"+failed.ID+"/claim", `{"reviewer":"alice"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/v1/reviews/"+failed.ID+"/claim", `{"reviewer":"bob"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/reviews/"+failed.ID+"/correct", `{"reviewer":"alice"}`).Code)
+
+	w = do(http.MethodPost, "/api/v1/reviews/"+failed.ID+"/correct",
+		`{"reviewer":"alice","invoice":{"number":"0000042","seller":{"name":"ABC","tax_id":"0123456789"}}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rec store.Record
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rec))
+	assert.Equal(t, "0000042", rec.Invoice.Number)
+	assert.Equal(t, "alice", rec.ReviewedBy)
+
+	w = do(http.MethodGet, "/api/v1/reviews", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Empty(t, list.Records)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/v1/reviews/missing", "").Code)
+}
+
+func TestReviewQueue_ConfidentResultsNotQueued(t *testing.T) {
+	s := store.NewMemoryStore()
+	srv := server.NewServer(&server.Config{Address: ":8080", Store: s})
+	body := `<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456787</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/process/xml", bytes.NewBufferString(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp server.ProcessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.ID)
+
+	w = httptest.NewRecorder()
+	newTestServer().Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/reviews", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "the review API needs a store")
+}
+
+func TestQuarantine(t *testing.T) {
+	srv := server.NewServer(&server.Config{Address: ":8080", Store: store.NewMemoryStore()})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/process/xml", "<Unknown/>")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var failed server.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+
+	w = do(http.MethodGet, "/api/v1/quarantine?error_class=parse", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list server.ReviewListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Records, 1)
+	assert.Equal(t, "parse", list.Records[0].ErrorClass)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/quarantine/"+failed.ID+"/replay", `{"strategies":"ocr"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/v1/quarantine/missing/replay", "").Code)
+
+	w = do(http.MethodPost, "/api/v1/quarantine/"+failed.ID+"/replay", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var rec store.Record
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rec))
+	assert.NotEmpty(t, rec.Error, "still fails")
+	assert.Len(t, rec.Attempts, 2)
+}
+
+func TestRecordStatus(t *testing.T) {
+	srv := server.NewServer(&server.Config{Address: ":8080", Store: store.NewMemoryStore()})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/process/xml", "<Unknown/>")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var failed server.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+
+	var list server.ReviewListResponse
+	require.NoError(t, json.Unmarshal(do(http.MethodGet, "/api/v1/records?status=received", "").Body.Bytes(), &list))
+	require.Len(t, list.Records, 1)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/v1/records?status=paid", "").Code)
+
+	path := "/api/v1/records/" + failed.ID + "/status"
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, path, `{"status":"approved"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, path, `{"status":"approved","actor":"alice"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/v1/records/missing/status", `{"status":"cancelled","actor":"alice"}`).Code)
+
+	w = do(http.MethodPost, path, `{"status":"cancelled","actor":"alice","note":"not ours"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rec store.Record
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rec))
+	assert.Equal(t, store.StatusCancelled, rec.Status)
+	require.Len(t, rec.History, 2)
+	assert.Equal(t, "not ours", rec.History[1].Note)
+	assert.Empty(t, rec.Artifact.Data)
+}
+
+func TestTenants(t *testing.T) {
+	srv := server.NewServer(&server.Config{
+		Address: ":8080",
+		Store:   store.NewMemoryStore(),
+		Tenants: map[string]processor.Tenant{"acme": {}, "globex": {}},
+	})
+	do := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Tenant-ID", tenant)
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("initech", http.MethodPost, "/api/v1/process/xml", "<Unknown/>")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("acme", http.MethodPost, "/api/v1/process/xml", "<Unknown/>")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var failed server.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+	require.NotEmpty(t, failed.ID)
+
+	var list server.ReviewListResponse
+	require.NoError(t, json.Unmarshal(do("acme", http.MethodGet, "/api/v1/reviews", "").Body.Bytes(), &list))
+	require.Len(t, list.Records, 1)
+	assert.Equal(t, "acme", list.Records[0].Tenant)
+	assert.Equal(t, http.StatusOK, do("acme", http.MethodGet, "/api/v1/reviews/"+failed.ID, "").Code)
+
+	// Other tenants see neither the record nor its document
+	require.NoError(t, json.Unmarshal(do("globex", http.MethodGet, "/api/v1/quarantine", "").Body.Bytes(), &list))
+	assert.Empty(t, list.Records)
+	assert.Equal(t, http.StatusNotFound, do("globex", http.MethodGet, "/api/v1/reviews/"+failed.ID+"/artifact", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("", http.MethodPost, "/api/v1/reviews/"+failed.ID+"/claim", `{"reviewer":"bob"}`).Code)
+
+	// Nor do requests without a tenant
+	for _, path := range []string{"/api/v1/reviews", "/api/v1/quarantine", "/api/v1/records"} {
+		w := do("", http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, w.Code, path)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Empty(t, list.Records, path)
+	}
+	assert.Equal(t, http.StatusNotFound, do("", http.MethodGet, "/api/v1/records/"+failed.ID, "").Code)
+}
@@ -2,29 +2,79 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/metrics"
+	"github.com/rezonia/invoice-processor/internal/outbox"
 	"github.com/rezonia/invoice-processor/internal/processor"
 	"github.com/rezonia/invoice-processor/internal/signature"
 	"github.com/rezonia/invoice-processor/internal/signature/pdf"
 	"github.com/rezonia/invoice-processor/internal/signature/trust"
 	"github.com/rezonia/invoice-processor/internal/signature/xml"
+	"github.com/rezonia/invoice-processor/internal/store"
+	"github.com/rezonia/invoice-processor/internal/webhook"
 )
 
 // Config holds server configuration
 type Config struct {
 	Address        string
 	APIKey         string
+	LLMProvider    string // openai (default), gemini, azure, bedrock, ollama
 	LLMBaseURL     string
 	LLMModel       string
 	LLMVisionModel string
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
 	Debug          bool
+	Metrics        bool // Serve Prometheus metrics at GET /metrics
+
+	// GRPCAddress serves the gRPC API (see GRPCHandler) over unencrypted
+	// HTTP/2 on a second address when set
+	GRPCAddress string
+
+	// Logger receives pipeline and LLM logs. The X-Request-ID header of a
+	// request, or a generated ID, is logged as its correlation ID and
+	// returned in the X-Request-ID response header.
+	Logger logging.Logger
+
+	// Store keeps results that need review (failed, or below
+	// ReviewThreshold) with the uploaded document, for the /reviews and
+	// /quarantine APIs
+	Store           store.Store
+	ReviewThreshold float64 // Default: 0.7
+
+	// Webhook is notified of every processed document. The caller closes
+	// it after the server stops.
+	Webhook *webhook.Dispatcher
+
+	// Events records the events of every extracted invoice, served at
+	// GET /api/v1/events for downstream systems to follow (see package
+	// outbox)
+	Events outbox.Store
+
+	// Idempotency answers a document submitted again with its earlier
+	// result, without processing it: a request with the Idempotency-Key
+	// header of an earlier one, or without the header, the same body sent
+	// to the same endpoint. Replayed responses carry the
+	// Idempotent-Replayed header.
+	Idempotency processor.IdempotencyStore
+
+	// Tenants are the client companies requests can be processed for with
+	// the X-Tenant-ID header, by ID. The review, quarantine and records
+	// APIs only show the records of the tenant of a request; those without
+	// the header, the records without a tenant.
+	Tenants map[string]processor.Tenant
+
+	// Budget caps the estimated LLM spend of the server's documents
+	Budget *processor.BudgetController
 }
 
 // Server represents the HTTP API server
@@ -34,6 +84,12 @@ type Server struct {
 	pipeline         *processor.Pipeline
 	verifierRegistry *signature.VerifierRegistry
 	pdfVerifier      *pdf.PDFVerifier
+	metrics          *metrics.Registry
+	store            store.Store
+
+	mu      sync.Mutex
+	httpSrv *http.Server
+	grpcSrv *http.Server
 }
 
 // NewServer creates a new API server
@@ -47,15 +103,40 @@ func NewServer(config *Config) *Server {
 	if config.Debug {
 		router.Use(gin.Logger())
 	}
+	router.Use(correlationID)
+
+	var registry *metrics.Registry
+	var pipelineMetrics *processor.Metrics
+	if config.Metrics {
+		registry = metrics.NewRegistry()
+		pipelineMetrics = processor.NewMetrics(registry)
+	}
 
 	// Create LLM extractor if API key provided
 	var llmExtractor *llm.Extractor
-	if config.APIKey != "" {
+	if config.APIKey != "" || (config.LLMProvider != "" && !llm.RequiresAPIKey(config.LLMProvider)) {
 		// Build client options
 		var clientOpts []llm.ClientOption
 		if config.LLMBaseURL != "" {
 			clientOpts = append(clientOpts, llm.WithBaseURL(config.LLMBaseURL))
 		}
+		if config.LLMProvider != "" {
+			// An unknown provider leaves the OpenAI-compatible default in place
+			if provider, err := llm.NewProvider(llm.ProviderConfig{
+				Name:    config.LLMProvider,
+				APIKey:  config.APIKey,
+				BaseURL: config.LLMBaseURL,
+			}); err == nil {
+				clientOpts = append(clientOpts, llm.WithProvider(provider))
+			}
+		}
+
+		if pipelineMetrics != nil {
+			clientOpts = append(clientOpts, llm.WithTelemetry(pipelineMetrics))
+		}
+		if config.Logger != nil {
+			clientOpts = append(clientOpts, llm.WithLogger(config.Logger))
+		}
 
 		client := llm.NewClient(config.APIKey, clientOpts...)
 
@@ -68,13 +149,37 @@ func NewServer(config *Config) *Server {
 			extractorOpts = append(extractorOpts, llm.WithVisionModel(config.LLMVisionModel))
 		}
 
+		if config.Logger != nil {
+			extractorOpts = append(extractorOpts, llm.WithExtractorLogger(config.Logger))
+		}
+
 		llmExtractor = llm.NewExtractor(client, extractorOpts...)
 	}
 
 	// Create pipeline
-	pipeline := processor.NewPipeline(
-		processor.WithLLMExtractor(llmExtractor),
-	)
+	pipelineOpts := []processor.PipelineOption{processor.WithLLMExtractor(llmExtractor)}
+	if pipelineMetrics != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithMetrics(pipelineMetrics))
+	}
+	if config.Logger != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithLogger(config.Logger))
+	}
+	if config.Webhook != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithHooks(config.Webhook.Hooks()))
+	}
+	if config.Events != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithHooks(outbox.New(config.Events).Hooks()))
+	}
+	if config.Idempotency != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithIdempotency(config.Idempotency))
+	}
+	if config.Tenants != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithTenants(config.Tenants))
+	}
+	if config.Budget != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithBudget(config.Budget))
+	}
+	pipeline := processor.NewPipeline(pipelineOpts...)
 
 	// Create signature verifiers
 	trustStore, _ := trust.NewTrustStore()
@@ -90,6 +195,11 @@ func NewServer(config *Config) *Server {
 		pipeline:         pipeline,
 		verifierRegistry: verifierRegistry,
 		pdfVerifier:      pdfVerifier,
+		metrics:          registry,
+		store:            config.Store,
+	}
+	if config.ReviewThreshold == 0 {
+		config.ReviewThreshold = DefaultReviewThreshold
 	}
 
 	s.setupRoutes()
@@ -99,14 +209,18 @@ func NewServer(config *Config) *Server {
 func (s *Server) setupRoutes() {
 	// Health check
 	s.router.GET("/health", s.handleHealth)
+	if s.metrics != nil {
+		s.router.GET("/metrics", gin.WrapH(s.metrics))
+	}
 
 	// API v1
-	v1 := s.router.Group("/api/v1")
+	v1 := s.router.Group("/api/v1", s.tenant)
 	{
 		// Process endpoints
 		v1.POST("/process/xml", s.handleProcessXML)
 		v1.POST("/process/pdf", s.handleProcessPDF)
 		v1.POST("/process/image", s.handleProcessImage)
+		v1.POST("/process/receipt", s.handleProcessReceipt)
 		v1.POST("/process/auto", s.handleProcessAuto)
 
 		// Validate endpoint
@@ -117,10 +231,51 @@ func (s *Server) setupRoutes() {
 
 		// Info endpoint
 		v1.POST("/info", s.handleInfo)
+
+		// Review queue
+		if s.store != nil {
+			v1.GET("/reviews", s.handleListReviews)
+			v1.GET("/reviews/:id", s.tenantRecord, s.handleGetReview)
+			v1.GET("/reviews/:id/artifact", s.tenantRecord, s.handleGetArtifact)
+			v1.POST("/reviews/:id/claim", s.tenantRecord, s.handleClaimReview)
+			v1.POST("/reviews/:id/correct", s.tenantRecord, s.handleCorrectReview)
+			v1.POST("/reviews/:id/approve", s.tenantRecord, s.handleApproveReview)
+
+			// Failed documents, and running them again
+			v1.GET("/quarantine", s.handleListQuarantine)
+			v1.POST("/quarantine/:id/replay", s.tenantRecord, s.handleReplay)
+
+			// Records by workflow status, and moving them along it
+			v1.GET("/records", s.handleListRecords)
+			v1.GET("/records/:id", s.tenantRecord, s.handleGetReview)
+			v1.POST("/records/:id/status", s.tenantRecord, s.handleSetStatus)
+		}
+
+		// Event stream of processed invoices
+		if s.config.Events != nil {
+			v1.GET("/events", s.handleListEvents)
+		}
 	}
 }
 
-// Run starts the HTTP server
+// once processes a request's document, or answers with the result of an
+// earlier request for it (see Config.Idempotency)
+func (s *Server) once(ctx context.Context, c *gin.Context, body []byte, process func(context.Context) *processor.Result) *processor.Result {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		key = c.FullPath() + " " + processor.IdempotencyKey(body, processor.ProcessOptions{})
+	}
+	results := s.pipeline.Idempotent(ctx, key, func(ctx context.Context) []*processor.Result {
+		return []*processor.Result{process(ctx)}
+	})
+	if results[0].IdempotentReplay {
+		c.Header("Idempotent-Replayed", "true")
+	}
+	return results[0]
+}
+
+// Run starts the HTTP server, and the gRPC one with Config.GRPCAddress, and
+// blocks until one fails or Stop is called
 func (s *Server) Run() error {
 	srv := &http.Server{
 		Addr:         s.config.Address,
@@ -128,7 +283,71 @@ func (s *Server) Run() error {
 		ReadTimeout:  s.config.ReadTimeout,
 		WriteTimeout: s.config.WriteTimeout,
 	}
-	return srv.ListenAndServe()
+	var grpcSrv *http.Server
+	if s.config.GRPCAddress != "" {
+		// No timeouts: ProcessBatch streams for as long as the batch runs
+		grpcSrv = &http.Server{Addr: s.config.GRPCAddress, Handler: s.GRPCHandler(), Protocols: new(http.Protocols)}
+		grpcSrv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	s.mu.Lock()
+	s.httpSrv = srv
+	s.grpcSrv = grpcSrv
+	s.mu.Unlock()
+
+	serve := func(srv *http.Server) error {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+	if grpcSrv == nil {
+		return serve(srv)
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- serve(srv) }()
+	go func() { errs <- serve(grpcSrv) }()
+	if err := <-errs; err != nil {
+		srv.Close()
+		grpcSrv.Close()
+		<-errs
+		return err
+	}
+	return <-errs
+}
+
+// Stop stops accepting connections and waits for the requests in flight and
+// their documents to finish. When ctx is done first, the documents are
+// canceled and answered with 503 Service Unavailable, and the connections
+// closed.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv, grpcSrv := s.httpSrv, s.grpcSrv
+	s.mu.Unlock()
+	if srv == nil {
+		return s.pipeline.Stop(ctx)
+	}
+
+	var grpcErr error
+	var wg sync.WaitGroup
+	if grpcSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			grpcErr = grpcSrv.Shutdown(ctx)
+		}()
+	}
+	err := srv.Shutdown(ctx)
+	wg.Wait()
+	if err = errors.Join(err, grpcErr); err != nil {
+		// Cancel the documents so their handlers answer before closing
+		s.pipeline.Stop(ctx)
+		srv.Close()
+		if grpcSrv != nil {
+			grpcSrv.Close()
+		}
+		return fmt.Errorf("failed to drain requests: %w", err)
+	}
+	return s.pipeline.Stop(ctx)
 }
 
 // Handler returns the http.Handler for use with custom servers
@@ -136,6 +355,42 @@ func (s *Server) Handler() http.Handler {
 	return s.router
 }
 
+// errorStatus returns the status of a failed document: 503 Service
+// Unavailable when the server is shutting down, so the client retries
+// elsewhere, or 422 Unprocessable Entity
+func errorStatus(err error) int {
+	if errors.Is(err, processor.ErrStopped) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// correlationID tags the documents of a request with its X-Request-ID, or a
+// generated ID, and echoes it in the response
+func correlationID(c *gin.Context) {
+	ctx := c.Request.Context()
+	if id := c.GetHeader("X-Request-ID"); id != "" {
+		ctx = logging.ContextWithCorrelationID(ctx, id)
+	}
+	ctx = logging.EnsureCorrelationID(ctx)
+	c.Request = c.Request.WithContext(ctx)
+	c.Header("X-Request-ID", logging.CorrelationID(ctx))
+	c.Next()
+}
+
+// tenant processes a request for the tenant of its X-Tenant-ID header
+func (s *Server) tenant(c *gin.Context) {
+	id := c.GetHeader("X-Tenant-ID")
+	if !s.pipeline.HasTenant(id) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unknown tenant %q", id)})
+		return
+	}
+	if id != "" {
+		c.Request = c.Request.WithContext(processor.ContextWithTenant(c.Request.Context(), id))
+	}
+	c.Next()
+}
+
 func (s *Server) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
@@ -158,16 +413,21 @@ func (s *Server) handleProcessXML(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 
-	result := s.pipeline.ProcessXMLBytes(ctx, body)
+	result := s.once(ctx, c, body, func(ctx context.Context) *processor.Result {
+		return s.pipeline.ProcessXMLBytes(ctx, body)
+	})
+	id := s.saveForReview(ctx, c.GetHeader("X-Document-ID"), result, body)
 	if result.Error != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"error":    result.Error.Error(),
-			"warnings": result.Warnings,
+		c.JSON(errorStatus(result.Error), ErrorResponse{
+			ID:       id,
+			Error:    result.Error.Error(),
+			Warnings: result.Warnings,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, ProcessResponse{
+		ID:         id,
 		Invoice:    result.Invoice,
 		Method:     string(result.Method),
 		Confidence: result.Confidence,
@@ -194,16 +454,21 @@ func (s *Server) handleProcessPDF(c *gin.Context) {
 	var imageData []byte
 	var mimeType string
 
-	result := s.pipeline.ProcessPDF(ctx, nil, imageData, mimeType)
+	result := s.once(ctx, c, body, func(ctx context.Context) *processor.Result {
+		return s.pipeline.ProcessPDF(ctx, nil, imageData, mimeType)
+	})
+	id := s.saveForReview(ctx, c.GetHeader("X-Document-ID"), result, body)
 	if result.Error != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"error":    result.Error.Error(),
-			"warnings": result.Warnings,
+		c.JSON(errorStatus(result.Error), ErrorResponse{
+			ID:       id,
+			Error:    result.Error.Error(),
+			Warnings: result.Warnings,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, ProcessResponse{
+		ID:         id,
 		Invoice:    result.Invoice,
 		Method:     string(result.Method),
 		Confidence: result.Confidence,
@@ -232,16 +497,63 @@ func (s *Server) handleProcessImage(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
 	defer cancel()
 
-	result := s.pipeline.ProcessImage(ctx, body, contentType)
+	result := s.once(ctx, c, body, func(ctx context.Context) *processor.Result {
+		return s.pipeline.ProcessImage(ctx, body, contentType)
+	})
+	id := s.saveForReview(ctx, c.GetHeader("X-Document-ID"), result, body)
 	if result.Error != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"error":    result.Error.Error(),
-			"warnings": result.Warnings,
+		c.JSON(errorStatus(result.Error), ErrorResponse{
+			ID:       id,
+			Error:    result.Error.Error(),
+			Warnings: result.Warnings,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ProcessResponse{
+		ID:         id,
+		Invoice:    result.Invoice,
+		Method:     string(result.Method),
+		Confidence: result.Confidence,
+		Warnings:   result.Warnings,
+	})
+}
+
+func (s *Server) handleProcessReceipt(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+
+	if len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty request body"})
+		return
+	}
+
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = detectMimeType(body)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+
+	result := s.once(ctx, c, body, func(ctx context.Context) *processor.Result {
+		return s.pipeline.ProcessReceipt(ctx, body, contentType)
+	})
+	id := s.saveForReview(ctx, c.GetHeader("X-Document-ID"), result, body)
+	if result.Error != nil {
+		c.JSON(errorStatus(result.Error), ErrorResponse{
+			ID:       id,
+			Error:    result.Error.Error(),
+			Warnings: result.Warnings,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, ProcessResponse{
+		ID:         id,
 		Invoice:    result.Invoice,
 		Method:     string(result.Method),
 		Confidence: result.Confidence,
@@ -268,36 +580,48 @@ func (s *Server) handleProcessAuto(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
 	defer cancel()
 
-	var result *processor.Result
+	var process func(ctx context.Context) *processor.Result
 
 	switch format {
 	case processor.FormatXML:
-		result = s.pipeline.ProcessXMLBytes(ctx, body)
+		process = func(ctx context.Context) *processor.Result { return s.pipeline.ProcessXMLBytes(ctx, body) }
 
 	case processor.FormatPDF:
-		result = s.pipeline.ProcessPDF(ctx, nil, body, "application/pdf")
+		process = func(ctx context.Context) *processor.Result {
+			return s.pipeline.ProcessPDF(ctx, nil, body, "application/pdf")
+		}
 
 	case processor.FormatImage:
 		mimeType := contentType
 		if mimeType == "" || mimeType == "application/octet-stream" {
 			mimeType = detectMimeType(body)
 		}
-		result = s.pipeline.ProcessImage(ctx, body, mimeType)
+		process = func(ctx context.Context) *processor.Result { return s.pipeline.ProcessImage(ctx, body, mimeType) }
+
+	case processor.FormatHTML:
+		process = func(ctx context.Context) *processor.Result { return s.pipeline.ProcessHTML(ctx, body) }
+
+	case processor.FormatSpreadsheet:
+		process = func(ctx context.Context) *processor.Result { return s.pipeline.ProcessSpreadsheet(ctx, body) }
 
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported file format"})
 		return
 	}
+	result := s.once(ctx, c, body, process)
+	id := s.saveForReview(ctx, c.GetHeader("X-Document-ID"), result, body)
 
 	if result.Error != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"error":    result.Error.Error(),
-			"warnings": result.Warnings,
+		c.JSON(errorStatus(result.Error), ErrorResponse{
+			ID:       id,
+			Error:    result.Error.Error(),
+			Warnings: result.Warnings,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, ProcessResponse{
+		ID:         id,
 		Invoice:    result.Invoice,
 		Method:     string(result.Method),
 		Confidence: result.Confidence,
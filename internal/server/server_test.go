@@ -2,7 +2,9 @@ package server_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +12,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
 	"github.com/rezonia/invoice-processor/internal/server"
 )
 
@@ -39,6 +43,38 @@ func TestHealthEndpoint(t *testing.T) {
 	assert.NotEmpty(t, response["time"])
 }
 
+func TestMetricsEndpoint(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer().Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "metrics are off by default")
+
+	srv := server.NewServer(&server.Config{Address: ":8080", Metrics: true})
+	body := `<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/process/xml", bytes.NewBufferString(body)))
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `invoice_documents_total{method="xml",status="success"} 1`)
+}
+
+func TestRequestIDLogged(t *testing.T) {
+	var buf bytes.Buffer
+	srv := server.NewServer(&server.Config{Address: ":8080", Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/process/xml", bytes.NewBufferString("<Unknown/>"))
+	req.Header.Set("X-Request-ID", "req-9")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, "req-9", w.Header().Get("X-Request-ID"))
+	assert.Contains(t, buf.String(), `msg="document failed" correlation_id=req-9`)
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Len(t, w.Header().Get("X-Request-ID"), 16, "an ID is generated without the header")
+}
+
 func TestProcessXMLEndpoint(t *testing.T) {
 	srv := newTestServer()
 
@@ -46,7 +82,8 @@ func TestProcessXMLEndpoint(t *testing.T) {
 <Invoice>
 	<InvoiceNo>0000001</InvoiceNo>
 	<InvoiceSeries>KK23</InvoiceSeries>
-	<Seller><TaxID>0123456789</TaxID><Name>Test Company</Name></Seller>
+	<InvoiceDate>2024-01-15</InvoiceDate>
+	<Seller><TaxID>0123456787</TaxID><Name>Test Company</Name></Seller>
 	<TotalAmount>1000000</TotalAmount>
 </Invoice>`
 
@@ -91,6 +128,19 @@ func TestProcessXMLEndpoint_InvalidXML(t *testing.T) {
 	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 }
 
+func TestStop(t *testing.T) {
+	srv := newTestServer()
+	require.NoError(t, srv.Stop(context.Background()))
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>0000001</InvoiceNo></Invoice>`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/process/xml", bytes.NewReader([]byte(xmlData)))
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "stopped servers turn documents away")
+	assert.Contains(t, w.Body.String(), processor.ErrStopped.Error())
+}
+
 func TestValidateEndpoint(t *testing.T) {
 	srv := newTestServer()
 
@@ -176,6 +226,17 @@ func TestProcessImageEndpoint_NoLLM(t *testing.T) {
 	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 }
 
+func TestProcessReceiptEndpoint_NoLLM(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/process/receipt", bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0, 0, 0}))
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
 // Benchmark tests
 
 func BenchmarkProcessXML(b *testing.B) {
@@ -207,3 +268,74 @@ func BenchmarkHealth(b *testing.B) {
 		srv.Handler().ServeHTTP(w, req)
 	}
 }
+
+func TestIdempotency(t *testing.T) {
+	srv := server.NewServer(&server.Config{Address: ":8080", Idempotency: processor.NewMemoryIdempotencyStore()})
+	body := `<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/v1/process/xml", "", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	w = post("/api/v1/process/xml", "", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	var resp server.ProcessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "0000042", resp.Invoice.Number)
+
+	w = post("/api/v1/process/auto", "", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"), "keys are per endpoint")
+
+	post("/api/v1/process/xml", "upload-1", body)
+	w = post("/api/v1/process/xml", "upload-1", "<Unknown/>")
+	assert.Equal(t, http.StatusOK, w.Code, "answered from the first request")
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	events := outbox.NewMemoryStore()
+	srv := server.NewServer(&server.Config{
+		Address: ":8080",
+		Events:  events,
+		Tenants: map[string]processor.Tenant{"acme": {}},
+	})
+	do := func(method, path, tenant, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	body := `<?xml version="1.0"?><Invoice><InvoiceNo>0000042</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller></Invoice>`
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/v1/process/xml", "", body).Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/v1/process/xml", "acme", body).Code)
+
+	w := do(http.MethodGet, "/api/v1/events?after=1", "acme", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp server.EventListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Events, 2, "only the tenant's events")
+	assert.Equal(t, outbox.EventExtracted, resp.Events[0].Type)
+	assert.Equal(t, "acme", resp.Events[0].Tenant)
+	assert.Equal(t, int64(4), resp.Next)
+
+	w = do(http.MethodGet, "/api/v1/events?after=4", "acme", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Events)
+	assert.Equal(t, int64(4), resp.Next)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/v1/events?after=x", "", "").Code)
+}
@@ -8,6 +8,7 @@ import (
 
 // ProcessResponse is the response for process endpoints
 type ProcessResponse struct {
+	ID         string         `json:"id,omitempty"` // Review record, when the result needs review
 	Invoice    *model.Invoice `json:"invoice"`
 	Method     string         `json:"method"`
 	Confidence float64        `json:"confidence"`
@@ -30,6 +31,7 @@ type InfoResponse struct {
 
 // ErrorResponse is the standard error response
 type ErrorResponse struct {
+	ID       string   `json:"id,omitempty"` // Review record of a failed document
 	Error    string   `json:"error"`
 	Details  string   `json:"details,omitempty"`
 	Warnings []string `json:"warnings,omitempty"`
@@ -0,0 +1,357 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SFTP version 3 packet types (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit      = 1
+	fxpVersion   = 2
+	fxpOpen      = 3
+	fxpClose     = 4
+	fxpRead      = 5
+	fxpOpendir   = 11
+	fxpReaddir   = 12
+	fxpMkdir     = 14
+	fxpStat      = 17
+	fxpRename    = 18
+	fxpStatus    = 101
+	fxpHandle    = 102
+	fxpData      = 103
+	fxpName      = 104
+	fxpAttrs     = 105
+	fxfRead      = 0x1
+	fxOK         = 0
+	fxEOF        = 1
+	fxNoSuchFile = 2
+
+	attrSize        = 0x1
+	attrUIDGID      = 0x2
+	attrPermissions = 0x4
+	attrACModTime   = 0x8
+	attrExtended    = 0x80000000
+)
+
+const (
+	// maxPacket bounds a packet read from the server
+	maxPacket = 1 << 20
+	// readChunk is the size of each read request
+	readChunk = 32 << 10
+)
+
+// fileInfo is a directory entry or the attributes of a path
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	isDir   bool
+	regular bool
+}
+
+// statusError is an SSH_FXP_STATUS reply other than OK
+type statusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	if e.msg != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", e.msg, e.code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.code)
+}
+
+// notExist reports whether err is the server saying a path does not exist
+func notExist(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.code == fxNoSuchFile
+}
+
+// sftpConn is a minimal SFTP version 3 client: enough to list a directory,
+// read files, create directories and rename files. Requests are sent one
+// at a time.
+type sftpConn struct {
+	r  io.Reader
+	w  io.WriteCloser
+	id uint32
+}
+
+// newSFTPConn negotiates version 3 over the streams of an sftp subsystem
+func newSFTPConn(r io.Reader, w io.WriteCloser) (*sftpConn, error) {
+	c := &sftpConn{r: r, w: w}
+	if err := c.send(fxpInit, uint32Bytes(3)); err != nil {
+		return nil, err
+	}
+	typ, payload, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpVersion || len(payload) < 4 {
+		return nil, fmt.Errorf("sftp: unexpected reply %d to init", typ)
+	}
+	if v := binary.BigEndian.Uint32(payload); v < 3 {
+		return nil, fmt.Errorf("sftp: server speaks version %d, need 3", v)
+	}
+	return c, nil
+}
+
+func (c *sftpConn) Close() error {
+	return c.w.Close()
+}
+
+func (c *sftpConn) send(typ byte, payload []byte) error {
+	pkt := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(pkt, uint32(1+len(payload)))
+	pkt[4] = typ
+	if _, err := c.w.Write(append(pkt, payload...)); err != nil {
+		return fmt.Errorf("sftp: failed to send request: %w", err)
+	}
+	return nil
+}
+
+func (c *sftpConn) recv() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: failed to read reply: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > maxPacket {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("sftp: failed to read reply: %w", err)
+	}
+	return header[4], payload, nil
+}
+
+// request sends a request and returns the reply of the same ID. A STATUS
+// reply other than OK is returned as a *statusError.
+func (c *sftpConn) request(typ byte, fields ...[]byte) (byte, *reader, error) {
+	c.id++
+	payload := uint32Bytes(c.id)
+	for _, f := range fields {
+		payload = append(payload, f...)
+	}
+	if err := c.send(typ, payload); err != nil {
+		return 0, nil, err
+	}
+	reply, body, err := c.recv()
+	if err != nil {
+		return 0, nil, err
+	}
+	r := &reader{buf: body}
+	if id := r.uint32(); id != c.id || r.err != nil {
+		return 0, nil, fmt.Errorf("sftp: reply to request %d, expected %d", id, c.id)
+	}
+	if reply == fxpStatus {
+		status := &statusError{code: r.uint32(), msg: r.string()}
+		if status.code != fxOK {
+			return 0, nil, status
+		}
+	}
+	return reply, r, nil
+}
+
+// handle sends a request answered with a handle
+func (c *sftpConn) handle(typ byte, fields ...[]byte) ([]byte, error) {
+	reply, r, err := c.request(typ, fields...)
+	if err != nil {
+		return nil, err
+	}
+	if reply != fxpHandle {
+		return nil, fmt.Errorf("sftp: unexpected reply %d, expected a handle", reply)
+	}
+	h := r.bytes()
+	return h, r.err
+}
+
+func (c *sftpConn) closeHandle(h []byte) error {
+	_, _, err := c.request(fxpClose, stringBytes(string(h)))
+	return err
+}
+
+// readDir lists a directory, without "." and ".."
+func (c *sftpConn) readDir(dir string) ([]fileInfo, error) {
+	h, err := c.handle(fxpOpendir, stringBytes(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	defer c.closeHandle(h)
+
+	var entries []fileInfo
+	for {
+		reply, r, err := c.request(fxpReaddir, stringBytes(string(h)))
+		var status *statusError
+		if errors.As(err, &status) && status.code == fxEOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		if reply != fxpName {
+			return nil, fmt.Errorf("sftp: unexpected reply %d to readdir", reply)
+		}
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			name := r.string()
+			r.string() // Long name, as ls -l prints it
+			info := r.attrs()
+			info.name = name
+			if name != "." && name != ".." {
+				entries = append(entries, info)
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+}
+
+// readFile reads a whole file, failing when it is larger than limit bytes
+func (c *sftpConn) readFile(path string, limit int64) ([]byte, error) {
+	h, err := c.handle(fxpOpen, stringBytes(path), uint32Bytes(fxfRead), uint32Bytes(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer c.closeHandle(h)
+
+	var data []byte
+	for {
+		reply, r, err := c.request(fxpRead, stringBytes(string(h)), uint64Bytes(uint64(len(data))), uint32Bytes(readChunk))
+		var status *statusError
+		if errors.As(err, &status) && status.code == fxEOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if reply != fxpData {
+			return nil, fmt.Errorf("sftp: unexpected reply %d to read", reply)
+		}
+		chunk := r.bytes()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(chunk) == 0 {
+			return data, nil
+		}
+		data = append(data, chunk...)
+		if int64(len(data)) > limit {
+			return nil, fmt.Errorf("%s is larger than %d bytes", path, limit)
+		}
+	}
+}
+
+// stat returns the attributes of path, following links
+func (c *sftpConn) stat(path string) (fileInfo, error) {
+	reply, r, err := c.request(fxpStat, stringBytes(path))
+	if err != nil {
+		return fileInfo{}, err
+	}
+	if reply != fxpAttrs {
+		return fileInfo{}, fmt.Errorf("sftp: unexpected reply %d to stat", reply)
+	}
+	info := r.attrs()
+	return info, r.err
+}
+
+func (c *sftpConn) mkdir(path string) error {
+	_, _, err := c.request(fxpMkdir, stringBytes(path), uint32Bytes(0))
+	return err
+}
+
+// rename moves a file; version 3 servers refuse to replace an existing one
+func (c *sftpConn) rename(from, to string) error {
+	_, _, err := c.request(fxpRename, stringBytes(from), stringBytes(to))
+	return err
+}
+
+// reader decodes the fields of a packet, recording the first error
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errors.New("sftp: truncated packet")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+// attrs decodes an ATTRS structure
+func (r *reader) attrs() fileInfo {
+	var info fileInfo
+	flags := r.uint32()
+	if flags&attrSize != 0 {
+		info.size = int64(r.uint64())
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		perm := r.uint32()
+		info.mode = os.FileMode(perm & 0o777)
+		info.isDir = perm&0o170000 == 0o040000
+		info.regular = perm&0o170000 == 0o100000
+	}
+	if flags&attrACModTime != 0 {
+		r.uint32() // Access time
+		info.modTime = time.Unix(int64(r.uint32()), 0)
+	}
+	if flags&attrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	return info
+}
+
+func uint32Bytes(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func uint64Bytes(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func stringBytes(s string) []byte {
+	return append(uint32Bytes(uint32(len(s))), s...)
+}
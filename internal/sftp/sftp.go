@@ -0,0 +1,411 @@
+// Package sftp ingests invoices that suppliers drop on SFTP servers
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Defaults for Config
+const (
+	DefaultPollInterval = 5 * time.Minute
+	DefaultMinAge       = time.Minute
+	DefaultMaxFiles     = 100
+	DefaultMaxFileSize  = 64 << 20
+)
+
+// Config configures a Connector
+type Config struct {
+	Addr     string // Server host:port
+	Username string
+
+	// Password and/or PrivateKey (PEM, as written by ssh-keygen) authenticate
+	// the user; KeyPassphrase decrypts an encrypted key
+	Password      string
+	PrivateKey    []byte
+	KeyPassphrase string
+
+	// The server's host key is checked against KnownHostsFile, in OpenSSH
+	// known_hosts format, or HostKey, a public key in authorized_keys format.
+	// One of them is required unless InsecureIgnoreHostKey is set, for tests.
+	KnownHostsFile        string
+	HostKey               string
+	InsecureIgnoreHostKey bool
+
+	// Dir is the remote directory polled for invoices (not recursive; default:
+	// the login directory). Patterns are path.Match globs files must match,
+	// such as "*.pdf"; none matches every file.
+	Dir      string
+	Patterns []string
+
+	// ProcessedDir receives the files processed without failures and is
+	// required; FailedDir receives those with a failed document (default:
+	// ProcessedDir). Both are created if missing and may be inside Dir.
+	ProcessedDir string
+	FailedDir    string
+
+	// MinAge is how long a file must have gone unmodified before it is
+	// fetched, so uploads in progress are left alone (default: DefaultMinAge)
+	MinAge time.Duration
+
+	PollInterval   time.Duration // Time between polls (default: DefaultPollInterval)
+	MaxFiles       int           // Files processed per poll (default: DefaultMaxFiles)
+	MaxFileSize    int64         // Larger files are failed unread (default: DefaultMaxFileSize)
+	Timeout        time.Duration // Per-file processing timeout (0 = none)
+	SplitDocuments bool          // See processor.ProcessOptions.SplitDocuments
+}
+
+// File describes a processed remote file
+type File struct {
+	Name    string
+	Path    string // Where the file was found
+	Size    int64
+	ModTime time.Time
+	Failed  bool // A document failed; the file goes to FailedDir
+}
+
+// Handler receives the results of one file. When it returns an error the
+// file is left in place and processed again on the next poll.
+type Handler func(ctx context.Context, file File, results []*processor.Result) error
+
+// Connector polls a directory of an SFTP server and runs each file found
+// there through the pipeline, like the directory watcher does for local
+// files. Once the handler accepts a file's results the file is moved to the
+// processed or failed directory, so it is fetched only once.
+type Connector struct {
+	pipeline *processor.Pipeline
+	cfg      Config
+	handle   Handler
+	ssh      *ssh.ClientConfig
+}
+
+// NewConnector returns a connector passing results to handle
+func NewConnector(pipeline *processor.Pipeline, cfg Config, handle Handler) (*Connector, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("SFTP server address is required")
+	}
+	if cfg.Username == "" {
+		return nil, errors.New("SFTP username is required")
+	}
+	if cfg.ProcessedDir == "" {
+		return nil, errors.New("processed directory is required")
+	}
+	if handle == nil {
+		return nil, errors.New("handler is required")
+	}
+	for _, pattern := range cfg.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if cfg.FailedDir == "" {
+		cfg.FailedDir = cfg.ProcessedDir
+	}
+	if cfg.MinAge <= 0 {
+		cfg.MinAge = DefaultMinAge
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultMaxFiles
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultMaxFileSize
+	}
+
+	sshConfig, err := clientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{pipeline: pipeline, cfg: cfg, handle: handle, ssh: sshConfig}, nil
+}
+
+// clientConfig returns the SSH settings of cfg
+func clientConfig(cfg Config) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if len(cfg.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+		if cfg.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(cfg.PrivateKey, []byte(cfg.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(cfg.PrivateKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("SFTP password or private key is required")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case cfg.KnownHostsFile != "":
+		callback, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known hosts: %w", err)
+		}
+		hostKey = callback
+	case cfg.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH host key: %w", err)
+		}
+		hostKey = ssh.FixedHostKey(key)
+	case cfg.InsecureIgnoreHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("SFTP known hosts file or host key is required")
+	}
+
+	return &ssh.ClientConfig{User: cfg.Username, Auth: auth, HostKeyCallback: hostKey, Timeout: 30 * time.Second}, nil
+}
+
+// Run polls until ctx is canceled, then returns nil. A failed poll, such as
+// a dropped connection, is reported to onError and retried on the next
+// interval.
+func (c *Connector) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Poll(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll connects once, processes up to MaxFiles files, oldest first, and
+// returns how many were handled. Once ctx is canceled the file in flight is
+// finished and the others are left for the next run, as is a file the
+// pipeline is stopped before finishing (see processor.Pipeline.Stop).
+func (c *Connector) Poll(ctx context.Context) (int, error) {
+	client, err := ssh.Dial("tcp", c.cfg.Addr, c.ssh)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to %s: %w", c.cfg.Addr, err)
+	}
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	conn, err := openSFTP(client)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	for _, dir := range []string{c.cfg.ProcessedDir, c.cfg.FailedDir} {
+		if err := ensureDir(conn, dir); err != nil {
+			return 0, err
+		}
+	}
+	files, err := c.list(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	work := context.WithoutCancel(ctx) // Finish the file in flight
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		var results []*processor.Result
+		if file.Size > c.cfg.MaxFileSize {
+			results = []*processor.Result{{Error: fmt.Errorf("file is larger than %d bytes", c.cfg.MaxFileSize)}}
+		} else {
+			data, err := conn.readFile(file.Path, c.cfg.MaxFileSize)
+			if err != nil {
+				return handled, err
+			}
+			results = c.process(work, file, data)
+		}
+		if stopped(results) {
+			break // Interrupted: leave the file for the next run
+		}
+		file.Failed = failed(results)
+		if err := c.handle(work, file, results); err != nil {
+			continue
+		}
+		dir := c.cfg.ProcessedDir
+		if file.Failed {
+			dir = c.cfg.FailedDir
+		}
+		if _, err := moveFile(conn, file.Path, dir); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// openSFTP starts the sftp subsystem on a new session of client
+func openSFTP(client *ssh.Client) (*sftpConn, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	return newSFTPConn(r, w)
+}
+
+// list returns the files to process: regular files matching the patterns
+// and unmodified for MinAge, oldest first
+func (c *Connector) list(conn *sftpConn) ([]File, error) {
+	entries, err := conn.readDir(c.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-c.cfg.MinAge)
+	var files []File
+	for _, e := range entries {
+		if !e.regular || ignored(e.name) || !c.matches(e.name) || e.modTime.After(cutoff) {
+			continue
+		}
+		files = append(files, File{Name: e.name, Path: path.Join(c.cfg.Dir, e.name), Size: e.size, ModTime: e.modTime})
+	}
+	slices.SortFunc(files, func(a, b File) int {
+		if n := a.ModTime.Compare(b.ModTime); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(files) > c.cfg.MaxFiles {
+		files = files[:c.cfg.MaxFiles]
+	}
+	return files, nil
+}
+
+// matches reports whether name matches one of the patterns
+func (c *Connector) matches(name string) bool {
+	if len(c.cfg.Patterns) == 0 {
+		return true
+	}
+	for _, pattern := range c.cfg.Patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// process runs one file through the pipeline
+func (c *Connector) process(ctx context.Context, file File, data []byte) []*processor.Result {
+	ctx = llm.ContextWithDocumentID(ctx, "sftp://"+c.cfg.Addr+"/"+strings.TrimPrefix(file.Path, "/"))
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	return c.pipeline.Process(ctx, data, processor.ProcessOptions{Filename: file.Name, SplitDocuments: c.cfg.SplitDocuments})
+}
+
+// stopped reports whether the pipeline was stopped before finishing results
+func stopped(results []*processor.Result) bool {
+	for _, r := range results {
+		if errors.Is(r.Error, processor.ErrStopped) {
+			return true
+		}
+	}
+	return false
+}
+
+// failed reports whether a document failed; documents that are not
+// invoices do not count
+func failed(results []*processor.Result) bool {
+	for _, r := range results {
+		if r.Error != nil && !errors.Is(r.Error, processor.ErrSkipped) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureDir creates dir unless it exists
+func ensureDir(conn *sftpConn, dir string) error {
+	info, err := conn.stat(dir)
+	if err == nil {
+		if !info.isDir {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if !notExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	if err := conn.mkdir(dir); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return nil
+}
+
+// moveFile moves the remote file at p into dir without overwriting, adding
+// a numeric suffix to the name if taken, and returns the new path
+func moveFile(conn *sftpConn, p, dir string) (string, error) {
+	base := path.Base(p)
+	ext := path.Ext(base)
+	target := path.Join(dir, base)
+	for i := 1; ; i++ {
+		_, err := conn.stat(target)
+		if notExist(err) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", target, err)
+		}
+		target = path.Join(dir, strings.TrimSuffix(base, ext)+"-"+strconv.Itoa(i)+ext)
+	}
+	if err := conn.rename(p, target); err != nil {
+		return "", fmt.Errorf("failed to move %s: %w", p, err)
+	}
+	return target, nil
+}
+
+// ignored reports whether a file name is skipped: hidden files and partial
+// uploads
+func ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return true
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tmp", ".part", ".partial", ".filepart":
+		return true
+	}
+	return false
+}
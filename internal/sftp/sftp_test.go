@@ -0,0 +1,360 @@
+package sftp_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/sftp"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+// fakeSFTP is an SSH server whose sftp subsystem serves a local directory
+type fakeSFTP struct {
+	root    string
+	hostKey string // authorized_keys line
+}
+
+func newFakeSFTP(t *testing.T, root string) (*fakeSFTP, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "supplier" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+	srv := &fakeSFTP{root: root, hostKey: string(ssh.MarshalAuthorizedKey(signer.PublicKey()))}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func (s *fakeSFTP) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "sessions only")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go s.serveSFTP(ch)
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP answers the requests the connector sends, one at a time
+func (s *fakeSFTP) serveSFTP(ch ssh.Channel) {
+	defer ch.Close()
+	handles := make(map[string]string)
+	listed := make(map[string]bool)
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(ch, header[:]); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+		if _, err := io.ReadFull(ch, payload); err != nil {
+			return
+		}
+		if header[4] == 1 { // INIT
+			writePacket(ch, 2, u32(3))
+			continue
+		}
+		id, fields := payload[:4], payload[4:]
+		name := func() string {
+			n := binary.BigEndian.Uint32(fields)
+			v := string(fields[4 : 4+n])
+			fields = fields[4+n:]
+			return v
+		}
+		status := func(code uint32) { writePacket(ch, 101, id, u32(code), str(""), str("")) }
+
+		switch header[4] {
+		case 3, 11: // OPEN, OPENDIR
+			p := name()
+			handle := string(rune('a' + len(handles)))
+			handles[handle] = p
+			writePacket(ch, 102, id, str(handle))
+		case 4: // CLOSE
+			status(0)
+		case 5: // READ
+			data, err := os.ReadFile(s.path(handles[name()]))
+			offset := binary.BigEndian.Uint64(fields)
+			switch {
+			case err != nil:
+				status(2)
+			case offset >= uint64(len(data)):
+				status(1)
+			default:
+				writePacket(ch, 103, id, str(string(data[offset:])))
+			}
+		case 12: // READDIR
+			handle := name()
+			entries, err := os.ReadDir(s.path(handles[handle]))
+			if err != nil || listed[handle] {
+				status(1)
+				continue
+			}
+			listed[handle] = true
+			reply := [][]byte{id, u32(uint32(len(entries)))}
+			for _, e := range entries {
+				info, _ := e.Info()
+				reply = append(reply, str(e.Name()), str(e.Name()), attrs(info))
+			}
+			writePacket(ch, 104, reply...)
+		case 14: // MKDIR
+			if err := os.Mkdir(s.path(name()), 0o755); err != nil {
+				status(4)
+				continue
+			}
+			status(0)
+		case 17: // STAT
+			info, err := os.Stat(s.path(name()))
+			if err != nil {
+				status(2)
+				continue
+			}
+			writePacket(ch, 105, id, attrs(info))
+		case 18: // RENAME
+			from, to := s.path(name()), s.path(name())
+			if _, err := os.Stat(to); err == nil {
+				status(4)
+				continue
+			}
+			if err := os.Rename(from, to); err != nil {
+				status(4)
+				continue
+			}
+			status(0)
+		default:
+			status(8) // Unsupported
+		}
+	}
+}
+
+// path maps a remote path into the served directory
+func (s *fakeSFTP) path(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(p, "/")))
+}
+
+func writePacket(w io.Writer, typ byte, fields ...[]byte) {
+	var body []byte
+	for _, f := range fields {
+		body = append(body, f...)
+	}
+	pkt := binary.BigEndian.AppendUint32(nil, uint32(1+len(body)))
+	w.Write(append(append(pkt, typ), body...))
+}
+
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func str(s string) []byte { return append(u32(uint32(len(s))), s...) }
+
+func attrs(info os.FileInfo) []byte {
+	perm := uint32(0o100000)
+	if info.IsDir() {
+		perm = 0o040000
+	}
+	b := u32(0x1 | 0x4 | 0x8)
+	b = binary.BigEndian.AppendUint64(b, uint64(info.Size()))
+	b = append(b, u32(perm|uint32(info.Mode().Perm()))...)
+	mtime := uint32(info.ModTime().Unix())
+	return append(b, append(u32(mtime), u32(mtime)...)...)
+}
+
+// writeFile writes a remote file last modified age ago
+func writeFile(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func newConnector(t *testing.T, srv *fakeSFTP, addr string, cfg sftp.Config, handle sftp.Handler) *sftp.Connector {
+	t.Helper()
+	cfg.Addr, cfg.Username, cfg.Password, cfg.HostKey = addr, "supplier", "secret", srv.hostKey
+	c, err := sftp.NewConnector(processor.NewPipeline(), cfg, handle)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConnector_Poll(t *testing.T) {
+	root := t.TempDir()
+	srv, addr := newFakeSFTP(t, root)
+	writeFile(t, filepath.Join(root, "outbox", "a.xml"), invoiceXML, time.Hour)
+	writeFile(t, filepath.Join(root, "outbox", "broken.xml"), "<Invoice", 2*time.Hour)
+	writeFile(t, filepath.Join(root, "outbox", "notes.txt"), "not an invoice", time.Hour)
+	writeFile(t, filepath.Join(root, "outbox", "uploading.xml"), invoiceXML, 0)
+	writeFile(t, filepath.Join(root, "outbox", "done", "a.xml"), invoiceXML, time.Hour)
+
+	var files []sftp.File
+	c := newConnector(t, srv, addr, sftp.Config{
+		Dir:          "/outbox",
+		Patterns:     []string{"*.xml", "*.pdf"},
+		ProcessedDir: "/outbox/done",
+		FailedDir:    "/outbox/failed",
+	}, func(_ context.Context, file sftp.File, results []*processor.Result) error {
+		files = append(files, file)
+		if file.Name == "a.xml" {
+			require.Len(t, results, 1)
+			require.NoError(t, results[0].Error)
+			assert.Equal(t, "0000042", results[0].Invoice.Number)
+		}
+		return nil
+	})
+
+	handled, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	require.Len(t, files, 2)
+	assert.Equal(t, "broken.xml", files[0].Name, "oldest first")
+	assert.True(t, files[0].Failed)
+	assert.Equal(t, "/outbox/a.xml", files[1].Path)
+	assert.False(t, files[1].Failed)
+
+	assert.FileExists(t, filepath.Join(root, "outbox", "failed", "broken.xml"))
+	assert.FileExists(t, filepath.Join(root, "outbox", "done", "a-1.xml"), "taken names are not overwritten")
+	assert.FileExists(t, filepath.Join(root, "outbox", "notes.txt"), "files not matching the patterns are left alone")
+	assert.FileExists(t, filepath.Join(root, "outbox", "uploading.xml"), "files still being uploaded are left alone")
+
+	handled, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, handled)
+}
+
+func TestConnector_HandlerError(t *testing.T) {
+	root := t.TempDir()
+	srv, addr := newFakeSFTP(t, root)
+	writeFile(t, filepath.Join(root, "a.xml"), invoiceXML, time.Hour)
+
+	fail := true
+	c := newConnector(t, srv, addr, sftp.Config{ProcessedDir: "processed"}, func(context.Context, sftp.File, []*processor.Result) error {
+		if fail {
+			return errors.New("ERP unavailable")
+		}
+		return nil
+	})
+
+	handled, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, handled)
+	assert.FileExists(t, filepath.Join(root, "a.xml"), "left for the next poll")
+
+	fail = false
+	handled, err = c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	assert.FileExists(t, filepath.Join(root, "processed", "a.xml"))
+}
+
+func TestConnector_MaxFiles(t *testing.T) {
+	root := t.TempDir()
+	srv, addr := newFakeSFTP(t, root)
+	writeFile(t, filepath.Join(root, "a.xml"), invoiceXML, 2*time.Hour)
+	writeFile(t, filepath.Join(root, "b.xml"), invoiceXML, time.Hour)
+	writeFile(t, filepath.Join(root, "big.xml"), invoiceXML+strings.Repeat(" ", 1024), 3*time.Hour)
+
+	var names []string
+	c := newConnector(t, srv, addr, sftp.Config{ProcessedDir: "processed", FailedDir: "failed", MaxFiles: 2, MaxFileSize: 1024},
+		func(_ context.Context, file sftp.File, results []*processor.Result) error {
+			names = append(names, file.Name)
+			if file.Name == "big.xml" {
+				assert.ErrorContains(t, results[0].Error, "larger than 1024 bytes")
+			}
+			return nil
+		})
+
+	handled, err := c.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	assert.Equal(t, []string{"big.xml", "a.xml"}, names)
+	assert.FileExists(t, filepath.Join(root, "failed", "big.xml"))
+	assert.FileExists(t, filepath.Join(root, "b.xml"), "left for the next poll")
+}
+
+func TestConnector_WrongHostKey(t *testing.T) {
+	root := t.TempDir()
+	_, addr := newFakeSFTP(t, root)
+	other, _ := newFakeSFTP(t, root)
+	c := newConnector(t, other, addr, sftp.Config{ProcessedDir: "processed"}, func(context.Context, sftp.File, []*processor.Result) error { return nil })
+
+	_, err := c.Poll(context.Background())
+	assert.ErrorContains(t, err, "host key mismatch")
+}
+
+func TestNewConnector_Validation(t *testing.T) {
+	handle := func(context.Context, sftp.File, []*processor.Result) error { return nil }
+	valid := sftp.Config{Addr: "sftp.example.com:22", Username: "supplier", Password: "secret", InsecureIgnoreHostKey: true, ProcessedDir: "done"}
+	_, err := sftp.NewConnector(processor.NewPipeline(), valid, handle)
+	require.NoError(t, err)
+
+	for name, mutate := range map[string]func(*sftp.Config){
+		"no address":        func(c *sftp.Config) { c.Addr = "" },
+		"no processed dir":  func(c *sftp.Config) { c.ProcessedDir = "" },
+		"no credentials":    func(c *sftp.Config) { c.Password = "" },
+		"no host key":       func(c *sftp.Config) { c.InsecureIgnoreHostKey = false },
+		"invalid pattern":   func(c *sftp.Config) { c.Patterns = []string{"[*.pdf"} },
+		"invalid key":       func(c *sftp.Config) { c.PrivateKey = []byte("not a key") },
+		"missing knownhost": func(c *sftp.Config) { c.KnownHostsFile = filepath.Join(t.TempDir(), "known_hosts") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid
+			mutate(&cfg)
+			_, err := sftp.NewConnector(processor.NewPipeline(), cfg, handle)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package sigv4 signs HTTP requests with AWS Signature Version 4.
+//
+// It covers the subset needed to call AWS REST APIs (Bedrock, S3, SQS) with
+// static or environment credentials, without depending on the AWS SDK.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm     = "AWS4-HMAC-SHA256"
+	timeFormat    = "20060102T150405Z"
+	shortFormat   = "20060102"
+	serviceS3     = "s3"
+	emptySHA256   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	headerDate    = "X-Amz-Date"
+	headerToken   = "X-Amz-Security-Token"
+	headerContent = "X-Amz-Content-Sha256"
+)
+
+// Credentials holds AWS access credentials
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads credentials from the standard AWS environment variables
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// RegionFromEnv returns the region from AWS_REGION or AWS_DEFAULT_REGION
+func RegionFromEnv() string {
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// Signer signs HTTP requests for one AWS service and region
+type Signer struct {
+	credentials Credentials
+	region      string
+	service     string
+	now         func() time.Time
+}
+
+// NewSigner creates a signer for the given service (e.g. "bedrock", "s3", "sqs")
+func NewSigner(creds Credentials, region, service string) *Signer {
+	return &Signer{
+		credentials: creds,
+		region:      region,
+		service:     service,
+		now:         time.Now,
+	}
+}
+
+// WithClock returns a copy of the signer using a fixed clock (for tests)
+func (s *Signer) WithClock(now func() time.Time) *Signer {
+	cp := *s
+	cp.now = now
+	return &cp
+}
+
+// Sign adds the Authorization and X-Amz-* headers to req.
+// payload must be the exact request body (nil for empty bodies).
+func (s *Signer) Sign(req *http.Request, payload []byte) error {
+	if s.credentials.AccessKeyID == "" || s.credentials.SecretAccessKey == "" {
+		return fmt.Errorf("sigv4: missing AWS credentials")
+	}
+	if s.region == "" {
+		return fmt.Errorf("sigv4: missing AWS region")
+	}
+
+	now := s.now().UTC()
+	amzDate := now.Format(timeFormat)
+	date := now.Format(shortFormat)
+
+	payloadHash := emptySHA256
+	if len(payload) > 0 {
+		payloadHash = hashHex(payload)
+	}
+
+	req.Header.Set(headerDate, amzDate)
+	if s.credentials.SessionToken != "" {
+		req.Header.Set(headerToken, s.credentials.SessionToken)
+	}
+	if s.service == serviceS3 {
+		// S3 requires the payload hash header on every request
+		req.Header.Set(headerContent, payloadHash)
+	}
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.credentials.AccessKeyID, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// canonicalHeaders signs host, content-type and all x-amz-* headers
+func (s *Signer) canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": strings.TrimSpace(host)}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(headers[name])
+		b.WriteByte('\n')
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalURI escapes the path once for S3 and twice for other services
+func (s *Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	if s.service == serviceS3 {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape implements the RFC 3986 encoding AWS expects (unreserved chars kept)
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
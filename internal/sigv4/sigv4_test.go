@@ -0,0 +1,73 @@
+package sigv4_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/sigv4"
+)
+
+// Test vectors from the AWS Signature Version 4 test suite
+var (
+	testCreds = sigv4.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	testTime = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+)
+
+func TestSign_GetVanilla(t *testing.T) {
+	signer := sigv4.NewSigner(testCreds, "us-east-1", "service").WithClock(testTime)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, signer.Sign(req, nil))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestSign_QueryOrder(t *testing.T) {
+	signer := sigv4.NewSigner(testCreds, "us-east-1", "service").WithClock(testTime)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?Param2=value2&Param1=value1", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, signer.Sign(req, nil))
+
+	assert.Contains(t, req.Header.Get("Authorization"),
+		"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500")
+}
+
+func TestSign_SessionTokenAndS3Hash(t *testing.T) {
+	creds := testCreds
+	creds.SessionToken = "token"
+	signer := sigv4.NewSigner(creds, "us-east-1", "s3").WithClock(testTime)
+
+	req, err := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/key.json", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, signer.Sign(req, []byte("{}")))
+
+	assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+	assert.Equal(t, "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", req.Header.Get("X-Amz-Content-Sha256"))
+	assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+}
+
+func TestSign_MissingCredentials(t *testing.T) {
+	signer := sigv4.NewSigner(sigv4.Credentials{}, "us-east-1", "bedrock")
+
+	req, err := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	assert.Error(t, signer.Sign(req, nil))
+}
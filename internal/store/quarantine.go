@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// ErrNoArtifact is returned when replaying a record that did not keep its
+// source document
+var ErrNoArtifact = errors.New("record has no source document to replay")
+
+// Attempt is one run of a document through the pipeline
+type Attempt struct {
+	At         time.Time `json:"at"`
+	Strategies []string  `json:"strategies,omitempty"` // Strategy override of a replay
+	Model      string    `json:"model,omitempty"`      // Model override of a replay
+	Method     string    `json:"method,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"error_class,omitempty"` // See processor.ErrorClass
+}
+
+// ReplayOptions changes how a quarantined document is run again. Zero
+// fields keep the pipeline's configuration.
+type ReplayOptions struct {
+	Strategies []processor.Strategy // See processor.WithStrategies
+	Model      string               // See llm.ContextWithModel
+
+	// ReviewThreshold is the confidence below which the replayed result
+	// still needs review (see NewRecord)
+	ReviewThreshold float64
+}
+
+// Replay runs the source document of the failed record with id through
+// pipeline again and saves the outcome in its place, adding the run to the
+// record's attempts. A record that succeeds leaves the quarantine; one that
+// fails again keeps its document for the next replay.
+func Replay(ctx context.Context, s Store, pipeline *processor.Pipeline, id string, opts ReplayOptions) (*Record, error) {
+	rec, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Artifact == nil || len(rec.Artifact.Data) == 0 {
+		return nil, ErrNoArtifact
+	}
+
+	runCtx := llm.ContextWithDocumentID(ctx, rec.DocumentID)
+	if opts.Model != "" {
+		runCtx = llm.ContextWithModel(runCtx, opts.Model)
+	}
+	results := pipeline.Process(runCtx, rec.Artifact.Data, processor.ProcessOptions{Filename: rec.Artifact.Name, Strategies: opts.Strategies})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result := replayResult(results)
+	if result.Data == nil {
+		result.Data = rec.Artifact.Data
+	}
+
+	replayed := NewRecord(rec.DocumentID, result, opts.ReviewThreshold)
+	replayed.ID = rec.ID
+	replayed.Source = rec.Source
+	replayed.CreatedAt = rec.CreatedAt
+	replayed.History = rec.History
+	if status := replayed.Status; status != rec.status() {
+		replayed.Status = rec.status()
+		if err := transition(replayed, status, "replay", "", time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+	replayed.Attempts = append(rec.attempts(), Attempt{
+		At:         time.Now().UTC(),
+		Strategies: strategyNames(opts.Strategies),
+		Model:      opts.Model,
+		Method:     replayed.Method,
+		Error:      replayed.Error,
+		ErrorClass: replayed.ErrorClass,
+	})
+	if err := s.SaveResult(ctx, replayed); err != nil {
+		return nil, fmt.Errorf("failed to save replayed record: %w", err)
+	}
+	return replayed, nil
+}
+
+// attempts returns the attempt history of rec, with its first run for
+// records saved before attempts were kept
+func (r *Record) attempts() []Attempt {
+	if len(r.Attempts) > 0 {
+		return r.Attempts
+	}
+	return []Attempt{{At: r.CreatedAt, Method: r.Method, Error: r.Error, ErrorClass: r.ErrorClass}}
+}
+
+// replayResult picks the result of a replayed document: the first success,
+// or the first failure when every document failed
+func replayResult(results []*processor.Result) *processor.Result {
+	for _, result := range results {
+		if result.Error == nil && result.Invoice != nil {
+			return result
+		}
+	}
+	if len(results) == 0 {
+		return &processor.Result{Error: errors.New("no document in replayed file")}
+	}
+	return results[0]
+}
+
+func strategyNames(strategies []processor.Strategy) []string {
+	var names []string
+	for _, s := range strategies {
+		names = append(names, string(s))
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+// modelProvider fails requests to every model but good
+type modelProvider struct {
+	mu     sync.Mutex
+	models []string
+}
+
+func (p *modelProvider) Name() string { return "models" }
+
+func (p *modelProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	p.mu.Lock()
+	p.models = append(p.models, req.Model)
+	p.mu.Unlock()
+	if req.Model != "good" {
+		return nil, &llm.APIError{StatusCode: http.StatusBadRequest, Body: "model refused the image"}
+	}
+	return &llm.Response{Content: `{"invoice_number":"0000042","total_amount":110000}`, Model: req.Model}, nil
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	provider := &modelProvider{}
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(provider)), llm.WithVisionModel("bad"), llm.WithRetryPolicy(llm.NoRetry))
+	p := processor.NewPipeline(processor.WithLLMExtractor(extractor))
+	s := store.NewMemoryStore()
+
+	results := p.Process(ctx, []byte("\xff\xd8\xffscanned invoice"), processor.ProcessOptions{Filename: "scan.jpg"})
+	require.Len(t, results, 1)
+	require.Error(t, results[0].Error)
+	rec := store.NewRecord("inbox/scan.jpg", results[0], 0.7)
+	require.NoError(t, s.SaveResult(ctx, rec))
+	assert.Equal(t, "error", rec.ErrorClass)
+
+	quarantined, err := s.Query(ctx, store.Query{Failed: true})
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	quarantined, err = s.Query(ctx, store.Query{ErrorClass: "timeout"})
+	require.NoError(t, err)
+	assert.Empty(t, quarantined)
+
+	// Same configuration: fails again, and stays quarantined
+	replayed, err := store.Replay(ctx, s, p, rec.ID, store.ReplayOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, replayed.Error)
+	assert.NotNil(t, replayed.Artifact)
+	require.Len(t, replayed.Attempts, 2)
+
+	// Another model
+	replayed, err = store.Replay(ctx, s, p, rec.ID, store.ReplayOptions{Model: "good", ReviewThreshold: 0.1})
+	require.NoError(t, err)
+	assert.Empty(t, replayed.Error)
+	assert.Equal(t, "0000042", replayed.Invoice.Number)
+	assert.Equal(t, rec.ID, replayed.ID)
+	assert.Equal(t, rec.CreatedAt, replayed.CreatedAt)
+	require.Len(t, replayed.Attempts, 3)
+	assert.Equal(t, "error", replayed.Attempts[0].ErrorClass)
+	assert.Equal(t, "good", replayed.Attempts[2].Model)
+	assert.Empty(t, replayed.Attempts[2].Error)
+	assert.Equal(t, []string{"bad", "bad", "good"}, provider.models)
+
+	quarantined, err = s.Query(ctx, store.Query{Failed: true})
+	require.NoError(t, err)
+	assert.Empty(t, quarantined)
+
+	_, err = store.Replay(ctx, s, p, "missing", store.ReplayOptions{})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestReplay_NoArtifact(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	rec := store.NewRecord("notes.txt", &processor.Result{Error: errors.New("unsupported file format")}, 0.7)
+	require.NoError(t, s.SaveResult(ctx, rec))
+
+	_, err := store.Replay(ctx, s, processor.NewPipeline(), rec.ID, store.ReplayOptions{})
+	assert.ErrorIs(t, err, store.ErrNoArtifact)
+}
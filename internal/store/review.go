@@ -0,0 +1,118 @@
+package store
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+var (
+	// ErrClaimed is returned when another reviewer holds the claim on a record
+	ErrClaimed = errors.New("record claimed by another reviewer")
+
+	// ErrReviewed is returned when claiming a record already reviewed
+	ErrReviewed = errors.New("record already reviewed")
+)
+
+// ClaimTimeout is how long a claim keeps other reviewers off a record. A
+// reviewer who walks away doesn't block it for longer.
+const ClaimTimeout = 30 * time.Minute
+
+// Artifact is the source document of a record that needs review, so the
+// reviewer can compare the extraction with it
+type Artifact struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// FieldProvenance tells a reviewer where a value came from and why it may be
+// wrong. Paths are those of model.Invoice.LowConfidenceFields, e.g.
+// "seller.tax_id".
+type FieldProvenance struct {
+	Path          string             `json:"path"`
+	Location      *model.BoundingBox `json:"location,omitempty"`
+	LowConfidence bool               `json:"low_confidence,omitempty"`
+	Handwritten   bool               `json:"handwritten,omitempty"`
+}
+
+// newArtifact returns the artifact of data, or nil without data
+func newArtifact(name string, data []byte) *Artifact {
+	if len(data) == 0 {
+		return nil
+	}
+	return &Artifact{Name: name, MimeType: http.DetectContentType(data), Size: len(data), Data: data}
+}
+
+// fieldProvenance lists the located, uncertain and handwritten fields of inv
+func fieldProvenance(inv *model.Invoice) []FieldProvenance {
+	if inv == nil {
+		return nil
+	}
+	fields := make(map[string]*FieldProvenance)
+	field := func(path string) *FieldProvenance {
+		if f, ok := fields[path]; ok {
+			return f
+		}
+		f := &FieldProvenance{Path: path}
+		fields[path] = f
+		return f
+	}
+	for path, box := range inv.FieldLocations {
+		field(path).Location = &box
+	}
+	for _, path := range inv.LowConfidenceFields {
+		field(path).LowConfidence = true
+	}
+	for _, path := range inv.HandwrittenFields {
+		field(path).Handwritten = true
+	}
+
+	provenance := make([]FieldProvenance, 0, len(fields))
+	for _, f := range fields {
+		provenance = append(provenance, *f)
+	}
+	sort.Slice(provenance, func(i, j int) bool { return provenance[i].Path < provenance[j].Path })
+	return provenance
+}
+
+// claimedByOther reports whether someone other than reviewer holds a claim
+// on rec that has not timed out
+func claimedByOther(rec *Record, reviewer string, now time.Time) bool {
+	return rec.ClaimedBy != "" && rec.ClaimedBy != reviewer && now.Sub(rec.ClaimedAt) < ClaimTimeout
+}
+
+// checkClaim returns why reviewer can't claim rec, if they can't
+func checkClaim(rec *Record, reviewer string, now time.Time) error {
+	switch {
+	case rec.ReviewedBy != "":
+		return ErrReviewed
+	case claimedByOther(rec, reviewer, now):
+		return ErrClaimed
+	}
+	return nil
+}
+
+// applyCorrection makes inv the final invoice of rec, keeping the extracted
+// one and what the reviewer changed in it, and marks rec reviewed by
+// reviewer. A failed record corrected by hand leaves the quarantine.
+func applyCorrection(rec *Record, reviewer string, inv *model.Invoice, now time.Time) error {
+	if err := review(rec, reviewer, now); err != nil {
+		return err
+	}
+	if rec.Extracted == nil {
+		rec.Extracted = rec.Invoice
+	}
+	rec.Invoice = inv
+	rec.Changes = nil
+	if rec.Extracted != nil {
+		rec.Changes = model.Diff(rec.Extracted, inv)
+	}
+	rec.ErrorClass = ""
+	rec.Fingerprint = inv.Fingerprint()
+	return nil
+}
@@ -0,0 +1,73 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+func TestNewRecord_ReviewArtifacts(t *testing.T) {
+	result := invoiceResult("1", time.Time{}, 0.5)
+	result.Data = []byte("%PDF-1.4\n")
+	result.Invoice.LowConfidenceFields = []string{"total_amount"}
+	result.Invoice.HandwrittenFields = []string{"total_amount"}
+	result.Invoice.FieldLocations = map[string]model.BoundingBox{"seller.tax_id": {Page: 1, X: 0.1, Y: 0.2}}
+
+	rec := store.NewRecord("scan.pdf", result, 0.7)
+	require.NotNil(t, rec.Artifact)
+	assert.Equal(t, "scan.pdf", rec.Artifact.Name)
+	assert.Equal(t, "application/pdf", rec.Artifact.MimeType)
+	assert.Equal(t, 9, rec.Artifact.Size)
+	assert.Equal(t, []store.FieldProvenance{
+		{Path: "seller.tax_id", Location: &model.BoundingBox{Page: 1, X: 0.1, Y: 0.2}},
+		{Path: "total_amount", LowConfidence: true, Handwritten: true},
+	}, rec.Provenance)
+
+	result.Confidence = 0.95
+	rec = store.NewRecord("scan.pdf", result, 0.7)
+	assert.Nil(t, rec.Artifact, "documents are kept only for review")
+	assert.Empty(t, rec.Provenance)
+}
+
+func TestMemoryStore_Review(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	rec := store.NewRecord("scan.pdf", invoiceResult("1", time.Time{}, 0.5), 0.7)
+	require.NoError(t, s.SaveResult(ctx, rec))
+
+	claimed, err := s.Claim(ctx, rec.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claimed.ClaimedBy)
+	_, err = s.Claim(ctx, rec.ID, "alice")
+	assert.NoError(t, err, "claims can be renewed")
+	_, err = s.Claim(ctx, rec.ID, "bob")
+	assert.ErrorIs(t, err, store.ErrClaimed)
+	_, err = s.Claim(ctx, "missing", "bob")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	corrected := *rec.Invoice
+	corrected.Number = "7"
+	assert.ErrorIs(t, s.Correct(ctx, rec.ID, "bob", &corrected), store.ErrClaimed)
+	require.NoError(t, s.Correct(ctx, rec.ID, "alice", &corrected))
+
+	got, err := s.GetByID(ctx, rec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "7", got.Invoice.Number)
+	assert.Equal(t, "1", got.Extracted.Number)
+	assert.Equal(t, []model.FieldChange{{Field: "number", Old: "1", New: "7"}}, got.Changes)
+	assert.NotEqual(t, rec.Fingerprint, got.Fingerprint)
+	assert.Equal(t, "alice", got.ReviewedBy)
+	assert.Empty(t, got.ClaimedBy)
+
+	_, err = s.Claim(ctx, rec.ID, "bob")
+	assert.ErrorIs(t, err, store.ErrReviewed)
+	pending, err := s.Query(ctx, store.Query{PendingReview: true})
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// TableName is the table SQLStore keeps records in
+const TableName = "invoice_records"
+
+// timeLayout stores timestamps as fixed-width UTC text, which sorts in time
+// order in every database
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// dialect holds what differs between the supported databases
+type dialect struct {
+	name     string
+	dataType string             // Column type of the JSON record
+	bind     func(n int) string // Placeholder of the nth argument, from 1
+}
+
+var (
+	sqliteDialect = dialect{
+		name:     "sqlite",
+		dataType: "TEXT",
+		bind:     func(int) string { return "?" },
+	}
+	postgresDialect = dialect{
+		name:     "postgres",
+		dataType: "JSONB",
+		bind:     func(n int) string { return "$" + strconv.Itoa(n) },
+	}
+)
+
+// SQLStore keeps records in a SQL database. The record is stored as JSON
+// next to the columns queries filter on. Open the *sql.DB with the driver
+// of your choice (mattn/go-sqlite3 or modernc.org/sqlite for SQLite, pgx or
+// lib/pq for Postgres); the store doesn't import one.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewSQLite returns a store in a SQLite database, creating its table if needed
+func NewSQLite(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	return newSQLStore(ctx, db, sqliteDialect)
+}
+
+// NewPostgres returns a store in a Postgres database, creating its table if needed
+func NewPostgres(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	return newSQLStore(ctx, db, postgresDialect)
+}
+
+func newSQLStore(ctx context.Context, db *sql.DB, d dialect) (*SQLStore, error) {
+	s := &SQLStore{db: db, dialect: d}
+	for _, stmt := range s.schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create %s schema: %w", d.name, err)
+		}
+	}
+	for _, stmt := range s.migrations() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil && !isDuplicateColumn(err) {
+			return nil, fmt.Errorf("failed to migrate %s schema: %w", d.name, err)
+		}
+	}
+	for _, stmt := range s.indexes() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create %s indexes: %w", d.name, err)
+		}
+	}
+	return s, nil
+}
+
+// schema returns the statements creating the table
+func (s *SQLStore) schema() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + TableName + ` (
+	id            TEXT PRIMARY KEY,
+	document_id   TEXT NOT NULL,
+	fingerprint   TEXT NOT NULL,
+	seller_tax_id TEXT NOT NULL,
+	invoice_date  TEXT NOT NULL,
+	needs_review  BOOLEAN NOT NULL,
+	reviewed_by   TEXT NOT NULL,
+	reviewed_at   TEXT NOT NULL,
+	claimed_by    TEXT NOT NULL,
+	claimed_at    TEXT NOT NULL,
+	error_class   TEXT NOT NULL DEFAULT '',
+	tenant        TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL DEFAULT '',
+	created_at    TEXT NOT NULL,
+	data          ` + s.dialect.dataType + ` NOT NULL
+)`,
+	}
+}
+
+// indexes returns the statements creating the indexes of the table. They
+// run after the migrations, since they may cover columns those add.
+func (s *SQLStore) indexes() []string {
+	return []string{
+		`CREATE INDEX IF NOT EXISTS ` + TableName + `_fingerprint ON ` + TableName + ` (fingerprint)`,
+		`CREATE INDEX IF NOT EXISTS ` + TableName + `_seller ON ` + TableName + ` (seller_tax_id, invoice_date)`,
+		`CREATE INDEX IF NOT EXISTS ` + TableName + `_created ON ` + TableName + ` (created_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + TableName + `_status ON ` + TableName + ` (status)`,
+	}
+}
+
+// migrations returns the statements adding the columns of newer versions to
+// a table created before them. They fail once applied (SQLite has no ADD
+// COLUMN IF NOT EXISTS); see isDuplicateColumn.
+func (s *SQLStore) migrations() []string {
+	return []string{
+		`ALTER TABLE ` + TableName + ` ADD COLUMN error_class TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE ` + TableName + ` ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE ` + TableName + ` ADD COLUMN status TEXT NOT NULL DEFAULT ''`,
+	}
+}
+
+// isDuplicateColumn reports whether err is that of a migration already applied
+func isDuplicateColumn(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate column") || strings.Contains(msg, "already exists")
+}
+
+// SaveResult implements Store
+func (s *SQLStore) SaveResult(ctx context.Context, rec *Record) error {
+	prepare(rec)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	var sellerTaxID, invoiceDate string
+	if rec.Invoice != nil {
+		sellerTaxID = rec.Invoice.Seller.TaxID
+		invoiceDate = formatDate(rec.Invoice.Date)
+	}
+	columns := []string{"id", "document_id", "fingerprint", "seller_tax_id", "invoice_date", "needs_review", "reviewed_by", "reviewed_at", "claimed_by", "claimed_at", "error_class", "tenant", "status", "created_at", "data"}
+	args := []any{rec.ID, rec.DocumentID, rec.Fingerprint, sellerTaxID, invoiceDate, rec.NeedsReview, rec.ReviewedBy, formatTime(rec.ReviewedAt), rec.ClaimedBy, formatTime(rec.ClaimedAt), rec.ErrorClass, rec.Tenant, string(rec.Status), formatTime(rec.CreatedAt), string(data)}
+
+	placeholders := make([]string, len(columns))
+	updates := make([]string, 0, len(columns)-1)
+	for i, col := range columns {
+		placeholders[i] = s.dialect.bind(i + 1)
+		if col != "id" {
+			updates = append(updates, col+" = excluded."+col)
+		}
+	}
+	query := `INSERT INTO ` + TableName + ` (` + strings.Join(columns, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `)
+ON CONFLICT (id) DO UPDATE SET ` + strings.Join(updates, ", ")
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to save record: %w", err)
+	}
+	return nil
+}
+
+// GetByID implements Store
+func (s *SQLStore) GetByID(ctx context.Context, id string) (*Record, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+recordColumns+` FROM `+TableName+` WHERE id = `+s.dialect.bind(1), id)
+	rec, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+	return rec, nil
+}
+
+// Query implements Store
+func (s *SQLStore) Query(ctx context.Context, q Query) ([]*Record, error) {
+	query, args := s.buildQuery(q)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	return records, nil
+}
+
+// buildQuery renders q as a SELECT with its arguments
+func (s *SQLStore) buildQuery(q Query) (string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, s.dialect.bind(len(args))))
+	}
+
+	if !q.AllTenants {
+		add("tenant = %s", q.Tenant)
+	}
+	if q.SellerTaxID != "" {
+		add("seller_tax_id = %s", q.SellerTaxID)
+	}
+	if q.Fingerprint != "" {
+		add("fingerprint = %s", q.Fingerprint)
+	}
+	if q.DocumentID != "" {
+		add("document_id = %s", q.DocumentID)
+	}
+	if !q.From.IsZero() {
+		add("invoice_date >= %s", formatDate(q.From))
+	}
+	if !q.To.IsZero() {
+		add("invoice_date <= %s", formatDate(q.To))
+		where = append(where, "invoice_date <> ''")
+	}
+	if q.PendingReview {
+		where = append(where, "needs_review", "reviewed_by = ''")
+	}
+	if q.Failed {
+		where = append(where, "error_class <> ''")
+	}
+	if q.ErrorClass != "" {
+		add("error_class = %s", q.ErrorClass)
+	}
+	if q.Status != "" {
+		add("status = %s", string(q.Status))
+	}
+
+	query := `SELECT ` + recordColumns + ` FROM ` + TableName
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, q.limit(), max(q.Offset, 0))
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT %s OFFSET %s`, s.dialect.bind(len(args)-1), s.dialect.bind(len(args)))
+	return query, args
+}
+
+// MarkReviewed implements Store. Like SetStatus, it applies only while the
+// record keeps the status it was read with.
+func (s *SQLStore) MarkReviewed(ctx context.Context, id, reviewer string) error {
+	rec, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	from := rec.status()
+	if err := review(rec, reviewer, time.Now().UTC()); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	b := s.dialect.bind
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE `+TableName+` SET data = `+b(1)+`, status = `+b(2)+`, reviewed_by = `+b(3)+`, reviewed_at = `+b(4)+`, claimed_by = '', claimed_at = ''`+
+			` WHERE id = `+b(5)+` AND (status = `+b(6)+` OR status = '')`,
+		string(data), string(rec.Status), reviewer, formatTime(rec.ReviewedAt), id, string(from))
+	if err != nil {
+		return fmt.Errorf("failed to mark record reviewed: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: record left %s meanwhile", ErrInvalidTransition, from)
+	}
+	return nil
+}
+
+// Claim implements Store. The claim is taken in one conditional update, so
+// of two reviewers claiming at once only one gets the record.
+func (s *SQLStore) Claim(ctx context.Context, id, reviewer string) (*Record, error) {
+	now := time.Now().UTC()
+	b := s.dialect.bind
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE `+TableName+` SET claimed_by = `+b(1)+`, claimed_at = `+b(2)+
+			` WHERE id = `+b(3)+` AND reviewed_by = '' AND (claimed_by = '' OR claimed_by = `+b(4)+` OR claimed_at < `+b(5)+`)`,
+		reviewer, formatTime(now), id, reviewer, formatTime(now.Add(-ClaimTimeout)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim record: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim record: %w", err)
+	}
+
+	rec, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		if err := checkClaim(rec, reviewer, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrClaimed // Taken between the update and the read
+	}
+	return rec, nil
+}
+
+// Correct implements Store. Like SetStatus, it applies only while the
+// record keeps the status it was read with.
+func (s *SQLStore) Correct(ctx context.Context, id, reviewer string, inv *model.Invoice) error {
+	if inv == nil {
+		return errors.New("no corrected invoice")
+	}
+	rec, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if claimedByOther(rec, reviewer, now) {
+		return ErrClaimed
+	}
+	from := rec.status()
+	if err := applyCorrection(rec, reviewer, inv, now); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	b := s.dialect.bind
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE `+TableName+` SET data = `+b(1)+`, fingerprint = `+b(2)+`, seller_tax_id = `+b(3)+`, invoice_date = `+b(4)+
+			`, reviewed_by = `+b(5)+`, reviewed_at = `+b(6)+`, claimed_by = '', claimed_at = '', error_class = '', status = `+b(7)+
+			` WHERE id = `+b(8)+` AND (claimed_by = '' OR claimed_by = `+b(9)+` OR claimed_at < `+b(10)+`)`+
+			` AND (status = `+b(11)+` OR status = '')`,
+		string(data), rec.Fingerprint, inv.Seller.TaxID, formatDate(inv.Date),
+		reviewer, formatTime(now), string(rec.Status), id, reviewer, formatTime(now.Add(-ClaimTimeout)), string(from))
+	if err != nil {
+		return fmt.Errorf("failed to save correction: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Claimed or moved along the workflow between the read and the update
+		if rec, err := s.GetByID(ctx, id); err == nil && !claimedByOther(rec, reviewer, time.Now().UTC()) {
+			return fmt.Errorf("%w: record left %s meanwhile", ErrInvalidTransition, from)
+		}
+		return ErrClaimed
+	}
+	return nil
+}
+
+// SetStatus implements Store. The update applies only while the record
+// keeps the status it was read with, so of two concurrent changes one
+// fails rather than both entering the history.
+func (s *SQLStore) SetStatus(ctx context.Context, id string, status Status, actor, note string) (*Record, error) {
+	rec, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	from := rec.status()
+	if err := transition(rec, status, actor, note, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	// Records saved before statuses were kept have none in their column
+	b := s.dialect.bind
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE `+TableName+` SET data = `+b(1)+`, status = `+b(2)+` WHERE id = `+b(3)+` AND (status = `+b(4)+` OR status = '')`,
+		string(data), string(status), id, string(from))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update record status: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("%w: record left %s meanwhile", ErrInvalidTransition, from)
+	}
+	return rec, nil
+}
+
+// Remember implements processor.DuplicateStore over the saved records: a
+// fingerprint is known once a record carrying it was saved
+func (s *SQLStore) Remember(ctx context.Context, fp, _ string) (string, bool, error) {
+	var doc string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT document_id FROM `+TableName+` WHERE fingerprint = `+s.dialect.bind(1)+` AND tenant = `+s.dialect.bind(2)+` ORDER BY created_at LIMIT 1`,
+		fp, processor.TenantFromContext(ctx)).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up fingerprint: %w", err)
+	}
+	return doc, true, nil
+}
+
+// recordColumns are the columns scanRecord reads
+const recordColumns = "data, reviewed_by, reviewed_at, claimed_by, claimed_at"
+
+// scanRecord decodes a row of recordColumns. The review and claim columns
+// are updated in place and override the JSON.
+func scanRecord(row interface{ Scan(...any) error }) (*Record, error) {
+	var data []byte
+	var reviewedBy, reviewedAt, claimedBy, claimedAt string
+	if err := row.Scan(&data, &reviewedBy, &reviewedAt, &claimedBy, &claimedAt); err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.ReviewedBy = reviewedBy
+	rec.ReviewedAt, _ = time.Parse(timeLayout, reviewedAt)
+	rec.ClaimedBy = claimedBy
+	rec.ClaimedAt, _ = time.Parse(timeLayout, claimedAt)
+	return &rec, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+var (
+	_ Store                    = (*SQLStore)(nil)
+	_ processor.DuplicateStore = (*SQLStore)(nil)
+)
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+func TestSQLStore_BuildQuery(t *testing.T) {
+	q := Query{
+		SellerTaxID:   "0123456789",
+		From:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		PendingReview: true,
+		AllTenants:    true,
+		Offset:        20,
+	}
+
+	query, args := (&SQLStore{dialect: postgresDialect}).buildQuery(q)
+	assert.Equal(t, "SELECT data, reviewed_by, reviewed_at, claimed_by, claimed_at FROM invoice_records WHERE seller_tax_id = $1 AND invoice_date >= $2 AND invoice_date <= $3 AND invoice_date <> '' AND needs_review AND reviewed_by = '' ORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5", query)
+	assert.Equal(t, []any{"0123456789", "2024-01-01", "2024-03-31", DefaultQueryLimit, 20}, args)
+
+	query, args = (&SQLStore{dialect: sqliteDialect}).buildQuery(Query{Fingerprint: "abc", Limit: 5})
+	assert.Equal(t, "SELECT data, reviewed_by, reviewed_at, claimed_by, claimed_at FROM invoice_records WHERE tenant = ? AND fingerprint = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{"", "abc", 5, 0}, args)
+
+	query, args = (&SQLStore{dialect: sqliteDialect}).buildQuery(Query{Tenant: "acme", DocumentID: "a.xml"})
+	assert.Equal(t, "SELECT data, reviewed_by, reviewed_at, claimed_by, claimed_at FROM invoice_records WHERE tenant = ? AND document_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{"acme", "a.xml", DefaultQueryLimit, 0}, args)
+
+	query, args = (&SQLStore{dialect: sqliteDialect}).buildQuery(Query{Failed: true, ErrorClass: "timeout"})
+	assert.Equal(t, "SELECT data, reviewed_by, reviewed_at, claimed_by, claimed_at FROM invoice_records WHERE tenant = ? AND error_class <> '' AND error_class = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{"", "timeout", DefaultQueryLimit, 0}, args)
+
+	query, args = (&SQLStore{dialect: sqliteDialect}).buildQuery(Query{Status: StatusApproved})
+	assert.Equal(t, "SELECT data, reviewed_by, reviewed_at, claimed_by, claimed_at FROM invoice_records WHERE tenant = ? AND status = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{"", "approved", DefaultQueryLimit, 0}, args)
+}
+
+func TestSQLStore_Schema(t *testing.T) {
+	assert.Contains(t, (&SQLStore{dialect: postgresDialect}).schema()[0], "data          JSONB NOT NULL")
+	assert.Contains(t, (&SQLStore{dialect: sqliteDialect}).schema()[0], "data          TEXT NOT NULL")
+	store := &SQLStore{dialect: sqliteDialect}
+	for _, stmt := range append(store.schema(), store.indexes()...) {
+		assert.True(t, strings.Contains(stmt, "IF NOT EXISTS"), "schema creation is idempotent")
+	}
+}
+
+func TestSQLStore_ConcurrentStatus(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDB()
+	s, err := NewSQLite(ctx, db.open())
+	require.NoError(t, err)
+	approve := func(id string) func(*fakeDB) {
+		return func(db *fakeDB) {
+			db.beforeUpdate = nil
+			_, err := s.SetStatus(ctx, id, StatusApproved, "bob", "")
+			require.NoError(t, err)
+		}
+	}
+
+	// Records approved between the read and the write of a review stay approved
+	rec := sqlRecord("portal/1.xml", "1", "0123456789", time.Time{}, 0.95)
+	require.NoError(t, s.SaveResult(ctx, rec))
+	db.beforeUpdate = approve(rec.ID)
+	assert.ErrorIs(t, s.MarkReviewed(ctx, rec.ID, "alice"), ErrInvalidTransition)
+	got, err := s.GetByID(ctx, rec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusApproved, got.Status)
+	assert.Empty(t, got.ReviewedBy)
+
+	rec = sqlRecord("portal/2.xml", "2", "0123456789", time.Time{}, 0.95)
+	require.NoError(t, s.SaveResult(ctx, rec))
+	db.beforeUpdate = approve(rec.ID)
+	corrected := *rec.Invoice
+	corrected.Number = "7"
+	assert.ErrorIs(t, s.Correct(ctx, rec.ID, "alice", &corrected), ErrInvalidTransition)
+	got, err = s.GetByID(ctx, rec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusApproved, got.Status)
+	assert.Equal(t, "2", got.Invoice.Number)
+}
+
+func TestSQLStore_Upgrade(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDB()
+
+	// The table and a record as the first version of the store saved them
+	require.NoError(t, db.exec(`CREATE TABLE IF NOT EXISTS `+TableName+` (
+	id            TEXT PRIMARY KEY,
+	document_id   TEXT NOT NULL,
+	fingerprint   TEXT NOT NULL,
+	seller_tax_id TEXT NOT NULL,
+	invoice_date  TEXT NOT NULL,
+	needs_review  BOOLEAN NOT NULL,
+	reviewed_by   TEXT NOT NULL,
+	reviewed_at   TEXT NOT NULL,
+	claimed_by    TEXT NOT NULL,
+	claimed_at    TEXT NOT NULL,
+	created_at    TEXT NOT NULL,
+	data          TEXT NOT NULL
+)`))
+	require.NoError(t, db.exec(`CREATE INDEX IF NOT EXISTS `+TableName+`_fingerprint ON `+TableName+` (fingerprint)`))
+	require.NoError(t, db.exec(`INSERT INTO `+TableName+` (id, document_id, fingerprint, seller_tax_id, invoice_date, needs_review, reviewed_by, reviewed_at, claimed_by, claimed_at, created_at, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET data = excluded.data`,
+		"old", "portal/1.xml", "fp", "0123456789", "2024-03-15", true, "", "", "", "", "2024-03-15T09:00:00.000000000Z",
+		`{"id":"old","document_id":"portal/1.xml","invoice":{"number":"1","seller":{"tax_id":"0123456789"}},"needs_review":true,"created_at":"2024-03-15T09:00:00Z"}`))
+
+	s, err := NewSQLite(ctx, db.open())
+	require.NoError(t, err)
+	for _, col := range []string{"error_class", "tenant", "status"} {
+		assert.True(t, db.tables[TableName].hasColumn(col), col)
+	}
+
+	records, err := s.Query(ctx, Query{PendingReview: true})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, StatusExtracted, records[0].status(), "records saved without a status get one from their state")
+	require.NoError(t, s.MarkReviewed(ctx, "old", "alice"))
+	records, err = s.Query(ctx, Query{Status: StatusReviewed})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, []StatusChange{{From: StatusExtracted, To: StatusReviewed, At: records[0].ReviewedAt, Actor: "alice"}}, records[0].History)
+}
+
+func TestTimeLayout_Sorts(t *testing.T) {
+	a := formatTime(time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC))
+	b := formatTime(time.Date(2024, 3, 15, 9, 0, 0, 500, time.UTC))
+	assert.Less(t, a, b)
+	assert.Len(t, a, len(b))
+}
+
+// sqlRecord returns a record of an invoice of seller, needing review
+// below 0.7
+func sqlRecord(documentID, number, seller string, date time.Time, confidence float64) *Record {
+	inv := &model.Invoice{Number: number, Date: date, Seller: model.Party{TaxID: seller}, TotalAmount: decimal.NewFromInt(216000)}
+	result := &processor.Result{Invoice: inv, Method: processor.MethodXML, Confidence: confidence, Fingerprint: inv.Fingerprint(), Data: []byte("<Invoice/>")}
+	return NewRecord(documentID, result, 0.7)
+}
+
+func TestSQLStore_Execute(t *testing.T) {
+	for _, d := range []dialect{sqliteDialect, postgresDialect} {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newFakeDB()
+			s, err := newSQLStore(ctx, db.open(), d)
+			require.NoError(t, err)
+			_, err = newSQLStore(ctx, db.open(), d)
+			require.NoError(t, err, "opening a store again leaves its schema as is")
+
+			march := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+			first := sqlRecord("portal/1.xml", "1", "0123456789", march, 0.95)
+			require.NoError(t, s.SaveResult(ctx, first))
+			require.NotEmpty(t, first.ID)
+			second := sqlRecord("email/2.pdf", "2", "0312345678", march.AddDate(0, 1, 0), 0.5)
+			second.CreatedAt = first.CreatedAt.Add(time.Second)
+			require.NoError(t, s.SaveResult(ctx, second))
+			other := sqlRecord("acme/3.xml", "3", "0123456789", march, 0.95)
+			other.Tenant = "acme"
+			require.NoError(t, s.SaveResult(ctx, other))
+
+			got, err := s.GetByID(ctx, first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "1", got.Invoice.Number)
+			assert.Equal(t, StatusValidated, got.Status)
+			_, err = s.GetByID(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// Saving a record again replaces it
+			first.DocumentID = "portal/1-renamed.xml"
+			require.NoError(t, s.SaveResult(ctx, first))
+			got, err = s.GetByID(ctx, first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "portal/1-renamed.xml", got.DocumentID)
+
+			records, err := s.Query(ctx, Query{})
+			require.NoError(t, err)
+			require.Len(t, records, 2, "the tenant's records only")
+			assert.Equal(t, second.ID, records[0].ID, "newest first")
+			records, err = s.Query(ctx, Query{SellerTaxID: "0123456789", From: march, To: march})
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, first.ID, records[0].ID)
+			records, err = s.Query(ctx, Query{Limit: 1, Offset: 1})
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, first.ID, records[0].ID)
+			records, err = s.Query(ctx, Query{AllTenants: true, Status: StatusValidated})
+			require.NoError(t, err)
+			assert.Len(t, records, 2)
+
+			doc, ok, err := s.Remember(processor.ContextWithTenant(ctx, "acme"), other.Fingerprint, "")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "acme/3.xml", doc)
+
+			// The review of the record that needs one
+			records, err = s.Query(ctx, Query{PendingReview: true})
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, second.ID, records[0].ID)
+			_, err = s.Claim(ctx, second.ID, "alice")
+			require.NoError(t, err)
+			_, err = s.Claim(ctx, second.ID, "bob")
+			assert.ErrorIs(t, err, ErrClaimed)
+			corrected := *second.Invoice
+			corrected.Number = "7"
+			assert.ErrorIs(t, s.Correct(ctx, second.ID, "bob", &corrected), ErrClaimed)
+			require.NoError(t, s.Correct(ctx, second.ID, "alice", &corrected))
+
+			got, err = s.GetByID(ctx, second.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "7", got.Invoice.Number)
+			assert.Equal(t, "2", got.Extracted.Number)
+			assert.Equal(t, "alice", got.ReviewedBy)
+			assert.Empty(t, got.ClaimedBy)
+			assert.Equal(t, StatusReviewed, got.Status)
+			_, err = s.Claim(ctx, second.ID, "bob")
+			assert.ErrorIs(t, err, ErrReviewed)
+			records, err = s.Query(ctx, Query{PendingReview: true})
+			require.NoError(t, err)
+			assert.Empty(t, records)
+
+			require.NoError(t, s.MarkReviewed(ctx, first.ID, "bob"))
+			assert.ErrorIs(t, s.MarkReviewed(ctx, "missing", "bob"), ErrNotFound)
+			rec, err := s.SetStatus(ctx, first.ID, StatusApproved, "carol", "PO 4711")
+			require.NoError(t, err)
+			assert.Len(t, rec.History, 3)
+			_, err = s.SetStatus(ctx, first.ID, StatusReceived, "carol", "")
+			assert.ErrorIs(t, err, ErrInvalidTransition)
+			records, err = s.Query(ctx, Query{Status: StatusApproved})
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, "bob", records[0].ReviewedBy)
+			assert.Equal(t, "PO 4711", records[0].History[2].Note)
+		})
+	}
+}
@@ -0,0 +1,656 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// fakeDB is an in-memory database understanding the statements SQLStore
+// runs, in either dialect, so its SQL is executed rather than compared as
+// text. Like SQLite, it rejects indexes on missing columns and columns
+// added twice.
+type fakeDB struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+
+	// beforeUpdate runs before each UPDATE, to change rows between a
+	// store's read and its write
+	beforeUpdate func(db *fakeDB)
+}
+
+type fakeTable struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{tables: make(map[string]*fakeTable)}
+}
+
+// open returns a *sql.DB on db
+func (db *fakeDB) open() *sql.DB {
+	return sql.OpenDB(fakeConnector{db})
+}
+
+// exec runs a statement directly, as an earlier version of the store would
+func (db *fakeDB) exec(query string, args ...driver.Value) error {
+	_, _, err := db.run(query, args)
+	return err
+}
+
+func (t *fakeTable) hasColumn(name string) bool {
+	for _, col := range t.columns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("open fake databases with fakeDB.open")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("transactions not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, n, err := s.db.run(s.query, args)
+	return driver.RowsAffected(n), err
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, _, err := s.db.run(s.query, args)
+	return rows, err
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeToken is a word, literal, placeholder or punctuation of a statement
+type fakeToken struct {
+	kind  byte // 'w' word, 's' string, 'n' number, '?' placeholder, 'p' punctuation
+	text  string
+	index int // Argument of a placeholder, from 0
+}
+
+func tokenize(query string) ([]fakeToken, error) {
+	var tokens []fakeToken
+	next := 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(query) && (query[j] == '_' || query[j] == '.' || unicode.IsLetter(rune(query[j])) || unicode.IsDigit(rune(query[j]))) {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: 'w', text: query[i:j]})
+			i = j
+		case unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(query) && unicode.IsDigit(rune(query[j])) {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: 'n', text: query[i:j]})
+			i = j
+		case c == '?':
+			tokens = append(tokens, fakeToken{kind: '?', index: next})
+			next++
+			i++
+		case c == '$':
+			j := i + 1
+			for j < len(query) && unicode.IsDigit(rune(query[j])) {
+				j++
+			}
+			n, err := strconv.Atoi(query[i+1 : j])
+			if err != nil {
+				return nil, fmt.Errorf("bad placeholder at %d", i)
+			}
+			tokens = append(tokens, fakeToken{kind: '?', index: n - 1})
+			i = j
+		case c == '\'':
+			j := strings.IndexByte(query[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, fakeToken{kind: 's', text: query[i+1 : i+1+j]})
+			i += j + 2
+		case strings.HasPrefix(query[i:], "<>"), strings.HasPrefix(query[i:], ">="), strings.HasPrefix(query[i:], "<="):
+			tokens = append(tokens, fakeToken{kind: 'p', text: query[i : i+2]})
+			i += 2
+		case strings.ContainsRune("(),=<>*", rune(c)):
+			tokens = append(tokens, fakeToken{kind: 'p', text: string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// fakeParser walks the tokens of a statement
+type fakeParser struct {
+	tokens []fakeToken
+	pos    int
+	args   []driver.Value
+}
+
+func (p *fakeParser) peek() fakeToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return fakeToken{}
+}
+
+func (p *fakeParser) next() fakeToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept consumes the words or punctuation given, if next
+func (p *fakeParser) accept(texts ...string) bool {
+	for i, text := range texts {
+		if p.pos+i >= len(p.tokens) || p.tokens[p.pos+i].kind == 's' || !strings.EqualFold(p.tokens[p.pos+i].text, text) {
+			return false
+		}
+	}
+	p.pos += len(texts)
+	return true
+}
+
+func (p *fakeParser) expect(texts ...string) error {
+	if !p.accept(texts...) {
+		return fmt.Errorf("expected %s at token %d (%q)", strings.Join(texts, " "), p.pos, p.peek().text)
+	}
+	return nil
+}
+
+func (p *fakeParser) word() (string, error) {
+	t := p.next()
+	if t.kind != 'w' {
+		return "", fmt.Errorf("expected a name at token %d (%q)", p.pos-1, t.text)
+	}
+	return t.text, nil
+}
+
+// words parses a parenthesized list of names
+func (p *fakeParser) words() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if p.accept(")") {
+			return names, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// value parses a literal or placeholder
+func (p *fakeParser) value() (driver.Value, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.text, nil
+	case 'n':
+		n, _ := strconv.ParseInt(t.text, 10, 64)
+		return n, nil
+	case '?':
+		if t.index >= len(p.args) {
+			return nil, fmt.Errorf("missing argument %d", t.index+1)
+		}
+		return p.args[t.index], nil
+	}
+	return nil, fmt.Errorf("expected a value at token %d (%q)", p.pos-1, t.text)
+}
+
+// fakeCond is a parsed WHERE clause
+type fakeCond func(row map[string]driver.Value) bool
+
+func (p *fakeParser) or(t *fakeTable) (fakeCond, error) {
+	left, err := p.and(t)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.and(t)
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]driver.Value) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *fakeParser) and(t *fakeTable) (fakeCond, error) {
+	left, err := p.comparison(t)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.comparison(t)
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]driver.Value) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *fakeParser) comparison(t *fakeTable) (fakeCond, error) {
+	if p.accept("(") {
+		cond, err := p.or(t)
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+	col, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	if !t.hasColumn(col) {
+		return nil, fmt.Errorf("no such column: %s", col)
+	}
+	op := p.peek()
+	switch op.text {
+	case "=", "<>", ">=", "<=", "<", ">":
+		p.next()
+	default:
+		return func(row map[string]driver.Value) bool { return row[col] == true }, nil
+	}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return func(row map[string]driver.Value) bool {
+		c := compareValues(row[col], value)
+		switch op.text {
+		case "=":
+			return c == 0
+		case "<>":
+			return c != 0
+		case ">=":
+			return c >= 0
+		case "<=":
+			return c <= 0
+		case "<":
+			return c < 0
+		}
+		return c > 0
+	}, nil
+}
+
+func compareValues(a, b driver.Value) int {
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(as, bs)
+		}
+	}
+	if a == b {
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// run executes query, returning the rows of a SELECT and the rows an
+// INSERT or UPDATE affected
+func (db *fakeDB) run(query string, args []driver.Value) (*fakeRows, int64, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &fakeParser{tokens: tokens, args: args}
+	if p.accept("UPDATE") && db.beforeUpdate != nil {
+		db.beforeUpdate(db)
+	}
+	p.pos = 0
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	table := func() (*fakeTable, error) {
+		name, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		t, ok := db.tables[name]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", name)
+		}
+		return t, nil
+	}
+
+	switch {
+	case p.accept("CREATE", "TABLE", "IF", "NOT", "EXISTS"):
+		name, err := p.word()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, 0, err
+		}
+		t := &fakeTable{}
+		for {
+			col, err := p.word()
+			if err != nil {
+				return nil, 0, err
+			}
+			t.columns = append(t.columns, col)
+			for p.peek().text != "," && p.peek().text != ")" {
+				if p.next().kind == 0 {
+					return nil, 0, fmt.Errorf("unterminated column list")
+				}
+			}
+			if p.accept(")") {
+				break
+			}
+			p.next()
+		}
+		if _, ok := db.tables[name]; !ok {
+			db.tables[name] = t
+		}
+		return nil, 0, nil
+
+	case p.accept("CREATE", "INDEX", "IF", "NOT", "EXISTS"):
+		if _, err := p.word(); err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect("ON"); err != nil {
+			return nil, 0, err
+		}
+		t, err := table()
+		if err != nil {
+			return nil, 0, err
+		}
+		cols, err := p.words()
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, col := range cols {
+			if !t.hasColumn(col) {
+				return nil, 0, fmt.Errorf("no such column: %s", col)
+			}
+		}
+		return nil, 0, nil
+
+	case p.accept("ALTER", "TABLE"):
+		t, err := table()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect("ADD", "COLUMN"); err != nil {
+			return nil, 0, err
+		}
+		col, err := p.word()
+		if err != nil {
+			return nil, 0, err
+		}
+		if t.hasColumn(col) {
+			return nil, 0, fmt.Errorf("duplicate column name: %s", col)
+		}
+		var def driver.Value
+		for p.peek().kind != 0 {
+			if p.accept("DEFAULT") {
+				if def, err = p.value(); err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			p.next()
+		}
+		t.columns = append(t.columns, col)
+		for _, row := range t.rows {
+			row[col] = def
+		}
+		return nil, 0, nil
+
+	case p.accept("INSERT", "INTO"):
+		t, err := table()
+		if err != nil {
+			return nil, 0, err
+		}
+		cols, err := p.words()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect("VALUES", "("); err != nil {
+			return nil, 0, err
+		}
+		row := make(map[string]driver.Value)
+		for i, col := range cols {
+			if !t.hasColumn(col) {
+				return nil, 0, fmt.Errorf("table %s has no column named %s", TableName, col)
+			}
+			if i > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, 0, err
+				}
+			}
+			if row[col], err = p.value(); err != nil {
+				return nil, 0, err
+			}
+		}
+		if err := p.expect(")", "ON", "CONFLICT", "(", "id", ")", "DO", "UPDATE", "SET"); err != nil {
+			return nil, 0, err
+		}
+		var updates []string
+		for {
+			col, err := p.word()
+			if err != nil {
+				return nil, 0, err
+			}
+			if err := p.expect("=", "excluded."+col); err != nil {
+				return nil, 0, err
+			}
+			updates = append(updates, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		for _, existing := range t.rows {
+			if existing["id"] == row["id"] {
+				for _, col := range updates {
+					existing[col] = row[col]
+				}
+				return nil, 1, nil
+			}
+		}
+		for _, col := range t.columns {
+			if _, ok := row[col]; !ok {
+				row[col] = ""
+			}
+		}
+		t.rows = append(t.rows, row)
+		return nil, 1, nil
+
+	case p.accept("UPDATE"):
+		t, err := table()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect("SET"); err != nil {
+			return nil, 0, err
+		}
+		set := make(map[string]driver.Value)
+		for {
+			col, err := p.word()
+			if err != nil {
+				return nil, 0, err
+			}
+			if !t.hasColumn(col) {
+				return nil, 0, fmt.Errorf("no such column: %s", col)
+			}
+			if err := p.expect("="); err != nil {
+				return nil, 0, err
+			}
+			if set[col], err = p.value(); err != nil {
+				return nil, 0, err
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect("WHERE"); err != nil {
+			return nil, 0, err
+		}
+		cond, err := p.or(t)
+		if err != nil {
+			return nil, 0, err
+		}
+		var n int64
+		for _, row := range t.rows {
+			if cond(row) {
+				for col, v := range set {
+					row[col] = v
+				}
+				n++
+			}
+		}
+		return nil, n, nil
+
+	case p.accept("SELECT"):
+		var cols []string
+		for {
+			col, err := p.word()
+			if err != nil {
+				return nil, 0, err
+			}
+			cols = append(cols, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect("FROM"); err != nil {
+			return nil, 0, err
+		}
+		t, err := table()
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, col := range cols {
+			if !t.hasColumn(col) {
+				return nil, 0, fmt.Errorf("no such column: %s", col)
+			}
+		}
+		cond := fakeCond(func(map[string]driver.Value) bool { return true })
+		if p.accept("WHERE") {
+			if cond, err = p.or(t); err != nil {
+				return nil, 0, err
+			}
+		}
+		var rows []map[string]driver.Value
+		for _, row := range t.rows {
+			if cond(row) {
+				rows = append(rows, row)
+			}
+		}
+		if p.accept("ORDER", "BY") {
+			type key struct {
+				col  string
+				desc bool
+			}
+			var keys []key
+			for {
+				col, err := p.word()
+				if err != nil {
+					return nil, 0, err
+				}
+				k := key{col: col, desc: p.accept("DESC")}
+				keys = append(keys, k)
+				if !p.accept(",") {
+					break
+				}
+			}
+			sort.SliceStable(rows, func(i, j int) bool {
+				for _, k := range keys {
+					if c := compareValues(rows[i][k.col], rows[j][k.col]); c != 0 {
+						return (c < 0) != k.desc
+					}
+				}
+				return false
+			})
+		}
+		limit, offset := int64(len(rows)), int64(0)
+		if p.accept("LIMIT") {
+			v, err := p.value()
+			if err != nil {
+				return nil, 0, err
+			}
+			limit = v.(int64)
+		}
+		if p.accept("OFFSET") {
+			v, err := p.value()
+			if err != nil {
+				return nil, 0, err
+			}
+			offset = v.(int64)
+		}
+		rows = rows[min(offset, int64(len(rows))):]
+		rows = rows[:min(limit, int64(len(rows)))]
+
+		result := &fakeRows{columns: cols}
+		for _, row := range rows {
+			values := make([]driver.Value, len(cols))
+			for i, col := range cols {
+				values[i] = row[col]
+			}
+			result.values = append(result.values, values)
+		}
+		return result, 0, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported statement: %.40s", query)
+}
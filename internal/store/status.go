@@ -0,0 +1,116 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Status is the stage of a record in the accounts payable workflow
+type Status string
+
+const (
+	StatusReceived  Status = "received"  // Document in, no invoice read from it yet
+	StatusExtracted Status = "extracted" // Invoice read, with findings or flagged for review
+	StatusValidated Status = "validated" // Invoice read and passed validation
+	StatusReviewed  Status = "reviewed"  // Checked or corrected by a reviewer
+	StatusApproved  Status = "approved"  // Approved for payment
+	StatusCancelled Status = "cancelled" // Dropped from the workflow, such as a cancelled invoice
+	StatusAdjusted  Status = "adjusted"  // Superseded by an adjustment or credit note
+)
+
+// ErrInvalidTransition is returned when moving a record to a status its
+// current one doesn't lead to
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses each status may move to. Cancelled is
+// final.
+var transitions = map[Status][]Status{
+	StatusReceived:  {StatusExtracted, StatusValidated, StatusReviewed, StatusCancelled},
+	StatusExtracted: {StatusValidated, StatusReviewed, StatusCancelled},
+	StatusValidated: {StatusReviewed, StatusApproved, StatusCancelled},
+	StatusReviewed:  {StatusApproved, StatusCancelled},
+	StatusApproved:  {StatusAdjusted, StatusCancelled},
+	StatusAdjusted:  {StatusCancelled},
+}
+
+// ParseStatus returns the status named s
+func ParseStatus(s string) (Status, error) {
+	status := Status(s)
+	if _, ok := transitions[status]; !ok && status != StatusCancelled {
+		return "", fmt.Errorf("unknown status %q", s)
+	}
+	return status, nil
+}
+
+// CanTransition reports whether a record may move from one status to another
+func CanTransition(from, to Status) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// StatusChange is an entry of the status history of a record
+type StatusChange struct {
+	From  Status    `json:"from,omitempty"` // Empty for the status a record was saved with
+	To    Status    `json:"to"`
+	At    time.Time `json:"at"`
+	Actor string    `json:"actor,omitempty"` // Reviewer or system that made the change
+	Note  string    `json:"note,omitempty"`
+}
+
+// resultStatus is the status of a record of result: received when no
+// invoice was read, validated when it needs no review and has no errors
+func resultStatus(rec *Record) Status {
+	switch {
+	case rec.Invoice == nil:
+		return StatusReceived
+	case rec.NeedsReview:
+		return StatusExtracted
+	}
+	for _, f := range rec.Findings {
+		if f.Severity == processor.SeverityError {
+			return StatusExtracted
+		}
+	}
+	return StatusValidated
+}
+
+// status returns the status of rec, derived for records saved before
+// statuses were kept
+func (r *Record) status() Status {
+	switch {
+	case r.Status != "":
+		return r.Status
+	case r.ReviewedBy != "":
+		return StatusReviewed
+	}
+	return resultStatus(r)
+}
+
+// transition moves rec to status to, adding the change to its history
+func transition(rec *Record, to Status, actor, note string, now time.Time) error {
+	from := rec.status()
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+	rec.Status = to
+	rec.History = append(rec.History, StatusChange{From: from, To: to, At: now, Actor: actor, Note: note})
+	return nil
+}
+
+// review moves rec to reviewed by reviewer; reviewing it again keeps its
+// status and history
+func review(rec *Record, reviewer string, now time.Time) error {
+	if rec.status() != StatusReviewed {
+		if err := transition(rec, StatusReviewed, reviewer, "", now); err != nil {
+			return err
+		}
+	}
+	rec.ReviewedBy = reviewer
+	rec.ReviewedAt = now
+	rec.ClaimedBy = ""
+	rec.ClaimedAt = time.Time{}
+	return nil
+}
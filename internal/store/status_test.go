@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+func TestNewRecord_Status(t *testing.T) {
+	assert.Equal(t, store.StatusValidated, store.NewRecord("a.xml", invoiceResult("1", time.Time{}, 0.95), 0.7).Status)
+	assert.Equal(t, store.StatusExtracted, store.NewRecord("a.xml", invoiceResult("1", time.Time{}, 0.5), 0.7).Status)
+
+	result := invoiceResult("1", time.Time{}, 0.95)
+	result.Findings = []processor.ValidationFinding{{Message: "totals don't add up", Severity: processor.SeverityError}}
+	assert.Equal(t, store.StatusExtracted, store.NewRecord("a.xml", result, 0.7).Status)
+
+	rec := store.NewRecord("notes.txt", &processor.Result{Error: errors.New("unsupported file format")}, 0.7)
+	assert.Equal(t, store.StatusReceived, rec.Status)
+}
+
+func TestParseStatus(t *testing.T) {
+	status, err := store.ParseStatus("cancelled")
+	require.NoError(t, err)
+	assert.Equal(t, store.StatusCancelled, status)
+	_, err = store.ParseStatus("paid")
+	assert.Error(t, err)
+
+	assert.True(t, store.CanTransition(store.StatusReviewed, store.StatusApproved))
+	assert.False(t, store.CanTransition(store.StatusExtracted, store.StatusApproved), "extractions with findings are reviewed first")
+	assert.False(t, store.CanTransition(store.StatusCancelled, store.StatusReceived))
+}
+
+func TestMemoryStore_SetStatus(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	rec := store.NewRecord("scan.pdf", invoiceResult("1", time.Time{}, 0.5), 0.7)
+	require.NoError(t, s.SaveResult(ctx, rec))
+
+	_, err := s.SetStatus(ctx, rec.ID, store.StatusApproved, "alice", "")
+	assert.ErrorIs(t, err, store.ErrInvalidTransition)
+	_, err = s.SetStatus(ctx, "missing", store.StatusApproved, "alice", "")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	require.NoError(t, s.MarkReviewed(ctx, rec.ID, "alice"))
+	require.NoError(t, s.MarkReviewed(ctx, rec.ID, "alice"), "reviewing again keeps the status")
+	got, err := s.SetStatus(ctx, rec.ID, store.StatusApproved, "bob", "PO 4711")
+	require.NoError(t, err)
+	assert.Equal(t, store.StatusApproved, got.Status)
+
+	require.Len(t, got.History, 3)
+	assert.Equal(t, store.StatusChange{To: store.StatusExtracted, At: rec.CreatedAt}, got.History[0])
+	assert.Equal(t, store.StatusExtracted, got.History[1].From)
+	assert.Equal(t, store.StatusReviewed, got.History[1].To)
+	assert.Equal(t, "alice", got.History[1].Actor)
+	assert.Equal(t, store.StatusChange{From: store.StatusReviewed, To: store.StatusApproved, At: got.History[2].At, Actor: "bob", Note: "PO 4711"}, got.History[2])
+	assert.False(t, got.History[2].At.Before(got.History[1].At))
+
+	assert.ErrorIs(t, s.MarkReviewed(ctx, rec.ID, "alice"), store.ErrInvalidTransition, "approved records are past review")
+	approved, err := s.Query(ctx, store.Query{Status: store.StatusApproved})
+	require.NoError(t, err)
+	assert.Len(t, approved, 1)
+	reviewed, err := s.Query(ctx, store.Query{Status: store.StatusReviewed})
+	require.NoError(t, err)
+	assert.Empty(t, reviewed)
+}
@@ -0,0 +1,380 @@
+// Package store persists processing results so consumers don't each write
+// their own database layer
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// ErrNotFound is returned for an unknown record ID
+var ErrNotFound = errors.New("record not found")
+
+// Record is one persisted document result
+type Record struct {
+	ID         string `json:"id"`
+	DocumentID string `json:"document_id,omitempty"` // File path, message ID or upload name
+	Source     string `json:"source,omitempty"`      // Archive member or attachment (see processor.Result.Source)
+
+	CorrelationID string `json:"correlation_id,omitempty"` // Tags the log records of the document
+	Tenant        string `json:"tenant,omitempty"`         // See processor.WithTenants
+
+	Invoice     *model.Invoice                `json:"invoice,omitempty"`
+	Method      string                        `json:"method,omitempty"`
+	Confidence  float64                       `json:"confidence"`
+	Warnings    []string                      `json:"warnings,omitempty"`
+	Findings    []processor.ValidationFinding `json:"findings,omitempty"`
+	Vendor      *processor.VendorMatch        `json:"vendor,omitempty"`
+	Fingerprint string                        `json:"fingerprint,omitempty"`
+	Duplicate   bool                          `json:"duplicate,omitempty"`
+	Error       string                        `json:"error,omitempty"`
+	ErrorClass  string                        `json:"error_class,omitempty"` // See processor.ErrorClass
+
+	NeedsReview bool      `json:"needs_review,omitempty"`
+	ReviewedBy  string    `json:"reviewed_by,omitempty"`
+	ReviewedAt  time.Time `json:"reviewed_at,omitzero"`
+	ClaimedBy   string    `json:"claimed_by,omitempty"`
+	ClaimedAt   time.Time `json:"claimed_at,omitzero"`
+
+	// Status is the stage of the record in the AP workflow, and History
+	// the changes that led to it (see Store.SetStatus)
+	Status  Status         `json:"status,omitempty"`
+	History []StatusChange `json:"history,omitempty"`
+
+	// Kept for records that need review: the source document and where the
+	// fields of the invoice were read
+	Artifact   *Artifact         `json:"artifact,omitempty"`
+	Provenance []FieldProvenance `json:"provenance,omitempty"`
+
+	// Extracted is the invoice as extracted, once a reviewer replaced it
+	// with a corrected one (see Store.Correct)
+	Extracted *model.Invoice `json:"extracted,omitempty"`
+
+	// Changes are the fields the reviewer corrected in Extracted
+	Changes []model.FieldChange `json:"changes,omitempty"`
+
+	// Attempts are the runs of a failed document, the first one included,
+	// once it was replayed (see Replay)
+	Attempts []Attempt `json:"attempts,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Query filters records. Zero fields don't filter, except Tenant: a query
+// only returns the records of its tenant, those without one when empty,
+// unless AllTenants is set.
+type Query struct {
+	Tenant      string
+	AllTenants  bool // For callers serving every tenant, such as admin tools
+	SellerTaxID string
+	Fingerprint string
+	DocumentID  string
+	From, To    time.Time // Invoice date range, inclusive
+
+	// PendingReview selects records that need review and have not been
+	// marked reviewed
+	PendingReview bool
+
+	// Failed selects quarantined records: documents that failed, other than
+	// those skipped as not invoices. ErrorClass narrows them to a class of
+	// processor.ErrorClass.
+	Failed     bool
+	ErrorClass string
+
+	Status Status // Current status
+
+	Limit  int // Default: 100
+	Offset int
+}
+
+// DefaultQueryLimit caps a query without a Limit
+const DefaultQueryLimit = 100
+
+// Store persists records. Implementations must be safe for concurrent use.
+type Store interface {
+	// SaveResult stores rec, assigning its ID and CreatedAt when unset. A
+	// record with an existing ID is replaced.
+	SaveResult(ctx context.Context, rec *Record) error
+
+	// GetByID returns the record with id, or ErrNotFound
+	GetByID(ctx context.Context, id string) (*Record, error)
+
+	// Query returns matching records, newest first
+	Query(ctx context.Context, q Query) ([]*Record, error)
+
+	// MarkReviewed records that reviewer checked the record with id, moves
+	// it to StatusReviewed and releases its claim. It returns
+	// ErrInvalidTransition once the record is past review.
+	MarkReviewed(ctx context.Context, id, reviewer string) error
+
+	// Claim assigns the record with id to reviewer for ClaimTimeout and
+	// returns it. It returns ErrClaimed while another reviewer holds it, and
+	// ErrReviewed once it was reviewed.
+	Claim(ctx context.Context, id, reviewer string) (*Record, error)
+
+	// Correct replaces the invoice of the record with id by inv, keeping
+	// the extracted one in Extracted, and marks it reviewed by reviewer. It
+	// returns ErrClaimed while another reviewer holds it, and
+	// ErrInvalidTransition once the record is past review.
+	Correct(ctx context.Context, id, reviewer string, inv *model.Invoice) error
+
+	// SetStatus moves the record with id to status, recording actor and
+	// note in its history, and returns it. It returns ErrInvalidTransition
+	// when its current status doesn't lead to status.
+	SetStatus(ctx context.Context, id string, status Status, actor, note string) (*Record, error)
+}
+
+// NewRecord converts a pipeline result. Results below reviewThreshold,
+// with handwriting, duplicates and failures need review; they keep the
+// document read by Process (Result.Data) and the provenance of their fields.
+func NewRecord(documentID string, result *processor.Result, reviewThreshold float64) *Record {
+	rec := &Record{
+		DocumentID:  documentID,
+		Source:      result.Source,
+		Invoice:     result.Invoice,
+		Method:      string(result.Method),
+		Confidence:  result.Confidence,
+		Warnings:    result.Warnings,
+		Findings:    result.Findings,
+		Vendor:      result.Vendor,
+		Fingerprint: result.Fingerprint,
+		Duplicate:   result.Duplicate,
+		NeedsReview: result.Confidence < reviewThreshold || result.HasHandwriting || result.Duplicate,
+
+		CorrelationID: result.CorrelationID,
+		Tenant:        result.Tenant,
+	}
+	if result.Error != nil {
+		rec.Invoice = nil
+		rec.Error = result.Error.Error()
+		rec.NeedsReview = !errors.Is(result.Error, processor.ErrSkipped)
+		if rec.NeedsReview {
+			rec.ErrorClass = processor.ErrorClass(result.Error)
+		}
+	}
+	if rec.NeedsReview {
+		name := result.Source
+		if name == "" {
+			name = documentID
+		}
+		rec.Artifact = newArtifact(name, result.Data)
+		rec.Provenance = fieldProvenance(rec.Invoice)
+	}
+	rec.Status = resultStatus(rec)
+	return rec
+}
+
+// prepare assigns the ID, creation time and status of a new record
+func prepare(rec *Record) {
+	if rec.ID == "" {
+		rec.ID = newID()
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	rec.Status = rec.status()
+	if len(rec.History) == 0 {
+		rec.History = []StatusChange{{To: rec.Status, At: rec.CreatedAt}}
+	}
+}
+
+// newID returns a random 128-bit hex ID
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// invoiceDate is the date a query's range applies to
+func (r *Record) invoiceDate() time.Time {
+	if r.Invoice == nil {
+		return time.Time{}
+	}
+	return r.Invoice.Date
+}
+
+// matches reports whether rec passes the filters of q
+func (q Query) matches(rec *Record) bool {
+	switch {
+	case !q.AllTenants && rec.Tenant != q.Tenant:
+		return false
+	case q.SellerTaxID != "" && (rec.Invoice == nil || rec.Invoice.Seller.TaxID != q.SellerTaxID):
+		return false
+	case q.Fingerprint != "" && rec.Fingerprint != q.Fingerprint:
+		return false
+	case q.DocumentID != "" && rec.DocumentID != q.DocumentID:
+		return false
+	case !q.From.IsZero() && rec.invoiceDate().Before(q.From):
+		return false
+	case !q.To.IsZero() && (rec.invoiceDate().IsZero() || rec.invoiceDate().After(q.To)):
+		return false
+	case q.PendingReview && (!rec.NeedsReview || rec.ReviewedBy != ""):
+		return false
+	case q.Failed && rec.ErrorClass == "":
+		return false
+	case q.ErrorClass != "" && rec.ErrorClass != q.ErrorClass:
+		return false
+	case q.Status != "" && rec.status() != q.Status:
+		return false
+	}
+	return true
+}
+
+// limit returns the effective page size
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	return q.Limit
+}
+
+// MemoryStore keeps records in memory, for tests and single-process tools
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+// SaveResult implements Store
+func (s *MemoryStore) SaveResult(_ context.Context, rec *Record) error {
+	prepare(rec)
+	saved := *rec
+	s.mu.Lock()
+	s.records[rec.ID] = &saved
+	s.mu.Unlock()
+	return nil
+}
+
+// GetByID implements Store
+func (s *MemoryStore) GetByID(_ context.Context, id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *rec
+	return &found, nil
+}
+
+// Query implements Store
+func (s *MemoryStore) Query(_ context.Context, q Query) ([]*Record, error) {
+	s.mu.RLock()
+	var records []*Record
+	for _, rec := range s.records {
+		if q.matches(rec) {
+			found := *rec
+			records = append(records, &found)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.After(records[j].CreatedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+	if q.Offset >= len(records) {
+		return nil, nil
+	}
+	records = records[q.Offset:]
+	return records[:min(len(records), q.limit())], nil
+}
+
+// MarkReviewed implements Store
+func (s *MemoryStore) MarkReviewed(_ context.Context, id, reviewer string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	return review(rec, reviewer, time.Now().UTC())
+}
+
+// Claim implements Store
+func (s *MemoryStore) Claim(_ context.Context, id, reviewer string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if err := checkClaim(rec, reviewer, now); err != nil {
+		return nil, err
+	}
+	rec.ClaimedBy = reviewer
+	rec.ClaimedAt = now
+	claimed := *rec
+	return &claimed, nil
+}
+
+// Correct implements Store
+func (s *MemoryStore) Correct(_ context.Context, id, reviewer string, inv *model.Invoice) error {
+	if inv == nil {
+		return errors.New("no corrected invoice")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	if claimedByOther(rec, reviewer, now) {
+		return ErrClaimed
+	}
+	return applyCorrection(rec, reviewer, inv, now)
+}
+
+// SetStatus implements Store
+func (s *MemoryStore) SetStatus(_ context.Context, id string, status Status, actor, note string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := transition(rec, status, actor, note, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	found := *rec
+	return &found, nil
+}
+
+// Remember implements processor.DuplicateStore over the saved records: a
+// fingerprint is known once a record carrying it was saved
+func (s *MemoryStore) Remember(ctx context.Context, fp, _ string) (string, bool, error) {
+	tenant := processor.TenantFromContext(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var first *Record
+	for _, rec := range s.records {
+		if rec.Fingerprint == fp && rec.Tenant == tenant && (first == nil || rec.CreatedAt.Before(first.CreatedAt)) {
+			first = rec
+		}
+	}
+	if first == nil {
+		return "", false, nil
+	}
+	return first.DocumentID, true, nil
+}
+
+var (
+	_ Store                    = (*MemoryStore)(nil)
+	_ processor.DuplicateStore = (*MemoryStore)(nil)
+)
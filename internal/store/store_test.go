@@ -0,0 +1,145 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+)
+
+func invoiceResult(number string, date time.Time, confidence float64) *processor.Result {
+	inv := &model.Invoice{
+		Number:      number,
+		Date:        date,
+		Seller:      model.Party{TaxID: "0123456789"},
+		TotalAmount: decimal.NewFromInt(216000),
+	}
+	return &processor.Result{Invoice: inv, Method: processor.MethodXML, Confidence: confidence, Fingerprint: inv.Fingerprint()}
+}
+
+func TestNewRecord(t *testing.T) {
+	rec := store.NewRecord("a.xml", invoiceResult("1", time.Time{}, 0.95), 0.7)
+	assert.Equal(t, "a.xml", rec.DocumentID)
+	assert.Equal(t, "xml", rec.Method)
+	assert.NotEmpty(t, rec.Fingerprint)
+	assert.False(t, rec.NeedsReview)
+
+	assert.True(t, store.NewRecord("a.xml", invoiceResult("1", time.Time{}, 0.5), 0.7).NeedsReview)
+
+	rec = store.NewRecord("notes.txt", &processor.Result{Error: errors.New("unsupported file format")}, 0.7)
+	assert.Equal(t, "unsupported file format", rec.Error)
+	assert.True(t, rec.NeedsReview)
+
+	rec = store.NewRecord("x.zip", &processor.Result{Error: processor.ErrSkipped}, 0.7)
+	assert.False(t, rec.NeedsReview)
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+
+	march := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	first := store.NewRecord("portal/1.xml", invoiceResult("1", march, 1), 0.7)
+	require.NoError(t, s.SaveResult(ctx, first))
+	require.NotEmpty(t, first.ID)
+	require.False(t, first.CreatedAt.IsZero())
+
+	second := store.NewRecord("email/2.pdf", invoiceResult("2", march.AddDate(0, 1, 0), 0.5), 0.7)
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+	require.NoError(t, s.SaveResult(ctx, second))
+
+	got, err := s.GetByID(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1", got.Invoice.Number)
+
+	_, err = s.GetByID(ctx, "missing")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	records, err := s.Query(ctx, store.Query{SellerTaxID: "0123456789"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, second.ID, records[0].ID, "newest first")
+
+	records, err = s.Query(ctx, store.Query{From: march.AddDate(0, 0, 1)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, second.ID, records[0].ID)
+
+	records, err = s.Query(ctx, store.Query{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, first.ID, records[0].ID)
+
+	records, err = s.Query(ctx, store.Query{PendingReview: true})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.NoError(t, s.MarkReviewed(ctx, second.ID, "alice"))
+	records, err = s.Query(ctx, store.Query{PendingReview: true})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	got, err = s.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.ReviewedBy)
+	assert.False(t, got.ReviewedAt.IsZero())
+	assert.ErrorIs(t, s.MarkReviewed(ctx, "missing", "alice"), store.ErrNotFound)
+}
+
+func TestMemoryStore_DuplicateStore(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	p := processor.NewPipeline(processor.WithDuplicateStore(s))
+	xmlData := []byte(`<?xml version="1.0"?><Invoice><InvoiceNo>42</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`)
+
+	result := p.ProcessXMLBytes(ctx, xmlData)
+	require.NoError(t, result.Error)
+	assert.False(t, result.Duplicate)
+	require.NoError(t, s.SaveResult(ctx, store.NewRecord("portal/42.xml", result, 0.7)))
+
+	result = p.ProcessXMLBytes(ctx, xmlData)
+	assert.True(t, result.Duplicate)
+	assert.Equal(t, "portal/42.xml", result.DuplicateOf)
+}
+
+func TestMemoryStore_Tenants(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	p := processor.NewPipeline(
+		processor.WithDuplicateStore(s),
+		processor.WithTenants(map[string]processor.Tenant{"acme": {}, "globex": {}}),
+	)
+	xmlData := []byte(`<?xml version="1.0"?><Invoice><InvoiceNo>42</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>216000</TotalAmount></Invoice>`)
+
+	acme := processor.ContextWithTenant(ctx, "acme")
+	result := p.ProcessXMLBytes(acme, xmlData)
+	require.NoError(t, result.Error)
+	rec := store.NewRecord("portal/42.xml", result, 0.7)
+	assert.Equal(t, "acme", rec.Tenant)
+	require.NoError(t, s.SaveResult(ctx, rec))
+
+	result = p.ProcessXMLBytes(processor.ContextWithTenant(ctx, "globex"), xmlData)
+	assert.False(t, result.Duplicate, "fingerprints are per tenant")
+	result = p.ProcessXMLBytes(acme, xmlData)
+	assert.True(t, result.Duplicate)
+
+	records, err := s.Query(ctx, store.Query{Tenant: "acme"})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+	records, err = s.Query(ctx, store.Query{Tenant: "globex"})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	records, err = s.Query(ctx, store.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, records, "an empty tenant is a tenant, not a wildcard")
+	records, err = s.Query(ctx, store.Query{AllTenants: true})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
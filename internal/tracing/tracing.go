@@ -0,0 +1,96 @@
+// Package tracing lets the pipeline, PDF extractor and LLM client report
+// spans to an existing tracing stack. Tracer and Span follow the shape of
+// OpenTelemetry's trace.Tracer and trace.Span, so an adapter to an OTel
+// tracer is a few lines, and nothing is traced until one is set.
+package tracing
+
+import (
+	"context"
+)
+
+// Attribute is a key/value pair attached to a span. Values are strings,
+// ints, int64s, float64s or bools.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int64 returns an integer attribute
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Float64 returns a floating point attribute
+func Float64(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// Tracer starts spans. The returned context carries the span so spans
+// started from it become its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is one timed operation. End must be called once; the other methods
+// are ignored after it.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type tracerKey struct{}
+type spanKey struct{}
+
+// ContextWithTracer traces the work done with ctx with t
+func ContextWithTracer(ctx context.Context, t Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// TracerFromContext returns the tracer set with ContextWithTracer, or nil
+func TracerFromContext(ctx context.Context) Tracer {
+	t, _ := ctx.Value(tracerKey{}).(Tracer)
+	return t
+}
+
+// Start starts a span with the tracer of ctx. Without one it returns ctx
+// and a span that does nothing.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t := TracerFromContext(ctx)
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := t.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the span last started with Start on ctx, or a span
+// that does nothing
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// End records err, when set, and ends span
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
@@ -0,0 +1,68 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/tracing"
+)
+
+type recordedSpan struct {
+	name   string
+	attrs  map[string]any
+	err    error
+	ended  bool
+	parent *recordedSpan
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...tracing.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+type parentKey struct{}
+
+type recorder struct{ spans []*recordedSpan }
+
+func (r *recorder) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	span := &recordedSpan{name: name, attrs: map[string]any{}}
+	span.parent, _ = ctx.Value(parentKey{}).(*recordedSpan)
+	span.SetAttributes(attrs...)
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, parentKey{}, span), span
+}
+
+func TestStart_NoTracer(t *testing.T) {
+	ctx := context.Background()
+	got, span := tracing.Start(ctx, "work")
+	assert.Equal(t, ctx, got)
+	tracing.End(span, errors.New("ignored"))
+	tracing.SpanFromContext(ctx).SetAttributes(tracing.String("ignored", "yes"))
+	assert.Nil(t, tracing.TracerFromContext(tracing.ContextWithTracer(ctx, nil)))
+}
+
+func TestStart_Nesting(t *testing.T) {
+	rec := &recorder{}
+	ctx := tracing.ContextWithTracer(context.Background(), rec)
+
+	ctx, outer := tracing.Start(ctx, "outer", tracing.Int("pages", 2))
+	innerCtx, inner := tracing.Start(ctx, "inner")
+	tracing.SpanFromContext(innerCtx).SetAttributes(tracing.Bool("cached", true))
+	tracing.End(inner, errors.New("timeout"))
+	tracing.End(outer, nil)
+
+	assert.Len(t, rec.spans, 2)
+	o, i := rec.spans[0], rec.spans[1]
+	assert.Same(t, o, i.parent)
+	assert.Equal(t, 2, o.attrs["pages"])
+	assert.Equal(t, true, i.attrs["cached"])
+	assert.EqualError(t, i.err, "timeout")
+	assert.NoError(t, o.err)
+	assert.True(t, o.ended && i.ended)
+}
@@ -0,0 +1,155 @@
+// Package uom maps the free-text units of measure of line items ("cái",
+// "Chiếc", "kilôgam") to UN/ECE codes, so quantities can be added up across
+// suppliers.
+package uom
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+)
+
+// UN/ECE Recommendation 20 and 21 codes of the units common on invoices
+const (
+	Piece        = "C62"
+	Set          = "SET"
+	Pair         = "PR"
+	Kilogram     = "KGM"
+	Gram         = "GRM"
+	Tonne        = "TNE"
+	Litre        = "LTR"
+	Millilitre   = "MLT"
+	Metre        = "MTR"
+	Centimetre   = "CMT"
+	Millimetre   = "MMT"
+	Kilometre    = "KMT"
+	SquareMetre  = "MTK"
+	CubicMetre   = "MTQ"
+	Box          = "BX"
+	Carton       = "CT"
+	Pack         = "PK"
+	Bag          = "BG"
+	Bottle       = "BO"
+	Can          = "CA"
+	Roll         = "RO"
+	Bundle       = "BE"
+	Hour         = "HUR"
+	Day          = "DAY"
+	Month        = "MON"
+	Year         = "ANN"
+	KilowattHour = "KWH"
+)
+
+// DefaultMapping maps the units invoices are written with, in Vietnamese
+// and English, to their codes. Units match ignoring case, spacing and a
+// trailing period, and without diacritics unless that makes them
+// ambiguous: "Cai" is "cái", but "bo" is "bộ" (set) or "bó" (bundle).
+var DefaultMapping = map[string]string{
+	"cái": Piece, "chiếc": Piece, "con": Piece, "quả": Piece, "trái": Piece, "cây": Piece,
+	"tờ": Piece, "cuốn": Piece, "quyển": Piece, "viên": Piece, "bản": Piece,
+	"piece": Piece, "pcs": Piece, "pc": Piece, "unit": Piece, "ea": Piece, "each": Piece,
+	"bộ": Set, "set": Set,
+	"đôi": Pair, "cặp": Pair, "pair": Pair,
+	"kg": Kilogram, "kilôgam": Kilogram, "kilogam": Kilogram, "kilogram": Kilogram, "ký": Kilogram, "kí": Kilogram,
+	"g": Gram, "gam": Gram, "gram": Gram, "gr": Gram,
+	"tấn": Tonne, "tonne": Tonne, "ton": Tonne,
+	"lít": Litre, "l": Litre, "litre": Litre, "liter": Litre,
+	"ml": Millilitre,
+	"m":  Metre, "mét": Metre, "meter": Metre, "metre": Metre,
+	"cm": Centimetre,
+	"mm": Millimetre,
+	"km": Kilometre,
+	"m2": SquareMetre, "m²": SquareMetre, "mét vuông": SquareMetre,
+	"m3": CubicMetre, "m³": CubicMetre, "khối": CubicMetre, "mét khối": CubicMetre,
+	"hộp": Box, "box": Box,
+	"thùng": Carton, "carton": Carton, "ctn": Carton,
+	"gói": Pack, "pack": Pack,
+	"túi": Bag, "bao": Bag, "bag": Bag,
+	"chai": Bottle, "bottle": Bottle,
+	"lon": Can, "can": Can,
+	"cuộn": Roll, "roll": Roll,
+	"bó": Bundle, "bundle": Bundle,
+	"giờ": Hour, "hour": Hour, "hr": Hour,
+	"ngày": Day, "day": Day,
+	"tháng": Month, "month": Month,
+	"năm": Year, "year": Year,
+	"kwh": KilowattHour,
+}
+
+// Normalizer maps units of measure to codes
+type Normalizer struct {
+	exact  map[string]string // By key
+	folded map[string]string // By key without diacritics, unambiguous ones only
+}
+
+// NewNormalizer returns a normalizer of DefaultMapping with mapping, units
+// to codes, added over it. An empty code unmaps a unit.
+func NewNormalizer(mapping map[string]string) *Normalizer {
+	n := &Normalizer{exact: make(map[string]string), folded: make(map[string]string)}
+	for unit, code := range DefaultMapping {
+		n.exact[key(unit)] = code
+	}
+	for unit, code := range mapping {
+		n.exact[key(unit)] = strings.TrimSpace(code)
+	}
+
+	ambiguous := make(map[string]bool)
+	for _, k := range slices.Sorted(maps.Keys(n.exact)) {
+		if n.exact[k] == "" {
+			continue
+		}
+		f := fold(k)
+		if code, ok := n.folded[f]; ok && code != n.exact[k] {
+			ambiguous[f] = true
+		}
+		n.folded[f] = n.exact[k]
+	}
+	for f := range ambiguous {
+		delete(n.folded, f)
+	}
+	return n
+}
+
+// Code returns the code of unit, reporting whether it is known
+func (n *Normalizer) Code(unit string) (string, bool) {
+	k := key(unit)
+	if code, ok := n.exact[k]; ok {
+		return code, code != ""
+	}
+	code, ok := n.folded[fold(k)]
+	return code, ok && code != ""
+}
+
+// Normalize sets the UnitCode of the line items of inv with a known unit
+func (n *Normalizer) Normalize(inv *model.Invoice) {
+	for i := range inv.Items {
+		if code, ok := n.Code(inv.Items[i].Unit); ok {
+			inv.Items[i].UnitCode = code
+		}
+	}
+}
+
+// key lowercases a unit and drops spacing and a trailing period
+func key(unit string) string {
+	unit = strings.TrimSuffix(strings.TrimSpace(norm.NFC.String(unit)), ".")
+	return strings.ToLower(strings.Join(strings.Fields(unit), " "))
+}
+
+// fold strips Vietnamese diacritics from a key
+func fold(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == 'đ' {
+			r = 'd'
+		} else if r >= utf8.RuneSelf {
+			r, _ = utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
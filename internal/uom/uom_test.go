@@ -0,0 +1,75 @@
+package uom_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/uom"
+)
+
+func TestNormalizer_Code(t *testing.T) {
+	n := uom.NewNormalizer(nil)
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"cái", uom.Piece},
+		{"Chiếc", uom.Piece},
+		{"Cai", uom.Piece},
+		{" CÁI. ", uom.Piece},
+		{"PCS", uom.Piece},
+		{"bộ", uom.Set},
+		{"kg", uom.Kilogram},
+		{"kilôgam", uom.Kilogram},
+		{"Kilogam", uom.Kilogram},
+		{"mét  vuông", uom.SquareMetre},
+		{"thung", uom.Carton},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			code, ok := n.Code(tt.unit)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, code)
+		})
+	}
+
+	for _, unit := range []string{"", "bo", "xyz"} {
+		_, ok := n.Code(unit)
+		assert.False(t, ok, "%q", unit)
+	}
+}
+
+func TestNormalizer_Mapping(t *testing.T) {
+	n := uom.NewNormalizer(map[string]string{"Ly": uom.Piece, "bó": "", "kg": "KGS"})
+
+	code, ok := n.Code("ly")
+	assert.True(t, ok)
+	assert.Equal(t, uom.Piece, code)
+
+	code, _ = n.Code("KG")
+	assert.Equal(t, "KGS", code)
+
+	_, ok = n.Code("bó")
+	assert.False(t, ok)
+
+	// With bó unmapped, "bo" is no longer ambiguous
+	code, ok = n.Code("bo")
+	assert.True(t, ok)
+	assert.Equal(t, uom.Set, code)
+}
+
+func TestNormalizer_Normalize(t *testing.T) {
+	inv := &model.Invoice{Items: []model.LineItem{
+		{Name: "Bút bi", Unit: "Cái"},
+		{Name: "Gạo", Unit: "kilôgam"},
+		{Name: "Phí dịch vụ", Unit: "lần"},
+	}}
+	uom.NewNormalizer(nil).Normalize(inv)
+
+	assert.Equal(t, uom.Piece, inv.Items[0].UnitCode)
+	assert.Equal(t, uom.Kilogram, inv.Items[1].UnitCode)
+	assert.Empty(t, inv.Items[2].UnitCode)
+	assert.Equal(t, "Cái", inv.Items[0].Unit)
+}
@@ -0,0 +1,131 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Attempt is an earlier run of a quarantined file
+type Attempt struct {
+	ProcessedAt time.Time  `json:"processed_at"`
+	Strategies  []string   `json:"strategies,omitempty"`
+	Model       string     `json:"model,omitempty"`
+	Documents   []Document `json:"documents"`
+}
+
+// ReplayOptions changes how a quarantined file is run again. Zero fields
+// keep the pipeline's configuration.
+type ReplayOptions struct {
+	Strategies []processor.Strategy // See processor.WithStrategies
+	Model      string               // See llm.ContextWithModel
+}
+
+// Quarantined returns the reports of the files in the quarantine directory
+// of cfg, oldest first
+func Quarantined(cfg Config) ([]*Report, error) {
+	entries, err := os.ReadDir(cfg.QuarantineDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", cfg.QuarantineDir, err)
+	}
+
+	var reports []*Report
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		report, err := readReport(filepath.Join(cfg.QuarantineDir, entry.Name()))
+		if err != nil || !report.Failed { // Not a report, or not of a failure
+			continue
+		}
+		if _, err := os.Stat(report.Path); err != nil {
+			continue // Report without its file
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ProcessedAt.Before(reports[j].ProcessedAt) })
+	return reports, nil
+}
+
+// Replay runs a quarantined file through pipeline again, keeping the runs
+// before in the report. A file that no longer fails leaves the quarantine as
+// a watched file would: moved to the processed directory, if any, with its
+// report written to the output directory. One that fails again stays, with
+// its report updated for the next replay.
+func Replay(ctx context.Context, pipeline *processor.Pipeline, cfg Config, quarantined *Report, opts ReplayOptions) (*Report, error) {
+	report := &Report{
+		File:       quarantined.File,
+		Path:       quarantined.Path,
+		Strategies: strategyNames(opts.Strategies),
+		Model:      opts.Model,
+		Attempts: append(quarantined.Attempts, Attempt{
+			ProcessedAt: quarantined.ProcessedAt,
+			Strategies:  quarantined.Strategies,
+			Model:       quarantined.Model,
+			Documents:   quarantined.Documents,
+		}),
+	}
+
+	if opts.Model != "" {
+		ctx = llm.ContextWithModel(ctx, opts.Model)
+	}
+	stopped := run(ctx, pipeline, cfg, report, &processor.ProcessOptions{SplitDocuments: cfg.SplitDocuments, Strategies: opts.Strategies})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if stopped {
+		return nil, processor.ErrStopped
+	}
+
+	quarantineReport := reportPath(cfg.QuarantineDir, report.Path)
+	if report.Failed {
+		return report, writeReport(quarantineReport, report)
+	}
+
+	path := report.Path
+	if cfg.ProcessedDir != "" {
+		moved, err := moveFile(path, cfg.ProcessedDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", path, err)
+		}
+		report.Path = moved
+	}
+	out := reportPath(cfg.OutputDir, report.Path)
+	if err := writeReport(out, report); err != nil {
+		return nil, err
+	}
+	if out != quarantineReport {
+		os.Remove(quarantineReport)
+	}
+	return report, nil
+}
+
+// readReport reads the report at path, setting the path of its file
+func readReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	report.Path = strings.TrimSuffix(path, ".json")
+	return &report, nil
+}
+
+func strategyNames(strategies []processor.Strategy) []string {
+	var names []string
+	for _, s := range strategies {
+		names = append(names, string(s))
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package watcher_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/watcher"
+)
+
+// modelProvider fails requests to every model but good
+type modelProvider struct{}
+
+func (modelProvider) Name() string { return "models" }
+
+func (modelProvider) Complete(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	if req.Model != "good" {
+		return nil, &llm.APIError{StatusCode: http.StatusBadRequest, Body: "model refused the image"}
+	}
+	return &llm.Response{Content: `{"invoice_number":"0000042","total_amount":110000}`, Model: req.Model}, nil
+}
+
+func TestReplay(t *testing.T) {
+	root := t.TempDir()
+	in, out, quarantine, processed := filepath.Join(root, "in"), filepath.Join(root, "out"), filepath.Join(root, "quarantine"), filepath.Join(root, "processed")
+	require.NoError(t, os.Mkdir(in, 0o755))
+
+	extractor := llm.NewExtractor(llm.NewClient("", llm.WithProvider(modelProvider{})), llm.WithVisionModel("bad"), llm.WithRetryPolicy(llm.NoRetry))
+	pipeline := processor.NewPipeline(processor.WithLLMExtractor(extractor))
+	cfg := watcher.Config{Dirs: []string{in}, OutputDir: out, QuarantineDir: quarantine, ProcessedDir: processed}
+	w, err := watcher.New(pipeline, cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(in, "scan.jpg"), []byte("\xff\xd8\xffscanned invoice"), 0o644))
+	ctx := context.Background()
+	require.NoError(t, w.Scan(ctx))
+	require.NoError(t, w.Scan(ctx))
+
+	reports, err := watcher.Quarantined(cfg)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, filepath.Join(quarantine, "scan.jpg"), reports[0].Path)
+	assert.Equal(t, "error", reports[0].Documents[0].ErrorClass)
+
+	// Fails again: stays quarantined, with the first run kept
+	report, err := watcher.Replay(ctx, pipeline, cfg, reports[0], watcher.ReplayOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.Failed)
+	reports, err = watcher.Quarantined(cfg)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Len(t, reports[0].Attempts, 1)
+
+	report, err = watcher.Replay(ctx, pipeline, cfg, reports[0], watcher.ReplayOptions{Model: "good"})
+	require.NoError(t, err)
+	assert.False(t, report.Failed)
+	assert.Equal(t, filepath.Join(processed, "scan.jpg"), report.Path)
+
+	saved := readReport(t, filepath.Join(out, "scan.jpg.json"))
+	assert.Equal(t, "good", saved.Model)
+	assert.Equal(t, "0000042", saved.Documents[0].Invoice.Number)
+	require.Len(t, saved.Attempts, 2)
+	assert.NotEmpty(t, saved.Attempts[1].Documents[0].Error)
+
+	reports, err = watcher.Quarantined(cfg)
+	require.NoError(t, err)
+	assert.Empty(t, reports)
+	assert.NoFileExists(t, filepath.Join(quarantine, "scan.jpg.json"))
+}
@@ -0,0 +1,380 @@
+// Package watcher ingests invoice files dropped into directories
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// DefaultPollInterval is how often watched directories are scanned
+const DefaultPollInterval = 2 * time.Second
+
+// Config configures a Watcher
+type Config struct {
+	// Dirs are the directories watched for new files (not recursive)
+	Dirs []string
+
+	// OutputDir receives a <file>.json report per processed file; empty
+	// writes it next to the input
+	OutputDir string
+
+	// QuarantineDir receives inputs with a failed document, together with
+	// their <file>.json report. Archive members that are not invoices do not
+	// count as failures. Required.
+	QuarantineDir string
+
+	// ProcessedDir receives inputs processed without failures; empty leaves
+	// them in place, and the report marks them as done
+	ProcessedDir string
+
+	PollInterval   time.Duration // Directory scan interval (default: DefaultPollInterval)
+	Timeout        time.Duration // Per-file processing timeout (0 = none)
+	SplitDocuments bool          // See processor.ProcessOptions.SplitDocuments
+
+	// OnReport is called after each file is processed, for logging
+	OnReport func(report *Report)
+}
+
+// Report is the JSON record written for each processed file
+type Report struct {
+	File        string     `json:"file"`
+	ProcessedAt time.Time  `json:"processed_at"`
+	Failed      bool       `json:"failed,omitempty"`
+	Documents   []Document `json:"documents"`
+
+	// Replays of a quarantined file (see Replay) record what they changed
+	// and the runs before them, oldest first
+	Strategies []string  `json:"strategies,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Attempts   []Attempt `json:"attempts,omitempty"`
+
+	// Path is where the input was moved, or its original path
+	Path string `json:"-"`
+}
+
+// Document is the outcome of one document in a file
+type Document struct {
+	Source     string                 `json:"source,omitempty"`
+	Pages      string                 `json:"pages,omitempty"`
+	Invoice    *model.Invoice         `json:"invoice,omitempty"`
+	Vendor     *processor.VendorMatch `json:"vendor,omitempty"`
+	Method     string                 `json:"method,omitempty"`
+	Confidence float64                `json:"confidence,omitempty"`
+	Warnings   []string               `json:"warnings,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	ErrorClass string                 `json:"error_class,omitempty"` // See processor.ErrorClass
+	Skipped    bool                   `json:"skipped,omitempty"`     // Not an invoice (see processor.ErrSkipped)
+	Duplicate  bool                   `json:"duplicate,omitempty"`   // Seen before (see processor.WithDuplicateStore)
+}
+
+// Watcher polls directories and runs new files through a pipeline. A file
+// is picked up once its size and modification time hold still between two
+// scans, so files still being copied in are left alone. Hidden files,
+// partial downloads and .json reports are ignored.
+type Watcher struct {
+	pipeline *processor.Pipeline
+	cfg      Config
+
+	pending map[string]fileState // Candidates seen in the last scan
+	done    map[string]fileState // Files processed and left in place
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// New returns a watcher feeding pipeline
+func New(pipeline *processor.Pipeline, cfg Config) (*Watcher, error) {
+	if len(cfg.Dirs) == 0 {
+		return nil, errors.New("no directories to watch")
+	}
+	if cfg.QuarantineDir == "" {
+		return nil, errors.New("quarantine directory is required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	for _, dir := range []string{cfg.OutputDir, cfg.QuarantineDir, cfg.ProcessedDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	return &Watcher{
+		pipeline: pipeline,
+		cfg:      cfg,
+		pending:  make(map[string]fileState),
+		done:     make(map[string]fileState),
+	}, nil
+}
+
+// Run scans the directories until ctx is canceled. It returns nil on
+// cancellation and an error only when a directory cannot be read. A file
+// being processed when ctx is canceled is finished first; stop the pipeline
+// (see processor.Pipeline.Stop) to bound how long that takes, leaving the
+// file for the next run.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Scan(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan lists the directories once and processes the files that have not
+// changed since the previous scan
+func (w *Watcher) Scan(ctx context.Context) error {
+	seen := make(map[string]fileState)
+	for _, dir := range w.cfg.Dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || ignored(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // Removed since listing
+			}
+			path := filepath.Join(dir, entry.Name())
+			state := fileState{size: info.Size(), modTime: info.ModTime()}
+			if done, ok := w.done[path]; ok && done == state {
+				seen[path] = state
+				continue
+			}
+			if w.hasReport(path, state) {
+				w.done[path] = state
+				seen[path] = state
+				continue
+			}
+
+			if prev, ok := w.pending[path]; ok && prev == state {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err := w.processFile(ctx, path, state); err != nil {
+					return err
+				}
+				if _, err := os.Stat(path); err != nil {
+					continue // Moved away
+				}
+			}
+			seen[path] = state
+		}
+	}
+
+	// Forget files that are gone
+	for path := range w.done {
+		if _, ok := seen[path]; !ok {
+			delete(w.done, path)
+		}
+	}
+	w.pending = seen
+	return nil
+}
+
+// hasReport reports whether a file left in place was processed before, by
+// an earlier run, judging by a report newer than the file
+func (w *Watcher) hasReport(path string, state fileState) bool {
+	if w.cfg.ProcessedDir != "" {
+		return false
+	}
+	info, err := os.Stat(reportPath(w.cfg.OutputDir, path))
+	return err == nil && !info.ModTime().Before(state.modTime)
+}
+
+// processFile runs one file through the pipeline, writes its report and
+// moves it to the processed or quarantine directory
+func (w *Watcher) processFile(ctx context.Context, path string, state fileState) error {
+	report := &Report{File: filepath.Base(path), Path: path}
+	if stopped := run(context.WithoutCancel(ctx), w.pipeline, w.cfg, report, nil); stopped {
+		return nil // Shutting down; the file is picked up again on the next run
+	}
+
+	reportDir, moveDir := w.cfg.OutputDir, w.cfg.ProcessedDir
+	if report.Failed {
+		reportDir, moveDir = w.cfg.QuarantineDir, w.cfg.QuarantineDir
+	}
+	if moveDir != "" {
+		moved, err := moveFile(path, moveDir)
+		if err != nil {
+			return fmt.Errorf("failed to move %s: %w", path, err)
+		}
+		report.Path = moved
+		path = moved
+	}
+	if err := writeReport(reportPath(reportDir, path), report); err != nil {
+		return err
+	}
+	if moveDir == "" {
+		w.done[report.Path] = state
+	}
+
+	if w.cfg.OnReport != nil {
+		w.cfg.OnReport(report)
+	}
+	return nil
+}
+
+// run processes the file of report and records the outcome of its
+// documents. opts, if any, apply to the whole file. It reports whether the
+// pipeline was stopped before the file was finished.
+func run(ctx context.Context, pipeline *processor.Pipeline, cfg Config, report *Report, opts *processor.ProcessOptions) (stopped bool) {
+	data, err := os.ReadFile(report.Path)
+	var results []*processor.Result
+	if err != nil {
+		results = []*processor.Result{{Error: fmt.Errorf("failed to read file: %w", err)}}
+	} else {
+		fileCtx := llm.ContextWithDocumentID(ctx, report.Path)
+		if cfg.Timeout > 0 {
+			var cancel context.CancelFunc
+			fileCtx, cancel = context.WithTimeout(fileCtx, cfg.Timeout)
+			defer cancel()
+		}
+		processOpts := processor.ProcessOptions{SplitDocuments: cfg.SplitDocuments}
+		if opts != nil {
+			processOpts = *opts
+		}
+		processOpts.Filename = report.Path
+		results = pipeline.Process(fileCtx, data, processOpts)
+	}
+
+	report.ProcessedAt = time.Now().UTC()
+	for _, result := range results {
+		report.Failed = report.Failed || (result.Error != nil && !errors.Is(result.Error, processor.ErrSkipped))
+		report.Documents = append(report.Documents, newDocument(result))
+		stopped = stopped || errors.Is(result.Error, processor.ErrStopped)
+	}
+	return stopped
+}
+
+// reportPath is where the report of the file at path goes: <dir>/<name>.json,
+// or next to the file when dir is empty
+func reportPath(dir, path string) string {
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	return filepath.Join(dir, filepath.Base(path)+".json")
+}
+
+func newDocument(result *processor.Result) Document {
+	doc := Document{
+		Source:     result.Source,
+		Invoice:    result.Invoice,
+		Vendor:     result.Vendor,
+		Method:     string(result.Method),
+		Confidence: result.Confidence,
+		Warnings:   result.Warnings,
+		Duplicate:  result.Duplicate,
+	}
+	if result.Pages != nil {
+		doc.Pages = result.Pages.String()
+	}
+	if result.Error != nil {
+		doc.Invoice = nil
+		doc.Error = result.Error.Error()
+		doc.Skipped = errors.Is(result.Error, processor.ErrSkipped)
+		if !doc.Skipped {
+			doc.ErrorClass = processor.ErrorClass(result.Error)
+		}
+	}
+	return doc
+}
+
+// writeReport writes report atomically, so readers never see a partial file
+func writeReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// moveFile moves path into dir without overwriting, adding a numeric suffix
+// to the name if taken, and returns the new path
+func moveFile(path, dir string) (string, error) {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	target := filepath.Join(dir, base)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		target = filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+strconv.Itoa(i)+ext)
+	}
+
+	if err := os.Rename(path, target); err == nil {
+		return target, nil
+	}
+	// Across file systems: copy, then remove
+	if err := copyFile(path, target); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+	return target, os.Remove(path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ignored reports whether a file name is skipped: hidden files, partial
+// downloads and reports
+func ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".tmp", ".part", ".crdownload", ".partial":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package watcher_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/watcher"
+)
+
+const invoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice>
+	<InvoiceNo>0000042</InvoiceNo>
+	<Seller><TaxID>0123456789</TaxID></Seller>
+</Invoice>`
+
+func readReport(t *testing.T, path string) watcher.Report {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var report watcher.Report
+	require.NoError(t, json.Unmarshal(data, &report))
+	return report
+}
+
+func TestWatcher_Scan(t *testing.T) {
+	root := t.TempDir()
+	in, out, quarantine, processed := filepath.Join(root, "in"), filepath.Join(root, "out"), filepath.Join(root, "quarantine"), filepath.Join(root, "processed")
+	require.NoError(t, os.Mkdir(in, 0o755))
+
+	var reports []*watcher.Report
+	w, err := watcher.New(processor.NewPipeline(), watcher.Config{
+		Dirs:          []string{in},
+		OutputDir:     out,
+		QuarantineDir: quarantine,
+		ProcessedDir:  processed,
+		OnReport:      func(r *watcher.Report) { reports = append(reports, r) },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(in, "a.xml"), []byte(invoiceXML), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(in, "notes.txt"), []byte("not an invoice"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(in, "b.pdf.part"), []byte("%PDF-"), 0o644))
+
+	ctx := context.Background()
+	require.NoError(t, w.Scan(ctx))
+	assert.Empty(t, reports, "files are picked up once they hold still")
+
+	require.NoError(t, w.Scan(ctx))
+	require.Len(t, reports, 2)
+
+	report := readReport(t, filepath.Join(out, "a.xml.json"))
+	assert.False(t, report.Failed)
+	require.Len(t, report.Documents, 1)
+	assert.Equal(t, "0000042", report.Documents[0].Invoice.Number)
+	assert.FileExists(t, filepath.Join(processed, "a.xml"))
+
+	report = readReport(t, filepath.Join(quarantine, "notes.txt.json"))
+	assert.True(t, report.Failed)
+	assert.Contains(t, report.Documents[0].Error, "unsupported file format")
+	assert.FileExists(t, filepath.Join(quarantine, "notes.txt"))
+
+	assert.NoFileExists(t, filepath.Join(in, "a.xml"))
+	assert.FileExists(t, filepath.Join(in, "b.pdf.part"), "partial downloads are left alone")
+
+	// A second file with a taken name is not overwritten
+	require.NoError(t, os.WriteFile(filepath.Join(in, "a.xml"), []byte(invoiceXML), 0o644))
+	require.NoError(t, w.Scan(ctx))
+	require.NoError(t, w.Scan(ctx))
+	assert.FileExists(t, filepath.Join(processed, "a-1.xml"))
+}
+
+func TestWatcher_ReportsAlongside(t *testing.T) {
+	in := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(in, "a.xml"), []byte(invoiceXML), 0o644))
+
+	count := 0
+	cfg := watcher.Config{
+		Dirs:          []string{in},
+		QuarantineDir: filepath.Join(in, "quarantine"),
+		OnReport:      func(*watcher.Report) { count++ },
+	}
+	w, err := watcher.New(processor.NewPipeline(), cfg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for range 3 {
+		require.NoError(t, w.Scan(ctx))
+	}
+	assert.Equal(t, 1, count)
+	assert.FileExists(t, filepath.Join(in, "a.xml"), "inputs stay in place without a processed directory")
+	assert.FileExists(t, filepath.Join(in, "a.xml.json"))
+
+	// A restarted watcher skips files that already have a report
+	w, err = watcher.New(processor.NewPipeline(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, w.Scan(ctx))
+	require.NoError(t, w.Scan(ctx))
+	assert.Equal(t, 1, count)
+}
+
+func TestNew_Validation(t *testing.T) {
+	_, err := watcher.New(processor.NewPipeline(), watcher.Config{QuarantineDir: t.TempDir()})
+	require.Error(t, err)
+
+	_, err = watcher.New(processor.NewPipeline(), watcher.Config{Dirs: []string{t.TempDir()}})
+	require.Error(t, err)
+}
+
+func TestWatcher_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w, err := watcher.New(processor.NewPipeline(), watcher.Config{Dirs: []string{t.TempDir()}, QuarantineDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.NoError(t, w.Run(ctx))
+
+	w, err = watcher.New(processor.NewPipeline(), watcher.Config{Dirs: []string{filepath.Join(t.TempDir(), "missing")}, QuarantineDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.Error(t, w.Run(context.Background()))
+}
+
+func TestWatcher_StoppedPipeline(t *testing.T) {
+	in, quarantine := t.TempDir(), t.TempDir()
+	pipeline := processor.NewPipeline()
+	require.NoError(t, pipeline.Stop(context.Background()))
+
+	w, err := watcher.New(pipeline, watcher.Config{Dirs: []string{in}, QuarantineDir: quarantine})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(in, "a.xml"), []byte(invoiceXML), 0o644))
+	require.NoError(t, w.Scan(context.Background()))
+	require.NoError(t, w.Scan(context.Background()))
+
+	assert.FileExists(t, filepath.Join(in, "a.xml"), "left for the next run")
+	assert.NoFileExists(t, filepath.Join(in, "a.xml.json"))
+	assert.NoFileExists(t, filepath.Join(quarantine, "a.xml"))
+}
+
+func TestWatcher_ArchiveWithNonInvoices(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"0000042.xml": invoiceXML, "readme.txt": "Portal export"} {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(in, "export.zip"), buf.Bytes(), 0o644))
+
+	w, err := watcher.New(processor.NewPipeline(), watcher.Config{Dirs: []string{in}, OutputDir: out, QuarantineDir: t.TempDir()})
+	require.NoError(t, err)
+	require.NoError(t, w.Scan(context.Background()))
+	require.NoError(t, w.Scan(context.Background()))
+
+	report := readReport(t, filepath.Join(out, "export.zip.json"))
+	assert.False(t, report.Failed, "members that are not invoices are skipped, not failures")
+	require.Len(t, report.Documents, 2)
+}
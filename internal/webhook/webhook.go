@@ -0,0 +1,311 @@
+// Package webhook posts processing results to a URL when a document finishes
+// or fails, so downstream systems don't have to poll
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/processor"
+)
+
+// Event types
+const (
+	EventProcessed = "document.processed"
+	EventFailed    = "document.failed"
+	EventSkipped   = "document.skipped" // Archive members and attachments that are not invoices
+)
+
+// Request headers
+const (
+	HeaderEvent     = "X-Invoice-Event"
+	HeaderDelivery  = "X-Invoice-Delivery"  // Unique per event, the same across retries
+	HeaderTimestamp = "X-Invoice-Timestamp" // Unix seconds, part of the signed content
+	HeaderSignature = "X-Invoice-Signature" // "sha256=" and the hex HMAC of timestamp, ".", body
+)
+
+// ErrClosed is returned by Notify after Close
+var ErrClosed = errors.New("webhook dispatcher closed")
+
+// Event is the JSON body posted for a document
+type Event struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	Time          time.Time         `json:"time"`
+	DocumentID    string            `json:"document_id,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Result        *processor.Result `json:"result"`
+}
+
+// Dispatcher posts events from a queue in the background, retrying failed
+// deliveries with exponential backoff. Deliveries that still fail are
+// logged and dropped. It is safe for concurrent use.
+type Dispatcher struct {
+	url            string
+	secret         []byte
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	queue     chan delivery
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+type delivery struct {
+	ctx   context.Context
+	event *Event
+	body  []byte
+}
+
+// Option configures a Dispatcher
+type Option func(*Dispatcher)
+
+// WithSecret signs deliveries with an HMAC-SHA256 of secret (see Verify)
+func WithSecret(secret string) Option {
+	return func(d *Dispatcher) {
+		d.secret = []byte(secret)
+	}
+}
+
+// WithHTTPClient sets the client deliveries are posted with (default: 10s
+// timeout)
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithRetry sets the attempts per event, including the first (default: 5),
+// and the delay before the first retry (default: 1s), doubled for each
+// retry up to maxBackoff (default: 1m)
+func WithRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = max(maxAttempts, 1)
+		d.initialBackoff = initialBackoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithQueueSize sets how many events wait for delivery before Notify
+// blocks (default: 100)
+func WithQueueSize(n int) Option {
+	return func(d *Dispatcher) {
+		d.queue = make(chan delivery, max(n, 0))
+	}
+}
+
+// NewDispatcher returns a dispatcher posting to url and starts its worker.
+// Close it to deliver the queued events.
+func NewDispatcher(url string, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		url:            url,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:    5,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		queue:          make(chan delivery, 100),
+		stop:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// Hooks returns pipeline hooks queueing an event for every document
+func (d *Dispatcher) Hooks() processor.Hooks {
+	return processor.Hooks{
+		OnFinished: func(ctx context.Context, result *processor.Result) {
+			if err := d.Notify(ctx, result); err != nil {
+				logging.Warn(ctx, "failed to queue webhook", "error", err)
+			}
+		},
+	}
+}
+
+// Notify queues the event of a finished document. It blocks while the
+// queue is full, until ctx is done.
+func (d *Dispatcher) Notify(ctx context.Context, result *processor.Result) error {
+	event := NewEvent(ctx, result)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	select {
+	case d.queue <- delivery{ctx: context.WithoutCancel(ctx), event: event, body: body}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewEvent returns the event of a finished document, with the document and
+// correlation IDs of ctx
+func NewEvent(ctx context.Context, result *processor.Result) *Event {
+	event := &Event{
+		ID:            newID(),
+		Type:          EventProcessed,
+		Time:          time.Now().UTC(),
+		DocumentID:    llm.DocumentIDFromContext(ctx),
+		CorrelationID: result.CorrelationID,
+		Result:        result,
+	}
+	switch {
+	case errors.Is(result.Error, processor.ErrSkipped):
+		event.Type = EventSkipped
+		event.Error = result.Error.Error()
+	case result.Error != nil:
+		event.Type = EventFailed
+		event.Error = result.Error.Error()
+	case result.Invoice == nil:
+		event.Type = EventFailed
+		event.Error = "no invoice extracted"
+	}
+	return event
+}
+
+// Close stops accepting events and waits until the queued ones are
+// delivered, or until ctx is done, when pending retries are abandoned
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.closeOnce.Do(func() { close(d.stop) })
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+	for dl := range d.queue {
+		if err := d.deliver(dl); err != nil {
+			logging.Warn(dl.ctx, "webhook delivery failed", "url", d.url, "event", dl.event.Type, "delivery", dl.event.ID, "error", err)
+		}
+	}
+}
+
+// deliver posts a delivery, retrying transient failures
+func (d *Dispatcher) deliver(dl delivery) error {
+	backoff := d.initialBackoff
+	var err error
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(backoff):
+			case <-d.stop:
+				return errors.Join(err, errors.New("dispatcher closed before retry"))
+			}
+			backoff = min(backoff*2, d.maxBackoff)
+		}
+		var retry bool
+		if retry, err = d.post(dl); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends one attempt, reporting whether a failure is worth retrying
+func (d *Dispatcher) post(dl delivery) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(dl.ctx, http.MethodPost, d.url, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.event.Type)
+	req.Header.Set(HeaderDelivery, dl.event.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if len(d.secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(d.secret, timestamp, dl.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// Sign returns the signature header of a body sent at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery, and that it was sent within
+// tolerance of now to reject replays (0 skips the check). Receivers call it
+// with the raw request body and the timestamp and signature headers.
+func Verify(secret []byte, timestamp, signature string, body []byte, tolerance time.Duration) bool {
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return false
+	}
+	if tolerance == 0 {
+		return true
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(sent, 0))
+	return age < tolerance && age > -tolerance
+}
+
+// newID returns a random 128-bit hex ID
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
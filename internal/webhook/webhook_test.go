@@ -0,0 +1,154 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/webhook"
+)
+
+// receiver records the deliveries posted to it, answering with the next of
+// statuses (200 once they run out)
+type receiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.deliveries = append(rc.deliveries, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	rc := &receiver{statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return rc, srv
+}
+
+var fastRetry = webhook.WithRetry(3, time.Millisecond, 5*time.Millisecond)
+
+func TestDispatcher_SignedDelivery(t *testing.T) {
+	rc, srv := newReceiver(t)
+	d := webhook.NewDispatcher(srv.URL, webhook.WithSecret("s3cret"))
+
+	ctx := llm.ContextWithDocumentID(context.Background(), "doc-1")
+	result := &processor.Result{Invoice: &model.Invoice{Number: "0000042"}, Method: processor.MethodXML, Confidence: 1, CorrelationID: "abc"}
+	require.NoError(t, d.Notify(ctx, result))
+	require.NoError(t, d.Close(context.Background()))
+
+	require.Len(t, rc.deliveries, 1)
+	req, body := rc.deliveries[0], rc.bodies[0]
+	assert.Equal(t, webhook.EventProcessed, req.Header.Get(webhook.HeaderEvent))
+	assert.NotEmpty(t, req.Header.Get(webhook.HeaderDelivery))
+	assert.True(t, webhook.Verify([]byte("s3cret"), req.Header.Get(webhook.HeaderTimestamp), req.Header.Get(webhook.HeaderSignature), body, time.Minute))
+	assert.False(t, webhook.Verify([]byte("other"), req.Header.Get(webhook.HeaderTimestamp), req.Header.Get(webhook.HeaderSignature), body, time.Minute))
+
+	var event struct {
+		webhook.Event
+		Result struct {
+			Invoice *model.Invoice `json:"invoice"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, req.Header.Get(webhook.HeaderDelivery), event.ID)
+	assert.Equal(t, "doc-1", event.DocumentID)
+	assert.Equal(t, "abc", event.CorrelationID)
+	assert.Equal(t, "0000042", event.Result.Invoice.Number)
+}
+
+func TestDispatcher_RetriesTransientFailures(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	d := webhook.NewDispatcher(srv.URL, fastRetry)
+
+	require.NoError(t, d.Notify(context.Background(), &processor.Result{Error: errors.New("boom")}))
+	require.NoError(t, d.Close(context.Background()))
+
+	require.Len(t, rc.deliveries, 3)
+	assert.Equal(t, webhook.EventFailed, rc.deliveries[2].Header.Get(webhook.HeaderEvent))
+	// Retries are the same delivery
+	assert.Equal(t, rc.deliveries[0].Header.Get(webhook.HeaderDelivery), rc.deliveries[2].Header.Get(webhook.HeaderDelivery))
+	assert.Empty(t, rc.deliveries[0].Header.Get(webhook.HeaderSignature))
+}
+
+func TestDispatcher_NoRetryOnClientError(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusBadRequest)
+	d := webhook.NewDispatcher(srv.URL, fastRetry)
+
+	require.NoError(t, d.Notify(context.Background(), &processor.Result{Invoice: &model.Invoice{}}))
+	require.NoError(t, d.Close(context.Background()))
+	assert.Len(t, rc.deliveries, 1)
+}
+
+func TestDispatcher_Closed(t *testing.T) {
+	_, srv := newReceiver(t)
+	d := webhook.NewDispatcher(srv.URL)
+	require.NoError(t, d.Close(context.Background()))
+	assert.ErrorIs(t, d.Notify(context.Background(), &processor.Result{}), webhook.ErrClosed)
+}
+
+func TestDispatcher_CloseAbandonsRetries(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusBadGateway, http.StatusBadGateway)
+	d := webhook.NewDispatcher(srv.URL, webhook.WithRetry(3, time.Hour, time.Hour))
+	require.NoError(t, d.Notify(context.Background(), &processor.Result{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Close(ctx), context.DeadlineExceeded)
+	assert.Len(t, rc.deliveries, 1)
+}
+
+func TestNewEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *processor.Result
+		want   string
+	}{
+		{"processed", &processor.Result{Invoice: &model.Invoice{}}, webhook.EventProcessed},
+		{"failed", &processor.Result{Error: errors.New("unsupported file format")}, webhook.EventFailed},
+		{"no invoice", &processor.Result{}, webhook.EventFailed},
+		{"skipped", &processor.Result{Error: processor.ErrSkipped}, webhook.EventSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := webhook.NewEvent(context.Background(), tt.result)
+			assert.Equal(t, tt.want, event.Type)
+			assert.Equal(t, tt.want != webhook.EventProcessed, event.Error != "")
+		})
+	}
+}
+
+func TestVerify_Tolerance(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{}`)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	signature := webhook.Sign(secret, old, body)
+
+	assert.False(t, webhook.Verify(secret, old, signature, body, 5*time.Minute))
+	assert.True(t, webhook.Verify(secret, old, signature, body, 0))
+	assert.False(t, webhook.Verify(secret, old, signature, []byte(`{"x":1}`), 0))
+}
@@ -0,0 +1,208 @@
+package invoicelib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/rezonia/invoice-processor/internal/config"
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
+	"github.com/rezonia/invoice-processor/internal/webhook"
+)
+
+// Config is a YAML pipeline configuration (see LoadConfig)
+type Config = config.Config
+
+// LoadConfig reads a YAML pipeline configuration file. Values may refer to
+// environment variables as ${NAME} or ${NAME:-default}, so secrets can stay
+// out of the file.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// ParseConfig reads a YAML pipeline configuration (see LoadConfig)
+func ParseConfig(data []byte) (*Config, error) {
+	return config.Parse(data)
+}
+
+// OptionsFromConfig returns DefaultPipelineOptions with the settings of cfg
+// applied. The store, audit log, webhook and event log of cfg need opening and are
+// left to NewProcessorFromConfig.
+func OptionsFromConfig(cfg *Config) (PipelineOptions, error) {
+	opts := DefaultPipelineOptions()
+
+	l := cfg.LLM
+	opts.LLMProvider = l.Provider
+	opts.LLMAPIKey = l.APIKey
+	if l.BaseURL != "" {
+		opts.LLMBaseURL = l.BaseURL
+	}
+	if l.Model != "" {
+		opts.LLMModel = l.Model
+	}
+	if l.VisionModel != "" {
+		opts.LLMVisionModel = l.VisionModel
+	}
+	opts.LLMFallbackModels = l.FallbackModels
+	opts.LLMVisionFallbackModels = l.VisionFallbackModels
+	opts.LLMEmbeddingModel = l.EmbeddingModel
+	opts.LLMTimeout = l.Timeout
+	opts.LLMRequestTimeout = l.RequestTimeout
+	opts.LLMMaxAttempts = l.MaxAttempts
+	opts.LLMMaxConcurrency = l.MaxConcurrency
+	opts.LLMRequestsPerSecond = l.RequestsPerSecond
+	opts.LLMTokensPerMinute = l.TokensPerMinute
+	opts.LLMCircuitBreakerThreshold = l.CircuitBreaker
+	opts.LLMHeaders = l.Headers
+	opts.LLMExtraBody = l.ExtraBody
+	opts.LLMPromptCaching = l.PromptCaching
+	opts.LLMTemperature = l.Temperature
+	opts.LLMTopP = l.TopP
+	opts.LLMMaxTokens = l.MaxTokens
+	opts.LLMAuditBodies = l.AuditBodies
+	if l.Proxy != "" {
+		proxy, err := url.Parse(l.Proxy)
+		if err != nil {
+			return opts, fmt.Errorf("invalid LLM proxy URL: %w", err)
+		}
+		opts.LLMProxy = proxy
+	}
+
+	e := cfg.Extraction
+	strategies, err := cfg.Strategies()
+	if err != nil {
+		return opts, err
+	}
+	opts.Strategies = strategies
+	opts.MaxMergedPages = e.MergePages
+	opts.LLMEnsemble = e.Ensemble
+	opts.LLMRace = e.Race
+	opts.LLMSamples = e.Samples
+	opts.LLMRecoverFields = e.RecoverFields
+	opts.LLMRedactPII = e.RedactPII
+	opts.LLMBoundingBoxes = e.BoundingBoxes
+	opts.LLMArithmeticCheck = e.CheckArithmetic
+	opts.LLMTaxIDCheck = e.CheckTaxIDs
+	opts.LLMAddresses = e.LLMAddresses
+	opts.LLMMaxTextTokens = e.MaxTextTokens
+	opts.LLMImageMaxSide = e.ImageMaxSide
+	opts.LLMRawResponses = e.RawResponses
+	opts.Preclassify = e.Preclassify
+	opts.DocumentDeadline = e.Deadline
+	opts.ClassifierModel = e.ClassifierModel
+	if e.Duplicates {
+		opts.DuplicateStore = processor.NewMemoryDuplicateStore()
+	}
+	if e.Idempotency {
+		opts.Idempotency = processor.NewMemoryIdempotencyStore()
+	}
+	if e.Vendors != "" {
+		data, err := os.ReadFile(e.Vendors)
+		if err != nil {
+			return opts, fmt.Errorf("failed to read vendors: %w", err)
+		}
+		if err := json.Unmarshal(data, &opts.Vendors); err != nil {
+			return opts, fmt.Errorf("failed to parse vendors: %w", err)
+		}
+	}
+
+	opts.ValidateAfterExtraction = cfg.ValidationEnabled()
+	if opts.ValidationRules, err = cfg.ValidationRules(); err != nil {
+		return opts, err
+	}
+	if opts.Tenants, err = cfg.ProcessorTenants(); err != nil {
+		return opts, err
+	}
+	opts.Budget = cfg.BudgetController()
+	if opts.SpreadsheetMapping, err = cfg.SpreadsheetMapping(); err != nil {
+		return opts, err
+	}
+	opts.UnitMapping = cfg.Extraction.Units
+	if cfg.Validation.ReviewThreshold > 0 {
+		opts.ReviewThreshold = cfg.Validation.ReviewThreshold
+	}
+	return opts, nil
+}
+
+// NewProcessorFromConfig builds a processor from cfg, opening its store,
+// LLM audit log, webhook and event log. A SQL store is opened with the database/sql
+// driver named by store.driver, which the program registers. cleanup releases
+// what was opened, delivering the queued webhook notifications first.
+func NewProcessorFromConfig(ctx context.Context, cfg *Config) (p *Processor, cleanup func() error, err error) {
+	opts, err := OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var closers []func() error
+	release := func() error {
+		var errs []error
+		for i := len(closers) - 1; i >= 0; i-- {
+			errs = append(errs, closers[i]())
+		}
+		return errors.Join(errs...)
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	if cfg.LLM.AuditLog != "" {
+		f, err := os.OpenFile(cfg.LLM.AuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		closers = append(closers, f.Close)
+		opts.LLMAuditLog = f
+	}
+
+	switch cfg.Store.Type {
+	case config.StoreMemory:
+		opts.Store = store.NewMemoryStore()
+	case config.StoreSQLite, config.StorePostgres:
+		driver := cfg.Store.Driver
+		if driver == "" {
+			driver = cfg.Store.Type
+		}
+		db, err := sql.Open(driver, cfg.Store.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open store: %w", err)
+		}
+		closers = append(closers, db.Close)
+		newStore := store.NewPostgres
+		if cfg.Store.Type == config.StoreSQLite {
+			newStore = store.NewSQLite
+		}
+		if opts.Store, err = newStore(ctx, db); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cfg.Webhook.URL != "" {
+		var webhookOpts []webhook.Option
+		if cfg.Webhook.Secret != "" {
+			webhookOpts = append(webhookOpts, webhook.WithSecret(cfg.Webhook.Secret))
+		}
+		dispatcher := webhook.NewDispatcher(cfg.Webhook.URL, webhookOpts...)
+		closers = append(closers, func() error { return dispatcher.Close(context.Background()) })
+		opts.Webhook = dispatcher
+	}
+
+	if cfg.Events.File != "" {
+		events, err := outbox.OpenFileStore(cfg.Events.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, events.Close)
+		opts.Events = events
+	}
+
+	return NewProcessor(opts), release, nil
+}
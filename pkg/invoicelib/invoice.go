@@ -13,7 +13,27 @@
 //	fmt.Println(invoice.TotalAmount)
 package invoicelib
 
-import "github.com/rezonia/invoice-processor/internal/model"
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/rezonia/invoice-processor/internal/export"
+	"github.com/rezonia/invoice-processor/internal/llm"
+	"github.com/rezonia/invoice-processor/internal/logging"
+	"github.com/rezonia/invoice-processor/internal/metrics"
+	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/outbox"
+	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/render"
+	"github.com/rezonia/invoice-processor/internal/store"
+	"github.com/rezonia/invoice-processor/internal/tracing"
+	"github.com/rezonia/invoice-processor/internal/uom"
+	"github.com/rezonia/invoice-processor/internal/webhook"
+)
 
 // Re-export core types for public API
 type (
@@ -23,9 +43,568 @@ type (
 	Signature   = model.Signature
 	Provider    = model.Provider
 	VATRate     = model.VATRate
+	VATCategory = model.VATCategory
+	VATLine     = model.VATLine
+	VNDAmounts  = model.VNDAmounts
+	FieldChange = model.FieldChange
+	Anonymizer  = model.Anonymizer
 	InvoiceType = model.InvoiceType
+	Statement   = model.Statement
+	Transaction = model.Transaction
+	BoundingBox = model.BoundingBox
+	Address     = model.Address
+)
+
+// Re-export layout classification types
+type (
+	Layout       = processor.Layout
+	Template     = processor.Template
+	TemplateFunc = processor.TemplateFunc
+)
+
+// Re-export the column mapping of spreadsheet invoices
+type (
+	SpreadsheetMapping = processor.SpreadsheetMapping
+	SpreadsheetField   = processor.SpreadsheetField
+)
+
+// DefaultSpreadsheetColumns returns the header names each spreadsheet
+// field is recognized by
+var DefaultSpreadsheetColumns = processor.DefaultSpreadsheetColumns
+
+// DefaultUnitMapping maps the units of measure line items are written with
+// to the UN/ECE codes of LineItem.UnitCode
+var DefaultUnitMapping = uom.DefaultMapping
+
+// Submission is the email a document was attached to
+type Submission = processor.Submission
+
+// SubmissionResults are the results of the documents of one email
+type SubmissionResults struct {
+	Submission *Submission // Nil for a document that was not emailed
+	Results    []*ExtractionResult
+}
+
+// GroupBySubmission groups results by the email they came from, in the
+// order of their first result, such as the results of ProcessDocuments for
+// an archive of exported emails. A result without a submission is a group
+// of its own.
+func GroupBySubmission(results []*ExtractionResult) []SubmissionResults {
+	var groups []SubmissionResults
+	index := make(map[*Submission]int)
+	for _, r := range results {
+		if i, ok := index[r.Submission]; ok {
+			groups[i].Results = append(groups[i].Results, r)
+			continue
+		}
+		if r.Submission != nil {
+			index[r.Submission] = len(groups)
+		}
+		groups = append(groups, SubmissionResults{Submission: r.Submission, Results: []*ExtractionResult{r}})
+	}
+	return groups
+}
+
+// ProcessOptions describe an input to Processor.ProcessDocuments
+type ProcessOptions = processor.ProcessOptions
+
+// Re-export batch processing types
+type (
+	BatchInput    = processor.BatchInput
+	BatchOptions  = processor.BatchOptions
+	BatchSummary  = processor.BatchSummary
+	LLMModelPrice = llm.ModelPrice
+)
+
+// Priority is the lane LLM calls wait in for a concurrency slot (see
+// PipelineOptions.LLMMaxConcurrency); interactive calls go first
+type Priority = llm.Priority
+
+// LLM call priorities
+const (
+	PriorityInteractive = llm.PriorityInteractive
+	PriorityBatch       = llm.PriorityBatch
+)
+
+// ContextWithPriority sends the LLM calls made with ctx in the lane of p.
+// RunBatch uses PriorityBatch unless ctx sets one.
+func ContextWithPriority(ctx context.Context, p Priority) context.Context {
+	return llm.ContextWithPriority(ctx, p)
+}
+
+// Re-export validation types
+type (
+	ValidationRule    = processor.ValidationRule
+	ValidationFinding = processor.ValidationFinding
+	ValidationIssue   = model.ValidationIssue
+	RuleSet           = model.RuleSet
+	Severity          = processor.Severity
+	Discrepancy       = processor.Discrepancy
+)
+
+// Validation severities
+const (
+	SeverityWarning = processor.SeverityWarning
+	SeverityError   = processor.SeverityError
+)
+
+// DefaultValidationRules returns the validation rules run after extraction
+func DefaultValidationRules() []ValidationRule {
+	return processor.DefaultValidationRules()
+}
+
+// Names of the validation rules of TT78Rules
+const (
+	RuleRequiredFields = model.RuleRequiredFields
+	RuleTaxID          = model.RuleTaxID
+	RuleDate           = model.RuleDate
+	RuleTotals         = model.RuleTotals
+	RuleVATRate        = model.RuleVATRate
+	RuleCurrency       = model.RuleCurrency
+	RuleCreditNote     = model.RuleCreditNote
+	RuleNumberFormat   = model.RuleNumberFormat
+	RuleSeriesFormat   = model.RuleSeriesFormat
+)
+
+// VietnamRules returns the checks of any Vietnamese invoice or receipt, the
+// defaults of the validation stage
+func VietnamRules() RuleSet {
+	return model.VietnamRules()
+}
+
+// TT78Rules returns VietnamRules with the invoice number and series formats
+// of Circular 78/2021/TT-BTC
+func TT78Rules() RuleSet {
+	return model.TT78Rules()
+}
+
+// Errors of ValidateTaxID
+var (
+	ErrTaxIDFormat   = model.ErrTaxIDFormat
+	ErrTaxIDChecksum = model.ErrTaxIDChecksum
+)
+
+// ValidateTaxID checks the format and check digit of a Vietnamese tax ID
+// (mã số thuế), 10 digits or 13 as NNNNNNNNNN-NNN for a branch, or the
+// 12-digit personal ID of an individual
+func ValidateTaxID(id string) error {
+	return model.ValidateTaxID(id)
+}
+
+// Re-export confidence scoring types
+type (
+	ConfidenceSignals = processor.ConfidenceSignals
+	ConfidenceScorer  = processor.ConfidenceScorer
+)
+
+// ScoreConfidence is the default confidence scorer
+func ScoreConfidence(s ConfidenceSignals) float64 {
+	return processor.ScoreConfidence(s)
+}
+
+// Re-export pipeline hook types (see PipelineOptions.Hooks). Hooks see the
+// pipeline's result, before it is converted to an ExtractionResult.
+type (
+	PipelineHooks  = processor.Hooks
+	PipelineResult = processor.Result
+	DocumentFormat = processor.Format
+)
+
+// Re-export stage retry types (see PipelineOptions.StageRetry)
+type (
+	Stage            = processor.Stage
+	StageRetryPolicy = processor.StageRetryPolicy
+)
+
+// Strategy is a way of extracting an invoice from a PDF (see
+// PipelineOptions.Strategies)
+type Strategy = processor.Strategy
+
+// PDF extraction strategies
+const (
+	StrategyEmbeddedXML = processor.StrategyEmbeddedXML
+	StrategyText        = processor.StrategyText
+	StrategyVision      = processor.StrategyVision
+)
+
+// ContextWithStrategies overrides the strategy chain for the documents
+// processed with ctx
+func ContextWithStrategies(ctx context.Context, strategies ...Strategy) context.Context {
+	return processor.ContextWithStrategies(ctx, strategies...)
+}
+
+// LLMAuditEvent describes one LLM call (see ExtractionResult.Raw)
+type LLMAuditEvent = llm.AuditEvent
+
+// Re-export debug mode types (see PipelineOptions.Debug)
+type (
+	DebugOptions = processor.DebugOptions
+	DebugInfo    = processor.DebugInfo
+	DebugImage   = processor.DebugImage
+	DebugCall    = processor.DebugCall
+)
+
+// Pipeline stages
+const (
+	StageXMLParse    = processor.StageXMLParse
+	StagePDFText     = processor.StagePDFText
+	StagePDFRender   = processor.StagePDFRender
+	StageClassify    = processor.StageClassify
+	StageLLMText     = processor.StageLLMText
+	StageLLMVision   = processor.StageLLMVision
+	StagePostprocess = processor.StagePostprocess
 )
 
+// DefaultStageRetryPolicy retries the PDF tools once after a transient failure
+var DefaultStageRetryPolicy = processor.DefaultStageRetryPolicy
+
+// IsTransient reports whether a stage error is worth retrying
+func IsTransient(err error) bool {
+	return processor.IsTransient(err)
+}
+
+// ErrSkipped, wrapped in an error returned by a hook, drops the document
+// instead of failing it (see ExtractionResult.Skipped)
+var ErrSkipped = processor.ErrSkipped
+
+// ErrStopped is the error of documents the processor did not finish because
+// it was stopped (see Processor.Stop)
+var ErrStopped = processor.ErrStopped
+
+// Tenant holds the settings of a client company (see PipelineOptions.Tenants)
+type Tenant = processor.Tenant
+
+// Models names the primary text and vision models of a tenant
+type Models = llm.Models
+
+// PromptSet overrides the extraction prompts of a tenant
+type PromptSet = llm.PromptSet
+
+// ErrUnknownTenant is the error of documents processed for a tenant not in
+// PipelineOptions.Tenants
+var ErrUnknownTenant = processor.ErrUnknownTenant
+
+// ContextWithTenant processes the documents of ctx for tenant
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return processor.ContextWithTenant(ctx, tenant)
+}
+
+// Re-export budget types (see PipelineOptions.Budget)
+type (
+	Budget           = processor.Budget
+	BudgetController = processor.BudgetController
+)
+
+// NewBudgetController returns a controller enforcing budget; processors
+// sharing it share its caps
+func NewBudgetController(budget Budget) *BudgetController {
+	return processor.NewBudgetController(budget)
+}
+
+// ErrBudgetExceeded is the error of documents whose LLM calls were refused
+// because a cap of PipelineOptions.Budget is reached
+var ErrBudgetExceeded = processor.ErrBudgetExceeded
+
+// ErrDeadlineExceeded is the error of documents cut off by
+// PipelineOptions.DocumentDeadline before anything was read
+var ErrDeadlineExceeded = processor.ErrDeadlineExceeded
+
+// DefaultStageShares is the share of the document deadline each stage may use
+var DefaultStageShares = processor.DefaultStageShares
+
+// Re-export webhook types (see PipelineOptions.Webhook)
+type (
+	WebhookDispatcher = webhook.Dispatcher
+	WebhookEvent      = webhook.Event
+	WebhookOption     = webhook.Option
+)
+
+// NewWebhookDispatcher returns a dispatcher posting a WebhookEvent to url
+// for every processed document
+func NewWebhookDispatcher(url string, opts ...WebhookOption) *WebhookDispatcher {
+	return webhook.NewDispatcher(url, opts...)
+}
+
+// Webhook options
+var (
+	WithWebhookSecret     = webhook.WithSecret     // Sign deliveries with HMAC-SHA256 (see VerifyWebhook)
+	WithWebhookRetry      = webhook.WithRetry      // Attempts and backoff of failed deliveries
+	WithWebhookHTTPClient = webhook.WithHTTPClient // Client deliveries are posted with
+)
+
+// VerifyWebhook checks the signature of a delivery received from a
+// WebhookDispatcher, given its raw body and X-Invoice-Timestamp and
+// X-Invoice-Signature headers, and rejects deliveries sent more than
+// tolerance ago (0 = no limit)
+func VerifyWebhook(secret []byte, timestamp, signature string, body []byte, tolerance time.Duration) bool {
+	return webhook.Verify(secret, timestamp, signature, body, tolerance)
+}
+
+// Re-export invoice event types (see PipelineOptions.Events)
+type (
+	InvoiceEvent   = outbox.Event
+	EventStore     = outbox.Store
+	EventPublisher = outbox.Publisher
+	EventCursor    = outbox.Cursor
+	EventRelay     = outbox.Relay
+	RelayConfig    = outbox.RelayConfig
+
+	EventPublisherFunc = outbox.PublisherFunc // Adapts a function to EventPublisher
+	FileEventCursor    = outbox.FileCursor    // Keeps the position of an EventRelay in a local file
+)
+
+// Invoice event types
+const (
+	EventInvoiceExtracted         = outbox.EventExtracted
+	EventInvoiceValidated         = outbox.EventValidated
+	EventInvoiceDuplicateDetected = outbox.EventDuplicateDetected
+	EventInvoiceCancelled         = outbox.EventCancelled
+)
+
+// NewMemoryEventStore returns an in-memory EventStore
+func NewMemoryEventStore() EventStore {
+	return outbox.NewMemoryStore()
+}
+
+// OpenFileEventStore opens an EventStore kept in a JSON lines file at path
+func OpenFileEventStore(path string) (*outbox.FileStore, error) {
+	return outbox.OpenFileStore(path)
+}
+
+// NewEventRelay returns a relay publishing the events of store to
+// publisher in order, at least once
+func NewEventRelay(store EventStore, publisher EventPublisher, cfg RelayConfig) (*EventRelay, error) {
+	return outbox.NewRelay(store, publisher, cfg)
+}
+
+// Re-export invoice export types
+type (
+	ExportColumn  = export.Column
+	ExportMapping = export.Mapping
+)
+
+// DefaultExportMapping returns the default invoice and line item columns
+func DefaultExportMapping() ExportMapping {
+	return export.DefaultMapping()
+}
+
+// ExportCSV writes invoices as a CSV table, one row per invoice, and their
+// line items as another to lines (nil = not written)
+func ExportCSV(w, lines io.Writer, invoices []*Invoice, m ExportMapping) error {
+	return export.WriteInvoicesCSV(w, lines, invoices, m)
+}
+
+// ExportXLSX writes invoices as an Excel workbook with Invoices and Lines
+// sheets
+func ExportXLSX(w io.Writer, invoices []*Invoice, m ExportMapping) error {
+	return export.WriteInvoicesXLSX(w, invoices, m)
+}
+
+// ExportJSONL writes each invoice as a line of JSON
+func ExportJSONL(w io.Writer, invoices []*Invoice) error {
+	return export.WriteJSONL(w, invoices)
+}
+
+// Re-export accounting system exports
+type (
+	AccountingSystem = export.AccountingSystem
+	Accounting       = export.Accounting
+	TaxCodes         = export.TaxCodes
+)
+
+// Accounting systems
+const (
+	QuickBooks = export.QuickBooks
+	Xero       = export.Xero
+	MISA       = export.MISA
+)
+
+// DefaultAccounting returns the tax codes, accounts and date format an
+// accounting system starts with
+func DefaultAccounting(system AccountingSystem) (Accounting, error) {
+	return export.DefaultAccounting(system)
+}
+
+// Renderer draws invoices as standardized HTML and PDF documents with
+// Vietnamese and English labels
+type Renderer = render.Renderer
+
+// RenderOption configures a Renderer
+type RenderOption = render.Option
+
+// NewRenderer returns a Renderer
+func NewRenderer(opts ...RenderOption) (*Renderer, error) {
+	return render.New(opts...)
+}
+
+// WithRenderFont sets the TrueType font of rendered PDFs (default: Roboto)
+func WithRenderFont(ttf []byte) RenderOption {
+	return render.WithFont(ttf)
+}
+
+// WithRenderNote replaces the footer of rendered documents ("" = none)
+func WithRenderNote(note string) RenderOption {
+	return render.WithNote(note)
+}
+
+// ExportUBL writes inv as a UBL 2.1 Invoice, or CreditNote for credit notes
+func ExportUBL(w io.Writer, inv *Invoice) error {
+	return export.WriteUBL(w, inv)
+}
+
+// DuplicateStore remembers invoice fingerprints (see PipelineOptions.DuplicateStore)
+type DuplicateStore = processor.DuplicateStore
+
+// NewMemoryDuplicateStore returns a DuplicateStore held in memory
+func NewMemoryDuplicateStore() *processor.MemoryDuplicateStore {
+	return processor.NewMemoryDuplicateStore()
+}
+
+// IdempotencyStore keeps the results of documents by idempotency key (see
+// PipelineOptions.Idempotency)
+type IdempotencyStore = processor.IdempotencyStore
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore held in memory
+func NewMemoryIdempotencyStore() *processor.MemoryIdempotencyStore {
+	return processor.NewMemoryIdempotencyStore()
+}
+
+// IdempotencyKey derives the idempotency key of a document from its content
+// and the options that change how it is read
+func IdempotencyKey(data []byte, opts ProcessOptions) string {
+	return processor.IdempotencyKey(data, opts)
+}
+
+// Fingerprint identifies an invoice by seller tax ID, series, number, date
+// and total (see Invoice.Fingerprint)
+func Fingerprint(inv *Invoice) string {
+	return inv.Fingerprint()
+}
+
+// Re-export persistence types
+type (
+	Store           = store.Store
+	StoreRecord     = store.Record
+	StoreQuery      = store.Query
+	StoreArtifact   = store.Artifact
+	FieldProvenance = store.FieldProvenance
+	StoreAttempt    = store.Attempt
+	ReplayOptions   = store.ReplayOptions
+	RecordStatus    = store.Status
+	StatusChange    = store.StatusChange
+)
+
+// Record statuses of the AP workflow (see Store.SetStatus)
+const (
+	StatusReceived  = store.StatusReceived
+	StatusExtracted = store.StatusExtracted
+	StatusValidated = store.StatusValidated
+	StatusReviewed  = store.StatusReviewed
+	StatusApproved  = store.StatusApproved
+	StatusCancelled = store.StatusCancelled
+	StatusAdjusted  = store.StatusAdjusted
+)
+
+// ParseRecordStatus returns the record status named s
+func ParseRecordStatus(s string) (RecordStatus, error) {
+	return store.ParseStatus(s)
+}
+
+// Store errors
+var (
+	ErrRecordNotFound = store.ErrNotFound   // Unknown record ID
+	ErrRecordClaimed  = store.ErrClaimed    // Another reviewer holds the record (see Store.Claim)
+	ErrRecordReviewed = store.ErrReviewed   // The record was already reviewed
+	ErrNoArtifact     = store.ErrNoArtifact // The record kept no document to replay
+
+	ErrInvalidTransition = store.ErrInvalidTransition // The record's status doesn't lead to the one requested
+)
+
+// NewSQLiteStore persists results in a SQLite database opened by the caller
+// with a driver of their choice, creating the table if needed
+func NewSQLiteStore(ctx context.Context, db *sql.DB) (*store.SQLStore, error) {
+	return store.NewSQLite(ctx, db)
+}
+
+// NewPostgresStore persists results in a Postgres database opened by the
+// caller with a driver of their choice, creating the table if needed
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*store.SQLStore, error) {
+	return store.NewPostgres(ctx, db)
+}
+
+// NewMemoryStore keeps results in memory, for tests
+func NewMemoryStore() *store.MemoryStore {
+	return store.NewMemoryStore()
+}
+
+// ContextWithDocumentID names the document processed with ctx, in LLM audit
+// records and saved results
+func ContextWithDocumentID(ctx context.Context, id string) context.Context {
+	return llm.ContextWithDocumentID(ctx, id)
+}
+
+// ContextWithCorrelationID sets the correlation ID logged with every record
+// of the document processed with ctx, such as the ID of the HTTP request
+// that uploaded it. Without one a random ID is generated.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return logging.ContextWithCorrelationID(ctx, id)
+}
+
+// Re-export vendor matching types
+type (
+	Vendor      = processor.Vendor
+	VendorMatch = processor.VendorMatch
+)
+
+// Re-export LLM telemetry types
+type (
+	LLMCallRecord    = llm.CallRecord
+	LLMTelemetryHook = llm.TelemetryHook
+	LLMTelemetryFunc = llm.TelemetryHookFunc
+	LLMCallOutcome   = llm.Outcome
+)
+
+// MetricsRegistry holds the metrics of PipelineOptions.Metrics. It is an
+// http.Handler serving them in the Prometheus text format, for a /metrics
+// endpoint.
+type MetricsRegistry = metrics.Registry
+
+// NewMetricsRegistry returns an empty registry. Processors sharing one add
+// to the same series.
+func NewMetricsRegistry() *MetricsRegistry {
+	return metrics.NewRegistry()
+}
+
+// Re-export tracing types. Tracer and TracingSpan follow OpenTelemetry's
+// trace.Tracer and trace.Span; adapt an OTel tracer to use it.
+type (
+	Tracer           = tracing.Tracer
+	TracingSpan      = tracing.Span
+	TracingAttribute = tracing.Attribute
+)
+
+// Logger receives structured log records of PipelineOptions.Logger;
+// *slog.Logger satisfies it
+type Logger = logging.Logger
+
+// Re-export LLM cassette types, for testing pipelines without network access
+type (
+	LLMCassette     = llm.Cassette
+	LLMCassetteMode = llm.CassetteMode
+)
+
+// Re-export LLM cassette modes
+const (
+	LLMCassetteReplay         = llm.CassetteReplay
+	LLMCassetteRecord         = llm.CassetteRecord
+	LLMCassetteReplayOrRecord = llm.CassetteReplayOrRecord
+)
+
+// NewLLMCassette opens the cassette file at path for PipelineOptions.LLMCassette
+func NewLLMCassette(path string, mode LLMCassetteMode) (*LLMCassette, error) {
+	return llm.NewCassette(path, mode)
+}
+
 // Re-export provider constants
 const (
 	ProviderTCT     = model.ProviderTCT
@@ -37,12 +616,94 @@ const (
 )
 
 // Re-export VAT rates
+var (
+	VATRate0     = model.VATRate0
+	VATRate5     = model.VATRate5
+	VATRate8     = model.VATRate8
+	VATRate10    = model.VATRate10
+	VATRateKCT   = model.VATRateKCT
+	VATRateKKKNT = model.VATRateKKKNT
+)
+
+// VAT categories of lines outside VAT
 const (
-	VATRate0  = model.VATRate0
-	VATRate5  = model.VATRate5
-	VATRate10 = model.VATRate10
+	VATCategoryTaxable     = model.VATCategoryTaxable
+	VATCategoryNonTaxable  = model.VATCategoryNonTaxable
+	VATCategoryNotDeclared = model.VATCategoryNotDeclared
 )
 
+// ParseVATRate reads a VAT rate as documents write it: "10", "8%", "KCT"...
+func ParseVATRate(s string) (VATRate, error) {
+	return model.ParseVATRate(s)
+}
+
+// CurrencyVND is the currency of invoices without one
+const CurrencyVND = model.CurrencyVND
+
+// ErrExchangeRate is returned converting a foreign currency invoice without
+// an exchange rate
+var ErrExchangeRate = model.ErrExchangeRate
+
+// ConvertToVND converts amount at rate VND per unit, rounded to whole dong
+func ConvertToVND(amount, rate decimal.Decimal) decimal.Decimal {
+	return model.ConvertToVND(amount, rate)
+}
+
+// InvoiceSchemaVersion is the version of the JSON serialization of Invoice
+const InvoiceSchemaVersion = model.InvoiceSchemaVersion
+
+// ErrUnsupportedSchemaVersion is returned for invoices serialized by a newer
+// release
+var ErrUnsupportedSchemaVersion = model.ErrUnsupportedSchemaVersion
+
+// InvoiceJSONSchema returns the JSON Schema of Invoice
+func InvoiceJSONSchema() map[string]any {
+	return model.InvoiceJSONSchema()
+}
+
+// MarshalInvoice writes inv as JSON stamped with InvoiceSchemaVersion
+func MarshalInvoice(inv *Invoice, opts ...MarshalOption) ([]byte, error) {
+	return model.Marshal(inv, opts...)
+}
+
+// UnmarshalInvoice reads an invoice of this schema version or an earlier one
+func UnmarshalInvoice(data []byte) (*Invoice, error) {
+	return model.Unmarshal(data)
+}
+
+// MarshalOption changes how MarshalInvoice writes an invoice
+type MarshalOption = model.MarshalOption
+
+// OmitZeroDecimals leaves zero amounts out of MarshalInvoice
+func OmitZeroDecimals() MarshalOption {
+	return model.OmitZeroDecimals()
+}
+
+// SortKeys writes the properties of MarshalInvoice in alphabetical order
+func SortKeys() MarshalOption {
+	return model.SortKeys()
+}
+
+// Diff lists the fields of the invoice b that differ from a
+func Diff(a, b *Invoice) []FieldChange {
+	return model.Diff(a, b)
+}
+
+// Anonymize returns a copy of inv with its parties pseudonymized, unkeyed
+func Anonymize(inv *Invoice) *Invoice {
+	return model.Anonymize(inv)
+}
+
+// NewAnonymizer returns an anonymizer whose pseudonyms are keyed with key
+func NewAnonymizer(key []byte) *Anonymizer {
+	return model.NewAnonymizer(key)
+}
+
+// SummarizeVAT adds up the taxable amounts and VAT of items per rate
+func SummarizeVAT(items []LineItem) []VATLine {
+	return model.SummarizeVAT(items)
+}
+
 // Re-export invoice types
 const (
 	InvoiceTypeNormal      = model.InvoiceTypeNormal
@@ -3,6 +3,9 @@ package invoicelib
 import (
 	"context"
 	"io"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/rezonia/invoice-processor/internal/model"
 )
@@ -56,11 +59,89 @@ type Extractor interface {
 
 // ExtractionResult represents extraction result with metadata
 type ExtractionResult struct {
+	ID          string // Record ID when saved to PipelineOptions.Store
 	Invoice     *model.Invoice
 	Confidence  float64
 	Method      string
 	Warnings    []string
 	NeedsReview bool
+
+	// Vendor is the master list entry the seller matched, if any (see PipelineOptions.Vendors)
+	Vendor *VendorMatch
+
+	// Pages is the page range, such as "3-5", of an invoice split out of a
+	// PDF bundling several; empty otherwise
+	Pages string
+
+	// Source is the archive member or email attachment the document came
+	// from (see Processor.ProcessDocuments); empty otherwise
+	Source string
+
+	// Submission is the email the document was attached to, shared with
+	// its other attachments (see GroupBySubmission); nil otherwise
+	Submission *Submission
+
+	// Findings of the validation stage, also listed in Warnings (see
+	// PipelineOptions.ValidateAfterExtraction)
+	Findings []ValidationFinding
+
+	// Signals the confidence was computed from
+	Signals *ConfidenceSignals
+
+	// Duplicate is set when the invoice was seen before (see
+	// PipelineOptions.DuplicateStore); the first document is in Warnings
+	Duplicate bool
+
+	// Skipped is set for archive members and attachments that are not
+	// invoices, such as readme files or PDF copies of an XML invoice; the
+	// reason is in Warnings
+	Skipped bool
+
+	// CorrelationID tags the log records of the document (see
+	// PipelineOptions.Logger)
+	CorrelationID string
+
+	// Retries counts the stages run again after transient failures (see
+	// PipelineOptions.StageRetry)
+	Retries int
+
+	// Raw holds every LLM call of the document as sent and received: prompts,
+	// model, generation parameters, image hashes and the unparsed response
+	// (see PipelineOptions.LLMRawResponses)
+	Raw []LLMAuditEvent
+
+	// Debug holds the extracted text, page images, prompts and raw LLM
+	// responses of the document (see PipelineOptions.Debug)
+	Debug *DebugInfo
+
+	// IdempotentReplay is set when the document was submitted before and
+	// its earlier result returned (see PipelineOptions.Idempotency)
+	IdempotentReplay bool
+
+	// DeadlineExceeded is set when stages of the document were cut off by
+	// PipelineOptions.DocumentDeadline; the result holds what was read in
+	// time and needs review
+	DeadlineExceeded bool
+
+	// Tenant is the tenant the document was processed for (see
+	// PipelineOptions.Tenants)
+	Tenant string
+}
+
+// PairResult is the result of Processor.ProcessPair: the XML invoice, and
+// the fields its PDF copy gets different
+type PairResult struct {
+	*ExtractionResult
+	Discrepancies []Discrepancy
+}
+
+// StatementResult contains a bank statement extraction result with metadata
+type StatementResult struct {
+	Statement   *model.Statement
+	Confidence  float64
+	Method      string
+	Warnings    []string
+	NeedsReview bool
 }
 
 // Pipeline processes invoices through the extraction chain
@@ -80,17 +161,158 @@ type PipelineOptions struct {
 	ReviewThreshold   float64 // Below this, flag for review (default: 0.70)
 
 	// LLM Configuration
+	LLMProvider    string // Provider backend: openai, openrouter, litellm, anthropic, gemini, azure, bedrock, ollama (env: LLM_PROVIDER)
 	LLMAPIKey      string // API key (env: LLM_API_KEY)
 	LLMBaseURL     string // Base URL (env: LLM_BASE_URL)
 	LLMModel       string // Text extraction model (env: LLM_MODEL)
 	LLMVisionModel string // Vision/image extraction model (env: LLM_VISION_MODEL)
 
+	LLMFallbackModels       []string // Text models tried in order when LLMModel keeps failing
+	LLMVisionFallbackModels []string // Vision models tried in order when LLMVisionModel keeps failing
+	LLMMaxAttempts          int      // Attempts per model on transient errors (default: 3)
+	LLMRecoverFields        bool     // Re-ask for a missing seller tax ID, total or date
+	LLMSamples              int      // Self-consistency samples merged by majority vote (0 = single request)
+	LLMEnsemble             bool     // Run text and vision extraction on PDFs and merge them
+	LLMRace                 bool     // Run text and vision extraction on PDFs together; first valid invoice wins
+	LLMRedactPII            bool     // Mask names, phones, emails and bank accounts in text sent to the LLM
+	LLMBoundingBoxes        bool     // Record where vision models read each field (Invoice.FieldLocations)
+	LLMArithmeticCheck      bool     // Re-ask the LLM for amounts that do not add up (see Invoice.Corrections)
+	LLMTaxIDCheck           bool     // Reject tax IDs that fail their check digit (see ValidateTaxID)
+	LLMAddresses            bool     // Split addresses the rules cannot place with the LLM (see Party.AddressParts)
+	LLMTemperature          *float64 // Sampling temperature (nil = 0.1)
+	LLMTopP                 float64  // Nucleus sampling cutoff (0 = provider default)
+	LLMMaxTokens            int64    // Maximum output tokens (0 = 4096)
+	LLMMaxTextTokens        int      // Document text sent for extraction, in estimated tokens; longer text is truncated (0 = 24000, -1 = no limit)
+	LLMImageMaxSide         int      // Longest image side sent for vision extraction, in pixels (0 = per-model budget, -1 = send images as is)
+
+	LLMMaxConcurrency    int     // Maximum in-flight LLM requests (0 = unlimited)
+	LLMRequestsPerSecond float64 // Per-model request rate limit (0 = unlimited)
+	LLMTokensPerMinute   int     // Per-model token rate limit (0 = unlimited)
+	LLMPromptCaching     bool    // Mark the system prompt and schema for provider prompt caching (Anthropic, Bedrock)
+
+	LLMCircuitBreakerThreshold int           // Consecutive transient failures that stop calls to a model (0 = disabled)
+	LLMCircuitBreakerCooldown  time.Duration // How long a tripped model is skipped (default: 30s)
+
+	LLMHTTPClient     *http.Client      // Custom HTTP client for LLM requests
+	LLMProxy          *url.URL          // Egress proxy for LLM requests (default: HTTP(S)_PROXY)
+	LLMHeaders        map[string]string // Extra headers sent with every LLM request
+	LLMExtraBody      map[string]any    // Extra body fields sent with every request to OpenAI-compatible gateways (LiteLLM metadata, OpenRouter routing)
+	LLMTimeout        time.Duration     // HTTP client timeout (default: 120s)
+	LLMRequestTimeout time.Duration     // Per-attempt timeout for each LLM call (0 = none)
+	LLMAuditLog       io.Writer         // Receives a JSON Lines record of every LLM call
+	LLMAuditBodies    bool              // Include PII-masked prompts and responses in LLMAuditLog
+	LLMRawResponses   bool              // Keep the unredacted prompts and responses of each document in ExtractionResult.Raw
+	LLMTelemetry      LLMTelemetryHook  // Receives model, latency, attempt, tokens and outcome of every LLM call
+	Metrics           *MetricsRegistry  // Receives document, stage, failure, LLM call and token metrics (see NewMetricsRegistry)
+	Tracer            Tracer            // Traces documents, pipeline stages, PDF tools and LLM calls
+	Logger            Logger            // Logs documents, stage transitions and failures, LLM calls and retries, with a correlation ID per document
+	LLMCassette       *LLMCassette      // Replays recorded LLM responses instead of calling the provider (tests); no API key needed
+
+	// StageRetry sets how pipeline stages are run again after transient
+	// failures (timeouts, killed PDF tools, temporary IO errors), by stage
+	// (default: DefaultStageRetryPolicy for the PDF stages). RetryBudget caps
+	// the retries of one document (0 = 4, -1 = no retries).
+	StageRetry  map[Stage]StageRetryPolicy
+	RetryBudget int
+
+	// MaxMergedPages is how many pages of a long scanned PDF are extracted
+	// in groups of five and merged into one invoice (0 = 30, -1 = only the
+	// first five pages)
+	MaxMergedPages int
+
+	// Strategies is the order PDF extraction strategies are tried in
+	// (default: text, then vision); override it per request with
+	// ContextWithStrategies or ProcessOptions.Strategies
+	Strategies []Strategy
+
+	// Debug includes the intermediate artifacts of each document in
+	// ExtractionResult.Debug, to find out why a field came out wrong
+	Debug *DebugOptions
+
+	// Known supplier layouts, matched by tax ID, marker text or PDF producer
+	Layouts []Layout
+
+	// SpreadsheetMapping names the columns of XLSX and CSV invoices whose
+	// headers DefaultSpreadsheetColumns misses (nil = the defaults)
+	SpreadsheetMapping *SpreadsheetMapping
+
+	// UnitMapping maps units of measure to UN/ECE codes for
+	// LineItem.UnitCode, added to DefaultUnitMapping; an empty code unmaps
+	// a unit
+	UnitMapping map[string]string
+
+	// DocumentDeadline bounds the extraction of each document, shared out
+	// across its stages by StageShares (nil = DefaultStageShares); stages
+	// cut off return what was read in time (0 = no deadline)
+	DocumentDeadline time.Duration
+	StageShares      map[Stage]float64
+
+	// Preclassify skips documents that are neither invoices nor receipts,
+	// such as contracts and delivery photos, before LLM extraction, with
+	// ExtractionResult.Skipped set. ClassifierModel is a small model asked
+	// about the documents keywords can't tell, such as scans (default:
+	// keywords only).
+	Preclassify     bool
+	ClassifierModel string
+
+	// Vendor master list; extracted sellers are matched to it by tax ID or by
+	// name embedding similarity (requires a provider with an embeddings API)
+	Vendors              []Vendor
+	VendorMatchThreshold float64 // Lowest name similarity accepted as a match (default: 0.85)
+	LLMEmbeddingModel    string  // Embedding model for vendor matching (default: text-embedding-3-small)
+
 	// Feature flags
 	EnableLLM bool
 	EnableOCR bool
 
-	// Validation
+	// Validation: findings of the rules (default: DefaultValidationRules) are
+	// added to the warnings and lower the confidence
 	ValidateAfterExtraction bool
+	ValidationRules         []ValidationRule
+
+	// ConfidenceScorer computes Confidence from its signals (default: ScoreConfidence)
+	ConfidenceScorer ConfidenceScorer
+
+	// DuplicateStore flags invoices seen before, by seller tax ID, series,
+	// number, date and total; duplicates need review (nil = no check)
+	DuplicateStore DuplicateStore
+
+	// Store persists the results of Process, ProcessDocuments and RunBatch,
+	// keyed by the document ID of the context (see ContextWithDocumentID).
+	// Unless DuplicateStore is set, saved results are also checked for
+	// duplicates.
+	Store Store
+
+	// Idempotency returns the earlier results of a document submitted
+	// again, by ProcessOptions.IdempotencyKey or content, instead of
+	// extracting it twice (nil = every submission is processed)
+	Idempotency IdempotencyStore
+
+	// Tenants are the client companies documents can be processed for, by
+	// ID (see ContextWithTenant), each with its own prompts, models,
+	// strategies and validation rules. Their idempotency keys, duplicates
+	// and stored results are kept apart. DefaultTenant is the tenant of
+	// documents whose context names none.
+	Tenants       map[string]Tenant
+	DefaultTenant string
+
+	// Budget caps the estimated LLM spend per day, tenant and batch, and
+	// downgrades to cheaper models or stops LLM calls once a cap is
+	// reached, with the decision in ExtractionResult.Warnings (see
+	// NewBudgetController)
+	Budget *BudgetController
+
+	// Hooks enrich, filter or veto documents at stage boundaries
+	Hooks []PipelineHooks
+
+	// Webhook is notified of every processed document (see
+	// NewWebhookDispatcher). The caller closes it.
+	Webhook *WebhookDispatcher
+
+	// Events records the events of every extracted invoice for downstream
+	// systems (see NewEventRelay). A document whose events can't be
+	// recorded fails.
+	Events EventStore
 }
 
 // DefaultPipelineOptions returns default pipeline options
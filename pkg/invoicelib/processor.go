@@ -2,11 +2,15 @@ package invoicelib
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/rezonia/invoice-processor/internal/llm"
 	"github.com/rezonia/invoice-processor/internal/model"
+	"github.com/rezonia/invoice-processor/internal/outbox"
 	"github.com/rezonia/invoice-processor/internal/processor"
+	"github.com/rezonia/invoice-processor/internal/store"
 )
 
 // Processor implements Pipeline interface using internal processor
@@ -17,14 +21,110 @@ type Processor struct {
 
 // NewProcessor creates a new invoice processor with the given options
 func NewProcessor(opts PipelineOptions) *Processor {
+	// Default endpoint and models target OpenRouter; drop them for other providers
+	if opts.LLMProvider != "" && opts.LLMProvider != llm.ProviderOpenAI && opts.LLMProvider != llm.ProviderOpenRouter {
+		defaults := DefaultPipelineOptions()
+		if opts.LLMBaseURL == defaults.LLMBaseURL {
+			opts.LLMBaseURL = ""
+		}
+		if opts.LLMModel == defaults.LLMModel {
+			opts.LLMModel = ""
+		}
+		if opts.LLMVisionModel == defaults.LLMVisionModel {
+			opts.LLMVisionModel = ""
+		}
+	}
+
 	var llmExtractor *llm.Extractor
-	if opts.EnableLLM && opts.LLMAPIKey != "" {
+	var vendorMatcher processor.VendorMatcher
+	var pipelineMetrics *processor.Metrics
+	if opts.Metrics != nil {
+		pipelineMetrics = processor.NewMetrics(opts.Metrics)
+	}
+	hasProviderCredentials := opts.LLMAPIKey != "" || (opts.LLMProvider != "" && !llm.RequiresAPIKey(opts.LLMProvider))
+	if opts.EnableLLM && (hasProviderCredentials || opts.LLMCassette != nil) {
+		httpOpts := llm.HTTPOptions{
+			Client:  opts.LLMHTTPClient,
+			Proxy:   opts.LLMProxy,
+			Headers: opts.LLMHeaders,
+		}
+
 		// Build client options
-		var clientOpts []llm.ClientOption
+		clientOpts := []llm.ClientOption{
+			llm.WithHTTPClient(httpOpts.Client),
+			llm.WithProxy(httpOpts.Proxy),
+		}
+		for key, value := range httpOpts.Headers {
+			clientOpts = append(clientOpts, llm.WithHeader(key, value))
+		}
 		if opts.LLMBaseURL != "" {
 			clientOpts = append(clientOpts, llm.WithBaseURL(opts.LLMBaseURL))
 		}
+		if opts.LLMTimeout > 0 {
+			clientOpts = append(clientOpts, llm.WithTimeout(opts.LLMTimeout))
+		}
+		if opts.LLMRequestTimeout > 0 {
+			clientOpts = append(clientOpts, llm.WithRequestTimeout(opts.LLMRequestTimeout))
+		}
+		var provider llm.Provider
+		if opts.LLMProvider != "" || len(opts.LLMExtraBody) > 0 || (opts.LLMCassette != nil && hasProviderCredentials) {
+			// An unknown provider leaves the OpenAI-compatible default in place
+			if p, err := llm.NewProvider(llm.ProviderConfig{
+				Name:      opts.LLMProvider,
+				APIKey:    opts.LLMAPIKey,
+				BaseURL:   opts.LLMBaseURL,
+				Timeout:   opts.LLMTimeout,
+				HTTP:      httpOpts,
+				ExtraBody: opts.LLMExtraBody,
+			}); err == nil {
+				provider = p
+			}
+		}
+		if opts.LLMCassette != nil {
+			// Without credentials the cassette replays only
+			provider = opts.LLMCassette.Provider(provider)
+		}
+		if provider != nil {
+			clientOpts = append(clientOpts, llm.WithProvider(provider))
+		}
 
+		if opts.LLMMaxConcurrency > 0 {
+			clientOpts = append(clientOpts, llm.WithMaxConcurrency(opts.LLMMaxConcurrency))
+		}
+		if opts.LLMRequestsPerSecond > 0 || opts.LLMTokensPerMinute > 0 {
+			clientOpts = append(clientOpts, llm.WithRateLimit("", llm.RateLimit{
+				RequestsPerSecond: opts.LLMRequestsPerSecond,
+				TokensPerMinute:   opts.LLMTokensPerMinute,
+			}))
+		}
+
+		if opts.LLMAuditLog != nil {
+			clientOpts = append(clientOpts, llm.WithInterceptor(llm.NewJSONLAuditLog(opts.LLMAuditLog)))
+			if opts.LLMAuditBodies {
+				clientOpts = append(clientOpts, llm.WithAuditBodies(llm.RedactBodies(llm.NewRedactor())))
+			}
+		}
+		if opts.LLMCircuitBreakerThreshold > 0 {
+			clientOpts = append(clientOpts, llm.WithCircuitBreaker(llm.CircuitBreaker{
+				FailureThreshold: opts.LLMCircuitBreakerThreshold,
+				Cooldown:         opts.LLMCircuitBreakerCooldown,
+			}))
+		}
+		if opts.LLMTelemetry != nil {
+			clientOpts = append(clientOpts, llm.WithTelemetry(opts.LLMTelemetry))
+		}
+		if pipelineMetrics != nil {
+			clientOpts = append(clientOpts, llm.WithTelemetry(pipelineMetrics))
+		}
+		if opts.Tracer != nil {
+			clientOpts = append(clientOpts, llm.WithTracer(opts.Tracer))
+		}
+		if opts.Logger != nil {
+			clientOpts = append(clientOpts, llm.WithLogger(opts.Logger))
+		}
+		if opts.LLMPromptCaching {
+			clientOpts = append(clientOpts, llm.WithPromptCaching(true))
+		}
 		client := llm.NewClient(opts.LLMAPIKey, clientOpts...)
 
 		// Build extractor options
@@ -35,13 +135,155 @@ func NewProcessor(opts PipelineOptions) *Processor {
 		if opts.LLMVisionModel != "" {
 			extractorOpts = append(extractorOpts, llm.WithVisionModel(opts.LLMVisionModel))
 		}
+		if len(opts.LLMFallbackModels) > 0 {
+			extractorOpts = append(extractorOpts, llm.WithFallbackModels(opts.LLMFallbackModels...))
+		}
+		if len(opts.LLMVisionFallbackModels) > 0 {
+			extractorOpts = append(extractorOpts, llm.WithVisionFallbackModels(opts.LLMVisionFallbackModels...))
+		}
+		if opts.LLMMaxAttempts > 0 {
+			retry := llm.DefaultRetryPolicy
+			retry.MaxAttempts = opts.LLMMaxAttempts
+			extractorOpts = append(extractorOpts, llm.WithRetryPolicy(retry))
+		}
+		if opts.LLMRecoverFields {
+			extractorOpts = append(extractorOpts, llm.WithFieldRecovery())
+		}
+		if opts.LLMBoundingBoxes {
+			extractorOpts = append(extractorOpts, llm.WithBoundingBoxes(true))
+		}
+		if opts.LLMArithmeticCheck {
+			extractorOpts = append(extractorOpts, llm.WithArithmeticCheck(llm.DefaultArithmeticTolerance))
+		}
+		if opts.LLMTaxIDCheck {
+			extractorOpts = append(extractorOpts, llm.WithTaxIDCheck())
+		}
+		switch {
+		case opts.LLMImageMaxSide < 0:
+			extractorOpts = append(extractorOpts, llm.WithImageDownscaling(false))
+		case opts.LLMImageMaxSide > 0:
+			extractorOpts = append(extractorOpts, llm.WithImageBudget(llm.ImageBudget{MaxLongSide: opts.LLMImageMaxSide}))
+		}
+		if opts.LLMMaxTextTokens != 0 {
+			extractorOpts = append(extractorOpts, llm.WithTextTokenBudget(max(opts.LLMMaxTextTokens, 0)))
+		}
+		if opts.LLMSamples > 1 {
+			extractorOpts = append(extractorOpts, llm.WithSelfConsistency(opts.LLMSamples, 0))
+		}
+		if opts.LLMRedactPII {
+			extractorOpts = append(extractorOpts, llm.WithRedactor(llm.NewRedactor()))
+		}
+		if opts.Logger != nil {
+			extractorOpts = append(extractorOpts, llm.WithExtractorLogger(opts.Logger))
+		}
+		extractorOpts = append(extractorOpts, llm.WithGenerationParams(llm.GenerationParams{
+			Temperature: opts.LLMTemperature,
+			TopP:        opts.LLMTopP,
+			MaxTokens:   opts.LLMMaxTokens,
+		}))
 
 		llmExtractor = llm.NewExtractor(client, extractorOpts...)
+
+		if len(opts.Vendors) > 0 {
+			var matcherOpts []processor.EmbeddingMatcherOption
+			if opts.VendorMatchThreshold > 0 {
+				matcherOpts = append(matcherOpts, processor.WithMatchThreshold(opts.VendorMatchThreshold))
+			}
+			vendorMatcher = processor.NewEmbeddingMatcher(client.Embedder(opts.LLMEmbeddingModel), opts.Vendors, matcherOpts...)
+		}
 	}
 
-	pipeline := processor.NewPipeline(
+	pipelineOpts := []processor.PipelineOption{
 		processor.WithLLMExtractor(llmExtractor),
-	)
+		processor.WithEnsemble(opts.LLMEnsemble),
+		processor.WithRace(opts.LLMRace),
+		processor.WithLLMAddressParsing(opts.LLMAddresses),
+		processor.WithValidation(opts.ValidateAfterExtraction),
+	}
+	duplicates := opts.DuplicateStore
+	if duplicates == nil {
+		// Saved results double as the record of invoices seen
+		duplicates, _ = opts.Store.(processor.DuplicateStore)
+	}
+	if duplicates != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithDuplicateStore(duplicates))
+	}
+	if pipelineMetrics != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithMetrics(pipelineMetrics))
+	}
+	if opts.Tracer != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithTracer(opts.Tracer))
+	}
+	if opts.Logger != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithLogger(opts.Logger))
+	}
+	for _, hooks := range opts.Hooks {
+		pipelineOpts = append(pipelineOpts, processor.WithHooks(hooks))
+	}
+	if opts.Webhook != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithHooks(opts.Webhook.Hooks()))
+	}
+	if opts.Events != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithHooks(outbox.New(opts.Events).Hooks()))
+	}
+	if opts.ConfidenceScorer != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithConfidenceScorer(opts.ConfidenceScorer))
+	}
+	if opts.ValidationRules != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithValidationRules(opts.ValidationRules...))
+	}
+	if vendorMatcher != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithVendorMatcher(vendorMatcher))
+	}
+	if len(opts.Layouts) > 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithLayoutClassifier(processor.NewHeuristicClassifier(opts.Layouts...)))
+	}
+	for stage, policy := range opts.StageRetry {
+		pipelineOpts = append(pipelineOpts, processor.WithStageRetry(stage, policy))
+	}
+	if opts.RetryBudget != 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithRetryBudget(max(opts.RetryBudget, 0)))
+	}
+	if opts.MaxMergedPages != 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithPageMerge(max(opts.MaxMergedPages, 0)))
+	}
+	if opts.LLMRawResponses {
+		pipelineOpts = append(pipelineOpts, processor.WithRawResponses(true))
+	}
+	if len(opts.Strategies) > 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithStrategies(opts.Strategies...))
+	}
+	if opts.Debug != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithDebug(*opts.Debug))
+	}
+	if opts.Idempotency != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithIdempotency(opts.Idempotency))
+	}
+	if opts.Tenants != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithTenants(opts.Tenants))
+	}
+	if opts.DefaultTenant != "" {
+		pipelineOpts = append(pipelineOpts, processor.WithDefaultTenant(opts.DefaultTenant))
+	}
+	if opts.Budget != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithBudget(opts.Budget))
+	}
+	if opts.SpreadsheetMapping != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithSpreadsheetMapping(*opts.SpreadsheetMapping))
+	}
+	if len(opts.UnitMapping) > 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithUnitMapping(opts.UnitMapping))
+	}
+	if opts.DocumentDeadline > 0 {
+		pipelineOpts = append(pipelineOpts, processor.WithDocumentDeadline(opts.DocumentDeadline))
+	}
+	if opts.StageShares != nil {
+		pipelineOpts = append(pipelineOpts, processor.WithStageShares(opts.StageShares))
+	}
+	if opts.Preclassify {
+		pipelineOpts = append(pipelineOpts, processor.WithDocumentClassifier(processor.NewDocumentClassifier(llmExtractor, opts.ClassifierModel)))
+	}
+	pipeline := processor.NewPipeline(pipelineOpts...)
 
 	return &Processor{
 		pipeline: pipeline,
@@ -54,39 +296,141 @@ func NewDefaultProcessor() *Processor {
 	return NewProcessor(DefaultPipelineOptions())
 }
 
-// Process processes input and returns extraction result
+// Stop stops the processor from accepting documents and waits for the ones
+// in flight to finish, canceling them when ctx is done first. Documents it
+// refuses or cancels fail with ErrStopped and can be submitted again after a
+// restart.
+func (p *Processor) Stop(ctx context.Context) error {
+	return p.pipeline.Stop(ctx)
+}
+
+// Process processes input and returns extraction result. The format is
+// detected from the content; an input holding several documents, such as a
+// ZIP archive or an email with attachments, needs ProcessDocuments.
 func (p *Processor) Process(ctx context.Context, r io.Reader) (*ExtractionResult, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, &model.ParseError{Message: "failed to read input", Cause: err}
 	}
 
-	format := processor.DetectFormat(data)
+	results := p.pipeline.Process(ctx, data, processor.ProcessOptions{})
+	if len(results) != 1 {
+		return nil, &model.ParseError{Message: fmt.Sprintf("input holds %d documents, use ProcessDocuments", len(results))}
+	}
+	if results[0].Error != nil {
+		return nil, results[0].Error
+	}
 
-	var result *processor.Result
-	switch format {
-	case processor.FormatXML:
-		result = p.pipeline.ProcessXMLBytes(ctx, data)
-	case processor.FormatPDF:
-		result = p.pipeline.ProcessPDF(ctx, nil, data, "application/pdf")
-	case processor.FormatImage:
-		mimeType := detectMimeType(data)
-		result = p.pipeline.ProcessImage(ctx, data, mimeType)
-	default:
-		return nil, &model.ParseError{Message: "unsupported file format"}
+	return p.extractionResult(ctx, results[0]), nil
+}
+
+// ProcessPair reads an invoice delivered as signed XML with a PDF copy. The
+// result holds the XML invoice; fields the PDF gets different are listed in
+// Discrepancies and added to the findings, a mismatched total as an error.
+// An error is returned when the XML can't be read.
+func (p *Processor) ProcessPair(ctx context.Context, xmlReader, pdfReader io.Reader) (*PairResult, error) {
+	xmlData, err := io.ReadAll(xmlReader)
+	if err != nil {
+		return nil, &model.ParseError{Message: "failed to read XML", Cause: err}
+	}
+	pdfData, err := io.ReadAll(pdfReader)
+	if err != nil {
+		return nil, &model.ParseError{Message: "failed to read PDF", Cause: err}
 	}
 
-	if result.Error != nil {
-		return nil, result.Error
+	pair := p.pipeline.ProcessPair(ctx, xmlData, pdfData)
+	if pair.XML.Error != nil {
+		return nil, pair.XML.Error
 	}
+	pair.XML.Data = xmlData
+	return &PairResult{
+		ExtractionResult: p.extractionResult(ctx, pair.XML),
+		Discrepancies:    pair.Discrepancies,
+	}, nil
+}
 
-	return &ExtractionResult{
+// ProcessDocuments detects the format of the input and returns one result
+// per document in it: ZIP archives and emails are unpacked (Source names the
+// member or attachment) and, with SplitDocuments, PDFs bundling several
+// invoices are split. A document that fails is returned without an Invoice,
+// flagged for review with the error in its warnings; an error is returned
+// only when the input is a single document and it fails.
+func (p *Processor) ProcessDocuments(ctx context.Context, r io.Reader, opts ProcessOptions) ([]*ExtractionResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &model.ParseError{Message: "failed to read input", Cause: err}
+	}
+
+	documents := p.pipeline.Process(ctx, data, opts)
+	if len(documents) == 1 && documents[0].Error != nil && documents[0].Source == "" {
+		return nil, documents[0].Error
+	}
+
+	results := make([]*ExtractionResult, len(documents))
+	for i, result := range documents {
+		results[i] = p.extractionResult(ctx, result)
+	}
+	return results, nil
+}
+
+// extractionResult converts a pipeline result and saves it to the store, if
+// any. Failed results are flagged for review with the error in their
+// warnings; skipped ones only carry the reason.
+func (p *Processor) extractionResult(ctx context.Context, result *processor.Result) *ExtractionResult {
+	extraction := &ExtractionResult{
 		Invoice:     result.Invoice,
 		Confidence:  result.Confidence,
 		Method:      string(result.Method),
 		Warnings:    result.Warnings,
-		NeedsReview: result.Confidence < p.options.ReviewThreshold,
-	}, nil
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+		Vendor:      result.Vendor,
+		Findings:    result.Findings,
+		Signals:     result.Signals,
+		Duplicate:   result.Duplicate,
+		Source:      result.Source,
+		Submission:  result.Submission,
+
+		CorrelationID: result.CorrelationID,
+		Retries:       result.Retries,
+		Raw:           result.Raw,
+		Debug:         result.Debug,
+
+		IdempotentReplay: result.IdempotentReplay,
+		DeadlineExceeded: result.DeadlineExceeded,
+		Tenant:           result.Tenant,
+	}
+	if result.Pages != nil {
+		extraction.Pages = result.Pages.String()
+	}
+	if result.Error != nil {
+		extraction.Invoice = nil
+		extraction.Skipped = errors.Is(result.Error, processor.ErrSkipped)
+		extraction.NeedsReview = !extraction.Skipped
+		extraction.Warnings = append(extraction.Warnings, result.Error.Error())
+	}
+	if p.options.Store != nil && !result.IdempotentReplay {
+		rec := store.NewRecord(llm.DocumentIDFromContext(ctx), result, p.options.ReviewThreshold)
+		if err := p.options.Store.SaveResult(ctx, rec); err != nil {
+			extraction.Warnings = append(extraction.Warnings, fmt.Sprintf("failed to save result: %v", err))
+		} else {
+			extraction.ID = rec.ID
+		}
+	}
+	return extraction
+}
+
+// Replay runs the document of a failed record in PipelineOptions.Store
+// through the pipeline again, optionally with other strategies or another
+// model, and saves the outcome in its place with the history of attempts.
+// List failed records with StoreQuery.Failed.
+func (p *Processor) Replay(ctx context.Context, id string, opts ReplayOptions) (*StoreRecord, error) {
+	if p.options.Store == nil {
+		return nil, errors.New("replay needs PipelineOptions.Store")
+	}
+	if opts.ReviewThreshold == 0 {
+		opts.ReviewThreshold = p.options.ReviewThreshold
+	}
+	return store.Replay(ctx, p.options.Store, p.pipeline, id, opts)
 }
 
 // ProcessXML processes XML input directly
@@ -106,7 +450,11 @@ func (p *Processor) ProcessXML(ctx context.Context, r io.Reader) (*ExtractionRes
 		Confidence:  result.Confidence,
 		Method:      string(result.Method),
 		Warnings:    result.Warnings,
-		NeedsReview: result.Confidence < p.options.ReviewThreshold,
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+		Vendor:      result.Vendor,
+		Findings:    result.Findings,
+		Signals:     result.Signals,
+		Duplicate:   result.Duplicate,
 	}, nil
 }
 
@@ -127,10 +475,57 @@ func (p *Processor) ProcessPDF(ctx context.Context, r io.Reader) (*ExtractionRes
 		Confidence:  result.Confidence,
 		Method:      string(result.Method),
 		Warnings:    result.Warnings,
-		NeedsReview: result.Confidence < p.options.ReviewThreshold,
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+		Vendor:      result.Vendor,
+		Findings:    result.Findings,
+		Signals:     result.Signals,
+		Duplicate:   result.Duplicate,
 	}, nil
 }
 
+// ProcessPDFDocuments processes a PDF that may bundle several invoices and
+// returns one result per invoice in page order. An invoice that fails to
+// extract is returned without an Invoice, flagged for review with the error in
+// its warnings; an error is returned only when the file holds a single
+// document and it fails.
+func (p *Processor) ProcessPDFDocuments(ctx context.Context, r io.Reader) ([]*ExtractionResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &model.ParseError{Message: "failed to read input", Cause: err}
+	}
+
+	documents := p.pipeline.ProcessPDFDocuments(ctx, data)
+	if len(documents) == 1 && documents[0].Error != nil {
+		return nil, documents[0].Error
+	}
+
+	results := make([]*ExtractionResult, len(documents))
+	for i, result := range documents {
+		extraction := &ExtractionResult{
+			Invoice:     result.Invoice,
+			Confidence:  result.Confidence,
+			Method:      string(result.Method),
+			Warnings:    result.Warnings,
+			NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+			Vendor:      result.Vendor,
+			Findings:    result.Findings,
+			Signals:     result.Signals,
+			Duplicate:   result.Duplicate,
+		}
+		if result.Pages != nil {
+			extraction.Pages = result.Pages.String()
+		}
+		if result.Error != nil {
+			extraction.Invoice = nil
+			extraction.NeedsReview = true
+			extraction.Warnings = append(extraction.Warnings, result.Error.Error())
+		}
+		results[i] = extraction
+	}
+
+	return results, nil
+}
+
 // ProcessImage processes image input directly
 func (p *Processor) ProcessImage(ctx context.Context, imageData []byte, mimeType string) (*ExtractionResult, error) {
 	result := p.pipeline.ProcessImage(ctx, imageData, mimeType)
@@ -143,10 +538,65 @@ func (p *Processor) ProcessImage(ctx context.Context, imageData []byte, mimeType
 		Confidence:  result.Confidence,
 		Method:      string(result.Method),
 		Warnings:    result.Warnings,
-		NeedsReview: result.Confidence < p.options.ReviewThreshold,
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+		Vendor:      result.Vendor,
+		Findings:    result.Findings,
+		Signals:     result.Signals,
+		Duplicate:   result.Duplicate,
+	}, nil
+}
+
+// ProcessReceipt processes a POS receipt image or scanned PDF
+func (p *Processor) ProcessReceipt(ctx context.Context, data []byte, mimeType string) (*ExtractionResult, error) {
+	result := p.pipeline.ProcessReceipt(ctx, data, mimeType)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &ExtractionResult{
+		Invoice:     result.Invoice,
+		Confidence:  result.Confidence,
+		Method:      string(result.Method),
+		Warnings:    result.Warnings,
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.HasHandwriting || result.Duplicate || result.DeadlineExceeded,
+		Vendor:      result.Vendor,
+		Findings:    result.Findings,
+		Signals:     result.Signals,
+		Duplicate:   result.Duplicate,
 	}, nil
 }
 
+// ProcessStatement extracts a bank statement from a PDF or image for payment
+// reconciliation. Statements whose balances do not reconcile need review.
+func (p *Processor) ProcessStatement(ctx context.Context, data []byte, mimeType string) (*StatementResult, error) {
+	result := p.pipeline.ProcessStatement(ctx, data, mimeType)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &StatementResult{
+		Statement:   result.Statement,
+		Confidence:  result.Confidence,
+		Method:      string(result.Method),
+		Warnings:    result.Warnings,
+		NeedsReview: result.Confidence < p.options.ReviewThreshold || result.Statement.CheckBalances() != nil,
+	}, nil
+}
+
+// RunBatch processes inputs with a pool of workers and returns one result per
+// document, in input order, with a summary of successes, failures, LLM usage,
+// cost and duration. Failed documents are flagged for review with the error
+// in their warnings, as in ProcessDocuments.
+func (p *Processor) RunBatch(ctx context.Context, inputs []BatchInput, opts BatchOptions) ([]*ExtractionResult, *BatchSummary) {
+	documents, summary := p.pipeline.ProcessBatch(ctx, inputs, opts)
+
+	results := make([]*ExtractionResult, len(documents))
+	for i, result := range documents {
+		results[i] = p.extractionResult(ctx, result)
+	}
+	return results, summary
+}
+
 // ProcessBatch processes multiple inputs concurrently
 func (p *Processor) ProcessBatch(ctx context.Context, inputs []io.Reader) ([]*ExtractionResult, error) {
 	results := make([]*ExtractionResult, len(inputs))
@@ -174,33 +624,3 @@ func (p *Processor) ProcessBatch(ctx context.Context, inputs []io.Reader) ([]*Ex
 
 	return results, firstErr
 }
-
-// detectMimeType detects MIME type from file content
-func detectMimeType(data []byte) string {
-	if len(data) < 8 {
-		return "application/octet-stream"
-	}
-
-	// PNG
-	if data[0] == 0x89 && data[1] == 0x50 && data[2] == 0x4E && data[3] == 0x47 {
-		return "image/png"
-	}
-	// JPEG
-	if data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF {
-		return "image/jpeg"
-	}
-	// TIFF
-	if (data[0] == 0x49 && data[1] == 0x49) || (data[0] == 0x4D && data[1] == 0x4D) {
-		return "image/tiff"
-	}
-	// PDF
-	if data[0] == '%' && data[1] == 'P' && data[2] == 'D' && data[3] == 'F' {
-		return "application/pdf"
-	}
-	// XML
-	if data[0] == '<' || (data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF && data[3] == '<') {
-		return "application/xml"
-	}
-
-	return "application/octet-stream"
-}
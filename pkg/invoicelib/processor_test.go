@@ -1,8 +1,10 @@
 package invoicelib_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,14 +49,14 @@ func TestProcessorProcessXML(t *testing.T) {
 <Invoice>
 	<InvoiceNo>0000001</InvoiceNo>
 	<InvoiceSeries>KK23</InvoiceSeries>
-	<IssueDate>2024-01-15</IssueDate>
+	<InvoiceDate>2024-01-15</InvoiceDate>
 	<Seller>
-		<TaxID>0123456789</TaxID>
+		<TaxID>0123456787</TaxID>
 		<Name>Test Seller Company</Name>
 		<Address>123 Seller Street</Address>
 	</Seller>
 	<Buyer>
-		<TaxID>9876543210</TaxID>
+		<TaxID>0312345673</TaxID>
 		<Name>Test Buyer Company</Name>
 	</Buyer>
 	<TotalAmount>1000000</TotalAmount>
@@ -71,6 +73,23 @@ func TestProcessorProcessXML(t *testing.T) {
 	assert.Equal(t, 1.0, result.Confidence)
 }
 
+func TestProcessorProcessPair(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	proc := invoicelib.NewProcessor(opts)
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>0000001</InvoiceNo><Seller><TaxID>0123456789</TaxID></Seller><TotalAmount>1000000</TotalAmount></Invoice>`
+	result, err := proc.ProcessPair(context.Background(), strings.NewReader(xmlData), strings.NewReader("%PDF-1.4\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "0000001", result.Invoice.Number)
+	assert.Empty(t, result.Discrepancies)
+	require.NotEmpty(t, result.Warnings)
+	assert.Contains(t, result.Warnings[0], "PDF copy could not be read")
+
+	_, err = proc.ProcessPair(context.Background(), strings.NewReader("<Unknown/>"), strings.NewReader("%PDF-1.4\n"))
+	assert.Error(t, err)
+}
+
 func TestProcessorProcess_AutoDetectXML(t *testing.T) {
 	opts := invoicelib.DefaultPipelineOptions()
 	opts.EnableLLM = false
@@ -113,6 +132,17 @@ func TestProcessorProcessXML_InvalidXML(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestProcessorStop(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	proc := invoicelib.NewProcessor(opts)
+	require.NoError(t, proc.Stop(context.Background()))
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>0000002</InvoiceNo></Invoice>`
+	_, err := proc.Process(context.Background(), strings.NewReader(xmlData))
+	assert.ErrorIs(t, err, invoicelib.ErrStopped)
+}
+
 func TestProcessorProcessBatch(t *testing.T) {
 	opts := invoicelib.DefaultPipelineOptions()
 	opts.EnableLLM = false
@@ -140,19 +170,245 @@ func TestProcessorProcessBatch(t *testing.T) {
 	assert.Equal(t, "0002", result.Invoice.Number)
 }
 
+func TestProcessorProcessDocuments_ZIP(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	proc := invoicelib.NewProcessor(opts)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"0001.xml":   `<?xml version="1.0"?><Invoice><InvoiceNo>0001</InvoiceNo><Seller><TaxID>1111111111</TaxID></Seller></Invoice>`,
+		"readme.txt": "Exported from the provider portal",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	_, err := proc.Process(context.Background(), bytes.NewReader(buf.Bytes()))
+	require.Error(t, err, "archives hold several documents")
+
+	results, err := proc.ProcessDocuments(context.Background(), bytes.NewReader(buf.Bytes()), invoicelib.ProcessOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, r := range results {
+		switch r.Source {
+		case "0001.xml":
+			assert.Equal(t, "0001", r.Invoice.Number)
+			assert.False(t, r.Skipped)
+		case "readme.txt":
+			assert.True(t, r.Skipped)
+			assert.False(t, r.NeedsReview)
+			assert.Nil(t, r.Invoice)
+		default:
+			t.Fatalf("unexpected source %q", r.Source)
+		}
+	}
+
+	batch, summary := proc.RunBatch(context.Background(), []invoicelib.BatchInput{{Name: "export.zip", Data: buf.Bytes()}}, invoicelib.BatchOptions{})
+	require.Len(t, batch, 2)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Skipped)
+}
+
+func TestProcessorProcessDocuments_Email(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	proc := invoicelib.NewProcessor(opts)
+
+	email := strings.Join([]string{
+		"From: billing@example.com",
+		"Subject: March invoices",
+		"Message-ID: <march@example.com>",
+		`Content-Type: multipart/mixed; boundary="b1"`,
+		"",
+		"--b1",
+		`Content-Disposition: attachment; filename="0001.xml"`,
+		"",
+		`<?xml version="1.0"?><Invoice><InvoiceNo>0001</InvoiceNo><Seller><TaxID>1111111111</TaxID></Seller></Invoice>`,
+		"--b1",
+		`Content-Disposition: attachment; filename="0002.xml"`,
+		"",
+		`<?xml version="1.0"?><Invoice><InvoiceNo>0002</InvoiceNo><Seller><TaxID>1111111111</TaxID></Seller></Invoice>`,
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	results, err := proc.ProcessDocuments(context.Background(), strings.NewReader(email), invoicelib.ProcessOptions{Filename: "march.eml"})
+	require.NoError(t, err)
+	groups := invoicelib.GroupBySubmission(results)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "march@example.com", groups[0].Submission.ID)
+	assert.Equal(t, "March invoices", groups[0].Submission.Subject)
+	require.Len(t, groups[0].Results, 2)
+	assert.Equal(t, "0001", groups[0].Results[0].Invoice.Number)
+	assert.Equal(t, "0002", groups[0].Results[1].Invoice.Number)
+}
+
 func TestExtractionResult_NeedsReview(t *testing.T) {
 	opts := invoicelib.DefaultPipelineOptions()
 	opts.EnableLLM = false
 	opts.ReviewThreshold = 0.90 // Set high threshold to trigger review flag
 	proc := invoicelib.NewProcessor(opts)
 
-	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><Seller><TaxID>1234567890</TaxID></Seller></Invoice>`
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><InvoiceDate>2024-01-15</InvoiceDate><Seller><TaxID>1234567893</TaxID><Name>Seller</Name></Seller><TotalAmount>1000</TotalAmount></Invoice>`
 
 	result, err := proc.ProcessXML(context.Background(), bytes.NewReader([]byte(xmlData)))
 	require.NoError(t, err)
 
 	// XML parsing has 1.0 confidence, so NeedsReview should be false with 0.90 threshold
 	assert.False(t, result.NeedsReview)
+
+	// Validation findings lower the confidence below the threshold
+	xmlData = `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><Seller><TaxID>1234567893</TaxID></Seller></Invoice>`
+	result, err = proc.ProcessXML(context.Background(), bytes.NewReader([]byte(xmlData)))
+	require.NoError(t, err)
+	assert.True(t, result.NeedsReview)
+}
+
+func TestProcessor_Store(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	opts.Store = invoicelib.NewMemoryStore()
+	proc := invoicelib.NewProcessor(opts)
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><InvoiceDate>2024-01-15</InvoiceDate><Seller><TaxID>1234567890</TaxID><Name>Seller</Name></Seller><TotalAmount>1000</TotalAmount></Invoice>`
+
+	ctx := invoicelib.ContextWithDocumentID(context.Background(), "portal/001.xml")
+	result, err := proc.Process(ctx, strings.NewReader(xmlData))
+	require.NoError(t, err)
+	require.NotEmpty(t, result.ID)
+
+	rec, err := opts.Store.GetByID(ctx, result.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "portal/001.xml", rec.DocumentID)
+	assert.Equal(t, "001", rec.Invoice.Number)
+
+	// The store also catches the invoice arriving again
+	result, err = proc.Process(invoicelib.ContextWithDocumentID(context.Background(), "email/001.xml"), strings.NewReader(xmlData))
+	require.NoError(t, err)
+	assert.True(t, result.Duplicate)
+	assert.True(t, result.NeedsReview)
+
+	records, err := opts.Store.Query(ctx, invoicelib.StoreQuery{PendingReview: true})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "email/001.xml", records[0].DocumentID)
+}
+
+func TestProcessor_Events(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	opts.Events = invoicelib.NewMemoryEventStore()
+	proc := invoicelib.NewProcessor(opts)
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><InvoiceDate>2024-01-15</InvoiceDate><Seller><TaxID>1234567890</TaxID><Name>Seller</Name></Seller><TotalAmount>1000</TotalAmount></Invoice>`
+	_, err := proc.Process(context.Background(), strings.NewReader(xmlData))
+	require.NoError(t, err)
+
+	var published []string
+	relay, err := invoicelib.NewEventRelay(opts.Events, invoicelib.EventPublisherFunc(func(_ context.Context, e *invoicelib.InvoiceEvent) error {
+		published = append(published, e.Type)
+		return nil
+	}), invoicelib.RelayConfig{})
+	require.NoError(t, err)
+	n, err := relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{invoicelib.EventInvoiceExtracted, invoicelib.EventInvoiceValidated}, published)
+}
+
+func TestProcessor_Tenants(t *testing.T) {
+	opts := invoicelib.DefaultPipelineOptions()
+	opts.EnableLLM = false
+	opts.Store = invoicelib.NewMemoryStore()
+	opts.Tenants = map[string]invoicelib.Tenant{"acme": {}, "globex": {}}
+	opts.DefaultTenant = "acme"
+	proc := invoicelib.NewProcessor(opts)
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><InvoiceDate>2024-01-15</InvoiceDate><Seller><TaxID>1234567890</TaxID><Name>Seller</Name></Seller><TotalAmount>1000</TotalAmount></Invoice>`
+	ctx := context.Background()
+	result, err := proc.Process(invoicelib.ContextWithDocumentID(ctx, "acme/001.xml"), strings.NewReader(xmlData))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", result.Tenant)
+
+	// The same invoice sent to another client company is not its duplicate
+	result, err = proc.Process(invoicelib.ContextWithTenant(invoicelib.ContextWithDocumentID(ctx, "globex/001.xml"), "globex"), strings.NewReader(xmlData))
+	require.NoError(t, err)
+	assert.Equal(t, "globex", result.Tenant)
+	assert.False(t, result.Duplicate)
+
+	records, err := opts.Store.Query(ctx, invoicelib.StoreQuery{Tenant: "globex"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "globex/001.xml", records[0].DocumentID)
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	t.Setenv("TEST_LLM_KEY", "sk-test")
+	cfg, err := invoicelib.ParseConfig([]byte(`
+llm:
+  provider: anthropic
+  api_key: ${TEST_LLM_KEY}
+  model: claude-sonnet
+extraction:
+  strategies: [embedded_xml, text]
+  idempotency: true
+  spreadsheet:
+    columns:
+      amount: [Charge]
+validation:
+  rules: [totals]
+  review_threshold: 0.8
+budget:
+  daily: 50
+  prices:
+    claude-sonnet: {prompt: 3, completion: 15}
+`))
+	require.NoError(t, err)
+
+	opts, err := invoicelib.OptionsFromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "anthropic", opts.LLMProvider)
+	assert.Equal(t, "sk-test", opts.LLMAPIKey)
+	assert.Equal(t, "claude-sonnet", opts.LLMModel)
+	assert.Equal(t, invoicelib.DefaultPipelineOptions().LLMVisionModel, opts.LLMVisionModel)
+	assert.Equal(t, []invoicelib.Strategy{invoicelib.StrategyEmbeddedXML, invoicelib.StrategyText}, opts.Strategies)
+	assert.NotNil(t, opts.Idempotency)
+	require.Len(t, opts.ValidationRules, 1)
+	assert.Equal(t, "totals", opts.ValidationRules[0].Name)
+	assert.True(t, opts.ValidateAfterExtraction)
+	assert.Equal(t, 0.8, opts.ReviewThreshold)
+	assert.NotNil(t, opts.Budget)
+	require.NotNil(t, opts.SpreadsheetMapping)
+	assert.Equal(t, []string{"Charge"}, opts.SpreadsheetMapping.Columns["amount"])
+	assert.Nil(t, opts.Store)
+}
+
+func TestNewProcessorFromConfig(t *testing.T) {
+	cfg, err := invoicelib.ParseConfig([]byte("store:\n  type: memory\n"))
+	require.NoError(t, err)
+	proc, cleanup, err := invoicelib.NewProcessorFromConfig(context.Background(), cfg)
+	require.NoError(t, err)
+	defer cleanup()
+
+	xmlData := `<?xml version="1.0"?><Invoice><InvoiceNo>001</InvoiceNo><InvoiceDate>2024-01-15</InvoiceDate><Seller><TaxID>1234567890</TaxID><Name>Seller</Name></Seller><TotalAmount>1000</TotalAmount></Invoice>`
+	result, err := proc.Process(invoicelib.ContextWithDocumentID(context.Background(), "a.xml"), strings.NewReader(xmlData))
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.ID, "saved to the configured store")
+
+	result, err = proc.Process(invoicelib.ContextWithDocumentID(context.Background(), "b.xml"), strings.NewReader(xmlData))
+	require.NoError(t, err)
+	assert.True(t, result.Duplicate)
+
+	// The database/sql driver is the program's to register
+	cfg, err = invoicelib.ParseConfig([]byte("store:\n  type: sqlite\n  driver: unregistered\n  dsn: invoices.db\n"))
+	require.NoError(t, err)
+	_, _, err = invoicelib.NewProcessorFromConfig(context.Background(), cfg)
+	assert.Error(t, err)
 }
 
 // Test re-exported types
@@ -178,9 +434,11 @@ func TestReExportedTypes(t *testing.T) {
 	assert.Equal(t, invoicelib.ProviderFPT, invoicelib.Provider("FPT"))
 
 	// Test VAT rates
-	assert.Equal(t, invoicelib.VATRate(0), invoicelib.VATRate0)
-	assert.Equal(t, invoicelib.VATRate(5), invoicelib.VATRate5)
-	assert.Equal(t, invoicelib.VATRate(10), invoicelib.VATRate10)
+	assert.Equal(t, "0%", invoicelib.VATRate0.String())
+	assert.Equal(t, "5%", invoicelib.VATRate5.String())
+	assert.Equal(t, "8%", invoicelib.VATRate8.String())
+	assert.Equal(t, "10%", invoicelib.VATRate10.String())
+	assert.Equal(t, "KCT", invoicelib.VATRateKCT.String())
 
 	// Test invoice types
 	assert.Equal(t, invoicelib.InvoiceType("Normal"), invoicelib.InvoiceTypeNormal)